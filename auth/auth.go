@@ -0,0 +1,210 @@
+// Package auth verifies the Google-signed ID tokens that Pub/Sub push,
+// Cloud Scheduler, Cloud Tasks and Identity-Aware Proxy attach to the
+// requests they send, checking signature, expiry, audience, issuer and
+// caller email. Google's signing keys are fetched once and cached for as
+// long as Google's Cache-Control allows. JWTVerifier does the same for
+// Firebase Auth ID tokens and JWTs we sign ourselves, for customer-facing
+// APIs.
+//
+// Quick start:
+//
+//	v, err := auth.NewVerifier(ctx,
+//	    auth.WithAudience("https://worker-abc123-uc.a.run.app/push"),
+//	    auth.WithEmails("pubsub-push@my-project.iam.gserviceaccount.com"),
+//	    auth.WithLogger(lg),
+//	)
+//	if err != nil { ... }
+//	mux.Handle("/push", v.Middleware()(pushHandler))
+//
+//	func pushHandler(w http.ResponseWriter, r *http.Request) {
+//	    claims := auth.ClaimsFrom(r.Context()) // the verified caller
+//	    ...
+//	}
+//
+//	fb, err := auth.NewFirebaseVerifier("my-project")
+//	if err != nil { ... }
+//	mux.Handle("/orders", fb.Middleware()(ordersHandler)) // ClaimsFrom(ctx).Subject is the UID
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"google.golang.org/api/idtoken"
+
+	"github.com/print-engine/ieos-golang-utils/httpx"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// IAPHeader carries the token IAP signs for every request it lets through.
+const IAPHeader = "X-Goog-IAP-JWT-Assertion"
+
+// Issuers of the tokens verified here.
+var (
+	GoogleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+	IAPIssuers    = []string{"https://cloud.google.com/iap"}
+)
+
+var (
+	// ErrMissingToken is returned when the request carries no token.
+	ErrMissingToken = errors.New("auth: missing token")
+	// ErrInvalidToken wraps why a token failed verification.
+	ErrInvalidToken = errors.New("auth: invalid token")
+	// ErrForbidden is returned for a valid token of a caller not allowed by
+	// WithEmails.
+	ErrForbidden = errors.New("auth: caller not allowed")
+)
+
+type Options struct {
+	Audiences []string
+	Issuers   []string
+	Emails    []string
+	Header    string
+	Leeway    time.Duration
+	Logger    *logger.CloudLogger
+	Validator *idtoken.Validator
+}
+
+type Option func(*Options)
+
+// WithAudience sets the accepted aud claims; at least one is required. For
+// push, Scheduler and Tasks it is the audience configured on the sender,
+// by default the endpoint URL; for IAP it is
+// "/projects/NUMBER/global/backendServices/ID" or "/projects/NUMBER/apps/ID".
+func WithAudience(aud ...string) Option {
+	return func(o *Options) { o.Audiences = append(o.Audiences, aud...) }
+}
+
+// WithIssuers replaces the accepted iss claims; defaults to GoogleIssuers,
+// or IAPIssuers for NewIAPVerifier.
+func WithIssuers(iss ...string) Option { return func(o *Options) { o.Issuers = iss } }
+
+// WithEmails accepts only tokens whose verified email is listed; an entry
+// starting with "@" accepts a whole domain. By default any Google-signed
+// token for the audience passes, which for push endpoints means any
+// service account in any project.
+func WithEmails(emails ...string) Option {
+	return func(o *Options) { o.Emails = append(o.Emails, emails...) }
+}
+
+// WithLeeway allows for clock skew when a JWTVerifier checks exp, iat and
+// nbf; defaults to 1m.
+func WithLeeway(d time.Duration) Option { return func(o *Options) { o.Leeway = d } }
+
+// WithLogger logs rejected requests, with the reason but never the token,
+// at warning level.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithValidator replaces the idtoken.Validator used to check signatures,
+// e.g. to fetch Google's keys through a proxy.
+func WithValidator(v *idtoken.Validator) Option { return func(o *Options) { o.Validator = v } }
+
+// Claims are the verified contents of a token.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Audience      string
+	Issuer        string
+	IssuedAt      time.Time
+	Expires       time.Time
+	// Raw holds every claim, e.g. "hd" for IAP users' hosted domain.
+	Raw map[string]any
+}
+
+// Verifier checks ID tokens. It is safe for concurrent use.
+type Verifier struct {
+	opts Options
+}
+
+// NewVerifier returns a Verifier for the OIDC tokens Pub/Sub push, Cloud
+// Scheduler and Cloud Tasks send as "Authorization: Bearer".
+func NewVerifier(ctx context.Context, opts ...Option) (*Verifier, error) {
+	return newVerifier(ctx, Options{Issuers: GoogleIssuers}, opts)
+}
+
+// NewIAPVerifier returns a Verifier for the token IAP sends in IAPHeader.
+// Checking it guards against requests that reach the service around IAP.
+func NewIAPVerifier(ctx context.Context, opts ...Option) (*Verifier, error) {
+	return newVerifier(ctx, Options{Issuers: IAPIssuers, Header: IAPHeader}, opts)
+}
+
+func newVerifier(ctx context.Context, options Options, opts []Option) (*Verifier, error) {
+	for _, f := range opts {
+		f(&options)
+	}
+	if len(options.Audiences) == 0 {
+		return nil, errors.New("auth: at least one audience is required")
+	}
+	if options.Validator == nil {
+		client := httpx.NewClient(httpx.WithTimeout(10 * time.Second))
+		v, err := idtoken.NewValidator(ctx, idtoken.WithHTTPClient(client))
+		if err != nil {
+			return nil, fmt.Errorf("auth: new validator: %w", err)
+		}
+		options.Validator = v
+	}
+	return &Verifier{opts: options}, nil
+}
+
+// Verify checks token and returns its claims. Errors wrap ErrMissingToken,
+// ErrInvalidToken or ErrForbidden.
+func (v *Verifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	var (
+		payload *idtoken.Payload
+		errs    []error
+	)
+	for _, aud := range v.opts.Audiences {
+		p, err := v.opts.Validator.Validate(ctx, token, aud)
+		if err == nil {
+			payload = p
+			break
+		}
+		errs = append(errs, err)
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, errors.Join(errs...))
+	}
+	if !slices.Contains(v.opts.Issuers, payload.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, payload.Issuer)
+	}
+	c := &Claims{
+		Subject:  payload.Subject,
+		Audience: payload.Audience,
+		Issuer:   payload.Issuer,
+		IssuedAt: time.Unix(payload.IssuedAt, 0),
+		Expires:  time.Unix(payload.Expires, 0),
+		Raw:      payload.Claims,
+	}
+	c.Email, _ = payload.Claims["email"].(string)
+	c.EmailVerified, _ = payload.Claims["email_verified"].(bool)
+	if v.opts.Header == IAPHeader {
+		// IAP only signs for users it authenticated and sets no email_verified
+		c.EmailVerified = c.Email != ""
+	}
+	if len(v.opts.Emails) > 0 && !emailAllowed(v.opts.Emails, c) {
+		return c, fmt.Errorf("%w: %q", ErrForbidden, c.Email)
+	}
+	return c, nil
+}
+
+func emailAllowed(allowed []string, c *Claims) bool {
+	if !c.EmailVerified {
+		return false
+	}
+	email := strings.ToLower(c.Email)
+	for _, e := range allowed {
+		e = strings.ToLower(e)
+		if e == email || (strings.HasPrefix(e, "@") && strings.HasSuffix(email, e)) {
+			return true
+		}
+	}
+	return false
+}
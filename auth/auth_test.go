@@ -0,0 +1,341 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/auth"
+)
+
+const (
+	testKid      = "key-1"
+	testAudience = "https://worker.example.com/push"
+	testIssuer   = "https://issuer.example.com"
+)
+
+var (
+	signingKey = mustRSAKey()
+	otherKey   = mustRSAKey()
+)
+
+func mustRSAKey() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}
+
+// jwksServer serves signingKey's public half as a JWKS under testKid and
+// counts the fetches.
+func jwksServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var fetches atomic.Int32
+	pub := signingKey.PublicKey
+	body, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": testKid,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &fetches
+}
+
+// claims returns valid claims for testAudience and testIssuer.
+func claims() jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            testIssuer,
+		"aud":            testAudience,
+		"sub":            "user-1",
+		"email":          "worker@my-project.iam.gserviceaccount.com",
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	}
+}
+
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key any, c jwt.MapClaims) string {
+	t.Helper()
+	tok := jwt.NewWithClaims(method, c)
+	if kid != "" {
+		tok.Header["kid"] = kid
+	}
+	s, err := tok.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func with(c jwt.MapClaims, key string, v any) jwt.MapClaims {
+	c[key] = v
+	return c
+}
+
+func TestJWTVerifier(t *testing.T) {
+	srv, _ := jwksServer(t)
+	v, err := auth.NewJWTVerifier(auth.JWKS(srv.URL),
+		auth.WithAudience(testAudience),
+		auth.WithIssuers(testIssuer),
+		auth.WithEmails("@my-project.iam.gserviceaccount.com"),
+		auth.WithLeeway(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubDER, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour := time.Hour
+
+	tests := []struct {
+		name  string
+		token string
+		want  error // nil for a valid token
+	}{
+		{"valid", sign(t, jwt.SigningMethodRS256, testKid, signingKey, claims()), nil},
+		{"audience in list", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "aud", []string{"other", testAudience})), nil},
+		{"missing", "", auth.ErrMissingToken},
+		{"malformed", "not-a-jwt", auth.ErrInvalidToken},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "aud", "https://other.example.com")), auth.ErrInvalidToken},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "iss", "https://evil.example.com")), auth.ErrInvalidToken},
+		{"expired", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "exp", time.Now().Add(-hour).Unix())), auth.ErrInvalidToken},
+		{"no expiry", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "exp", nil)), auth.ErrInvalidToken},
+		{"issued in the future", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "iat", time.Now().Add(hour).Unix())), auth.ErrInvalidToken},
+		{"not yet valid", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "nbf", time.Now().Add(hour).Unix())), auth.ErrInvalidToken},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "key-2", signingKey, claims()), auth.ErrInvalidToken},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, testKid, otherKey, claims()), auth.ErrInvalidToken},
+		{"alg none", sign(t, jwt.SigningMethodNone, testKid, jwt.UnsafeAllowNoneSignatureType, claims()), auth.ErrInvalidToken},
+		{"alg HS256 with the public key as secret", sign(t, jwt.SigningMethodHS256, testKid, pubDER, claims()), auth.ErrInvalidToken},
+		{"alg ES256 header for an RSA key", func() string {
+			tok := sign(t, jwt.SigningMethodRS256, testKid, signingKey, claims())
+			return reheader(t, tok, map[string]any{"alg": "ES256", "kid": testKid, "typ": "JWT"})
+		}(), auth.ErrInvalidToken},
+		{"email outside the allowed domain", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "email", "someone@gmail.com")), auth.ErrForbidden},
+		{"unverified email", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "email_verified", false)), auth.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := v.Verify(context.Background(), tt.token)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if c.Subject != "user-1" || c.Audience != testAudience || c.Issuer != testIssuer {
+					t.Errorf("claims = %+v", c)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// reheader replaces the header of a signed token, keeping its payload and
+// signature.
+func reheader(t *testing.T, token string, header map[string]any) string {
+	t.Helper()
+	b, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		t.Fatalf("token %q has %d parts", token, len(parts))
+	}
+	return base64.RawURLEncoding.EncodeToString(b) + "." + parts[1] + "." + parts[2]
+}
+
+func TestJWTVerifierRequiresAudience(t *testing.T) {
+	if _, err := auth.NewJWTVerifier(auth.HMAC([]byte("secret"))); err == nil {
+		t.Fatal("NewJWTVerifier without an audience succeeded")
+	}
+}
+
+func TestJWTVerifierHMAC(t *testing.T) {
+	v, err := auth.NewJWTVerifier(auth.HMAC([]byte("secret")), auth.WithAudience(testAudience))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", sign(t, jwt.SigningMethodHS256, "", []byte("secret"), claims()), nil},
+		{"wrong secret", sign(t, jwt.SigningMethodHS256, "", []byte("guess"), claims()), auth.ErrInvalidToken},
+		{"alg RS256", sign(t, jwt.SigningMethodRS256, "", signingKey, claims()), auth.ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token)
+			if (tt.want == nil && err != nil) || (tt.want != nil && !errors.Is(err, tt.want)) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestJWKSCachesKeys(t *testing.T) {
+	srv, fetches := jwksServer(t)
+	keys := auth.JWKS(srv.URL)
+	for i := 0; i < 3; i++ {
+		if _, err := keys.Key(context.Background(), testKid); err != nil {
+			t.Fatalf("Key: %v", err)
+		}
+	}
+	// an unknown kid right after a fetch must not hammer the endpoint
+	if _, err := keys.Key(context.Background(), "key-2"); err == nil {
+		t.Fatal("Key for an unknown kid succeeded")
+	}
+	if n := fetches.Load(); n != 1 {
+		t.Errorf("fetched keys %d times, want 1", n)
+	}
+}
+
+func TestJWKSFetchFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	if _, err := auth.JWKS(srv.URL).Key(context.Background(), testKid); err == nil {
+		t.Fatal("Key succeeded without keys")
+	}
+}
+
+// redirect sends every request to srv, standing in for Google's cert
+// endpoints.
+type redirect struct{ srv *url.URL }
+
+func (rt redirect) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = rt.srv.Scheme, rt.srv.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestVerifier(t *testing.T) {
+	srv, _ := jwksServer(t)
+	u, err := url.Parse(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	validator, err := idtoken.NewValidator(context.Background(), option.WithHTTPClient(&http.Client{Transport: redirect{u}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := auth.NewVerifier(context.Background(),
+		auth.WithAudience(testAudience),
+		auth.WithEmails("worker@my-project.iam.gserviceaccount.com"),
+		auth.WithValidator(validator),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	google := func() jwt.MapClaims { return with(claims(), "iss", "https://accounts.google.com") }
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"valid", sign(t, jwt.SigningMethodRS256, testKid, signingKey, google()), nil},
+		{"missing", "", auth.ErrMissingToken},
+		{"wrong audience", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(google(), "aud", "https://other.example.com")), auth.ErrInvalidToken},
+		{"wrong issuer", sign(t, jwt.SigningMethodRS256, testKid, signingKey, claims()), auth.ErrInvalidToken},
+		{"expired", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(google(), "exp", time.Now().Add(-time.Hour).Unix())), auth.ErrInvalidToken},
+		{"unknown kid", sign(t, jwt.SigningMethodRS256, "key-2", signingKey, google()), auth.ErrInvalidToken},
+		{"signed by another key", sign(t, jwt.SigningMethodRS256, testKid, otherKey, google()), auth.ErrInvalidToken},
+		{"alg HS256", sign(t, jwt.SigningMethodHS256, testKid, []byte("secret"), google()), auth.ErrInvalidToken},
+		{"other caller", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(google(), "email", "intruder@other.iam.gserviceaccount.com")), auth.ErrForbidden},
+		{"unverified email", sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(google(), "email_verified", false)), auth.ErrForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := v.Verify(context.Background(), tt.token)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if c.Email != "worker@my-project.iam.gserviceaccount.com" || !c.EmailVerified {
+					t.Errorf("claims = %+v", c)
+				}
+				return
+			}
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	srv, _ := jwksServer(t)
+	v, err := auth.NewJWTVerifier(auth.JWKS(srv.URL), auth.WithAudience(testAudience), auth.WithEmails("@my-project.iam.gserviceaccount.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := v.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c := auth.ClaimsFrom(r.Context()); c == nil || c.Subject != "user-1" {
+			t.Errorf("ClaimsFrom = %+v", c)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"valid", "Bearer " + sign(t, jwt.SigningMethodRS256, testKid, signingKey, claims()), http.StatusNoContent},
+		{"missing", "", http.StatusUnauthorized},
+		{"not bearer", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"expired", "Bearer " + sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "exp", time.Now().Add(-time.Hour).Unix())), http.StatusUnauthorized},
+		{"forbidden", "Bearer " + sign(t, jwt.SigningMethodRS256, testKid, signingKey, with(claims(), "email", "someone@gmail.com")), http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/push", nil)
+			if tt.header != "" {
+				r.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
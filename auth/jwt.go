@@ -0,0 +1,139 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"github.com/print-engine/ieos-golang-utils/middleware"
+)
+
+// FirebaseKeysURL serves the keys Firebase Auth signs ID tokens with.
+const FirebaseKeysURL = "https://www.googleapis.com/service_accounts/v1/jwk/securetoken@system.gserviceaccount.com"
+
+// firebaseKeys is shared so every Firebase verifier uses one key cache.
+var firebaseKeys = JWKS(FirebaseKeysURL)
+
+// JWTVerifier checks bearer JWTs signed by Firebase Auth or by our own
+// issuers. It is safe for concurrent use.
+type JWTVerifier struct {
+	opts   Options
+	keys   KeySource
+	parser *jwt.Parser
+	// check runs issuer-specific checks after the common ones.
+	check func(c *Claims, now time.Time) error
+}
+
+// NewJWTVerifier returns a JWTVerifier for tokens signed with keys, read
+// from "Authorization: Bearer". WithAudience is required; issuers are only
+// checked when set with WithIssuers.
+func NewJWTVerifier(keys KeySource, opts ...Option) (*JWTVerifier, error) {
+	options := Options{Leeway: time.Minute}
+	for _, f := range opts {
+		f(&options)
+	}
+	if len(options.Audiences) == 0 {
+		return nil, errors.New("auth: at least one audience is required")
+	}
+	return &JWTVerifier{
+		opts: options,
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(keys.Algorithms()),
+			jwt.WithLeeway(options.Leeway),
+			jwt.WithIssuedAt(),
+			jwt.WithExpirationRequired(),
+		),
+	}, nil
+}
+
+// NewFirebaseVerifier returns a JWTVerifier for the ID tokens Firebase
+// Auth issues to users of projectID, checked as the Firebase Admin SDK
+// does. Claims.Subject is the user's UID.
+func NewFirebaseVerifier(projectID string, opts ...Option) (*JWTVerifier, error) {
+	if projectID == "" {
+		return nil, errors.New("auth: firebase project ID is required")
+	}
+	opts = append([]Option{
+		WithAudience(projectID),
+		WithIssuers("https://securetoken.google.com/" + projectID),
+	}, opts...)
+	v, err := NewJWTVerifier(firebaseKeys, opts...)
+	if err != nil {
+		return nil, err
+	}
+	v.parser = jwt.NewParser(
+		jwt.WithValidMethods([]string{"RS256"}),
+		jwt.WithLeeway(v.opts.Leeway),
+		jwt.WithIssuedAt(),
+		jwt.WithExpirationRequired(),
+	)
+	v.check = func(c *Claims, now time.Time) error {
+		if c.Subject == "" || len(c.Subject) > 128 {
+			return errors.New("invalid sub claim")
+		}
+		authTime, ok := c.Raw["auth_time"].(float64)
+		if !ok || time.Unix(int64(authTime), 0).After(now.Add(v.opts.Leeway)) {
+			return errors.New("invalid auth_time claim")
+		}
+		return nil
+	}
+	return v, nil
+}
+
+// Verify checks token and returns its claims. Errors wrap ErrMissingToken,
+// ErrInvalidToken or ErrForbidden.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Claims, error) {
+	if token == "" {
+		return nil, ErrMissingToken
+	}
+	mc := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, mc, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	c := &Claims{Raw: mc}
+	c.Subject, _ = mc.GetSubject()
+	c.Issuer, _ = mc.GetIssuer()
+	c.Email, _ = mc["email"].(string)
+	c.EmailVerified, _ = mc["email_verified"].(bool)
+	if t, _ := mc.GetIssuedAt(); t != nil {
+		c.IssuedAt = t.Time
+	}
+	if t, _ := mc.GetExpirationTime(); t != nil {
+		c.Expires = t.Time
+	}
+	aud, _ := mc.GetAudience()
+	for _, a := range aud {
+		if slices.Contains(v.opts.Audiences, a) {
+			c.Audience = a
+			break
+		}
+	}
+	if c.Audience == "" {
+		return nil, fmt.Errorf("%w: unexpected audience %q", ErrInvalidToken, aud)
+	}
+	if len(v.opts.Issuers) > 0 && !slices.Contains(v.opts.Issuers, c.Issuer) {
+		return nil, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, c.Issuer)
+	}
+	if v.check != nil {
+		if err := v.check(c, time.Now()); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+	}
+	if len(v.opts.Emails) > 0 && !emailAllowed(v.opts.Emails, c) {
+		return c, fmt.Errorf("%w: %q", ErrForbidden, c.Email)
+	}
+	return c, nil
+}
+
+// Middleware verifies the bearer token of each request like
+// Verifier.Middleware does.
+func (v *JWTVerifier) Middleware() middleware.Middleware { return guard(v, v.opts) }
@@ -0,0 +1,195 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/httpx"
+)
+
+// KeySource supplies the keys a JWTVerifier checks signatures with.
+type KeySource interface {
+	// Key returns the key for the token's kid header, which may be empty.
+	Key(ctx context.Context, kid string) (any, error)
+	// Algorithms lists the alg headers the keys may be used with.
+	Algorithms() []string
+}
+
+var asymmetricAlgorithms = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// HMAC returns a KeySource for tokens signed with a shared secret (HS256,
+// HS384 or HS512), whatever their kid.
+func HMAC(secret []byte) KeySource { return hmacSource(secret) }
+
+type hmacSource []byte
+
+func (s hmacSource) Key(context.Context, string) (any, error) { return []byte(s), nil }
+func (hmacSource) Algorithms() []string                       { return []string{"HS256", "HS384", "HS512"} }
+
+// StaticKeys returns a KeySource for fixed public keys by kid; the key
+// under "" is used for tokens without a kid.
+func StaticKeys(keys map[string]crypto.PublicKey) KeySource { return staticSource(keys) }
+
+type staticSource map[string]crypto.PublicKey
+
+func (s staticSource) Key(_ context.Context, kid string) (any, error) {
+	if k, ok := s[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("auth: unknown key %q", kid)
+}
+
+func (staticSource) Algorithms() []string { return asymmetricAlgorithms }
+
+// JWKS returns a KeySource that fetches a JSON Web Key Set from url and
+// caches it as long as its Cache-Control allows (an hour without one). A
+// kid not in the cache triggers a refetch, at most once a minute, so
+// rotated keys are picked up early; if a refetch fails the cached keys are
+// still used.
+func JWKS(url string) KeySource {
+	return &jwksSource{url: url, client: httpx.NewClient(httpx.WithTimeout(10 * time.Second))}
+}
+
+type jwksSource struct {
+	url    string
+	client *http.Client
+
+	mu      sync.Mutex
+	keys    map[string]any
+	fetched time.Time
+	expires time.Time
+}
+
+func (s *jwksSource) Algorithms() []string { return asymmetricAlgorithms }
+
+func (s *jwksSource) Key(ctx context.Context, kid string) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	k, ok := s.keys[kid]
+	if ok && now.Before(s.expires) {
+		return k, nil
+	}
+	if now.After(s.expires) || now.Sub(s.fetched) > time.Minute {
+		if err := s.refresh(ctx, now); err != nil {
+			if ok {
+				return k, nil
+			}
+			return nil, err
+		}
+	}
+	if k, ok := s.keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("auth: unknown key %q", kid)
+}
+
+func (s *jwksSource) refresh(ctx context.Context, now time.Time) error {
+	s.fetched = now
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("auth: fetch keys: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("auth: fetch keys: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("auth: fetch keys: %s", resp.Status)
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("auth: decode keys: %w", err)
+	}
+	keys := make(map[string]any, len(set.Keys))
+	for _, j := range set.Keys {
+		if j.Use != "" && j.Use != "sig" {
+			continue
+		}
+		k, err := j.publicKey()
+		if err != nil {
+			// skip key types we cannot use rather than failing the set
+			continue
+		}
+		keys[j.Kid] = k
+	}
+	s.keys = keys
+	s.expires = now.Add(maxAge(resp.Header.Get("Cache-Control"), time.Hour))
+	return nil
+}
+
+// maxAge returns the max-age of a Cache-Control header, or def.
+func maxAge(cacheControl string, def time.Duration) time.Duration {
+	for _, d := range strings.Split(cacheControl, ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(d), "max-age="); ok {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				return time.Duration(n) * time.Second
+			}
+		}
+	}
+	return def
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (j jwk) publicKey() (crypto.PublicKey, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch j.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", j.Kty)
+	}
+}
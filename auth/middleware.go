@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/print-engine/ieos-golang-utils/middleware"
+)
+
+type claimsKey struct{}
+
+// Middleware verifies the token of each request before calling the next
+// handler, answering 401 for a missing or invalid token and 403 for a
+// caller not allowed by WithEmails. Pub/Sub push and Cloud Tasks treat
+// both as failed deliveries and retry them. The claims are available
+// through ClaimsFrom, and the request logger bound by
+// middleware.RequestLogger gains a user_id label with the token's subject.
+func (v *Verifier) Middleware() middleware.Middleware { return guard(v, v.opts) }
+
+type tokenVerifier interface {
+	Verify(ctx context.Context, token string) (*Claims, error)
+}
+
+func guard(v tokenVerifier, opts Options) middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, err := v.Verify(r.Context(), token(r, opts.Header))
+			if err != nil {
+				reject(w, r, opts, claims, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), claimsKey{}, claims)
+			if rl := middleware.LoggerFrom(ctx); rl != nil && claims.Subject != "" {
+				ctx = middleware.ContextWithLogger(ctx, rl.WithLabels(map[string]string{"user_id": claims.Subject}))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// ClaimsFrom returns the claims verified by Middleware, or nil.
+func ClaimsFrom(ctx context.Context) *Claims {
+	c, _ := ctx.Value(claimsKey{}).(*Claims)
+	return c
+}
+
+// BearerToken returns the token of r's "Authorization: Bearer" header,
+// or "".
+func BearerToken(r *http.Request) string { return token(r, "") }
+
+func token(r *http.Request, header string) string {
+	if header != "" {
+		return r.Header.Get(header)
+	}
+	scheme, tok, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(tok)
+}
+
+func reject(w http.ResponseWriter, r *http.Request, opts Options, claims *Claims, err error) {
+	status := http.StatusUnauthorized
+	if errors.Is(err, ErrForbidden) {
+		status = http.StatusForbidden
+	} else if opts.Header == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+	}
+	if lg := opts.Logger; lg != nil {
+		data := map[string]any{"path": r.URL.Path, "status": status, "error": err.Error()}
+		if claims != nil {
+			data["email"] = claims.Email
+		}
+		lg.Warning(r.Context(), r, "request rejected", data)
+	}
+	http.Error(w, http.StatusText(status), status)
+}
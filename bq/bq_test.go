@@ -0,0 +1,326 @@
+package bq_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/bq"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+type printEvent struct {
+	JobID string `bigquery:"job_id"`
+	Pages int    `bigquery:"pages"`
+}
+
+type insertRow struct {
+	InsertID string `json:"insertId"`
+	JSON     struct {
+		JobID string `json:"job_id"`
+	} `json:"json"`
+}
+
+// fakeBigQuery answers insertAll requests with respond, called with the
+// 0-based request number and its rows, and records the requests.
+type fakeBigQuery struct {
+	respond func(n int, rows []insertRow) (status int, body string)
+	tables  map[string]bool // existing tables, for WithCreateTable
+
+	mu       sync.Mutex
+	requests [][]insertRow
+	created  []string
+}
+
+func (f *fakeBigQuery) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/insertAll"):
+		var req struct{ Rows []insertRow }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		n := len(f.requests)
+		f.requests = append(f.requests, req.Rows)
+		status, body := http.StatusOK, `{}`
+		if f.respond != nil {
+			status, body = f.respond(n, req.Rows)
+		}
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	case r.Method == http.MethodGet:
+		if !f.tables[r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]] {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error":{"code":404,"message":"Not found: Table"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{}`))
+	case r.Method == http.MethodPost:
+		var t struct {
+			TableReference struct{ TableID string }
+			Schema         struct{ Fields []struct{ Name string } }
+		}
+		_ = json.NewDecoder(r.Body).Decode(&t)
+		f.created = append(f.created, t.TableReference.TableID+":"+t.Schema.Fields[0].Name)
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
+func (f *fakeBigQuery) log() [][]insertRow {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([][]insertRow(nil), f.requests...)
+}
+
+// inserter returns an Inserter writing to an in-process fakeBigQuery.
+func inserter(t *testing.T, f *fakeBigQuery, opts ...bq.Option) *bq.Inserter[printEvent] {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+	client, err := bigquery.NewClient(ctx, "my-proj", option.WithEndpoint(srv.URL+"/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	ins, err := bq.NewInserter[printEvent](ctx, "my-proj", "telemetry", "print_events", append([]bq.Option{
+		bq.WithClient(client),
+		bq.WithRetry(retryx.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ins
+}
+
+// rowErrors answers with the given insert errors, by row index and reason,
+// in index order.
+func rowErrors(errs map[int]string) string {
+	var b strings.Builder
+	b.WriteString(`{"insertErrors":[`)
+	for index := 0; len(errs) > 0; index++ {
+		reason, ok := errs[index]
+		if !ok {
+			continue
+		}
+		delete(errs, index)
+		e, _ := json.Marshal(map[string]any{"index": index, "errors": []map[string]string{{"reason": reason, "message": reason + " row"}}})
+		b.Write(e)
+		if len(errs) > 0 {
+			b.WriteByte(',')
+		}
+	}
+	b.WriteString(`]}`)
+	return b.String()
+}
+
+func TestInsert(t *testing.T) {
+	rows := []printEvent{{"job-1", 1}, {"job-2", 2}, {"job-3", 3}}
+	tests := []struct {
+		name        string
+		respond     func(n int, rows []insertRow) (int, string)
+		wantRetried []string // jobs of each request after the first
+		wantFailed  []string // jobs of the InsertError
+		wantErr     bool
+	}{
+		{"all inserted", nil, nil, nil, false},
+		{"invalid row not retried", func(int, []insertRow) (int, string) {
+			return 200, rowErrors(map[int]string{1: "invalid"})
+		}, nil, []string{"job-2"}, true},
+		{"stopped rows retried", func(n int, _ []insertRow) (int, string) {
+			if n == 0 {
+				return 200, rowErrors(map[int]string{0: "stopped", 1: "invalid", 2: "stopped"})
+			}
+			return 200, `{}`
+		}, []string{"job-1,job-3"}, []string{"job-2"}, true},
+		{"retries run out", func(int, []insertRow) (int, string) {
+			return 200, rowErrors(map[int]string{0: "timeout"})
+		}, []string{"job-1", "job-1"}, []string{"job-1"}, true},
+		{"request rejected", func(int, []insertRow) (int, string) {
+			return 400, `{"error":{"code":400,"message":"no such field"}}`
+		}, nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeBigQuery{respond: tt.respond}
+			ins := inserter(t, f, bq.WithBatch(10, 0))
+			err := ins.Insert(context.Background(), rows)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Insert = %v, want error %v", err, tt.wantErr)
+			}
+			log := f.log()
+			if got := jobs(log[0]); got != "job-1,job-2,job-3" {
+				t.Errorf("first request = %s", got)
+			}
+			var retried []string
+			for i, req := range log[1:] {
+				retried = append(retried, jobs(req))
+				// retries keep insert IDs, so BigQuery deduplicates them
+				if req[0].InsertID != insertID(log[0], req[0].JSON.JobID) {
+					t.Errorf("retry %d changed the insert ID", i+1)
+				}
+			}
+			if strings.Join(retried, " ") != strings.Join(tt.wantRetried, " ") {
+				t.Errorf("retried %v, want %v", retried, tt.wantRetried)
+			}
+			var ierr *bq.InsertError[printEvent]
+			if errors.As(err, &ierr) != (tt.wantFailed != nil) {
+				t.Fatalf("err = %v, want InsertError %v", err, tt.wantFailed != nil)
+			}
+			if ierr != nil {
+				var failed []string
+				for _, r := range ierr.Rows {
+					failed = append(failed, r.Row.JobID)
+				}
+				if strings.Join(failed, ",") != strings.Join(tt.wantFailed, ",") {
+					t.Errorf("failed rows %v, want %v", failed, tt.wantFailed)
+				}
+			}
+		})
+	}
+}
+
+func jobs(rows []insertRow) string {
+	ids := make([]string, len(rows))
+	for i, r := range rows {
+		ids[i] = r.JSON.JobID
+	}
+	return strings.Join(ids, ",")
+}
+
+func insertID(rows []insertRow, job string) string {
+	for _, r := range rows {
+		if r.JSON.JobID == job {
+			return r.InsertID
+		}
+	}
+	return ""
+}
+
+func TestBuffering(t *testing.T) {
+	f := &fakeBigQuery{}
+	ins := inserter(t, f, bq.WithBatch(2, 0))
+	ctx := context.Background()
+	if err := ins.Add(ctx, printEvent{"job-1", 1}); err != nil || len(f.log()) != 0 {
+		t.Fatalf("Add = %v, %d requests before a full batch", err, len(f.log()))
+	}
+	if err := ins.Add(ctx, printEvent{"job-2", 1}, printEvent{"job-3", 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ins.Add(ctx, printEvent{"job-4", 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ins.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, req := range f.log() {
+		got = append(got, jobs(req))
+	}
+	// a full buffer is inserted in batches of the batch size
+	if want := "job-1,job-2 job-3 job-4"; strings.Join(got, " ") != want {
+		t.Errorf("requests %v, want %s", got, want)
+	}
+}
+
+func TestBackgroundFlush(t *testing.T) {
+	f := &fakeBigQuery{}
+	errs := make(chan error, 1)
+	ins := inserter(t, f, bq.WithBatch(100, 10*time.Millisecond), bq.WithErrorHandler(func(err error) { errs <- err }))
+	defer ins.Close(context.Background())
+	if err := ins.Add(context.Background(), printEvent{"job-1", 1}); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for len(f.log()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if len(f.log()) != 1 {
+		t.Fatal("buffered row not flushed in the background")
+	}
+
+	f.mu.Lock()
+	f.respond = func(int, []insertRow) (int, string) { return 200, rowErrors(map[int]string{0: "invalid"}) }
+	f.mu.Unlock()
+	if err := ins.Add(context.Background(), printEvent{"job-2", 1}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-errs:
+		var ierr *bq.InsertError[printEvent]
+		if !errors.As(err, &ierr) {
+			t.Errorf("error handler got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("background flush error not reported")
+	}
+}
+
+func TestCreateTable(t *testing.T) {
+	tests := []struct {
+		name        string
+		exists      bool
+		wantCreated string
+	}{
+		{"missing table created", false, "print_events:job_id"},
+		{"existing table kept", true, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeBigQuery{tables: map[string]bool{"print_events": tt.exists}}
+			inserter(t, f, bq.WithCreateTable(nil), bq.WithBatch(1, 0))
+			if got := strings.Join(f.created, ","); got != tt.wantCreated {
+				t.Errorf("created %q, want %q", got, tt.wantCreated)
+			}
+		})
+	}
+}
+
+func TestInsertErrorMessage(t *testing.T) {
+	one := &bq.InsertError[printEvent]{Rows: []bq.FailedRow[printEvent]{{Err: errors.New("invalid row")}}}
+	if got := one.Error(); got != "bq: 1 row failed: invalid row" {
+		t.Errorf("Error = %q", got)
+	}
+	one.Rows = append(one.Rows, bq.FailedRow[printEvent]{Err: errors.New("stopped")})
+	if got := one.Error(); got != "bq: 2 rows failed, first: invalid row" {
+		t.Errorf("Error = %q", got)
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &googleapi.Error{Code: 429}, true},
+		{"unavailable", &googleapi.Error{Code: 503}, true},
+		{"backend error reason", &googleapi.Error{Code: 400, Errors: []googleapi.ErrorItem{{Reason: "backendError"}}}, true},
+		{"rate limit reason", &googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}, true},
+		{"invalid", &googleapi.Error{Code: 400, Errors: []googleapi.ErrorItem{{Reason: "invalid"}}}, false},
+		{"not found", &googleapi.Error{Code: 404}, false},
+		{"network", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"other", errors.New("schema mismatch"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bq.Retryable(tt.err); got != tt.want {
+				t.Errorf("Retryable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
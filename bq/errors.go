@@ -0,0 +1,42 @@
+package bq
+
+import (
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+)
+
+// FailedRow is a row BigQuery did not insert, with its errors.
+type FailedRow[T any] struct {
+	Row T
+	Err error
+}
+
+// InsertError lists the rows of an insert that failed for good: rejected as
+// invalid, or still failing when the retries ran out. The other rows of the
+// insert were inserted.
+type InsertError[T any] struct {
+	Rows []FailedRow[T]
+}
+
+func (e *InsertError[T]) Error() string {
+	if len(e.Rows) == 1 {
+		return fmt.Sprintf("bq: 1 row failed: %v", e.Rows[0].Err)
+	}
+	return fmt.Sprintf("bq: %d rows failed, first: %v", len(e.Rows), e.Rows[0].Err)
+}
+
+// rowRetryable reports whether a row of a partial failure may succeed when
+// sent again: BigQuery stops valid rows alongside invalid ones ("stopped")
+// and fails rows on timeouts and backend errors, but "invalid" rows never
+// succeed.
+func rowRetryable(re bigquery.RowInsertionError) bool {
+	for _, err := range re.Errors {
+		var e *bigquery.Error
+		if errors.As(err, &e) && e.Reason == "invalid" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,377 @@
+// Package bq streams rows into BigQuery through a typed Inserter that
+// batches rows, retries transient failures and only the rows that failed,
+// and reports rows BigQuery rejected.
+//
+// Quick start:
+//
+//	type PrintEvent struct {
+//	    JobID     string    `bigquery:"job_id"`
+//	    Printer   string    `bigquery:"printer"`
+//	    Pages     int       `bigquery:"pages"`
+//	    PrintedAt time.Time `bigquery:"printed_at"`
+//	}
+//
+//	ins, err := bq.NewInserter[PrintEvent](ctx, "", "telemetry", "print_events",
+//	    bq.WithCreateTable(&bigquery.TableMetadata{
+//	        TimePartitioning: &bigquery.TimePartitioning{Field: "printed_at"},
+//	    }),
+//	    bq.WithLogger(lg), // a *logger.CloudLogger
+//	)
+//	if err != nil { return err }
+//	defer ins.Close(ctx)
+//
+//	ins.Add(ctx, PrintEvent{JobID: "42", Printer: "hp-7", Pages: 3, PrintedAt: time.Now()})
+package bq
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+	"google.golang.org/api/googleapi"
+)
+
+type Options struct {
+	BatchSize           int
+	FlushInterval       time.Duration
+	Retry               retryx.Policy
+	CreateTable         *bigquery.TableMetadata
+	SkipInvalidRows     bool
+	IgnoreUnknownValues bool
+	Logger              *logger.CloudLogger
+	OnError             func(error)
+	Client              *bigquery.Client
+}
+
+type Option func(*Options)
+
+// WithBatch sets how many rows Add buffers before inserting them, and the
+// longest a row waits in the buffer; defaults to 500 rows and 1s. A zero
+// interval only flushes full batches, on Flush and on Close.
+func WithBatch(size int, interval time.Duration) Option {
+	return func(o *Options) { o.BatchSize, o.FlushInterval = size, interval }
+}
+
+// WithRetry sets the retry policy of inserts; its Retryable defaults to
+// transient BigQuery and network errors. Defaults to 5 attempts.
+func WithRetry(p retryx.Policy) Option { return func(o *Options) { o.Retry = p } }
+
+// WithCreateTable creates the table on NewInserter if it does not exist,
+// with meta (e.g. partitioning) and, unless meta sets one, the schema
+// inferred from T.
+func WithCreateTable(meta *bigquery.TableMetadata) Option {
+	return func(o *Options) {
+		if meta == nil {
+			meta = &bigquery.TableMetadata{}
+		}
+		o.CreateTable = meta
+	}
+}
+
+// WithSkipInvalidRows inserts the valid rows of a batch with invalid ones,
+// instead of BigQuery rejecting the whole batch; invalid rows are still
+// reported.
+func WithSkipInvalidRows() Option { return func(o *Options) { o.SkipInvalidRows = true } }
+
+// WithIgnoreUnknownValues drops values not in the table's schema instead of
+// rejecting their rows.
+func WithIgnoreUnknownValues() Option { return func(o *Options) { o.IgnoreUnknownValues = true } }
+
+// WithLogger logs rows that failed for good through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithErrorHandler calls f with the errors of background flushes, which
+// have no caller to return them to.
+func WithErrorHandler(f func(error)) Option { return func(o *Options) { o.OnError = f } }
+
+// WithClient uses an existing client instead of creating one; Close then
+// leaves the client open.
+func WithClient(c *bigquery.Client) Option { return func(o *Options) { o.Client = c } }
+
+// Inserter streams rows of type T into one table. T is a struct whose
+// `bigquery` tags name the columns. It is safe for concurrent use.
+type Inserter[T any] struct {
+	opts       Options
+	client     *bigquery.Client
+	ownsClient bool
+	inserter   *bigquery.Inserter
+	table      string
+	schema     bigquery.Schema
+
+	mu   sync.Mutex
+	buf  []row[T]
+	stop chan struct{}
+	done chan struct{}
+}
+
+// row is a buffered row with the insert ID BigQuery deduplicates retries
+// by.
+type row[T any] struct {
+	value    T
+	insertID string
+}
+
+// Schema infers the BigQuery schema of T from its fields and `bigquery`
+// tags.
+func Schema[T any]() (bigquery.Schema, error) {
+	var v T
+	return bigquery.InferSchema(v)
+}
+
+// NewInserter returns an Inserter for projectID.datasetID.tableID; an empty
+// projectID is detected from the environment.
+func NewInserter[T any](ctx context.Context, projectID, datasetID, tableID string, opts ...Option) (*Inserter[T], error) {
+	options := Options{BatchSize: 500, FlushInterval: time.Second, Retry: retryx.Policy{MaxAttempts: 5}}
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.BatchSize < 1 {
+		options.BatchSize = 1
+	}
+	if options.Retry.Retryable == nil {
+		options.Retry.Retryable = Retryable
+	}
+	schema, err := Schema[T]()
+	if err != nil {
+		return nil, fmt.Errorf("bq: infer schema: %w", err)
+	}
+
+	ins := &Inserter[T]{opts: options, client: options.Client, schema: schema}
+	if ins.client == nil {
+		if projectID == "" {
+			projectID = bigquery.DetectProjectID
+		}
+		client, err := bigquery.NewClient(ctx, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("bq: new client: %w", err)
+		}
+		ins.client, ins.ownsClient = client, true
+	}
+	table := ins.client.Dataset(datasetID).Table(tableID)
+	if options.CreateTable != nil {
+		if err := createTable(ctx, table, options.CreateTable, schema); err != nil {
+			ins.closeClient()
+			return nil, err
+		}
+	}
+	ins.inserter, ins.table = table.Inserter(), table.FullyQualifiedName()
+	ins.inserter.SkipInvalidRows = options.SkipInvalidRows
+	ins.inserter.IgnoreUnknownValues = options.IgnoreUnknownValues
+
+	if options.FlushInterval > 0 {
+		ins.stop, ins.done = make(chan struct{}), make(chan struct{})
+		go ins.flushLoop()
+	}
+	return ins, nil
+}
+
+func createTable(ctx context.Context, table *bigquery.Table, meta *bigquery.TableMetadata, schema bigquery.Schema) error {
+	if _, err := table.Metadata(ctx); err == nil {
+		return nil
+	} else if !isStatus(err, http.StatusNotFound) {
+		return fmt.Errorf("bq: table %s: %w", table.FullyQualifiedName(), err)
+	}
+	m := *meta
+	if m.Schema == nil {
+		m.Schema = schema
+	}
+	if err := table.Create(ctx, &m); err != nil && !isStatus(err, http.StatusConflict) {
+		// a conflict means another instance created it first
+		return fmt.Errorf("bq: create table %s: %w", table.FullyQualifiedName(), err)
+	}
+	return nil
+}
+
+func (ins *Inserter[T]) flushLoop() {
+	defer close(ins.done)
+	t := time.NewTicker(ins.opts.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ins.stop:
+			return
+		case <-t.C:
+			if err := ins.Flush(context.Background()); err != nil && ins.opts.OnError != nil {
+				ins.opts.OnError(err)
+			}
+		}
+	}
+}
+
+// Add buffers rows and inserts the buffer once it holds a full batch,
+// returning that insert's error. Buffered rows are otherwise inserted in the
+// background every flush interval.
+func (ins *Inserter[T]) Add(ctx context.Context, rows ...T) error {
+	ins.mu.Lock()
+	for _, v := range rows {
+		ins.buf = append(ins.buf, row[T]{value: v, insertID: newInsertID()})
+	}
+	var batch []row[T]
+	if len(ins.buf) >= ins.opts.BatchSize {
+		batch, ins.buf = ins.buf, nil
+	}
+	ins.mu.Unlock()
+	if batch == nil {
+		return nil
+	}
+	return ins.insert(ctx, batch)
+}
+
+// Flush inserts the buffered rows.
+func (ins *Inserter[T]) Flush(ctx context.Context) error {
+	ins.mu.Lock()
+	batch := ins.buf
+	ins.buf = nil
+	ins.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	return ins.insert(ctx, batch)
+}
+
+// Insert inserts rows at once, bypassing the buffer.
+func (ins *Inserter[T]) Insert(ctx context.Context, rows []T) error {
+	batch := make([]row[T], len(rows))
+	for i, v := range rows {
+		batch[i] = row[T]{value: v, insertID: newInsertID()}
+	}
+	return ins.insert(ctx, batch)
+}
+
+// Close stops the background flush, inserts the buffered rows and releases
+// the client unless it was passed with WithClient.
+func (ins *Inserter[T]) Close(ctx context.Context) error {
+	if ins.stop != nil {
+		close(ins.stop)
+		<-ins.done
+	}
+	err := ins.Flush(ctx)
+	if cerr := ins.closeClient(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (ins *Inserter[T]) closeClient() error {
+	if ins.ownsClient {
+		return ins.client.Close()
+	}
+	return nil
+}
+
+// errRowsPending asks for another attempt with the rows of a partial
+// failure that may still succeed.
+var errRowsPending = errors.New("bq: rows pending retry")
+
+// insert puts rows in batches of BatchSize, retrying failed requests and,
+// after a partial failure, the rows that did not fail for good.
+func (ins *Inserter[T]) insert(ctx context.Context, rows []row[T]) error {
+	var errs []error
+	for start := 0; start < len(rows); start += ins.opts.BatchSize {
+		if err := ins.insertBatch(ctx, rows[start:min(start+ins.opts.BatchSize, len(rows))]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (ins *Inserter[T]) insertBatch(ctx context.Context, rows []row[T]) error {
+	pending := rows
+	var failed []FailedRow[T]
+	var lastRowErrs map[string]error
+	policy := ins.opts.Retry
+	policy.Retryable = retryx.AnyOf(isRowsPending, ins.opts.Retry.Retryable)
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		savers := make([]*bigquery.StructSaver, len(pending))
+		for i, r := range pending {
+			savers[i] = &bigquery.StructSaver{Schema: ins.schema, InsertID: r.insertID, Struct: r.value}
+		}
+		err := ins.inserter.Put(ctx, savers)
+		var pme bigquery.PutMultiError
+		if !errors.As(err, &pme) {
+			return err
+		}
+		var retry []row[T]
+		lastRowErrs = map[string]error{}
+		for _, re := range pme {
+			r := pending[re.RowIndex]
+			if rowRetryable(re) {
+				retry = append(retry, r)
+				lastRowErrs[r.insertID] = re.Errors
+				continue
+			}
+			failed = append(failed, FailedRow[T]{Row: r.value, Err: re.Errors})
+		}
+		pending = retry
+		if len(pending) == 0 {
+			return nil
+		}
+		return errRowsPending
+	})
+	switch {
+	case errors.Is(err, errRowsPending):
+		for _, r := range pending {
+			failed = append(failed, FailedRow[T]{Row: r.value, Err: lastRowErrs[r.insertID]})
+		}
+	case err != nil:
+		ins.logFailure(ctx, len(pending), err)
+		return fmt.Errorf("bq: insert %d rows: %w", len(pending), err)
+	}
+	if len(failed) == 0 {
+		return nil
+	}
+	ierr := &InsertError[T]{Rows: failed}
+	ins.logFailure(ctx, len(failed), ierr)
+	return ierr
+}
+
+func isRowsPending(err error) bool { return errors.Is(err, errRowsPending) }
+
+func (ins *Inserter[T]) logFailure(ctx context.Context, rows int, err error) {
+	if ins.opts.Logger == nil {
+		return
+	}
+	ins.opts.Logger.Error(ctx, nil, "bigquery insert failed", map[string]any{
+		"table": ins.table,
+		"rows":  rows,
+		"error": err.Error(),
+	})
+}
+
+func newInsertID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Retryable reports whether a BigQuery request error is transient: rate
+// limits, backend errors and network failures.
+func Retryable(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		switch gerr.Code {
+		case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		for _, e := range gerr.Errors {
+			if e.Reason == "backendError" || e.Reason == "rateLimitExceeded" {
+				return true
+			}
+		}
+		return false
+	}
+	return retryx.NetworkErrors(err)
+}
+
+func isStatus(err error, code int) bool {
+	var gerr *googleapi.Error
+	return errors.As(err, &gerr) && gerr.Code == code
+}
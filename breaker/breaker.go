@@ -0,0 +1,273 @@
+// Package breaker stops calling a failing dependency for a while instead of
+// piling up requests against it, and probes it with a few requests before
+// resuming normal traffic.
+//
+// Quick start:
+//
+//	slack := breaker.New("slack",
+//	    breaker.WithPolicy(breaker.FailureRate(0.5, 20, time.Minute)),
+//	    breaker.WithOpenTimeout(30*time.Second),
+//	    breaker.WithLogger(lg), // a *logger.CloudLogger
+//	)
+//	err := slack.Do(ctx, func(ctx context.Context) error {
+//	    return postMessage(ctx, msg)
+//	})
+//	if errors.Is(err, breaker.ErrOpen) {
+//	    // Slack is failing; skip or queue the message
+//	}
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// State is the state of a breaker.
+type State int
+
+const (
+	// StateClosed lets every call through and records its outcome.
+	StateClosed State = iota
+	// StateOpen rejects every call until the open timeout has passed.
+	StateOpen
+	// StateHalfOpen lets a few probe calls through; their outcome closes or
+	// reopens the breaker.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+var (
+	// ErrOpen is returned, wrapped with the breaker's name, for calls
+	// rejected while the breaker is open.
+	ErrOpen = errors.New("circuit open")
+	// ErrTooManyRequests is returned, wrapped with the breaker's name, for
+	// calls rejected while the half-open probes are in flight.
+	ErrTooManyRequests = errors.New("circuit half-open, too many requests")
+)
+
+type Options struct {
+	Policy           Policy
+	OpenTimeout      time.Duration
+	HalfOpenRequests int
+	IsFailure        func(error) bool
+	OnStateChange    func(ctx context.Context, name string, from, to State)
+	Logger           *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithPolicy sets when the closed breaker opens; defaults to
+// ConsecutiveFailures(5).
+func WithPolicy(p Policy) Option { return func(o *Options) { o.Policy = p } }
+
+// WithOpenTimeout sets how long the breaker stays open before probing the
+// dependency again; defaults to 30s.
+func WithOpenTimeout(d time.Duration) Option { return func(o *Options) { o.OpenTimeout = d } }
+
+// WithHalfOpenRequests sets how many probe calls run while half-open, all
+// of which must succeed to close the breaker; defaults to 1.
+func WithHalfOpenRequests(n int) Option { return func(o *Options) { o.HalfOpenRequests = n } }
+
+// WithFailureClassifier decides which errors count as failures of the
+// dependency. By default every error does except context.Canceled, which
+// is the caller giving up; use it to ignore e.g. validation errors.
+func WithFailureClassifier(f func(error) bool) Option {
+	return func(o *Options) { o.IsFailure = f }
+}
+
+// WithStateChange calls f after every state change, e.g. to export the
+// state as a metric.
+func WithStateChange(f func(ctx context.Context, name string, from, to State)) Option {
+	return func(o *Options) { o.OnStateChange = f }
+}
+
+// WithLogger logs state changes through lg: opening at warning, the others
+// at info level.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// Breaker guards calls to one dependency. It is safe for concurrent use.
+type Breaker struct {
+	name string
+	opts Options
+
+	mu         sync.Mutex
+	state      State
+	generation uint64 // bumped on every state change to drop stale outcomes
+	openedAt   time.Time
+	inFlight   int // half-open probes running
+	successes  int // half-open probes succeeded
+}
+
+// New returns a closed Breaker; name identifies it in errors and logs.
+func New(name string, opts ...Option) *Breaker {
+	options := Options{
+		OpenTimeout:      30 * time.Second,
+		HalfOpenRequests: 1,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.Policy == nil {
+		options.Policy = ConsecutiveFailures(5)
+	}
+	if options.HalfOpenRequests < 1 {
+		options.HalfOpenRequests = 1
+	}
+	if options.IsFailure == nil {
+		options.IsFailure = isFailure
+	}
+	return &Breaker{name: name, opts: options}
+}
+
+func isFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// Name returns the breaker's name.
+func (b *Breaker) Name() string { return b.name }
+
+// State returns the current state. An open breaker whose timeout has passed
+// reports StateOpen until the next call moves it to half-open.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+// Do calls fn unless the breaker rejects the call, and records the outcome.
+// Rejected calls return an error wrapping ErrOpen or ErrTooManyRequests
+// without calling fn. A panic in fn counts as a failure and is re-raised.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := DoValue(ctx, b, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// DoValue is Do for calls that return a value.
+func DoValue[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error)) (v T, err error) {
+	done, err := b.Allow(ctx)
+	if err != nil {
+		return v, err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			done(fmt.Errorf("panic: %v", r))
+			panic(r)
+		}
+	}()
+	v, err = fn(ctx)
+	done(err)
+	return v, err
+}
+
+// Allow reserves a call for code that cannot be wrapped in a function, such
+// as a stream: it returns ErrOpen or ErrTooManyRequests (wrapped) if the call
+// must not be made, and otherwise a done func to report the call's error,
+// or nil, exactly once.
+func (b *Breaker) Allow(ctx context.Context) (done func(err error), err error) {
+	b.mu.Lock()
+	now := time.Now()
+	var changed []transition
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.opts.OpenTimeout {
+		changed = append(changed, b.setState(StateHalfOpen, now))
+	}
+	switch b.state {
+	case StateOpen:
+		err = fmt.Errorf("breaker %s: %w", b.name, ErrOpen)
+	case StateHalfOpen:
+		if b.inFlight >= b.opts.HalfOpenRequests {
+			err = fmt.Errorf("breaker %s: %w", b.name, ErrTooManyRequests)
+		} else {
+			b.inFlight++
+		}
+	}
+	generation := b.generation
+	b.mu.Unlock()
+	b.notify(ctx, changed)
+	if err != nil {
+		return nil, err
+	}
+
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.record(ctx, generation, b.opts.IsFailure(err)) })
+	}, nil
+}
+
+func (b *Breaker) record(ctx context.Context, generation uint64, failed bool) {
+	b.mu.Lock()
+	if generation != b.generation {
+		// the call started before the last state change
+		b.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	var changed []transition
+	switch b.state {
+	case StateClosed:
+		b.opts.Policy.Record(failed, now)
+		if failed && b.opts.Policy.Tripped(now) {
+			changed = append(changed, b.setState(StateOpen, now))
+		}
+	case StateHalfOpen:
+		b.inFlight--
+		if failed {
+			changed = append(changed, b.setState(StateOpen, now))
+		} else if b.successes++; b.successes >= b.opts.HalfOpenRequests {
+			changed = append(changed, b.setState(StateClosed, now))
+		}
+	}
+	b.mu.Unlock()
+	b.notify(ctx, changed)
+}
+
+type transition struct{ from, to State }
+
+// setState must be called with b.mu held.
+func (b *Breaker) setState(to State, now time.Time) transition {
+	t := transition{from: b.state, to: to}
+	b.state = to
+	b.generation++
+	b.inFlight, b.successes = 0, 0
+	switch to {
+	case StateOpen:
+		b.openedAt = now
+	case StateClosed:
+		b.opts.Policy.Reset()
+	}
+	return t
+}
+
+func (b *Breaker) notify(ctx context.Context, changed []transition) {
+	for _, t := range changed {
+		if lg := b.opts.Logger; lg != nil {
+			data := map[string]any{"breaker": b.name, "from": t.from.String(), "to": t.to.String()}
+			if t.to == StateOpen {
+				data["openTimeout"] = b.opts.OpenTimeout.String()
+				lg.Warning(ctx, nil, "circuit breaker opened", data)
+			} else {
+				lg.Info(ctx, nil, "circuit breaker "+t.to.String(), data)
+			}
+		}
+		if b.opts.OnStateChange != nil {
+			b.opts.OnStateChange(ctx, b.name, t.from, t.to)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package breaker_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/breaker"
+)
+
+var t0 = time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+// outcome is one recorded call of a policy test.
+type outcome struct {
+	failed bool
+	at     time.Duration // since t0
+}
+
+func fails(n int, at time.Duration) []outcome {
+	out := make([]outcome, n)
+	for i := range out {
+		out[i] = outcome{true, at}
+	}
+	return out
+}
+
+func oks(n int, at time.Duration) []outcome {
+	out := make([]outcome, n)
+	for i := range out {
+		out[i] = outcome{false, at}
+	}
+	return out
+}
+
+func TestPolicies(t *testing.T) {
+	rate := func() breaker.Policy { return breaker.FailureRate(0.5, 4, 10*time.Second) }
+	tests := []struct {
+		name     string
+		policy   breaker.Policy
+		outcomes []outcome
+		checkAt  time.Duration
+		want     bool
+	}{
+		{"consecutive below n", breaker.ConsecutiveFailures(3), fails(2, 0), 0, false},
+		{"consecutive at n", breaker.ConsecutiveFailures(3), fails(3, 0), 0, true},
+		{"consecutive reset by a success", breaker.ConsecutiveFailures(3),
+			append(append(fails(2, 0), oks(1, 0)...), fails(2, 0)...), 0, false},
+		{"consecutive n below one", breaker.ConsecutiveFailures(0), fails(1, 0), 0, true},
+		{"rate below min requests", rate(), fails(3, 0), 0, false},
+		{"rate at threshold", rate(), append(fails(2, 0), oks(2, 0)...), 0, true},
+		{"rate below threshold", rate(), append(fails(1, 0), oks(3, 0)...), 0, false},
+		{"rate counts the whole window", rate(), append(fails(2, 0), oks(2, 9*time.Second)...), 9 * time.Second, true},
+		{"rate forgets old calls", rate(), append(fails(4, 0), fails(1, 10*time.Second)...), 10 * time.Second, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, o := range tt.outcomes {
+				tt.policy.Record(o.failed, t0.Add(o.at))
+			}
+			if got := tt.policy.Tripped(t0.Add(tt.checkAt)); got != tt.want {
+				t.Errorf("Tripped = %v, want %v", got, tt.want)
+			}
+			tt.policy.Reset()
+			if tt.policy.Tripped(t0.Add(tt.checkAt)) {
+				t.Error("Tripped after Reset")
+			}
+		})
+	}
+}
+
+var errDown = errors.New("dependency down")
+
+func TestBreaker(t *testing.T) {
+	ctx := context.Background()
+	type step struct {
+		err     error         // returned by the call
+		sleep   time.Duration // before the call
+		wantErr error         // from Do
+		want    breaker.State // after the call
+	}
+	tests := []struct {
+		name     string
+		halfOpen int
+		steps    []step
+	}{
+		{
+			name: "opens after the policy trips",
+			steps: []step{
+				{err: errDown, wantErr: errDown, want: breaker.StateClosed},
+				{err: errDown, wantErr: errDown, want: breaker.StateOpen},
+				{wantErr: breaker.ErrOpen, want: breaker.StateOpen},
+			},
+		},
+		{
+			name: "cancellation is not a failure",
+			steps: []step{
+				{err: context.Canceled, wantErr: context.Canceled, want: breaker.StateClosed},
+				{err: context.Canceled, wantErr: context.Canceled, want: breaker.StateClosed},
+			},
+		},
+		{
+			name: "probe closes",
+			steps: []step{
+				{err: errDown, wantErr: errDown},
+				{err: errDown, wantErr: errDown, want: breaker.StateOpen},
+				{sleep: 30 * time.Millisecond, want: breaker.StateClosed},
+				{err: errDown, wantErr: errDown, want: breaker.StateClosed},
+			},
+		},
+		{
+			name: "probe reopens",
+			steps: []step{
+				{err: errDown, wantErr: errDown},
+				{err: errDown, wantErr: errDown, want: breaker.StateOpen},
+				{sleep: 30 * time.Millisecond, err: errDown, wantErr: errDown, want: breaker.StateOpen},
+				{wantErr: breaker.ErrOpen, want: breaker.StateOpen},
+			},
+		},
+		{
+			name:     "all probes must succeed",
+			halfOpen: 2,
+			steps: []step{
+				{err: errDown, wantErr: errDown},
+				{err: errDown, wantErr: errDown, want: breaker.StateOpen},
+				{sleep: 30 * time.Millisecond, want: breaker.StateHalfOpen},
+				{want: breaker.StateClosed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var changes []string
+			b := breaker.New("slack",
+				breaker.WithPolicy(breaker.ConsecutiveFailures(2)),
+				breaker.WithOpenTimeout(20*time.Millisecond),
+				breaker.WithHalfOpenRequests(tt.halfOpen),
+				breaker.WithStateChange(func(_ context.Context, name string, from, to breaker.State) {
+					changes = append(changes, fmt.Sprintf("%s:%s->%s", name, from, to))
+				}),
+			)
+			for i, s := range tt.steps {
+				time.Sleep(s.sleep)
+				err := b.Do(ctx, func(context.Context) error { return s.err })
+				if !errors.Is(err, s.wantErr) {
+					t.Fatalf("step %d: err = %v, want %v", i, err, s.wantErr)
+				}
+				if got := b.State(); got != s.want {
+					t.Fatalf("step %d: state = %s, want %s (changes %v)", i, got, s.want, changes)
+				}
+			}
+		})
+	}
+}
+
+func TestHalfOpenLimitsProbes(t *testing.T) {
+	ctx := context.Background()
+	b := breaker.New("slack", breaker.WithPolicy(breaker.ConsecutiveFailures(1)), breaker.WithOpenTimeout(time.Millisecond))
+	_ = b.Do(ctx, func(context.Context) error { return errDown })
+	time.Sleep(5 * time.Millisecond)
+
+	done, err := b.Allow(ctx)
+	if err != nil {
+		t.Fatalf("probe Allow: %v", err)
+	}
+	if _, err := b.Allow(ctx); !errors.Is(err, breaker.ErrTooManyRequests) {
+		t.Errorf("second Allow = %v, want ErrTooManyRequests", err)
+	}
+	done(nil)
+	done(errDown) // only the first report counts
+	if got := b.State(); got != breaker.StateClosed {
+		t.Errorf("state = %s, want closed", got)
+	}
+}
+
+func TestStaleOutcomeIgnored(t *testing.T) {
+	ctx := context.Background()
+	b := breaker.New("slack", breaker.WithPolicy(breaker.ConsecutiveFailures(1)), breaker.WithOpenTimeout(time.Hour))
+	slow, err := b.Allow(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = b.Do(ctx, func(context.Context) error { return errDown })
+	slow(nil) // started while closed, must not count against the open breaker
+	if got := b.State(); got != breaker.StateOpen {
+		t.Errorf("state = %s, want open", got)
+	}
+}
+
+func TestFailureClassifier(t *testing.T) {
+	invalid := errors.New("invalid message")
+	b := breaker.New("slack",
+		breaker.WithPolicy(breaker.ConsecutiveFailures(1)),
+		breaker.WithFailureClassifier(func(err error) bool { return err != nil && !errors.Is(err, invalid) }),
+	)
+	_ = b.Do(context.Background(), func(context.Context) error { return invalid })
+	if got := b.State(); got != breaker.StateClosed {
+		t.Errorf("state = %s, want closed for an ignored error", got)
+	}
+}
+
+func TestPanicCountsAsFailure(t *testing.T) {
+	b := breaker.New("slack", breaker.WithPolicy(breaker.ConsecutiveFailures(1)))
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic swallowed")
+			}
+		}()
+		_ = b.Do(context.Background(), func(context.Context) error { panic("nil map") })
+	}()
+	if got := b.State(); got != breaker.StateOpen {
+		t.Errorf("state = %s, want open", got)
+	}
+}
+
+func TestDoValue(t *testing.T) {
+	b := breaker.New("slack")
+	v, err := breaker.DoValue(context.Background(), b, func(context.Context) (string, error) { return "ts-1", nil })
+	if err != nil || v != "ts-1" {
+		t.Errorf("DoValue = %q, %v; want ts-1", v, err)
+	}
+}
@@ -0,0 +1,88 @@
+package breaker
+
+import "time"
+
+// Policy decides when a closed breaker opens. The breaker serializes calls
+// to it, so implementations need no locking.
+type Policy interface {
+	// Record records the outcome of a call.
+	Record(failed bool, now time.Time)
+	// Tripped reports whether the breaker should open; it is asked after
+	// every failure.
+	Tripped(now time.Time) bool
+	// Reset forgets all outcomes; it is called when the breaker closes.
+	Reset()
+}
+
+// ConsecutiveFailures opens the breaker after n failures in a row.
+func ConsecutiveFailures(n int) Policy {
+	return &consecutive{n: max(n, 1)}
+}
+
+type consecutive struct{ n, failures int }
+
+func (c *consecutive) Record(failed bool, _ time.Time) {
+	if failed {
+		c.failures++
+	} else {
+		c.failures = 0
+	}
+}
+
+func (c *consecutive) Tripped(time.Time) bool { return c.failures >= c.n }
+func (c *consecutive) Reset()                 { c.failures = 0 }
+
+// rateBuckets is how many slices the failure-rate window is counted in.
+const rateBuckets = 10
+
+// FailureRate opens the breaker once at least threshold (0 to 1) of the
+// calls in the trailing window failed, provided there were at least
+// minRequests of them, so a single failure on a quiet dependency does not
+// open it.
+func FailureRate(threshold float64, minRequests int, window time.Duration) Policy {
+	return &failureRate{
+		threshold:   threshold,
+		minRequests: max(minRequests, 1),
+		bucket:      max(window/rateBuckets, time.Millisecond),
+	}
+}
+
+type failureRate struct {
+	threshold   float64
+	minRequests int
+	bucket      time.Duration
+	buckets     [rateBuckets]rateBucket
+}
+
+// rateBucket counts the calls of one slice of the window; epoch numbers the
+// slice since the Unix epoch.
+type rateBucket struct {
+	epoch           int64
+	total, failures int
+}
+
+func (f *failureRate) Record(failed bool, now time.Time) {
+	epoch := now.UnixNano() / int64(f.bucket)
+	b := &f.buckets[epoch%rateBuckets]
+	if b.epoch != epoch {
+		b.epoch, b.total, b.failures = epoch, 0, 0
+	}
+	b.total++
+	if failed {
+		b.failures++
+	}
+}
+
+func (f *failureRate) Tripped(now time.Time) bool {
+	epoch := now.UnixNano() / int64(f.bucket)
+	total, failures := 0, 0
+	for _, b := range f.buckets {
+		if epoch-b.epoch < rateBuckets {
+			total += b.total
+			failures += b.failures
+		}
+	}
+	return total >= f.minRequests && float64(failures) >= f.threshold*float64(total)
+}
+
+func (f *failureRate) Reset() { f.buckets = [rateBuckets]rateBucket{} }
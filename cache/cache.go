@@ -0,0 +1,109 @@
+// Package cache provides a generic Cache interface with an in-memory
+// LRU+TTL implementation and a Redis one, a Loader that fills a cache on
+// misses with one load per key however many callers miss at once, and
+// hit/miss counts reported to the metrics package.
+//
+// Quick start:
+//
+//	names := cache.NewLRU[string, string](10_000, cache.WithTTL(time.Hour), cache.WithName("channel-names"), cache.WithMetrics(m))
+//	resolve := cache.NewLoader[string, string](names, func(ctx context.Context, id string) (string, error) {
+//	    return slack.ChannelName(ctx, id)
+//	})
+//	name, err := resolve.Get(ctx, channelID) // one Slack call per ID per hour
+//
+//	// shared across instances
+//	products := cache.NewRedis[string, Product](rdb, "catalog:", cache.WithTTL(10*time.Minute))
+package cache
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/metrics"
+)
+
+// Cache maps keys to values for a while. Implementations are safe for
+// concurrent use.
+type Cache[K comparable, V any] interface {
+	// Get returns the value for key and whether it was found.
+	Get(ctx context.Context, key K) (V, bool, error)
+	// Set stores v for ttl, or the cache's default TTL when ttl is zero.
+	Set(ctx context.Context, key K, v V, ttl time.Duration) error
+	// Delete removes key; deleting a missing key is not an error.
+	Delete(ctx context.Context, key K) error
+}
+
+type Options struct {
+	TTL     time.Duration
+	Name    string
+	Metrics *metrics.Client
+	Logger  *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithTTL sets the default TTL of entries, 10m by default.
+func WithTTL(d time.Duration) Option { return func(o *Options) { o.TTL = d } }
+
+// WithName names the cache in metrics and logs, such as "channel-names".
+func WithName(name string) Option { return func(o *Options) { o.Name = name } }
+
+// WithMetrics counts lookups in m's counter cache/lookups, labeled by
+// cache name and result: "hit", "miss" or "error".
+func WithMetrics(m *metrics.Client) Option { return func(o *Options) { o.Metrics = m } }
+
+// WithLogger logs a Loader's failed cache reads and writes at warning
+// level; the Loader carries on without the cache.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+func newOptions(opts []Option) Options {
+	options := Options{TTL: 10 * time.Minute}
+	for _, f := range opts {
+		f(&options)
+	}
+	return options
+}
+
+// Stats counts a cache's lookups since it was created.
+type Stats struct {
+	Hits, Misses, Errors uint64
+}
+
+// recorder counts lookups; caches embed it for their Stats method.
+type recorder struct {
+	name                 string
+	hits, misses, errors atomic.Uint64
+	counter              *metrics.Counter
+}
+
+func newRecorder(o Options) *recorder {
+	r := &recorder{name: o.Name}
+	if o.Metrics != nil {
+		r.counter = o.Metrics.Counter("cache/lookups")
+	}
+	return r
+}
+
+func (r *recorder) record(found bool, err error) {
+	result := "miss"
+	switch {
+	case err != nil:
+		r.errors.Add(1)
+		result = "error"
+	case found:
+		r.hits.Add(1)
+		result = "hit"
+	default:
+		r.misses.Add(1)
+	}
+	if r.counter != nil {
+		r.counter.Inc(metrics.Labels{"cache": r.name, "result": result})
+	}
+}
+
+// Stats returns the lookup counts.
+func (r *recorder) Stats() Stats {
+	return Stats{Hits: r.hits.Load(), Misses: r.misses.Load(), Errors: r.errors.Load()}
+}
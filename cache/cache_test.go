@@ -0,0 +1,243 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/cache"
+)
+
+func TestLRU(t *testing.T) {
+	ctx := context.Background()
+	type op struct {
+		get string // key to read, or "" to set
+		set string
+	}
+	tests := []struct {
+		name     string
+		size     int
+		ops      []op
+		wantKeys []string
+		gone     []string
+	}{
+		{
+			name:     "evicts the oldest",
+			size:     2,
+			ops:      []op{{set: "a"}, {set: "b"}, {set: "c"}},
+			wantKeys: []string{"b", "c"},
+			gone:     []string{"a"},
+		},
+		{
+			name:     "reads count as use",
+			size:     2,
+			ops:      []op{{set: "a"}, {set: "b"}, {get: "a"}, {set: "c"}},
+			wantKeys: []string{"a", "c"},
+			gone:     []string{"b"},
+		},
+		{
+			name:     "overwrites count as use",
+			size:     2,
+			ops:      []op{{set: "a"}, {set: "b"}, {set: "a"}, {set: "c"}},
+			wantKeys: []string{"a", "c"},
+			gone:     []string{"b"},
+		},
+		{
+			name:     "size below one holds one",
+			size:     0,
+			ops:      []op{{set: "a"}, {set: "b"}},
+			wantKeys: []string{"b"},
+			gone:     []string{"a"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cache.NewLRU[string, string](tt.size)
+			for _, o := range tt.ops {
+				if o.get != "" {
+					_, _, _ = c.Get(ctx, o.get)
+					continue
+				}
+				if err := c.Set(ctx, o.set, "v-"+o.set, 0); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if c.Len() != len(tt.wantKeys) {
+				t.Errorf("Len = %d, want %d", c.Len(), len(tt.wantKeys))
+			}
+			for _, k := range tt.wantKeys {
+				if v, ok, _ := c.Get(ctx, k); !ok || v != "v-"+k {
+					t.Errorf("Get(%q) = %q, %v; want v-%s", k, v, ok, k)
+				}
+			}
+			for _, k := range tt.gone {
+				if _, ok, _ := c.Get(ctx, k); ok {
+					t.Errorf("Get(%q) found an evicted key", k)
+				}
+			}
+		})
+	}
+}
+
+func TestLRUExpiry(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU[string, int](10, cache.WithTTL(time.Hour))
+	_ = c.Set(ctx, "default", 1, 0)
+	_ = c.Set(ctx, "short", 2, 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok, _ := c.Get(ctx, "short"); ok {
+		t.Error("expired entry found")
+	}
+	if v, ok, _ := c.Get(ctx, "default"); !ok || v != 1 {
+		t.Errorf("Get(default) = %d, %v; want 1 under the default TTL", v, ok)
+	}
+	if c.Len() != 1 {
+		t.Errorf("Len = %d, want the expired entry dropped on read", c.Len())
+	}
+	_ = c.Delete(ctx, "default")
+	_ = c.Delete(ctx, "missing")
+	if _, ok, _ := c.Get(ctx, "default"); ok {
+		t.Error("deleted entry found")
+	}
+}
+
+func TestLRUStats(t *testing.T) {
+	ctx := context.Background()
+	c := cache.NewLRU[int, int](10)
+	_ = c.Set(ctx, 1, 1, 0)
+	for _, k := range []int{1, 1, 2, 3, 1} {
+		_, _, _ = c.Get(ctx, k)
+	}
+	if got, want := c.Stats(), (cache.Stats{Hits: 3, Misses: 2}); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+// flakyCache fails reads and writes while failing is set.
+type flakyCache struct {
+	cache.Cache[string, string]
+	failing bool
+}
+
+var errCache = errors.New("cache down")
+
+func (c *flakyCache) Get(ctx context.Context, key string) (string, bool, error) {
+	if c.failing {
+		return "", false, errCache
+	}
+	return c.Cache.Get(ctx, key)
+}
+
+func (c *flakyCache) Set(ctx context.Context, key, v string, ttl time.Duration) error {
+	if c.failing {
+		return errCache
+	}
+	return c.Cache.Set(ctx, key, v, ttl)
+}
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+	tests := []struct {
+		name      string
+		failing   bool
+		loadErr   error
+		wantLoads int32
+		wantErr   error
+	}{
+		{"loads once", false, nil, 1, nil},
+		{"load errors are not cached", false, boom, 3, boom},
+		{"cache outage loads every time", true, nil, 3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var loads atomic.Int32
+			c := &flakyCache{Cache: cache.NewLRU[string, string](10), failing: tt.failing}
+			l := cache.NewLoader[string, string](c, func(_ context.Context, id string) (string, error) {
+				loads.Add(1)
+				return "#" + id, tt.loadErr
+			})
+			for i := 0; i < 3; i++ {
+				v, err := l.Get(ctx, "C0123")
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Get err = %v, want %v", err, tt.wantErr)
+				}
+				if err == nil && v != "#C0123" {
+					t.Errorf("Get = %q, want #C0123", v)
+				}
+			}
+			if n := loads.Load(); n != tt.wantLoads {
+				t.Errorf("loaded %d times, want %d", n, tt.wantLoads)
+			}
+		})
+	}
+}
+
+func TestLoaderCoalescesMisses(t *testing.T) {
+	ctx := context.Background()
+	var loads atomic.Int32
+	release := make(chan struct{})
+	l := cache.NewLoader[string, string](cache.NewLRU[string, string](10), func(_ context.Context, id string) (string, error) {
+		loads.Add(1)
+		<-release
+		return "#" + id, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := l.Get(ctx, "C0123"); err != nil || v != "#C0123" {
+				t.Errorf("Get = %q, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := loads.Load(); n != 1 {
+		t.Errorf("loaded %d times, want 1", n)
+	}
+}
+
+func TestLoaderWaiterCancelled(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{})
+	l := cache.NewLoader[string, string](cache.NewLRU[string, string](10), func(context.Context, string) (string, error) {
+		close(started)
+		<-release
+		return "v", nil
+	})
+	go func() { _, _ = l.Get(context.Background(), "k") }()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := l.Get(ctx, "k"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestLoaderRefresh(t *testing.T) {
+	ctx := context.Background()
+	version := 0
+	c := cache.NewLRU[string, int](10)
+	l := cache.NewLoader[string, int](c, func(context.Context, string) (int, error) {
+		version++
+		return version, nil
+	})
+	if v, _ := l.Get(ctx, "k"); v != 1 {
+		t.Fatalf("Get = %d, want 1", v)
+	}
+	if v, err := l.Refresh(ctx, "k", 0); err != nil || v != 2 {
+		t.Fatalf("Refresh = %d, %v; want 2", v, err)
+	}
+	if v, _ := l.Get(ctx, "k"); v != 2 {
+		t.Errorf("Get after Refresh = %d, want 2", v)
+	}
+}
@@ -0,0 +1,107 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LoadFunc loads the value for key on a cache miss.
+type LoadFunc[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// Loader reads through a Cache, loading missing values with one call per
+// key at a time: callers that miss while a load is running wait for its
+// result rather than stampede the backend. It is safe for concurrent use.
+type Loader[K comparable, V any] struct {
+	cache Cache[K, V]
+	load  LoadFunc[K, V]
+	opts  Options
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+var errLoadPanicked = errors.New("cache: load panicked")
+
+type call[V any] struct {
+	done chan struct{}
+	v    V
+	err  error
+}
+
+// NewLoader returns a Loader filling c with load. Of the options, only
+// WithTTL, for loaded values, and WithLogger apply; the TTL defaults to
+// c's own.
+func NewLoader[K comparable, V any](c Cache[K, V], load LoadFunc[K, V], opts ...Option) *Loader[K, V] {
+	options := Options{}
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Loader[K, V]{cache: c, load: load, opts: options, calls: map[K]*call[V]{}}
+}
+
+// Get returns the cached value for key, or loads, caches and returns it.
+// Cache errors are logged and treated as misses, so a Redis outage slows
+// lookups down rather than failing them; load errors are returned and not
+// cached.
+func (l *Loader[K, V]) Get(ctx context.Context, key K) (V, error) {
+	v, ok, err := l.cache.Get(ctx, key)
+	if err != nil {
+		l.warn(ctx, "cache read failed", key, err)
+	}
+	if ok {
+		return v, nil
+	}
+
+	l.mu.Lock()
+	if c, ok := l.calls[key]; ok {
+		l.mu.Unlock()
+		select {
+		case <-c.done:
+			return c.v, c.err
+		case <-ctx.Done():
+			return v, ctx.Err()
+		}
+	}
+	c := &call[V]{done: make(chan struct{})}
+	l.calls[key] = c
+	l.mu.Unlock()
+
+	func() {
+		defer func() {
+			l.mu.Lock()
+			delete(l.calls, key)
+			l.mu.Unlock()
+			close(c.done)
+		}()
+		// waiters see this if load panics
+		c.err = errLoadPanicked
+		// one caller's cancellation must not fail the others waiting
+		c.v, c.err = l.load(context.WithoutCancel(ctx), key)
+	}()
+	if c.err == nil {
+		if err := l.cache.Set(ctx, key, c.v, l.opts.TTL); err != nil {
+			l.warn(ctx, "cache write failed", key, err)
+		}
+	}
+	return c.v, c.err
+}
+
+// Refresh loads key again and replaces the cached value.
+func (l *Loader[K, V]) Refresh(ctx context.Context, key K, ttl time.Duration) (V, error) {
+	v, err := l.load(ctx, key)
+	if err != nil {
+		return v, err
+	}
+	if ttl <= 0 {
+		ttl = l.opts.TTL
+	}
+	return v, l.cache.Set(ctx, key, v, ttl)
+}
+
+func (l *Loader[K, V]) warn(ctx context.Context, msg string, key K, err error) {
+	if lg := l.opts.Logger; lg != nil {
+		lg.Warning(ctx, nil, msg, map[string]any{"key": key, "error": err.Error()})
+	}
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// LRU is an in-memory Cache holding at most size entries, evicting the
+// least recently used first. Expired entries are dropped when read or
+// evicted.
+type LRU[K comparable, V any] struct {
+	*recorder
+	opts  Options
+	size  int
+	mu    sync.Mutex
+	order *list.List // of *lruEntry, most recently used first
+	items map[K]*list.Element
+}
+
+type lruEntry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// NewLRU returns an LRU of at most size entries.
+func NewLRU[K comparable, V any](size int, opts ...Option) *LRU[K, V] {
+	options := newOptions(opts)
+	return &LRU[K, V]{
+		recorder: newRecorder(options),
+		opts:     options,
+		size:     max(size, 1),
+		order:    list.New(),
+		items:    map[K]*list.Element{},
+	}
+}
+
+func (c *LRU[K, V]) Get(_ context.Context, key K) (V, bool, error) {
+	v, ok := c.get(key)
+	c.record(ok, nil)
+	return v, ok, nil
+}
+
+func (c *LRU[K, V]) get(key K) (V, bool) {
+	var zero V
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		return zero, false
+	}
+	e := el.Value.(*lruEntry[K, V])
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		c.remove(el)
+		return zero, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *LRU[K, V]) Set(_ context.Context, key K, v V, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = c.opts.TTL
+	}
+	var expires time.Time
+	if ttl > 0 {
+		expires = time.Now().Add(ttl)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*lruEntry[K, V])
+		e.value, e.expires = v, expires
+		c.order.MoveToFront(el)
+		return nil
+	}
+	c.items[key] = c.order.PushFront(&lruEntry[K, V]{key: key, value: v, expires: expires})
+	for c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+	return nil
+}
+
+func (c *LRU[K, V]) Delete(_ context.Context, key K) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	return nil
+}
+
+// Len returns the number of entries, including expired ones not yet
+// dropped.
+func (c *LRU[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+func (c *LRU[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*lruEntry[K, V]).key)
+}
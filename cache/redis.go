@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Redis is a Cache shared across instances, keeping JSON-encoded values
+// under prefix+key, with key formatted by fmt.Sprint. Redis evicts
+// entries when they expire.
+type Redis[K comparable, V any] struct {
+	*recorder
+	opts   Options
+	client redis.Cmdable
+	prefix string
+}
+
+// NewRedis returns a Redis cache; client is usually a *redis.Client or
+// *redis.ClusterClient.
+func NewRedis[K comparable, V any](client redis.Cmdable, prefix string, opts ...Option) *Redis[K, V] {
+	options := newOptions(opts)
+	return &Redis[K, V]{recorder: newRecorder(options), opts: options, client: client, prefix: prefix}
+}
+
+func (c *Redis[K, V]) key(k K) string { return c.prefix + fmt.Sprint(k) }
+
+func (c *Redis[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	v, ok, err := c.get(ctx, key)
+	c.record(ok, err)
+	return v, ok, err
+}
+
+func (c *Redis[K, V]) get(ctx context.Context, key K) (V, bool, error) {
+	var v V
+	b, err := c.client.Get(ctx, c.key(key)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, fmt.Errorf("cache: get %v: %w", key, err)
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, false, fmt.Errorf("cache: decode %v: %w", key, err)
+	}
+	return v, true, nil
+}
+
+func (c *Redis[K, V]) Set(ctx context.Context, key K, v V, ttl time.Duration) error {
+	if ttl <= 0 {
+		ttl = c.opts.TTL
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("cache: encode %v: %w", key, err)
+	}
+	if err := c.client.Set(ctx, c.key(key), b, ttl).Err(); err != nil {
+		return fmt.Errorf("cache: set %v: %w", key, err)
+	}
+	return nil
+}
+
+func (c *Redis[K, V]) Delete(ctx context.Context, key K) error {
+	if err := c.client.Del(ctx, c.key(key)).Err(); err != nil {
+		return fmt.Errorf("cache: delete %v: %w", key, err)
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+// Package config populates a struct from layered sources, each overriding the
+// one before: `default` struct tags, a YAML or JSON file, .env files and the
+// environment, then resolves Secret Manager references and validates the
+// result.
+//
+// Quick start:
+//
+//	type Config struct {
+//	    Port     int           `yaml:"port" json:"port" env:"PORT" default:"8080"`
+//	    Timeout  time.Duration `yaml:"timeout" json:"timeout" env:"TIMEOUT" default:"10s"`
+//	    Channels []string      `yaml:"channels" json:"channels" env:"CHANNELS"` // comma-separated in the env
+//	    Token    string        `env:"SLACK_BOT_TOKEN" secret:"true" required:"true"`
+//	}
+//
+//	var cfg Config
+//	config.MustLoad(ctx, &cfg,
+//	    config.WithFile(os.Getenv("CONFIG_FILE")), // optional; skipped when empty
+//	    config.WithDotEnv(".env"),                  // optional; skipped when missing
+//	)
+//
+// With SLACK_BOT_TOKEN=projects/p/secrets/slack-bot-token/versions/latest,
+// cfg.Token holds the secret's value.
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/print-engine/ieos-golang-utils/secrets"
+	"gopkg.in/yaml.v3"
+)
+
+// Validator is implemented by config structs with checks beyond required
+// fields; Load calls Validate last.
+type Validator interface {
+	Validate() error
+}
+
+// SecretAccessor returns the value of a Secret Manager version.
+type SecretAccessor func(ctx context.Context, name string) (string, error)
+
+type Options struct {
+	File           string
+	DotEnvFiles    []string
+	EnvPrefix      string
+	LookupEnv      func(string) (string, bool)
+	SecretAccessor SecretAccessor
+}
+
+type Option func(*Options)
+
+// WithFile reads path, YAML or JSON by its extension (.json, else YAML),
+// over the defaults. An empty path is skipped; a missing file is an error.
+func WithFile(path string) Option { return func(o *Options) { o.File = path } }
+
+// WithDotEnv reads KEY=VALUE files as a fallback for variables not set in
+// the environment. Missing files are skipped, so the same code runs locally
+// with a .env and deployed without one.
+func WithDotEnv(paths ...string) Option {
+	return func(o *Options) { o.DotEnvFiles = append(o.DotEnvFiles, paths...) }
+}
+
+// WithEnvPrefix prepends prefix to every `env` tag, e.g. "SLACK_".
+func WithEnvPrefix(prefix string) Option { return func(o *Options) { o.EnvPrefix = prefix } }
+
+// WithLookupEnv reads the environment through f instead of os.LookupEnv,
+// e.g. in tests.
+func WithLookupEnv(f func(string) (string, bool)) Option {
+	return func(o *Options) { o.LookupEnv = f }
+}
+
+// WithSecretAccessor resolves secret references through f instead of a
+// Secret Manager client, e.g. in tests or to share a client.
+func WithSecretAccessor(f SecretAccessor) Option { return func(o *Options) { o.SecretAccessor = f } }
+
+// Load populates dst, a pointer to a struct, from its `default` tags, the
+// file, the environment (`env` tags) and Secret Manager (`secret:"true"`
+// fields whose value is a secret or version resource name), then checks
+// `required:"true"` fields are set and calls Validate if dst implements
+// Validator. Nested structs are walked; their fields carry their own tags.
+func Load(ctx context.Context, dst any, opts ...Option) error {
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.LookupEnv == nil {
+		options.LookupEnv = os.LookupEnv
+	}
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("config: Load needs a pointer to a struct, got %T", dst)
+	}
+
+	fields := collectFields(rv.Elem(), "")
+	for _, f := range fields {
+		if def, ok := f.tag.Lookup("default"); ok {
+			if err := setValue(f.value, def); err != nil {
+				return fmt.Errorf("config: default of %s: %w", f.path, err)
+			}
+		}
+	}
+	if options.File != "" {
+		if err := decodeFile(options.File, dst); err != nil {
+			return err
+		}
+	}
+	lookup, err := envLookup(options)
+	if err != nil {
+		return err
+	}
+	for _, f := range fields {
+		name := f.tag.Get("env")
+		if name == "" {
+			continue
+		}
+		if v, ok := lookup(options.EnvPrefix + name); ok {
+			if err := setValue(f.value, v); err != nil {
+				return fmt.Errorf("config: %s%s: %w", options.EnvPrefix, name, err)
+			}
+		}
+	}
+	if err := resolveSecrets(ctx, fields, options); err != nil {
+		return err
+	}
+
+	var missing []error
+	for _, f := range fields {
+		if f.tag.Get("required") == "true" && f.value.IsZero() {
+			missing = append(missing, fmt.Errorf("config: %s is required%s", f.path, envHint(f, options)))
+		}
+	}
+	if err := errors.Join(missing...); err != nil {
+		return err
+	}
+	if v, ok := dst.(Validator); ok {
+		if err := v.Validate(); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	return nil
+}
+
+// MustLoad is Load that panics on error, for main functions and init.
+func MustLoad(ctx context.Context, dst any, opts ...Option) {
+	if err := Load(ctx, dst, opts...); err != nil {
+		panic(err)
+	}
+}
+
+func envHint(f field, o Options) string {
+	if name := f.tag.Get("env"); name != "" {
+		return " (set " + o.EnvPrefix + name + ")"
+	}
+	return ""
+}
+
+func decodeFile(path string, dst any) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("config: %w", err)
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = json.Unmarshal(b, dst)
+	} else {
+		err = yaml.Unmarshal(b, dst)
+	}
+	if err != nil {
+		return fmt.Errorf("config: parse %s: %w", path, err)
+	}
+	return nil
+}
+
+// envLookup layers the .env files under the environment.
+func envLookup(o Options) (func(string) (string, bool), error) {
+	if len(o.DotEnvFiles) == 0 {
+		return o.LookupEnv, nil
+	}
+	dotenv := map[string]string{}
+	for _, path := range o.DotEnvFiles {
+		vars, err := readDotEnv(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("config: %w", err)
+		}
+		for k, v := range vars {
+			if _, ok := dotenv[k]; !ok {
+				// earlier files win, like godotenv.Load
+				dotenv[k] = v
+			}
+		}
+	}
+	return func(key string) (string, bool) {
+		if v, ok := o.LookupEnv(key); ok {
+			return v, true
+		}
+		v, ok := dotenv[key]
+		return v, ok
+	}, nil
+}
+
+// resolveSecrets replaces the value of every `secret:"true"` string field
+// holding a Secret Manager reference with the secret's value. References are
+// "projects/p/secrets/s/versions/v" or "projects/p/secrets/s", meaning the
+// latest version; other values are left as they are, so a plain value works
+// locally. Without WithSecretAccessor they are read through secrets.Get.
+func resolveSecrets(ctx context.Context, fields []field, o Options) error {
+	access := o.SecretAccessor
+	if access == nil {
+		access = secrets.Get
+	}
+	for _, f := range fields {
+		if f.tag.Get("secret") != "true" || f.value.Kind() != reflect.String {
+			continue
+		}
+		name, ok := secrets.Name(f.value.String())
+		if !ok {
+			continue
+		}
+		v, err := access(ctx, name)
+		if err != nil {
+			return fmt.Errorf("config: %s: access %s: %w", f.path, name, err)
+		}
+		f.value.SetString(v)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package config_test
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/config"
+)
+
+type slackConfig struct {
+	Token   string `yaml:"token" json:"token" env:"SLACK_BOT_TOKEN" secret:"true" required:"true"`
+	Channel string `yaml:"channel" json:"channel" env:"SLACK_CHANNEL" default:"#alerts"`
+}
+
+type testConfig struct {
+	Port     int           `yaml:"port" json:"port" env:"PORT" default:"8080"`
+	Timeout  time.Duration `yaml:"timeout" json:"timeout" env:"TIMEOUT" default:"10s"`
+	Debug    bool          `yaml:"debug" json:"debug" env:"DEBUG"`
+	Ratio    float64       `yaml:"ratio" json:"ratio" env:"RATIO" default:"0.5"`
+	Channels []string      `yaml:"channels" json:"channels" env:"CHANNELS"`
+	Limit    *int          `yaml:"limit" json:"limit" env:"LIMIT"`
+	Addr     netip.Addr    `yaml:"addr" json:"addr" env:"ADDR" default:"127.0.0.1"`
+	Slack    slackConfig   `yaml:"slack" json:"slack"`
+}
+
+func (c *testConfig) Validate() error {
+	if c.Port > 65535 {
+		return errors.New("port out of range")
+	}
+	return nil
+}
+
+// env returns a LookupEnv over vars.
+func env(vars map[string]string) config.Option {
+	return config.WithLookupEnv(func(k string) (string, bool) {
+		v, ok := vars[k]
+		return v, ok
+	})
+}
+
+func write(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	ctx := context.Background()
+	limit := 3
+	defaults := testConfig{Port: 8080, Timeout: 10 * time.Second, Ratio: 0.5, Addr: netip.MustParseAddr("127.0.0.1"),
+		Slack: slackConfig{Token: "xoxb-1", Channel: "#alerts"}}
+	with := func(f func(c *testConfig)) testConfig {
+		c := defaults
+		f(&c)
+		return c
+	}
+	tests := []struct {
+		name string
+		opts []config.Option
+		want testConfig
+	}{
+		{
+			name: "defaults",
+			opts: []config.Option{env(map[string]string{"SLACK_BOT_TOKEN": "xoxb-1"})},
+			want: defaults,
+		},
+		{
+			name: "env overrides defaults",
+			opts: []config.Option{env(map[string]string{
+				"SLACK_BOT_TOKEN": "xoxb-1", "PORT": "9090", "TIMEOUT": "90s", "DEBUG": "true",
+				"CHANNELS": "#a, #b,,", "LIMIT": "3", "ADDR": "10.0.0.1",
+			})},
+			want: with(func(c *testConfig) {
+				c.Port, c.Timeout, c.Debug = 9090, 90*time.Second, true
+				c.Channels, c.Limit, c.Addr = []string{"#a", "#b"}, &limit, netip.MustParseAddr("10.0.0.1")
+			}),
+		},
+		{
+			name: "yaml file over defaults, env over file",
+			opts: []config.Option{
+				config.WithFile(write(t, "config.yaml", "port: 7070\nratio: 0.9\nslack:\n  channel: '#ops'\n")),
+				env(map[string]string{"SLACK_BOT_TOKEN": "xoxb-1", "PORT": "9090"}),
+			},
+			want: with(func(c *testConfig) { c.Port, c.Ratio, c.Slack.Channel = 9090, 0.9, "#ops" }),
+		},
+		{
+			name: "json file",
+			opts: []config.Option{
+				config.WithFile(write(t, "config.JSON", `{"port": 7070, "slack": {"token": "xoxb-1"}}`)),
+				env(nil),
+			},
+			want: with(func(c *testConfig) { c.Port = 7070 }),
+		},
+		{
+			name: "env prefix",
+			opts: []config.Option{config.WithEnvPrefix("APP_"), env(map[string]string{"APP_SLACK_BOT_TOKEN": "xoxb-1", "PORT": "1"})},
+			want: defaults,
+		},
+		{
+			name: "dotenv under the environment, earlier files first",
+			opts: []config.Option{
+				config.WithDotEnv(
+					write(t, ".env.local", "PORT=7070\n"),
+					filepath.Join(t.TempDir(), "missing.env"),
+					write(t, ".env", "# local settings\nexport PORT=6060\nSLACK_CHANNEL='#dev' # comment\nSLACK_BOT_TOKEN=\"xoxb-\\x31\"\nDEBUG=true\n"),
+				),
+				env(map[string]string{"DEBUG": "false"}),
+			},
+			want: with(func(c *testConfig) { c.Port, c.Slack.Channel = 7070, "#dev" }),
+		},
+		{
+			name: "secret reference resolved",
+			opts: []config.Option{
+				env(map[string]string{"SLACK_BOT_TOKEN": "projects/p/secrets/slack-bot-token"}),
+				config.WithSecretAccessor(func(_ context.Context, name string) (string, error) {
+					if name != "projects/p/secrets/slack-bot-token/versions/latest" {
+						return "", errors.New("unexpected secret " + name)
+					}
+					return "xoxb-1", nil
+				}),
+			},
+			want: defaults,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got testConfig
+			if err := config.Load(ctx, &got, tt.opts...); err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("config = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	ctx := context.Background()
+	token := map[string]string{"SLACK_BOT_TOKEN": "xoxb-1"}
+	tests := []struct {
+		name    string
+		dst     any
+		opts    []config.Option
+		wantErr string
+	}{
+		{"not a pointer", testConfig{}, nil, "needs a pointer to a struct"},
+		{"required missing", &testConfig{}, []config.Option{env(nil)}, "Slack.Token is required (set SLACK_BOT_TOKEN)"},
+		{"bad env value", &testConfig{}, []config.Option{env(map[string]string{"PORT": "eighty"})}, "config: PORT:"},
+		{"bad duration", &testConfig{}, []config.Option{env(map[string]string{"TIMEOUT": "10"})}, "config: TIMEOUT:"},
+		{"missing file", &testConfig{}, []config.Option{config.WithFile(filepath.Join(t.TempDir(), "nope.yaml")), env(token)}, "no such file"},
+		{"bad yaml", &testConfig{}, []config.Option{config.WithFile(write(t, "c.yaml", "port: [")), env(token)}, "config: parse"},
+		{"bad dotenv", &testConfig{}, []config.Option{config.WithDotEnv(write(t, ".env", "JUSTAKEY\n")), env(token)}, ".env:1: expected KEY=VALUE"},
+		{"unterminated quote", &testConfig{}, []config.Option{config.WithDotEnv(write(t, ".env", "A=\"open\n")), env(token)}, "unterminated quote"},
+		{"secret access fails", &testConfig{}, []config.Option{
+			env(map[string]string{"SLACK_BOT_TOKEN": "projects/p/secrets/s/versions/2"}),
+			config.WithSecretAccessor(func(context.Context, string) (string, error) { return "", errors.New("permission denied") }),
+		}, "Slack.Token: access projects/p/secrets/s/versions/2: permission denied"},
+		{"validate", &testConfig{}, []config.Option{env(map[string]string{"SLACK_BOT_TOKEN": "x", "PORT": "70000"})}, "config: port out of range"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := config.Load(ctx, tt.dst, tt.opts...)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMustLoadPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustLoad did not panic")
+		}
+	}()
+	var c testConfig
+	config.MustLoad(context.Background(), &c, env(nil))
+}
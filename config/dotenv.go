@@ -0,0 +1,69 @@
+package config
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// readDotEnv parses a .env file: KEY=VALUE lines, optionally prefixed with
+// "export", with # comments and single- or double-quoted values, the latter
+// with Go escapes such as \n.
+func readDotEnv(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	vars := map[string]string{}
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("%s:%d: expected KEY=VALUE", path, n)
+		}
+		value = strings.TrimSpace(value)
+		if value, err = dotEnvValue(value); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		vars[key] = value
+	}
+	return vars, sc.Err()
+}
+
+// dotEnvValue unquotes a value and drops a trailing comment.
+func dotEnvValue(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch q := value[0]; q {
+	case '"', '\'':
+		end := 1
+		for ; end < len(value) && value[end] != q; end++ {
+			if q == '"' && value[end] == '\\' {
+				end++
+			}
+		}
+		if end >= len(value) {
+			return "", errors.New("unterminated quote")
+		}
+		if q == '\'' {
+			return value[1:end], nil
+		}
+		return strconv.Unquote(value[:end+1])
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
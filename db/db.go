@@ -0,0 +1,247 @@
+// Package db opens PostgreSQL connection pools to Cloud SQL through the
+// Cloud SQL Go connector, with IAM database authentication by default,
+// applies embedded migrations, and logs slow queries through CloudLogger.
+//
+// Quick start:
+//
+//	//go:embed migrations/*.sql
+//	var migrations embed.FS
+//
+//	d, err := db.Open(ctx, "my-project:europe-west1:print", "orders",
+//	    db.WithIAMUser("orders-api@my-project.iam.gserviceaccount.com"),
+//	    db.WithLogger(lg),
+//	)
+//	if err != nil { return err }
+//	defer d.Close()
+//	if err := d.Migrate(ctx, migrations, "migrations"); err != nil { return err }
+//	h.Register("postgres", d)
+//
+//	row := d.QueryRow(ctx, "SELECT status FROM jobs WHERE id = $1", id) // pgx
+//	sqlDB := d.SQL()                                                     // database/sql, same pool
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/cloudsqlconn"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+type Options struct {
+	User            string
+	Password        string
+	PrivateIP       bool
+	MaxConns        int32
+	MinConns        int32
+	MaxConnLifetime time.Duration
+	SlowQuery       time.Duration
+	Logger          *logger.CloudLogger
+	DialerOptions   []cloudsqlconn.Option
+}
+
+type Option func(*Options)
+
+// WithIAMUser connects as the database user of a service account, given
+// by its email, authenticating with the service's credentials. The
+// instance needs the cloudsql.iam_authentication flag and the user must be
+// added to it.
+func WithIAMUser(email string) Option {
+	return func(o *Options) {
+		// Postgres IAM users drop the domain suffix of service accounts
+		o.User, o.Password = strings.TrimSuffix(email, ".gserviceaccount.com"), ""
+	}
+}
+
+// WithPassword connects as a built-in database user instead of with IAM
+// authentication.
+func WithPassword(user, password string) Option {
+	return func(o *Options) { o.User, o.Password = user, password }
+}
+
+// WithPrivateIP connects over the instance's private IP, for services with
+// VPC access; by default the public IP is used.
+func WithPrivateIP() Option { return func(o *Options) { o.PrivateIP = true } }
+
+// WithMaxConns sets the pool size, 10 by default. Keep the sum over all
+// instances of a service below the database's max_connections.
+func WithMaxConns(n int32) Option { return func(o *Options) { o.MaxConns = n } }
+
+// WithMinConns keeps n connections open, 0 by default.
+func WithMinConns(n int32) Option { return func(o *Options) { o.MinConns = n } }
+
+// WithMaxConnLifetime sets how long a connection is reused, 30m by
+// default.
+func WithMaxConnLifetime(d time.Duration) Option { return func(o *Options) { o.MaxConnLifetime = d } }
+
+// WithSlowQuery sets the duration above which queries are logged, 500ms
+// by default; zero disables the log.
+func WithSlowQuery(d time.Duration) Option { return func(o *Options) { o.SlowQuery = d } }
+
+// WithLogger logs slow queries at warning level, with their SQL but not
+// their arguments, and applied migrations at info.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithDialerOptions passes options to the Cloud SQL connector.
+func WithDialerOptions(opts ...cloudsqlconn.Option) Option {
+	return func(o *Options) { o.DialerOptions = append(o.DialerOptions, opts...) }
+}
+
+// DB is a pgx connection pool. It is safe for concurrent use.
+type DB struct {
+	*pgxpool.Pool
+	opts   Options
+	dialer *cloudsqlconn.Dialer
+}
+
+func newOptions(opts []Option) Options {
+	options := Options{
+		MaxConns:        10,
+		MaxConnLifetime: 30 * time.Minute,
+		SlowQuery:       500 * time.Millisecond,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	return options
+}
+
+// Open connects to database on the Cloud SQL instance, given by its
+// connection name "project:region:instance", and checks the connection.
+// A user is required: WithIAMUser or WithPassword.
+func Open(ctx context.Context, instance, database string, opts ...Option) (*DB, error) {
+	options := newOptions(opts)
+	if options.User == "" {
+		return nil, errors.New("db: no user; use WithIAMUser or WithPassword")
+	}
+	dopts := options.DialerOptions
+	if options.Password == "" {
+		dopts = append([]cloudsqlconn.Option{cloudsqlconn.WithIAMAuthN()}, dopts...)
+	}
+	if options.PrivateIP {
+		dopts = append(dopts, cloudsqlconn.WithDefaultDialOptions(cloudsqlconn.WithPrivateIP()))
+	}
+	dialer, err := cloudsqlconn.NewDialer(ctx, dopts...)
+	if err != nil {
+		return nil, fmt.Errorf("db: new dialer: %w", err)
+	}
+	dsn := fmt.Sprintf("user=%s database=%s sslmode=disable", quote(options.User), quote(database))
+	if options.Password != "" {
+		dsn += " password=" + quote(options.Password)
+	}
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		dialer.Close()
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	// the connector encrypts and authorizes the connection itself
+	cfg.ConnConfig.DialFunc = func(ctx context.Context, _, _ string) (net.Conn, error) {
+		return dialer.Dial(ctx, instance)
+	}
+	d, err := open(ctx, cfg, options)
+	if err != nil {
+		dialer.Close()
+		return nil, err
+	}
+	d.dialer = dialer
+	return d, nil
+}
+
+// OpenDSN connects with a PostgreSQL connection string directly, without
+// the connector, for local databases and the Cloud SQL Auth Proxy.
+func OpenDSN(ctx context.Context, dsn string, opts ...Option) (*DB, error) {
+	cfg, err := pgxpool.ParseConfig(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	return open(ctx, cfg, newOptions(opts))
+}
+
+func open(ctx context.Context, cfg *pgxpool.Config, options Options) (*DB, error) {
+	cfg.MaxConns = options.MaxConns
+	cfg.MinConns = options.MinConns
+	cfg.MaxConnLifetime = options.MaxConnLifetime
+	if options.SlowQuery > 0 && options.Logger != nil {
+		cfg.ConnConfig.Tracer = &slowQueryTracer{threshold: options.SlowQuery, lg: options.Logger}
+	}
+	pool, err := pgxpool.NewWithConfig(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("db: %w", err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("db: ping: %w", err)
+	}
+	return &DB{Pool: pool, opts: options}, nil
+}
+
+// SQL returns a database/sql handle sharing d's pool, for libraries that
+// need one. Closing it does not close d.
+func (d *DB) SQL() *sql.DB { return stdlib.OpenDBFromPool(d.Pool) }
+
+// Check pings the database, so a DB can be registered with the health
+// package.
+func (d *DB) Check(ctx context.Context) error {
+	if err := d.Ping(ctx); err != nil {
+		return fmt.Errorf("db: ping: %w", err)
+	}
+	return nil
+}
+
+// Close closes the pool and the connector.
+func (d *DB) Close() {
+	d.Pool.Close()
+	if d.dialer != nil {
+		d.dialer.Close()
+	}
+}
+
+// quote quotes a connection string value.
+func quote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+type slowQueryTracer struct {
+	threshold time.Duration
+	lg        *logger.CloudLogger
+}
+
+type queryStart struct {
+	sql   string
+	start time.Time
+}
+
+type queryStartKey struct{}
+
+func (t *slowQueryTracer) TraceQueryStart(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	return context.WithValue(ctx, queryStartKey{}, queryStart{sql: data.SQL, start: time.Now()})
+}
+
+func (t *slowQueryTracer) TraceQueryEnd(ctx context.Context, _ *pgx.Conn, data pgx.TraceQueryEndData) {
+	q, ok := ctx.Value(queryStartKey{}).(queryStart)
+	if !ok {
+		return
+	}
+	took := time.Since(q.start)
+	if took < t.threshold {
+		return
+	}
+	sqlText := q.sql
+	if len(sqlText) > 2000 {
+		sqlText = sqlText[:2000] + "..."
+	}
+	payload := map[string]any{"sql": sqlText, "duration_ms": took.Milliseconds(), "rows": data.CommandTag.RowsAffected()}
+	if data.Err != nil {
+		payload["error"] = data.Err.Error()
+	}
+	t.lg.Warning(ctx, nil, "slow query", payload)
+}
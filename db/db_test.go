@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+func TestReadMigrations(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   fstest.MapFS
+		want    string
+		wantErr bool
+	}{
+		{"ordered by version", fstest.MapFS{
+			"migrations/0010_add_jobs_status.sql": {Data: []byte("ALTER TABLE jobs ADD status text")},
+			"migrations/0002_create_jobs.sql":     {Data: []byte("CREATE TABLE jobs (id text)")},
+			"migrations/0001_init.sql":            {Data: []byte("CREATE SCHEMA print")},
+		}, "1_init 2_create_jobs 10_add_jobs_status", false},
+		{"other files ignored", fstest.MapFS{
+			"migrations/0001_init.sql":         {Data: []byte("CREATE SCHEMA print")},
+			"migrations/README.md":             {Data: []byte("# migrations")},
+			"migrations/init.sql":              {Data: []byte("SELECT 1")},
+			"migrations/next_jobs.sql":         {Data: []byte("SELECT 1")},
+			"migrations/0002_nested.sql/x.sql": {Data: []byte("SELECT 1")},
+		}, "1_init", false},
+		{"duplicate version", fstest.MapFS{
+			"migrations/0001_init.sql": {Data: []byte("CREATE SCHEMA print")},
+			"migrations/1_another.sql": {Data: []byte("SELECT 1")},
+		}, "", true},
+		{"missing dir", fstest.MapFS{}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := readMigrations(tt.files, "migrations")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("readMigrations error = %v, want error %v", err, tt.wantErr)
+			}
+			var names []string
+			for _, m := range got {
+				names = append(names, fmt.Sprintf("%d_%s", m.version, m.name))
+				if m.sql != string(tt.files["migrations/"+fileName(tt.files, m.version)].Data) {
+					t.Errorf("migration %d sql = %q", m.version, m.sql)
+				}
+			}
+			if strings.Join(names, " ") != tt.want {
+				t.Errorf("migrations = %v, want %s", names, tt.want)
+			}
+		})
+	}
+}
+
+// fileName finds the file of a migration version in files.
+func fileName(files fstest.MapFS, version int64) string {
+	for name := range files {
+		base := strings.TrimPrefix(name, "migrations/")
+		if v, _, ok := strings.Cut(base, "_"); ok && strings.TrimLeft(v, "0") == fmt.Sprint(version) {
+			return base
+		}
+	}
+	return ""
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"orders", `'orders'`},
+		{"it's", `'it\'s'`},
+		{`back\slash`, `'back\\slash'`},
+		{"pass word", `'pass word'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got := quote(tt.in)
+			if got != tt.want {
+				t.Errorf("quote = %s, want %s", got, tt.want)
+			}
+			// the quoted value survives the connection string parser
+			cfg, err := pgxpool.ParseConfig("host=localhost password=" + got)
+			if err != nil || cfg.ConnConfig.Password != tt.in {
+				t.Errorf("parsed password = %q, %v", cfg.ConnConfig.Password, err)
+			}
+		})
+	}
+}
+
+func TestOptions(t *testing.T) {
+	o := newOptions([]Option{WithIAMUser("orders-api@my-project.iam.gserviceaccount.com"), WithMaxConns(4)})
+	if o.User != "orders-api@my-project.iam" || o.Password != "" || o.MaxConns != 4 || o.SlowQuery != 500*time.Millisecond {
+		t.Errorf("options = %+v", o)
+	}
+	o = newOptions([]Option{WithIAMUser("dev@example.com")})
+	if o.User != "dev@example.com" {
+		t.Errorf("user account = %q, want it unchanged", o.User)
+	}
+	o = newOptions([]Option{WithPassword("orders", "s3cret")})
+	if o.User != "orders" || o.Password != "s3cret" {
+		t.Errorf("options = %+v", o)
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	ctx := context.Background()
+	if _, err := Open(ctx, "my-project:europe-west1:print", "orders"); err == nil {
+		t.Error("Open accepted no user")
+	}
+	if _, err := OpenDSN(ctx, "host=localhost port=notaport"); err == nil {
+		t.Error("OpenDSN accepted a bad connection string")
+	}
+}
+
+type notes struct {
+	mu   sync.Mutex
+	msgs []string
+	last any
+}
+
+func (n *notes) Notify(_ context.Context, sev logging.Severity, _, msg string, payload any) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.msgs = append(n.msgs, sev.String()+" "+msg)
+	n.last = payload
+}
+
+func TestSlowQueryTracer(t *testing.T) {
+	tests := []struct {
+		name      string
+		took      time.Duration
+		err       error
+		wantLog   bool
+		wantError bool
+	}{
+		{"fast", 0, nil, false, false},
+		{"slow", 20 * time.Millisecond, nil, true, false},
+		{"slow and failed", 20 * time.Millisecond, errors.New("canceling statement"), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			n := &notes{}
+			lg, err := logger.New(context.Background(), logger.WithStdoutOnly(), logger.WithNotifier(n, logging.Warning))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tr := &slowQueryTracer{threshold: 10 * time.Millisecond, lg: lg}
+			ctx := tr.TraceQueryStart(context.Background(), nil, pgx.TraceQueryStartData{SQL: "SELECT pg_sleep(1)"})
+			time.Sleep(tt.took)
+			tr.TraceQueryEnd(ctx, nil, pgx.TraceQueryEndData{CommandTag: pgconn.NewCommandTag("SELECT 1"), Err: tt.err})
+			if logged := len(n.msgs) == 1 && n.msgs[0] == "Warning slow query"; logged != tt.wantLog {
+				t.Fatalf("logs = %v, want slow query logged %v", n.msgs, tt.wantLog)
+			}
+			if !tt.wantLog {
+				return
+			}
+			entry, _ := n.last.(logger.LogEntryPayload)
+			payload, _ := entry.DataObject.(map[string]any)
+			if payload["sql"] != "SELECT pg_sleep(1)" || payload["rows"] != int64(1) {
+				t.Errorf("payload = %v", payload)
+			}
+			if _, ok := payload["error"]; ok != tt.wantError {
+				t.Errorf("payload = %v, want error %v", payload, tt.wantError)
+			}
+		})
+	}
+}
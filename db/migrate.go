@@ -0,0 +1,118 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// migrationLock is the advisory lock key held while migrating, so
+// instances starting together apply each migration once.
+const migrationLock = 0x6965_6f73_6d69_67 // "ieosmig"
+
+type migration struct {
+	version int64
+	name    string
+	sql     string
+}
+
+// Migrate applies the migrations in dir of fsys not yet applied, in order
+// of version. Files are named "<version>_<name>.sql", e.g.
+// "0003_add_jobs_status.sql"; others are ignored. Each migration runs in
+// its own transaction and is recorded in the schema_migrations table.
+// Applied migrations must not be edited: add a new one instead.
+func (d *DB) Migrate(ctx context.Context, fsys fs.FS, dir string) error {
+	migrations, err := readMigrations(fsys, dir)
+	if err != nil {
+		return err
+	}
+	conn, err := d.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("db: migrate: %w", err)
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "SELECT pg_advisory_lock($1)", int64(migrationLock)); err != nil {
+		return fmt.Errorf("db: migrate: lock: %w", err)
+	}
+	defer conn.Exec(context.WithoutCancel(ctx), "SELECT pg_advisory_unlock($1)", int64(migrationLock))
+
+	if _, err := conn.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version bigint PRIMARY KEY,
+		name text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	)`); err != nil {
+		return fmt.Errorf("db: migrate: create schema_migrations: %w", err)
+	}
+	rows, err := conn.Query(ctx, "SELECT version FROM schema_migrations")
+	if err != nil {
+		return fmt.Errorf("db: migrate: %w", err)
+	}
+	applied, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return fmt.Errorf("db: migrate: %w", err)
+	}
+	done := make(map[int64]bool, len(applied))
+	for _, v := range applied {
+		done[v] = true
+	}
+
+	for _, m := range migrations {
+		if done[m.version] {
+			continue
+		}
+		err := pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, m.sql); err != nil {
+				return err
+			}
+			_, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", m.version, m.name)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("db: migration %d_%s: %w", m.version, m.name, err)
+		}
+		if lg := d.opts.Logger; lg != nil {
+			lg.Info(ctx, nil, "applied migration", map[string]any{"version": m.version, "name": m.name})
+		}
+	}
+	return nil
+}
+
+func readMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, fmt.Errorf("db: read migrations: %w", err)
+	}
+	var migrations []migration
+	seen := make(map[int64]string)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		prefix, name, ok := strings.Cut(strings.TrimSuffix(e.Name(), ".sql"), "_")
+		if !ok {
+			continue
+		}
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			continue
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("db: migrations %s and %s share version %d", other, e.Name(), version)
+		}
+		seen[version] = e.Name()
+		b, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("db: read migrations: %w", err)
+		}
+		migrations = append(migrations, migration{version: version, name: name, sql: string(b)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+	return migrations, nil
+}
@@ -0,0 +1,168 @@
+package errs
+
+import (
+	"net/http"
+	"sync"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/grpc/codes"
+)
+
+// Code classifies an error.
+type Code string
+
+// General codes, after the gRPC ones.
+const (
+	OK                 Code = "ok"
+	Unknown            Code = "unknown"
+	InvalidArgument    Code = "invalid_argument"
+	NotFound           Code = "not_found"
+	AlreadyExists      Code = "already_exists"
+	PermissionDenied   Code = "permission_denied"
+	Unauthenticated    Code = "unauthenticated"
+	FailedPrecondition Code = "failed_precondition"
+	Aborted            Code = "aborted"
+	ResourceExhausted  Code = "resource_exhausted"
+	Canceled           Code = "canceled"
+	DeadlineExceeded   Code = "deadline_exceeded"
+	Unimplemented      Code = "unimplemented"
+	Unavailable        Code = "unavailable"
+	Internal           Code = "internal"
+)
+
+// Print codes.
+const (
+	// PrinterOffline means the target printer cannot be reached.
+	PrinterOffline Code = "printer_offline"
+	// PrinterBusy means the printer or its queue cannot take more jobs now.
+	PrinterBusy Code = "printer_busy"
+	// MediaUnavailable means the printer lacks the paper or media the job
+	// needs.
+	MediaUnavailable Code = "media_unavailable"
+	// JobRejected means the print vendor refused the job, e.g. for an
+	// invalid document or settings.
+	JobRejected Code = "job_rejected"
+	// VendorError means the print vendor's API failed.
+	VendorError Code = "vendor_error"
+)
+
+// Spec is how a code maps onto transports and logs.
+type Spec struct {
+	HTTPStatus int
+	GRPCCode   codes.Code
+	Severity   logging.Severity
+}
+
+var (
+	mu    sync.RWMutex
+	specs = map[Code]Spec{
+		OK:                 {http.StatusOK, codes.OK, logging.Info},
+		Unknown:            {http.StatusInternalServerError, codes.Unknown, logging.Error},
+		InvalidArgument:    {http.StatusBadRequest, codes.InvalidArgument, logging.Warning},
+		NotFound:           {http.StatusNotFound, codes.NotFound, logging.Warning},
+		AlreadyExists:      {http.StatusConflict, codes.AlreadyExists, logging.Warning},
+		PermissionDenied:   {http.StatusForbidden, codes.PermissionDenied, logging.Warning},
+		Unauthenticated:    {http.StatusUnauthorized, codes.Unauthenticated, logging.Warning},
+		FailedPrecondition: {http.StatusPreconditionFailed, codes.FailedPrecondition, logging.Warning},
+		Aborted:            {http.StatusConflict, codes.Aborted, logging.Warning},
+		ResourceExhausted:  {http.StatusTooManyRequests, codes.ResourceExhausted, logging.Warning},
+		Canceled:           {499, codes.Canceled, logging.Info},
+		DeadlineExceeded:   {http.StatusGatewayTimeout, codes.DeadlineExceeded, logging.Error},
+		Unimplemented:      {http.StatusNotImplemented, codes.Unimplemented, logging.Error},
+		Unavailable:        {http.StatusServiceUnavailable, codes.Unavailable, logging.Error},
+		Internal:           {http.StatusInternalServerError, codes.Internal, logging.Error},
+
+		PrinterOffline:   {http.StatusServiceUnavailable, codes.Unavailable, logging.Warning},
+		PrinterBusy:      {http.StatusServiceUnavailable, codes.Unavailable, logging.Warning},
+		MediaUnavailable: {http.StatusConflict, codes.FailedPrecondition, logging.Warning},
+		JobRejected:      {http.StatusUnprocessableEntity, codes.InvalidArgument, logging.Warning},
+		VendorError:      {http.StatusBadGateway, codes.Unavailable, logging.Error},
+	}
+)
+
+// Register adds or replaces the mapping of code, e.g. for a vendor's own
+// codes. Call it from init.
+func Register(code Code, s Spec) {
+	mu.Lock()
+	defer mu.Unlock()
+	specs[code] = s
+}
+
+// SpecOf returns the mapping of code; unregistered codes map like Unknown.
+func SpecOf(code Code) Spec {
+	mu.RLock()
+	defer mu.RUnlock()
+	if s, ok := specs[code]; ok {
+		return s
+	}
+	return specs[Unknown]
+}
+
+// HTTPStatus returns the HTTP status for err's code.
+func HTTPStatus(err error) int { return SpecOf(CodeOf(err)).HTTPStatus }
+
+// GRPCCode returns the gRPC code for err's code.
+func GRPCCode(err error) codes.Code { return SpecOf(CodeOf(err)).GRPCCode }
+
+// Severity returns the log severity for err's code.
+func Severity(err error) logging.Severity { return SpecOf(CodeOf(err)).Severity }
+
+// LogSeverity returns the severity for e's code; the logger's Err method
+// logs at it.
+func (e *Error) LogSeverity() logging.Severity { return SpecOf(e.Code).Severity }
+
+// FromHTTPStatus returns the general code for an HTTP status, e.g. from a
+// downstream response.
+func FromHTTPStatus(status int) Code {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return InvalidArgument
+	case http.StatusUnauthorized:
+		return Unauthenticated
+	case http.StatusForbidden:
+		return PermissionDenied
+	case http.StatusNotFound:
+		return NotFound
+	case http.StatusConflict:
+		return Aborted
+	case http.StatusPreconditionFailed:
+		return FailedPrecondition
+	case http.StatusTooManyRequests:
+		return ResourceExhausted
+	case http.StatusNotImplemented:
+		return Unimplemented
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return Unavailable
+	case http.StatusGatewayTimeout:
+		return DeadlineExceeded
+	}
+	switch {
+	case status < 400:
+		return OK
+	case status < 500:
+		return InvalidArgument
+	default:
+		return Internal
+	}
+}
+
+// fromGRPC maps gRPC codes onto the general codes.
+var fromGRPC = map[codes.Code]Code{
+	codes.OK:                 OK,
+	codes.Canceled:           Canceled,
+	codes.Unknown:            Unknown,
+	codes.InvalidArgument:    InvalidArgument,
+	codes.DeadlineExceeded:   DeadlineExceeded,
+	codes.NotFound:           NotFound,
+	codes.AlreadyExists:      AlreadyExists,
+	codes.PermissionDenied:   PermissionDenied,
+	codes.ResourceExhausted:  ResourceExhausted,
+	codes.FailedPrecondition: FailedPrecondition,
+	codes.Aborted:            Aborted,
+	codes.OutOfRange:         InvalidArgument,
+	codes.Unimplemented:      Unimplemented,
+	codes.Internal:           Internal,
+	codes.Unavailable:        Unavailable,
+	codes.DataLoss:           Internal,
+	codes.Unauthenticated:    Unauthenticated,
+}
@@ -0,0 +1,152 @@
+// Package errs defines coded errors that carry a public message, the
+// underlying cause and the stack where they were created, and maps their
+// codes to HTTP statuses, gRPC codes and log severities. The logger labels
+// entries with the code of a logged error and, through Err, picks the
+// severity from it.
+//
+// Quick start:
+//
+//	job, err := store.Get(ctx, id)
+//	if errors.Is(err, firestorex.ErrNotFound) {
+//	    return errs.Newf(errs.NotFound, "print job %s not found", id)
+//	}
+//	if err != nil {
+//	    return errs.Wrap(err, errs.Unavailable, "loading print job")
+//	}
+//
+//	// in the HTTP handler
+//	if err != nil {
+//	    lg.Err(ctx, r, "get print job failed", err) // warning for NotFound, error for Unavailable
+//	    errs.WriteHTTP(w, err)                      // 404 or 503 with a JSON body
+//	}
+package errs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"strings"
+)
+
+// Error is a coded error.
+type Error struct {
+	// Code classifies the error.
+	Code Code
+	// Msg is safe to show to callers; the cause may not be.
+	Msg string
+	// Err is the cause, if any.
+	Err   error
+	stack []uintptr
+}
+
+// New returns an Error with code and msg, recording the caller's stack.
+func New(code Code, msg string) error {
+	return &Error{Code: code, Msg: msg, stack: callers()}
+}
+
+// Newf is New with a formatted message.
+func Newf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Msg: fmt.Sprintf(format, args...), stack: callers()}
+}
+
+// Wrap returns err with code and msg, or nil if err is nil. The stack of
+// an Error already in err's chain is kept; otherwise the caller's stack
+// is recorded.
+func Wrap(err error, code Code, msg string) error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{Code: code, Msg: msg, Err: err}
+	var inner *Error
+	if errors.As(err, &inner) && inner.stack != nil {
+		e.stack = inner.stack
+	} else {
+		e.stack = callers()
+	}
+	return e
+}
+
+// Wrapf is Wrap with a formatted message.
+func Wrapf(err error, code Code, format string, args ...any) error {
+	if err == nil {
+		return nil
+	}
+	return Wrap(err, code, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Msg
+	}
+	if e.Msg == "" {
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorCode returns the code as a string; the logger labels entries with it.
+func (e *Error) ErrorCode() string { return string(e.Code) }
+
+// Stack returns the stack where the error was created, formatted like a
+// goroutine's trace in a panic.
+func (e *Error) Stack() string {
+	var b strings.Builder
+	frames := runtime.CallersFrames(e.stack)
+	for {
+		f, more := frames.Next()
+		if f.Function != "" {
+			fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		if !more {
+			break
+		}
+	}
+	return b.String()
+}
+
+func callers() []uintptr {
+	pcs := make([]uintptr, 32)
+	// skip runtime.Callers, callers and the constructor
+	n := runtime.Callers(3, pcs)
+	return pcs[:n]
+}
+
+// CodeOf returns the code of the first Error in err's chain. Errors
+// without one are classified by their gRPC status, context.Canceled and
+// context.DeadlineExceeded; CodeOf(nil) is OK and anything else Unknown.
+func CodeOf(err error) Code {
+	if err == nil {
+		return OK
+	}
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return Canceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return DeadlineExceeded
+	}
+	if c, ok := fromGRPCError(err); ok {
+		return c
+	}
+	return Unknown
+}
+
+// Is reports whether err's code is code.
+func Is(err error, code Code) bool { return CodeOf(err) == code }
+
+// Message returns the first non-empty message of an Error in err's chain,
+// safe to show to callers, or "" if there is none.
+func Message(err error) string {
+	for ; err != nil; err = errors.Unwrap(err) {
+		if e, ok := err.(*Error); ok && e.Msg != "" {
+			return e.Msg
+		}
+	}
+	return ""
+}
@@ -0,0 +1,222 @@
+package errs_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/logging"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+)
+
+var errCause = errors.New("firestore: connection reset")
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want errs.Code
+	}{
+		{"nil", nil, errs.OK},
+		{"coded", errs.New(errs.NotFound, "job not found"), errs.NotFound},
+		{"wrapped coded", fmt.Errorf("get: %w", errs.New(errs.PrinterBusy, "busy")), errs.PrinterBusy},
+		{"outermost code wins", errs.Wrap(errs.New(errs.NotFound, "x"), errs.Internal, "y"), errs.Internal},
+		{"canceled", fmt.Errorf("send: %w", context.Canceled), errs.Canceled},
+		{"deadline", context.DeadlineExceeded, errs.DeadlineExceeded},
+		{"grpc status", status.Error(codes.PermissionDenied, "no"), errs.PermissionDenied},
+		{"grpc out of range", status.Error(codes.OutOfRange, "no"), errs.InvalidArgument},
+		{"plain", errCause, errs.Unknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errs.CodeOf(tt.err); got != tt.want {
+				t.Errorf("CodeOf = %q, want %q", got, tt.want)
+			}
+			if !errs.Is(tt.err, tt.want) {
+				t.Errorf("Is(%q) = false", tt.want)
+			}
+		})
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if errs.Wrap(nil, errs.Internal, "x") != nil || errs.Wrapf(nil, errs.Internal, "x %d", 1) != nil {
+		t.Error("Wrap(nil) is not nil")
+	}
+	tests := []struct {
+		name    string
+		err     error
+		wantMsg string
+		wantStr string
+	}{
+		{"message only", errs.New(errs.NotFound, "print job 42 not found"), "print job 42 not found", "print job 42 not found"},
+		{"formatted", errs.Newf(errs.NotFound, "print job %d not found", 42), "print job 42 not found", "print job 42 not found"},
+		{"wrapped cause", errs.Wrap(errCause, errs.Unavailable, "loading print job"), "loading print job", "loading print job: " + errCause.Error()},
+		{"no message", errs.Wrap(errCause, errs.Unavailable, ""), "", errCause.Error()},
+		{"inner message", fmt.Errorf("handler: %w", errs.Wrapf(errCause, errs.Unavailable, "loading job %d", 7)), "loading job 7", "handler: loading job 7: " + errCause.Error()},
+		{"uncoded", errCause, "", errCause.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errs.Message(tt.err); got != tt.wantMsg {
+				t.Errorf("Message = %q, want %q", got, tt.wantMsg)
+			}
+			if got := tt.err.Error(); got != tt.wantStr {
+				t.Errorf("Error = %q, want %q", got, tt.wantStr)
+			}
+		})
+	}
+	if err := errs.Wrap(errCause, errs.Unavailable, "x"); !errors.Is(err, errCause) {
+		t.Error("Wrap hides the cause from errors.Is")
+	}
+}
+
+func TestStack(t *testing.T) {
+	inner := errs.New(errs.NotFound, "x")
+	var e *errs.Error
+	if !errors.As(inner, &e) || !strings.Contains(e.Stack(), "errs_test.TestStack") {
+		t.Fatalf("stack does not start at the caller:\n%s", e.Stack())
+	}
+	var outer *errs.Error
+	_ = errors.As(wrapElsewhere(inner), &outer)
+	if outer.Stack() != e.Stack() {
+		t.Error("Wrap replaced the stack of the inner Error")
+	}
+}
+
+func wrapElsewhere(err error) error { return errs.Wrap(err, errs.Internal, "y") }
+
+func TestMapping(t *testing.T) {
+	tests := []struct {
+		err      error
+		wantHTTP int
+		wantGRPC codes.Code
+		wantSev  logging.Severity
+	}{
+		{errs.New(errs.NotFound, "x"), http.StatusNotFound, codes.NotFound, logging.Warning},
+		{errs.New(errs.PrinterOffline, "x"), http.StatusServiceUnavailable, codes.Unavailable, logging.Warning},
+		{errs.New(errs.VendorError, "x"), http.StatusBadGateway, codes.Unavailable, logging.Error},
+		{context.Canceled, 499, codes.Canceled, logging.Info},
+		{errs.New("made_up", "x"), http.StatusInternalServerError, codes.Unknown, logging.Error},
+		{errCause, http.StatusInternalServerError, codes.Unknown, logging.Error},
+	}
+	for _, tt := range tests {
+		t.Run(string(errs.CodeOf(tt.err)), func(t *testing.T) {
+			if got := errs.HTTPStatus(tt.err); got != tt.wantHTTP {
+				t.Errorf("HTTPStatus = %d, want %d", got, tt.wantHTTP)
+			}
+			if got := errs.GRPCCode(tt.err); got != tt.wantGRPC {
+				t.Errorf("GRPCCode = %s, want %s", got, tt.wantGRPC)
+			}
+			if got := errs.Severity(tt.err); got != tt.wantSev {
+				t.Errorf("Severity = %s, want %s", got, tt.wantSev)
+			}
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	const code errs.Code = "test_quota_exceeded"
+	errs.Register(code, errs.Spec{HTTPStatus: http.StatusPaymentRequired, GRPCCode: codes.ResourceExhausted, Severity: logging.Notice})
+	if got := errs.HTTPStatus(errs.New(code, "x")); got != http.StatusPaymentRequired {
+		t.Errorf("HTTPStatus = %d, want the registered 402", got)
+	}
+}
+
+func TestFromHTTPStatus(t *testing.T) {
+	tests := []struct {
+		status int
+		want   errs.Code
+	}{
+		{200, errs.OK},
+		{304, errs.OK},
+		{400, errs.InvalidArgument},
+		{404, errs.NotFound},
+		{409, errs.Aborted},
+		{418, errs.InvalidArgument},
+		{429, errs.ResourceExhausted},
+		{502, errs.Unavailable},
+		{503, errs.Unavailable},
+		{504, errs.DeadlineExceeded},
+		{500, errs.Internal},
+		{507, errs.Internal},
+	}
+	for _, tt := range tests {
+		if got := errs.FromHTTPStatus(tt.status); got != tt.want {
+			t.Errorf("FromHTTPStatus(%d) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestToGRPC(t *testing.T) {
+	if errs.ToGRPC(nil) != nil {
+		t.Error("ToGRPC(nil) is not nil")
+	}
+	tests := []struct {
+		name     string
+		err      error
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{"public message", errs.Wrap(errCause, errs.NotFound, "print job 42 not found"), codes.NotFound, "print job 42 not found"},
+		{"cause hidden", errCause, codes.Unknown, "unknown"},
+		{"context", context.DeadlineExceeded, codes.DeadlineExceeded, "deadline_exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := status.Convert(errs.ToGRPC(tt.err))
+			if st.Code() != tt.wantCode || st.Message() != tt.wantMsg {
+				t.Errorf("status = %s %q, want %s %q", st.Code(), st.Message(), tt.wantCode, tt.wantMsg)
+			}
+		})
+	}
+	if st, _ := status.FromError(errs.New(errs.PrinterBusy, "busy")); st.Code() != codes.Unavailable || st.Message() != "busy" {
+		t.Errorf("GRPCStatus = %s %q, want Unavailable busy", st.Code(), st.Message())
+	}
+}
+
+func TestWriteHTTP(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantCode   errs.Code
+		wantMsg    string
+	}{
+		{"coded", errs.Wrap(errCause, errs.NotFound, "print job 42 not found"), 404, errs.NotFound, "print job 42 not found"},
+		{"cause hidden", errCause, 500, errs.Unknown, "Internal Server Error"},
+		{"no status text", context.Canceled, 499, errs.Canceled, "canceled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			errs.WriteHTTP(w, tt.err)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var body struct {
+				Error struct {
+					Code    errs.Code `json:"code"`
+					Message string    `json:"message"`
+				} `json:"error"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Error.Code != tt.wantCode || body.Error.Message != tt.wantMsg {
+				t.Errorf("body = %+v, want %q %q", body.Error, tt.wantCode, tt.wantMsg)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package errs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"google.golang.org/grpc/status"
+)
+
+// GRPCStatus lets gRPC servers return Errors directly: the status carries
+// the mapped code and the public message.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(SpecOf(e.Code).GRPCCode, e.Msg)
+}
+
+// ToGRPC returns err as a gRPC status error with its mapped code, keeping
+// the message public: errors without an Error message get their code's
+// name instead of err's text.
+func ToGRPC(err error) error {
+	if err == nil {
+		return nil
+	}
+	code := CodeOf(err)
+	msg := Message(err)
+	if msg == "" {
+		msg = string(code)
+	}
+	return status.Error(SpecOf(code).GRPCCode, msg)
+}
+
+func fromGRPCError(err error) (Code, bool) {
+	var se interface{ GRPCStatus() *status.Status }
+	if !errors.As(err, &se) {
+		return "", false
+	}
+	c, ok := fromGRPC[se.GRPCStatus().Code()]
+	if !ok {
+		return Unknown, true
+	}
+	return c, true
+}
+
+// WriteHTTP answers with err's mapped status and a JSON body:
+//
+//	{"error": {"code": "not_found", "message": "print job 42 not found"}}
+//
+// The message is the Error's public message; errors without one get their
+// status text, so causes never reach callers. err must not be nil.
+func WriteHTTP(w http.ResponseWriter, err error) {
+	code := CodeOf(err)
+	st := SpecOf(code).HTTPStatus
+	msg := Message(err)
+	if msg == "" {
+		msg = http.StatusText(st)
+	}
+	if msg == "" {
+		msg = string(code)
+	}
+	var body struct {
+		Error struct {
+			Code    Code   `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	body.Error.Code = code
+	body.Error.Message = msg
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(st)
+	_ = json.NewEncoder(w).Encode(body)
+}
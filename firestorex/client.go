@@ -0,0 +1,96 @@
+// Package firestorex removes the Firestore boilerplate of job-tracking
+// services: typed collections with get/set/query helpers, cursor pagination,
+// transactions retried on contention and outages, and client construction
+// that works the same against the emulator.
+//
+// Quick start:
+//
+//	client, err := firestorex.NewClient(ctx, "") // project from the environment
+//	if err != nil { return err }
+//	defer client.Close()
+//
+//	jobs := firestorex.NewCollection[Job](client, "print-jobs")
+//	job, err := jobs.Get(ctx, "42")
+//	if errors.Is(err, firestorex.ErrNotFound) { ... }
+//
+//	page, next, err := jobs.Page(ctx, jobs.Ref().Where("status", "==", "queued").OrderBy("createdAt", firestore.Asc), 50, cursor)
+package firestorex
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// EmulatorProjectID is used against the emulator when no project is
+// configured; "demo-" projects never reach real Google Cloud resources.
+const EmulatorProjectID = "demo-local"
+
+type Options struct {
+	DatabaseID    string
+	EmulatorHost  string
+	ClientOptions []option.ClientOption
+}
+
+type Option func(*Options)
+
+// WithDatabase connects to a named database instead of "(default)".
+func WithDatabase(id string) Option { return func(o *Options) { o.DatabaseID = id } }
+
+// WithEmulatorHost connects to the emulator at addr ("localhost:8080"), as
+// the FIRESTORE_EMULATOR_HOST variable does, e.g. from tests.
+func WithEmulatorHost(addr string) Option { return func(o *Options) { o.EmulatorHost = addr } }
+
+// WithClientOptions passes options such as credentials to the client.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *Options) { o.ClientOptions = append(o.ClientOptions, opts...) }
+}
+
+// NewClient returns a Firestore client for projectID. An empty projectID
+// is read from GOOGLE_CLOUD_PROJECT, then detected from the credentials;
+// against the emulator it falls back to EmulatorProjectID, so local runs
+// need no configuration beyond FIRESTORE_EMULATOR_HOST.
+func NewClient(ctx context.Context, projectID string, opts ...Option) (*firestore.Client, error) {
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	clientOpts := options.ClientOptions
+	if options.EmulatorHost != "" {
+		clientOpts = append([]option.ClientOption{
+			option.WithEndpoint(options.EmulatorHost),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		}, clientOpts...)
+	}
+	if projectID == "" {
+		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if projectID == "" {
+		projectID = firestore.DetectProjectID
+		if Emulated() || options.EmulatorHost != "" {
+			projectID = EmulatorProjectID
+		}
+	}
+
+	var client *firestore.Client
+	var err error
+	if options.DatabaseID != "" {
+		client, err = firestore.NewClientWithDatabase(ctx, projectID, options.DatabaseID, clientOpts...)
+	} else {
+		client, err = firestore.NewClient(ctx, projectID, clientOpts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("firestorex: new client: %w", err)
+	}
+	return client, nil
+}
+
+// Emulated reports whether FIRESTORE_EMULATOR_HOST points clients at the
+// emulator.
+func Emulated() bool { return os.Getenv("FIRESTORE_EMULATOR_HOST") != "" }
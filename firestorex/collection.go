@@ -0,0 +1,178 @@
+package firestorex
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrNotFound is returned, wrapped, for documents that do not exist.
+	ErrNotFound = errors.New("firestorex: document not found")
+	// ErrAlreadyExists is returned, wrapped, by Create for an existing
+	// document.
+	ErrAlreadyExists = errors.New("firestorex: document already exists")
+	// ErrInvalidCursor is returned by Page for a cursor it did not issue.
+	ErrInvalidCursor = errors.New("firestorex: invalid page cursor")
+)
+
+// Doc is a decoded document with its ID and update time.
+type Doc[T any] struct {
+	ID         string
+	Data       T
+	UpdateTime time.Time
+}
+
+// Collection is a collection of documents decoded as T, using T's
+// `firestore` struct tags.
+type Collection[T any] struct {
+	ref *firestore.CollectionRef
+}
+
+// NewCollection returns the collection at path, e.g. "print-jobs" or
+// "print-jobs/42/events".
+func NewCollection[T any](client *firestore.Client, path string) *Collection[T] {
+	return &Collection[T]{ref: client.Collection(path)}
+}
+
+// Ref returns the collection reference, to build queries.
+func (c *Collection[T]) Ref() *firestore.CollectionRef { return c.ref }
+
+// Get returns the document id.
+func (c *Collection[T]) Get(ctx context.Context, id string) (T, error) {
+	var v T
+	snap, err := c.ref.Doc(id).Get(ctx)
+	if err != nil {
+		return v, c.wrap("get", id, err)
+	}
+	if err := snap.DataTo(&v); err != nil {
+		return v, fmt.Errorf("firestorex: decode %s/%s: %w", c.ref.ID, id, err)
+	}
+	return v, nil
+}
+
+// Set writes the document id, replacing it, or merging fields when given
+// firestore.MergeAll.
+func (c *Collection[T]) Set(ctx context.Context, id string, v T, opts ...firestore.SetOption) error {
+	if _, err := c.ref.Doc(id).Set(ctx, v, opts...); err != nil {
+		return c.wrap("set", id, err)
+	}
+	return nil
+}
+
+// Create writes the document id, failing with ErrAlreadyExists if it exists.
+func (c *Collection[T]) Create(ctx context.Context, id string, v T) error {
+	if _, err := c.ref.Doc(id).Create(ctx, v); err != nil {
+		return c.wrap("create", id, err)
+	}
+	return nil
+}
+
+// Update changes fields of the document id, failing with ErrNotFound if it
+// does not exist.
+func (c *Collection[T]) Update(ctx context.Context, id string, updates ...firestore.Update) error {
+	if _, err := c.ref.Doc(id).Update(ctx, updates); err != nil {
+		return c.wrap("update", id, err)
+	}
+	return nil
+}
+
+// Delete deletes the document id; deleting a missing document succeeds.
+func (c *Collection[T]) Delete(ctx context.Context, id string) error {
+	if _, err := c.ref.Doc(id).Delete(ctx); err != nil {
+		return c.wrap("delete", id, err)
+	}
+	return nil
+}
+
+// Query returns every document matching q, which must be built from Ref.
+// Use Page for queries that may match many documents.
+func (c *Collection[T]) Query(ctx context.Context, q firestore.Query) ([]Doc[T], error) {
+	return c.collect(q.Documents(ctx), -1)
+}
+
+// Page returns up to size documents of q after cursor ("" for the first
+// page), and the cursor of the next page, "" after the last one. Cursors
+// are opaque; they stay valid while the document they point past exists.
+func (c *Collection[T]) Page(ctx context.Context, q firestore.Query, size int, cursor string) ([]Doc[T], string, error) {
+	size = max(size, 1)
+	if cursor != "" {
+		id, err := base64.RawURLEncoding.DecodeString(cursor)
+		if err != nil {
+			return nil, "", ErrInvalidCursor
+		}
+		// the snapshot carries every field q orders by, whatever they are
+		snap, err := c.ref.Doc(string(id)).Get(ctx)
+		if err != nil {
+			return nil, "", c.wrap("page", string(id), err)
+		}
+		q = q.StartAfter(snap)
+	}
+	// one extra document tells whether there is a next page
+	docs, err := c.collect(q.Limit(size+1).Documents(ctx), size+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(docs) <= size {
+		return docs, "", nil
+	}
+	docs = docs[:size]
+	return docs, base64.RawURLEncoding.EncodeToString([]byte(docs[size-1].ID)), nil
+}
+
+func (c *Collection[T]) collect(it *firestore.DocumentIterator, limit int) ([]Doc[T], error) {
+	defer it.Stop()
+	var out []Doc[T]
+	for limit < 0 || len(out) < limit {
+		snap, err := it.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("firestorex: query %s: %w", c.ref.ID, err)
+		}
+		d := Doc[T]{ID: snap.Ref.ID, UpdateTime: snap.UpdateTime}
+		if err := snap.DataTo(&d.Data); err != nil {
+			return nil, fmt.Errorf("firestorex: decode %s/%s: %w", c.ref.ID, snap.Ref.ID, err)
+		}
+		out = append(out, d)
+	}
+	return out, nil
+}
+
+// GetTx returns the document id within a transaction.
+func (c *Collection[T]) GetTx(tx *firestore.Transaction, id string) (T, error) {
+	var v T
+	snap, err := tx.Get(c.ref.Doc(id))
+	if err != nil {
+		return v, c.wrap("get", id, err)
+	}
+	if err := snap.DataTo(&v); err != nil {
+		return v, fmt.Errorf("firestorex: decode %s/%s: %w", c.ref.ID, id, err)
+	}
+	return v, nil
+}
+
+// SetTx writes the document id within a transaction.
+func (c *Collection[T]) SetTx(tx *firestore.Transaction, id string, v T, opts ...firestore.SetOption) error {
+	return tx.Set(c.ref.Doc(id), v, opts...)
+}
+
+// wrap maps NotFound and AlreadyExists to ErrNotFound and ErrAlreadyExists,
+// keeping the original error in the chain.
+func (c *Collection[T]) wrap(op, id string, err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return fmt.Errorf("%w: %s/%s: %w", ErrNotFound, c.ref.ID, id, err)
+	case codes.AlreadyExists:
+		return fmt.Errorf("%w: %s/%s: %w", ErrAlreadyExists, c.ref.ID, id, err)
+	}
+	return fmt.Errorf("firestorex: %s %s/%s: %w", op, c.ref.ID, id, err)
+}
@@ -0,0 +1,364 @@
+package firestorex_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/firestore/apiv1/firestorepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/print-engine/ieos-golang-utils/firestorex"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+// fakeFirestore keeps documents in memory and answers the calls the
+// client makes for gets, writes, queries ordered by document ID and
+// transactions.
+type fakeFirestore struct {
+	firestorepb.UnimplementedFirestoreServer
+
+	mu   sync.Mutex
+	docs map[string]*firestorepb.Document // by full name
+}
+
+func (f *fakeFirestore) BatchGetDocuments(req *firestorepb.BatchGetDocumentsRequest, stream firestorepb.Firestore_BatchGetDocumentsServer) error {
+	f.mu.Lock()
+	var resps []*firestorepb.BatchGetDocumentsResponse
+	for _, name := range req.GetDocuments() {
+		resp := &firestorepb.BatchGetDocumentsResponse{ReadTime: timestamppb.Now()}
+		if d, ok := f.docs[name]; ok {
+			resp.Result = &firestorepb.BatchGetDocumentsResponse_Found{Found: proto.Clone(d).(*firestorepb.Document)}
+		} else {
+			resp.Result = &firestorepb.BatchGetDocumentsResponse_Missing{Missing: name}
+		}
+		resps = append(resps, resp)
+	}
+	f.mu.Unlock()
+	for _, resp := range resps {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirestore) Commit(_ context.Context, req *firestorepb.CommitRequest) (*firestorepb.CommitResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	now := timestamppb.Now()
+	resp := &firestorepb.CommitResponse{CommitTime: now}
+	for _, w := range req.GetWrites() {
+		name := w.GetDelete()
+		if d := w.GetUpdate(); d != nil {
+			name = d.GetName()
+		}
+		_, exists := f.docs[name]
+		if pre := w.GetCurrentDocument(); pre != nil && pre.GetExists() != exists {
+			if exists {
+				return nil, status.Errorf(codes.AlreadyExists, "document %s exists", name)
+			}
+			return nil, status.Errorf(codes.NotFound, "no document %s", name)
+		}
+		switch {
+		case w.GetDelete() != "":
+			delete(f.docs, name)
+		case w.GetUpdateMask() != nil && exists:
+			d := f.docs[name]
+			for _, path := range w.GetUpdateMask().GetFieldPaths() {
+				if v, ok := w.GetUpdate().GetFields()[path]; ok {
+					d.Fields[path] = v
+				} else {
+					delete(d.Fields, path)
+				}
+			}
+			d.UpdateTime = now
+		default:
+			d := proto.Clone(w.GetUpdate()).(*firestorepb.Document)
+			if d.Fields == nil {
+				d.Fields = map[string]*firestorepb.Value{}
+			}
+			d.CreateTime, d.UpdateTime = now, now
+			f.docs[name] = d
+		}
+		resp.WriteResults = append(resp.WriteResults, &firestorepb.WriteResult{UpdateTime: now})
+	}
+	return resp, nil
+}
+
+// RunQuery supports a single collection ordered by document ID, with a
+// start-after cursor and a limit.
+func (f *fakeFirestore) RunQuery(req *firestorepb.RunQueryRequest, stream firestorepb.Firestore_RunQueryServer) error {
+	q := req.GetStructuredQuery()
+	prefix := req.GetParent() + "/" + q.GetFrom()[0].GetCollectionId() + "/"
+	after := ""
+	if v := q.GetStartAt().GetValues(); len(v) > 0 {
+		after = v[len(v)-1].GetReferenceValue()
+	}
+	f.mu.Lock()
+	var names []string
+	for name := range f.docs {
+		if strings.HasPrefix(name, prefix) && !strings.Contains(name[len(prefix):], "/") && name > after {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	if l := q.GetLimit(); l != nil && int(l.GetValue()) < len(names) {
+		names = names[:l.GetValue()]
+	}
+	var docs []*firestorepb.Document
+	for _, name := range names {
+		docs = append(docs, proto.Clone(f.docs[name]).(*firestorepb.Document))
+	}
+	f.mu.Unlock()
+	for _, d := range docs {
+		if err := stream.Send(&firestorepb.RunQueryResponse{Document: d, ReadTime: timestamppb.Now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fakeFirestore) BeginTransaction(context.Context, *firestorepb.BeginTransactionRequest) (*firestorepb.BeginTransactionResponse, error) {
+	return &firestorepb.BeginTransactionResponse{Transaction: []byte("tx")}, nil
+}
+
+func (f *fakeFirestore) Rollback(context.Context, *firestorepb.RollbackRequest) (*emptypb.Empty, error) {
+	return &emptypb.Empty{}, nil
+}
+
+// client returns a Firestore client backed by an in-process fakeFirestore.
+func client(t *testing.T) *firestore.Client {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	firestorepb.RegisterFirestoreServer(srv, &fakeFirestore{docs: map[string]*firestorepb.Document{}})
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	c, err := firestorex.NewClient(context.Background(), "demo-test", firestorex.WithEmulatorHost(lis.Addr().String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+type job struct {
+	Printer string `firestore:"printer"`
+	Pages   int    `firestore:"pages"`
+}
+
+func TestCollection(t *testing.T) {
+	type step struct {
+		op      string // get, set, create, update, delete
+		id      string
+		v       job
+		wantErr error // ErrNotFound, ErrAlreadyExists or nil
+		want    job
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{"get missing", []step{{op: "get", id: "42", wantErr: firestorex.ErrNotFound}}},
+		{"set then get", []step{
+			{op: "set", id: "42", v: job{"hp-7", 3}},
+			{op: "get", id: "42", want: job{"hp-7", 3}},
+		}},
+		{"create twice", []step{
+			{op: "create", id: "42", v: job{"hp-7", 3}},
+			{op: "create", id: "42", v: job{"hp-8", 1}, wantErr: firestorex.ErrAlreadyExists},
+			{op: "get", id: "42", want: job{"hp-7", 3}},
+		}},
+		{"update", []step{
+			{op: "update", id: "42", wantErr: firestorex.ErrNotFound},
+			{op: "set", id: "42", v: job{"hp-7", 3}},
+			{op: "update", id: "42"},
+			{op: "get", id: "42", want: job{"hp-7", 4}},
+		}},
+		{"delete", []step{
+			{op: "delete", id: "42"},
+			{op: "set", id: "42", v: job{"hp-7", 3}},
+			{op: "delete", id: "42"},
+			{op: "get", id: "42", wantErr: firestorex.ErrNotFound},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobs := firestorex.NewCollection[job](client(t), "print-jobs")
+			ctx := context.Background()
+			for i, s := range tt.steps {
+				var got job
+				var err error
+				switch s.op {
+				case "get":
+					got, err = jobs.Get(ctx, s.id)
+				case "set":
+					err = jobs.Set(ctx, s.id, s.v)
+				case "create":
+					err = jobs.Create(ctx, s.id, s.v)
+				case "update":
+					err = jobs.Update(ctx, s.id, firestore.Update{Path: "pages", Value: 4})
+				case "delete":
+					err = jobs.Delete(ctx, s.id)
+				}
+				if s.wantErr != nil {
+					if !errors.Is(err, s.wantErr) {
+						t.Fatalf("step %d %s = %v, want %v", i, s.op, err, s.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatalf("step %d %s = %v", i, s.op, err)
+				}
+				if got != s.want {
+					t.Errorf("step %d %s = %+v, want %+v", i, s.op, got, s.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPage(t *testing.T) {
+	c := client(t)
+	jobs := firestorex.NewCollection[job](c, "print-jobs")
+	ctx := context.Background()
+	for i := 1; i <= 5; i++ {
+		if err := jobs.Set(ctx, fmt.Sprintf("job-%d", i), job{"hp-7", i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// another collection's documents are not listed
+	if err := firestorex.NewCollection[job](c, "printers").Set(ctx, "hp-7", job{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		size      int
+		wantPages string
+	}{
+		{2, "job-1,job-2 job-3,job-4 job-5"},
+		{5, "job-1,job-2,job-3,job-4,job-5"},
+		{10, "job-1,job-2,job-3,job-4,job-5"},
+		{0, "job-1 job-2 job-3 job-4 job-5"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.size), func(t *testing.T) {
+			var pages []string
+			cursor := ""
+			for {
+				docs, next, err := jobs.Page(ctx, jobs.Ref().OrderBy(firestore.DocumentID, firestore.Asc), tt.size, cursor)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ids []string
+				for _, d := range docs {
+					ids = append(ids, d.ID)
+					if d.Data.Printer != "hp-7" || d.UpdateTime.IsZero() {
+						t.Errorf("doc = %+v", d)
+					}
+				}
+				pages = append(pages, strings.Join(ids, ","))
+				if next == "" {
+					break
+				}
+				if len(pages) > 5 {
+					t.Fatal("paging does not end")
+				}
+				cursor = next
+			}
+			if got := strings.Join(pages, " "); got != tt.wantPages {
+				t.Errorf("pages = %s, want %s", got, tt.wantPages)
+			}
+		})
+	}
+
+	if _, _, err := jobs.Page(ctx, jobs.Ref().Query, 2, "%%%"); !errors.Is(err, firestorex.ErrInvalidCursor) {
+		t.Errorf("garbled cursor = %v, want ErrInvalidCursor", err)
+	}
+	docs, err := jobs.Query(ctx, jobs.Ref().Query)
+	if err != nil || len(docs) != 5 {
+		t.Errorf("Query = %d docs, %v", len(docs), err)
+	}
+}
+
+func TestRunTransaction(t *testing.T) {
+	errOutage := status.Error(codes.Unavailable, "backend unavailable")
+	tests := []struct {
+		name      string
+		fail      []error // returned by the first attempts
+		wantCalls int32
+		wantPages int
+		wantErr   bool
+	}{
+		{"commits", nil, 1, 4, false},
+		{"outage retried", []error{errOutage}, 2, 4, false},
+		{"permanent not retried", []error{retryx.Permanent(errOutage)}, 1, 3, true},
+		{"retries run out", []error{errOutage, errOutage, errOutage}, 3, 3, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client(t)
+			jobs := firestorex.NewCollection[job](c, "print-jobs")
+			ctx := context.Background()
+			if err := jobs.Set(ctx, "42", job{"hp-7", 3}); err != nil {
+				t.Fatal(err)
+			}
+			policy := firestorex.TxPolicy
+			policy.MaxAttempts, policy.InitialDelay = 3, 1
+			var calls atomic.Int32
+			err := firestorex.RunTransactionWithPolicy(ctx, c, policy, func(ctx context.Context, tx *firestore.Transaction) error {
+				n := calls.Add(1)
+				j, err := jobs.GetTx(tx, "42")
+				if err != nil {
+					return err
+				}
+				if int(n) <= len(tt.fail) {
+					return tt.fail[n-1]
+				}
+				j.Pages++
+				return jobs.SetTx(tx, "42", j)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("RunTransaction = %v, want error %v", err, tt.wantErr)
+			}
+			if n := calls.Load(); n != tt.wantCalls {
+				t.Errorf("ran %d times, want %d", n, tt.wantCalls)
+			}
+			if got, _ := jobs.Get(ctx, "42"); got.Pages != tt.wantPages {
+				t.Errorf("pages = %d, want %d", got.Pages, tt.wantPages)
+			}
+		})
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	t.Setenv("FIRESTORE_EMULATOR_HOST", "")
+	if firestorex.Emulated() {
+		t.Error("Emulated with no FIRESTORE_EMULATOR_HOST")
+	}
+	c, err := firestorex.NewClient(context.Background(), "", firestorex.WithEmulatorHost("127.0.0.1:1"), firestorex.WithDatabase("print"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if got := c.Collection("print-jobs").Path; !strings.HasPrefix(got, "projects/"+firestorex.EmulatorProjectID+"/databases/print/") {
+		t.Errorf("path = %s", got)
+	}
+}
@@ -0,0 +1,35 @@
+package firestorex
+
+import (
+	"context"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+	"google.golang.org/grpc/codes"
+)
+
+// TxPolicy is the default retry policy of RunTransaction: on top of the
+// client's own retries of contended commits, transactions are retried with
+// backoff on contention (Aborted) and outages.
+var TxPolicy = retryx.Policy{
+	MaxAttempts:  5,
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     5 * time.Second,
+	Retryable:    retryx.GRPCCodes(codes.Aborted, codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted),
+}
+
+// RunTransaction runs fn in a transaction, retrying the whole transaction
+// per TxPolicy, so fn must be safe to run more than once: no side effects
+// outside the transaction. Return retryx.Permanent(err) from fn to give up
+// at once.
+func RunTransaction(ctx context.Context, client *firestore.Client, fn func(ctx context.Context, tx *firestore.Transaction) error, opts ...firestore.TransactionOption) error {
+	return RunTransactionWithPolicy(ctx, client, TxPolicy, fn, opts...)
+}
+
+// RunTransactionWithPolicy is RunTransaction with a custom retry policy.
+func RunTransactionWithPolicy(ctx context.Context, client *firestore.Client, p retryx.Policy, fn func(ctx context.Context, tx *firestore.Transaction) error, opts ...firestore.TransactionOption) error {
+	return p.Do(ctx, func(ctx context.Context) error {
+		return client.RunTransaction(ctx, fn, opts...)
+	})
+}
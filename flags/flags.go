@@ -0,0 +1,243 @@
+// Package flags evaluates feature flags kept in a Firestore document or a
+// GCS JSON object. Flags are cached in memory and refreshed as the source
+// changes, so checking one is a map lookup; rules turn them on per
+// environment, per tenant, or for a stable percentage of tenants.
+//
+// Quick start:
+//
+//	ff, err := flags.New(ctx, flags.FirestoreSource(fs, "config/flags"),
+//	    flags.WithEnvironment(os.Getenv("ENVIRONMENT")),
+//	    flags.WithLogger(lg),
+//	)
+//	if err != nil { return err }
+//	defer ff.Close()
+//
+//	ctx = flags.WithTarget(ctx, flags.Target{Tenant: tenantID})
+//	if ff.Enabled(ctx, "new-alert-routing") {
+//	    routeV2(ctx, alert)
+//	}
+//
+// with the document (or object) holding one field per flag:
+//
+//	{"new-alert-routing": {"enabled": true, "environments": ["staging", "prod"],
+//	                       "tenants": ["acme"], "percentage": 10}}
+package flags
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Flag is a flag's rules, checked in order:
+//
+//  1. a disabled flag is off everywhere;
+//  2. tenants in ExcludeTenants are off;
+//  3. outside Environments, when set, the flag is off;
+//  4. tenants in Tenants are on;
+//  5. with Percentage set, that share of targets is on, chosen by hashing
+//     the flag name with the target's key, so each tenant stays on or off
+//     as the percentage grows;
+//  6. otherwise the flag is on, unless Tenants was set, in which case only
+//     those tenants are.
+type Flag struct {
+	Enabled        bool     `json:"enabled"`
+	Environments   []string `json:"environments,omitempty"`
+	Tenants        []string `json:"tenants,omitempty"`
+	ExcludeTenants []string `json:"excludeTenants,omitempty"`
+	// Percentage, from 0 to 100, rolls the flag out gradually.
+	Percentage *float64 `json:"percentage,omitempty"`
+}
+
+// Set is every flag by name.
+type Set map[string]Flag
+
+// Target is who a flag is evaluated for.
+type Target struct {
+	Tenant string
+	// Environment overrides the Client's, e.g. for a tenant's sandbox.
+	Environment string
+	// Key picks the percentage bucket; it defaults to Tenant. Set it to a
+	// user or printer ID to roll out per user or printer instead.
+	Key string
+}
+
+type targetKey struct{}
+
+// WithTarget returns ctx with t, which Enabled evaluates flags for.
+func WithTarget(ctx context.Context, t Target) context.Context {
+	return context.WithValue(ctx, targetKey{}, t)
+}
+
+// TargetFrom returns the Target set by WithTarget.
+func TargetFrom(ctx context.Context) Target {
+	t, _ := ctx.Value(targetKey{}).(Target)
+	return t
+}
+
+// Source loads flags and reports their changes.
+type Source interface {
+	// Load returns the current flags.
+	Load(ctx context.Context) (Set, error)
+	// Watch calls changed with the flags whenever they change, until ctx
+	// is done or watching fails.
+	Watch(ctx context.Context, changed func(Set)) error
+}
+
+type Options struct {
+	Environment string
+	Logger      *logger.CloudLogger
+	OnChange    func(Set)
+	RetryDelay  time.Duration
+}
+
+type Option func(*Options)
+
+// WithEnvironment sets the environment flags are evaluated in, such as
+// "prod"; Environments rules never match without one.
+func WithEnvironment(env string) Option { return func(o *Options) { o.Environment = env } }
+
+// WithLogger logs flag changes at info and watch failures at warning.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithOnChange calls fn with the new flags after each change.
+func WithOnChange(fn func(Set)) Option { return func(o *Options) { o.OnChange = fn } }
+
+// WithRetryDelay sets how long to wait before watching again after the
+// source fails, 10s by default. The last flags stay in use meanwhile.
+func WithRetryDelay(d time.Duration) Option { return func(o *Options) { o.RetryDelay = d } }
+
+// Client evaluates flags from its source's latest Set. It is safe for
+// concurrent use.
+type Client struct {
+	opts   Options
+	src    Source
+	flags  atomic.Pointer[Set]
+	cancel context.CancelFunc
+	done   chan struct{}
+	once   sync.Once
+}
+
+// New loads the flags from src and keeps watching it until Close. It
+// fails if the first load does.
+func New(ctx context.Context, src Source, opts ...Option) (*Client, error) {
+	options := Options{RetryDelay: 10 * time.Second}
+	for _, f := range opts {
+		f(&options)
+	}
+	set, err := src.Load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("flags: load: %w", err)
+	}
+	wctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &Client{opts: options, src: src, cancel: cancel, done: make(chan struct{})}
+	c.flags.Store(&set)
+	go c.watch(wctx)
+	return c, nil
+}
+
+// Close stops watching the source.
+func (c *Client) Close() error {
+	c.once.Do(func() {
+		c.cancel()
+		<-c.done
+	})
+	return nil
+}
+
+func (c *Client) watch(ctx context.Context) {
+	defer close(c.done)
+	for {
+		err := c.src.Watch(ctx, c.update)
+		if ctx.Err() != nil {
+			return
+		}
+		if err == nil {
+			err = errors.New("watch ended")
+		}
+		c.warn("flags watch failed", err)
+		t := time.NewTimer(c.opts.RetryDelay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (c *Client) update(set Set) {
+	c.flags.Store(&set)
+	if lg := c.opts.Logger; lg != nil {
+		lg.Info(context.Background(), nil, "flags updated", map[string]any{"flags": len(set)})
+	}
+	if c.opts.OnChange != nil {
+		c.opts.OnChange(set)
+	}
+}
+
+// Flags returns the current flags; do not modify them.
+func (c *Client) Flags() Set { return *c.flags.Load() }
+
+// Enabled reports whether the flag name is on for the Target in ctx.
+// Unknown flags are off.
+func (c *Client) Enabled(ctx context.Context, name string) bool {
+	f, ok := c.Flags()[name]
+	if !ok {
+		return false
+	}
+	t := TargetFrom(ctx)
+	if t.Environment == "" {
+		t.Environment = c.opts.Environment
+	}
+	return f.Evaluate(name, t)
+}
+
+// Evaluate applies f's rules, named name, for t; see Flag.
+func (f Flag) Evaluate(name string, t Target) bool {
+	switch {
+	case !f.Enabled:
+		return false
+	case t.Tenant != "" && slices.Contains(f.ExcludeTenants, t.Tenant):
+		return false
+	case len(f.Environments) > 0 && !slices.Contains(f.Environments, t.Environment):
+		return false
+	case t.Tenant != "" && slices.Contains(f.Tenants, t.Tenant):
+		return true
+	case f.Percentage != nil:
+		key := t.Key
+		if key == "" {
+			key = t.Tenant
+		}
+		if key == "" {
+			return *f.Percentage >= 100
+		}
+		return float64(bucket(name, key)) < *f.Percentage*100
+	}
+	return len(f.Tenants) == 0
+}
+
+// bucket places key in one of 10000 buckets, independently per flag.
+func bucket(name, key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+	h.Write([]byte{0})
+	h.Write([]byte(key))
+	return h.Sum64() % 10000
+}
+
+func (c *Client) warn(msg string, err error) {
+	if lg := c.opts.Logger; lg != nil {
+		lg.Warning(context.Background(), nil, msg, map[string]any{"error": err.Error()})
+		return
+	}
+	log.Printf("%s: %v", msg, err)
+}
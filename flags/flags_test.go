@@ -0,0 +1,150 @@
+package flags_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/flags"
+)
+
+func pct(p float64) *float64 { return &p }
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		name string
+		flag flags.Flag
+		t    flags.Target
+		want bool
+	}{
+		{"disabled", flags.Flag{}, flags.Target{Tenant: "acme"}, false},
+		{"enabled", flags.Flag{Enabled: true}, flags.Target{}, true},
+		{"excluded tenant", flags.Flag{Enabled: true, ExcludeTenants: []string{"acme"}}, flags.Target{Tenant: "acme"}, false},
+		{"exclusion beats tenants", flags.Flag{Enabled: true, Tenants: []string{"acme"}, ExcludeTenants: []string{"acme"}}, flags.Target{Tenant: "acme"}, false},
+		{"in environment", flags.Flag{Enabled: true, Environments: []string{"prod"}}, flags.Target{Environment: "prod"}, true},
+		{"outside environment", flags.Flag{Enabled: true, Environments: []string{"prod"}}, flags.Target{Environment: "staging"}, false},
+		{"no environment", flags.Flag{Enabled: true, Environments: []string{"prod"}}, flags.Target{}, false},
+		{"environment beats tenants", flags.Flag{Enabled: true, Environments: []string{"prod"}, Tenants: []string{"acme"}}, flags.Target{Tenant: "acme", Environment: "dev"}, false},
+		{"listed tenant", flags.Flag{Enabled: true, Tenants: []string{"acme"}}, flags.Target{Tenant: "acme"}, true},
+		{"unlisted tenant", flags.Flag{Enabled: true, Tenants: []string{"acme"}}, flags.Target{Tenant: "globex"}, false},
+		{"listed tenant beats percentage", flags.Flag{Enabled: true, Tenants: []string{"acme"}, Percentage: pct(0)}, flags.Target{Tenant: "acme"}, true},
+		{"zero percent", flags.Flag{Enabled: true, Percentage: pct(0)}, flags.Target{Tenant: "acme"}, false},
+		{"hundred percent", flags.Flag{Enabled: true, Percentage: pct(100)}, flags.Target{Tenant: "acme"}, true},
+		{"percentage without key", flags.Flag{Enabled: true, Percentage: pct(99)}, flags.Target{}, false},
+		{"hundred percent without key", flags.Flag{Enabled: true, Percentage: pct(100)}, flags.Target{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.flag.Evaluate("new-alert-routing", tt.t); got != tt.want {
+				t.Errorf("Evaluate = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPercentageRollout(t *testing.T) {
+	on := func(p float64, key string) bool {
+		return flags.Flag{Enabled: true, Percentage: pct(p)}.Evaluate("new-alert-routing", flags.Target{Tenant: "t", Key: key})
+	}
+	const n = 10000
+	for _, p := range []float64{10, 50} {
+		count := 0
+		for i := 0; i < n; i++ {
+			key := fmt.Sprintf("printer-%d", i)
+			if on(p, key) {
+				count++
+				if !on(p+20, key) {
+					t.Fatalf("%s on at %v%% but off at %v%%", key, p, p+20)
+				}
+			}
+		}
+		if share := float64(count) / n * 100; share < p-2 || share > p+2 {
+			t.Errorf("%v%% rollout turned on %.1f%%", p, share)
+		}
+	}
+}
+
+// chanSource sends sets from a channel and fails its first watch.
+type chanSource struct {
+	sets    chan flags.Set
+	watches atomic.Int32
+}
+
+func (s *chanSource) Load(context.Context) (flags.Set, error) {
+	return flags.Set{"a": {Enabled: true}}, nil
+}
+
+func (s *chanSource) Watch(ctx context.Context, changed func(flags.Set)) error {
+	if s.watches.Add(1) == 1 {
+		return errors.New("listener reset")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case set := <-s.sets:
+			changed(set)
+		}
+	}
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	src := &chanSource{sets: make(chan flags.Set)}
+	changes := make(chan flags.Set, 1)
+	c, err := flags.New(ctx, src,
+		flags.WithEnvironment("prod"),
+		flags.WithRetryDelay(time.Millisecond),
+		flags.WithOnChange(func(s flags.Set) { changes <- s }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	if !c.Enabled(ctx, "a") || c.Enabled(ctx, "unknown") {
+		t.Errorf("initial flags = %v", c.Flags())
+	}
+	// sent once the watch is retried after its first failure
+	src.sets <- flags.Set{"b": {Enabled: true, Environments: []string{"prod"}}}
+	<-changes
+	if c.Enabled(ctx, "a") || !c.Enabled(ctx, "b") {
+		t.Errorf("flags after change = %v", c.Flags())
+	}
+	if c.Enabled(flags.WithTarget(ctx, flags.Target{Environment: "sandbox"}), "b") {
+		t.Error("target environment did not override the client's")
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type failingSource struct{ flags.Source }
+
+func (failingSource) Load(context.Context) (flags.Set, error) {
+	return nil, errors.New("permission denied")
+}
+
+func TestNewFailsOnLoad(t *testing.T) {
+	if _, err := flags.New(context.Background(), failingSource{}); err == nil {
+		t.Error("New succeeded with a failing source")
+	}
+}
+
+func TestStaticSource(t *testing.T) {
+	ctx := flags.WithTarget(context.Background(), flags.Target{Tenant: "acme"})
+	c, err := flags.New(ctx, flags.StaticSource(flags.Set{"beta": {Enabled: true, Tenants: []string{"acme"}}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if !c.Enabled(ctx, "beta") || c.Enabled(context.Background(), "beta") {
+		t.Error("beta should be on for acme only")
+	}
+	if got := flags.TargetFrom(ctx); got.Tenant != "acme" {
+		t.Errorf("TargetFrom = %+v", got)
+	}
+}
@@ -0,0 +1,147 @@
+package flags
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	gcs "cloud.google.com/go/storage"
+)
+
+// FirestoreSource reads flags from the document at path, such as
+// "config/flags", with one map field per flag, and watches it with a
+// snapshot listener.
+func FirestoreSource(client *firestore.Client, path string) Source {
+	return &firestoreSource{doc: client.Doc(path)}
+}
+
+type firestoreSource struct {
+	doc *firestore.DocumentRef
+}
+
+func (s *firestoreSource) Load(ctx context.Context) (Set, error) {
+	snap, err := s.doc.Get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDoc(snap)
+}
+
+func (s *firestoreSource) Watch(ctx context.Context, changed func(Set)) error {
+	it := s.doc.Snapshots(ctx)
+	defer it.Stop()
+	for {
+		snap, err := it.Next()
+		if err != nil {
+			return err
+		}
+		if !snap.Exists() {
+			continue // keep the last flags rather than turn everything off
+		}
+		set, err := decodeDoc(snap)
+		if err != nil {
+			return err
+		}
+		changed(set)
+	}
+}
+
+// decodeDoc goes through JSON so Flag needs only json tags and numbers
+// decode whether Firestore stored them as integers or doubles.
+func decodeDoc(snap *firestore.DocumentSnapshot) (Set, error) {
+	b, err := json.Marshal(snap.Data())
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", snap.Ref.Path, err)
+	}
+	return decode(b, snap.Ref.Path)
+}
+
+// GCSSource reads flags from a JSON object, an object of flags by name,
+// and polls it every interval, re-reading it when its generation changes.
+func GCSSource(client *gcs.Client, bucket, object string, interval time.Duration) Source {
+	return &gcsSource{obj: client.Bucket(bucket).Object(object), interval: interval}
+}
+
+type gcsSource struct {
+	obj      *gcs.ObjectHandle
+	interval time.Duration
+	gen      int64
+}
+
+func (s *gcsSource) Load(ctx context.Context) (Set, error) {
+	r, err := s.obj.NewReader(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	set, err := decode(b, s.obj.ObjectName())
+	if err != nil {
+		return nil, err
+	}
+	s.gen = r.Attrs.Generation
+	return set, nil
+}
+
+func (s *gcsSource) Watch(ctx context.Context, changed func(Set)) error {
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		attrs, err := s.obj.Attrs(ctx)
+		if err != nil {
+			return err
+		}
+		if attrs.Generation == s.gen {
+			continue
+		}
+		r, err := s.obj.Generation(attrs.Generation).NewReader(ctx)
+		if err != nil {
+			return err
+		}
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+		flags, err := decode(b, s.obj.ObjectName())
+		if err != nil {
+			return err
+		}
+		s.gen = attrs.Generation
+		changed(flags)
+	}
+}
+
+// StaticSource serves set and never changes, for tests and local runs.
+func StaticSource(set Set) Source { return staticSource(set) }
+
+type staticSource Set
+
+func (s staticSource) Load(context.Context) (Set, error) { return Set(s), nil }
+
+func (s staticSource) Watch(ctx context.Context, _ func(Set)) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func decode(b []byte, name string) (Set, error) {
+	var set Set
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode %s: %w", name, err)
+	}
+	return set, nil
+}
@@ -0,0 +1,83 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	gpubsub "cloud.google.com/go/pubsub"
+	"github.com/print-engine/ieos-golang-utils/httpx"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// checkClient makes the HTTP calls of checks: a probe should report the
+// dependency's state, not retry it.
+var checkClient = httpx.NewClient(httpx.WithRetry(retryx.Policy{MaxAttempts: 1}), httpx.WithTimeout(10*time.Second))
+
+// SlackAuthURL is the Slack Web API method SlackAuth calls.
+var SlackAuthURL = "https://slack.com/api/auth.test"
+
+// SlackAuth checks that Slack accepts the bot token.
+func SlackAuth(token string) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		if token == "" {
+			return errors.New("no Slack token configured")
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, SlackAuthURL, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		resp, err := checkClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("slack auth.test: HTTP %s", resp.Status)
+		}
+		var body struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			return fmt.Errorf("slack auth.test: %w", err)
+		}
+		if !body.OK {
+			return fmt.Errorf("slack auth.test: %s", body.Error)
+		}
+		return nil
+	})
+}
+
+// PubSubTopic checks that the topic exists and is visible to the service.
+func PubSubTopic(client *gpubsub.Client, topicID string) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		ok, err := client.Topic(topicID).Exists(ctx)
+		if err != nil {
+			return fmt.Errorf("pubsub topic %s: %w", topicID, err)
+		}
+		if !ok {
+			return fmt.Errorf("pubsub topic %s does not exist", topicID)
+		}
+		return nil
+	})
+}
+
+// FirestorePing checks Firestore answers by reading a document that need
+// not exist.
+func FirestorePing(client *firestore.Client) Checker {
+	return CheckFunc(func(ctx context.Context) error {
+		_, err := client.Collection("_health").Doc("ping").Get(ctx)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return fmt.Errorf("firestore: %w", err)
+		}
+		return nil
+	})
+}
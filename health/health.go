@@ -0,0 +1,226 @@
+// Package health serves uniform liveness and readiness endpoints: /healthz
+// answers as long as the process serves HTTP, /readyz runs pluggable
+// dependency checks, cached briefly so probes do not hammer dependencies,
+// and reports each one as JSON.
+//
+// Quick start:
+//
+//	h := health.New(health.WithLogger(lg), health.WithVersion(os.Getenv("K_REVISION")))
+//	h.Register("slack", health.SlackAuth(os.Getenv("SLACK_BOT_TOKEN")))
+//	h.Register("pubsub", health.PubSubTopic(psClient, "print-jobs"))
+//	h.Register("firestore", health.FirestorePing(fsClient), health.Optional())
+//	h.Mount(mux) // /healthz and /readyz
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Checker checks one dependency; a nil error means it is usable.
+type Checker interface {
+	Check(ctx context.Context) error
+}
+
+// CheckFunc adapts a function to Checker.
+type CheckFunc func(ctx context.Context) error
+
+func (f CheckFunc) Check(ctx context.Context) error { return f(ctx) }
+
+// Status is the outcome of a check or of the whole service.
+type Status string
+
+const (
+	StatusOK Status = "ok"
+	// StatusDegraded means only optional checks failed; the service stays
+	// ready.
+	StatusDegraded Status = "degraded"
+	StatusFailing  Status = "failing"
+)
+
+// Result is the outcome of one check, as reported by /readyz.
+type Result struct {
+	Status    Status    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Optional  bool      `json:"optional,omitempty"`
+	LatencyMs int64     `json:"latencyMs"`
+	CheckedAt time.Time `json:"checkedAt"`
+}
+
+// Report is the /readyz response body.
+type Report struct {
+	Status  Status            `json:"status"`
+	Version string            `json:"version,omitempty"`
+	Checks  map[string]Result `json:"checks,omitempty"`
+}
+
+type Options struct {
+	CacheTTL time.Duration
+	Timeout  time.Duration
+	Version  string
+	Logger   *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithCacheTTL sets how long a check's result is reused; defaults to 10s.
+func WithCacheTTL(d time.Duration) Option { return func(o *Options) { o.CacheTTL = d } }
+
+// WithTimeout bounds each check; defaults to 3s.
+func WithTimeout(d time.Duration) Option { return func(o *Options) { o.Timeout = d } }
+
+// WithVersion reports the deployed version, e.g. K_REVISION, in responses.
+func WithVersion(v string) Option { return func(o *Options) { o.Version = v } }
+
+// WithLogger logs checks that start or stop failing through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// Health holds the registered checks. It is safe for concurrent use.
+type Health struct {
+	opts Options
+
+	mu     sync.Mutex
+	checks map[string]*check
+}
+
+type check struct {
+	checker  Checker
+	optional bool
+
+	mu   sync.Mutex // held while checking, so concurrent probes check once
+	last Result
+}
+
+// New returns a Health without checks.
+func New(opts ...Option) *Health {
+	options := Options{CacheTTL: 10 * time.Second, Timeout: 3 * time.Second}
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Health{opts: options, checks: map[string]*check{}}
+}
+
+// CheckOption configures a registered check.
+type CheckOption func(*check)
+
+// Optional reports the check's failure as degraded instead of failing, for
+// dependencies the service can do without, so /readyz stays 200.
+func Optional() CheckOption { return func(c *check) { c.optional = true } }
+
+// Register adds or replaces the check name.
+func (h *Health) Register(name string, c Checker, opts ...CheckOption) {
+	ch := &check{checker: c}
+	for _, f := range opts {
+		f(ch)
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.checks[name] = ch
+}
+
+// Check runs the checks, or reuses results younger than the cache TTL, in
+// parallel and returns the report.
+func (h *Health) Check(ctx context.Context) Report {
+	h.mu.Lock()
+	checks := make(map[string]*check, len(h.checks))
+	for name, c := range h.checks {
+		checks[name] = c
+	}
+	h.mu.Unlock()
+
+	report := Report{Status: StatusOK, Version: h.opts.Version, Checks: make(map[string]Result, len(checks))}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, c := range checks {
+		wg.Add(1)
+		go func(name string, c *check) {
+			defer wg.Done()
+			r := h.run(ctx, name, c)
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = r
+		}(name, c)
+	}
+	wg.Wait()
+	for _, r := range report.Checks {
+		switch {
+		case r.Status == StatusFailing:
+			report.Status = StatusFailing
+		case r.Status == StatusDegraded && report.Status == StatusOK:
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+func (h *Health) run(ctx context.Context, name string, c *check) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.CheckedAt.IsZero() && time.Since(c.last.CheckedAt) < h.opts.CacheTTL {
+		return c.last
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := c.checker.Check(ctx)
+	r := Result{Status: StatusOK, Optional: c.optional, LatencyMs: time.Since(start).Milliseconds(), CheckedAt: start}
+	if err != nil {
+		r.Status, r.Error = StatusFailing, err.Error()
+		if c.optional {
+			r.Status = StatusDegraded
+		}
+	}
+	if lg := h.opts.Logger; lg != nil && r.Status != c.last.Status && !(c.last.Status == "" && r.Status == StatusOK) {
+		data := map[string]any{"check": name, "status": string(r.Status), "error": r.Error}
+		if r.Status == StatusOK {
+			lg.Info(ctx, nil, "health check recovered", data)
+		} else {
+			lg.Warning(ctx, nil, "health check failing", data)
+		}
+	}
+	c.last = r
+	return r
+}
+
+// Livez serves the liveness probe: 200 {"status":"ok"} while the process
+// can serve HTTP. It runs no checks, so a failing dependency does not get
+// the instance restarted.
+func (h *Health) Livez() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Report{Status: StatusOK, Version: h.opts.Version})
+	})
+}
+
+// Readyz serves the readiness probe: the report of Check, with 200 unless a
+// required check fails, then 503. "?verbose=0" omits the per-check results.
+func (h *Health) Readyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := h.Check(r.Context())
+		code := http.StatusOK
+		if report.Status == StatusFailing {
+			code = http.StatusServiceUnavailable
+		}
+		if r.URL.Query().Get("verbose") == "0" {
+			report.Checks = nil
+		}
+		writeJSON(w, code, report)
+	})
+}
+
+// Mount registers /healthz and /readyz on mux.
+func (h *Health) Mount(mux *http.ServeMux) {
+	mux.Handle("/healthz", h.Livez())
+	mux.Handle("/readyz", h.Readyz())
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,168 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/health"
+)
+
+var (
+	ok     = health.CheckFunc(func(context.Context) error { return nil })
+	broken = health.CheckFunc(func(context.Context) error { return errors.New("connection refused") })
+)
+
+func TestReadyz(t *testing.T) {
+	type reg struct {
+		name     string
+		check    health.Checker
+		optional bool
+	}
+	tests := []struct {
+		name       string
+		checks     []reg
+		query      string
+		wantCode   int
+		wantStatus health.Status
+		wantChecks map[string]health.Status
+	}{
+		{"no checks", nil, "", 200, health.StatusOK, nil},
+		{"all ok", []reg{{"slack", ok, false}, {"pubsub", ok, false}}, "", 200, health.StatusOK,
+			map[string]health.Status{"slack": health.StatusOK, "pubsub": health.StatusOK}},
+		{"optional failing", []reg{{"slack", ok, false}, {"firestore", broken, true}}, "", 200, health.StatusDegraded,
+			map[string]health.Status{"slack": health.StatusOK, "firestore": health.StatusDegraded}},
+		{"required failing", []reg{{"slack", broken, false}, {"firestore", broken, true}}, "", 503, health.StatusFailing,
+			map[string]health.Status{"slack": health.StatusFailing, "firestore": health.StatusDegraded}},
+		{"not verbose", []reg{{"slack", broken, false}}, "?verbose=0", 503, health.StatusFailing, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := health.New(health.WithVersion("svc-00042"))
+			for _, r := range tt.checks {
+				var opts []health.CheckOption
+				if r.optional {
+					opts = append(opts, health.Optional())
+				}
+				h.Register(r.name, r.check, opts...)
+			}
+			mux := http.NewServeMux()
+			h.Mount(mux)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz"+tt.query, nil))
+			if w.Code != tt.wantCode {
+				t.Errorf("code = %d, want %d", w.Code, tt.wantCode)
+			}
+			var report health.Report
+			if err := json.NewDecoder(w.Body).Decode(&report); err != nil {
+				t.Fatal(err)
+			}
+			if report.Status != tt.wantStatus || report.Version != "svc-00042" || len(report.Checks) != len(tt.wantChecks) {
+				t.Fatalf("report = %+v", report)
+			}
+			for name, want := range tt.wantChecks {
+				if got := report.Checks[name]; got.Status != want || (want != health.StatusOK) != (got.Error != "") {
+					t.Errorf("check %s = %+v, want %s", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLivezRunsNoChecks(t *testing.T) {
+	h := health.New()
+	h.Register("slack", health.CheckFunc(func(context.Context) error {
+		t.Error("liveness ran a check")
+		return nil
+	}))
+	w := httptest.NewRecorder()
+	h.Livez().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if w.Code != 200 || w.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("code %d, headers %v", w.Code, w.Header())
+	}
+}
+
+func TestCheckCaching(t *testing.T) {
+	var calls atomic.Int32
+	release := make(chan struct{})
+	slow := health.CheckFunc(func(context.Context) error {
+		calls.Add(1)
+		<-release
+		return nil
+	})
+	h := health.New(health.WithCacheTTL(50 * time.Millisecond))
+	h.Register("slack", slow)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.Check(context.Background())
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("concurrent probes checked %d times, want 1", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	h.Check(context.Background())
+	if n := calls.Load(); n != 2 {
+		t.Errorf("checked %d times after the TTL, want 2", n)
+	}
+}
+
+func TestCheckTimeout(t *testing.T) {
+	h := health.New(health.WithTimeout(10 * time.Millisecond))
+	h.Register("pubsub", health.CheckFunc(func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}))
+	if r := h.Check(context.Background()); r.Status != health.StatusFailing {
+		t.Errorf("status = %s, want failing on timeout", r.Status)
+	}
+}
+
+func TestSlackAuth(t *testing.T) {
+	tests := []struct {
+		name    string
+		token   string
+		status  int
+		body    string
+		wantErr bool
+	}{
+		{"ok", "xoxb-1", 200, `{"ok":true}`, false},
+		{"no token", "", 200, `{"ok":true}`, true},
+		{"rejected token", "xoxb-1", 200, `{"ok":false,"error":"invalid_auth"}`, true},
+		{"http error", "xoxb-1", 500, ``, true},
+		{"bad body", "xoxb-1", 200, `<html>`, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get("Authorization"); got != "Bearer "+tt.token {
+					t.Errorf("Authorization = %q", got)
+				}
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+			old := health.SlackAuthURL
+			health.SlackAuthURL = srv.URL
+			defer func() { health.SlackAuthURL = old }()
+
+			err := health.SlackAuth(tt.token).Check(context.Background())
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Check = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+// Package httpx builds *http.Client values with the defaults our services
+// otherwise forget: timeouts, pooled connections, retries of idempotent
+// requests, logging hooks and trace header propagation.
+//
+// Quick start:
+//
+//	client := httpx.NewClient(
+//	    httpx.WithLogger(lg), // a *logger.CloudLogger
+//	    httpx.WithHostPool("api.vendor.example", httpx.HostPool{MaxIdleConns: 32, MaxConns: 64}),
+//	)
+//
+//	func handle(w http.ResponseWriter, r *http.Request) {
+//	    ctx := httpx.ContextWithTrace(r.Context(), r) // forward the caller's trace
+//	    req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+//	    resp, err := client.Do(req)
+//	    ...
+//	}
+package httpx
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+// HostPool tunes the connection pool to one host.
+type HostPool struct {
+	// MaxIdleConns is how many idle connections are kept for reuse.
+	MaxIdleConns int
+	// MaxConns caps connections, dialing, active and idle; zero means no
+	// limit.
+	MaxConns int
+}
+
+type Options struct {
+	Timeout               time.Duration
+	DialTimeout           time.Duration
+	TLSHandshakeTimeout   time.Duration
+	ResponseHeaderTimeout time.Duration
+	IdleConnTimeout       time.Duration
+	Pool                  HostPool
+	HostPools             map[string]HostPool
+	Retry                 retryx.Policy
+	RequestHooks          []func(*http.Request)
+	ResponseHooks         []ResponseHook
+	Logger                *logger.CloudLogger
+	Transport             http.RoundTripper
+}
+
+type Option func(*Options)
+
+// WithTimeout bounds a whole request, retries and reading the body
+// included; defaults to 30s. Zero disables it.
+func WithTimeout(d time.Duration) Option { return func(o *Options) { o.Timeout = d } }
+
+// WithDialTimeouts sets the TCP connect and TLS handshake timeouts; both
+// default to 5s.
+func WithDialTimeouts(dial, tlsHandshake time.Duration) Option {
+	return func(o *Options) { o.DialTimeout, o.TLSHandshakeTimeout = dial, tlsHandshake }
+}
+
+// WithResponseHeaderTimeout bounds the wait for response headers of each
+// attempt, so a hung server is retried before the overall timeout; defaults
+// to 10s.
+func WithResponseHeaderTimeout(d time.Duration) Option {
+	return func(o *Options) { o.ResponseHeaderTimeout = d }
+}
+
+// WithPool sets the connection pool of every host without a HostPool of its
+// own; defaults to 16 idle connections and no connection limit.
+func WithPool(p HostPool) Option { return func(o *Options) { o.Pool = p } }
+
+// WithHostPool sets the connection pool of host ("example.com" or
+// "example.com:8443"), e.g. to allow more connections to a busy vendor API
+// or cap those to a fragile one.
+func WithHostPool(host string, p HostPool) Option {
+	return func(o *Options) {
+		if o.HostPools == nil {
+			o.HostPools = map[string]HostPool{}
+		}
+		o.HostPools[host] = p
+	}
+}
+
+// WithRetry sets the retry policy of idempotent requests. Its Retryable
+// defaults to network errors and transient HTTP statuses; set MaxAttempts
+// to 1 to disable retries. Defaults to 3 attempts.
+func WithRetry(p retryx.Policy) Option { return func(o *Options) { o.Retry = p } }
+
+// WithRequestHook calls f before each attempt with the outgoing request,
+// which f must not modify.
+func WithRequestHook(f func(*http.Request)) Option {
+	return func(o *Options) { o.RequestHooks = append(o.RequestHooks, f) }
+}
+
+// ResponseHook is called after each attempt with its response or error and
+// latency.
+type ResponseHook func(req *http.Request, resp *http.Response, err error, latency time.Duration)
+
+// WithResponseHook calls f after each attempt, e.g. to record metrics.
+func WithResponseHook(f ResponseHook) Option {
+	return func(o *Options) { o.ResponseHooks = append(o.ResponseHooks, f) }
+}
+
+// WithLogger logs each attempt through lg: failures and server errors at
+// warning, the rest at debug level.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithTransport sends requests through rt instead of the pooled transports
+// built from the other options, e.g. in tests.
+func WithTransport(rt http.RoundTripper) Option { return func(o *Options) { o.Transport = rt } }
+
+// NewClient returns an *http.Client configured by opts, to use instead of
+// http.DefaultClient.
+func NewClient(opts ...Option) *http.Client {
+	options := Options{
+		Timeout:               30 * time.Second,
+		DialTimeout:           5 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		Pool:                  HostPool{MaxIdleConns: 16},
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.Retry.Retryable == nil {
+		options.Retry.Retryable = retryx.AnyOf(retryx.NetworkErrors, retryx.TransientHTTP)
+	}
+
+	base := options.Transport
+	if base == nil {
+		base = newHostTransport(options)
+	}
+	var rt http.RoundTripper = &hookTransport{next: base, opts: options}
+	rt = &retryTransport{next: rt, policy: options.Retry}
+	rt = &traceTransport{next: rt}
+	return &http.Client{Transport: rt, Timeout: options.Timeout}
+}
+
+// hostTransport routes requests to a transport per tuned host, since an
+// http.Transport applies one pool size to every host.
+type hostTransport struct {
+	fallback *http.Transport
+	hosts    map[string]*http.Transport
+}
+
+func newHostTransport(o Options) *hostTransport {
+	t := &hostTransport{fallback: newTransport(o, o.Pool), hosts: map[string]*http.Transport{}}
+	for host, p := range o.HostPools {
+		t.hosts[host] = newTransport(o, p)
+	}
+	return t
+}
+
+func newTransport(o Options, p HostPool) *http.Transport {
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: o.DialTimeout, KeepAlive: 30 * time.Second}).DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   o.TLSHandshakeTimeout,
+		ResponseHeaderTimeout: o.ResponseHeaderTimeout,
+		IdleConnTimeout:       o.IdleConnTimeout,
+		ExpectContinueTimeout: time.Second,
+		MaxIdleConns:          0, // bounded per host
+		MaxIdleConnsPerHost:   p.MaxIdleConns,
+		MaxConnsPerHost:       p.MaxConns,
+	}
+}
+
+func (t *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if tr, ok := t.hosts[req.URL.Host]; ok {
+		return tr.RoundTrip(req)
+	}
+	if tr, ok := t.hosts[req.URL.Hostname()]; ok {
+		return tr.RoundTrip(req)
+	}
+	return t.fallback.RoundTrip(req)
+}
@@ -0,0 +1,183 @@
+package httpx_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/httpx"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+var fast = retryx.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		method       string
+		body         string
+		header       http.Header
+		statuses     []int // answered by successive attempts, then 200
+		wantAttempts int32
+		wantStatus   int
+	}{
+		{"success", http.MethodGet, "", nil, nil, 1, 200},
+		{"transient status retried", http.MethodGet, "", nil, []int{503, 502}, 3, 200},
+		{"out of attempts returns the response", http.MethodGet, "", nil, []int{503, 503, 503}, 3, 503},
+		{"client error not retried", http.MethodGet, "", nil, []int{404}, 1, 404},
+		{"post not retried", http.MethodPost, "job", nil, []int{503}, 1, 503},
+		{"post with idempotency key retried", http.MethodPost, "job", http.Header{httpx.IdempotencyKeyHeader: {"k1"}}, []int{503}, 2, 200},
+		{"put body replayed", http.MethodPut, "job", nil, []int{429}, 2, 200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				n := int(attempts.Add(1))
+				if b, _ := io.ReadAll(r.Body); string(b) != tt.body {
+					t.Errorf("attempt %d body = %q, want %q", n, b, tt.body)
+				}
+				if n <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[n-1])
+				}
+			}))
+			defer srv.Close()
+
+			req, _ := http.NewRequest(tt.method, srv.URL, strings.NewReader(tt.body))
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			resp, err := httpx.NewClient(httpx.WithRetry(fast)).Do(req)
+			if err != nil {
+				t.Fatalf("Do: %v", err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus || attempts.Load() != tt.wantAttempts {
+				t.Errorf("status %d after %d attempts, want %d after %d", resp.StatusCode, attempts.Load(), tt.wantStatus, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	var attempts atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}
+	}))
+	defer srv.Close()
+
+	var delays []time.Duration
+	policy := retryx.Policy{MaxAttempts: 2, InitialDelay: time.Hour, OnRetry: func(_ int, _ error, d time.Duration) {
+		delays = append(delays, d)
+	}}
+	resp, err := httpx.NewClient(httpx.WithRetry(policy)).Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 || len(delays) != 1 || delays[0] != 0 {
+		t.Errorf("status %d with delays %v, want 200 after a Retry-After of 0", resp.StatusCode, delays)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var requests, responses int
+	client := httpx.NewClient(
+		httpx.WithRetry(fast),
+		httpx.WithRequestHook(func(*http.Request) { mu.Lock(); requests++; mu.Unlock() }),
+		httpx.WithResponseHook(func(_ *http.Request, resp *http.Response, err error, _ time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			if err == nil && resp.StatusCode == 503 {
+				responses++
+			}
+		}),
+	)
+	resp, err := client.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if requests != 3 || responses != 3 {
+		t.Errorf("hooks ran %d/%d times, want once per attempt", requests, responses)
+	}
+}
+
+func TestTracePropagation(t *testing.T) {
+	const trace = "105445aa7843bc8bf206b12000100000/1;o=1"
+	tests := []struct {
+		name  string
+		set   string // set on the outgoing request
+		want  string
+		noCtx bool
+	}{
+		{"forwarded", "", trace, false},
+		{"explicit header kept", "other/2", "other/2", false},
+		{"no incoming trace", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.Header.Get("X-Cloud-Trace-Context")
+			}))
+			defer srv.Close()
+
+			in := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+			if !tt.noCtx {
+				in.Header.Set("X-Cloud-Trace-Context", trace)
+			}
+			ctx := httpx.ContextWithTrace(context.Background(), in)
+			req, _ := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+			if tt.set != "" {
+				req.Header.Set("X-Cloud-Trace-Context", tt.set)
+			}
+			resp, err := httpx.NewClient().Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if got != tt.want {
+				t.Errorf("trace header = %q, want %q", got, tt.want)
+			}
+			if tt.set == "" && req.Header.Get("X-Cloud-Trace-Context") != "" {
+				t.Error("the caller's request was modified")
+			}
+		})
+	}
+}
+
+// roundTripFunc is an http.RoundTripper for WithTransport.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestTimeout(t *testing.T) {
+	client := httpx.NewClient(httpx.WithTimeout(20*time.Millisecond), httpx.WithRetry(retryx.Policy{MaxAttempts: 1}),
+		httpx.WithTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		})))
+	start := time.Now()
+	if _, err := client.Get("http://vendor.example/jobs"); err == nil {
+		t.Fatal("Get succeeded, want a timeout")
+	}
+	if took := time.Since(start); took > time.Second {
+		t.Errorf("Get took %s despite the 20ms timeout", took)
+	}
+}
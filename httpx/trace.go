@@ -0,0 +1,55 @@
+package httpx
+
+import (
+	"context"
+	"net/http"
+)
+
+// traceHeaders are the trace context headers forwarded to outgoing requests:
+// Google's own and the W3C Trace Context ones.
+var traceHeaders = []string{"X-Cloud-Trace-Context", "Traceparent", "Tracestate"}
+
+type traceKey struct{}
+
+// ContextWithTrace returns ctx carrying the trace headers of the incoming
+// request r, which the client then sets on outgoing requests made with the
+// context, so downstream logs correlate with the caller's trace.
+func ContextWithTrace(ctx context.Context, r *http.Request) context.Context {
+	if r == nil {
+		return ctx
+	}
+	h := http.Header{}
+	for _, k := range traceHeaders {
+		if v := r.Header.Get(k); v != "" {
+			h.Set(k, v)
+		}
+	}
+	if len(h) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, traceKey{}, h)
+}
+
+// traceTransport sets the context's trace headers on requests without them.
+type traceTransport struct {
+	next http.RoundTripper
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	h, _ := req.Context().Value(traceKey{}).(http.Header)
+	var missing []string
+	for k := range h {
+		if req.Header.Get(k) == "" {
+			missing = append(missing, k)
+		}
+	}
+	if len(missing) == 0 {
+		return t.next.RoundTrip(req)
+	}
+	// a RoundTripper must not modify the caller's request
+	req = req.Clone(req.Context())
+	for _, k := range missing {
+		req.Header.Set(k, h.Get(k))
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,133 @@
+package httpx
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+// IdempotencyKeyHeader makes a POST or PATCH request retryable: the server
+// is expected to apply a repeated request with the same key only once.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// retryTransport retries idempotent requests whose body can be replayed.
+type retryTransport struct {
+	next   http.RoundTripper
+	policy retryx.Policy
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !idempotent(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+	var last *http.Response
+	tries := 0
+	resp, err := retryx.DoValue(req.Context(), t.policy, func(ctx context.Context) (*http.Response, error) {
+		if last != nil {
+			// discard the response being retried so its connection is reused
+			_, _ = io.Copy(io.Discard, io.LimitReader(last.Body, 64<<10))
+			last.Body.Close()
+			last = nil
+		}
+		tries++
+		attempt := req
+		if tries > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, retryx.Permanent(err)
+			}
+			attempt = req.Clone(ctx)
+			attempt.Body = body
+		}
+		resp, err := t.next.RoundTrip(attempt)
+		if err != nil {
+			return nil, err
+		}
+		last = resp
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+		se := &retryx.StatusError{StatusCode: resp.StatusCode, Status: resp.Status}
+		if d, ok := retryAfter(resp); ok && t.policy.Retryable(se) {
+			return resp, retryx.After(se, d)
+		}
+		return resp, se
+	})
+	var se *retryx.StatusError
+	if errors.As(err, &se) && resp != nil {
+		// an error status is a response, not a transport failure
+		return resp, nil
+	}
+	return resp, err
+}
+
+// idempotent reports whether req may be sent again without side effects
+// beyond the first.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get(IdempotencyKeyHeader) != ""
+}
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if s, err := strconv.Atoi(v); err == nil && s >= 0 {
+		return time.Duration(s) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(time.Until(t), 0), true
+	}
+	return 0, false
+}
+
+// hookTransport runs the request and response hooks and logging around
+// every attempt.
+type hookTransport struct {
+	next http.RoundTripper
+	opts Options
+}
+
+func (t *hookTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	for _, h := range t.opts.RequestHooks {
+		h(req)
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	latency := time.Since(start)
+	for _, h := range t.opts.ResponseHooks {
+		h(req, resp, err, latency)
+	}
+	if lg := t.opts.Logger; lg != nil {
+		data := map[string]any{"method": req.Method, "url": redactedURL(req), "latencyMs": latency.Milliseconds()}
+		switch {
+		case err != nil:
+			data["error"] = err.Error()
+			lg.Warning(req.Context(), nil, "http request failed", data)
+		case resp.StatusCode >= 500:
+			data["status"] = resp.StatusCode
+			lg.Warning(req.Context(), nil, "http request failed", data)
+		default:
+			data["status"] = resp.StatusCode
+			lg.Debug(req.Context(), nil, "http request", data)
+		}
+	}
+	return resp, err
+}
+
+// redactedURL drops the query, which often carries tokens and signatures.
+func redactedURL(req *http.Request) string {
+	u := *req.URL
+	u.RawQuery, u.User = "", nil
+	return u.String()
+}
@@ -0,0 +1,186 @@
+// Package idempotency runs an operation at most once per key, such as a
+// payment capture per order or a print job per submission, and replays
+// the recorded result to retries. Keys and results live in a pluggable
+// Store (memory, Redis or Firestore) for a TTL.
+//
+// Quick start:
+//
+//	k := idempotency.New(idempotency.FirestoreStore(fs, "idempotency"), idempotency.WithLogger(lg))
+//
+//	capture, err := idempotency.DoValue(ctx, k, "capture:"+orderID, func(ctx context.Context) (Capture, error) {
+//	    return psp.Capture(ctx, orderID, amount) // runs once; retries get the same Capture
+//	})
+//	if errors.Is(err, idempotency.ErrInProgress) {
+//	    // another request is capturing right now; answer 409 or retry later
+//	}
+//
+//	sub.Receive(ctx, pubsub.Chain(handle, k.PubSub())) // at most one successful run per message
+package idempotency
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/pubsub"
+)
+
+var (
+	// ErrInProgress is returned while another caller runs the operation for
+	// the same key.
+	ErrInProgress = errors.New("idempotency: operation in progress")
+	// ErrNotOwner is returned by a Store when the caller's lock expired and
+	// the key was claimed again or completed by someone else.
+	ErrNotOwner = errors.New("idempotency: lock lost")
+)
+
+// Store records operation keys. Tokens tell apart the callers claiming a
+// key, so a caller whose lock expired cannot complete another's claim.
+type Store interface {
+	// Claim locks key for token until lock elapses. It returns done and the
+	// recorded result if key completed before, and ErrInProgress while
+	// another token holds the lock.
+	Claim(ctx context.Context, key, token string, lock time.Duration) (result []byte, done bool, err error)
+	// Complete records result for key, kept for ttl, if token still holds
+	// the lock; otherwise it returns ErrNotOwner.
+	Complete(ctx context.Context, key, token string, result []byte, ttl time.Duration) error
+	// Release drops token's lock on key so the operation can be retried.
+	Release(ctx context.Context, key, token string) error
+}
+
+type Options struct {
+	TTL         time.Duration
+	LockTimeout time.Duration
+	Logger      *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithTTL sets how long results are replayed; defaults to 24h. Retries
+// after that run the operation again.
+func WithTTL(d time.Duration) Option { return func(o *Options) { o.TTL = d } }
+
+// WithLockTimeout bounds how long a claim blocks other callers if its
+// owner dies mid-operation; defaults to 5m. It must exceed the longest
+// run of the operation.
+func WithLockTimeout(d time.Duration) Option { return func(o *Options) { o.LockTimeout = d } }
+
+// WithLogger logs replays at debug level and failures to record results
+// at error level.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// Keeper runs operations once per key. It is safe for concurrent use.
+type Keeper struct {
+	store Store
+	opts  Options
+}
+
+// New returns a Keeper recording keys in store.
+func New(store Store, opts ...Option) *Keeper {
+	options := Options{
+		TTL:         24 * time.Hour,
+		LockTimeout: 5 * time.Minute,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Keeper{store: store, opts: options}
+}
+
+// Do runs fn unless key completed before, in which case it returns the
+// recorded result without running fn. While another caller runs key it
+// returns ErrInProgress. If fn fails nothing is recorded, so a retry runs
+// it again.
+//
+// If recording the result fails after fn succeeded, Do logs the failure
+// and still returns the result: the operation happened, and an error
+// would invite a retry that runs it twice.
+func (k *Keeper) Do(ctx context.Context, key string, fn func(ctx context.Context) ([]byte, error)) ([]byte, error) {
+	token := newToken()
+	result, done, err := k.store.Claim(ctx, key, token, k.opts.LockTimeout)
+	if err != nil {
+		if errors.Is(err, ErrInProgress) {
+			return nil, fmt.Errorf("%w: %s", ErrInProgress, key)
+		}
+		return nil, fmt.Errorf("idempotency: claim %s: %w", key, err)
+	}
+	if done {
+		if lg := k.opts.Logger; lg != nil {
+			lg.Debug(ctx, nil, "idempotent replay", map[string]any{"key": key})
+		}
+		return result, nil
+	}
+
+	result, err = fn(ctx)
+	// record even if the caller gave up meanwhile
+	rctx := context.WithoutCancel(ctx)
+	if err != nil {
+		if rerr := k.store.Release(rctx, key, token); rerr != nil {
+			k.logFailure(rctx, "idempotency release failed", key, rerr)
+		}
+		return nil, err
+	}
+	if cerr := k.store.Complete(rctx, key, token, result, k.opts.TTL); cerr != nil {
+		k.logFailure(rctx, "idempotency result not recorded", key, cerr)
+	}
+	return result, nil
+}
+
+// DoValue is Do for results of any JSON-encodable type.
+func DoValue[T any](ctx context.Context, k *Keeper, key string, fn func(ctx context.Context) (T, error)) (T, error) {
+	var (
+		v   T
+		ran bool
+	)
+	b, err := k.Do(ctx, key, func(ctx context.Context) ([]byte, error) {
+		out, err := fn(ctx)
+		if err != nil {
+			return nil, err
+		}
+		v, ran = out, true
+		return json.Marshal(out)
+	})
+	if err != nil || ran {
+		return v, err
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return v, fmt.Errorf("idempotency: decode result of %s: %w", key, err)
+	}
+	return v, nil
+}
+
+// PubSub returns a subscriber middleware that acks redeliveries of
+// messages already handled, keyed by the message's "idempotency_key"
+// attribute or else its ID. A message handled elsewhere at the same time
+// is nacked, to be redelivered once that run ends.
+func (k *Keeper) PubSub() pubsub.Middleware {
+	return func(next pubsub.HandlerFunc) pubsub.HandlerFunc {
+		return func(ctx context.Context, m *pubsub.Message) error {
+			key := m.Attributes["idempotency_key"]
+			if key == "" {
+				key = "pubsub:" + m.ID
+			}
+			_, err := k.Do(ctx, key, func(ctx context.Context) ([]byte, error) {
+				return nil, next(ctx, m)
+			})
+			return err
+		}
+	}
+}
+
+func (k *Keeper) logFailure(ctx context.Context, msg, key string, err error) {
+	if lg := k.opts.Logger; lg != nil {
+		lg.Error(ctx, nil, msg, map[string]any{"key": key, "error": err.Error()})
+	}
+}
+
+func newToken() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
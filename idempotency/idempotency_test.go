@@ -0,0 +1,223 @@
+package idempotency
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/pubsub"
+)
+
+var t0 = time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+func TestClaim(t *testing.T) {
+	tests := []struct {
+		name       string
+		cur        *record
+		token      string
+		wantStore  bool
+		wantResult []byte
+		wantDone   bool
+		wantErr    error
+	}{
+		{name: "new key", cur: nil, token: "a", wantStore: true},
+		{name: "locked by another token", cur: &record{Token: "b", ExpireAt: t0.Add(time.Minute)}, token: "a", wantErr: ErrInProgress},
+		{name: "locked by the same token", cur: &record{Token: "a", ExpireAt: t0.Add(time.Minute)}, token: "a", wantStore: true},
+		{name: "lock expired", cur: &record{Token: "b", ExpireAt: t0}, token: "a", wantStore: true},
+		{name: "completed", cur: &record{Token: "b", Done: true, Result: []byte("ok"), ExpireAt: t0.Add(time.Minute)}, token: "a", wantResult: []byte("ok"), wantDone: true},
+		{name: "completed result expired", cur: &record{Token: "b", Done: true, Result: []byte("ok"), ExpireAt: t0.Add(-time.Second)}, token: "a", wantStore: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next, result, done, err := claim(tt.cur, tt.token, time.Minute, t0)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if done != tt.wantDone || !bytes.Equal(result, tt.wantResult) {
+				t.Errorf("result, done = %q, %v; want %q, %v", result, done, tt.wantResult, tt.wantDone)
+			}
+			if (next != nil) != tt.wantStore {
+				t.Fatalf("next = %+v, want stored %v", next, tt.wantStore)
+			}
+			if next != nil && (next.Token != tt.token || next.Done || !next.ExpireAt.Equal(t0.Add(time.Minute))) {
+				t.Errorf("next = %+v, want a lock for %s until %s", next, tt.token, t0.Add(time.Minute))
+			}
+		})
+	}
+}
+
+func TestOwned(t *testing.T) {
+	tests := []struct {
+		name string
+		r    *record
+		want bool
+	}{
+		{"missing", nil, false},
+		{"locked", &record{Token: "a", ExpireAt: t0.Add(time.Minute)}, true},
+		{"locked by another token", &record{Token: "b", ExpireAt: t0.Add(time.Minute)}, false},
+		{"lock expired", &record{Token: "a", ExpireAt: t0}, false},
+		{"completed", &record{Token: "a", Done: true, ExpireAt: t0.Add(time.Minute)}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := owned(tt.r, "a", t0); got != tt.want {
+				t.Errorf("owned = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	t.Run("replays the result", func(t *testing.T) {
+		k := New(NewMemoryStore())
+		runs := 0
+		fn := func(context.Context) ([]byte, error) {
+			runs++
+			return []byte("receipt"), nil
+		}
+		for i := 0; i < 3; i++ {
+			got, err := k.Do(ctx, "order-1", fn)
+			if err != nil || string(got) != "receipt" {
+				t.Fatalf("Do #%d = %q, %v", i+1, got, err)
+			}
+		}
+		if runs != 1 {
+			t.Errorf("fn ran %d times, want 1", runs)
+		}
+	})
+	t.Run("retries after a failure", func(t *testing.T) {
+		k := New(NewMemoryStore())
+		if _, err := k.Do(ctx, "order-1", func(context.Context) ([]byte, error) { return nil, boom }); !errors.Is(err, boom) {
+			t.Fatalf("err = %v, want fn's error", err)
+		}
+		got, err := k.Do(ctx, "order-1", func(context.Context) ([]byte, error) { return []byte("ok"), nil })
+		if err != nil || string(got) != "ok" {
+			t.Errorf("retry = %q, %v; want ok", got, err)
+		}
+	})
+	t.Run("in progress", func(t *testing.T) {
+		k := New(NewMemoryStore())
+		started, release := make(chan struct{}), make(chan struct{})
+		go func() {
+			_, _ = k.Do(ctx, "order-1", func(context.Context) ([]byte, error) {
+				close(started)
+				<-release
+				return nil, nil
+			})
+		}()
+		<-started
+		defer close(release)
+		if _, err := k.Do(ctx, "order-1", func(context.Context) ([]byte, error) { return nil, nil }); !errors.Is(err, ErrInProgress) {
+			t.Errorf("err = %v, want ErrInProgress", err)
+		}
+		if _, err := k.Do(ctx, "order-2", func(context.Context) ([]byte, error) { return nil, nil }); err != nil {
+			t.Errorf("other key: %v", err)
+		}
+	})
+	t.Run("lock expired mid-run", func(t *testing.T) {
+		store := NewMemoryStore()
+		k := New(store, WithLockTimeout(10*time.Millisecond))
+		got, err := k.Do(ctx, "order-1", func(context.Context) ([]byte, error) {
+			time.Sleep(20 * time.Millisecond)
+			// another caller takes the expired lock
+			if _, _, err := store.Claim(ctx, "order-1", "other", time.Minute); err != nil {
+				t.Errorf("Claim: %v", err)
+			}
+			return []byte("first"), nil
+		})
+		// the result is returned even though it could not be recorded
+		if err != nil || string(got) != "first" {
+			t.Errorf("Do = %q, %v; want first", got, err)
+		}
+		if err := store.Complete(ctx, "order-1", "other", []byte("second"), time.Minute); err != nil {
+			t.Errorf("Complete by the new owner: %v", err)
+		}
+	})
+	t.Run("concurrent callers", func(t *testing.T) {
+		k := New(NewMemoryStore())
+		var runs atomic.Int32
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := k.Do(ctx, "order-1", func(context.Context) ([]byte, error) {
+					runs.Add(1)
+					return nil, nil
+				})
+				if err != nil && !errors.Is(err, ErrInProgress) {
+					t.Errorf("Do: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+		if n := runs.Load(); n != 1 {
+			t.Errorf("fn ran %d times, want 1", n)
+		}
+	})
+}
+
+func TestDoValue(t *testing.T) {
+	type capture struct {
+		ID     string
+		Amount int
+	}
+	ctx := context.Background()
+	k := New(NewMemoryStore())
+	want := capture{ID: "cap_1", Amount: 1299}
+	for i := 0; i < 2; i++ {
+		got, err := DoValue(ctx, k, "capture:A-1", func(context.Context) (capture, error) {
+			if i > 0 {
+				t.Error("fn ran on the replay")
+			}
+			return want, nil
+		})
+		if err != nil || got != want {
+			t.Errorf("DoValue #%d = %+v, %v; want %+v", i+1, got, err, want)
+		}
+	}
+}
+
+func TestPubSub(t *testing.T) {
+	ctx := context.Background()
+	k := New(NewMemoryStore())
+	handled := map[string]int{}
+	h := pubsub.Chain(func(_ context.Context, m *pubsub.Message) error {
+		handled[string(m.Data)]++
+		if string(m.Data) == "fail" && handled["fail"] == 1 {
+			return errors.New("transient")
+		}
+		return nil
+	}, k.PubSub())
+
+	tests := []struct {
+		name    string
+		msg     *pubsub.Message
+		wantErr bool
+	}{
+		{"first delivery", &pubsub.Message{ID: "1", Data: []byte("a")}, false},
+		{"redelivery", &pubsub.Message{ID: "1", Data: []byte("a")}, false},
+		{"same key, new ID", &pubsub.Message{ID: "2", Data: []byte("b"), Attributes: map[string]string{"idempotency_key": "k"}}, false},
+		{"republished with the key", &pubsub.Message{ID: "3", Data: []byte("b"), Attributes: map[string]string{"idempotency_key": "k"}}, false},
+		{"failed delivery", &pubsub.Message{ID: "4", Data: []byte("fail")}, true},
+		{"redelivery after the failure", &pubsub.Message{ID: "4", Data: []byte("fail")}, false},
+	}
+	for _, tt := range tests {
+		if err := h(ctx, tt.msg); (err != nil) != tt.wantErr {
+			t.Errorf("%s: err = %v, want error %v", tt.name, err, tt.wantErr)
+		}
+	}
+	want := map[string]int{"a": 1, "b": 1, "fail": 2}
+	for data, n := range want {
+		if handled[data] != n {
+			t.Errorf("%q handled %d times, want %d", data, handled[data], n)
+		}
+	}
+}
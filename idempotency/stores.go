@@ -0,0 +1,235 @@
+package idempotency
+
+import (
+	"context"
+	"net/url"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// record is the state of one key.
+type record struct {
+	Token    string    `firestore:"token"`
+	Done     bool      `firestore:"done"`
+	Result   []byte    `firestore:"result,omitempty"`
+	ExpireAt time.Time `firestore:"expireAt"`
+}
+
+// claim applies Claim to r, which is nil for a missing key, and returns
+// the record to store, or nil if r stays as it is.
+func claim(r *record, token string, lock time.Duration, now time.Time) (next *record, result []byte, done bool, err error) {
+	if r != nil && now.Before(r.ExpireAt) {
+		if r.Done {
+			return nil, r.Result, true, nil
+		}
+		if r.Token != token {
+			return nil, nil, false, ErrInProgress
+		}
+	}
+	return &record{Token: token, ExpireAt: now.Add(lock)}, nil, false, nil
+}
+
+// owned reports whether token holds an unexpired lock on r.
+func owned(r *record, token string, now time.Time) bool {
+	return r != nil && !r.Done && r.Token == token && now.Before(r.ExpireAt)
+}
+
+// MemoryStore keeps keys in process; for tests and single-instance jobs.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]*record
+	claims  int
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: map[string]*record{}}
+}
+
+func (s *MemoryStore) Claim(_ context.Context, key, token string, lock time.Duration) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.claims++; s.claims%1024 == 0 {
+		for k, r := range s.records {
+			if !now.Before(r.ExpireAt) {
+				delete(s.records, k)
+			}
+		}
+	}
+	next, result, done, err := claim(s.records[key], token, lock, now)
+	if next != nil {
+		s.records[key] = next
+	}
+	return result, done, err
+}
+
+func (s *MemoryStore) Complete(_ context.Context, key, token string, result []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if !owned(s.records[key], token, now) {
+		return ErrNotOwner
+	}
+	s.records[key] = &record{Token: token, Done: true, Result: result, ExpireAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *MemoryStore) Release(_ context.Context, key, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if owned(s.records[key], token, time.Now()) {
+		delete(s.records, key)
+	}
+	return nil
+}
+
+// RedisStore keeps keys in Redis hashes under prefix+key, expiring with
+// the lock or TTL.
+func RedisStore(client redis.Scripter, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+type redisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+var (
+	claimScript = redis.NewScript(`
+local r = redis.call('HMGET', KEYS[1], 'token', 'done', 'result')
+if r[1] then
+  if r[2] == '1' then return {1, r[3] or ''} end
+  if r[1] ~= ARGV[1] then return {0, ''} end
+end
+redis.call('DEL', KEYS[1])
+redis.call('HSET', KEYS[1], 'token', ARGV[1], 'done', '0')
+redis.call('PEXPIRE', KEYS[1], ARGV[2])
+return {2, ''}
+`)
+	completeScript = redis.NewScript(`
+local r = redis.call('HMGET', KEYS[1], 'token', 'done')
+if r[1] ~= ARGV[1] or r[2] ~= '0' then return 0 end
+redis.call('HSET', KEYS[1], 'done', '1', 'result', ARGV[2])
+redis.call('PEXPIRE', KEYS[1], ARGV[3])
+return 1
+`)
+	releaseScript = redis.NewScript(`
+local r = redis.call('HMGET', KEYS[1], 'token', 'done')
+if r[1] == ARGV[1] and r[2] == '0' then redis.call('DEL', KEYS[1]) end
+return 1
+`)
+)
+
+func (s *redisStore) Claim(ctx context.Context, key, token string, lock time.Duration) ([]byte, bool, error) {
+	res, err := claimScript.Run(ctx, s.client, []string{s.prefix + key}, token, lock.Milliseconds()).Slice()
+	if err != nil {
+		return nil, false, err
+	}
+	state, _ := res[0].(int64)
+	switch state {
+	case 0:
+		return nil, false, ErrInProgress
+	case 1:
+		result, _ := res[1].(string)
+		return []byte(result), true, nil
+	default:
+		return nil, false, nil
+	}
+}
+
+func (s *redisStore) Complete(ctx context.Context, key, token string, result []byte, ttl time.Duration) error {
+	ok, err := completeScript.Run(ctx, s.client, []string{s.prefix + key}, token, result, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if ok == 0 {
+		return ErrNotOwner
+	}
+	return nil
+}
+
+func (s *redisStore) Release(ctx context.Context, key, token string) error {
+	return releaseScript.Run(ctx, s.client, []string{s.prefix + key}, token).Err()
+}
+
+// FirestoreStore keeps keys as documents of collection, updated in
+// transactions. Documents are not deleted when they expire; add a TTL
+// policy on their expireAt field to remove them.
+func FirestoreStore(client *firestore.Client, collection string) Store {
+	return &firestoreStore{client: client, coll: client.Collection(collection)}
+}
+
+type firestoreStore struct {
+	client *firestore.Client
+	coll   *firestore.CollectionRef
+}
+
+func (s *firestoreStore) doc(key string) *firestore.DocumentRef {
+	// document IDs cannot contain slashes
+	return s.coll.Doc(url.PathEscape(key))
+}
+
+// get reads key's record in tx, or nil if there is none.
+func get(tx *firestore.Transaction, ref *firestore.DocumentRef) (*record, error) {
+	snap, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var r record
+	if err := snap.DataTo(&r); err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+func (s *firestoreStore) Claim(ctx context.Context, key, token string, lock time.Duration) (result []byte, done bool, err error) {
+	ref := s.doc(key)
+	err = s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		r, err := get(tx, ref)
+		if err != nil {
+			return err
+		}
+		var next *record
+		next, result, done, err = claim(r, token, lock, time.Now())
+		if err != nil || next == nil {
+			return err
+		}
+		return tx.Set(ref, next)
+	})
+	return result, done, err
+}
+
+func (s *firestoreStore) Complete(ctx context.Context, key, token string, result []byte, ttl time.Duration) error {
+	ref := s.doc(key)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		r, err := get(tx, ref)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !owned(r, token, now) {
+			return ErrNotOwner
+		}
+		return tx.Set(ref, &record{Token: token, Done: true, Result: result, ExpireAt: now.Add(ttl)})
+	})
+}
+
+func (s *firestoreStore) Release(ctx context.Context, key, token string) error {
+	ref := s.doc(key)
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		r, err := get(tx, ref)
+		if err != nil || !owned(r, token, time.Now()) {
+			return err
+		}
+		return tx.Delete(ref)
+	})
+}
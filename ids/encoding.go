@@ -0,0 +1,165 @@
+package ids
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"time"
+)
+
+const (
+	ulidLen  = 26
+	ksuidLen = 27
+
+	// ksuidEpoch is the KSUID epoch, 2014-05-13T16:53:20Z, in Unix seconds.
+	ksuidEpoch = 1400000000
+
+	crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	base62    = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+)
+
+// raw holds an ID's bytes: 16 for a ULID, 20 for a KSUID. The time comes
+// first, big-endian, so byte order is time order.
+type raw [20]byte
+
+func nextULID(last raw, t time.Time, entropy io.Reader) (raw, error) {
+	ms := uint64(max(t.UnixMilli(), 0))
+	lastMs := uint64(last[0])<<40 | uint64(binary.BigEndian.Uint32(last[1:5]))<<8 | uint64(last[5])
+	return next(last, ms, lastMs, 6, 16, entropy)
+}
+
+func nextKSUID(last raw, t time.Time, entropy io.Reader) (raw, error) {
+	secs := uint64(min(max(t.Unix()-ksuidEpoch, 0), math.MaxUint32))
+	return next(last, secs, uint64(binary.BigEndian.Uint32(last[:4])), 4, 20, entropy)
+}
+
+// next returns an ID at ts with random bits in b[start:end]. If ts is not
+// after the last ID's, the last ID's random bits are incremented instead,
+// moving on to the next tick when they run out.
+func next(last raw, ts, lastTs uint64, start, end int, entropy io.Reader) (raw, error) {
+	r := last
+	if last != (raw{}) && ts <= lastTs {
+		if increment(r[start:end]) {
+			return r, nil
+		}
+		ts = lastTs + 1
+	}
+	if _, err := io.ReadFull(entropy, r[start:end]); err != nil {
+		return raw{}, err
+	}
+	for i := start - 1; i >= 0; i-- {
+		r[i] = byte(ts)
+		ts >>= 8
+	}
+	return r, nil
+}
+
+// increment adds one to b, reporting false if it wrapped around.
+func increment(b []byte) bool {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i]++
+		if b[i] != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func (r raw) time(k Kind) time.Time {
+	if k == KSUID {
+		return time.Unix(int64(binary.BigEndian.Uint32(r[:4]))+ksuidEpoch, 0).UTC()
+	}
+	ms := int64(r[0])<<40 | int64(binary.BigEndian.Uint32(r[1:5]))<<8 | int64(r[5])
+	return time.UnixMilli(ms).UTC()
+}
+
+func (r raw) encode(k Kind) string {
+	if k == KSUID {
+		return encodeKSUID(r)
+	}
+	return encodeULID(r)
+}
+
+// encodeULID writes the 128 bits of r[:16] as 26 base32 digits, the first
+// carrying the top 3 bits.
+func encodeULID(r raw) string {
+	hi, lo := binary.BigEndian.Uint64(r[:8]), binary.BigEndian.Uint64(r[8:16])
+	var out [ulidLen]byte
+	for i := ulidLen - 1; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:])
+}
+
+func decodeULID(s string) (raw, error) {
+	var hi, lo uint64
+	for i := 0; i < len(s); i++ {
+		v := crockfordValue(s[i])
+		if v < 0 {
+			return raw{}, errors.New("invalid character")
+		}
+		if i == 0 && v > 7 {
+			return raw{}, errors.New("overflows 128 bits")
+		}
+		hi = hi<<5 | lo>>59
+		lo = lo<<5 | uint64(v)
+	}
+	var r raw
+	binary.BigEndian.PutUint64(r[:8], hi)
+	binary.BigEndian.PutUint64(r[8:16], lo)
+	return r, nil
+}
+
+func crockfordValue(c byte) int {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	for i := 0; i < len(crockford); i++ {
+		if crockford[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// encodeKSUID writes r as 27 base62 digits, zero-padded so IDs sort as
+// strings.
+func encodeKSUID(r raw) string {
+	n := new(big.Int).SetBytes(r[:])
+	base, mod := big.NewInt(62), new(big.Int)
+	out := []byte("000000000000000000000000000")
+	for i := ksuidLen - 1; i >= 0 && n.Sign() > 0; i-- {
+		n.DivMod(n, base, mod)
+		out[i] = base62[mod.Int64()]
+	}
+	return string(out)
+}
+
+func decodeKSUID(s string) (raw, error) {
+	n, base := new(big.Int), big.NewInt(62)
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		var v int64
+		switch {
+		case c >= '0' && c <= '9':
+			v = int64(c - '0')
+		case c >= 'A' && c <= 'Z':
+			v = int64(c-'A') + 10
+		case c >= 'a' && c <= 'z':
+			v = int64(c-'a') + 36
+		default:
+			return raw{}, errors.New("invalid character")
+		}
+		n.Mul(n, base).Add(n, big.NewInt(v))
+	}
+	if n.BitLen() > 160 {
+		return raw{}, errors.New("overflows 160 bits")
+	}
+	var r raw
+	n.FillBytes(r[:])
+	return r, nil
+}
@@ -0,0 +1,204 @@
+// Package ids generates prefixed, time-sortable identifiers for print jobs,
+// orders, alerts and the like, as ULIDs (millisecond time, 26 characters)
+// or KSUIDs (second time, 27 characters). IDs from one Generator sort in
+// the order they were made, both as strings and by their time, so they
+// can serve as Firestore document IDs and BigQuery keys alike.
+//
+// Quick start:
+//
+//	var jobIDs = ids.New("job") // job_01HV3R8Y6Q2N9W4ZK7XJ5T1BMC
+//
+//	job.ID = jobIDs.Next()
+//
+//	id, err := jobIDs.Parse(r.PathValue("id"))
+//	if err != nil {
+//	    errs.WriteHTTP(w, err) // 400
+//	    return
+//	}
+//	age := time.Since(id.Time)
+package ids
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+)
+
+// Separator separates an ID's prefix from its body.
+const Separator = "_"
+
+// ErrInvalid is returned, wrapped, for strings that are not IDs of the
+// expected prefix and kind.
+var ErrInvalid = errs.New(errs.InvalidArgument, "invalid id")
+
+// Kind is an ID format.
+type Kind uint8
+
+const (
+	// ULID is 48 bits of Unix milliseconds and 80 random bits, in 26
+	// Crockford base32 characters.
+	ULID Kind = iota
+	// KSUID is 32 bits of seconds since 2014-05-13 and 128 random bits, in
+	// 27 base62 characters.
+	KSUID
+)
+
+func (k Kind) String() string {
+	switch k {
+	case ULID:
+		return "ulid"
+	case KSUID:
+		return "ksuid"
+	}
+	return fmt.Sprintf("Kind(%d)", uint8(k))
+}
+
+// ID is a parsed identifier.
+type ID struct {
+	Prefix string
+	Kind   Kind
+	// Time is when the ID was made, to the millisecond for ULIDs and the
+	// second for KSUIDs.
+	Time time.Time
+	// Body is the encoded ID without its prefix.
+	Body string
+}
+
+// String returns the ID as generated, e.g. "job_01HV3R8Y6Q2N9W4ZK7XJ5T1BMC".
+func (id ID) String() string {
+	if id.Prefix == "" {
+		return id.Body
+	}
+	return id.Prefix + Separator + id.Body
+}
+
+// Options configures a Generator; set them with the With functions.
+type Options struct {
+	Kind    Kind
+	Clock   func() time.Time
+	Entropy io.Reader
+}
+
+type Option func(*Options)
+
+// WithKSUID makes KSUIDs instead of ULIDs, for systems that already use
+// them.
+func WithKSUID() Option { return func(o *Options) { o.Kind = KSUID } }
+
+// WithClock sets the time source, time.Now by default.
+func WithClock(now func() time.Time) Option { return func(o *Options) { o.Clock = now } }
+
+// WithEntropy sets the source of random bits, crypto/rand by default.
+func WithEntropy(r io.Reader) Option { return func(o *Options) { o.Entropy = r } }
+
+// Generator makes IDs with one prefix and kind. It is safe for concurrent
+// use.
+type Generator struct {
+	prefix string
+	opts   Options
+
+	mu   sync.Mutex
+	last raw
+}
+
+// New returns a Generator of IDs with prefix, which is lowercase letters
+// and digits starting with a letter, such as "job" or "ord"; an empty
+// prefix makes bare IDs. It panics on other prefixes.
+func New(prefix string, opts ...Option) *Generator {
+	if !validPrefix(prefix) {
+		panic(fmt.Sprintf("ids: invalid prefix %q", prefix))
+	}
+	options := Options{Clock: time.Now, Entropy: rand.Reader}
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Generator{prefix: prefix, opts: options}
+}
+
+// Next returns a new ID. Each ID sorts after the previous one from g, even
+// within one millisecond (or second, for KSUIDs) or when the clock steps
+// back: then the last ID's random bits are incremented instead of drawn.
+// It panics if the entropy source fails.
+func (g *Generator) Next() string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	t := g.opts.Clock()
+	var next raw
+	var err error
+	if g.opts.Kind == KSUID {
+		next, err = nextKSUID(g.last, t, g.opts.Entropy)
+	} else {
+		next, err = nextULID(g.last, t, g.opts.Entropy)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("ids: read entropy: %v", err))
+	}
+	g.last = next
+	return ID{Prefix: g.prefix, Body: next.encode(g.opts.Kind)}.String()
+}
+
+// Parse parses s as an ID of g's prefix and kind.
+func (g *Generator) Parse(s string) (ID, error) {
+	id, err := Parse(s)
+	if err != nil {
+		return ID{}, err
+	}
+	if id.Prefix != g.prefix || id.Kind != g.opts.Kind {
+		return ID{}, fmt.Errorf("%w: %q is not a %s with prefix %q", ErrInvalid, s, g.opts.Kind, g.prefix)
+	}
+	return id, nil
+}
+
+// Valid reports whether s is an ID of g's prefix and kind.
+func (g *Generator) Valid(s string) bool {
+	_, err := g.Parse(s)
+	return err == nil
+}
+
+// Parse parses an ID of any prefix, telling ULIDs and KSUIDs apart by
+// length. ULIDs are accepted in either case.
+func Parse(s string) (ID, error) {
+	prefix, body, ok := strings.Cut(s, Separator)
+	if !ok {
+		prefix, body = "", s
+	}
+	if !validPrefix(prefix) {
+		return ID{}, fmt.Errorf("%w: %q has an invalid prefix", ErrInvalid, s)
+	}
+	id := ID{Prefix: prefix}
+	var r raw
+	var err error
+	switch len(body) {
+	case ulidLen:
+		id.Kind = ULID
+		r, err = decodeULID(body)
+	case ksuidLen:
+		id.Kind = KSUID
+		r, err = decodeKSUID(body)
+	default:
+		err = fmt.Errorf("length %d", len(body))
+	}
+	if err != nil {
+		return ID{}, fmt.Errorf("%w: %q: %v", ErrInvalid, s, err)
+	}
+	id.Time = r.time(id.Kind)
+	id.Body = r.encode(id.Kind)
+	return id, nil
+}
+
+func validPrefix(p string) bool {
+	for i, c := range p {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return len(p) <= 16
+}
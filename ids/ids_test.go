@@ -0,0 +1,238 @@
+package ids_test
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/ids"
+)
+
+// constReader is an entropy source that returns b forever.
+type constReader byte
+
+func (r constReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = byte(r)
+	}
+	return len(p), nil
+}
+
+// clock returns the times in order, repeating the last one.
+func clock(times ...time.Time) func() time.Time {
+	return func() time.Time {
+		t := times[0]
+		if len(times) > 1 {
+			times = times[1:]
+		}
+		return t
+	}
+}
+
+var epoch = time.Date(2026, 10, 15, 9, 30, 0, 123_000_000, time.UTC)
+
+func TestNextIsSorted(t *testing.T) {
+	kinds := []struct {
+		name string
+		opts []ids.Option
+		tick time.Duration
+	}{
+		{"ulid", nil, time.Millisecond},
+		{"ksuid", []ids.Option{ids.WithKSUID()}, time.Second},
+	}
+	for _, k := range kinds {
+		tests := []struct {
+			name    string
+			clock   func() time.Time
+			entropy constReader
+		}{
+			{"same tick", clock(epoch), 0x42},
+			{"clock going backwards", clock(epoch, epoch.Add(-time.Hour), epoch.Add(-2*k.tick), epoch), 0x42},
+			{"random bits wrapping around", clock(epoch), 0xff},
+			{"later ticks", clock(epoch, epoch.Add(k.tick), epoch.Add(5*k.tick)), 0x00},
+		}
+		for _, tt := range tests {
+			t.Run(k.name+"/"+tt.name, func(t *testing.T) {
+				g := ids.New("job", append([]ids.Option{ids.WithClock(tt.clock), ids.WithEntropy(tt.entropy)}, k.opts...)...)
+				var got []string
+				for i := 0; i < 1000; i++ {
+					got = append(got, g.Next())
+				}
+				for i := 1; i < len(got); i++ {
+					if got[i-1] >= got[i] {
+						t.Fatalf("id %d = %s does not sort after %s", i, got[i], got[i-1])
+					}
+				}
+				first, err := g.Parse(got[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := epoch.Truncate(k.tick); !first.Time.Equal(want) {
+					t.Errorf("first id time = %v, want %v", first.Time, want)
+				}
+			})
+		}
+	}
+}
+
+func TestWrapAdvancesTick(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []ids.Option
+		tick time.Duration
+	}{
+		{"ulid", nil, time.Millisecond},
+		{"ksuid", []ids.Option{ids.WithKSUID()}, time.Second},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			g := ids.New("", append([]ids.Option{ids.WithClock(clock(epoch)), ids.WithEntropy(constReader(0xff))}, tt.opts...)...)
+			a, err := ids.Parse(g.Next())
+			if err != nil {
+				t.Fatal(err)
+			}
+			b, err := ids.Parse(g.Next())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d := b.Time.Sub(a.Time); d != tt.tick {
+				t.Errorf("time advanced by %v after the random bits ran out, want %v", d, tt.tick)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, g := range []*ids.Generator{
+		ids.New("ord"),
+		ids.New("alr", ids.WithKSUID()),
+		ids.New(""),
+		ids.New("job", ids.WithEntropy(constReader(0xff))),
+		ids.New("job", ids.WithEntropy(constReader(0x00)), ids.WithKSUID()),
+	} {
+		for i := 0; i < 100; i++ {
+			s := g.Next()
+			id, err := g.Parse(s)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", s, err)
+			}
+			if id.String() != s {
+				t.Fatalf("Parse(%q).String() = %q", s, id.String())
+			}
+			// exhausted random bits move IDs ahead of the clock
+			if d := time.Since(id.Time); d < -time.Minute || d > time.Minute {
+				t.Fatalf("Parse(%q).Time = %v", s, id.Time)
+			}
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in     string
+		prefix string
+		kind   ids.Kind
+		time   time.Time
+		body   string
+	}{
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAV", "", ids.ULID, time.UnixMilli(1469922850259), "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{"job_01arz3ndektsv4rrffq69g5fav", "job", ids.ULID, time.UnixMilli(1469922850259), "01ARZ3NDEKTSV4RRFFQ69G5FAV"},
+		{"7ZZZZZZZZZZZZZZZZZZZZZZZZZ", "", ids.ULID, time.UnixMilli(1<<48 - 1), "7ZZZZZZZZZZZZZZZZZZZZZZZZZ"},
+		{"0ujtsYcgvSTl8PAuAdqWYSMnLOv", "", ids.KSUID, time.Unix(1507608047, 0), "0ujtsYcgvSTl8PAuAdqWYSMnLOv"},
+		{"ord_000000000000000000000000000", "ord", ids.KSUID, time.Unix(1400000000, 0), "000000000000000000000000000"},
+		{"aWgEPTl1tmebfsQzFP4bxwgy80V", "", ids.KSUID, time.Unix(1400000000+1<<32-1, 0), "aWgEPTl1tmebfsQzFP4bxwgy80V"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			id, err := ids.Parse(tt.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if id.Prefix != tt.prefix || id.Kind != tt.kind || !id.Time.Equal(tt.time) || id.Body != tt.body {
+				t.Errorf("Parse = %+v, want prefix %q kind %v time %v body %q", id, tt.prefix, tt.kind, tt.time, tt.body)
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"",
+		"job_",
+		"Job_01ARZ3NDEKTSV4RRFFQ69G5FAV",                         // uppercase prefix
+		"1job_01ARZ3NDEKTSV4RRFFQ69G5FAV",                        // prefix starting with a digit
+		"job_01ARZ3NDEKTSV4RRFFQ69G5FA",                          // too short
+		"job_01ARZ3NDEKTSV4RRFFQ69G5FAVV0",                       // too long
+		"job_81ARZ3NDEKTSV4RRFFQ69G5FAV",                         // overflows 128 bits
+		"job_01ARZ3NDEKTSV4RRFFQ69G5FAU",                         // U is not Crockford base32
+		"ord_0ujtsYcgvSTl8PAuAdqWYSMnLO-",                        // not base62
+		"ord_aWgEPTl1tmebfsQzFP4bxwgy80W",                        // overflows 160 bits
+		"job_ord_01ARZ3NDEKTSV4RRFFQ69G5FAV",                     // two prefixes
+		strings.Repeat("a", 17) + "_0ujtsYcgvSTl8PAuAdqWYSMnLOv", // prefix too long
+	} {
+		if id, err := ids.Parse(in); !errors.Is(err, ids.ErrInvalid) {
+			t.Errorf("Parse(%q) = %+v, %v; want ErrInvalid", in, id, err)
+		}
+	}
+}
+
+func TestGeneratorParseChecksPrefixAndKind(t *testing.T) {
+	jobs := ids.New("job")
+	for _, s := range []string{
+		ids.New("ord").Next(),
+		ids.New("job", ids.WithKSUID()).Next(),
+		ids.New("").Next(),
+	} {
+		if _, err := jobs.Parse(s); !errors.Is(err, ids.ErrInvalid) {
+			t.Errorf("Parse(%q) error = %v, want ErrInvalid", s, err)
+		}
+		if jobs.Valid(s) {
+			t.Errorf("Valid(%q) = true", s)
+		}
+	}
+	if s := jobs.Next(); !jobs.Valid(s) {
+		t.Errorf("Valid(%q) = false", s)
+	}
+}
+
+func TestNewPanicsOnInvalidPrefix(t *testing.T) {
+	for _, prefix := range []string{"Job", "1job", "job_", "jo-b", strings.Repeat("a", 17)} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("New(%q) did not panic", prefix)
+				}
+			}()
+			ids.New(prefix)
+		}()
+	}
+}
+
+func TestConcurrentNextIsUnique(t *testing.T) {
+	g := ids.New("job")
+	out := make(chan string, 8*1000)
+	done := make(chan struct{})
+	for w := 0; w < 8; w++ {
+		go func() {
+			for i := 0; i < 1000; i++ {
+				out <- g.Next()
+			}
+			done <- struct{}{}
+		}()
+	}
+	for w := 0; w < 8; w++ {
+		<-done
+	}
+	close(out)
+	var got []string
+	for s := range out {
+		got = append(got, s)
+	}
+	sort.Strings(got)
+	for i := 1; i < len(got); i++ {
+		if got[i] == got[i-1] {
+			t.Fatalf("duplicate id %s", got[i])
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"github.com/slack-go/slack"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Setting SLACK_ACK_BUTTONS=true adds an "Acknowledge" button to Slack alerts.
+// Clicking it (see NewInteractionHandler) strikes the alert through, records
+// who acknowledged it and mutes repeats with the same fingerprint for
+// SLACK_ACK_SUPPRESS_FOR (default 1h). Acks are kept per instance unless
+// SLACK_ACK_FIRESTORE_COLLECTION is set, which is needed when the
+// interactivity endpoint and the Pub/Sub handler run as separate services.
+//
+// Reacting to an alert with one of SLACK_SNOOZE_EMOJI (comma-separated names,
+// default "no_bell") snoozes its fingerprint the same way for
+// SLACK_SNOOZE_FOR (default 1h); see NewEventHandler.
+//
+// Setting SLACK_ACK_RESOLVE_SEVERITY (e.g. INFO) lifts a mute early once the
+// issue looks resolved: an entry from the same source (log, resource type and
+// service) at or below that severity, and below the acknowledged alert's,
+// ends the mute so the next failure alerts again. SLACK_ACK_RESOLVE_PATTERN
+// additionally requires the entry's text to match a regexp, e.g.
+// "recovered|back to normal".
+
+const (
+	defaultAckSuppressFor = time.Hour
+	defaultSnoozeFor      = time.Hour
+	defaultSnoozeEmoji    = "no_bell"
+	ackActionID           = "ack_alert"
+	alertMetadataType     = "ieos_alert"
+)
+
+// ackRecord is one acknowledgement of a fingerprint.
+type ackRecord struct {
+	Fingerprint string    `firestore:"fingerprint"`
+	UserID      string    `firestore:"userId"`
+	UserName    string    `firestore:"userName"`
+	Via         string    `firestore:"via"` // "button" or "reaction"
+	AckedAt     time.Time `firestore:"ackedAt"`
+	Until       time.Time `firestore:"until"`
+	ExpireAt    time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+	// Source and Severity identify what may resolve the ack; empty for
+	// alerts posted before they were recorded.
+	Source     string    `firestore:"source"`
+	Severity   string    `firestore:"severity"`
+	ResolvedAt time.Time `firestore:"resolvedAt"`
+}
+
+// ackTracker remembers acknowledged fingerprints until their mute expires.
+type ackTracker struct {
+	buttons     bool
+	suppressFor time.Duration
+	snoozeEmoji map[string]bool
+	snoozeFor   time.Duration
+	resolve     bool
+	resolveAt   logging.Severity         // highest severity that resolves
+	resolveRE   *regexp.Regexp           // optional
+	shared      *firestore.CollectionRef // optional
+
+	mu    sync.Mutex
+	local map[string]ackRecord
+}
+
+// ack mutes the fingerprint and marks its alert history as acknowledged.
+func (t *ackTracker) ack(ctx context.Context, rec ackRecord) error {
+	t.mu.Lock()
+	t.local[rec.Fingerprint] = rec
+	t.mu.Unlock()
+	if h, _ := getHistory(); h != nil {
+		if err := h.acked(ctx, rec); err != nil {
+			// the mute matters more than the timeline
+			log.Printf("failed to record acknowledgement of %s in alert history: %v", rec.Fingerprint, err)
+		}
+	}
+	if t.shared == nil {
+		return nil
+	}
+	_, err := t.shared.Doc(rec.Fingerprint).Set(ctx, rec)
+	return err
+}
+
+// active returns the acknowledgement muting fingerprint at now, if any.
+func (t *ackTracker) active(ctx context.Context, fingerprint string, now time.Time) (*ackRecord, error) {
+	if t == nil || fingerprint == "" {
+		return nil, nil
+	}
+	t.mu.Lock()
+	rec, ok := t.local[fingerprint]
+	if ok && !now.Before(rec.Until) {
+		delete(t.local, fingerprint)
+		ok = false
+	}
+	t.mu.Unlock()
+	if ok {
+		return &rec, nil
+	}
+	if t.shared == nil {
+		return nil, nil
+	}
+	snap, err := t.shared.Doc(fingerprint).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := snap.DataTo(&rec); err != nil {
+		return nil, err
+	}
+	if !now.Before(rec.Until) {
+		return nil, nil
+	}
+	t.mu.Lock()
+	t.local[fingerprint] = rec
+	t.mu.Unlock()
+	return &rec, nil
+}
+
+// resolved ends the mutes of the entry's source that it resolves and
+// returns them: the entry must be at or below the resolving severity, below
+// the acknowledged alert's severity and match the resolve pattern, if any.
+func (t *ackTracker) resolved(ctx context.Context, e *LogEntry, text string, now time.Time) ([]ackRecord, error) {
+	if t == nil || !t.resolve || e.SeverityLevel() > t.resolveAt || (t.resolveRE != nil && !t.resolveRE.MatchString(text)) {
+		return nil, nil
+	}
+	source := alertSource(e)
+	resolves := func(rec ackRecord) bool {
+		return rec.Source == source && now.Before(rec.Until) && logging.ParseSeverity(rec.Severity) > e.SeverityLevel()
+	}
+
+	var out []ackRecord
+	t.mu.Lock()
+	for fingerprint, rec := range t.local {
+		if resolves(rec) {
+			delete(t.local, fingerprint)
+			rec.Until, rec.ResolvedAt = now, now
+			out = append(out, rec)
+		}
+	}
+	t.mu.Unlock()
+	if t.shared == nil {
+		return out, nil
+	}
+
+	snaps, err := t.shared.Where("source", "==", source).Where("until", ">", now).Documents(ctx).GetAll()
+	if err != nil {
+		return out, err
+	}
+	for _, snap := range snaps {
+		var rec ackRecord
+		if err := snap.DataTo(&rec); err != nil {
+			return out, err
+		}
+		if !resolves(rec) {
+			continue
+		}
+		if _, err := snap.Ref.Update(ctx, []firestore.Update{{Path: "until", Value: now}, {Path: "resolvedAt", Value: now}}); err != nil {
+			return out, err
+		}
+		rec.Until, rec.ResolvedAt = now, now
+		if !containsAck(out, rec.Fingerprint) {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+func containsAck(recs []ackRecord, fingerprint string) bool {
+	for _, rec := range recs {
+		if rec.Fingerprint == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	acks         *ackTracker
+	acksErr      error
+	acksInitOnce sync.Once
+)
+
+// getAcks returns the ack tracker configured via env. It is always usable;
+// an error means the shared backend is unavailable.
+func getAcks() (*ackTracker, error) {
+	acksInitOnce.Do(func() {
+		acks = &ackTracker{
+			buttons:     setting("SLACK_ACK_BUTTONS") == "true",
+			suppressFor: defaultAckSuppressFor,
+			snoozeEmoji: map[string]bool{},
+			snoozeFor:   defaultSnoozeFor,
+			local:       map[string]ackRecord{},
+		}
+		if v := setting("SLACK_ACK_SUPPRESS_FOR"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				acksErr = fmt.Errorf("invalid SLACK_ACK_SUPPRESS_FOR %q", v)
+			} else {
+				acks.suppressFor = d
+			}
+		}
+		if v := setting("SLACK_SNOOZE_FOR"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				acksErr = fmt.Errorf("invalid SLACK_SNOOZE_FOR %q", v)
+			} else {
+				acks.snoozeFor = d
+			}
+		}
+		if v := setting("SLACK_ACK_RESOLVE_SEVERITY"); v != "" {
+			if !validSeverity(v) {
+				acksErr = fmt.Errorf("invalid SLACK_ACK_RESOLVE_SEVERITY %q", v)
+			} else {
+				acks.resolve, acks.resolveAt = true, logging.ParseSeverity(v)
+			}
+		}
+		if v := setting("SLACK_ACK_RESOLVE_PATTERN"); v != "" {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				acksErr = fmt.Errorf("invalid SLACK_ACK_RESOLVE_PATTERN: %v", err)
+			} else {
+				acks.resolveRE = re
+			}
+		}
+		emoji := setting("SLACK_SNOOZE_EMOJI")
+		if emoji == "" {
+			emoji = defaultSnoozeEmoji
+		}
+		for _, name := range strings.Split(emoji, ",") {
+			if name = strings.Trim(strings.TrimSpace(name), ":"); name != "" {
+				acks.snoozeEmoji[name] = true
+			}
+		}
+		collection := setting("SLACK_ACK_FIRESTORE_COLLECTION")
+		if collection == "" {
+			return
+		}
+		client, err := getFirestore()
+		if err != nil {
+			acksErr = err
+			return
+		}
+		acks.shared = client.Collection(collection)
+	})
+	return acks, acksErr
+}
+
+// ackedBlocks rewrites an alert after acknowledgement: the header line is
+// struck through, the button is dropped and a context line names the user.
+// Other blocks, such as resource fields, are kept.
+func ackedBlocks(original slack.Blocks, rec ackRecord) []slack.Block {
+	var (
+		text string
+		rest []slack.Block
+	)
+	for _, b := range original.BlockSet {
+		switch blk := b.(type) {
+		case *slack.SectionBlock:
+			if blk.Text != nil && text == "" {
+				text = blk.Text.Text
+				continue
+			}
+		case *slack.ActionBlock:
+			continue
+		}
+		rest = append(rest, b)
+	}
+	title, body, _ := strings.Cut(text, "\n")
+	if title != "" {
+		text = "~" + title + "~"
+		if body != "" {
+			text += "\n" + body
+		}
+	}
+	note := fmt.Sprintf(":white_check_mark: Acknowledged by <@%s> · repeats muted until %s", rec.UserID, slackDate(rec.Until))
+	blocks := append([]slack.Block{alertSection(text)}, rest...)
+	return append(blocks, slack.NewContextBlock("", slack.NewTextBlockObject(slack.MarkdownType, note, false, false)))
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Setting SLACK_DAILY_THREAD=true keeps channel timelines to one message a
+// day: the first alert of the day (in SLACK_TIMEZONE) posts a dated anchor
+// message to the channel and every alert below
+// SLACK_DAILY_THREAD_BYPASS_SEVERITY (default CRITICAL) is posted in its
+// thread. Alerts at or above it, and summaries, stay top level. Anchors are
+// kept per instance unless SLACK_DAILY_THREAD_FIRESTORE_COLLECTION is set.
+
+// anchorWindow outlives the day so late alerts still find the anchor; the
+// day is part of the key, so a new day always gets a new anchor.
+const anchorWindow = 48 * time.Hour
+
+const anchorDayLayout = "2006-01-02"
+
+type dailyAnchors struct {
+	threads *traceThreads
+	bypass  logging.Severity
+}
+
+var (
+	anchors         *dailyAnchors
+	anchorsErr      error
+	anchorsInitOnce sync.Once
+)
+
+// getDailyAnchors returns the anchor config, or nil when the mode is off.
+func getDailyAnchors() (*dailyAnchors, error) {
+	anchorsInitOnce.Do(func() {
+		if setting("SLACK_DAILY_THREAD") != "true" {
+			return
+		}
+		a := &dailyAnchors{
+			threads: &traceThreads{window: anchorWindow, local: map[string]traceThread{}},
+			bypass:  logging.Critical,
+		}
+		if v := setting("SLACK_DAILY_THREAD_BYPASS_SEVERITY"); v != "" {
+			if !validSeverity(v) {
+				anchorsErr = fmt.Errorf("invalid SLACK_DAILY_THREAD_BYPASS_SEVERITY %q", v)
+				return
+			}
+			a.bypass = logging.ParseSeverity(v)
+		}
+		if collection := setting("SLACK_DAILY_THREAD_FIRESTORE_COLLECTION"); collection != "" {
+			client, err := getFirestore()
+			if err != nil {
+				anchorsErr = err
+				return
+			}
+			a.threads.shared = client.Collection(collection)
+		}
+		anchors = a
+	})
+	return anchors, anchorsErr
+}
+
+// applies reports whether the alert belongs in the daily thread. Synthetic
+// alerts (digests, summaries) have no fingerprint and stay top level.
+func (d *dailyAnchors) applies(a *Alert) bool {
+	return d != nil && a.Fingerprint != "" && logging.ParseSeverity(a.Severity) < d.bypass
+}
+
+func anchorText(day time.Time) string {
+	return fmt.Sprintf(":spiral_calendar_pad: *Alerts for %s* — details in thread", day.Format("Monday, 2 January 2006"))
+}
+
+// dailyAnchorFor returns the ts of today's anchor on channelID, posting it
+// when the alert is the day's first. It returns "" when the alert should be
+// posted top level, including when the anchor cannot be posted.
+func dailyAnchorFor(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, channelID string, a *Alert) string {
+	d, err := getDailyAnchors()
+	if err != nil {
+		reqLog.Error("invalid daily thread config", err)
+	}
+	if !d.applies(a) {
+		return ""
+	}
+	loadTimestampConfig()
+	now := time.Now().In(timestampLoc)
+	day := now.Format(anchorDayLayout)
+	ts, err := d.threads.lookup(ctx, channelID, day, now)
+	if err != nil {
+		reqLog.Warning("daily anchor lookup failed", err, map[string]any{"target": channelID})
+		return ""
+	}
+	if ts != "" {
+		return ts
+	}
+	if ok, err := d.threads.claim(ctx, channelID, day, now); err != nil || !ok {
+		// another delivery is posting the anchor; this alert stays top level
+		if err != nil {
+			reqLog.Warning("daily anchor claim failed", err, map[string]any{"target": channelID})
+		}
+		return ""
+	}
+	ts, err = notifier.SendMessage(ctx, channelID, anchorText(now))
+	if err != nil {
+		reqLog.Error("failed to post daily anchor", err, map[string]any{"target": channelID})
+		if err := d.threads.release(ctx, channelID, day); err != nil {
+			reqLog.Warning("failed to release daily anchor claim", err, map[string]any{"target": channelID})
+		}
+		return ""
+	}
+	if err := d.threads.record(ctx, channelID, day, ts, now); err != nil {
+		reqLog.Warning("failed to record daily anchor", err, map[string]any{"target": channelID, "ts": ts})
+	}
+	return ts
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Cloud Billing budget notifications published to the topic are recognised
+// and rendered as budget alerts instead of raw JSON. They go to
+// SLACK_BILLING_CHANNEL_ID (destinations, like a route; the severity routes
+// when unset) prefixed with SLACK_BILLING_MENTION, which takes the same
+// values as SLACK_ESCALATION_MENTION. Billing republishes the same status
+// several times a day, so each threshold is announced once per budget
+// period and updates that cross no threshold are dropped.
+
+// budgetNotification is the Cloud Billing budget notification format.
+// See: https://cloud.google.com/billing/docs/how-to/budgets-programmatic-notifications
+type budgetNotification struct {
+	BudgetDisplayName         string    `json:"budgetDisplayName"`
+	AlertThresholdExceeded    float64   `json:"alertThresholdExceeded"`
+	ForecastThresholdExceeded float64   `json:"forecastThresholdExceeded"`
+	CostAmount                float64   `json:"costAmount"`
+	CostIntervalStart         time.Time `json:"costIntervalStart"`
+	BudgetAmount              float64   `json:"budgetAmount"`
+	BudgetAmountType          string    `json:"budgetAmountType"`
+	CurrencyCode              string    `json:"currencyCode"`
+}
+
+// parseBudgetNotification reports whether m is a budget notification.
+func parseBudgetNotification(m PubSubMessage) (*budgetNotification, bool) {
+	var b budgetNotification
+	if err := json.Unmarshal(m.Data, &b); err != nil || b.BudgetDisplayName == "" || b.CurrencyCode == "" {
+		return nil, false
+	}
+	return &b, true
+}
+
+// severity grades the notification: reaching the budget is an error, an
+// actual threshold a warning and a forecast one a notice.
+func (b *budgetNotification) severity() string {
+	switch {
+	case b.AlertThresholdExceeded >= 1:
+		return "ERROR"
+	case b.AlertThresholdExceeded > 0:
+		return "WARNING"
+	}
+	return "NOTICE"
+}
+
+// dedupKey identifies the threshold crossed in the current budget period.
+func (b *budgetNotification) dedupKey(budgetID string) string {
+	if budgetID == "" {
+		budgetID = b.BudgetDisplayName
+	}
+	sum := sha256.Sum256([]byte(budgetID))
+	return fmt.Sprintf("budget-%s-%d-%g-%g", hex.EncodeToString(sum[:8]), b.CostIntervalStart.Unix(), b.AlertThresholdExceeded, b.ForecastThresholdExceeded)
+}
+
+func formatBudgetNotification(b *budgetNotification, mention string) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "[%s] Billing budget: %s", b.severity(), b.BudgetDisplayName)
+	if mention != "" {
+		fmt.Fprintf(&s, "\n%s", mention)
+	}
+	if b.AlertThresholdExceeded > 0 {
+		fmt.Fprintf(&s, "\n:moneybag: *%.0f%%* of the budget reached", b.AlertThresholdExceeded*100)
+	} else {
+		fmt.Fprintf(&s, "\n:chart_with_upwards_trend: forecast to reach *%.0f%%* of the budget", b.ForecastThresholdExceeded*100)
+	}
+	fmt.Fprintf(&s, "\ncost so far: %.2f %s of %.2f %s", b.CostAmount, b.CurrencyCode, b.BudgetAmount, b.CurrencyCode)
+	if b.BudgetAmount > 0 {
+		fmt.Fprintf(&s, " (%.0f%%)", b.CostAmount/b.BudgetAmount*100)
+	}
+	if !b.CostIntervalStart.IsZero() {
+		fmt.Fprintf(&s, "\nperiod since: %s", formatTimestamp(b.CostIntervalStart))
+	}
+	if b.BudgetAmountType == "LAST_PERIODS_AMOUNT" {
+		s.WriteString("\nbudget: last period's spend")
+	}
+	return s.String()
+}
+
+// handleBudgetNotification posts a budget notification that crossed a
+// threshold not yet announced this period.
+func handleBudgetNotification(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, m PubSubMessage, b *budgetNotification) error {
+	if b.AlertThresholdExceeded == 0 && b.ForecastThresholdExceeded == 0 {
+		reqLog.Debug("budget update without a crossed threshold", map[string]any{"budget": b.BudgetDisplayName})
+		return nil
+	}
+	store, _ := getDedupStore()
+	key := b.dedupKey(m.Attributes["budgetId"])
+	if seen, _ := store.Seen(ctx, key); seen {
+		reqLog.Debug("budget threshold already announced", map[string]any{"budget": b.BudgetDisplayName})
+		return nil
+	}
+
+	severity := b.severity()
+	countMetric(reqLog, metricReceived, map[string]string{"severity": severity})
+	text := redact(formatBudgetNotification(b, slackMention(strings.TrimSpace(setting("SLACK_BILLING_MENTION")))))
+	alert := newAlert(severity, text, nil)
+	alert.Fingerprint = key
+	now := time.Now()
+	recordRecent(alert, now, "")
+	countAlertStats(ctx, reqLog, alert, now)
+
+	dests := parseDestinations(setting("SLACK_BILLING_CHANNEL_ID"))
+	if len(dests) == 0 {
+		dests = routeForSeverity(severity, "")
+	}
+	if err := fanOut(ctx, reqLog, notifier, m, dests, alert); err != nil {
+		return err
+	}
+	if err := store.MarkProcessed(ctx, key); err != nil {
+		reqLog.Warning("failed to record budget threshold", err, map[string]any{"budget": b.BudgetDisplayName})
+	}
+	return nil
+}
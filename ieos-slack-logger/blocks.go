@@ -0,0 +1,150 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/slack-go/slack"
+)
+
+// Slack alerts are rendered as Block Kit: the message text, then the key
+// labels of the monitored resource as fields so responders can tell which
+// deployment is affected at a glance. SLACK_RESOURCE_LABELS overrides which
+// labels are shown (comma-separated keys, in order).
+
+// Block Kit allows at most 10 fields per section.
+const maxSectionFields = 10
+
+// defaultResourceLabels are the labels shown when SLACK_RESOURCE_LABELS is unset.
+var defaultResourceLabels = []string{
+	"project_id", "service_name", "revision_name", "function_name", "job_name",
+	"location", "cluster_name", "namespace_name", "pod_name", "container_name",
+}
+
+// resourceLabelTitles are the field headings of well-known labels; others
+// are shown by key.
+var resourceLabelTitles = map[string]string{
+	"project_id":     "Project",
+	"service_name":   "Service",
+	"revision_name":  "Revision",
+	"function_name":  "Function",
+	"job_name":       "Job",
+	"location":       "Location",
+	"zone":           "Zone",
+	"region":         "Region",
+	"cluster_name":   "Cluster",
+	"namespace_name": "Namespace",
+	"pod_name":       "Pod",
+	"container_name": "Container",
+	"instance_id":    "Instance",
+}
+
+var (
+	resourceLabelKeys     []string
+	resourceLabelInitOnce configOnce
+)
+
+func getResourceLabelKeys() []string {
+	resourceLabelInitOnce.Do(func() {
+		resourceLabelKeys = defaultResourceLabels
+		if v := setting("SLACK_RESOURCE_LABELS"); v != "" {
+			resourceLabelKeys = nil
+			for _, key := range strings.Split(v, ",") {
+				if key = strings.TrimSpace(key); key != "" {
+					resourceLabelKeys = append(resourceLabelKeys, key)
+				}
+			}
+		}
+	})
+	return resourceLabelKeys
+}
+
+// resourceFields renders the entry's key resource labels as section fields.
+func resourceFields(e *LogEntry) []*slack.TextBlockObject {
+	var fields []*slack.TextBlockObject
+	for _, key := range getResourceLabelKeys() {
+		v := e.Resource.Labels[key]
+		if v == "" {
+			continue
+		}
+		title := resourceLabelTitles[key]
+		if title == "" {
+			title = key
+		}
+		fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, fmt.Sprintf("*%s*\n`%s`", title, v), false, false))
+		if len(fields) == maxSectionFields {
+			break
+		}
+	}
+	return fields
+}
+
+// alertMsgOptions tags the message with the alert fingerprint as message
+// metadata, so reactions can be traced back to it, and renders it as blocks:
+// the text, the resource labels and, when buttons are enabled, an
+// Acknowledge button. The plain text stays as the notification fallback.
+func alertMsgOptions(a *Alert) []slack.MsgOption {
+	if a.Fingerprint == "" {
+		return nil
+	}
+	payload := map[string]any{"fingerprint": a.Fingerprint, "severity": a.Severity}
+	if a.Entry != nil {
+		payload["source"] = alertSource(a.Entry)
+	}
+	opts := []slack.MsgOption{slack.MsgOptionMetadata(slack.SlackMetadata{
+		EventType:    alertMetadataType,
+		EventPayload: payload,
+	})}
+	blocks := []slack.Block{alertSection(slackText(a))}
+	if a.Entry != nil {
+		if fields := printJobBlockFields(a.Entry); len(fields) > 0 {
+			blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+		}
+		if fields := resourceFields(a.Entry); len(fields) > 0 {
+			blocks = append(blocks, slack.NewSectionBlock(nil, fields, nil))
+		}
+	}
+	if t, _ := getAcks(); t.buttons {
+		button := slack.NewButtonBlockElement(ackActionID, a.Fingerprint,
+			slack.NewTextBlockObject(slack.PlainTextType, "Acknowledge", false, false))
+		button.Style = slack.StylePrimary
+		blocks = append(blocks, slack.NewActionBlock("ack", button))
+	}
+	if a.Color != "" {
+		// the color bar is only drawn beside attachments, so the body moves
+		// into one below the header line
+		if head, body, ok := strings.Cut(slackText(a), "\n"); ok {
+			attachment := slack.Attachment{Color: a.Color, Fallback: head, Blocks: slack.Blocks{BlockSet: append([]slack.Block{alertSection(body)}, blocks[1:]...)}}
+			return append(opts, slack.MsgOptionBlocks(alertSection(head)), slack.MsgOptionAttachments(attachment))
+		}
+	}
+	if len(blocks) == 1 {
+		// plain text renders the same and keeps messages small
+		return opts
+	}
+	return append(opts, slack.MsgOptionBlocks(blocks...))
+}
+
+func alertSection(text string) *slack.SectionBlock {
+	return slack.NewSectionBlock(
+		slack.NewTextBlockObject(slack.MarkdownType, truncateMiddle(text, slackBlockTextLimit), false, false),
+		nil, nil,
+	)
+}
+
+// slackText is the Slack rendering of an alert: the environment badge, the
+// severity emoji, the text and the event time. Synthetic alerts carry no
+// environment or event time.
+func slackText(a *Alert) string {
+	text := a.Text
+	if emoji := severityEmoji(a.Severity); emoji != "" {
+		text = emoji + " " + text
+	}
+	if badge := environmentBadge(entryEnvironment(a.Entry)); badge != "" {
+		text = badge + " " + text
+	}
+	if a.Entry == nil {
+		return text
+	}
+	return text + "\n:clock3: " + slackDate(a.Timestamp())
+}
@@ -0,0 +1,289 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Posting budgets stop one noisy service from exhausting the workspace's
+// Slack rate limit. SLACK_CHANNEL_BUDGETS holds per-target budgets as
+// "<target>=<posts>/<window>" pairs and SLACK_CHANNEL_BUDGET_DEFAULT applies
+// to every other Slack target:
+//
+//	SLACK_CHANNEL_BUDGETS=C0123456=30/10m,eng/C0789=5/1m
+//	SLACK_CHANNEL_BUDGET_DEFAULT=60/10m
+//
+// Posts are counted over a sliding window per instance. Alerts over budget
+// are dropped and counted, unless at or above SLACK_BUDGET_BYPASS_SEVERITY
+// (default CRITICAL); a summary of the drops is posted once the channel has
+// room again. Sink targets are not budgeted.
+
+type postBudget struct {
+	limit  int
+	window time.Duration
+}
+
+func parsePostBudget(s string) (postBudget, error) {
+	n, w, ok := strings.Cut(strings.TrimSpace(s), "/")
+	limit, err := strconv.Atoi(n)
+	if !ok || err != nil || limit <= 0 {
+		return postBudget{}, fmt.Errorf("invalid budget %q: expected <posts>/<window>", s)
+	}
+	window, err := time.ParseDuration(w)
+	if err != nil || window <= 0 {
+		return postBudget{}, fmt.Errorf("invalid budget %q: bad window", s)
+	}
+	return postBudget{limit: limit, window: window}, nil
+}
+
+// channelBudgets tracks recent posts per target against its budget.
+type channelBudgets struct {
+	byTarget map[string]postBudget
+	fallback *postBudget // optional
+	bypass   logging.Severity
+
+	mu      sync.Mutex
+	posts   map[string][]time.Time    // target -> post times, oldest first
+	dropped map[string]map[string]int // target -> severity -> count
+	since   map[string]time.Time      // target -> first drop
+}
+
+func (b *channelBudgets) budgetFor(target string) (postBudget, bool) {
+	if pb, ok := b.byTarget[target]; ok {
+		return pb, true
+	}
+	if b.fallback != nil {
+		return *b.fallback, true
+	}
+	return postBudget{}, false
+}
+
+// prune drops posts that left the window and reports the remaining count.
+func (b *channelBudgets) prune(now time.Time, target string, pb postBudget) int {
+	posts := b.posts[target]
+	i := 0
+	for i < len(posts) && now.Sub(posts[i]) >= pb.window {
+		i++
+	}
+	b.posts[target] = posts[i:]
+	return len(posts) - i
+}
+
+// allow reports whether a post to target fits its budget and, if so,
+// counts it. Denied posts are counted towards the overflow summary.
+func (b *channelBudgets) allow(now time.Time, target, severity string) bool {
+	if b == nil {
+		return true
+	}
+	if _, _, isSink := sinkTarget(target); isSink {
+		return true
+	}
+	pb, ok := b.budgetFor(target)
+	if !ok {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.prune(now, target, pb) >= pb.limit && logging.ParseSeverity(severity) < b.bypass {
+		if b.dropped[target] == nil {
+			b.dropped[target] = map[string]int{}
+			b.since[target] = now
+		}
+		b.dropped[target][strings.ToUpper(severity)]++
+		return false
+	}
+	b.posts[target] = append(b.posts[target], now)
+	return true
+}
+
+// overflowSummary is the summary of the alerts a budget dropped for a target.
+type overflowSummary struct {
+	target string
+	counts map[string]int
+	since  time.Time
+	text   string
+}
+
+// overflowSummaries returns summaries of the alerts dropped for targets
+// that are back under budget, and resets their counts; summaries that fail
+// to post are put back with restore.
+func (b *channelBudgets) overflowSummaries(now time.Time) []overflowSummary {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []overflowSummary
+	for target, counts := range b.dropped {
+		pb, ok := b.budgetFor(target)
+		if ok && b.prune(now, target, pb) >= pb.limit {
+			continue
+		}
+		total := 0
+		sevs := make([]string, 0, len(counts))
+		for sev, n := range counts {
+			total += n
+			sevs = append(sevs, sev)
+		}
+		sort.Slice(sevs, func(i, j int) bool {
+			return logging.ParseSeverity(sevs[i]) > logging.ParseSeverity(sevs[j])
+		})
+		parts := make([]string, 0, len(sevs))
+		for _, sev := range sevs {
+			parts = append(parts, fmt.Sprintf("%s: %d", sev, counts[sev]))
+		}
+		budget := "Posting budget removed"
+		if ok {
+			budget = fmt.Sprintf("Posting budget of %d per %s exceeded", pb.limit, pb.window)
+		}
+		out = append(out, overflowSummary{
+			target: target,
+			counts: counts,
+			since:  b.since[target],
+			text: fmt.Sprintf("%s: %d alert(s) dropped since %s (%s)",
+				budget, total, formatTimestamp(b.since[target]), strings.Join(parts, ", ")),
+		})
+		delete(b.dropped, target)
+		delete(b.since, target)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].target < out[j].target })
+	return out
+}
+
+// restore puts the counts of a summary that could not be posted back, so
+// they are part of the next attempt.
+func (b *channelBudgets) restore(s overflowSummary) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.dropped[s.target] == nil {
+		b.dropped[s.target] = map[string]int{}
+		b.since[s.target] = s.since
+	}
+	if s.since.Before(b.since[s.target]) {
+		b.since[s.target] = s.since
+	}
+	for sev, n := range s.counts {
+		b.dropped[s.target][sev] += n
+	}
+}
+
+// carryBudgets moves the recent posts and drop counts of old, the budgets
+// before a config reload, to b so a reload neither resets the windows nor
+// loses the drops. Drops of targets that no longer have a budget are
+// summarised on the next invocation. When b is nil, old's drops are kept in
+// budgets without limits.
+func carryBudgets(old, b *channelBudgets) *channelBudgets {
+	if old == nil {
+		return b
+	}
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if b == nil {
+		if len(old.dropped) == 0 {
+			return nil
+		}
+		b = &channelBudgets{
+			byTarget: map[string]postBudget{},
+			bypass:   old.bypass,
+			posts:    map[string][]time.Time{},
+			dropped:  map[string]map[string]int{},
+			since:    map[string]time.Time{},
+		}
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for target, posts := range old.posts {
+		b.posts[target] = posts
+	}
+	for target, counts := range old.dropped {
+		b.dropped[target] = counts
+		b.since[target] = old.since[target]
+	}
+	old.posts, old.dropped, old.since = map[string][]time.Time{}, map[string]map[string]int{}, map[string]time.Time{}
+	return b
+}
+
+var (
+	budgets         *channelBudgets
+	budgetsErr      error
+	budgetsInitOnce configOnce
+)
+
+// getBudgets returns the budgets configured via env, or nil when none are set.
+func getBudgets() (*channelBudgets, error) {
+	budgetsInitOnce.Do(func() {
+		old := budgets
+		budgets, budgetsErr = nil, nil
+		defer func() { budgets = carryBudgets(old, budgets) }()
+		specs, fallback := setting("SLACK_CHANNEL_BUDGETS"), setting("SLACK_CHANNEL_BUDGET_DEFAULT")
+		if specs == "" && fallback == "" {
+			return
+		}
+		b := &channelBudgets{
+			byTarget: map[string]postBudget{},
+			bypass:   logging.Critical,
+			posts:    map[string][]time.Time{},
+			dropped:  map[string]map[string]int{},
+			since:    map[string]time.Time{},
+		}
+		for _, spec := range strings.Split(specs, ",") {
+			if strings.TrimSpace(spec) == "" {
+				continue
+			}
+			target, budget, ok := strings.Cut(spec, "=")
+			if !ok {
+				budgetsErr = fmt.Errorf("SLACK_CHANNEL_BUDGETS: expected <target>=<posts>/<window>, got %q", spec)
+				return
+			}
+			pb, err := parsePostBudget(budget)
+			if err != nil {
+				budgetsErr = fmt.Errorf("SLACK_CHANNEL_BUDGETS: %v", err)
+				return
+			}
+			b.byTarget[strings.TrimSpace(target)] = pb
+		}
+		if fallback != "" {
+			pb, err := parsePostBudget(fallback)
+			if err != nil {
+				budgetsErr = fmt.Errorf("SLACK_CHANNEL_BUDGET_DEFAULT: %v", err)
+				return
+			}
+			b.fallback = &pb
+		}
+		if v := setting("SLACK_BUDGET_BYPASS_SEVERITY"); v != "" {
+			// an unknown severity parses as DEFAULT, which would let
+			// everything bypass the budgets
+			if validSeverity(v) {
+				b.bypass = logging.ParseSeverity(v)
+			} else {
+				budgetsErr = fmt.Errorf("invalid SLACK_BUDGET_BYPASS_SEVERITY %q, using CRITICAL", v)
+			}
+		}
+		budgets = b
+	})
+	return budgets, budgetsErr
+}
+
+// postOverflowSummaries tells channels how many alerts their budget
+// dropped. Counts of summaries that failed to post with a transient error
+// are restored and posted again on the next invocation.
+func postOverflowSummaries(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, b *channelBudgets, summaries []overflowSummary) {
+	for _, s := range summaries {
+		err := deliver(ctx, reqLog, notifier, s.target, newAlert("WARNING", s.text, nil))
+		if err == nil {
+			continue
+		}
+		reqLog.Error("failed to post budget summary", err, map[string]any{"target": s.target})
+		if !IsPermanent(err) {
+			b.restore(s)
+		}
+	}
+}
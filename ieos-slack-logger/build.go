@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Cloud Build notifications (the "cloud-builds" topic) are recognised and
+// rendered as build status messages: build ID, trigger, branch, status,
+// duration and a link to the build, in a green or red attachment. They go
+// to SLACK_BUILD_CHANNEL_ID (destinations, like a route; the severity routes
+// when unset). SLACK_BUILD_STATUSES lists the statuses posted, by default
+// the finished ones; queued and running updates are dropped. Build step
+// output exported to the "cloudbuild" log is formatted by formatBuildLog.
+
+const (
+	defaultBuildStatuses = "SUCCESS,FAILURE,INTERNAL_ERROR,TIMEOUT,EXPIRED,CANCELLED"
+
+	buildColorSuccess = "#2EB67D"
+	buildColorFailure = "#D32F2F"
+)
+
+// buildNotification is the part of the Cloud Build Build resource needed for
+// alerts. See: https://cloud.google.com/build/docs/subscribe-build-notifications
+type buildNotification struct {
+	ID             string            `json:"id"`
+	ProjectID      string            `json:"projectId"`
+	Status         string            `json:"status"`
+	StatusDetail   string            `json:"statusDetail"`
+	BuildTriggerID string            `json:"buildTriggerId"`
+	Substitutions  map[string]string `json:"substitutions"`
+	StartTime      time.Time         `json:"startTime"`
+	FinishTime     time.Time         `json:"finishTime"`
+	LogURL         string            `json:"logUrl"`
+}
+
+// parseBuildNotification reports whether m is a Cloud Build notification.
+func parseBuildNotification(m PubSubMessage) (*buildNotification, bool) {
+	var b buildNotification
+	if err := json.Unmarshal(m.Data, &b); err != nil || b.ID == "" || b.Status == "" {
+		return nil, false
+	}
+	if m.Attributes["buildId"] == "" && b.LogURL == "" {
+		return nil, false
+	}
+	return &b, true
+}
+
+func (b *buildNotification) succeeded() bool { return b.Status == "SUCCESS" }
+
+func (b *buildNotification) failed() bool {
+	switch b.Status {
+	case "FAILURE", "INTERNAL_ERROR", "TIMEOUT", "EXPIRED":
+		return true
+	}
+	return false
+}
+
+func (b *buildNotification) severity() string {
+	switch {
+	case b.failed():
+		return "ERROR"
+	case b.succeeded():
+		return "INFO"
+	}
+	return "NOTICE"
+}
+
+// color is the attachment color: green for passed builds, red for failed.
+func (b *buildNotification) color() string {
+	switch {
+	case b.failed():
+		return buildColorFailure
+	case b.succeeded():
+		return buildColorSuccess
+	}
+	return ""
+}
+
+// link is the build's log page, or its console page when the notification
+// carries none.
+func (b *buildNotification) link() string {
+	if b.LogURL != "" {
+		return b.LogURL
+	}
+	if b.ProjectID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://console.cloud.google.com/cloud-build/builds/%s?project=%s", url.PathEscape(b.ID), url.QueryEscape(b.ProjectID))
+}
+
+func formatBuildNotification(b *buildNotification) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "[%s] Cloud Build: %s", b.severity(), b.Status)
+	if repo := b.Substitutions["REPO_NAME"]; repo != "" {
+		fmt.Fprintf(&s, " %s", repo)
+	}
+	fmt.Fprintf(&s, "\nbuild: `%s`", b.ID)
+	trigger := b.Substitutions["TRIGGER_NAME"]
+	if trigger == "" {
+		trigger = b.BuildTriggerID
+	}
+	if trigger != "" {
+		fmt.Fprintf(&s, "\ntrigger: `%s`", trigger)
+	}
+	if branch := b.Substitutions["BRANCH_NAME"]; branch != "" {
+		fmt.Fprintf(&s, "\nbranch: `%s`", branch)
+		if sha := b.Substitutions["SHORT_SHA"]; sha != "" {
+			fmt.Fprintf(&s, " @ `%s`", sha)
+		}
+	} else if tag := b.Substitutions["TAG_NAME"]; tag != "" {
+		fmt.Fprintf(&s, "\ntag: `%s`", tag)
+	}
+	fmt.Fprintf(&s, "\nstatus: *%s*", b.Status)
+	if b.StatusDetail != "" {
+		fmt.Fprintf(&s, " - %s", b.StatusDetail)
+	}
+	if !b.StartTime.IsZero() && b.FinishTime.After(b.StartTime) {
+		fmt.Fprintf(&s, "\nduration: %s", b.FinishTime.Sub(b.StartTime).Round(time.Second))
+	}
+	if link := b.link(); link != "" {
+		fmt.Fprintf(&s, "\n<%s|Open build>", link)
+	}
+	return s.String()
+}
+
+// buildStatusPosted reports whether notifications with status are posted.
+func buildStatusPosted(status string) bool {
+	spec := setting("SLACK_BUILD_STATUSES")
+	if spec == "" {
+		spec = defaultBuildStatuses
+	}
+	for _, s := range strings.Split(spec, ",") {
+		if strings.EqualFold(strings.TrimSpace(s), status) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleBuildNotification posts a Cloud Build status change.
+func handleBuildNotification(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, m PubSubMessage, b *buildNotification) error {
+	if !buildStatusPosted(b.Status) {
+		reqLog.Debug("build status not posted", map[string]any{"buildId": b.ID, "status": b.Status})
+		return nil
+	}
+
+	severity := b.severity()
+	countMetric(reqLog, metricReceived, map[string]string{"severity": severity})
+	alert := newAlert(severity, redact(formatBuildNotification(b)), nil)
+	alert.Fingerprint = "build-" + b.ID + "-" + b.Status
+	alert.Color = b.color()
+	now := time.Now()
+	recordRecent(alert, now, "")
+	countAlertStats(ctx, reqLog, alert, now)
+
+	dests := parseDestinations(setting("SLACK_BUILD_CHANNEL_ID"))
+	if len(dests) == 0 {
+		dests = routeForSeverity(severity, b.ProjectID, projectEnvironment(b.ProjectID))
+	}
+	return fanOut(ctx, reqLog, notifier, m, dests, alert)
+}
+
+// formatBuildLog renders build step output from the "cloudbuild" log with
+// the build and trigger it belongs to and a link to the build.
+func formatBuildLog(e *LogEntry) (string, bool) {
+	if e.Resource.Type != "build" {
+		return "", false
+	}
+	id := e.Resource.Labels["build_id"]
+	if id == "" {
+		return "", false
+	}
+	b := &buildNotification{ID: id, ProjectID: e.Resource.Labels["project_id"], BuildTriggerID: e.Resource.Labels["build_trigger_id"]}
+
+	var s strings.Builder
+	s.WriteString(formatHeader(e))
+	fmt.Fprintf(&s, "\nCloud Build: `%s`", b.ID)
+	if b.BuildTriggerID != "" {
+		fmt.Fprintf(&s, " trigger: `%s`", b.BuildTriggerID)
+	}
+	if step := e.Labels["build_step"]; step != "" {
+		fmt.Fprintf(&s, " step: `%s`", step)
+	}
+	if e.TextPayload != "" {
+		fmt.Fprintf(&s, "\n%s", e.TextPayload)
+	} else if message := payloadString(e, "message"); message != "" {
+		fmt.Fprintf(&s, "\n%s", message)
+	}
+	if link := b.link(); link != "" {
+		fmt.Fprintf(&s, "\n<%s|Open build>", link)
+	}
+	return s.String(), true
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Routes may name Slack channels instead of giving their IDs, e.g.
+// "#alerts-prod" or "eng/#alerts-prod". Names are resolved through
+// conversations.list (scopes channels:read, and groups:read for private
+// channels) and cached per workspace for SLACK_CHANNEL_CACHE_TTL (default
+// 1h). The bot joins public channels it is not in yet, named or not (scope
+// channels:join); private channels only list once the bot was invited, so
+// an unknown name or a private channel without the bot fails with an error
+// that says so.
+
+const (
+	defaultChannelCacheTTL = time.Hour
+	// channelMissRefresh bounds conversations.list calls for names that
+	// are not found, e.g. a typo in a route.
+	channelMissRefresh  = time.Minute
+	channelListPageSize = 1000
+)
+
+type channelInfo struct {
+	id      string
+	private bool
+	member  bool
+}
+
+// channelDirectory caches a workspace's channels by name.
+type channelDirectory struct {
+	mu       sync.Mutex
+	byName   map[string]channelInfo
+	joined   map[string]bool // channel IDs the bot is known to be in
+	loadedAt time.Time
+}
+
+// lookup returns the channel named name, listing the workspace's channels
+// when the cache is stale or, at most once per channelMissRefresh, when the
+// name is unknown.
+func (d *channelDirectory) lookup(ctx context.Context, api SlackAPI, name string, now time.Time) (channelInfo, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	info, ok := d.byName[name]
+	age := now.Sub(d.loadedAt)
+	if (ok && age < channelCacheTTL()) || (!ok && age < channelMissRefresh) {
+		return info, ok, nil
+	}
+	byName := map[string]channelInfo{}
+	params := &slack.GetConversationsParameters{
+		ExcludeArchived: true,
+		Limit:           channelListPageSize,
+		Types:           []string{"public_channel", "private_channel"},
+	}
+	for {
+		channels, cursor, err := api.GetConversationsContext(ctx, params)
+		if err != nil {
+			return channelInfo{}, false, describeSlackError(err)
+		}
+		for _, c := range channels {
+			byName[c.Name] = channelInfo{id: c.ID, private: c.IsPrivate, member: c.IsMember}
+		}
+		if cursor == "" {
+			break
+		}
+		params.Cursor = cursor
+	}
+	d.byName, d.loadedAt = byName, now
+	info, ok = byName[name]
+	return info, ok, nil
+}
+
+func (d *channelDirectory) isJoined(channelID string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.joined[channelID]
+}
+
+func (d *channelDirectory) markJoined(channelID string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.joined == nil {
+		d.joined = map[string]bool{}
+	}
+	d.joined[channelID] = true
+}
+
+func channelCacheTTL() time.Duration {
+	if d, err := time.ParseDuration(setting("SLACK_CHANNEL_CACHE_TTL")); err == nil && d > 0 {
+		return d
+	}
+	return defaultChannelCacheTTL
+}
+
+// resolveChannel returns the ID of a "#name" channel, joining it when the
+// bot is not a member yet. Anything else is taken to be an ID already.
+func (n *Notifier) resolveChannel(ctx context.Context, api SlackAPI, channel string) (string, error) {
+	name, ok := strings.CutPrefix(channel, "#")
+	if !ok {
+		return channel, nil
+	}
+	info, found, err := n.channels.lookup(ctx, api, name, time.Now())
+	if err != nil {
+		return "", fmt.Errorf("looking up slack channel #%s: %w", name, err)
+	}
+	if !found {
+		return "", &SlackError{Code: "channel_not_found", Permanent: true, msg: fmt.Sprintf(
+			"slack channel #%s not found: check the name, or invite the bot with /invite if the channel is private", name)}
+	}
+	if !info.member && !n.channels.isJoined(info.id) {
+		if err := n.joinChannel(ctx, api, info.id); err != nil {
+			return "", err
+		}
+	}
+	return info.id, nil
+}
+
+// joinChannel joins a public channel so the bot can post there.
+func (n *Notifier) joinChannel(ctx context.Context, api SlackAPI, channelID string) error {
+	if _, _, _, err := api.JoinConversationContext(ctx, channelID); err != nil {
+		err = describeSlackError(err)
+		if isSlackErrorCode(err, "method_not_supported_for_channel_type") || isSlackErrorCode(err, "channel_not_found") {
+			return &SlackError{Code: "not_in_channel", Permanent: true, msg: fmt.Sprintf(
+				"bot is not in slack channel %s and cannot join it: invite it with /invite if the channel is private", channelID)}
+		}
+		if isSlackErrorCode(err, "missing_scope") {
+			return &SlackError{Code: "missing_scope", Permanent: true, msg: fmt.Sprintf(
+				"bot cannot join slack channel %s: add the channels:join scope or invite it with /invite", channelID)}
+		}
+		return err
+	}
+	n.channels.markJoined(channelID)
+	return nil
+}
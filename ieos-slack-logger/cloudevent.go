@@ -0,0 +1,28 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cloudevents/sdk-go/v2/event"
+)
+
+// MessagePublishedData is the data of a google.cloud.pubsub.topic.v1.messagePublished
+// CloudEvent, as delivered by Eventarc and 2nd-gen Cloud Functions.
+// See: https://cloud.google.com/eventarc/docs/cloudevents#pubsub
+type MessagePublishedData struct {
+	Message      PubSubMessage `json:"message"`
+	Subscription string        `json:"subscription"`
+}
+
+// HandleLogAlertCloudEvent is the CloudEvent entry point for 2nd-gen Cloud
+// Functions and Cloud Run Eventarc triggers (--entry-point=HandleLogAlertCloudEvent).
+// It unwraps the Pub/Sub envelope and delegates to HandleLogAlert.
+func HandleLogAlertCloudEvent(ctx context.Context, e event.Event) error {
+	var data MessagePublishedData
+	if err := e.DataAs(&data); err != nil {
+		getLogger(ctx).ForRequest(ctx, nil).Error("failed to decode cloudevent data", err, map[string]any{"eventId": e.ID(), "type": e.Type()})
+		return fmt.Errorf("event.DataAs: %w", err)
+	}
+	return HandleLogAlert(ctx, data.Message)
+}
@@ -0,0 +1,162 @@
+// Command replay runs LogEntry JSON through HandleLogAlert locally, so
+// formatting and routing changes can be checked before a deploy.
+//
+// Usage:
+//
+//	replay [-post] [-channel <target>] [-blocks] [file ...]
+//
+// Each file (or stdin when none is given, or for "-") holds a single
+// LogEntry, newline-delimited entries, or the JSON array printed by
+//
+//	gcloud logging read '<filter>' --format=json
+//
+// Routing and formatting are configured from the environment exactly as in
+// the deployed service. -channel sends every entry to one target instead of
+// the SLACK_*_CHANNEL_ID routes.
+//
+// By default Slack is replaced by a recording fake and the messages that
+// would have been posted are printed. -post sends them to Slack with the
+// SLACK_BOT_TOKEN[_<NAME>] tokens instead. Sink targets (webhook:, email:,
+// ...) in the routes are always called; use -channel to keep them out.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	service "github.com/print-engine/ieos-golang-utils/ieos-slack-logger"
+	"github.com/print-engine/ieos-golang-utils/ieos-slack-logger/slacktest"
+)
+
+func main() {
+	post := flag.Bool("post", false, "post to Slack instead of printing")
+	channel := flag.String("channel", "", "send every entry to this target instead of the configured routes")
+	blocks := flag.Bool("blocks", false, "also print the Block Kit payload of each message")
+	flag.Parse()
+
+	if *channel != "" {
+		for _, key := range []string{"SLACK_ERROR_CHANNEL_ID", "SLACK_WARNING_CHANNEL_ID", "SLACK_DEFAULT_CHANNEL_ID"} {
+			os.Setenv(key, *channel)
+		}
+	}
+
+	ctx := context.Background()
+	var fake *slacktest.Fake
+	if !*post {
+		fake = slacktest.New()
+		n, err := service.NewNotifier(ctx, service.NotifierConfig{API: fake, SkipAuthTest: true})
+		if err != nil {
+			log.Fatalf("fake notifier: %v", err)
+		}
+		byName := map[string]*service.Notifier{"": n}
+		for _, name := range strings.Split(os.Getenv("SLACK_WORKSPACES"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				byName[name] = n
+			}
+		}
+		service.UseWorkspaces(service.NewWorkspaces(byName))
+	}
+
+	files := flag.Args()
+	if len(files) == 0 {
+		files = []string{"-"}
+	}
+	failed := 0
+	for _, file := range files {
+		entries, err := readEntries(file)
+		if err != nil {
+			log.Fatalf("%s: %v", file, err)
+		}
+		for i, raw := range entries {
+			fmt.Printf("=== %s #%d\n", file, i+1)
+			if err := service.HandleLogAlert(ctx, service.PubSubMessage{Data: raw}); err != nil {
+				fmt.Printf("error: %v\n", err)
+				failed++
+			}
+			if fake != nil {
+				printMessages(fake, *blocks)
+				fake.Reset()
+			}
+		}
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readEntries returns the LogEntry objects in file: a JSON array, or one
+// or more concatenated objects.
+func readEntries(file string) ([]json.RawMessage, error) {
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(br)
+	var entries []json.RawMessage
+	if first == '[' {
+		if err := dec.Decode(&entries); err != nil {
+			return nil, err
+		}
+		return entries, nil
+	}
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return entries, nil
+		} else if err != nil {
+			return nil, err
+		}
+		entries = append(entries, raw)
+	}
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.ContainsRune([]byte(" \t\r\n"), rune(b)) {
+			return b, br.UnreadByte()
+		}
+	}
+}
+
+func printMessages(fake *slacktest.Fake, blocks bool) {
+	msgs := fake.Messages()
+	if len(msgs) == 0 && len(fake.Uploads()) == 0 {
+		fmt.Println("(nothing posted to Slack)")
+	}
+	for _, m := range msgs {
+		fmt.Printf("--> %s", m.Channel)
+		if m.ThreadTS != "" {
+			fmt.Printf(" (thread %s)", m.ThreadTS)
+		}
+		fmt.Printf("\n%s\n", m.Text)
+		if blocks && len(m.Blocks) > 0 {
+			out, _ := json.MarshalIndent(m.Blocks, "", "  ")
+			fmt.Printf("%s\n", out)
+		}
+	}
+	for _, u := range fake.Uploads() {
+		fmt.Printf("--> %s: snippet %s (%d bytes)\n", u.Channel, u.Filename, u.FileSize)
+	}
+}
@@ -0,0 +1,117 @@
+// Command server runs the Slack logger as a plain HTTP service (e.g. on
+// Cloud Run) behind a Pub/Sub push subscription.
+//
+// Environment:
+//
+//	PORT                  listen port (default 8080)
+//	PUSH_AUDIENCE         expected OIDC audience of the push subscription
+//	PUSH_SERVICE_ACCOUNT  optional; expected service account email
+//	PUSH_AUTH_DISABLED    set to "true" to skip token checks (local only)
+//	SLACK_SIGNING_SECRET  verifies Slack interactivity requests, served at
+//	                      /slack/interactions, the /ieos-alerts slash
+//	                      command at /slack/commands and Events API
+//	                      callbacks at /slack/events
+//	DASHBOARD_TOKEN       serves the recent alerts dashboard at /dashboard
+//	                      to requests with this bearer token or basic auth
+//	                      password
+//	DASHBOARD_AUTH_DISABLED  set to "true" to serve the dashboard without a
+//	                      token (local only); PUSH_AUTH_DISABLED does not
+//	                      open it
+//	PULL_SUBSCRIPTION     optional; also pulls log entries from this
+//	                      subscription ("projects/<p>/subscriptions/<s>" or
+//	                      an ID in GOOGLE_CLOUD_PROJECT)
+//
+// Push deliveries and pulled messages share a pool of SLACK_WORKERS workers.
+//
+// A Cloud Scheduler job should call /scheduled every minute, with an OIDC
+// token for PUSH_AUDIENCE, to run escalations and heartbeats.
+//
+// On SIGTERM the server stops taking push deliveries and pulled messages
+// (they are nacked and redelivered elsewhere), finishes the ones in flight
+// and flushes buffered digests within Cloud Run's 10s grace period.
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	service "github.com/print-engine/ieos-golang-utils/ieos-slack-logger"
+)
+
+// shutdownTimeout stays within the 10s Cloud Run allows after SIGTERM.
+const shutdownTimeout = 8 * time.Second
+
+func main() {
+	cfg := service.PushConfig{
+		Audience:            os.Getenv("PUSH_AUDIENCE"),
+		ServiceAccountEmail: os.Getenv("PUSH_SERVICE_ACCOUNT"),
+		SkipAuth:            os.Getenv("PUSH_AUTH_DISABLED") == "true",
+	}
+	h, err := service.NewPushHandler(cfg)
+	if err != nil {
+		log.Fatalf("push handler: %v", err)
+	}
+	scheduled, err := service.NewSchedulerHandler(cfg)
+	if err != nil {
+		log.Fatalf("scheduler handler: %v", err)
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	mux.HandleFunc("/slack/interactions", service.HandleSlackInteraction)
+	mux.HandleFunc("/slack/commands", service.HandleSlackCommand)
+	mux.HandleFunc("/slack/events", service.HandleSlackEvent)
+	mux.Handle("/scheduled", scheduled)
+	dashboardOpen := os.Getenv("DASHBOARD_AUTH_DISABLED") == "true"
+	if token := os.Getenv("DASHBOARD_TOKEN"); token != "" || dashboardOpen {
+		dashboard, err := service.NewDashboardHandler(service.DashboardConfig{Token: token, SkipAuth: dashboardOpen && token == ""})
+		if err != nil {
+			log.Fatalf("dashboard handler: %v", err)
+		}
+		mux.Handle("/dashboard", dashboard)
+	}
+
+	receiveCtx, stopReceiving := context.WithCancel(context.Background())
+	if sub := os.Getenv("PULL_SUBSCRIPTION"); sub != "" {
+		go func() {
+			if err := service.ReceiveSubscription(receiveCtx, sub); err != nil {
+				log.Fatalf("pull %s: %v", sub, err)
+			}
+		}()
+	}
+
+	srv := &http.Server{Addr: ":" + port, Handler: mux}
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGTERM, os.Interrupt)
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-stop
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := service.Shutdown(ctx); err != nil {
+			log.Printf("shutdown: %v", err)
+		}
+		stopReceiving()
+		if err := srv.Shutdown(ctx); err != nil {
+			log.Printf("http shutdown: %v", err)
+		}
+	}()
+
+	log.Printf("listening on :%s", port)
+	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+	// ListenAndServe returns as soon as shutdown starts
+	<-stopped
+}
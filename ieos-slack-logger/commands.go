@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// The /ieos-alerts slash command lets on-call engineers manage noise from
+// Slack:
+//
+//	/ieos-alerts recent [service]             latest alerts (of this instance
+//	                                          unless the alert history is set)
+//	/ieos-alerts silence <pattern> <duration> mute alerts containing pattern
+//	/ieos-alerts unsilence [pattern]          lift a silence, or list them
+//
+// A pattern may contain spaces; the duration is always the last word.
+
+const (
+	slashCommandName   = "/ieos-alerts"
+	recentCommandLimit = 10
+)
+
+const commandUsage = "Usage:\n" +
+	"• `" + slashCommandName + " recent [service]`\n" +
+	"• `" + slashCommandName + " silence <pattern> <duration>` (e.g. `silence quota exceeded 2h`)\n" +
+	"• `" + slashCommandName + " unsilence [pattern]`"
+
+// NewCommandHandler returns an http.Handler for the /ieos-alerts slash
+// command request URL. Requests are verified like interactivity requests.
+func NewCommandHandler(cfg InteractionConfig) (http.Handler, error) {
+	if len(cfg.SigningSecrets) == 0 {
+		return nil, fmt.Errorf("at least one slack signing secret is required")
+	}
+	return VerifySlackRequests(cfg.SigningSecrets, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		reqLog := getLogger(ctx).ForRequest(ctx, r)
+
+		cmd, err := slack.SlashCommandParse(r)
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		reply, err := runCommand(ctx, cmd, time.Now().UTC())
+		if err != nil {
+			reqLog.Error("slash command failed", err, map[string]any{"text": cmd.Text, "user": cmd.UserID})
+			reply = &slack.Msg{ResponseType: slack.ResponseTypeEphemeral, Text: fmt.Sprintf(":warning: %v", err)}
+		} else {
+			reqLog.Info("slash command handled", map[string]any{"text": cmd.Text, "user": cmd.UserID, "channel": cmd.ChannelID})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(reply)
+	})), nil
+}
+
+// runCommand executes the slash command text. Changes to silences are
+// announced in the channel; everything else is only shown to the caller.
+func runCommand(ctx context.Context, cmd slack.SlashCommand, now time.Time) (*slack.Msg, error) {
+	ephemeral := func(text string) *slack.Msg {
+		return &slack.Msg{ResponseType: slack.ResponseTypeEphemeral, Text: text}
+	}
+	args := strings.Fields(cmd.Text)
+	if len(args) == 0 {
+		return ephemeral(commandUsage), nil
+	}
+	store, _ := getSilences()
+
+	switch strings.ToLower(args[0]) {
+	case "recent":
+		filter := strings.Join(args[1:], " ")
+		if h, _ := getHistory(); h != nil {
+			alerts, err := h.latest(ctx, filter, recentCommandLimit)
+			if err != nil {
+				return nil, err
+			}
+			return ephemeral(formatRecent(alerts)), nil
+		}
+		return ephemeral(formatRecent(recentAlerts.latest(filter, recentCommandLimit))), nil
+
+	case "silence":
+		if len(args) < 3 {
+			return ephemeral(commandUsage), nil
+		}
+		d, err := time.ParseDuration(args[len(args)-1])
+		if err != nil || d <= 0 || d > maxSilenceDuration {
+			return ephemeral(fmt.Sprintf("Invalid duration %q: use e.g. 30m or 4h, up to %s.", args[len(args)-1], maxSilenceDuration)), nil
+		}
+		rec := silenceRecord{
+			Pattern:   strings.Join(args[1:len(args)-1], " "),
+			CreatedBy: cmd.UserID,
+			CreatedAt: now,
+			Until:     now.Add(d),
+			ExpireAt:  now.Add(d),
+		}
+		if err := store.add(ctx, rec); err != nil {
+			return nil, err
+		}
+		return &slack.Msg{
+			ResponseType: slack.ResponseTypeInChannel,
+			Text:         fmt.Sprintf(":no_bell: <@%s> silenced alerts matching `%s` until %s", cmd.UserID, rec.Pattern, slackDate(rec.Until)),
+		}, nil
+
+	case "unsilence":
+		if len(args) == 1 {
+			active, err := store.list(ctx, now)
+			if err != nil {
+				return nil, err
+			}
+			return ephemeral(formatSilences(active)), nil
+		}
+		pattern := strings.Join(args[1:], " ")
+		found, err := store.remove(ctx, pattern, now)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return ephemeral(fmt.Sprintf("No active silence for `%s`.", pattern)), nil
+		}
+		return &slack.Msg{
+			ResponseType: slack.ResponseTypeInChannel,
+			Text:         fmt.Sprintf(":bell: <@%s> lifted the silence on `%s`", cmd.UserID, pattern),
+		}, nil
+	}
+	return ephemeral(commandUsage), nil
+}
+
+func formatRecent(alerts []recentAlert) string {
+	if len(alerts) == 0 {
+		return "No recent alerts."
+	}
+	var b strings.Builder
+	b.WriteString("Recent alerts:")
+	for _, r := range alerts {
+		fmt.Fprintf(&b, "\n• %s %s", slackDate(r.At), r.Title)
+		if r.Service != "" {
+			fmt.Fprintf(&b, " (`%s`)", r.Service)
+		}
+		if r.Muted != "" {
+			fmt.Fprintf(&b, " _%s_", r.Muted)
+		}
+		if r.Headline != "" {
+			fmt.Fprintf(&b, "\n    %s", r.Headline)
+		}
+	}
+	return b.String()
+}
+
+func formatSilences(active []silenceRecord) string {
+	if len(active) == 0 {
+		return "No active silences.\n" + commandUsage
+	}
+	var b strings.Builder
+	b.WriteString("Active silences:")
+	for _, rec := range active {
+		fmt.Fprintf(&b, "\n• `%s` until %s (by <@%s>)", rec.Pattern, slackDate(rec.Until), rec.CreatedBy)
+	}
+	return b.String()
+}
+
+// HandleSlackCommand is the HTTP Cloud Function for the /ieos-alerts slash
+// command, configured from SLACK_SIGNING_SECRET[_<NAME>].
+func HandleSlackCommand(w http.ResponseWriter, r *http.Request) {
+	reloadConfig(r.Context(), getLogger(r.Context()).ForRequest(r.Context(), r), time.Now())
+	h, err := NewCommandHandler(InteractionConfig{SigningSecrets: signingSecretsFromEnv()})
+	if err != nil {
+		getLogger(r.Context()).ForRequest(r.Context(), r).Error("slack slash command not configured", err)
+		http.Error(w, "not configured", http.StatusServiceUnavailable)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
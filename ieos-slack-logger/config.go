@@ -0,0 +1,548 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"cloud.google.com/go/logging"
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	storage "google.golang.org/api/storage/v1"
+	"gopkg.in/yaml.v3"
+)
+
+// SLACK_CONFIG points at a YAML config file that takes precedence over the
+// environment: a local path, a GCS object ("gs://bucket/object") or a Secret
+// Manager version ("projects/p/secrets/s/versions/latest"):
+//
+//	routes:
+//	  error: [C0123456, "webhook:pagerduty>=CRITICAL"]
+//	  warning: [C0456789]
+//	  default: [C0789012|payments]
+//	projects:            # per-project routes, by project ID
+//	  my-staging:
+//	    default: [C0STAGING]
+//	environments: {acme-prod: prod, acme-staging: staging}
+//	environment_label: env
+//	environment_routes:  # per-environment routes, by environment name
+//	  staging:
+//	    default: [C0STAGING]
+//	budgets:
+//	  default: 60/10m
+//	  channels: {C0123456: 30/10m}
+//	  bypass_severity: CRITICAL
+//	quiet_windows: ["mon-fri 19:00-07:00 America/Chicago"]
+//	quiet_bypass_severity: CRITICAL
+//	named_quiet_windows: # for destinations with quiet=<name>
+//	  payments: ["mon-fri 19:00-07:00 Europe/Berlin"]
+//	severity_emoji: {ERROR: sev-error}
+//	resource_labels: [service_name, location]
+//	headline_fields: [jsonPayload.message, jsonPayload.job.id]
+//	redact_patterns: ['cust-[0-9]{8}']
+//	severity_rules:
+//	  - {log: payments-worker, from: WARNING, to: ERROR}
+//	  - {log: run.googleapis.com/stderr, from: ERROR, to: NOTICE, match: cache warm-up}
+//	grouping_rules:
+//	  - {log: payments, key: "resource.labels.service_name + ':' + jsonPayload.errorCode"}
+//	templates:
+//	  payments: |
+//	    [{{.Severity}}] {{.Service}}
+//	    {{.Message}}
+//	sinks:
+//	  webhook:
+//	    pagerduty: {url: "https://...", secret: "..."}
+//	  email:
+//	    oncall: {from: alerts@example.com, to: [oncall@example.com]}
+//	settings:            # any other setting, by its env name
+//	  SLACK_DIGEST_INTERVAL: 15m
+//
+// Each section stands in for the env vars documented with its feature, e.g.
+// sinks.webhook.pagerduty.url for WEBHOOK_PAGERDUTY_URL. The config is
+// validated on load and re-read every SLACK_CONFIG_REFRESH_INTERVAL (default
+// 1m); a changed config that fails validation is logged and the previous one
+// is kept. Routes, environments, budgets, quiet windows, emoji, resource
+// labels, headline fields, redaction, severity and grouping rules, templates
+// and sinks take effect on reload; other settings are read once per instance.
+
+const defaultConfigRefreshInterval = time.Minute
+
+// routeConfig is the routes section of the YAML config.
+type routeConfig struct {
+	Error   []string `yaml:"error"`
+	Warning []string `yaml:"warning"`
+	Default []string `yaml:"default"`
+}
+
+// severityRuleConfig is an entry of the severity_rules section.
+type severityRuleConfig struct {
+	Log   string `yaml:"log"`
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+	Match string `yaml:"match"`
+}
+
+// groupingRuleConfig is an entry of the grouping_rules section.
+type groupingRuleConfig struct {
+	Log string `yaml:"log"`
+	Key string `yaml:"key"`
+}
+
+// fileConfig is the YAML config layout.
+type fileConfig struct {
+	Routes            routeConfig            `yaml:"routes"`
+	Projects          map[string]routeConfig `yaml:"projects"`
+	Environments      map[string]string      `yaml:"environments"`
+	EnvironmentLabel  string                 `yaml:"environment_label"`
+	EnvironmentRoutes map[string]routeConfig `yaml:"environment_routes"`
+	Budgets           struct {
+		Default        string            `yaml:"default"`
+		Channels       map[string]string `yaml:"channels"`
+		BypassSeverity string            `yaml:"bypass_severity"`
+	} `yaml:"budgets"`
+	QuietWindows        []string                             `yaml:"quiet_windows"`
+	QuietBypassSeverity string                               `yaml:"quiet_bypass_severity"`
+	NamedQuietWindows   map[string][]string                  `yaml:"named_quiet_windows"`
+	SeverityEmoji       map[string]string                    `yaml:"severity_emoji"`
+	ResourceLabels      []string                             `yaml:"resource_labels"`
+	HeadlineFields      []string                             `yaml:"headline_fields"`
+	RedactPatterns      []string                             `yaml:"redact_patterns"`
+	SeverityRules       []severityRuleConfig                 `yaml:"severity_rules"`
+	GroupingRules       []groupingRuleConfig                 `yaml:"grouping_rules"`
+	Templates           map[string]string                    `yaml:"templates"`
+	Sinks               map[string]map[string]map[string]any `yaml:"sinks"`
+	Settings            map[string]string                    `yaml:"settings"`
+}
+
+// configError collects validation problems with their location in the file.
+type configError []string
+
+func (e configError) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+func (e *configError) addf(path, format string, args ...any) {
+	*e = append(*e, path+": "+fmt.Sprintf(format, args...))
+}
+
+func validSeverity(s string) bool {
+	return strings.EqualFold(s, "DEFAULT") || logging.ParseSeverity(s) != logging.Default
+}
+
+// parseConfig validates a YAML config and flattens it into settings keyed by
+// env name.
+func parseConfig(data []byte) (map[string]string, error) {
+	var fc fileConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
+	var errs configError
+	out := map[string]string{}
+	for key, v := range fc.Settings {
+		if !strings.HasPrefix(key, "SLACK_") {
+			errs.addf("settings."+key, "expected a SLACK_* setting name")
+			continue
+		}
+		for _, suffix := range []string{"_INTERVAL", "_AFTER", "_FOR", "_COOLDOWN"} {
+			if d, err := time.ParseDuration(v); strings.HasSuffix(key, suffix) && (err != nil || d <= 0) {
+				errs.addf("settings."+key, "%q is not a positive duration", v)
+			}
+		}
+		out[key] = v
+	}
+
+	for name, src := range fc.Templates {
+		if _, err := template.New(name).Funcs(templateFuncs).Parse(src); err != nil {
+			errs.addf("templates."+name, "%v", err)
+		}
+		out["SLACK_TEMPLATE_"+envName(name)] = src
+	}
+
+	for name, specs := range fc.NamedQuietWindows {
+		for i, spec := range specs {
+			if _, err := parseQuietWindow(spec); err != nil {
+				errs.addf(fmt.Sprintf("named_quiet_windows.%s[%d]", name, i), "%v", err)
+			}
+		}
+		out["SLACK_QUIET_WINDOWS_"+envName(name)] = strings.Join(specs, ";")
+	}
+
+	for kind, byName := range fc.Sinks {
+		if _, ok := sinkFactories[kind]; !ok {
+			errs.addf("sinks."+kind, "unknown sink kind")
+			continue
+		}
+		for name, fields := range byName {
+			for field, v := range fields {
+				out[strings.ToUpper(kind)+"_"+envName(name)+"_"+envName(field)] = settingValue(v)
+			}
+		}
+	}
+
+	addRoutes := func(prefix, suffix string, rc routeConfig) {
+		routes := []struct {
+			name, key string
+			dests     []string
+		}{
+			{"error", "SLACK_ERROR_CHANNEL_ID", rc.Error},
+			{"warning", "SLACK_WARNING_CHANNEL_ID", rc.Warning},
+			{"default", "SLACK_DEFAULT_CHANNEL_ID", rc.Default},
+		}
+		for _, r := range routes {
+			if len(r.dests) == 0 {
+				continue
+			}
+			for i, spec := range r.dests {
+				path := fmt.Sprintf("%s.%s[%d]", prefix, r.name, i)
+				if _, min, ok := strings.Cut(spec, ">="); ok && !validSeverity(strings.TrimSpace(min)) {
+					errs.addf(path, "unknown severity %q", strings.TrimSpace(min))
+				}
+				if target, _, _ := strings.Cut(spec, ">="); strings.Contains(target, ";") {
+					for _, opt := range strings.Split(target, ";")[1:] {
+						opt = strings.TrimSpace(opt)
+						if name, ok := quietOption(opt); ok {
+							key := "SLACK_QUIET_WINDOWS_" + envName(name)
+							if _, ok := out[key]; !ok && os.Getenv(key) == "" {
+								errs.addf(path, "quiet window %q is not defined", name)
+							}
+						} else if _, ok := destinationOptions[strings.ToLower(opt)]; !ok {
+							errs.addf(path, "unknown option %q", opt)
+						}
+					}
+				}
+				dests := parseDestinations(spec)
+				if len(dests) != 1 || dests[0].Target == "" {
+					errs.addf(path, "expected one destination, got %q", spec)
+					continue
+				}
+				d := dests[0]
+				if d.Template != "" {
+					key := "SLACK_TEMPLATE_" + envName(d.Template)
+					if _, ok := out[key]; !ok && os.Getenv(key) == "" {
+						errs.addf(path, "template %q is not defined", d.Template)
+					}
+				}
+				if kind, name, ok := sinkTarget(d.Target); ok && fc.Sinks[kind][name] == nil && !envHasPrefix(strings.ToUpper(kind)+"_"+envName(name)+"_") {
+					errs.addf(path, "sink %s is not configured", d.Target)
+				}
+			}
+			out[r.key+suffix] = strings.Join(r.dests, ",")
+		}
+	}
+	addRoutes("routes", "", fc.Routes)
+	for project, rc := range fc.Projects {
+		addRoutes("projects."+project, "_"+envName(project), rc)
+	}
+	for env, rc := range fc.EnvironmentRoutes {
+		addRoutes("environment_routes."+env, "_"+envName(env), rc)
+	}
+	if len(fc.Environments) > 0 {
+		projects := make([]string, 0, len(fc.Environments))
+		for project := range fc.Environments {
+			projects = append(projects, project)
+		}
+		sort.Strings(projects)
+		pairs := make([]string, 0, len(projects))
+		for _, project := range projects {
+			pairs = append(pairs, project+"="+fc.Environments[project])
+		}
+		out["SLACK_ENVIRONMENTS"] = strings.Join(pairs, ",")
+	}
+	if fc.EnvironmentLabel != "" {
+		out["SLACK_ENVIRONMENT_LABEL"] = fc.EnvironmentLabel
+	}
+
+	if b := fc.Budgets; b.Default != "" || len(b.Channels) > 0 {
+		if b.Default != "" {
+			if _, err := parsePostBudget(b.Default); err != nil {
+				errs.addf("budgets.default", "%v", err)
+			}
+			out["SLACK_CHANNEL_BUDGET_DEFAULT"] = b.Default
+		}
+		targets := make([]string, 0, len(b.Channels))
+		for target, budget := range b.Channels {
+			if _, err := parsePostBudget(budget); err != nil {
+				errs.addf("budgets.channels."+target, "%v", err)
+			}
+			targets = append(targets, target)
+		}
+		sort.Strings(targets)
+		pairs := make([]string, 0, len(targets))
+		for _, target := range targets {
+			pairs = append(pairs, target+"="+b.Channels[target])
+		}
+		out["SLACK_CHANNEL_BUDGETS"] = strings.Join(pairs, ",")
+	}
+	if v := fc.Budgets.BypassSeverity; v != "" {
+		if !validSeverity(v) {
+			errs.addf("budgets.bypass_severity", "unknown severity %q", v)
+		}
+		out["SLACK_BUDGET_BYPASS_SEVERITY"] = v
+	}
+
+	if len(fc.QuietWindows) > 0 {
+		for i, spec := range fc.QuietWindows {
+			if _, err := parseQuietWindow(spec); err != nil {
+				errs.addf(fmt.Sprintf("quiet_windows[%d]", i), "%v", err)
+			}
+		}
+		out["SLACK_QUIET_WINDOWS"] = strings.Join(fc.QuietWindows, ";")
+	}
+	if v := fc.QuietBypassSeverity; v != "" {
+		if !validSeverity(v) {
+			errs.addf("quiet_bypass_severity", "unknown severity %q", v)
+		}
+		out["SLACK_QUIET_BYPASS_SEVERITY"] = v
+	}
+
+	if len(fc.SeverityEmoji) > 0 {
+		pairs := make([]string, 0, len(fc.SeverityEmoji))
+		for sev, emoji := range fc.SeverityEmoji {
+			if !validSeverity(sev) {
+				errs.addf("severity_emoji."+sev, "unknown severity")
+			}
+			pairs = append(pairs, sev+"="+emoji)
+		}
+		sort.Strings(pairs)
+		out["SLACK_SEVERITY_EMOJI"] = strings.Join(pairs, ",")
+	}
+	if len(fc.ResourceLabels) > 0 {
+		out["SLACK_RESOURCE_LABELS"] = strings.Join(fc.ResourceLabels, ",")
+	}
+	if len(fc.HeadlineFields) > 0 {
+		out["SLACK_HEADLINE_FIELDS"] = strings.Join(fc.HeadlineFields, ",")
+	}
+	if len(fc.RedactPatterns) > 0 {
+		for i, p := range fc.RedactPatterns {
+			if _, err := regexp.Compile(p); err != nil {
+				errs.addf(fmt.Sprintf("redact_patterns[%d]", i), "%v", err)
+			}
+		}
+		out["SLACK_REDACT_PATTERNS"] = strings.Join(fc.RedactPatterns, "\n")
+	}
+
+	if len(fc.SeverityRules) > 0 {
+		lines := make([]string, 0, len(fc.SeverityRules))
+		for i, rc := range fc.SeverityRules {
+			logID, from := rc.Log, rc.From
+			if logID == "" {
+				logID = "*"
+			}
+			if from == "" {
+				from = "*"
+			}
+			line := fmt.Sprintf("%s %s=%s", logID, from, rc.To)
+			if rc.Match != "" {
+				line += " ~" + rc.Match
+			}
+			if _, err := parseSeverityRule(line); err != nil {
+				errs.addf(fmt.Sprintf("severity_rules[%d]", i), "%v", err)
+			}
+			lines = append(lines, line)
+		}
+		out["SLACK_SEVERITY_RULES"] = strings.Join(lines, "\n")
+	}
+	if len(fc.GroupingRules) > 0 {
+		lines := make([]string, 0, len(fc.GroupingRules))
+		for i, rc := range fc.GroupingRules {
+			logID := rc.Log
+			if logID == "" {
+				logID = "*"
+			}
+			line := logID + " " + strings.ReplaceAll(rc.Key, "\n", " ")
+			if _, err := parseGroupingRule(line); err != nil {
+				errs.addf(fmt.Sprintf("grouping_rules[%d]", i), "%v", err)
+			}
+			lines = append(lines, line)
+		}
+		out["SLACK_GROUPING_RULES"] = strings.Join(lines, "\n")
+	}
+
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return nil, errs
+	}
+	return out, nil
+}
+
+// settingValue renders a YAML scalar or list as an env value.
+func settingValue(v any) string {
+	if list, ok := v.([]any); ok {
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		return strings.Join(parts, ",")
+	}
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func envHasPrefix(prefix string) bool {
+	for _, kv := range os.Environ() {
+		if strings.HasPrefix(kv, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// readConfigSource reads the config from a path, GCS object or Secret
+// Manager version.
+func readConfigSource(ctx context.Context, source string) ([]byte, error) {
+	switch {
+	case strings.HasPrefix(source, "gs://"):
+		bucket, object, ok := strings.Cut(strings.TrimPrefix(source, "gs://"), "/")
+		if !ok || object == "" {
+			return nil, fmt.Errorf("invalid GCS object %q", source)
+		}
+		svc, err := storage.NewService(ctx)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := svc.Objects.Get(bucket, object).Context(ctx).Download()
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		return io.ReadAll(resp.Body)
+	case strings.HasPrefix(source, "projects/") && strings.Contains(source, "/secrets/"):
+		client, err := secretmanager.NewClient(ctx)
+		if err != nil {
+			return nil, err
+		}
+		defer client.Close()
+		resp, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: source})
+		if err != nil {
+			return nil, err
+		}
+		return resp.GetPayload().GetData(), nil
+	}
+	return os.ReadFile(source)
+}
+
+// loadedConfig is the active config file, flattened into settings.
+type loadedConfig struct {
+	settings map[string]string
+	sum      [sha256.Size]byte
+}
+
+var (
+	activeConfig     atomic.Pointer[loadedConfig]
+	configGeneration atomic.Uint64 // bumped on every change of the active config
+	configMu         sync.Mutex    // serializes loads
+	configCheckedAt  time.Time
+)
+
+// setting returns a setting from the config file, falling back to the
+// environment.
+func setting(key string) string {
+	if c := activeConfig.Load(); c != nil {
+		if v, ok := c.settings[key]; ok {
+			return v
+		}
+	}
+	return os.Getenv(key)
+}
+
+// loadConfig reads and validates the config file and activates it when it
+// changed. It reports whether the active config changed.
+func loadConfig(ctx context.Context, now time.Time) (bool, error) {
+	source := os.Getenv("SLACK_CONFIG")
+	if source == "" {
+		return false, nil
+	}
+	configMu.Lock()
+	defer configMu.Unlock()
+	configCheckedAt = now
+	data, err := readConfigSource(ctx, source)
+	if err != nil {
+		return false, fmt.Errorf("read %s: %w", source, err)
+	}
+	sum := sha256.Sum256(data)
+	if c := activeConfig.Load(); c != nil && c.sum == sum {
+		return false, nil
+	}
+	settings, err := parseConfig(data)
+	if err != nil {
+		return false, err
+	}
+	activeConfig.Store(&loadedConfig{settings: settings, sum: sum})
+	configGeneration.Add(1)
+	resetReloadableCaches()
+	return true, nil
+}
+
+// reloadConfig loads the config file on the first call and re-reads it when
+// the refresh interval has passed. Every entry point calls it before reading
+// settings. A config that fails to load falls back to the environment rather
+// than dropping alerts.
+func reloadConfig(ctx context.Context, reqLog *logger.RequestLogger, now time.Time) {
+	if os.Getenv("SLACK_CONFIG") == "" {
+		return
+	}
+	interval := defaultConfigRefreshInterval
+	if v, err := time.ParseDuration(os.Getenv("SLACK_CONFIG_REFRESH_INTERVAL")); err == nil && v > 0 {
+		interval = v
+	}
+	configMu.Lock()
+	due := now.Sub(configCheckedAt) >= interval
+	configMu.Unlock()
+	if !due {
+		return
+	}
+	changed, err := loadConfig(ctx, now)
+	if err != nil {
+		reqLog.Error("config reload failed, keeping the previous config", err, map[string]any{"source": os.Getenv("SLACK_CONFIG")})
+		return
+	}
+	if changed {
+		reqLog.Info("config reloaded", map[string]any{"source": os.Getenv("SLACK_CONFIG"), "summary": configSummary()})
+	}
+}
+
+// resetReloadableCaches drops the caches that do not follow configOnce.
+func resetReloadableCaches() {
+	templatesMu.Lock()
+	templates = map[string]*template.Template{}
+	templatesMu.Unlock()
+	sinksMu.Lock()
+	sinks = map[string]Sink{}
+	sinksMu.Unlock()
+}
+
+// configOnce is a sync.Once for hot-reloadable settings: it runs f again
+// after the config file changed.
+type configOnce struct {
+	mu   sync.Mutex
+	gen  uint64
+	done bool
+}
+
+func (o *configOnce) Do(f func()) {
+	gen := configGeneration.Load()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done && o.gen == gen {
+		return
+	}
+	o.done, o.gen = true, gen
+	f()
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"cloud.google.com/go/logging/logadmin"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/slack-go/slack"
+	"google.golang.org/api/iterator"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Setting SLACK_CONTEXT_LINES (e.g. 5) looks up that many entries written
+// just before and just after an alert's entry by the same resource, within
+// SLACK_CONTEXT_WINDOW (default 30s) of it, and posts them as a code block
+// in the alert's thread, so responders see what led up to the failure
+// without leaving Slack. Entries are read with the Cloud Logging API, which
+// needs roles/logging.viewer in the alert's project; a failed lookup only
+// skips the reply.
+
+const (
+	defaultContextWindow  = 30 * time.Second
+	contextLookupTimeout  = 10 * time.Second
+	contextLineMaxLen     = 300
+	contextLinesMaxPerDir = 50
+)
+
+type contextLines struct {
+	n      int
+	window time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*logadmin.Client // by project
+}
+
+// client returns the Logging API client for project.
+func (c *contextLines) client(ctx context.Context, project string) (*logadmin.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cl, ok := c.clients[project]; ok {
+		return cl, nil
+	}
+	cl, err := logadmin.NewClient(context.WithoutCancel(ctx), project)
+	if err != nil {
+		return nil, err
+	}
+	c.clients[project] = cl
+	return cl, nil
+}
+
+// resourceFilter selects the entries of the same resource as e.
+func resourceFilter(e *LogEntry) string {
+	parts := []string{"resource.type=" + strconv.Quote(e.Resource.Type)}
+	keys := make([]string, 0, len(e.Resource.Labels))
+	for k := range e.Resource.Labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("resource.labels.%s=%s", k, strconv.Quote(e.Resource.Labels[k])))
+	}
+	return strings.Join(parts, " AND ")
+}
+
+// around returns up to n entries before and after e, oldest first.
+func (c *contextLines) around(ctx context.Context, e *LogEntry) ([]*logging.Entry, error) {
+	project := logProject(e.LogName)
+	if project == "" || e.Timestamp.IsZero() || e.Resource.Type == "" {
+		return nil, nil
+	}
+	cl, err := c.client(ctx, project)
+	if err != nil {
+		return nil, err
+	}
+	at := e.Timestamp.UTC()
+	base := resourceFilter(e)
+	if e.InsertID != "" {
+		base += " AND insertId!=" + strconv.Quote(e.InsertID)
+	}
+	ts := func(t time.Time) string { return strconv.Quote(t.Format(time.RFC3339Nano)) }
+
+	before, err := c.fetch(ctx, cl, fmt.Sprintf("%s AND timestamp>=%s AND timestamp<=%s", base, ts(at.Add(-c.window)), ts(at)), logadmin.NewestFirst())
+	if err != nil {
+		return nil, err
+	}
+	after, err := c.fetch(ctx, cl, fmt.Sprintf("%s AND timestamp>%s AND timestamp<=%s", base, ts(at), ts(at.Add(c.window))))
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*logging.Entry, 0, len(before)+len(after))
+	for i := len(before) - 1; i >= 0; i-- {
+		out = append(out, before[i])
+	}
+	return append(out, after...), nil
+}
+
+func (c *contextLines) fetch(ctx context.Context, cl *logadmin.Client, filter string, opts ...logadmin.EntriesOption) ([]*logging.Entry, error) {
+	it := cl.Entries(ctx, append(opts, logadmin.Filter(filter))...)
+	var out []*logging.Entry
+	for len(out) < c.n {
+		entry, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return out, err
+		}
+		out = append(out, entry)
+	}
+	return out, nil
+}
+
+// contextLine renders one entry as "15:04:05.000 SEVERITY message".
+func contextLine(e *logging.Entry) string {
+	var text string
+	switch p := e.Payload.(type) {
+	case string:
+		text = p
+	case *structpb.Struct:
+		if m, ok := p.Fields["message"]; ok && m.GetStringValue() != "" {
+			text = m.GetStringValue()
+		} else if b, err := json.Marshal(p.AsMap()); err == nil {
+			text = string(b)
+		}
+	case nil:
+	default:
+		text = fmt.Sprint(p)
+	}
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > contextLineMaxLen {
+		text = string(r[:contextLineMaxLen]) + "…"
+	}
+	return fmt.Sprintf("%s %-8s %s", e.Timestamp.UTC().Format("15:04:05.000"), e.Severity, text)
+}
+
+// formatContextLines renders the entries around the alert's entry, marking
+// where the alert's entry falls between them.
+func formatContextLines(e *LogEntry, entries []*logging.Entry, window time.Duration) string {
+	var lines []string
+	marked := false
+	for _, ce := range entries {
+		if !marked && ce.Timestamp.After(e.Timestamp) {
+			lines = append(lines, fmt.Sprintf("%s %-8s ▶ this alert", e.Timestamp.UTC().Format("15:04:05.000"), e.Severity))
+			marked = true
+		}
+		lines = append(lines, contextLine(ce))
+	}
+	if !marked {
+		lines = append(lines, fmt.Sprintf("%s %-8s ▶ this alert", e.Timestamp.UTC().Format("15:04:05.000"), e.Severity))
+	}
+	return fmt.Sprintf(":mag: Same resource, ±%s:\n%s", window, codeBlock(strings.Join(lines, "\n")))
+}
+
+var (
+	contextLookup         *contextLines
+	contextLookupErr      error
+	contextLookupInitOnce sync.Once
+)
+
+// getContextLines returns the context lookup configured via env, or nil when
+// it is disabled.
+func getContextLines() (*contextLines, error) {
+	contextLookupInitOnce.Do(func() {
+		v := setting("SLACK_CONTEXT_LINES")
+		if v == "" {
+			return
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > contextLinesMaxPerDir {
+			contextLookupErr = fmt.Errorf("invalid SLACK_CONTEXT_LINES %q: want 1 to %d", v, contextLinesMaxPerDir)
+			return
+		}
+		c := &contextLines{n: n, window: defaultContextWindow, clients: map[string]*logadmin.Client{}}
+		if v := setting("SLACK_CONTEXT_WINDOW"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				contextLookupErr = fmt.Errorf("invalid SLACK_CONTEXT_WINDOW %q", v)
+				return
+			}
+			c.window = d
+		}
+		contextLookup = c
+	})
+	return contextLookup, contextLookupErr
+}
+
+// postContextLines replies in the alert's thread with the entries around
+// its entry.
+func postContextLines(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, channelID, threadTS string, a *Alert) {
+	c, err := getContextLines()
+	if err != nil {
+		reqLog.Error("invalid context lines config", err)
+	}
+	if c == nil || a.Entry == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, contextLookupTimeout)
+	defer cancel()
+	entries, err := c.around(ctx, a.Entry)
+	if err != nil {
+		reqLog.Warning("context lines lookup failed", err, map[string]any{"logName": a.Entry.LogName})
+		return
+	}
+	if len(entries) == 0 {
+		return
+	}
+	text := redact(formatContextLines(a.Entry, entries, c.window))
+	if _, err := notifier.SendMessage(ctx, channelID, text, slack.MsgOptionTS(threadTS)); err != nil {
+		reqLog.Warning("failed to post context lines", err, map[string]any{"channel": channelID, "threadTs": threadTS})
+	}
+}
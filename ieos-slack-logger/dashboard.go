@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// The dashboard lists recent alerts from the alert history (this instance's
+// recent alerts when SLACK_HISTORY_FIRESTORE_COLLECTION is unset) as an HTML
+// table, or as JSON with ?format=json or "Accept: application/json". Query
+// parameters narrow the list:
+//
+//	/dashboard?service=render&severity=ERROR&limit=100
+//
+// service matches service names by substring, severity is a floor and limit
+// defaults to 50 (at most 200).
+
+const (
+	defaultDashboardLimit = 50
+	maxDashboardLimit     = historyScanLimit
+)
+
+// DashboardConfig configures the recent alerts dashboard.
+type DashboardConfig struct {
+	// Token is required as a bearer token or as the basic auth password, so
+	// browsers can open the page. Required unless SkipAuth is set.
+	Token string
+	// SkipAuth disables the token check, e.g. behind Identity-Aware Proxy.
+	SkipAuth bool
+}
+
+// dashboardAlert is an alert as the dashboard shows it.
+type dashboardAlert struct {
+	At       time.Time `json:"at"`
+	Severity string    `json:"severity"`
+	Service  string    `json:"service,omitempty"`
+	Title    string    `json:"title"`
+	Headline string    `json:"headline,omitempty"`
+	Muted    string    `json:"muted,omitempty"`
+}
+
+// dashboardQuery is the parsed query string.
+type dashboardQuery struct {
+	Service  string
+	Severity string
+	Limit    int
+}
+
+func parseDashboardQuery(r *http.Request) (dashboardQuery, error) {
+	q := dashboardQuery{
+		Service:  strings.TrimSpace(r.URL.Query().Get("service")),
+		Severity: strings.ToUpper(strings.TrimSpace(r.URL.Query().Get("severity"))),
+		Limit:    defaultDashboardLimit,
+	}
+	if q.Severity != "" && !validSeverity(q.Severity) {
+		return q, fmt.Errorf("unknown severity %q", q.Severity)
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return q, fmt.Errorf("invalid limit %q", v)
+		}
+		q.Limit = min(n, maxDashboardLimit)
+	}
+	return q, nil
+}
+
+func (q dashboardQuery) match(r recentAlert) bool {
+	if q.Service != "" && !strings.Contains(strings.ToLower(r.Service), strings.ToLower(q.Service)) {
+		return false
+	}
+	return q.Severity == "" || logging.ParseSeverity(r.Severity) >= logging.ParseSeverity(q.Severity)
+}
+
+// dashboardAlerts reads the alerts matching q from the history, or from
+// this instance's recent alerts when there is none.
+func dashboardAlerts(ctx context.Context, q dashboardQuery) ([]dashboardAlert, error) {
+	var alerts []recentAlert
+	if h, _ := getHistory(); h != nil {
+		var err error
+		if alerts, err = h.matching(ctx, q.match, q.Limit); err != nil {
+			return nil, err
+		}
+	} else {
+		alerts = recentAlerts.matching(q.match, q.Limit)
+	}
+	out := make([]dashboardAlert, len(alerts))
+	for i, r := range alerts {
+		out[i] = dashboardAlert{At: r.At, Severity: r.Severity, Service: r.Service, Title: r.Title, Headline: r.Headline, Muted: r.Muted}
+	}
+	return out, nil
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"time": formatTimestamp,
+	"color": func(sev string) string {
+		return fmt.Sprintf("#%06X", severityRGB(sev))
+	},
+}).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><title>Recent alerts</title>
+<style>
+body{font-family:sans-serif;margin:24px}
+table{border-collapse:collapse;width:100%}
+th,td{text-align:left;padding:4px 8px;border-bottom:1px solid #ddd;vertical-align:top}
+td.sev{font-weight:bold}
+.muted{color:#888}
+</style></head><body>
+<h1>Recent alerts</h1>
+<form method="get">
+<input name="service" placeholder="service" value="{{.Query.Service}}">
+<input name="severity" placeholder="min severity" value="{{.Query.Severity}}">
+<button>Filter</button>
+</form>
+<table>
+<tr><th>Time</th><th>Severity</th><th>Service</th><th>Alert</th><th>Muted</th></tr>
+{{range .Alerts}}<tr>
+<td>{{time .At}}</td>
+<td class="sev" style="color:{{color .Severity}}">{{.Severity}}</td>
+<td>{{.Service}}</td>
+<td>{{.Title}}{{if .Headline}}<br><span class="muted">{{.Headline}}</span>{{end}}</td>
+<td class="muted">{{.Muted}}</td>
+</tr>
+{{else}}<tr><td colspan="5">No recent alerts.</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// dashboardAuthorized checks the request's bearer token or basic auth
+// password against token.
+func dashboardAuthorized(r *http.Request, token string) bool {
+	got := ""
+	if _, password, ok := r.BasicAuth(); ok {
+		got = password
+	} else if v, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		got = v
+	}
+	return got != "" && subtle.ConstantTimeCompare([]byte(got), []byte(token)) == 1
+}
+
+// NewDashboardHandler returns an http.Handler serving the recent alerts
+// dashboard.
+func NewDashboardHandler(cfg DashboardConfig) (http.Handler, error) {
+	if cfg.Token == "" && !cfg.SkipAuth {
+		return nil, fmt.Errorf("dashboard token is required when auth is enabled")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !cfg.SkipAuth && !dashboardAuthorized(r, cfg.Token) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="ieos-slack-logger"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		serveDashboard(w, r)
+	}), nil
+}
+
+// HandleDashboard is the HTTP Cloud Function equivalent of
+// NewDashboardHandler. Deploy it without unauthenticated access; IAM takes
+// the place of the token.
+func HandleDashboard(w http.ResponseWriter, r *http.Request) {
+	serveDashboard(w, r)
+}
+
+func serveDashboard(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	reqLog := getLogger(ctx).ForRequest(ctx, r)
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	reloadConfig(ctx, reqLog, time.Now())
+	q, err := parseDashboardQuery(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	alerts, err := dashboardAlerts(ctx, q)
+	if err != nil {
+		reqLog.Error("dashboard query failed", err)
+		http.Error(w, "alert history unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"alerts": alerts})
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dashboardTemplate.Execute(w, map[string]any{"Query": q, "Alerts": alerts}); err != nil {
+		reqLog.Error("dashboard render failed", err)
+	}
+}
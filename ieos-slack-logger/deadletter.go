@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// When SLACK_DEAD_LETTER_TOPIC is set ("projects/<p>/topics/<t>" or a topic
+// ID in GOOGLE_CLOUD_PROJECT), permanently failed deliveries are published
+// there with the failure reason and acked, instead of being redelivered by
+// Pub/Sub forever.
+
+// DeadLetter is the message body published to the dead-letter topic.
+type DeadLetter struct {
+	Entry      json.RawMessage   `json:"entry"`
+	Attributes map[string]string `json:"attributes,omitempty"`
+	MessageID  string            `json:"messageId,omitempty"`
+	Channel    string            `json:"channel,omitempty"`
+	Reason     string            `json:"reason"`
+	FailedAt   time.Time         `json:"failedAt"`
+}
+
+var (
+	deadLetterTopic    *pubsub.Topic
+	deadLetterErr      error
+	deadLetterInitOnce sync.Once
+)
+
+// getDeadLetterTopic returns the configured topic, or nil when dead-lettering is disabled.
+func getDeadLetterTopic(ctx context.Context) (*pubsub.Topic, error) {
+	deadLetterInitOnce.Do(func() {
+		name := setting("SLACK_DEAD_LETTER_TOPIC")
+		if name == "" {
+			return
+		}
+		projectID, topicID := os.Getenv("GOOGLE_CLOUD_PROJECT"), name
+		if parts := strings.Split(name, "/"); len(parts) == 4 && parts[0] == "projects" && parts[2] == "topics" {
+			projectID, topicID = parts[1], parts[3]
+		}
+		if projectID == "" {
+			deadLetterErr = fmt.Errorf("SLACK_DEAD_LETTER_TOPIC %q needs a project (set GOOGLE_CLOUD_PROJECT or use projects/<p>/topics/<t>)", name)
+			return
+		}
+		// The client outlives the request, so it must not be bound to ctx's deadline.
+		client, err := pubsub.NewClient(context.Background(), projectID)
+		if err != nil {
+			deadLetterErr = err
+			return
+		}
+		deadLetterTopic = client.Topic(topicID)
+	})
+	return deadLetterTopic, deadLetterErr
+}
+
+// publishDeadLetter publishes the original message and failure reason and
+// waits for the server to accept it.
+func publishDeadLetter(ctx context.Context, topic *pubsub.Topic, m PubSubMessage, channelID string, cause error) error {
+	body, err := json.Marshal(DeadLetter{
+		Entry:      json.RawMessage(m.Data),
+		Attributes: m.Attributes,
+		MessageID:  m.MessageID,
+		Channel:    channelID,
+		Reason:     cause.Error(),
+		FailedAt:   time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	attrs := map[string]string{}
+	var se *SlackError
+	if errors.As(cause, &se) && se.Code != "" {
+		attrs["dead_letter_code"] = se.Code
+	}
+	res := topic.Publish(ctx, &pubsub.Message{Data: body, Attributes: attrs})
+	_, err = res.Get(ctx)
+	return err
+}
+
+// handleDeliveryFailure dead-letters permanent failures and acks them; other
+// failures are returned so Pub/Sub redelivers the message.
+func handleDeliveryFailure(ctx context.Context, reqLog *logger.RequestLogger, m PubSubMessage, channelID string, cause error) error {
+	if !IsPermanent(cause) {
+		return cause
+	}
+	topic, err := getDeadLetterTopic(ctx)
+	if err != nil {
+		reqLog.Error("dead-letter topic unavailable", err)
+		return cause
+	}
+	if topic == nil {
+		return cause
+	}
+	if err := publishDeadLetter(ctx, topic, m, channelID, cause); err != nil {
+		reqLog.Error("dead-letter publish failed", err)
+		return cause
+	}
+	reqLog.Warning("delivery failed permanently; message dead-lettered", map[string]any{"channel": channelID, "reason": cause.Error()})
+	countMetric(reqLog, metricDeadLettered, map[string]string{"target": channelID})
+	return nil
+}
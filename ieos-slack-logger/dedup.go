@@ -0,0 +1,158 @@
+package service
+
+import (
+	"container/list"
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/functions/metadata"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Pub/Sub delivers at least once, so processed message IDs are remembered
+// and redeliveries are skipped. Every instance keeps an in-memory LRU of
+// SLACK_DEDUP_CACHE_SIZE IDs (default 10000); setting
+// SLACK_DEDUP_FIRESTORE_COLLECTION additionally shares them across instances
+// and cold starts. Documents carry an expireAt field for a Firestore TTL policy.
+
+const (
+	defaultDedupCacheSize = 10000
+	dedupRetention        = 7 * 24 * time.Hour // Pub/Sub's maximum retention
+)
+
+// processedStore records which messages have been fully handled.
+type processedStore interface {
+	Seen(ctx context.Context, id string) (bool, error)
+	MarkProcessed(ctx context.Context, id string) error
+}
+
+// lruStore is a fixed-size in-memory processedStore.
+type lruStore struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front is most recent
+	items map[string]*list.Element
+}
+
+func newLRUStore(size int) *lruStore {
+	return &lruStore{size: size, order: list.New(), items: make(map[string]*list.Element, size)}
+}
+
+func (s *lruStore) Seen(_ context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[id]
+	if ok {
+		s.order.MoveToFront(el)
+	}
+	return ok, nil
+}
+
+func (s *lruStore) MarkProcessed(_ context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[id]; ok {
+		s.order.MoveToFront(el)
+		return nil
+	}
+	s.items[id] = s.order.PushFront(id)
+	if s.order.Len() > s.size {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.items, oldest.Value.(string))
+	}
+	return nil
+}
+
+// firestoreStore keeps one document per processed message ID.
+type firestoreStore struct {
+	col *firestore.CollectionRef
+}
+
+func (s *firestoreStore) Seen(ctx context.Context, id string) (bool, error) {
+	_, err := s.col.Doc(id).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (s *firestoreStore) MarkProcessed(ctx context.Context, id string) error {
+	now := time.Now().UTC()
+	_, err := s.col.Doc(id).Set(ctx, map[string]any{
+		"processedAt": now,
+		"expireAt":    now.Add(dedupRetention),
+	})
+	return err
+}
+
+// tieredStore checks the local cache before the shared backend.
+type tieredStore struct {
+	local  *lruStore
+	shared processedStore // optional
+}
+
+func (s *tieredStore) Seen(ctx context.Context, id string) (bool, error) {
+	if seen, _ := s.local.Seen(ctx, id); seen || s.shared == nil {
+		return seen, nil
+	}
+	seen, err := s.shared.Seen(ctx, id)
+	if seen {
+		_ = s.local.MarkProcessed(ctx, id)
+	}
+	return seen, err
+}
+
+func (s *tieredStore) MarkProcessed(ctx context.Context, id string) error {
+	_ = s.local.MarkProcessed(ctx, id)
+	if s.shared == nil {
+		return nil
+	}
+	return s.shared.MarkProcessed(ctx, id)
+}
+
+var (
+	dedupStore    *tieredStore
+	dedupErr      error
+	dedupInitOnce sync.Once
+)
+
+func getDedupStore() (processedStore, error) {
+	dedupInitOnce.Do(func() {
+		size := defaultDedupCacheSize
+		if v := setting("SLACK_DEDUP_CACHE_SIZE"); v != "" {
+			if n, err := strconv.Atoi(v); err == nil && n > 0 {
+				size = n
+			}
+		}
+		dedupStore = &tieredStore{local: newLRUStore(size)}
+
+		collection := setting("SLACK_DEDUP_FIRESTORE_COLLECTION")
+		if collection == "" {
+			return
+		}
+		client, err := getFirestore()
+		if err != nil {
+			dedupErr = err
+			return
+		}
+		dedupStore.shared = &firestoreStore{col: client.Collection(collection)}
+	})
+	return dedupStore, dedupErr
+}
+
+// messageID returns the Pub/Sub message ID from the message itself
+// (CloudEvent and push deliveries) or from the background event metadata.
+func messageID(ctx context.Context, m PubSubMessage) string {
+	if m.MessageID != "" {
+		return m.MessageID
+	}
+	if meta, err := metadata.FromContext(ctx); err == nil && meta != nil {
+		return meta.EventID
+	}
+	return ""
+}
@@ -0,0 +1,231 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Digest mode buffers low-severity entries and posts them as one message per
+// channel every SLACK_DIGEST_INTERVAL (e.g. "15m"), grouped by logName with a
+// count and a sample line. Entries at or above SLACK_DIGEST_MIN_IMMEDIATE
+// (default ERROR) are still posted immediately. Buffers are per instance and
+// are flushed on the first invocation after the interval elapses, and on
+// shutdown; entries of a digest that fails to post are kept for the next.
+
+const digestSampleMaxLen = 200
+
+type digestGroup struct {
+	count    int
+	severity string // highest severity seen in the group
+	sample   string
+}
+
+type digestBuffer struct {
+	interval  time.Duration
+	immediate logging.Severity
+
+	mu      sync.Mutex
+	started time.Time
+	total   int
+	groups  map[string]map[string]*digestGroup // channel -> logName -> group
+}
+
+func newDigestBuffer(interval time.Duration, immediate logging.Severity) *digestBuffer {
+	return &digestBuffer{interval: interval, immediate: immediate, groups: map[string]map[string]*digestGroup{}}
+}
+
+// add buffers the entry and reports true, or reports false when the entry
+// should be posted immediately.
+func (d *digestBuffer) add(now time.Time, channelID, logName, severity, message string) bool {
+	if d == nil || logging.ParseSeverity(severity) >= d.immediate {
+		return false
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.total == 0 {
+		d.started = now
+	}
+	byLog := d.groups[channelID]
+	if byLog == nil {
+		byLog = map[string]*digestGroup{}
+		d.groups[channelID] = byLog
+	}
+	g := byLog[logName]
+	if g == nil {
+		g = &digestGroup{severity: severity, sample: digestSample(message)}
+		byLog[logName] = g
+	}
+	g.count++
+	if logging.ParseSeverity(severity) > logging.ParseSeverity(g.severity) {
+		g.severity = severity
+	}
+	d.total++
+	return true
+}
+
+// digestPost is the digest of one channel and the groups it was rendered
+// from.
+type digestPost struct {
+	channelID string
+	started   time.Time
+	groups    map[string]*digestGroup // logName -> group
+	text      string
+}
+
+// due returns the digests per channel once the interval has elapsed and
+// clears the buffer.
+func (d *digestBuffer) due(now time.Time) []digestPost {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.total == 0 || now.Sub(d.started) < d.interval {
+		return nil
+	}
+	return d.take()
+}
+
+// drain returns the buffered digests per channel regardless of the
+// interval, e.g. on shutdown, and clears the buffer.
+func (d *digestBuffer) drain() []digestPost {
+	if d == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.total == 0 {
+		return nil
+	}
+	return d.take()
+}
+
+// take renders the buffered groups and clears them. d.mu must be held.
+func (d *digestBuffer) take() []digestPost {
+	out := make([]digestPost, 0, len(d.groups))
+	for channelID, byLog := range d.groups {
+		logNames := make([]string, 0, len(byLog))
+		count := 0
+		for name, g := range byLog {
+			logNames = append(logNames, name)
+			count += g.count
+		}
+		sort.Slice(logNames, func(i, j int) bool {
+			gi, gj := byLog[logNames[i]], byLog[logNames[j]]
+			if gi.count != gj.count {
+				return gi.count > gj.count
+			}
+			return logNames[i] < logNames[j]
+		})
+
+		var b strings.Builder
+		fmt.Fprintf(&b, "Digest: %d entries since %s", count, formatTimestamp(d.started))
+		for _, name := range logNames {
+			g := byLog[name]
+			fmt.Fprintf(&b, "\n• %s — %d× (max %s)", name, g.count, g.severity)
+			if g.sample != "" {
+				fmt.Fprintf(&b, "\n    %s", g.sample)
+			}
+		}
+		out = append(out, digestPost{channelID: channelID, started: d.started, groups: byLog, text: b.String()})
+	}
+	d.groups = map[string]map[string]*digestGroup{}
+	d.total = 0
+	sort.Slice(out, func(i, j int) bool { return out[i].channelID < out[j].channelID })
+	return out
+}
+
+// restore puts the groups of a digest that could not be posted back into
+// the buffer, so they are part of the next one.
+func (d *digestBuffer) restore(p digestPost) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.total == 0 || p.started.Before(d.started) {
+		d.started = p.started
+	}
+	byLog := d.groups[p.channelID]
+	if byLog == nil {
+		byLog = map[string]*digestGroup{}
+		d.groups[p.channelID] = byLog
+	}
+	for logName, g := range p.groups {
+		cur := byLog[logName]
+		if cur == nil {
+			byLog[logName] = g
+		} else {
+			cur.count += g.count
+			if logging.ParseSeverity(g.severity) > logging.ParseSeverity(cur.severity) {
+				cur.severity = g.severity
+			}
+		}
+		d.total += g.count
+	}
+}
+
+// digestSample reduces a formatted message to its first meaningful line
+// after the "[SEVERITY] logName" header.
+func digestSample(message string) string {
+	_, body, _ := strings.Cut(message, "\n")
+	sample := strings.TrimSpace(firstTextLine(body))
+	if r := []rune(sample); len(r) > digestSampleMaxLen {
+		sample = string(r[:digestSampleMaxLen]) + "…"
+	}
+	return sample
+}
+
+var (
+	digest         *digestBuffer
+	digestErr      error
+	digestInitOnce sync.Once
+)
+
+// getDigest returns the digest buffer configured via env, or nil when digest
+// mode is disabled.
+func getDigest() (*digestBuffer, error) {
+	digestInitOnce.Do(func() {
+		v := setting("SLACK_DIGEST_INTERVAL")
+		if v == "" {
+			return
+		}
+		interval, err := time.ParseDuration(v)
+		if err != nil || interval <= 0 {
+			digestErr = fmt.Errorf("invalid SLACK_DIGEST_INTERVAL %q", v)
+			return
+		}
+		immediate := logging.Error
+		if s := setting("SLACK_DIGEST_MIN_IMMEDIATE"); s != "" {
+			// an unknown severity parses as DEFAULT, which would post
+			// everything immediately
+			if validSeverity(s) {
+				immediate = logging.ParseSeverity(s)
+			} else {
+				digestErr = fmt.Errorf("invalid SLACK_DIGEST_MIN_IMMEDIATE %q, using ERROR", s)
+			}
+		}
+		digest = newDigestBuffer(interval, immediate)
+	})
+	return digest, digestErr
+}
+
+// postDigests sends due digests to their channels. Groups of digests that
+// failed to post with a transient error are put back into d and posted with
+// the next digest.
+func postDigests(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, d *digestBuffer, digests []digestPost) {
+	for _, p := range digests {
+		err := deliver(ctx, reqLog, notifier, p.channelID, newAlert("INFO", p.text, nil))
+		if err == nil {
+			continue
+		}
+		reqLog.Error("failed to post digest", err, map[string]any{"channel": p.channelID})
+		if !IsPermanent(err) {
+			d.restore(p)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package service
+
+import "github.com/print-engine/ieos-golang-utils/logger"
+
+// Setting SLACK_DRY_RUN=true, or adding the "dryrun" option to a single
+// destination (e.g. "C0123456;dryrun"), runs alerts through routing,
+// formatting, templates and dedup as usual but logs the message each
+// destination would have received instead of delivering it. New rules and
+// templates can so be rolled out against production traffic before they
+// page anyone.
+
+// dryRun reports whether delivery to d is only logged.
+func dryRun(d Destination) bool {
+	return d.DryRun || setting("SLACK_DRY_RUN") == "true"
+}
+
+// logDryRun logs the message a destination would have received.
+func logDryRun(reqLog *logger.RequestLogger, target string, a *Alert) {
+	countMetric(reqLog, metricSuppressed, map[string]string{"reason": "dry_run", "target": target})
+	fields := map[string]any{"target": target, "severity": a.Severity, "fingerprint": a.Fingerprint}
+	if _, _, ok := sinkTarget(target); ok {
+		fields["text"] = a.Text
+	} else {
+		fields["text"] = slackText(a)
+	}
+	reqLog.Info("dry run: alert not delivered", fields)
+}
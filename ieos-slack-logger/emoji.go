@@ -0,0 +1,64 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Slack alerts start with a severity emoji so they can be told apart at a
+// glance, e.g. on mobile where colors are easy to miss. SLACK_SEVERITY_EMOJI
+// overrides the defaults as "<SEVERITY>=<emoji>" pairs, workspace custom
+// emoji included; an empty emoji removes the prefix for that severity and
+// "off" disables prefixes entirely:
+//
+//	SLACK_SEVERITY_EMOJI=ERROR=:fire:,WARNING=:warning:,DEBUG=
+
+var defaultSeverityEmoji = map[string]string{
+	"EMERGENCY": ":rotating_light:",
+	"ALERT":     ":rotating_light:",
+	"CRITICAL":  ":rotating_light:",
+	"ERROR":     ":red_square:",
+	"WARNING":   ":large_orange_square:",
+	"NOTICE":    ":large_blue_square:",
+	"INFO":      ":large_blue_square:",
+}
+
+// emojiNameRE matches an emoji name given without its colons.
+var emojiNameRE = regexp.MustCompile(`^[a-z0-9_+'-]+$`)
+
+var (
+	severityEmojis        map[string]string
+	severityEmojiInitOnce configOnce
+)
+
+func getSeverityEmojis() map[string]string {
+	severityEmojiInitOnce.Do(func() {
+		v := strings.TrimSpace(setting("SLACK_SEVERITY_EMOJI"))
+		if v == "off" {
+			severityEmojis = map[string]string{}
+			return
+		}
+		severityEmojis = make(map[string]string, len(defaultSeverityEmoji))
+		for sev, emoji := range defaultSeverityEmoji {
+			severityEmojis[sev] = emoji
+		}
+		for _, pair := range strings.Split(v, ",") {
+			sev, emoji, ok := strings.Cut(pair, "=")
+			if !ok {
+				continue
+			}
+			emoji = strings.TrimSpace(emoji)
+			if emojiNameRE.MatchString(emoji) {
+				// bare emoji names, e.g. "sev-error"
+				emoji = ":" + emoji + ":"
+			}
+			severityEmojis[strings.ToUpper(strings.TrimSpace(sev))] = emoji
+		}
+	})
+	return severityEmojis
+}
+
+// severityEmoji returns the emoji prefix for a severity, or "".
+func severityEmoji(severity string) string {
+	return getSeverityEmojis()[strings.ToUpper(severity)]
+}
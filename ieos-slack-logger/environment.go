@@ -0,0 +1,88 @@
+package service
+
+import "strings"
+
+// Alerts name the environment they come from so a prod page is never taken
+// for staging noise. The environment is read from the entry label or
+// resource label named by SLACK_ENVIRONMENT_LABEL, else looked up by project
+// in SLACK_ENVIRONMENTS ("<project>=<environment>" pairs):
+//
+//	SLACK_ENVIRONMENTS=acme-prod=prod,acme-staging=staging,acme-dev=dev
+//
+// Slack messages then start with a colored badge, e.g. ":red_circle: *PROD*".
+// An environment can have its own routes like a project does, e.g.
+// SLACK_ERROR_CHANNEL_ID_STAGING; a project's own routes take precedence.
+
+// environmentBadgeEmoji colors well-known environments by name prefix;
+// others get a white badge.
+var environmentBadgeEmoji = []struct{ prefix, emoji string }{
+	{"prod", ":red_circle:"},
+	{"stag", ":large_orange_circle:"},
+	{"preprod", ":large_orange_circle:"},
+	{"qa", ":large_yellow_circle:"},
+	{"test", ":large_yellow_circle:"},
+	{"dev", ":large_green_circle:"},
+	{"local", ":large_green_circle:"},
+}
+
+var (
+	projectEnvironments map[string]string
+	environmentLabel    string
+	environmentInitOnce configOnce
+)
+
+func loadEnvironments() {
+	environmentInitOnce.Do(func() {
+		projectEnvironments = map[string]string{}
+		for _, pair := range strings.Split(setting("SLACK_ENVIRONMENTS"), ",") {
+			project, env, ok := strings.Cut(pair, "=")
+			if project, env = strings.TrimSpace(project), strings.TrimSpace(env); ok && project != "" && env != "" {
+				projectEnvironments[project] = strings.ToLower(env)
+			}
+		}
+		environmentLabel = strings.TrimSpace(setting("SLACK_ENVIRONMENT_LABEL"))
+	})
+}
+
+// projectEnvironment returns the environment mapped to the project, or "".
+func projectEnvironment(project string) string {
+	loadEnvironments()
+	return projectEnvironments[project]
+}
+
+// entryEnvironment returns the environment the entry comes from, or "" when
+// it cannot be told.
+func entryEnvironment(e *LogEntry) string {
+	if e == nil {
+		return ""
+	}
+	loadEnvironments()
+	if environmentLabel != "" {
+		if v := e.Labels[environmentLabel]; v != "" {
+			return strings.ToLower(v)
+		}
+		if v := e.Resource.Labels[environmentLabel]; v != "" {
+			return strings.ToLower(v)
+		}
+	}
+	project := logProject(e.LogName)
+	if project == "" {
+		project = e.Resource.Labels["project_id"]
+	}
+	return projectEnvironments[project]
+}
+
+// environmentBadge renders the Slack badge for an environment, or "".
+func environmentBadge(env string) string {
+	if env == "" {
+		return ""
+	}
+	emoji := ":white_circle:"
+	for _, b := range environmentBadgeEmoji {
+		if strings.HasPrefix(env, b.prefix) {
+			emoji = b.emoji
+			break
+		}
+	}
+	return emoji + " *" + strings.ToUpper(env) + "*"
+}
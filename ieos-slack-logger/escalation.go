@@ -0,0 +1,228 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/slack-go/slack"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Setting SLACK_ESCALATE_AFTER (e.g. "10m") escalates Slack alerts at or
+// above SLACK_ESCALATE_SEVERITY (default CRITICAL) that nobody acknowledged,
+// by button or snooze reaction, within that time. Escalations are reposted to
+// the destinations in SLACK_ESCALATION_CHANNEL_ID, or broadcast from the
+// alert's thread when it is unset, prefixed with SLACK_ESCALATION_MENTION: a
+// user group ID ("S0123ABC"), a user ID ("U0123ABC") or "here"/"channel".
+//
+// Pending escalations are checked by the scheduler endpoint (see
+// NewSchedulerHandler), which a Cloud Scheduler job should call every
+// minute. They are kept per instance unless
+// SLACK_ESCALATION_FIRESTORE_COLLECTION is set; the ack store must be shared
+// as well when acks are handled by a separate service.
+
+// pendingEscalation is a posted alert waiting for an acknowledgement.
+type pendingEscalation struct {
+	Fingerprint string    `firestore:"fingerprint"`
+	Target      string    `firestore:"target"` // Slack target the alert went to
+	TS          string    `firestore:"ts"`
+	Severity    string    `firestore:"severity"`
+	Text        string    `firestore:"text"`
+	PostedAt    time.Time `firestore:"postedAt"`
+	DueAt       time.Time `firestore:"dueAt"`
+	ExpireAt    time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+func escalationKey(target, ts string) string {
+	return strings.ReplaceAll(target, "/", "_") + ":" + ts
+}
+
+// escalator tracks alerts that escalate unless acknowledged in time.
+type escalator struct {
+	after   time.Duration
+	min     logging.Severity
+	targets []Destination
+	mention string
+	shared  *firestore.CollectionRef // optional
+
+	mu    sync.Mutex
+	local map[string]pendingEscalation
+}
+
+// track schedules the escalation of an alert posted to target at ts.
+func (e *escalator) track(ctx context.Context, target, ts string, a *Alert, now time.Time) error {
+	if e == nil || a.Fingerprint == "" || logging.ParseSeverity(a.Severity) < e.min {
+		return nil
+	}
+	p := pendingEscalation{
+		Fingerprint: a.Fingerprint,
+		Target:      target,
+		TS:          ts,
+		Severity:    a.Severity,
+		Text:        a.Text,
+		PostedAt:    now,
+		DueAt:       now.Add(e.after),
+		ExpireAt:    now.Add(e.after + dedupRetention),
+	}
+	key := escalationKey(target, ts)
+	if e.shared != nil {
+		_, err := e.shared.Doc(key).Set(ctx, p)
+		return err
+	}
+	e.mu.Lock()
+	e.local[key] = p
+	e.mu.Unlock()
+	return nil
+}
+
+// due removes and returns the escalations due at now. With a shared backend
+// each one is claimed by deleting its document, so only one instance acts.
+func (e *escalator) due(ctx context.Context, now time.Time) ([]pendingEscalation, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if e.shared == nil {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		var out []pendingEscalation
+		for key, p := range e.local {
+			if !now.Before(p.DueAt) {
+				out = append(out, p)
+				delete(e.local, key)
+			}
+		}
+		return out, nil
+	}
+
+	snaps, err := e.shared.Where("dueAt", "<=", now).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var out []pendingEscalation
+	for _, snap := range snaps {
+		var p pendingEscalation
+		if err := snap.DataTo(&p); err != nil {
+			return out, err
+		}
+		if _, err := snap.Ref.Delete(ctx, firestore.Exists); status.Code(err) == codes.NotFound {
+			continue // claimed by another instance
+		} else if err != nil {
+			return out, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// slackMention turns SLACK_ESCALATION_MENTION into Slack mention markup.
+func slackMention(v string) string {
+	switch {
+	case v == "":
+		return ""
+	case v == "here" || v == "channel" || v == "everyone":
+		return "<!" + v + ">"
+	case strings.HasPrefix(v, "S"):
+		return "<!subteam^" + v + ">"
+	case strings.HasPrefix(v, "U") || strings.HasPrefix(v, "W"):
+		return "<@" + v + ">"
+	}
+	return v
+}
+
+var (
+	escalations         *escalator
+	escalationsErr      error
+	escalationsInitOnce sync.Once
+)
+
+// getEscalator returns the escalator configured via env, or nil when
+// escalation is disabled.
+func getEscalator() (*escalator, error) {
+	escalationsInitOnce.Do(func() {
+		v := setting("SLACK_ESCALATE_AFTER")
+		if v == "" {
+			return
+		}
+		after, err := time.ParseDuration(v)
+		if err != nil || after <= 0 {
+			escalationsErr = fmt.Errorf("invalid SLACK_ESCALATE_AFTER %q", v)
+			return
+		}
+		e := &escalator{
+			after:   after,
+			min:     logging.Critical,
+			targets: parseDestinations(setting("SLACK_ESCALATION_CHANNEL_ID")),
+			mention: slackMention(strings.TrimSpace(setting("SLACK_ESCALATION_MENTION"))),
+			local:   map[string]pendingEscalation{},
+		}
+		if s := setting("SLACK_ESCALATE_SEVERITY"); s != "" {
+			e.min = logging.ParseSeverity(s)
+		}
+		if collection := setting("SLACK_ESCALATION_FIRESTORE_COLLECTION"); collection != "" {
+			client, err := getFirestore()
+			if err != nil {
+				escalationsErr = err
+				return
+			}
+			e.shared = client.Collection(collection)
+		}
+		escalations = e
+	})
+	return escalations, escalationsErr
+}
+
+// trackEscalation schedules an escalation for a freshly posted Slack alert.
+func trackEscalation(ctx context.Context, reqLog *logger.RequestLogger, target, ts string, a *Alert) {
+	e, _ := getEscalator()
+	if err := e.track(ctx, target, ts, a, time.Now().UTC()); err != nil {
+		reqLog.Error("failed to schedule escalation", err, map[string]any{"target": target, "ts": ts})
+	}
+}
+
+// runEscalations escalates every due alert that has not been acknowledged.
+func runEscalations(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, now time.Time) {
+	e, err := getEscalator()
+	if err != nil {
+		reqLog.Error("invalid escalation config", err)
+	}
+	pending, err := e.due(ctx, now)
+	if err != nil {
+		reqLog.Error("escalation lookup failed", err)
+	}
+	ackTracker, _ := getAcks()
+	for _, p := range pending {
+		if rec, err := ackTracker.active(ctx, p.Fingerprint, now); err != nil {
+			reqLog.Warning("ack lookup failed", err, map[string]any{"fingerprint": p.Fingerprint})
+		} else if rec != nil {
+			continue
+		}
+		if err := escalate(ctx, reqLog, notifier, e, p); err != nil {
+			reqLog.Error("failed to escalate alert", err, map[string]any{"fingerprint": p.Fingerprint, "target": p.Target})
+			continue
+		}
+		reqLog.Warning("unacknowledged alert escalated", map[string]any{"fingerprint": p.Fingerprint, "target": p.Target, "ts": p.TS})
+	}
+}
+
+func escalate(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, e *escalator, p pendingEscalation) error {
+	note := strings.TrimSpace(fmt.Sprintf("%s :rotating_light: Not acknowledged within %s", e.mention, e.after))
+	if len(e.targets) == 0 {
+		_, err := notifier.SendMessage(ctx, p.Target, note, slack.MsgOptionTS(p.TS), slack.MsgOptionBroadcast())
+		return err
+	}
+	title, body, _ := strings.Cut(p.Text, "\n")
+	a := newAlert(p.Severity, title+"\n"+note+"\n"+body, nil)
+	for _, d := range e.targets {
+		if err := deliver(ctx, reqLog, notifier, d.Target, a); err != nil {
+			return err
+		}
+	}
+	return nil
+}
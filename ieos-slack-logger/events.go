@@ -0,0 +1,118 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/slack-go/slack"
+	"github.com/slack-go/slack/slackevents"
+)
+
+// NewEventHandler returns an http.Handler for the Slack app's Events API
+// request URL. It answers the URL verification challenge and snoozes alerts
+// on reaction_added events with a snooze emoji (see SLACK_SNOOZE_EMOJI).
+// The app must subscribe to reaction_added and have the reactions:read and
+// channels:history scopes.
+func NewEventHandler(cfg InteractionConfig) (http.Handler, error) {
+	if len(cfg.SigningSecrets) == 0 {
+		return nil, fmt.Errorf("at least one slack signing secret is required")
+	}
+	return VerifySlackRequests(cfg.SigningSecrets, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		reqLog := getLogger(ctx).ForRequest(ctx, r)
+
+		body, _ := io.ReadAll(r.Body)
+		ev, err := slackevents.ParseEvent(json.RawMessage(body), slackevents.OptionNoVerifyToken())
+		if err != nil {
+			// unknown inner event types are not an error worth a retry
+			reqLog.Debug("ignoring slack event", map[string]any{"error": err.Error()})
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		switch ev.Type {
+		case slackevents.URLVerification:
+			if v, ok := ev.Data.(*slackevents.EventsAPIURLVerificationEvent); ok {
+				w.Header().Set("Content-Type", "text/plain")
+				_, _ = w.Write([]byte(v.Challenge))
+				return
+			}
+		case slackevents.CallbackEvent:
+			// Slack retries when we answer slowly; the first attempt still
+			// completes, so only retries after a failure are worth handling.
+			if r.Header.Get("X-Slack-Retry-Reason") == "http_timeout" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+			if reaction, ok := ev.InnerEvent.Data.(*slackevents.ReactionAddedEvent); ok {
+				fingerprint, err := snooze(ctx, ev.TeamID, reaction)
+				if err != nil {
+					reqLog.Error("failed to snooze alert", err, map[string]any{"channel": reaction.Item.Channel, "ts": reaction.Item.Timestamp, "user": reaction.User})
+					http.Error(w, "snooze failed", http.StatusInternalServerError)
+					return
+				}
+				if fingerprint != "" {
+					reqLog.Info("alert snoozed", map[string]any{"fingerprint": fingerprint, "user": reaction.User, "channel": reaction.Item.Channel})
+				}
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})), nil
+}
+
+// snooze acknowledges the alert a snooze emoji was added to and confirms it
+// in the alert's thread. It returns the snoozed fingerprint, or "" when the
+// reaction is not a snooze or the message is not an alert.
+func snooze(ctx context.Context, teamID string, ev *slackevents.ReactionAddedEvent) (string, error) {
+	t, _ := getAcks()
+	if !t.snoozeEmoji[ev.Reaction] || ev.Item.Type != "message" {
+		return "", nil
+	}
+	n := getWorkspaces(ctx).forTeam(teamID)
+	meta, err := n.alertMetadata(ctx, ev.Item.Channel, ev.Item.Timestamp)
+	if err != nil {
+		return "", err
+	}
+	fingerprint, _ := meta["fingerprint"].(string)
+	if fingerprint == "" {
+		return "", nil
+	}
+
+	now := time.Now().UTC()
+	rec := ackRecord{
+		Fingerprint: fingerprint,
+		UserID:      ev.User,
+		Via:         "reaction",
+		AckedAt:     now,
+		Until:       now.Add(t.snoozeFor),
+		ExpireAt:    now.Add(t.snoozeFor),
+	}
+	rec.Source, _ = meta["source"].(string)
+	rec.Severity, _ = meta["severity"].(string)
+	if err := t.ack(ctx, rec); err != nil {
+		return "", err
+	}
+	note := fmt.Sprintf(":%s: Snoozed by <@%s> · repeats muted until %s", ev.Reaction, ev.User, slackDate(rec.Until))
+	if _, err := n.SendMessage(ctx, ev.Item.Channel, note, slack.MsgOptionTS(ev.Item.Timestamp)); err != nil {
+		// the snooze itself is recorded; a missing confirmation is cosmetic
+		getLogger(ctx).ForRequest(ctx, nil).Warning("failed to confirm snooze", err, map[string]any{"fingerprint": fingerprint})
+	}
+	return fingerprint, nil
+}
+
+// HandleSlackEvent is the HTTP Cloud Function for the Slack app's Events API
+// request URL, configured from SLACK_SIGNING_SECRET[_<NAME>].
+func HandleSlackEvent(w http.ResponseWriter, r *http.Request) {
+	reloadConfig(r.Context(), getLogger(r.Context()).ForRequest(r.Context(), r), time.Now())
+	h, err := NewEventHandler(InteractionConfig{SigningSecrets: signingSecretsFromEnv()})
+	if err != nil {
+		getLogger(r.Context()).ForRequest(r.Context(), r).Error("slack events not configured", err)
+		http.Error(w, "not configured", http.StatusServiceUnavailable)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
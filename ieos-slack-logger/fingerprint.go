@@ -0,0 +1,44 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+)
+
+// volatileTokenRE matches the parts of a message that differ between
+// occurrences of the same problem: UUIDs, long hex IDs and numbers.
+var volatileTokenRE = regexp.MustCompile(`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}|[0-9a-fA-F]{12,}|\d+`)
+
+// alertFingerprint identifies repeats of the same alert: the same log and
+// resource type with the same first message line once volatile tokens are
+// masked, unless a grouping rule defines it (see SLACK_GROUPING_RULES).
+// message is the formatted text, header line included.
+func alertFingerprint(e *LogEntry, message string) string {
+	if fp := groupingFingerprint(e); fp != "" {
+		return fp
+	}
+	_, body, _ := strings.Cut(message, "\n")
+	headline, _, _ := strings.Cut(strings.TrimSpace(body), "\n")
+	headline = volatileTokenRE.ReplaceAllString(headline, "#")
+
+	h := sha256.New()
+	for _, part := range []string{e.LogName, e.Resource.Type, headline} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// alertSource identifies where an alert comes from, regardless of its
+// message: the log, resource type and service. An entry from the same
+// source can resolve an acknowledged alert.
+func alertSource(e *LogEntry) string {
+	h := sha256.New()
+	for _, part := range []string{e.LogName, e.Resource.Type, entryService(e)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"context"
+	"sync"
+
+	"cloud.google.com/go/firestore"
+)
+
+var (
+	firestoreClient   *firestore.Client
+	firestoreErr      error
+	firestoreInitOnce sync.Once
+)
+
+// getFirestore returns the shared Firestore client for the detected project.
+func getFirestore() (*firestore.Client, error) {
+	firestoreInitOnce.Do(func() {
+		firestoreClient, firestoreErr = firestore.NewClient(context.Background(), firestore.DetectProjectID)
+	})
+	return firestoreClient, firestoreErr
+}
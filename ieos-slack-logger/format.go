@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// entryFormatter renders entries of one recognised shape. It reports false
+// when the entry is not of that shape so the next formatter can be tried.
+type entryFormatter func(e *LogEntry) (string, bool)
+
+// entryFormatters are tried in order before falling back to formatDefault.
+var entryFormatters = []entryFormatter{
+	formatAuditLog,
+	formatErrorReport,
+	formatUptimeCheck,
+	formatK8sEvent,
+	formatBuildLog,
+	formatStackTrace,
+}
+
+// formatMessage builds the Slack text for an entry. Every format starts with
+// the "[SEVERITY] logName" header line.
+func formatMessage(e *LogEntry) string {
+	for _, f := range entryFormatters {
+		if text, ok := f(e); ok {
+			return text
+		}
+	}
+	return formatDefault(e)
+}
+
+func formatHeader(e *LogEntry) string {
+	return fmt.Sprintf("[%s] %s", e.Severity, e.LogName)
+}
+
+// formatDefault renders the text payload and either the configured headline
+// fields or a compact jsonPayload excerpt.
+func formatDefault(e *LogEntry) string {
+	var b strings.Builder
+	b.WriteString(formatHeader(e))
+	if e.TextPayload != "" {
+		fmt.Fprintf(&b, "\n%s", formatTextPayload(e.TextPayload))
+	}
+	if len(e.JSONPayload) > 0 {
+		if headline, ok := formatHeadline(e); ok {
+			fmt.Fprintf(&b, "\n%s", headline)
+		} else if compact, err := json.Marshal(e.JSONPayload); err == nil {
+			fmt.Fprintf(&b, "\njson: %s", compact)
+		}
+	}
+	return b.String()
+}
+
+// payloadString returns the first of the dotted jsonPayload paths that holds
+// a non-empty value, as text.
+func payloadString(e *LogEntry, paths ...string) string {
+	for _, p := range paths {
+		if v, ok := entryField(e.JSONPayload, p); ok {
+			if s := fieldString(v); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// formatTextPayload fences a textPayload that spans several lines or holds
+// JSON or XML, so Slack keeps its layout instead of reflowing it as prose.
+// JSON is indented first. Single-line prose is returned as is.
+func formatTextPayload(text string) string {
+	trimmed := strings.TrimSpace(text)
+	switch payloadLanguage(trimmed) {
+	case "json":
+		var indented bytes.Buffer
+		if err := json.Indent(&indented, []byte(trimmed), "", "  "); err == nil {
+			trimmed = indented.String()
+		}
+		return codeBlock(trimmed)
+	case "xml":
+		return codeBlock(trimmed)
+	}
+	if strings.Contains(trimmed, "\n") {
+		return codeBlock(trimmed)
+	}
+	return text
+}
+
+// payloadLanguage reports whether text is a JSON object or array ("json")
+// or an XML document ("xml"), or "" for anything else.
+func payloadLanguage(text string) string {
+	text = strings.TrimSpace(text)
+	switch {
+	case text == "":
+		return ""
+	case (text[0] == '{' || text[0] == '[') && json.Valid([]byte(text)):
+		return "json"
+	case text[0] == '<' && text[len(text)-1] == '>' && wellFormedXML(text):
+		return "xml"
+	}
+	return ""
+}
+
+// wellFormedXML reports whether text parses as XML with at least one element.
+func wellFormedXML(text string) bool {
+	dec := xml.NewDecoder(strings.NewReader(text))
+	elements := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return err == io.EOF && elements > 0
+		}
+		if _, ok := tok.(xml.StartElement); ok {
+			elements++
+		}
+	}
+}
+
+// codeBlock fences text for Slack. Slack shows a language after the opening
+// fence as part of the code, so hints go into snippet filenames instead.
+func codeBlock(text string) string {
+	// a fence inside the text would end the code block early
+	return "```\n" + strings.ReplaceAll(text, "```", "`\u200b``") + "\n```"
+}
+
+// firstTextLine returns the first line of text, skipping an opening code
+// fence so previews show content rather than backticks.
+func firstTextLine(text string) string {
+	first, rest, _ := strings.Cut(text, "\n")
+	if first == "```" {
+		first, _, _ = strings.Cut(rest, "\n")
+	}
+	return first
+}
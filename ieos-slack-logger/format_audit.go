@@ -0,0 +1,71 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+)
+
+const auditLogType = "type.googleapis.com/google.cloud.audit.AuditLog"
+
+// auditLog is the part of google.cloud.audit.AuditLog needed for alerts.
+type auditLog struct {
+	Type               string `json:"@type"`
+	ServiceName        string `json:"serviceName"`
+	MethodName         string `json:"methodName"`
+	ResourceName       string `json:"resourceName"`
+	AuthenticationInfo struct {
+		PrincipalEmail string `json:"principalEmail"`
+	} `json:"authenticationInfo"`
+	RequestMetadata struct {
+		CallerIP string `json:"callerIp"`
+	} `json:"requestMetadata"`
+	Status *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"status"`
+}
+
+// formatAuditLog renders admin activity, data access and IAM audit entries.
+func formatAuditLog(e *LogEntry) (string, bool) {
+	if len(e.ProtoPayload) == 0 {
+		return "", false
+	}
+	var a auditLog
+	if err := json.Unmarshal(e.ProtoPayload, &a); err != nil || a.Type != auditLogType {
+		return "", false
+	}
+
+	var b strings.Builder
+	b.WriteString(formatHeader(e))
+	fmt.Fprintf(&b, "\nAudit: `%s`", a.MethodName)
+	if a.ServiceName != "" {
+		fmt.Fprintf(&b, " (%s)", a.ServiceName)
+	}
+	if a.ResourceName != "" {
+		fmt.Fprintf(&b, "\nresource: `%s`", a.ResourceName)
+	}
+	principal := a.AuthenticationInfo.PrincipalEmail
+	if principal == "" {
+		principal = "unknown principal"
+	}
+	fmt.Fprintf(&b, "\nprincipal: %s", principal)
+	if a.RequestMetadata.CallerIP != "" {
+		fmt.Fprintf(&b, " from %s", a.RequestMetadata.CallerIP)
+	}
+	fmt.Fprintf(&b, "\nstatus: %s", auditStatus(a))
+	return b.String(), true
+}
+
+func auditStatus(a auditLog) string {
+	if a.Status == nil || a.Status.Code == 0 {
+		return "OK"
+	}
+	s := codes.Code(a.Status.Code).String()
+	if a.Status.Message != "" {
+		s += " - " + a.Status.Message
+	}
+	return s
+}
@@ -0,0 +1,88 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	reportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+	errorReportMaxFrames   = 5
+)
+
+// goFrameRE matches the file line of a Go stack frame, e.g.
+// "\t/app/main.go:42 +0x1d".
+var goFrameRE = regexp.MustCompile(`\.go:\d+( \+0x[0-9a-f]+)?$`)
+
+// formatErrorReport renders ReportedErrorEvent payloads the way the Error
+// Reporting console summarises them: exception, service/version, top frames.
+func formatErrorReport(e *LogEntry) (string, bool) {
+	if len(e.JSONPayload) == 0 {
+		return "", false
+	}
+	message, _ := e.JSONPayload["message"].(string)
+	svcCtx, _ := e.JSONPayload["serviceContext"].(map[string]any)
+	typ, _ := e.JSONPayload["@type"].(string)
+	frames := stackFrames(message)
+	if message == "" || (typ != reportedErrorEventType && (svcCtx == nil || len(frames) == 0)) {
+		return "", false
+	}
+
+	var b strings.Builder
+	b.WriteString(formatHeader(e))
+	fmt.Fprintf(&b, "\n*%s*", exceptionLine(message))
+	service, _ := svcCtx["service"].(string)
+	version, _ := svcCtx["version"].(string)
+	if service != "" {
+		fmt.Fprintf(&b, "\nservice: `%s`", service)
+		if version != "" {
+			fmt.Fprintf(&b, " version: `%s`", version)
+		}
+	}
+	if len(frames) > 0 {
+		if len(frames) > errorReportMaxFrames {
+			frames = frames[:errorReportMaxFrames]
+		}
+		fmt.Fprintf(&b, "\n```\n%s\n```", strings.Join(frames, "\n"))
+	}
+	return b.String(), true
+}
+
+// exceptionLine picks the line naming the exception: the last line of a
+// Python traceback, otherwise the first line (Java, Node, .NET, Go panics).
+func exceptionLine(message string) string {
+	lines := strings.Split(strings.TrimSpace(message), "\n")
+	if strings.HasPrefix(lines[0], "Traceback (most recent call last)") {
+		for i := len(lines) - 1; i >= 0; i-- {
+			if l := strings.TrimSpace(lines[i]); l != "" {
+				return l
+			}
+		}
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+// stackFrames returns the frame lines of a stack trace, innermost first.
+func stackFrames(message string) []string {
+	var frames []string
+	lines := strings.Split(message, "\n")
+	python := strings.HasPrefix(strings.TrimSpace(message), "Traceback (most recent call last)")
+	for i, line := range lines {
+		l := strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(l, "at "), strings.HasPrefix(l, `File "`):
+			frames = append(frames, l)
+		case goFrameRE.MatchString(l) && i > 0:
+			// Go prints the function on the line before its file:line.
+			frames = append(frames, strings.TrimSpace(lines[i-1])+" "+l)
+		}
+	}
+	if python {
+		// Python prints the outermost call first.
+		for i, j := 0, len(frames)-1; i < j; i, j = i+1, j-1 {
+			frames[i], frames[j] = frames[j], frames[i]
+		}
+	}
+	return frames
+}
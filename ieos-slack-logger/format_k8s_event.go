@@ -0,0 +1,57 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// formatK8sEvent renders Kubernetes events exported by GKE (the "events"
+// log) with the reason, the object it concerns and how often it repeated,
+// e.g. OOMKilled, BackOff or FailedScheduling.
+func formatK8sEvent(e *LogEntry) (string, bool) {
+	if len(e.JSONPayload) == 0 || !strings.HasSuffix(e.LogName, "/logs/events") {
+		return "", false
+	}
+	if kind, _ := e.JSONPayload["kind"].(string); kind != "Event" {
+		return "", false
+	}
+	reason := payloadString(e, "reason")
+	if reason == "" {
+		return "", false
+	}
+
+	var b strings.Builder
+	b.WriteString(formatHeader(e))
+	fmt.Fprintf(&b, "\nKubernetes event: *%s*", reason)
+	if typ := payloadString(e, "type"); typ != "" && typ != "Normal" {
+		fmt.Fprintf(&b, " (%s)", typ)
+	}
+	kind := payloadString(e, "involvedObject.kind")
+	name := payloadString(e, "involvedObject.name")
+	if name != "" {
+		if kind == "" {
+			kind = "object"
+		}
+		fmt.Fprintf(&b, "\n%s: `%s`", strings.ToLower(kind), name)
+	}
+	namespace := payloadString(e, "involvedObject.namespace")
+	if namespace == "" {
+		namespace = e.Resource.Labels["namespace_name"]
+	}
+	if namespace != "" {
+		fmt.Fprintf(&b, "\nnamespace: `%s`", namespace)
+	}
+	if cluster := e.Resource.Labels["cluster_name"]; cluster != "" {
+		fmt.Fprintf(&b, "\ncluster: `%s`", cluster)
+		if location := e.Resource.Labels["location"]; location != "" {
+			fmt.Fprintf(&b, " (%s)", location)
+		}
+	}
+	if count := payloadString(e, "count", "series.count"); count != "" && count != "1" {
+		fmt.Fprintf(&b, "\ncount: %s", count)
+	}
+	if message := payloadString(e, "message", "note"); message != "" {
+		fmt.Fprintf(&b, "\n%s", message)
+	}
+	return b.String(), true
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// stackPayloadFields are the jsonPayload fields loggers put stack traces in.
+var stackPayloadFields = []string{"stack", "stack_trace", "stacktrace", "exception"}
+
+// entryStack returns the multi-line stack trace in the entry's textPayload
+// or jsonPayload, and any jsonPayload message that accompanies it.
+func entryStack(e *LogEntry) (stack, message string) {
+	if strings.Contains(e.TextPayload, "\n") && len(stackFrames(e.TextPayload)) > 0 {
+		return e.TextPayload, ""
+	}
+	for _, field := range stackPayloadFields {
+		if s, _ := e.JSONPayload[field].(string); strings.Contains(s, "\n") && len(stackFrames(s)) > 0 {
+			message, _ = e.JSONPayload["message"].(string)
+			return s, message
+		}
+	}
+	return "", ""
+}
+
+// formatStackTrace renders entries carrying a stack trace as a headline with
+// the exception and its innermost frame, followed by the trace in a code
+// block so Slack keeps its line breaks.
+func formatStackTrace(e *LogEntry) (string, bool) {
+	stack, message := entryStack(e)
+	if stack == "" {
+		return "", false
+	}
+	var b strings.Builder
+	b.WriteString(formatHeader(e))
+	fmt.Fprintf(&b, "\n*%s*", exceptionLine(stack))
+	if frames := stackFrames(stack); len(frames) > 0 {
+		fmt.Fprintf(&b, " at `%s`", strings.TrimPrefix(frames[0], "at "))
+	}
+	if message != "" && !strings.HasPrefix(stack, message) {
+		fmt.Fprintf(&b, "\n%s", message)
+	}
+	fmt.Fprintf(&b, "\n%s", codeBlock(strings.TrimSpace(stack)))
+	return b.String(), true
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const (
+	uptimeResourceType = "uptime_url"
+	uptimeLogID        = "monitoring.googleapis.com%2Fuptime_checks"
+)
+
+// uptimeReasonFields are the jsonPayload fields describing why a check
+// failed, most specific first.
+var uptimeReasonFields = []string{"checkFailureReason", "failureReason", "errorCode", "message"}
+
+// isUptimeCheck reports whether e is a Cloud Monitoring uptime check result.
+func isUptimeCheck(e *LogEntry) bool {
+	if e.Resource.Type == uptimeResourceType || strings.HasSuffix(e.LogName, "/logs/"+uptimeLogID) {
+		return true
+	}
+	typ, _ := e.JSONPayload["@type"].(string)
+	return strings.Contains(strings.ToLower(typ), "uptime")
+}
+
+// formatUptimeCheck renders uptime check results with the check, its target,
+// the checker region and the failure reason, linking to the incident when
+// the result names one and to the check otherwise.
+func formatUptimeCheck(e *LogEntry) (string, bool) {
+	if len(e.JSONPayload) == 0 || !isUptimeCheck(e) {
+		return "", false
+	}
+	checkID := payloadString(e, "checkId", "uptimeCheckId")
+	if checkID == "" {
+		checkID = e.Resource.Labels["check_id"]
+	}
+	name := payloadString(e, "checkDisplayName", "checkName", "displayName")
+	if name == "" {
+		name = checkID
+	}
+
+	var b strings.Builder
+	b.WriteString(formatHeader(e))
+	if passed, _ := e.JSONPayload["checkPassed"].(bool); passed {
+		fmt.Fprintf(&b, "\n:white_check_mark: Uptime check *%s* passed", name)
+	} else {
+		fmt.Fprintf(&b, "\n:rotating_light: Uptime check *%s* failed", name)
+	}
+	if target := uptimeTarget(e); target != "" {
+		fmt.Fprintf(&b, "\ntarget: %s", target)
+	}
+	if region := payloadString(e, "checkerLocation", "region"); region != "" {
+		fmt.Fprintf(&b, "\nregion: `%s`", region)
+	}
+	if reason := uptimeReason(e); reason != "" {
+		fmt.Fprintf(&b, "\nreason: %s", reason)
+	}
+	if u := payloadString(e, "incidentUrl", "incident.url"); u != "" {
+		fmt.Fprintf(&b, "\n<%s|Open incident>", u)
+	} else if u := uptimeCheckURL(e, checkID); u != "" {
+		fmt.Fprintf(&b, "\n<%s|Open uptime check>", u)
+	}
+	return b.String(), true
+}
+
+// uptimeTarget is the URL the checker requested.
+func uptimeTarget(e *LogEntry) string {
+	if u := payloadString(e, "requestUrl", "httpRequest.requestUrl", "checkRequest.url"); u != "" {
+		return u
+	}
+	if e.HTTPRequest != nil && e.HTTPRequest.RequestURL != "" {
+		return e.HTTPRequest.RequestURL
+	}
+	if host := e.Resource.Labels["host"]; host != "" {
+		return "https://" + host
+	}
+	return ""
+}
+
+// uptimeReason joins the failure reason with the response status, if any.
+func uptimeReason(e *LogEntry) string {
+	reason := payloadString(e, uptimeReasonFields...)
+	status := payloadString(e, "responseCode", "statusCode", "httpRequest.status")
+	if status == "" && e.HTTPRequest != nil && e.HTTPRequest.Status != 0 {
+		status = fmt.Sprint(e.HTTPRequest.Status)
+	}
+	switch {
+	case status != "" && reason != "":
+		return fmt.Sprintf("%s (HTTP %s)", reason, status)
+	case status != "":
+		return "HTTP " + status
+	}
+	return reason
+}
+
+// uptimeCheckURL is the check's page in the Monitoring console.
+func uptimeCheckURL(e *LogEntry, checkID string) string {
+	project := logProject(e.LogName)
+	if project == "" {
+		project = e.Resource.Labels["project_id"]
+	}
+	if project == "" || checkID == "" {
+		return ""
+	}
+	return fmt.Sprintf("https://console.cloud.google.com/monitoring/uptime/%s?project=%s", url.PathEscape(checkID), url.QueryEscape(project))
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// SLACK_GROUPING_RULES replaces the default fingerprint, which decides what
+// counts as "the same alert" for dedup, acks, threading and escalation, with
+// a CEL expression over the entry, one rule per line:
+//
+//	<log ID> <CEL expression>
+//
+// e.g. "payments resource.labels.service_name + ':' + jsonPayload.errorCode"
+// groups the payments log by service and error code whatever the message
+// says. The log ID is unescaped and may be "*". Expressions see logName,
+// severity, insertId, trace, textPayload, message (jsonPayload.message or
+// textPayload), labels, resource (type and labels) and jsonPayload. The
+// first rule for the entry's log wins; when its expression fails, e.g. on a
+// missing field (guard with has()), the default fingerprint is used.
+
+// groupingRule is one line of SLACK_GROUPING_RULES.
+type groupingRule struct {
+	logID   string // "*" matches every log
+	expr    string
+	program cel.Program
+}
+
+var groupingEnv = sync.OnceValues(func() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("logName", cel.StringType),
+		cel.Variable("severity", cel.StringType),
+		cel.Variable("insertId", cel.StringType),
+		cel.Variable("trace", cel.StringType),
+		cel.Variable("textPayload", cel.StringType),
+		cel.Variable("message", cel.StringType),
+		cel.Variable("labels", cel.MapType(cel.StringType, cel.StringType)),
+		cel.Variable("resource", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("jsonPayload", cel.MapType(cel.StringType, cel.DynType)),
+	)
+})
+
+// parseGroupingRule parses and compiles one rule line.
+func parseGroupingRule(spec string) (groupingRule, error) {
+	var r groupingRule
+	logID, expr, ok := strings.Cut(strings.TrimSpace(spec), " ")
+	if expr = strings.TrimSpace(expr); !ok || expr == "" {
+		return r, fmt.Errorf("invalid grouping rule %q: expected <log ID> <CEL expression>", spec)
+	}
+	env, err := groupingEnv()
+	if err != nil {
+		return r, err
+	}
+	ast, iss := env.Compile(expr)
+	if iss.Err() != nil {
+		return r, fmt.Errorf("invalid grouping rule %q: %v", spec, iss.Err())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return r, fmt.Errorf("invalid grouping rule %q: %v", spec, err)
+	}
+	r.logID, r.expr, r.program = logID, expr, program
+	return r, nil
+}
+
+// groupingActivation exposes the entry to grouping expressions.
+func groupingActivation(e *LogEntry) map[string]any {
+	message, _ := e.JSONPayload["message"].(string)
+	if message == "" {
+		message = e.TextPayload
+	}
+	orEmpty := func(m map[string]string) map[string]string {
+		if m == nil {
+			return map[string]string{}
+		}
+		return m
+	}
+	payload := e.JSONPayload
+	if payload == nil {
+		payload = map[string]any{}
+	}
+	return map[string]any{
+		"logName":     e.LogName,
+		"severity":    e.Severity,
+		"insertId":    e.InsertID,
+		"trace":       e.Trace,
+		"textPayload": e.TextPayload,
+		"message":     message,
+		"labels":      orEmpty(e.Labels),
+		"resource":    map[string]any{"type": e.Resource.Type, "labels": orEmpty(e.Resource.Labels)},
+		"jsonPayload": payload,
+	}
+}
+
+var (
+	groupingRules         []groupingRule
+	groupingRulesInitOnce configOnce
+)
+
+func getGroupingRules() []groupingRule {
+	groupingRulesInitOnce.Do(func() {
+		groupingRules = nil
+		for _, spec := range strings.Split(setting("SLACK_GROUPING_RULES"), "\n") {
+			if spec = strings.TrimSpace(spec); spec == "" {
+				continue
+			}
+			r, err := parseGroupingRule(spec)
+			if err != nil {
+				log.Printf("%v, skipped", err)
+				continue
+			}
+			groupingRules = append(groupingRules, r)
+		}
+	})
+	return groupingRules
+}
+
+// groupingFingerprint returns the fingerprint of the entry per the first
+// grouping rule for its log, or "" when there is none or it fails.
+func groupingFingerprint(e *LogEntry) string {
+	rules := getGroupingRules()
+	if len(rules) == 0 {
+		return ""
+	}
+	logID := entryLogID(e)
+	for _, r := range rules {
+		if r.logID != "*" && r.logID != logID {
+			continue
+		}
+		out, _, err := r.program.Eval(groupingActivation(e))
+		if err != nil {
+			return ""
+		}
+		sum := sha256.Sum256([]byte(r.expr + "\x00" + fmt.Sprint(out.Value())))
+		return hex.EncodeToString(sum[:])[:16]
+	}
+	return ""
+}
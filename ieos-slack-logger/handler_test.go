@@ -0,0 +1,660 @@
+package service_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	service "github.com/print-engine/ieos-golang-utils/ieos-slack-logger"
+	"github.com/print-engine/ieos-golang-utils/ieos-slack-logger/slacktest"
+)
+
+var fake = slacktest.New()
+
+func TestMain(m *testing.M) {
+	n, err := service.NewNotifier(context.Background(), service.NotifierConfig{API: fake, SkipAuthTest: true})
+	if err != nil {
+		panic(err)
+	}
+	service.UseWorkspaces(service.NewWorkspaces(map[string]*service.Notifier{"": n}))
+	os.Exit(m.Run())
+}
+
+func TestHandleLogAlertFixtures(t *testing.T) {
+	tests := []struct {
+		fixture     string
+		wantChannel string
+		wantColor   string
+		want        []string
+		notWant     []string
+		wantBlocks  []string
+	}{
+		{
+			fixture:     "text_payload.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{":red_circle: *PROD* :red_square: [ERROR] projects/acme-prod/logs/run.googleapis.com%2Fstderr", "failed to reserve inventory: connection refused"},
+		},
+		{
+			fixture:     "json_payload.json",
+			wantChannel: "C_WARNINGS",
+			want:        []string{"[WARNING] projects/acme-prod/logs/payments", `"message":"payment capture timed out"`, `"orderId":"A-1009"`},
+		},
+		{
+			fixture:     "audit_log.json",
+			wantChannel: "C_WARNINGS",
+			want:        []string{"Audit: `SetIamPolicy` (cloudresourcemanager.googleapis.com)", "from 203.0.113.7", "status: PermissionDenied - Permission denied"},
+		},
+		{
+			fixture:     "error_report.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{"*java.lang.NullPointerException: cart is null*", "service: `cart` version: `2026.10.1`", "at com.acme.cart.CartService.total(CartService.java:88)"},
+		},
+		{
+			fixture:     "k8s_container.json",
+			wantChannel: "C_STAGING",
+			want:        []string{":large_orange_circle: *STAGING*", "*panic: runtime error: index out of range [3] with length 3* at `main.pick(...) /app/main.go:27 +0x1d`", "```\npanic:"},
+			notWant:     []string{"json: "},
+		},
+		{
+			fixture:     "uptime_check.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{"Uptime check *storefront homepage* failed", "target: https://shop.acme.example/", "region: `eur-belgium`", "reason: Response timed out (HTTP 504)", "<https://console.cloud.google.com/monitoring/uptime/storefront-homepage-x7Yq?project=acme-prod|Open uptime check>"},
+		},
+		{
+			fixture:     "k8s_event.json",
+			wantChannel: "C_WARNINGS",
+			want:        []string{"Kubernetes event: *BackOff* (Warning)", "pod: `render-worker-6d9f7c5b8-kx2lp`", "namespace: `print`", "cluster: `print-prod` (europe-west1)", "count: 7"},
+		},
+		{
+			fixture:     "cloud_build.json",
+			wantChannel: "C_BUILDS",
+			wantColor:   "#D32F2F",
+			want:        []string{"[ERROR] Cloud Build: FAILURE print-engine-render", "trigger: `render-main`", "branch: `main` @ `a1b2c3d`", "duration: 4m42s", "|Open build>"},
+		},
+		{
+			fixture:     "print_job.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{"imposition failed: bleed exceeds sheet"},
+			wantBlocks:  []string{"https://ops.example.com/jobs/J-20261014-0042?facility=leipzig|J-20261014-0042", "`A-2231`", "`leipzig`", "`prepress`"},
+		},
+		{
+			fixture:     "json_text_payload.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{"```\n{\n  \"error\": \"carrier rejected label\",", "\n  \"shipment\": {\n    \"id\": \"S-77120\","},
+		},
+		{
+			fixture:     "severity_rule.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{"[ERROR] projects/acme-prod/logs/payments-worker", "settlement batch 2026-10-14 retried 3 times"},
+		},
+		{
+			fixture:     "monitoring_incident.json",
+			wantChannel: "C_ERRORS",
+			want:        []string{"[CRITICAL] Cloud Monitoring: Storefront 5xx ratio", "incident: `0.nb2k7e1rkx4h` state: *OPEN*", "condition: 5xx ratio above 5%", "resource: `storefront cloud_run_revision`", "|Open incident>"},
+		},
+		{
+			fixture:     "billing_budget.json",
+			wantChannel: "C_FINANCE",
+			want:        []string{"[WARNING] Billing budget: acme-prod monthly", "<!subteam^S0FINANCE>", "*90%* of the budget reached", "cost so far: 9120.44 USD of 10000.00 USD (91%)"},
+		},
+	}
+
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+	t.Setenv("SLACK_WARNING_CHANNEL_ID", "C_WARNINGS")
+	t.Setenv("SLACK_DEFAULT_CHANNEL_ID", "C_DEFAULT")
+	t.Setenv("SLACK_DEFAULT_CHANNEL_ID_ACME_STAGING", "C_STAGING")
+	t.Setenv("SLACK_BILLING_CHANNEL_ID", "C_FINANCE")
+	t.Setenv("SLACK_BUILD_CHANNEL_ID", "C_BUILDS")
+	t.Setenv("SLACK_JOB_DASHBOARD_URL", "https://ops.example.com/jobs/{{.JobID}}?facility={{.Facility}}")
+	t.Setenv("SLACK_BILLING_MENTION", "S0FINANCE")
+	t.Setenv("SLACK_ENVIRONMENTS", "acme-prod=prod,acme-staging=staging")
+	t.Setenv("SLACK_SEVERITY_RULES", "payments-worker WARNING=ERROR\nrun.googleapis.com/stderr ERROR=NOTICE ~cache warm-up")
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+			fake.Reset()
+			// budget thresholds are announced once per budget, so every run
+			// needs its own
+			attrs := map[string]string{"budgetId": fmt.Sprintf("%s-%d", tt.fixture, time.Now().UnixNano())}
+			if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data, Attributes: attrs}); err != nil {
+				t.Fatalf("HandleLogAlert: %v", err)
+			}
+			msgs := fake.Messages()
+			if len(msgs) != 1 {
+				t.Fatalf("posted %d messages, want 1", len(msgs))
+			}
+			if msgs[0].Channel != tt.wantChannel {
+				t.Errorf("posted to %s, want %s", msgs[0].Channel, tt.wantChannel)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(msgs[0].Text, s) {
+					t.Errorf("message does not contain %q:\n%s", s, msgs[0].Text)
+				}
+			}
+			if tt.wantColor != "" && (len(msgs[0].Attachments) != 1 || !strings.Contains(string(msgs[0].Attachments[0]), `"color":"`+tt.wantColor+`"`)) {
+				t.Errorf("attachments %s, want one colored %s", msgs[0].Attachments, tt.wantColor)
+			}
+			blocks := fmt.Sprintf("%s", msgs[0].Blocks)
+			for _, s := range tt.wantBlocks {
+				if !strings.Contains(blocks, s) {
+					t.Errorf("blocks do not contain %q:\n%s", s, blocks)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(msgs[0].Text, s) {
+					t.Errorf("message contains %q:\n%s", s, msgs[0].Text)
+				}
+			}
+		})
+	}
+}
+
+func TestHandleLogAlertSeverityFloor(t *testing.T) {
+	t.Setenv("SLACK_WARNING_CHANNEL_ID", "C_WARNINGS,webhook:unused>=ERROR")
+
+	data, err := os.ReadFile(filepath.Join("testdata", "json_payload.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Reset()
+	if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+		t.Fatalf("HandleLogAlert: %v", err)
+	}
+	if msgs := fake.Messages(); len(msgs) != 1 || msgs[0].Channel != "C_WARNINGS" {
+		t.Fatalf("got %+v, want one message to C_WARNINGS", msgs)
+	}
+}
+
+func TestHandleLogAlertRejectsInvalidJSON(t *testing.T) {
+	fake.Reset()
+	if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: []byte("{not json")}); err == nil {
+		t.Fatal("HandleLogAlert succeeded on invalid JSON")
+	}
+	if n := len(fake.Messages()); n != 0 {
+		t.Fatalf("posted %d messages for invalid JSON", n)
+	}
+}
+
+func TestHandleLogAlertWorkflowSink(t *testing.T) {
+	got := make(chan map[string]string, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var vars map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&vars); err != nil {
+			t.Errorf("decode workflow body: %v", err)
+		}
+		got <- vars
+	}))
+	defer srv.Close()
+	// sinks are cached by name, so every run needs its own
+	name := fmt.Sprintf("tickets%d", time.Now().UnixNano())
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "workflow:"+name)
+	t.Setenv("WORKFLOW_"+strings.ToUpper(name)+"_URL", srv.URL)
+
+	data, err := os.ReadFile(filepath.Join("testdata", "text_payload.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+		t.Fatalf("HandleLogAlert: %v", err)
+	}
+	vars := <-got
+	want := map[string]string{"severity": "ERROR", "message": "failed to reserve inventory: connection refused"}
+	for k, v := range want {
+		if vars[k] != v {
+			t.Errorf("%s = %q, want %q", k, vars[k], v)
+		}
+	}
+	if vars["service"] == "" || vars["logs_url"] == "" {
+		t.Errorf("missing service or logs_url in %v", vars)
+	}
+}
+
+func TestHandleLogAlertDestinationOptions(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "mentions.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		route   string
+		want    []string
+		notWant []string
+		unfurl  string
+	}{
+		{
+			route:   "C_ERRORS",
+			want:    []string{"<@U02ABCDEF>", "<!channel>"},
+			notWant: []string{"&lt;"},
+		},
+		{
+			route:   "C_ERRORS;nounfurl;nomentions",
+			want:    []string{"reported by @U02ABCDEF in #ops", "id=7&view=full @channel"},
+			notWant: []string{"<@", "<#", "<!channel>"},
+			unfurl:  "false",
+		},
+		{
+			route:   "C_ERRORS;escape",
+			want:    []string{"&lt;@U02ABCDEF&gt;", "id=7&amp;view=full &lt;!channel&gt;"},
+			notWant: []string{"<@", "<!channel>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.route, func(t *testing.T) {
+			t.Setenv("SLACK_ERROR_CHANNEL_ID", tt.route)
+			fake.Reset()
+			if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+				t.Fatalf("HandleLogAlert: %v", err)
+			}
+			msgs := fake.Messages()
+			if len(msgs) != 1 || msgs[0].Channel != "C_ERRORS" {
+				t.Fatalf("got %+v, want one message to C_ERRORS", msgs)
+			}
+			for _, s := range tt.want {
+				if !strings.Contains(msgs[0].Text, s) {
+					t.Errorf("message does not contain %q:\n%s", s, msgs[0].Text)
+				}
+			}
+			for _, s := range tt.notWant {
+				if strings.Contains(msgs[0].Text, s) {
+					t.Errorf("message contains %q:\n%s", s, msgs[0].Text)
+				}
+			}
+			if got := msgs[0].Values.Get("unfurl_links"); got != tt.unfurl {
+				t.Errorf("unfurl_links = %q, want %q", got, tt.unfurl)
+			}
+		})
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	h, err := service.NewDashboardHandler(service.DashboardConfig{Token: "s3cret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join("testdata", "error_report.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+	if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+		t.Fatalf("HandleLogAlert: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/dashboard?service=cart&severity=error&format=json", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status without token = %d, want 401", rec.Code)
+	}
+
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", rec.Code, rec.Body)
+	}
+	var got struct {
+		Alerts []struct {
+			Severity string `json:"severity"`
+			Service  string `json:"service"`
+		} `json:"alerts"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Alerts) == 0 {
+		t.Fatal("no alerts listed")
+	}
+	for _, a := range got.Alerts {
+		if a.Service != "cart" || a.Severity != "ERROR" {
+			t.Errorf("listed %+v, want only ERROR alerts of cart", a)
+		}
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/dashboard?severity=ERROR", nil)
+	req.SetBasicAuth("", "s3cret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "<td>cart</td>") {
+		t.Fatalf("html dashboard: status %d\n%s", rec.Code, rec.Body)
+	}
+}
+
+func TestVerifySlackRequests(t *testing.T) {
+	const secret = "8f742231b10e8888abcd99yyyzzz85a5"
+	h := service.VerifySlackRequests([]string{secret}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		_, _ = w.Write(body)
+	}))
+	sign := func(ts time.Time, body string) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		fmt.Fprintf(mac, "v0:%d:%s", ts.Unix(), body)
+		return "v0=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	// every run needs its own signatures, or they are replays
+	body := fmt.Sprintf("command=%%2Fieos-alerts&text=recent&nonce=%d", time.Now().UnixNano())
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		method    string
+		ts        time.Time
+		signature string
+		want      int
+	}{
+		{name: "signed", method: http.MethodPost, ts: now, signature: sign(now, body), want: http.StatusOK},
+		{name: "replayed", method: http.MethodPost, ts: now, signature: sign(now, body), want: http.StatusUnauthorized},
+		{name: "bad signature", method: http.MethodPost, ts: now, signature: sign(now, body+"&x=1"), want: http.StatusUnauthorized},
+		{name: "stale", method: http.MethodPost, ts: now.Add(-10 * time.Minute), signature: sign(now.Add(-10*time.Minute), body), want: http.StatusUnauthorized},
+		{name: "get", method: http.MethodGet, ts: now, signature: sign(now, body), want: http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/slack/commands", strings.NewReader(body))
+			req.Header.Set("X-Slack-Request-Timestamp", fmt.Sprint(tt.ts.Unix()))
+			req.Header.Set("X-Slack-Signature", tt.signature)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Fatalf("status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && rec.Body.String() != body {
+				t.Errorf("handler read body %q, want %q", rec.Body.String(), body)
+			}
+		})
+	}
+}
+
+func TestPushHandlerBurst(t *testing.T) {
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+	h, err := service.NewPushHandler(service.PushConfig{SkipAuth: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.Reset()
+
+	const n = 40
+	run := time.Now().UnixNano()
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			entry := fmt.Sprintf(`{"logName":"projects/acme-prod/logs/burst","severity":"ERROR","textPayload":"burst entry %d"}`, i)
+			body, _ := json.Marshal(map[string]any{"message": map[string]any{
+				"data":      []byte(entry),
+				"messageId": fmt.Sprintf("burst-%d-%d", run, i),
+			}})
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body)))
+			if rec.Code != http.StatusNoContent {
+				t.Errorf("push %d: status %d", i, rec.Code)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if got := len(fake.Messages()); got != n {
+		t.Fatalf("posted %d messages, want %d", got, n)
+	}
+}
+
+func TestHandleLogAlertNoiseFilters(t *testing.T) {
+	// the filters are reloadable settings, so they come from a config file
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("settings:\n  SLACK_NOISE_FILTERS: all\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACK_CONFIG", config)
+	t.Setenv("SLACK_CONFIG_REFRESH_INTERVAL", "1ns")
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+	t.Setenv("SLACK_WARNING_CHANNEL_ID", "C_WARNINGS")
+	t.Setenv("SLACK_DEFAULT_CHANNEL_ID", "C_DEFAULT")
+	t.Cleanup(func() {
+		// leave no filters active for later tests
+		_ = os.WriteFile(config, []byte("{}\n"), 0o600)
+		_ = service.HandleLogAlert(context.Background(), service.PubSubMessage{})
+	})
+
+	tests := []struct {
+		name  string
+		entry string
+		drop  bool
+	}{
+		{
+			name:  "health check request",
+			entry: `{"logName":"projects/acme-prod/logs/run.googleapis.com%2Frequests","severity":"INFO","httpRequest":{"requestMethod":"GET","requestUrl":"https://checkout.acme.example/healthz","status":200}}`,
+			drop:  true,
+		},
+		{
+			name:  "health check access log line",
+			entry: `{"logName":"projects/acme-prod/logs/nginx","severity":"INFO","textPayload":"10.0.0.7 - - [14/Oct/2026:09:00:01 +0000] \"GET /readyz HTTP/1.1\" 200 2"}`,
+			drop:  true,
+		},
+		{
+			name:  "failing health check",
+			entry: `{"logName":"projects/acme-prod/logs/run.googleapis.com%2Frequests","severity":"ERROR","httpRequest":{"requestMethod":"GET","requestUrl":"https://checkout.acme.example/healthz","status":503}}`,
+		},
+		{
+			name:  "probe failure during rollout",
+			entry: `{"logName":"projects/acme-prod/logs/events","severity":"WARNING","jsonPayload":{"kind":"Event","reason":"Unhealthy","message":"Readiness probe failed: connection refused","count":1}}`,
+			drop:  true,
+		},
+		{
+			name:  "persistent probe failure",
+			entry: `{"logName":"projects/acme-prod/logs/events","severity":"WARNING","jsonPayload":{"kind":"Event","reason":"Unhealthy","message":"Liveness probe failed: HTTP probe failed with statuscode: 500","count":12}}`,
+		},
+		{
+			name:  "context canceled",
+			entry: `{"logName":"projects/acme-prod/logs/run.googleapis.com%2Fstderr","severity":"ERROR","textPayload":"render: context canceled"}`,
+			drop:  true,
+		},
+		{
+			name:  "critical context canceled",
+			entry: `{"logName":"projects/acme-prod/logs/run.googleapis.com%2Fstderr","severity":"CRITICAL","textPayload":"ledger commit: context canceled"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake.Reset()
+			if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: []byte(tt.entry)}); err != nil {
+				t.Fatalf("HandleLogAlert: %v", err)
+			}
+			want := 1
+			if tt.drop {
+				want = 0
+			}
+			if got := len(fake.Messages()); got != want {
+				t.Fatalf("posted %d messages, want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestHandleLogAlertChannelByName(t *testing.T) {
+	fake.AddChannel("C_NAMED", "alerts-named", false, false)
+	fake.AddChannel("C_SECRET", "alerts-secret", true, false)
+	data, err := os.ReadFile(filepath.Join("testdata", "text_payload.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("public", func(t *testing.T) {
+		t.Setenv("SLACK_ERROR_CHANNEL_ID", "#alerts-named")
+		fake.Reset()
+		if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+			t.Fatalf("HandleLogAlert: %v", err)
+		}
+		if msgs := fake.Messages(); len(msgs) != 1 || msgs[0].Channel != "C_NAMED" {
+			t.Fatalf("got %+v, want one message to C_NAMED", msgs)
+		}
+	})
+	t.Run("private without the bot", func(t *testing.T) {
+		t.Setenv("SLACK_ERROR_CHANNEL_ID", "#alerts-secret")
+		fake.Reset()
+		_ = service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data})
+		if msgs := fake.Messages(); len(msgs) != 0 {
+			t.Fatalf("posted %+v to a private channel the bot is not in", msgs)
+		}
+	})
+}
+
+func TestHandleLogAlertIncidentClosed(t *testing.T) {
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+	data, err := os.ReadFile(filepath.Join("testdata", "monitoring_incident.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// incidents are remembered per process, so this one is not the fixture's
+	opened := bytes.ReplaceAll(data, []byte("0.nb2k7e1rkx4h"), []byte("0.closedinctest"))
+	closed := bytes.Replace(opened, []byte(`"state": "open"`), []byte(`"state": "closed"`), 1)
+	closed = bytes.Replace(closed, []byte(`"ended_at": null`), []byte(`"ended_at": 1792326300`), 1)
+
+	fake.Reset()
+	for _, data := range [][]byte{opened, opened, closed} {
+		if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+			t.Fatalf("HandleLogAlert: %v", err)
+		}
+	}
+	msgs := fake.Messages()
+	if len(msgs) != 1 {
+		t.Fatalf("posted %d messages, want 1", len(msgs))
+	}
+	updates := fake.Updates()
+	if len(updates) != 1 || updates[0].Channel != "C_ERRORS" || updates[0].Timestamp != msgs[0].Timestamp {
+		t.Fatalf("got updates %+v, want one of %s in C_ERRORS", updates, msgs[0].Timestamp)
+	}
+	for _, s := range []string{"incident closed after 25m0s", "state: *CLOSED*"} {
+		if !strings.Contains(updates[0].Text, s) {
+			t.Errorf("update does not contain %q:\n%s", s, updates[0].Text)
+		}
+	}
+}
+
+func TestHandleLogAlertGroupingRules(t *testing.T) {
+	// grouping rules are reloadable settings, so they come from a config file
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	rules := "grouping_rules:\n  - {log: payments, key: \"resource.labels.function_name + ':' + jsonPayload.errorCode\"}\n"
+	if err := os.WriteFile(config, []byte(rules), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SLACK_CONFIG", config)
+	t.Setenv("SLACK_CONFIG_REFRESH_INTERVAL", "1ns")
+	t.Setenv("SLACK_WARNING_CHANNEL_ID", "C_WARNINGS")
+	t.Cleanup(func() {
+		// leave no rules active for later tests
+		_ = os.WriteFile(config, []byte("{}\n"), 0o600)
+		_ = service.HandleLogAlert(context.Background(), service.PubSubMessage{})
+	})
+
+	fake.Reset()
+	for _, entry := range []string{
+		`{"logName":"projects/acme-prod/logs/payments","severity":"WARNING","resource":{"type":"cloud_function","labels":{"function_name":"capture-payment"}},"jsonPayload":{"message":"capture of A-1009 declined","errorCode":"card_declined"}}`,
+		`{"logName":"projects/acme-prod/logs/payments","severity":"WARNING","resource":{"type":"cloud_function","labels":{"function_name":"capture-payment"}},"jsonPayload":{"message":"issuer refused B-2231","errorCode":"card_declined"}}`,
+		`{"logName":"projects/acme-prod/logs/payments","severity":"WARNING","resource":{"type":"cloud_function","labels":{"function_name":"capture-payment"}},"jsonPayload":{"message":"capture of A-1009 declined","errorCode":"insufficient_funds"}}`,
+	} {
+		if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: []byte(entry)}); err != nil {
+			t.Fatalf("HandleLogAlert: %v", err)
+		}
+	}
+	msgs := fake.Messages()
+	if len(msgs) != 3 {
+		t.Fatalf("posted %d messages, want 3", len(msgs))
+	}
+	fp := func(m slacktest.Message) any { return m.Metadata.EventPayload["fingerprint"] }
+	if fp(msgs[0]) == nil || fp(msgs[0]) != fp(msgs[1]) {
+		t.Errorf("same error code grouped as %v and %v, want one fingerprint", fp(msgs[0]), fp(msgs[1]))
+	}
+	if fp(msgs[0]) == fp(msgs[2]) {
+		t.Errorf("different error codes share fingerprint %v", fp(msgs[0]))
+	}
+}
+
+func TestHandleLogAlertDryRun(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "text_payload.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("destination", func(t *testing.T) {
+		t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_CANARY;dryrun,C_ERRORS")
+		fake.Reset()
+		if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+			t.Fatalf("HandleLogAlert: %v", err)
+		}
+		if msgs := fake.Messages(); len(msgs) != 1 || msgs[0].Channel != "C_ERRORS" {
+			t.Fatalf("got %+v, want one message to C_ERRORS", msgs)
+		}
+	})
+	t.Run("everywhere", func(t *testing.T) {
+		t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+		t.Setenv("SLACK_DRY_RUN", "true")
+		fake.Reset()
+		if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: data}); err != nil {
+			t.Fatalf("HandleLogAlert: %v", err)
+		}
+		if msgs := fake.Messages(); len(msgs) != 0 {
+			t.Fatalf("posted %+v in dry-run mode", msgs)
+		}
+	})
+}
+
+func TestHandleLogAlertBudgetSurvivesReload(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig := func(settings string) {
+		t.Helper()
+		if err := os.WriteFile(config, []byte("settings:\n"+settings), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeConfig("  SLACK_CHANNEL_BUDGETS: C_ERRORS=1/1h\n")
+	t.Setenv("SLACK_CONFIG", config)
+	t.Setenv("SLACK_CONFIG_REFRESH_INTERVAL", "1ns")
+	t.Setenv("SLACK_ERROR_CHANNEL_ID", "C_ERRORS")
+	t.Cleanup(func() {
+		_ = os.WriteFile(config, []byte("{}\n"), 0o600)
+		_ = service.HandleLogAlert(context.Background(), service.PubSubMessage{})
+	})
+	fake.Reset()
+
+	send := func(i int) {
+		t.Helper()
+		entry := fmt.Sprintf(`{"logName":"projects/acme-prod/logs/billing","severity":"ERROR","textPayload":"invoice %d failed"}`, i)
+		if err := service.HandleLogAlert(context.Background(), service.PubSubMessage{Data: []byte(entry)}); err != nil {
+			t.Fatalf("HandleLogAlert: %v", err)
+		}
+	}
+	send(1)
+	send(2)
+	// an unrelated change reloads the config; the window and the drop are kept
+	writeConfig("  SLACK_CHANNEL_BUDGETS: C_ERRORS=1/1h\n  SLACK_DEFAULT_CHANNEL_ID: C_DEFAULT\n")
+	send(3)
+	if got := len(fake.Messages()); got != 1 {
+		t.Fatalf("posted %d messages, want 1 within the budget", got)
+	}
+
+	writeConfig("  SLACK_DEFAULT_CHANNEL_ID: C_DEFAULT\n")
+	send(4)
+	msgs := fake.Messages()
+	if len(msgs) != 3 {
+		t.Fatalf("got %d messages, want the alert, the drop summary and the next alert", len(msgs))
+	}
+	if !strings.Contains(msgs[1].Text, "2 alert(s) dropped") {
+		t.Errorf("summary does not count both drops:\n%s", msgs[1].Text)
+	}
+}
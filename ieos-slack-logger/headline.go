@@ -0,0 +1,128 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// SLACK_HEADLINE_FIELDS lists LogEntry fields, as dotted paths, that make up
+// the headline of entries with a jsonPayload instead of the compact
+// jsonPayload dump, e.g.
+//
+//	SLACK_HEADLINE_FIELDS=jsonPayload.message,jsonPayload.job.id,resource.labels.location
+//
+// renders "Job failed · id: 42 · location: us-central1". The first field is
+// shown bare and later ones with their name; list elements are addressed by
+// index ("jsonPayload.errors.0.reason"). SLACK_HEADLINE_FIELDS_<LOG> overrides
+// the list for one log ID, e.g. SLACK_HEADLINE_FIELDS_PAYMENTS_WORKER for
+// "projects/p/logs/payments-worker". When none of the fields are present the
+// jsonPayload is dumped as before.
+
+const headlineSeparator = " · "
+
+var nonEnvCharsRE = regexp.MustCompile(`[^A-Z0-9]+`)
+
+// logSettingName turns the log ID of logName into a settings suffix.
+func logSettingName(logName string) string {
+	_, id, ok := strings.Cut(logName, "/logs/")
+	if !ok {
+		return ""
+	}
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		id = unescaped
+	}
+	return strings.Trim(nonEnvCharsRE.ReplaceAllString(strings.ToUpper(id), "_"), "_")
+}
+
+// headlineFields returns the configured field paths for an entry's log.
+func headlineFields(e *LogEntry) []string {
+	spec := ""
+	if name := logSettingName(e.LogName); name != "" {
+		spec = setting("SLACK_HEADLINE_FIELDS_" + name)
+	}
+	if spec == "" {
+		spec = setting("SLACK_HEADLINE_FIELDS")
+	}
+	var paths []string
+	for _, p := range strings.Split(spec, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			paths = append(paths, p)
+		}
+	}
+	return paths
+}
+
+// entryField resolves a dotted path against the entry's JSON form.
+func entryField(root map[string]any, path string) (any, bool) {
+	var cur any = root
+	for _, seg := range strings.Split(path, ".") {
+		switch v := cur.(type) {
+		case map[string]any:
+			next, ok := v[seg]
+			if !ok {
+				return nil, false
+			}
+			cur = next
+		case []any:
+			i, err := strconv.Atoi(seg)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			cur = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return cur, cur != nil
+}
+
+func fieldString(v any) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]any, []any:
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+	return fmt.Sprint(v)
+}
+
+// formatHeadline builds the headline from the configured fields, or reports
+// false when none are configured or present.
+func formatHeadline(e *LogEntry) (string, bool) {
+	paths := headlineFields(e)
+	if len(paths) == 0 {
+		return "", false
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return "", false
+	}
+	var root map[string]any
+	if err := json.Unmarshal(raw, &root); err != nil {
+		return "", false
+	}
+	var parts []string
+	for _, path := range paths {
+		v, ok := entryField(root, path)
+		if !ok {
+			continue
+		}
+		s := fieldString(v)
+		if s == "" {
+			continue
+		}
+		if len(parts) > 0 {
+			s = path[strings.LastIndex(path, ".")+1:] + ": " + s
+		}
+		parts = append(parts, s)
+	}
+	if len(parts) == 0 {
+		return "", false
+	}
+	return strings.Join(parts, headlineSeparator), true
+}
@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Setting SLACK_HEARTBEAT_CHANNEL_ID (destinations, like a route) posts a
+// low-key heartbeat every SLACK_HEARTBEAT_INTERVAL (default 24h) with the
+// entries processed and how many deliveries failed, so a pipeline that
+// silently stopped is noticed when the heartbeat goes missing. The first
+// heartbeat after a cold start also lists the loaded configuration, which
+// is logged at startup as well.
+//
+// Heartbeats are sent from the scheduler endpoint, which rarely runs on the
+// instance that handled the entries. Set SLACK_HEARTBEAT_FIRESTORE_COLLECTION
+// to add up the counts of every instance in a Firestore document; without
+// it the heartbeat only reports the scheduler instance's own counts.
+
+const defaultHeartbeatInterval = 24 * time.Hour
+
+// heartbeatCounts is the shared document holding the counts of every
+// instance since the last heartbeat.
+type heartbeatCounts struct {
+	Counts map[string]int64 `firestore:"counts"`
+}
+
+type heartbeat struct {
+	interval time.Duration
+	targets  []Destination
+	shared   *firestore.DocumentRef // optional
+
+	mu      sync.Mutex
+	started time.Time
+	last    time.Time
+	sent    bool // whether a heartbeat went out since the cold start
+	counts  map[string]int
+}
+
+// count tallies a metric towards the next heartbeat.
+func (h *heartbeat) count(metric string) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	h.counts[metric]++
+	h.mu.Unlock()
+}
+
+// flush adds the tallies of this instance to the shared counts and resets
+// them; tallies that fail to save are kept for the next flush.
+func (h *heartbeat) flush(ctx context.Context) error {
+	if h == nil || h.shared == nil {
+		return nil
+	}
+	h.mu.Lock()
+	counts := h.counts
+	h.counts = map[string]int{}
+	h.mu.Unlock()
+	if len(counts) == 0 {
+		return nil
+	}
+	inc := make(map[string]any, len(counts))
+	for metric, n := range counts {
+		inc[metric] = firestore.Increment(n)
+	}
+	if _, err := h.shared.Set(ctx, map[string]any{"counts": inc}, firestore.MergeAll); err != nil {
+		h.mu.Lock()
+		for metric, n := range counts {
+			h.counts[metric] += n
+		}
+		h.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// take returns the counts since the last heartbeat and resets them.
+func (h *heartbeat) take(ctx context.Context) (map[string]int64, error) {
+	if h.shared == nil {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		out := make(map[string]int64, len(h.counts))
+		for metric, n := range h.counts {
+			out[metric] = int64(n)
+		}
+		h.counts = map[string]int{}
+		return out, nil
+	}
+	if err := h.flush(ctx); err != nil {
+		return nil, err
+	}
+	client, err := getFirestore()
+	if err != nil {
+		return nil, err
+	}
+	var out map[string]int64
+	err = client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		snap, err := tx.Get(h.shared)
+		if err != nil && status.Code(err) != codes.NotFound {
+			return err
+		}
+		var hc heartbeatCounts
+		if snap.Exists() {
+			if err := snap.DataTo(&hc); err != nil {
+				return err
+			}
+		}
+		out = hc.Counts
+		return tx.Set(h.shared, heartbeatCounts{Counts: map[string]int64{}})
+	})
+	return out, err
+}
+
+// due returns the heartbeat text once the interval has elapsed and resets
+// the counts. A heartbeat whose counts cannot be read is retried on the
+// next call.
+func (h *heartbeat) due(ctx context.Context, now time.Time) (string, bool, error) {
+	if h == nil {
+		return "", false, nil
+	}
+	h.mu.Lock()
+	if now.Sub(h.last) < h.interval {
+		h.mu.Unlock()
+		return "", false, nil
+	}
+	since, first := h.last, !h.sent
+	if first {
+		since = h.started
+	}
+	h.mu.Unlock()
+	counts, err := h.take(ctx)
+	if err != nil {
+		return "", false, err
+	}
+	text := fmt.Sprintf(":green_heart: ieos-slack-logger alive: processed %d entries, posted %d, %d failure(s) since %s",
+		counts[metricReceived], counts[metricPosted], counts[metricFailed], formatTimestamp(since))
+	if n := counts[metricSuppressed]; n > 0 {
+		text += fmt.Sprintf(", %d suppressed", n)
+	}
+	if first {
+		text += "\n" + configSummary()
+	}
+	h.mu.Lock()
+	h.last, h.sent = now, true
+	h.mu.Unlock()
+	return text, true, nil
+}
+
+// configSummary describes the configuration loaded from env.
+func configSummary() string {
+	var lines []string
+	routes := map[string]string{
+		"ERROR+":         setting("SLACK_ERROR_CHANNEL_ID"),
+		"WARNING/NOTICE": setting("SLACK_WARNING_CHANNEL_ID"),
+		"default":        setting("SLACK_DEFAULT_CHANNEL_ID"),
+	}
+	sinks := map[string]bool{}
+	for _, tier := range []string{"ERROR+", "WARNING/NOTICE", "default"} {
+		dests := parseDestinations(routes[tier])
+		if len(dests) == 0 {
+			continue
+		}
+		targets := make([]string, 0, len(dests))
+		for _, d := range dests {
+			targets = append(targets, d.Target)
+			if _, _, ok := sinkTarget(d.Target); ok {
+				sinks[d.Target] = true
+			}
+		}
+		lines = append(lines, fmt.Sprintf("route %s → %s", tier, strings.Join(targets, ", ")))
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "no routes configured")
+	}
+	if len(sinks) > 0 {
+		names := make([]string, 0, len(sinks))
+		for name := range sinks {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		lines = append(lines, "sinks: "+strings.Join(names, ", "))
+	}
+
+	var features []string
+	if qs, _ := getQuietHours(); qs != nil {
+		features = append(features, fmt.Sprintf("%d quiet window(s)", len(qs.windows)))
+	}
+	if dg, _ := getDigest(); dg != nil {
+		features = append(features, "digest every "+dg.interval.String())
+	}
+	if t, _ := getAcks(); t.buttons {
+		features = append(features, "ack buttons")
+	}
+	if e, _ := getEscalator(); e != nil {
+		features = append(features, "escalation after "+e.after.String())
+	}
+	if b, _ := getBudgets(); b != nil {
+		features = append(features, "posting budgets")
+	}
+	if t, _ := getTraceThreads(); t != nil {
+		features = append(features, "threads by trace")
+	}
+	if d, _ := getDailyAnchors(); d != nil {
+		features = append(features, "daily anchor threads")
+	}
+	if n, _ := getNoiseFilters(); n != nil {
+		names := make([]string, 0, len(n.enabled))
+		for _, h := range noiseHeuristics {
+			if n.enabled[h.name] {
+				names = append(names, h.name)
+			}
+		}
+		features = append(features, "noise filters ("+strings.Join(names, ", ")+")")
+	}
+	if len(features) > 0 {
+		lines = append(lines, "features: "+strings.Join(features, ", "))
+	}
+	return strings.Join(lines, "\n")
+}
+
+var (
+	heartbeats        *heartbeat
+	heartbeatsErr     error
+	heartbeatInitOnce sync.Once
+)
+
+// getHeartbeat returns the heartbeat configured via env, or nil when it is
+// disabled.
+func getHeartbeat() (*heartbeat, error) {
+	heartbeatInitOnce.Do(func() {
+		targets := parseDestinations(setting("SLACK_HEARTBEAT_CHANNEL_ID"))
+		if len(targets) == 0 {
+			return
+		}
+		interval := defaultHeartbeatInterval
+		if v := setting("SLACK_HEARTBEAT_INTERVAL"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				heartbeatsErr = fmt.Errorf("invalid SLACK_HEARTBEAT_INTERVAL %q", v)
+				return
+			}
+			interval = d
+		}
+		now := time.Now()
+		// the first heartbeat goes out right away so a deploy is confirmed
+		h := &heartbeat{interval: interval, targets: targets, started: now, last: now.Add(-interval), counts: map[string]int{}}
+		if collection := setting("SLACK_HEARTBEAT_FIRESTORE_COLLECTION"); collection != "" {
+			client, err := getFirestore()
+			if err != nil {
+				heartbeatsErr = err
+				return
+			}
+			h.shared = client.Collection(collection).Doc("heartbeat")
+		}
+		heartbeats = h
+	})
+	return heartbeats, heartbeatsErr
+}
+
+// flushHeartbeat saves the tallies of the current invocation to the shared
+// heartbeat counts.
+func flushHeartbeat(ctx context.Context, reqLog *logger.RequestLogger) {
+	h, _ := getHeartbeat()
+	if err := h.flush(ctx); err != nil {
+		reqLog.Warning("failed to save heartbeat counts", err)
+	}
+}
+
+var startupLogOnce sync.Once
+
+// runHeartbeat logs the configuration on the first call and posts the
+// heartbeat when it is due.
+func runHeartbeat(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, now time.Time) {
+	startupLogOnce.Do(func() {
+		reqLog.Info("configuration loaded", map[string]any{"summary": configSummary()})
+	})
+	h, err := getHeartbeat()
+	if err != nil {
+		reqLog.Error("invalid heartbeat config", err)
+	}
+	text, ok, err := h.due(ctx, now)
+	if err != nil {
+		reqLog.Warning("failed to read heartbeat counts", err)
+		return
+	}
+	if !ok {
+		return
+	}
+	for _, d := range h.targets {
+		if err := deliver(ctx, reqLog, notifier, d.Target, newAlert("DEBUG", text, nil)); err != nil {
+			reqLog.Error("failed to post heartbeat", err, map[string]any{"target": d.Target})
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Setting SLACK_HISTORY_FIRESTORE_COLLECTION records every processed alert:
+// one document per delivery (target and Slack ts) and one per muted alert,
+// updated when the alert is acknowledged. Documents expire after
+// SLACK_HISTORY_RETENTION (default 720h) through a Firestore TTL policy on
+// expireAt. The slash command's "recent" reads the history when it is set,
+// so it covers all instances and survives cold starts, and the collection
+// doubles as a timeline for postmortems.
+
+const (
+	defaultHistoryRetention = 30 * 24 * time.Hour
+	// historyScanLimit bounds the documents read to answer a filtered query.
+	historyScanLimit = 200
+)
+
+// Alert history statuses.
+const (
+	historyPosted = "posted"
+	historyMuted  = "muted"
+)
+
+// historyRecord is one processed alert.
+type historyRecord struct {
+	Fingerprint string    `firestore:"fingerprint"`
+	Severity    string    `firestore:"severity"`
+	Title       string    `firestore:"title"`
+	Headline    string    `firestore:"headline"`
+	Service     string    `firestore:"service"`
+	LogName     string    `firestore:"logName"`
+	Target      string    `firestore:"target"`
+	TS          string    `firestore:"ts"` // Slack message ts; empty for sinks and muted alerts
+	Status      string    `firestore:"status"`
+	Reason      string    `firestore:"reason"` // why a muted alert was held back
+	At          time.Time `firestore:"at"`
+	AckedBy     string    `firestore:"ackedBy"`
+	AckedVia    string    `firestore:"ackedVia"`
+	AckedAt     time.Time `firestore:"ackedAt"`
+	ExpireAt    time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+type alertHistory struct {
+	retention time.Duration
+	shared    *firestore.CollectionRef
+}
+
+// add stores a record. Deliveries are keyed by target and ts, so a retried
+// write does not duplicate them.
+func (h *alertHistory) add(ctx context.Context, rec historyRecord) error {
+	if h == nil {
+		return nil
+	}
+	rec.ExpireAt = rec.At.Add(h.retention)
+	doc := h.shared.NewDoc()
+	if rec.TS != "" {
+		sum := sha256.Sum256([]byte(rec.Target + "\x00" + rec.TS))
+		doc = h.shared.Doc(hex.EncodeToString(sum[:])[:24])
+	}
+	_, err := doc.Set(ctx, rec)
+	return err
+}
+
+// acked marks the not yet acknowledged records of a fingerprint.
+func (h *alertHistory) acked(ctx context.Context, rec ackRecord) error {
+	if h == nil || rec.Fingerprint == "" {
+		return nil
+	}
+	snaps, err := h.shared.Where("fingerprint", "==", rec.Fingerprint).Limit(historyScanLimit).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	for _, snap := range snaps {
+		var cur historyRecord
+		if err := snap.DataTo(&cur); err != nil {
+			return err
+		}
+		if cur.AckedBy != "" {
+			continue
+		}
+		if _, err := snap.Ref.Update(ctx, []firestore.Update{
+			{Path: "ackedBy", Value: rec.UserID},
+			{Path: "ackedVia", Value: rec.Via},
+			{Path: "ackedAt", Value: rec.AckedAt},
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latest returns up to limit records, newest first, whose service or title
+// contains filter (case-insensitive), as the recent alert list shows them.
+func (h *alertHistory) latest(ctx context.Context, filter string, limit int) ([]recentAlert, error) {
+	return h.matching(ctx, recentFilter(filter), limit)
+}
+
+// matching returns up to limit of the latest records for which match is
+// true, newest first. Only the newest historyScanLimit records are searched.
+func (h *alertHistory) matching(ctx context.Context, match func(recentAlert) bool, limit int) ([]recentAlert, error) {
+	snaps, err := h.shared.OrderBy("at", firestore.Desc).Limit(historyScanLimit).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	var out []recentAlert
+	for _, snap := range snaps {
+		var rec historyRecord
+		if err := snap.DataTo(&rec); err != nil {
+			return nil, err
+		}
+		r := recentAlert{At: rec.At, Severity: rec.Severity, Service: rec.Service, Title: rec.Title, Headline: rec.Headline, Muted: rec.Reason}
+		if rec.AckedBy != "" {
+			r.Muted = "acknowledged by <@" + rec.AckedBy + ">"
+		}
+		if !match(r) {
+			continue
+		}
+		out = append(out, r)
+		if len(out) == limit {
+			break
+		}
+	}
+	return out, nil
+}
+
+var (
+	history         *alertHistory
+	historyErr      error
+	historyInitOnce sync.Once
+)
+
+// getHistory returns the alert history, or nil when it is not configured.
+func getHistory() (*alertHistory, error) {
+	historyInitOnce.Do(func() {
+		collection := setting("SLACK_HISTORY_FIRESTORE_COLLECTION")
+		if collection == "" {
+			return
+		}
+		h := &alertHistory{retention: defaultHistoryRetention}
+		if v := setting("SLACK_HISTORY_RETENTION"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				historyErr = fmt.Errorf("invalid SLACK_HISTORY_RETENTION %q", v)
+				return
+			}
+			h.retention = d
+		}
+		client, err := getFirestore()
+		if err != nil {
+			historyErr = err
+			return
+		}
+		h.shared = client.Collection(collection)
+		history = h
+	})
+	return history, historyErr
+}
+
+// recordHistory stores a processed alert: status is historyPosted with the
+// target and ts of the delivery, or historyMuted with the reason. Synthetic
+// alerts such as digests and summaries are not recorded.
+func recordHistory(ctx context.Context, reqLog *logger.RequestLogger, a *Alert, status, target, ts, reason string) {
+	if a.Fingerprint == "" {
+		return
+	}
+	h, err := getHistory()
+	if err != nil {
+		reqLog.Error("alert history unavailable", err)
+	}
+	rec := historyRecord{
+		Fingerprint: a.Fingerprint,
+		Severity:    a.Severity,
+		Title:       a.Title,
+		Headline:    digestSample(a.Text),
+		Target:      target,
+		TS:          ts,
+		Status:      status,
+		Reason:      reason,
+		At:          time.Now().UTC(),
+	}
+	if a.Entry != nil {
+		rec.Service, rec.LogName = entryService(a.Entry), a.Entry.LogName
+	}
+	if err := h.add(ctx, rec); err != nil {
+		reqLog.Warning("failed to record alert history", err, map[string]any{"target": target, "fingerprint": a.Fingerprint})
+	}
+}
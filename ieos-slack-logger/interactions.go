@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// InteractionConfig configures the Slack interactivity endpoint.
+type InteractionConfig struct {
+	// SigningSecrets are the app signing secrets requests are verified
+	// against; one per Slack app when several workspaces are configured.
+	SigningSecrets []string
+}
+
+// NewInteractionHandler returns an http.Handler for the Slack app's
+// interactivity request URL. It verifies the request signature and handles
+// Acknowledge button clicks.
+func NewInteractionHandler(cfg InteractionConfig) (http.Handler, error) {
+	if len(cfg.SigningSecrets) == 0 {
+		return nil, fmt.Errorf("at least one slack signing secret is required")
+	}
+	return VerifySlackRequests(cfg.SigningSecrets, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		reqLog := getLogger(ctx).ForRequest(ctx, r)
+
+		body, _ := io.ReadAll(r.Body)
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		var cb slack.InteractionCallback
+		if err := json.Unmarshal([]byte(form.Get("payload")), &cb); err != nil {
+			reqLog.Error("failed to decode interaction payload", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		if cb.Type == slack.InteractionTypeBlockActions {
+			for _, action := range cb.ActionCallback.BlockActions {
+				if action.ActionID != ackActionID {
+					continue
+				}
+				if err := acknowledge(ctx, &cb, action.Value); err != nil {
+					reqLog.Error("failed to acknowledge alert", err, map[string]any{"fingerprint": action.Value, "user": cb.User.ID})
+					http.Error(w, "acknowledge failed", http.StatusInternalServerError)
+					return
+				}
+				reqLog.Info("alert acknowledged", map[string]any{"fingerprint": action.Value, "user": cb.User.ID, "channel": cb.Channel.ID})
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	})), nil
+}
+
+// acknowledge records the ack and rewrites the alert message in place.
+func acknowledge(ctx context.Context, cb *slack.InteractionCallback, fingerprint string) error {
+	t, _ := getAcks()
+	n := getWorkspaces(ctx).forTeam(cb.Team.ID)
+	meta := cb.Message.Metadata.EventPayload
+	if _, ok := meta["source"]; !ok {
+		// payloads do not always carry the metadata; without it the ack
+		// still mutes, it just cannot be resolved early
+		meta, _ = n.alertMetadata(ctx, cb.Channel.ID, cb.Message.Timestamp)
+	}
+	now := time.Now().UTC()
+	rec := ackRecord{
+		Fingerprint: fingerprint,
+		UserID:      cb.User.ID,
+		UserName:    cb.User.Name,
+		Via:         "button",
+		AckedAt:     now,
+		Until:       now.Add(t.suppressFor),
+		ExpireAt:    now.Add(t.suppressFor),
+	}
+	rec.Source, _ = meta["source"].(string)
+	rec.Severity, _ = meta["severity"].(string)
+	if err := t.ack(ctx, rec); err != nil {
+		return err
+	}
+
+	title, _, _ := strings.Cut(cb.Message.Text, "\n")
+	fallback := fmt.Sprintf("~%s~ (acknowledged by %s)", title, cb.User.Name)
+	return n.UpdateMessage(ctx, cb.Channel.ID, cb.Message.Timestamp, fallback, ackedBlocks(cb.Message.Blocks, rec)...)
+}
+
+// HandleSlackInteraction is the HTTP Cloud Function for the Slack app's
+// interactivity request URL, configured from SLACK_SIGNING_SECRET[_<NAME>].
+func HandleSlackInteraction(w http.ResponseWriter, r *http.Request) {
+	reloadConfig(r.Context(), getLogger(r.Context()).ForRequest(r.Context(), r), time.Now())
+	h, err := NewInteractionHandler(InteractionConfig{SigningSecrets: signingSecretsFromEnv()})
+	if err != nil {
+		getLogger(r.Context()).ForRequest(r.Context(), r).Error("slack interactivity not configured", err)
+		http.Error(w, "not configured", http.StatusServiceUnavailable)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// LogEntry is a Cloud Logging LogEntry as exported by the Log Router.
+// See: https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry
+type LogEntry struct {
+	LogName          string            `json:"logName"`
+	Severity         string            `json:"severity"`
+	Timestamp        time.Time         `json:"-"`
+	ReceiveTimestamp time.Time         `json:"-"`
+	InsertID         string            `json:"insertId"`
+	Resource         MonitoredResource `json:"resource"`
+	Labels           map[string]string `json:"labels"`
+	HTTPRequest      *HTTPRequest      `json:"httpRequest"`
+	Trace            string            `json:"trace"`
+	SpanID           string            `json:"spanId"`
+	TextPayload      string            `json:"textPayload"`
+	JSONPayload      map[string]any    `json:"jsonPayload"`
+	// ProtoPayload is kept raw; its shape depends on the "@type" field.
+	ProtoPayload json.RawMessage `json:"protoPayload"`
+
+	// timestampErr records timestamps that failed to parse and were left
+	// zero, for the caller to log.
+	timestampErr error
+}
+
+// MonitoredResource identifies the resource that produced the entry.
+type MonitoredResource struct {
+	Type   string            `json:"type"`
+	Labels map[string]string `json:"labels"`
+}
+
+// HTTPRequest is the request metadata attached to access-log style entries.
+// Int64 fields such as responseSize are encoded as strings in the export.
+type HTTPRequest struct {
+	RequestMethod string `json:"requestMethod"`
+	RequestURL    string `json:"requestUrl"`
+	Status        int    `json:"status"`
+	ResponseSize  string `json:"responseSize"`
+	UserAgent     string `json:"userAgent"`
+	RemoteIP      string `json:"remoteIp"`
+	Latency       string `json:"latency"`
+}
+
+// UnmarshalJSON decodes the entry, tolerating missing timestamps and
+// defaulting an absent severity to DEFAULT. A malformed timestamp is left
+// zero, meaning unknown, rather than failing an otherwise valid alert.
+func (e *LogEntry) UnmarshalJSON(data []byte) error {
+	type plain LogEntry
+	aux := struct {
+		*plain
+		Timestamp        string `json:"timestamp"`
+		ReceiveTimestamp string `json:"receiveTimestamp"`
+	}{plain: (*plain)(e)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	var errTS, errReceive error
+	if e.Timestamp, errTS = parseLogTimestamp(aux.Timestamp); errTS != nil {
+		errTS = fmt.Errorf("invalid timestamp: %w", errTS)
+	}
+	if e.ReceiveTimestamp, errReceive = parseLogTimestamp(aux.ReceiveTimestamp); errReceive != nil {
+		errReceive = fmt.Errorf("invalid receiveTimestamp: %w", errReceive)
+	}
+	e.timestampErr = errors.Join(errTS, errReceive)
+	if e.Severity == "" {
+		e.Severity = "DEFAULT"
+	}
+	return nil
+}
+
+func parseLogTimestamp(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// SeverityLevel returns the entry severity as a comparable logging.Severity.
+func (e *LogEntry) SeverityLevel() logging.Severity {
+	return logging.ParseSeverity(e.Severity)
+}
+
+func parseLogEntry(data []byte) (*LogEntry, error) {
+	var e LogEntry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
@@ -0,0 +1,91 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// slackEscaper escapes the characters Slack treats as markup in message text.
+var slackEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+// mentionRE matches user, channel, group and special mentions, e.g.
+// "<@U0123>", "<#C0123|ops>", "<!subteam^S0123|@oncall>" and "<!here>".
+var mentionRE = regexp.MustCompile(`<([@#!])([^<>|]*)(?:\|([^<>]*))?>`)
+
+// neutraliseMentions rewrites mentions as plain text, e.g. "<#C0123|ops>"
+// as "#ops". Without link_names Slack does not ping for plain "@here".
+func neutraliseMentions(s string) string {
+	return mentionRE.ReplaceAllStringFunc(s, func(m string) string {
+		parts := mentionRE.FindStringSubmatch(m)
+		sigil, name := parts[1], strings.TrimPrefix(parts[2], "subteam^")
+		if label := strings.TrimLeft(parts[3], "@#"); label != "" {
+			name = label
+		}
+		if sigil == "!" {
+			sigil = "@"
+		}
+		return sigil + name
+	})
+}
+
+// payloadTextMapper returns the rewrite a destination applies to payload
+// text, or nil when it applies none.
+func payloadTextMapper(d Destination) func(string) string {
+	switch {
+	case d.Escape:
+		// escaping leaves no mention to neutralise
+		return slackEscaper.Replace
+	case d.NoMentions:
+		return neutraliseMentions
+	}
+	return nil
+}
+
+// mapPayloadText returns a copy of the entry with f applied to its text
+// payload and every string in its jsonPayload.
+func mapPayloadText(e *LogEntry, f func(string) string) *LogEntry {
+	out := *e
+	out.TextPayload = f(e.TextPayload)
+	if e.JSONPayload != nil {
+		out.JSONPayload, _ = mapStrings(e.JSONPayload, f).(map[string]any)
+	}
+	return &out
+}
+
+func mapStrings(v any, f func(string) string) any {
+	switch v := v.(type) {
+	case string:
+		return f(v)
+	case map[string]any:
+		m := make(map[string]any, len(v))
+		for k, x := range v {
+			m[k] = mapStrings(x, f)
+		}
+		return m
+	case []any:
+		l := make([]any, len(v))
+		for i, x := range v {
+			l[i] = mapStrings(x, f)
+		}
+		return l
+	}
+	return v
+}
+
+// forDestination returns the alert as the destination should see it: the
+// entry re-formatted with its payload text rewritten and the posting
+// options set. Synthetic alerts have no payload and keep their text.
+func (a *Alert) forDestination(d Destination) *Alert {
+	f := payloadTextMapper(d)
+	if !d.NoUnfurl && (f == nil || a.Entry == nil) {
+		return a
+	}
+	out := *a
+	out.NoUnfurl = d.NoUnfurl
+	if f != nil && a.Entry != nil {
+		out.Entry = mapPayloadText(a.Entry, f)
+		out.Text = redact(formatMessage(out.Entry))
+		out.Title, _, _ = strings.Cut(out.Text, "\n")
+	}
+	return &out
+}
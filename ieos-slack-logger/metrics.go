@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Setting SLACK_METRICS=log emits delivery counters as structured log
+// entries, one per increment, for log-based metrics in Cloud Monitoring:
+//
+//	jsonPayload.message="metric"
+//	jsonPayload.data_object.metric="alerts_posted"
+//
+// with labels extracted from jsonPayload.data_object (e.g. target, reason,
+// severity). The counters are:
+//
+//	alerts_received      {severity}
+//	alerts_deduped       {}
+//	alerts_suppressed    {reason: quiet_window, acknowledged, silenced, digest, budget, outage}
+//	alerts_routed        {target}
+//	alerts_posted        {target}
+//	alerts_failed        {target, reason}
+//	alerts_dead_lettered {target}
+
+const (
+	metricReceived     = "alerts_received"
+	metricDeduped      = "alerts_deduped"
+	metricSuppressed   = "alerts_suppressed"
+	metricRouted       = "alerts_routed"
+	metricPosted       = "alerts_posted"
+	metricFailed       = "alerts_failed"
+	metricDeadLettered = "alerts_dead_lettered"
+)
+
+var (
+	metricsEnabled  bool
+	metricsInitOnce sync.Once
+)
+
+// countMetric increments a counter by one. Counters also feed the heartbeat.
+func countMetric(reqLog *logger.RequestLogger, name string, labels map[string]string) {
+	h, _ := getHeartbeat()
+	h.count(name)
+	metricsInitOnce.Do(func() {
+		metricsEnabled = setting("SLACK_METRICS") == "log"
+	})
+	if !metricsEnabled {
+		return
+	}
+	data := make(map[string]any, len(labels)+2)
+	for k, v := range labels {
+		data[k] = v
+	}
+	data["metric"], data["value"] = name, 1
+	reqLog.Info("metric", data)
+}
+
+// failureReason labels a failed delivery: the Slack error code, the sink's
+// HTTP status, or "transient"/"permanent" when neither is known.
+func failureReason(err error) string {
+	var se *SlackError
+	if errors.As(err, &se) && se.Code != "" {
+		return se.Code
+	}
+	var ke *SinkError
+	if errors.As(err, &ke) && ke.Status != 0 {
+		return "http_" + strconv.Itoa(ke.Status)
+	}
+	if IsPermanent(err) {
+		return "permanent"
+	}
+	return "transient"
+}
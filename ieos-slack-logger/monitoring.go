@@ -0,0 +1,305 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Cloud Monitoring alerting policy notifications sent through a Pub/Sub
+// notification channel are recognised and rendered as incident alerts: the
+// policy, condition, resource, incident ID and state. They go to
+// SLACK_MONITORING_CHANNEL_ID (destinations, like a route; the severity
+// routes when unset). Slack messages posted for an open incident are
+// remembered and, when the incident closes, updated in place instead of a
+// second message being posted. They are remembered per instance unless
+// SLACK_INCIDENT_FIRESTORE_COLLECTION is set.
+
+const (
+	incidentRetention   = 7 * 24 * time.Hour
+	incidentStateClosed = "closed"
+)
+
+// monitoringNotification is the Pub/Sub notification format of Cloud
+// Monitoring alerting policies.
+// See: https://cloud.google.com/monitoring/support/notification-options#schema-pubsub
+type monitoringNotification struct {
+	Version  string             `json:"version"`
+	Incident monitoringIncident `json:"incident"`
+}
+
+type monitoringIncident struct {
+	IncidentID          string `json:"incident_id"`
+	ScopingProjectID    string `json:"scoping_project_id"`
+	URL                 string `json:"url"`
+	State               string `json:"state"`
+	StartedAt           int64  `json:"started_at"`
+	EndedAt             int64  `json:"ended_at"`
+	Summary             string `json:"summary"`
+	PolicyName          string `json:"policy_name"`
+	ConditionName       string `json:"condition_name"`
+	Severity            string `json:"severity"`
+	ResourceDisplayName string `json:"resource_display_name"`
+	Resource            struct {
+		Type   string            `json:"type"`
+		Labels map[string]string `json:"labels"`
+	} `json:"resource"`
+	Documentation struct {
+		Content string `json:"content"`
+	} `json:"documentation"`
+}
+
+// parseMonitoringNotification reports whether m is an alerting policy
+// notification.
+func parseMonitoringNotification(m PubSubMessage) (*monitoringIncident, bool) {
+	var n monitoringNotification
+	if err := json.Unmarshal(m.Data, &n); err != nil || n.Version == "" || n.Incident.IncidentID == "" || n.Incident.State == "" {
+		return nil, false
+	}
+	return &n.Incident, true
+}
+
+func (i *monitoringIncident) closed() bool {
+	return strings.EqualFold(i.State, incidentStateClosed)
+}
+
+// severity is the policy's severity for open incidents, ERROR when the
+// policy sets none, and INFO once the incident is closed.
+func (i *monitoringIncident) severity() string {
+	if i.closed() {
+		return "INFO"
+	}
+	switch strings.ToUpper(i.Severity) {
+	case "CRITICAL":
+		return "CRITICAL"
+	case "WARNING":
+		return "WARNING"
+	}
+	return "ERROR"
+}
+
+func (i *monitoringIncident) project() string {
+	if i.ScopingProjectID != "" {
+		return i.ScopingProjectID
+	}
+	return i.Resource.Labels["project_id"]
+}
+
+func formatMonitoringIncident(i *monitoringIncident) string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "[%s] Cloud Monitoring: %s", i.severity(), i.PolicyName)
+	if i.closed() {
+		s.WriteString("\n:white_check_mark: incident closed")
+		if i.StartedAt > 0 && i.EndedAt > i.StartedAt {
+			fmt.Fprintf(&s, " after %s", time.Duration(i.EndedAt-i.StartedAt)*time.Second)
+		}
+	}
+	fmt.Fprintf(&s, "\nincident: `%s` state: *%s*", i.IncidentID, strings.ToUpper(i.State))
+	if i.ConditionName != "" {
+		fmt.Fprintf(&s, "\ncondition: %s", i.ConditionName)
+	}
+	resource := i.ResourceDisplayName
+	if resource == "" {
+		resource = i.Resource.Labels["service_name"]
+	}
+	if resource != "" || i.Resource.Type != "" {
+		fmt.Fprintf(&s, "\nresource: `%s`", strings.TrimSpace(resource+" "+i.Resource.Type))
+	}
+	if i.Summary != "" {
+		fmt.Fprintf(&s, "\n%s", i.Summary)
+	}
+	if i.StartedAt > 0 {
+		fmt.Fprintf(&s, "\nstarted: %s", formatTimestamp(time.Unix(i.StartedAt, 0)))
+	}
+	if i.EndedAt > 0 {
+		fmt.Fprintf(&s, "\nended: %s", formatTimestamp(time.Unix(i.EndedAt, 0)))
+	}
+	if i.Documentation.Content != "" {
+		fmt.Fprintf(&s, "\n%s", i.Documentation.Content)
+	}
+	if i.URL != "" {
+		fmt.Fprintf(&s, "\n<%s|Open incident>", i.URL)
+	}
+	return s.String()
+}
+
+// incidentMessage is a Slack message posted for an open incident.
+type incidentMessage struct {
+	Incident string    `firestore:"incident"`
+	Target   string    `firestore:"target"`
+	TS       string    `firestore:"ts"`
+	PostedAt time.Time `firestore:"postedAt"`
+	ExpireAt time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+// incidentMessageKey keys messages by incident and target; incident IDs may
+// contain slashes, which Firestore does not allow in document IDs.
+func incidentMessageKey(incident, target string) string {
+	sum := sha256.Sum256([]byte(incident + "\x00" + target))
+	return hex.EncodeToString(sum[:])[:24]
+}
+
+// incidentMessages maps open incidents to the messages posted for them.
+type incidentMessages struct {
+	shared *firestore.CollectionRef // optional
+
+	mu    sync.Mutex
+	local map[string][]incidentMessage
+}
+
+// record remembers the message posted at ts to target for incident.
+func (t *incidentMessages) record(ctx context.Context, incident, target, ts string, now time.Time) error {
+	msg := incidentMessage{Incident: incident, Target: target, TS: ts, PostedAt: now, ExpireAt: now.Add(incidentRetention)}
+	t.mu.Lock()
+	t.local[incident] = append(t.local[incident], msg)
+	t.mu.Unlock()
+	if t.shared == nil {
+		return nil
+	}
+	_, err := t.shared.Doc(incidentMessageKey(incident, target)).Set(ctx, msg)
+	return err
+}
+
+// lookup returns the messages posted for incident.
+func (t *incidentMessages) lookup(ctx context.Context, incident string, now time.Time) ([]incidentMessage, error) {
+	t.mu.Lock()
+	var out []incidentMessage
+	for _, msg := range t.local[incident] {
+		if now.Before(msg.ExpireAt) {
+			out = append(out, msg)
+		}
+	}
+	t.mu.Unlock()
+	if len(out) > 0 || t.shared == nil {
+		return out, nil
+	}
+
+	snaps, err := t.shared.Where("incident", "==", incident).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		var msg incidentMessage
+		if err := snap.DataTo(&msg); err != nil {
+			return out, err
+		}
+		if now.Before(msg.ExpireAt) {
+			out = append(out, msg)
+		}
+	}
+	return out, nil
+}
+
+// forget drops the messages of a closed incident.
+func (t *incidentMessages) forget(ctx context.Context, incident string, msgs []incidentMessage) error {
+	t.mu.Lock()
+	delete(t.local, incident)
+	t.mu.Unlock()
+	if t.shared == nil {
+		return nil
+	}
+	for _, msg := range msgs {
+		if _, err := t.shared.Doc(incidentMessageKey(incident, msg.Target)).Delete(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var (
+	incidents         *incidentMessages
+	incidentsErr      error
+	incidentsInitOnce sync.Once
+)
+
+// getIncidents returns the incident message map configured via env.
+func getIncidents() (*incidentMessages, error) {
+	incidentsInitOnce.Do(func() {
+		incidents = &incidentMessages{local: map[string][]incidentMessage{}}
+		if collection := setting("SLACK_INCIDENT_FIRESTORE_COLLECTION"); collection != "" {
+			client, err := getFirestore()
+			if err != nil {
+				// fall back to per-instance correlation
+				incidentsErr = err
+				return
+			}
+			incidents.shared = client.Collection(collection)
+		}
+	})
+	return incidents, incidentsErr
+}
+
+// recordIncidentMessage remembers a freshly posted incident alert so it can
+// be updated when the incident closes.
+func recordIncidentMessage(ctx context.Context, reqLog *logger.RequestLogger, target, ts string, a *Alert) {
+	if a.incident == "" {
+		return
+	}
+	t, _ := getIncidents()
+	if err := t.record(ctx, a.incident, target, ts, time.Now().UTC()); err != nil {
+		reqLog.Warning("failed to record incident message", err, map[string]any{"incident": a.incident, "target": target, "ts": ts})
+	}
+}
+
+// handleMonitoringNotification posts an opened incident and updates its
+// messages once it closes. A closed incident whose messages are unknown,
+// e.g. because it opened before this service saw it, is posted instead.
+func handleMonitoringNotification(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, m PubSubMessage, i *monitoringIncident) error {
+	severity := i.severity()
+	countMetric(reqLog, metricReceived, map[string]string{"severity": severity})
+	alert := newAlert(severity, redact(formatMonitoringIncident(i)), nil)
+	alert.Fingerprint = "incident-" + i.IncidentID
+	alert.incident = i.IncidentID
+	now := time.Now()
+
+	t, err := getIncidents()
+	if err != nil {
+		reqLog.Error("incident store unavailable", err)
+	}
+	msgs, err := t.lookup(ctx, i.IncidentID, now)
+	if err != nil {
+		reqLog.Warning("incident message lookup failed", err, map[string]any{"incident": i.IncidentID})
+	}
+	if !i.closed() && len(msgs) > 0 {
+		reqLog.Debug("incident already posted", map[string]any{"incident": i.IncidentID})
+		return nil
+	}
+	recordRecent(alert, now, "")
+	countAlertStats(ctx, reqLog, alert, now)
+
+	if i.closed() && len(msgs) > 0 {
+		var errs []error
+		for _, msg := range msgs {
+			if err := notifier.UpdateMessage(ctx, msg.Target, msg.TS, slackText(alert), alertSection(slackText(alert))); err != nil {
+				reqLog.Error("failed to update incident message", err, map[string]any{"incident": i.IncidentID, "target": msg.Target, "ts": msg.TS})
+				if !IsPermanent(err) {
+					errs = append(errs, err)
+				}
+				continue
+			}
+			reqLog.Info("incident message updated", map[string]any{"incident": i.IncidentID, "target": msg.Target, "ts": msg.TS})
+		}
+		if len(errs) > 0 {
+			return errors.Join(errs...)
+		}
+		if err := t.forget(ctx, i.IncidentID, msgs); err != nil {
+			reqLog.Warning("failed to forget closed incident", err, map[string]any{"incident": i.IncidentID})
+		}
+		return nil
+	}
+
+	dests := parseDestinations(setting("SLACK_MONITORING_CHANNEL_ID"))
+	if len(dests) == 0 {
+		dests = routeForSeverity(severity, i.project(), projectEnvironment(i.project()))
+	}
+	return fanOut(ctx, reqLog, notifier, m, dests, alert)
+}
@@ -0,0 +1,154 @@
+package service
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// SLACK_NOISE_FILTERS drops entries that match common noise before they are
+// formatted, as a comma-separated list of heuristics (or "all"):
+//
+//	healthz   successful GET access logs of health endpoints (/healthz,
+//	          /health, /livez, /readyz, /ping, /_ah/health)
+//	probes    Kubernetes liveness/readiness probe failures that repeated
+//	          fewer than SLACK_NOISE_PROBE_COUNT (default 3) times, as pods
+//	          report while a deploy rolls them
+//	canceled  "context canceled" errors below CRITICAL, as in-flight
+//	          requests report when an instance shuts down
+//
+// Dropped entries are counted as suppressed with reason "noise".
+
+const defaultNoiseProbeCount = 3
+
+// noiseHeuristics are the available filters by name, in the order they are
+// tried.
+var noiseHeuristics = []struct {
+	name  string
+	match func(n *noiseFilters, e *LogEntry) bool
+}{
+	{"healthz", (*noiseFilters).healthCheck},
+	{"probes", (*noiseFilters).probeFailure},
+	{"canceled", (*noiseFilters).contextCanceled},
+}
+
+var (
+	healthPaths = map[string]bool{
+		"/healthz": true, "/health": true, "/livez": true, "/readyz": true, "/ping": true, "/_ah/health": true,
+	}
+	// accessLogPattern matches the request line and status of common text
+	// access log formats, e.g. `"GET /healthz HTTP/1.1" 200`.
+	accessLogPattern = regexp.MustCompile(`\bGET (/[^\s"?]*)(?:\?\S*)?(?: HTTP/[\d.]+)?"? (\d{3})\b`)
+)
+
+type noiseFilters struct {
+	enabled    map[string]bool
+	probeCount int
+}
+
+// healthCheck matches successful GETs of a health endpoint, from the
+// httpRequest metadata or a text access log line.
+func (n *noiseFilters) healthCheck(e *LogEntry) bool {
+	if r := e.HTTPRequest; r != nil && r.RequestMethod == "GET" {
+		u, err := url.Parse(r.RequestURL)
+		return err == nil && healthPaths[u.Path] && r.Status > 0 && r.Status < 400
+	}
+	m := accessLogPattern.FindStringSubmatch(e.TextPayload)
+	if m == nil {
+		return false
+	}
+	status, _ := strconv.Atoi(m[2])
+	return healthPaths[m[1]] && status < 400
+}
+
+// probeFailure matches Unhealthy Kubernetes events for failed liveness or
+// readiness probes that have not repeated often yet.
+func (n *noiseFilters) probeFailure(e *LogEntry) bool {
+	if !strings.HasSuffix(e.LogName, "/logs/events") || payloadString(e, "reason") != "Unhealthy" {
+		return false
+	}
+	message := payloadString(e, "message", "note")
+	if !strings.Contains(message, "Liveness probe failed") && !strings.Contains(message, "Readiness probe failed") {
+		return false
+	}
+	count, err := strconv.Atoi(payloadString(e, "count", "series.count"))
+	if err != nil {
+		count = 1
+	}
+	return count < n.probeCount
+}
+
+// contextCanceled matches "context canceled" errors that are not critical.
+func (n *noiseFilters) contextCanceled(e *LogEntry) bool {
+	if e.SeverityLevel() >= logging.Critical {
+		return false
+	}
+	message := e.TextPayload
+	if message == "" {
+		message = payloadString(e, "message", "error", "err")
+	}
+	return strings.Contains(message, "context canceled")
+}
+
+// match returns the name of the first enabled heuristic the entry matches.
+func (n *noiseFilters) match(e *LogEntry) string {
+	if n == nil {
+		return ""
+	}
+	for _, h := range noiseHeuristics {
+		if n.enabled[h.name] && h.match(n, e) {
+			return h.name
+		}
+	}
+	return ""
+}
+
+var (
+	noise         *noiseFilters
+	noiseErr      error
+	noiseInitOnce configOnce
+)
+
+// getNoiseFilters returns the heuristics enabled via env, or nil when none
+// are.
+func getNoiseFilters() (*noiseFilters, error) {
+	noiseInitOnce.Do(func() {
+		noise, noiseErr = nil, nil
+		v := setting("SLACK_NOISE_FILTERS")
+		if v == "" {
+			return
+		}
+		n := &noiseFilters{enabled: map[string]bool{}, probeCount: defaultNoiseProbeCount}
+		known := map[string]bool{}
+		for _, h := range noiseHeuristics {
+			known[h.name] = true
+		}
+		for _, name := range strings.Split(v, ",") {
+			switch name = strings.ToLower(strings.TrimSpace(name)); {
+			case name == "":
+			case name == "all":
+				for k := range known {
+					n.enabled[k] = true
+				}
+			case known[name]:
+				n.enabled[name] = true
+			default:
+				noiseErr = fmt.Errorf("unknown SLACK_NOISE_FILTERS entry %q", name)
+			}
+		}
+		if c := setting("SLACK_NOISE_PROBE_COUNT"); c != "" {
+			count, err := strconv.Atoi(c)
+			if err != nil || count <= 0 {
+				noiseErr = fmt.Errorf("invalid SLACK_NOISE_PROBE_COUNT %q", c)
+			} else {
+				n.probeCount = count
+			}
+		}
+		noise = n
+	})
+	return noise, noiseErr
+}
@@ -0,0 +1,49 @@
+package service
+
+import "sync"
+
+// Setting SLACK_ORDERED_DELIVERY=true serializes deliveries per target
+// within an instance: an alert's message, snippet upload and thread replies
+// all go out before the next alert for that channel starts, and the first
+// alert of a trace is posted before later ones look up its thread. Across
+// instances, give the Log Router sink's messages a Pub/Sub ordering key on a
+// subscription with message ordering enabled; messages are acked only once
+// handled, so Pub/Sub holds back the next message of a key until then.
+
+// targetLocks hands out one mutex per delivery target.
+type targetLocks struct {
+	mu    sync.Mutex
+	locks map[string]*sync.Mutex
+}
+
+// lock blocks until target is free and returns its unlock function.
+func (l *targetLocks) lock(target string) func() {
+	l.mu.Lock()
+	m := l.locks[target]
+	if m == nil {
+		m = &sync.Mutex{}
+		l.locks[target] = m
+	}
+	l.mu.Unlock()
+	m.Lock()
+	return m.Unlock
+}
+
+var (
+	orderedTargets         *targetLocks
+	orderedTargetsInitOnce sync.Once
+)
+
+// lockTarget serializes deliveries to target when ordered delivery is
+// enabled, and returns the function that releases it.
+func lockTarget(target string) func() {
+	orderedTargetsInitOnce.Do(func() {
+		if setting("SLACK_ORDERED_DELIVERY") == "true" {
+			orderedTargets = &targetLocks{locks: map[string]*sync.Mutex{}}
+		}
+	})
+	if orderedTargets == nil {
+		return func() {}
+	}
+	return orderedTargets.lock(target)
+}
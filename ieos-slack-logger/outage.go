@@ -0,0 +1,262 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Setting SLACK_OUTAGE_FIRESTORE_COLLECTION puts a circuit breaker in front
+// of Slack. After SLACK_OUTAGE_THRESHOLD (default 5) consecutive transient
+// failures the breaker opens: alerts for Slack targets are stored in the
+// collection and acked instead of spinning Pub/Sub redeliveries. Every
+// SLACK_OUTAGE_COOLDOWN (default 1m) one delivery probes Slack; once one
+// succeeds the breaker closes and the scheduler endpoint replays the
+// held-back alerts as one summary per target.
+
+const (
+	defaultOutageThreshold = 5
+	defaultOutageCooldown  = time.Minute
+	outageReplayLimit      = 20 // alerts listed per summary
+)
+
+// bufferedAlert is an alert held back while Slack was unavailable.
+type bufferedAlert struct {
+	Target     string    `firestore:"target"`
+	Severity   string    `firestore:"severity"`
+	Title      string    `firestore:"title"`
+	BufferedAt time.Time `firestore:"bufferedAt"`
+	ExpireAt   time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+// slackBreaker is a per-instance circuit breaker around Slack deliveries
+// backed by a shared buffer.
+type slackBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	buffer    *firestore.CollectionRef
+
+	mu        sync.Mutex
+	failures  int
+	openedAt  time.Time // zero while closed
+	probeAt   time.Time // when the next probe may go out
+	checkedAt time.Time // last look for alerts to replay
+}
+
+// allow reports whether a delivery may go to Slack: always while closed,
+// once per cooldown while open.
+func (b *slackBreaker) allow(now time.Time) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openedAt.IsZero() {
+		return true
+	}
+	if now.Before(b.probeAt) {
+		return false
+	}
+	b.probeAt = now.Add(b.cooldown)
+	return true
+}
+
+// record updates the breaker with a delivery result and reports whether the
+// breaker is open afterwards. Permanent failures say nothing about Slack's
+// health and are ignored.
+func (b *slackBreaker) record(now time.Time, err error) bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch {
+	case err == nil:
+		b.failures, b.openedAt = 0, time.Time{}
+	case !IsPermanent(err):
+		b.failures++
+		if b.openedAt.IsZero() && b.failures >= b.threshold {
+			b.openedAt, b.probeAt = now, now.Add(b.cooldown)
+		}
+	}
+	return !b.openedAt.IsZero()
+}
+
+// hold stores the alert for replay.
+func (b *slackBreaker) hold(ctx context.Context, target string, a *Alert, now time.Time) error {
+	_, _, err := b.buffer.Add(ctx, bufferedAlert{
+		Target:     target,
+		Severity:   a.Severity,
+		Title:      a.Title,
+		BufferedAt: now,
+		ExpireAt:   now.Add(dedupRetention),
+	})
+	return err
+}
+
+// claim removes and returns the held-back alerts, grouped by target, once
+// the breaker is closed. Each one is claimed by deleting its document, so
+// only one instance replays it.
+func (b *slackBreaker) claim(ctx context.Context, now time.Time) (map[string][]bufferedAlert, error) {
+	if b == nil {
+		return nil, nil
+	}
+	b.mu.Lock()
+	if !b.openedAt.IsZero() || now.Sub(b.checkedAt) < b.cooldown {
+		b.mu.Unlock()
+		return nil, nil
+	}
+	b.checkedAt = now
+	b.mu.Unlock()
+
+	snaps, err := b.buffer.OrderBy("bufferedAt", firestore.Asc).Documents(ctx).GetAll()
+	if err != nil {
+		return nil, err
+	}
+	out := map[string][]bufferedAlert{}
+	for _, snap := range snaps {
+		var p bufferedAlert
+		if err := snap.DataTo(&p); err != nil {
+			return out, err
+		}
+		if _, err := snap.Ref.Delete(ctx, firestore.Exists); status.Code(err) == codes.NotFound {
+			continue // claimed by another instance
+		} else if err != nil {
+			return out, err
+		}
+		out[p.Target] = append(out[p.Target], p)
+	}
+	return out, nil
+}
+
+// outageSummary lists the alerts held back for one target, oldest first,
+// and returns the highest severity among them.
+func outageSummary(held []bufferedAlert) (string, string) {
+	top := held[0].Severity
+	var b strings.Builder
+	fmt.Fprintf(&b, ":arrows_counterclockwise: Slack was unavailable: %d alert(s) held back between %s and %s",
+		len(held), formatTimestamp(held[0].BufferedAt), formatTimestamp(held[len(held)-1].BufferedAt))
+	for i, p := range held {
+		if logging.ParseSeverity(p.Severity) > logging.ParseSeverity(top) {
+			top = p.Severity
+		}
+		if i < outageReplayLimit {
+			fmt.Fprintf(&b, "\n• %s %s", formatTimestamp(p.BufferedAt), p.Title)
+		}
+	}
+	if n := len(held) - outageReplayLimit; n > 0 {
+		fmt.Fprintf(&b, "\n…and %d more", n)
+	}
+	return b.String(), top
+}
+
+var (
+	breaker         *slackBreaker
+	breakerErr      error
+	breakerInitOnce sync.Once
+)
+
+// getBreaker returns the breaker configured via env, or nil when outage
+// buffering is disabled.
+func getBreaker() (*slackBreaker, error) {
+	breakerInitOnce.Do(func() {
+		collection := setting("SLACK_OUTAGE_FIRESTORE_COLLECTION")
+		if collection == "" {
+			return
+		}
+		b := &slackBreaker{threshold: defaultOutageThreshold, cooldown: defaultOutageCooldown}
+		if v := setting("SLACK_OUTAGE_THRESHOLD"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				breakerErr = fmt.Errorf("invalid SLACK_OUTAGE_THRESHOLD %q", v)
+				return
+			}
+			b.threshold = n
+		}
+		if v := setting("SLACK_OUTAGE_COOLDOWN"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				breakerErr = fmt.Errorf("invalid SLACK_OUTAGE_COOLDOWN %q", v)
+				return
+			}
+			b.cooldown = d
+		}
+		client, err := getFirestore()
+		if err != nil {
+			breakerErr = err
+			return
+		}
+		b.buffer = client.Collection(collection)
+		breaker = b
+	})
+	return breaker, breakerErr
+}
+
+// guardSlack runs send through the breaker. While the breaker is open, or
+// when send trips it, the alert is held back for replay and nil is returned;
+// if it cannot be stored the delivery error is returned instead so Pub/Sub
+// redelivers.
+func guardSlack(ctx context.Context, reqLog *logger.RequestLogger, target string, a *Alert, send func() error) error {
+	b, err := getBreaker()
+	if err != nil {
+		reqLog.Error("invalid outage buffer config", err)
+	}
+	now := time.Now().UTC()
+	if !b.allow(now) {
+		return holdAlert(ctx, reqLog, b, target, a, now, &SlackError{Code: "circuit_open", msg: "slack circuit breaker is open"})
+	}
+	err = send()
+	if !b.record(now, err) || err == nil || IsPermanent(err) {
+		return err
+	}
+	return holdAlert(ctx, reqLog, b, target, a, now, err)
+}
+
+func holdAlert(ctx context.Context, reqLog *logger.RequestLogger, b *slackBreaker, target string, a *Alert, now time.Time, cause error) error {
+	if err := b.hold(ctx, target, a, now); err != nil {
+		reqLog.Error("failed to hold back alert during slack outage", err, map[string]any{"target": target})
+		return cause
+	}
+	reqLog.Warning("slack unavailable; alert held back for replay", map[string]any{"target": target, "reason": cause.Error()})
+	countMetric(reqLog, metricSuppressed, map[string]string{"reason": "outage", "target": target})
+	recordHistory(ctx, reqLog, a, historyMuted, target, "", "slack outage")
+	return nil
+}
+
+// replayHeldAlerts posts a summary of the alerts held back during an outage
+// to each target once Slack is reachable again.
+func replayHeldAlerts(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, now time.Time) {
+	b, _ := getBreaker()
+	held, err := b.claim(ctx, now)
+	if err != nil {
+		reqLog.Error("outage buffer lookup failed", err)
+	}
+	targets := make([]string, 0, len(held))
+	for target := range held {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		text, severity := outageSummary(held[target])
+		if err := deliver(ctx, reqLog, notifier, target, newAlert(severity, text, nil)); err != nil {
+			reqLog.Error("failed to replay held-back alerts", err, map[string]any{"target": target, "count": len(held[target])})
+			for _, p := range held[target] {
+				if _, _, err := b.buffer.Add(ctx, p); err != nil {
+					reqLog.Error("failed to hold back alert during slack outage", err, map[string]any{"target": target})
+				}
+			}
+			continue
+		}
+		reqLog.Info("held-back alerts replayed", map[string]any{"target": target, "count": len(held[target])})
+	}
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Deliveries in a long-running server (push requests and pulled messages)
+// run on a bounded pool of SLACK_WORKERS (default 16) workers. Each message
+// gets SLACK_MESSAGE_TIMEOUT (default 50s, inside Pub/Sub's default 60s ack
+// deadline) and a panic while handling it fails only that message, so a
+// burst of entries is processed in parallel without overrunning Slack or the
+// instance. Messages beyond the pool wait for a free worker.
+
+const (
+	defaultWorkers        = 16
+	defaultMessageTimeout = 50 * time.Second
+)
+
+type workerPool struct {
+	slots   chan struct{}
+	timeout time.Duration
+}
+
+// run handles m on a free worker, waiting for one until ctx is done.
+func (p *workerPool) run(ctx context.Context, m PubSubMessage) (err error) {
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-p.slots }()
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic handling message: %v", r)
+			getLogger(ctx).ForRequest(ctx, nil).Critical("recovered from panic", err, map[string]any{"messageId": m.MessageID, "stack": string(debug.Stack())})
+		}
+	}()
+	return HandleLogAlert(ctx, m)
+}
+
+var (
+	pool         *workerPool
+	poolErr      error
+	poolInitOnce sync.Once
+)
+
+// getPool returns the worker pool configured via env.
+func getPool() (*workerPool, error) {
+	poolInitOnce.Do(func() {
+		workers, timeout := defaultWorkers, defaultMessageTimeout
+		if v := setting("SLACK_WORKERS"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				poolErr = fmt.Errorf("invalid SLACK_WORKERS %q", v)
+			} else {
+				workers = n
+			}
+		}
+		if v := setting("SLACK_MESSAGE_TIMEOUT"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				poolErr = fmt.Errorf("invalid SLACK_MESSAGE_TIMEOUT %q", v)
+			} else {
+				timeout = d
+			}
+		}
+		// an invalid setting falls back to its default rather than
+		// leaving the instance without workers
+		pool = &workerPool{slots: make(chan struct{}, workers), timeout: timeout}
+	})
+	return pool, poolErr
+}
+
+// handlePooled runs m through HandleLogAlert on the worker pool.
+func handlePooled(ctx context.Context, m PubSubMessage) error {
+	p, err := getPool()
+	if err != nil {
+		getLogger(ctx).ForRequest(ctx, nil).Error("invalid worker pool config", err)
+	}
+	return p.run(ctx, m)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/url"
+	"text/template"
+
+	"github.com/slack-go/slack"
+)
+
+// Print-engine services log jobId, orderId, facility and stage in their
+// jsonPayload. When present they are shown as message fields, with the job
+// linked to the fulfillment dashboard through SLACK_JOB_DASHBOARD_URL, a
+// template over printJob whose values are already URL-escaped, e.g.
+//
+//	SLACK_JOB_DASHBOARD_URL=https://ops.example.com/jobs/{{.JobID}}?facility={{.Facility}}
+//
+// Templates see the link as .Links.Job.
+
+// printJob holds the print-engine fields of an entry.
+type printJob struct {
+	JobID    string
+	OrderID  string
+	Facility string
+	Stage    string
+}
+
+// entryPrintJob extracts the print-engine fields, reporting false when the
+// entry has none. The Go services log them camelCase, the Python ones
+// snake_case.
+func entryPrintJob(e *LogEntry) (printJob, bool) {
+	j := printJob{
+		JobID:    payloadString(e, "jobId", "job_id"),
+		OrderID:  payloadString(e, "orderId", "order_id"),
+		Facility: payloadString(e, "facility"),
+		Stage:    payloadString(e, "stage"),
+	}
+	return j, j != printJob{}
+}
+
+var (
+	jobDashboardTmpl     *template.Template
+	jobDashboardInitOnce configOnce
+)
+
+func getJobDashboardTemplate() *template.Template {
+	jobDashboardInitOnce.Do(func() {
+		jobDashboardTmpl = nil
+		spec := setting("SLACK_JOB_DASHBOARD_URL")
+		if spec == "" {
+			return
+		}
+		t, err := template.New("job").Option("missingkey=zero").Parse(spec)
+		if err != nil {
+			log.Printf("invalid SLACK_JOB_DASHBOARD_URL, job links disabled: %v", err)
+			return
+		}
+		jobDashboardTmpl = t
+	})
+	return jobDashboardTmpl
+}
+
+// jobDashboardURL renders the dashboard link for a job; empty when no
+// template is configured or the entry has no job ID.
+func jobDashboardURL(j printJob) string {
+	t := getJobDashboardTemplate()
+	if t == nil || j.JobID == "" {
+		return ""
+	}
+	escaped := printJob{
+		JobID:    url.PathEscape(j.JobID),
+		OrderID:  url.PathEscape(j.OrderID),
+		Facility: url.PathEscape(j.Facility),
+		Stage:    url.PathEscape(j.Stage),
+	}
+	var b bytes.Buffer
+	if err := t.Execute(&b, escaped); err != nil {
+		log.Printf("SLACK_JOB_DASHBOARD_URL failed to render: %v", err)
+		return ""
+	}
+	return b.String()
+}
+
+// printJobBlockFields renders the print-engine fields as section fields,
+// the job ID linked to its dashboard.
+func printJobBlockFields(e *LogEntry) []*slack.TextBlockObject {
+	j, ok := entryPrintJob(e)
+	if !ok {
+		return nil
+	}
+	job := fmt.Sprintf("`%s`", j.JobID)
+	if link := jobDashboardURL(j); link != "" {
+		job = fmt.Sprintf("<%s|%s>", link, j.JobID)
+	}
+	var fields []*slack.TextBlockObject
+	for _, f := range []struct{ title, value, text string }{
+		{"Job", j.JobID, job},
+		{"Order", j.OrderID, "`" + j.OrderID + "`"},
+		{"Facility", j.Facility, "`" + j.Facility + "`"},
+		{"Stage", j.Stage, "`" + j.Stage + "`"},
+	} {
+		if f.value != "" {
+			fields = append(fields, slack.NewTextBlockObject(slack.MarkdownType, "*"+f.title+"*\n"+f.text, false, false))
+		}
+	}
+	return fields
+}
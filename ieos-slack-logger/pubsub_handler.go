@@ -2,21 +2,25 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
-	"strings"
 	"sync"
+	"time"
+	"unicode/utf8"
 
 	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/slack-go/slack"
 )
 
 // PubSubMessage is the payload of a Pub/Sub event.
 // Data is a base64-decoded JSON blob when delivered by Log Router.
+// MessageID and PublishTime are only populated by CloudEvent and push
+// deliveries; background functions carry them in the event metadata.
 // See: https://cloud.google.com/logging/docs/export/pubsub#data_format
 type PubSubMessage struct {
-	Data       []byte            `json:"data"`
-	Attributes map[string]string `json:"attributes"`
+	Data        []byte            `json:"data"`
+	Attributes  map[string]string `json:"attributes"`
+	MessageID   string            `json:"messageId,omitempty"`
+	PublishTime string            `json:"publishTime,omitempty"`
 }
 
 var (
@@ -48,67 +52,278 @@ func getLogger(ctx context.Context) *logger.CloudLogger {
 
 // HandleLogAlert is a Cloud Function / Functions Framework handler for Pub/Sub.
 // Exported for deployment. It parses the LogEntry JSON and sends a Slack message.
+// Redeliveries of an already handled message ID are skipped.
 func HandleLogAlert(ctx context.Context, m PubSubMessage) error {
 	reqLog := getLogger(ctx).ForRequest(ctx, nil)
+	reloadConfig(ctx, reqLog, time.Now())
+	defer flushHeartbeat(ctx, reqLog)
+
+	id := messageID(ctx, m)
+	store, err := getDedupStore()
+	if err != nil {
+		// the in-memory cache still works without the shared backend
+		reqLog.Error("dedup backend unavailable", err)
+	}
+	if id != "" {
+		if seen, err := store.Seen(ctx, id); err != nil {
+			reqLog.Warning("dedup lookup failed", err, map[string]any{"messageId": id})
+		} else if seen {
+			reqLog.Info("skipping duplicate delivery", map[string]any{"messageId": id})
+			countMetric(reqLog, metricDeduped, nil)
+			return nil
+		}
+	}
+
+	if err := handleMessage(ctx, reqLog, m); err != nil {
+		return err
+	}
+	if id != "" {
+		if err := store.MarkProcessed(ctx, id); err != nil {
+			reqLog.Warning("failed to record processed message", err, map[string]any{"messageId": id})
+		}
+	}
+	return nil
+}
+
+func handleMessage(ctx context.Context, reqLog *logger.RequestLogger, m PubSubMessage) error {
+	notifier := getWorkspaces(ctx)
 
 	if len(m.Data) == 0 {
 		reqLog.Warning("empty pubsub data")
 		return fmt.Errorf("empty pubsub data")
 	}
+	if b, ok := parseBudgetNotification(m); ok {
+		return handleBudgetNotification(ctx, reqLog, notifier, m, b)
+	}
+	if b, ok := parseBuildNotification(m); ok {
+		return handleBuildNotification(ctx, reqLog, notifier, m, b)
+	}
+	if i, ok := parseMonitoringNotification(m); ok {
+		return handleMonitoringNotification(ctx, reqLog, notifier, m, i)
+	}
 
-	var payload map[string]any
-	if err := json.Unmarshal(m.Data, &payload); err != nil {
+	entry, err := parseLogEntry(m.Data)
+	if err != nil {
 		reqLog.Error("failed to parse pubsub json", err)
 		return err
 	}
+	if entry.timestampErr != nil {
+		reqLog.Warning("entry timestamp ignored", entry.timestampErr, map[string]any{"logName": entry.LogName, "insertId": entry.InsertID})
+	}
+	if original := remapSeverity(entry); original != "" {
+		reqLog.Debug("severity remapped", map[string]any{"logName": entry.LogName, "from": original, "to": entry.Severity})
+	}
+	countMetric(reqLog, metricReceived, map[string]string{"severity": entry.Severity})
 
-	severity := getString(payload["severity"]) // "ERROR", "WARNING", etc.
-	logName := getString(payload["logName"])    // projects/..../logs/...
-	text := getString(payload["textPayload"])   // optional
+	now := time.Now()
+	quiet, err := getQuietHours()
+	if err != nil {
+		// fail open: a bad schedule must not swallow alerts
+		reqLog.Error("invalid quiet window config", err)
+	}
+	postQuietSummaries(ctx, reqLog, notifier, quiet, quiet.endedSummaries(now))
+	for _, qs := range namedQuietSchedules() {
+		postQuietSummaries(ctx, reqLog, notifier, qs, qs.endedSummaries(now))
+	}
 
-	// build a concise message
-	var b strings.Builder
-	if severity == "" {
-		severity = "DEFAULT"
+	dg, err := getDigest()
+	if err != nil {
+		reqLog.Error("invalid digest config", err)
 	}
-	fmt.Fprintf(&b, "[%s] %s", severity, logName)
-	if text != "" {
-		fmt.Fprintf(&b, "\n%s", text)
+	postDigests(ctx, reqLog, notifier, dg, dg.due(now))
+
+	late, err := getStaleBatch()
+	if err != nil {
+		reqLog.Error("invalid stale entry config", err)
 	}
-	// If jsonPayload exists, include a compact excerpt
-	if jp, ok := payload["jsonPayload"]; ok && jp != nil {
-		if compact, err := json.Marshal(jp); err == nil {
-			fmt.Fprintf(&b, "\njson: %s", compact)
-		}
+	postStaleSummaries(ctx, reqLog, notifier, late.due(now), now)
+
+	budget, err := getBudgets()
+	if err != nil {
+		reqLog.Error("invalid posting budget config", err)
+	}
+	postOverflowSummaries(ctx, reqLog, notifier, budget, budget.overflowSummaries(now))
+
+	noiseFilters, err := getNoiseFilters()
+	if err != nil {
+		reqLog.Error("invalid noise filter config", err)
+	}
+	if name := noiseFilters.match(entry); name != "" {
+		countMetric(reqLog, metricSuppressed, map[string]string{"reason": "noise"})
+		reqLog.Debug("entry dropped as noise", map[string]any{"filter": name, "severity": entry.Severity, "logName": entry.LogName})
+		return nil
+	}
+
+	message := redact(formatMessage(entry))
+	alert := newAlert(entry.Severity, message, entry)
+	countAlertStats(ctx, reqLog, alert, now)
+
+	if late.stale(entry, now) {
+		recordRecent(alert, now, "stale")
+		recordHistory(ctx, reqLog, alert, historyMuted, "", "", "stale")
+		holdStale(reqLog, late, alert, now)
+		return nil
 	}
 
-	message := b.String()
+	if quiet.suppress(now, entry.Severity, "") {
+		recordRecent(alert, now, "quiet window")
+		recordHistory(ctx, reqLog, alert, historyMuted, "", "", "quiet window")
+		countMetric(reqLog, metricSuppressed, map[string]string{"reason": "quiet_window"})
+		reqLog.Info("alert suppressed by quiet window", map[string]any{"severity": entry.Severity, "logName": entry.LogName})
+		return nil
+	}
 
-	channelID := chooseChannelForSeverity(severity)
-	ts, err := SendMessage(channelID, message)
+	ackTracker, err := getAcks()
 	if err != nil {
-		reqLog.Error("slack send failed", err)
-		return err
+		reqLog.Error("ack store unavailable", err)
+	}
+	if resolved, err := ackTracker.resolved(ctx, entry, alert.Text, now); err != nil {
+		reqLog.Warning("ack resolution failed", err)
+	} else {
+		for _, rec := range resolved {
+			reqLog.Info("acknowledged alert resolved", map[string]any{"fingerprint": rec.Fingerprint, "ackedBy": rec.UserID, "resolvedBy": entry.InsertID})
+		}
+	}
+	if rec, err := ackTracker.active(ctx, alert.Fingerprint, now); err != nil {
+		reqLog.Warning("ack lookup failed", err, map[string]any{"fingerprint": alert.Fingerprint})
+	} else if rec != nil {
+		recordRecent(alert, now, "acknowledged")
+		recordHistory(ctx, reqLog, alert, historyMuted, "", "", "acknowledged")
+		countMetric(reqLog, metricSuppressed, map[string]string{"reason": "acknowledged"})
+		reqLog.Info("alert muted by acknowledgement", map[string]any{"fingerprint": alert.Fingerprint, "ackedBy": rec.UserID, "until": rec.Until})
+		return nil
 	}
 
-	reqLog.Info("slack message sent", map[string]any{"ts": ts, "channel": channelID})
-	return nil
+	silenceStore, err := getSilences()
+	if err != nil {
+		reqLog.Error("silence store unavailable", err)
+	}
+	if rec, err := silenceStore.match(ctx, alert.Text, now); err != nil {
+		reqLog.Warning("silence lookup failed", err)
+	} else if rec != nil {
+		recordRecent(alert, now, "silenced")
+		recordHistory(ctx, reqLog, alert, historyMuted, "", "", "silenced")
+		countMetric(reqLog, metricSuppressed, map[string]string{"reason": "silenced"})
+		reqLog.Info("alert muted by silence", map[string]any{"pattern": rec.Pattern, "silencedBy": rec.CreatedBy, "until": rec.Until})
+		return nil
+	}
+	recordRecent(alert, now, "")
+
+	var targets []Destination
+	for _, d := range routeForSeverity(entry.Severity, logProject(entry.LogName), entryEnvironment(entry)) {
+		if !d.accepts(entry.SeverityLevel()) {
+			continue
+		}
+		// before the digest and budget, so held back alerts use neither
+		if d.QuietWindow != "" && suppressForDestination(reqLog, d, alert, now) {
+			continue
+		}
+		if dg.add(now, d.Target, entry.LogName, entry.Severity, message) {
+			reqLog.Debug("alert buffered for digest", map[string]any{"severity": entry.Severity, "logName": entry.LogName, "target": d.Target})
+			countMetric(reqLog, metricSuppressed, map[string]string{"reason": "digest", "target": d.Target})
+			continue
+		}
+		if !budget.allow(now, d.Target, entry.Severity) {
+			reqLog.Warning("alert dropped by posting budget", map[string]any{"severity": entry.Severity, "logName": entry.LogName, "target": d.Target})
+			countMetric(reqLog, metricSuppressed, map[string]string{"reason": "budget", "target": d.Target})
+			continue
+		}
+		countMetric(reqLog, metricRouted, map[string]string{"target": d.Target})
+		targets = append(targets, d)
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+	return fanOut(ctx, reqLog, notifier, m, targets, alert)
 }
 
-func chooseChannelForSeverity(sev string) string {
-	sev = strings.ToUpper(sev)
-	switch sev {
-	case "CRITICAL", "ALERT", "EMERGENCY", "ERROR":
-		if v := os.Getenv("SLACK_ERROR_CHANNEL_ID"); v != "" { return v }
-	case "WARNING", "NOTICE":
-		if v := os.Getenv("SLACK_WARNING_CHANNEL_ID"); v != "" { return v }
-	}
-	if v := os.Getenv("SLACK_DEFAULT_CHANNEL_ID"); v != "" { return v }
-	// last resort: return empty which will surface as validation error in SendMessage
-	return ""
+// deliver sends the alert to target: a configured sink ("webhook:<name>") or
+// a Slack channel. Slack messages switch to a summary plus snippet when the
+// message is oversized or Slack still rejects it as too long, and may be
+// posted in the thread of an earlier alert with the same trace or in the
+// channel's daily anchor thread.
+func deliver(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, target string, a *Alert) error {
+	defer lockTarget(target)()
+
+	if kind, name, ok := sinkTarget(target); ok {
+		sink, err := getSink(kind, name)
+		if err != nil {
+			return err
+		}
+		if err := sink.Send(ctx, a); err != nil {
+			return err
+		}
+		reqLog.Info("alert sent", map[string]any{"target": target})
+		recordHistory(ctx, reqLog, a, historyPosted, target, "", "")
+		return nil
+	}
+
+	return guardSlack(ctx, reqLog, target, a, func() error {
+		channelID, message := target, slackText(a)
+		threadTS := traceThreadFor(ctx, reqLog, channelID, a)
+		if threadTS == "" {
+			threadTS = dailyAnchorFor(ctx, reqLog, notifier, channelID, a)
+		}
+		posted := func(ts string) {
+			if threadTS == "" {
+				recordTraceThread(ctx, reqLog, channelID, ts, a)
+			}
+			trackEscalation(ctx, reqLog, channelID, ts, a)
+			recordIncidentMessage(ctx, reqLog, channelID, ts, a)
+			recordHistory(ctx, reqLog, a, historyPosted, channelID, ts, "")
+			replyTS := threadTS
+			if replyTS == "" {
+				replyTS = ts
+			}
+			postContextLines(ctx, reqLog, notifier, channelID, replyTS, a)
+		}
+		if utf8.RuneCountInString(message) <= snippetThreshold() {
+			opts := alertMsgOptions(a)
+			if a.NoUnfurl {
+				opts = append(opts, slack.MsgOptionDisableLinkUnfurl(), slack.MsgOptionDisableMediaUnfurl())
+			}
+			if threadTS != "" {
+				opts = append(opts, slack.MsgOptionTS(threadTS))
+			}
+			ts, err := notifier.SendMessage(ctx, channelID, message, opts...)
+			if err == nil {
+				reqLog.Info("slack message sent", map[string]any{"ts": ts, "channel": channelID, "threadTs": threadTS})
+				posted(ts)
+				return nil
+			}
+			if !isSlackErrorCode(err, "msg_too_long") {
+				return err
+			}
+		}
+		ts, err := sendWithSnippet(ctx, reqLog, notifier, channelID, threadTS, message, a.Entry)
+		if err != nil {
+			return err
+		}
+		posted(ts)
+		return nil
+	})
 }
 
-func getString(v any) string {
-	s, _ := v.(string)
-	return s
+// sendWithSnippet posts a summary, as a reply when threadTS is set, and
+// attaches the full payload in its thread. A failed upload is logged but
+// does not fail the delivery, since the summary has already reached the
+// channel. It returns the summary's timestamp.
+func sendWithSnippet(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, channelID, threadTS, message string, entry *LogEntry) (string, error) {
+	var extra []slack.MsgOption
+	if threadTS != "" {
+		extra = append(extra, slack.MsgOptionTS(threadTS))
+	}
+	ts, err := notifier.SendMessage(ctx, channelID, snippetSummary(message), extra...)
+	if err != nil {
+		return "", err
+	}
+	if threadTS == "" {
+		threadTS = ts
+	}
+	content, filename := snippetContent(message, entry)
+	if err := notifier.UploadSnippet(ctx, channelID, threadTS, filename, content); err != nil {
+		reqLog.Error("slack snippet upload failed", err, map[string]any{"ts": ts, "channel": channelID})
+	}
+	reqLog.Info("slack message sent with snippet", map[string]any{"ts": ts, "channel": channelID, "bytes": len(content)})
+	return ts, nil
 }
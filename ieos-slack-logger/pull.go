@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/pubsub"
+)
+
+// ReceiveSubscription pulls messages from a Pub/Sub subscription
+// ("projects/<p>/subscriptions/<s>" or a subscription ID in
+// GOOGLE_CLOUD_PROJECT) and handles them on the worker pool until ctx is
+// done. Handled messages are acked and failed ones nacked; messages still
+// outstanding when ctx is done are nacked by the client library, so Pub/Sub
+// redelivers them.
+func ReceiveSubscription(ctx context.Context, name string) error {
+	projectID, subID := os.Getenv("GOOGLE_CLOUD_PROJECT"), name
+	if parts := strings.Split(name, "/"); len(parts) == 4 && parts[0] == "projects" && parts[2] == "subscriptions" {
+		projectID, subID = parts[1], parts[3]
+	}
+	if projectID == "" {
+		return fmt.Errorf("subscription %q needs a project (set GOOGLE_CLOUD_PROJECT or use projects/<p>/subscriptions/<s>)", name)
+	}
+	client, err := pubsub.NewClient(ctx, projectID)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	p, err := getPool()
+	if err != nil {
+		getLogger(ctx).ForRequest(ctx, nil).Error("invalid worker pool config", err)
+	}
+	sub := client.Subscription(subID)
+	// leases beyond the pool would only wait for a worker while their ack
+	// deadline runs
+	sub.ReceiveSettings.MaxOutstandingMessages = cap(p.slots)
+	return sub.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		if !beginDelivery() {
+			msg.Nack()
+			return
+		}
+		defer endDelivery()
+		m := PubSubMessage{Data: msg.Data, Attributes: msg.Attributes, MessageID: msg.ID, PublishTime: msg.PublishTime.Format(time.RFC3339Nano)}
+		// the library cancels ctx once Receive is stopping; a message
+		// already being handled is finished rather than half-posted
+		if err := p.run(context.WithoutCancel(ctx), m); err != nil {
+			msg.Nack()
+			return
+		}
+		msg.Ack()
+	})
+}
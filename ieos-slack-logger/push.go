@@ -0,0 +1,101 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/idtoken"
+)
+
+var googleIssuers = map[string]bool{
+	"accounts.google.com":         true,
+	"https://accounts.google.com": true,
+}
+
+// PushConfig configures the Pub/Sub push endpoint.
+type PushConfig struct {
+	// Audience is the expected "aud" claim of the push subscription's OIDC
+	// token, usually the endpoint URL. Required unless SkipAuth is set.
+	Audience string
+	// ServiceAccountEmail, when set, must match the token's "email" claim.
+	ServiceAccountEmail string
+	// SkipAuth disables token verification, e.g. for local testing.
+	SkipAuth bool
+}
+
+// pushEnvelope is the JSON body of a Pub/Sub push delivery.
+// See: https://cloud.google.com/pubsub/docs/push#receive_push
+type pushEnvelope struct {
+	Message      PubSubMessage `json:"message"`
+	Subscription string        `json:"subscription"`
+}
+
+// NewPushHandler returns an http.Handler that accepts Pub/Sub push
+// deliveries and runs them through HandleLogAlert on the worker pool. A 2xx
+// response acks the message; any other status makes Pub/Sub redeliver it.
+func NewPushHandler(cfg PushConfig) (http.Handler, error) {
+	if cfg.Audience == "" && !cfg.SkipAuth {
+		return nil, fmt.Errorf("push audience is required when auth is enabled")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		reqLog := getLogger(ctx).ForRequest(ctx, r)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if !cfg.SkipAuth {
+			if err := verifyPushToken(r, cfg); err != nil {
+				reqLog.Warning("push token rejected", err)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if !beginDelivery() {
+			// nacked; Pub/Sub redelivers to an instance that is not stopping
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+		defer endDelivery()
+
+		var env pushEnvelope
+		if err := json.NewDecoder(r.Body).Decode(&env); err != nil {
+			reqLog.Error("failed to decode push envelope", err)
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := handlePooled(ctx, env.Message); err != nil {
+			http.Error(w, "delivery failed", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}), nil
+}
+
+// verifyPushToken validates the Google-signed OIDC token Pub/Sub attaches
+// to authenticated push requests.
+func verifyPushToken(r *http.Request, cfg PushConfig) error {
+	raw, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || raw == "" {
+		return fmt.Errorf("missing bearer token")
+	}
+	payload, err := idtoken.Validate(r.Context(), raw, cfg.Audience)
+	if err != nil {
+		return err
+	}
+	if !googleIssuers[payload.Issuer] {
+		return fmt.Errorf("unexpected issuer %q", payload.Issuer)
+	}
+	if cfg.ServiceAccountEmail != "" {
+		email, _ := payload.Claims["email"].(string)
+		verified, _ := payload.Claims["email_verified"].(bool)
+		if email != cfg.ServiceAccountEmail || !verified {
+			return fmt.Errorf("unexpected token email %q", email)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Quiet windows hold back non-critical alerts during planned maintenance or
+// outside business hours. They are configured with SLACK_QUIET_WINDOWS as a
+// ';'-separated list of specs, each either recurring or one-off:
+//
+//	mon-fri 19:00-07:00 America/Chicago   (recurring, wraps past midnight)
+//	sat,sun 00:00-24:00                   (recurring, UTC when no zone given)
+//	2026-10-20T01:00:00Z/2026-10-20T03:00:00Z   (one-off maintenance window)
+//
+// Entries at or above SLACK_QUIET_BYPASS_SEVERITY (default CRITICAL) are
+// always delivered. Suppressed entries are counted per window and a summary
+// is posted to the default channel on the first invocation after the window
+// closes; counts of a summary that fails to post are kept for the next one.
+//
+// A route destination can have windows of its own with the "quiet=<name>"
+// option, read from SLACK_QUIET_WINDOWS_<NAME> in the same format:
+//
+//	SLACK_ERROR_CHANNEL_ID=C0PAYMENTS;quiet=payments,C0OPS
+//	SLACK_QUIET_WINDOWS_PAYMENTS=mon-fri 19:00-07:00 Europe/Berlin
+//
+// holds back the payments channel's alerts below the bypass severity on
+// weekday nights while C0OPS still gets them. Their summaries go to that
+// destination only.
+
+type quietWindow struct {
+	spec string
+
+	// recurring windows
+	days       [7]bool // indexed by time.Weekday; the day the window opens
+	start, end int     // minutes since midnight; end <= start wraps to the next day
+	loc        *time.Location
+
+	// one-off windows
+	from, to time.Time
+}
+
+func (w *quietWindow) contains(t time.Time) bool {
+	if !w.from.IsZero() {
+		return !t.Before(w.from) && t.Before(w.to)
+	}
+	lt := t.In(w.loc)
+	m := lt.Hour()*60 + lt.Minute()
+	day := lt.Weekday()
+	if w.start < w.end {
+		return w.days[day] && m >= w.start && m < w.end
+	}
+	prev := (day + 6) % 7
+	return (w.days[day] && m >= w.start) || (w.days[prev] && m < w.end)
+}
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+func parseQuietWindow(spec string) (*quietWindow, error) {
+	spec = strings.TrimSpace(spec)
+	w := &quietWindow{spec: spec}
+
+	if from, to, ok := strings.Cut(spec, "/"); ok && !strings.Contains(spec, " ") {
+		var err error
+		if w.from, err = time.Parse(time.RFC3339, from); err != nil {
+			return nil, fmt.Errorf("quiet window %q: invalid start: %v", spec, err)
+		}
+		if w.to, err = time.Parse(time.RFC3339, to); err != nil {
+			return nil, fmt.Errorf("quiet window %q: invalid end: %v", spec, err)
+		}
+		if !w.to.After(w.from) {
+			return nil, fmt.Errorf("quiet window %q: end must be after start", spec)
+		}
+		return w, nil
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) < 2 || len(fields) > 3 {
+		return nil, fmt.Errorf("quiet window %q: expected \"<days> <HH:MM>-<HH:MM> [zone]\"", spec)
+	}
+	if err := parseWeekdays(fields[0], &w.days); err != nil {
+		return nil, fmt.Errorf("quiet window %q: %v", spec, err)
+	}
+	startStr, endStr, ok := strings.Cut(fields[1], "-")
+	if !ok {
+		return nil, fmt.Errorf("quiet window %q: invalid time range %q", spec, fields[1])
+	}
+	var err error
+	if w.start, err = parseClock(startStr); err != nil {
+		return nil, fmt.Errorf("quiet window %q: %v", spec, err)
+	}
+	if w.end, err = parseClock(endStr); err != nil {
+		return nil, fmt.Errorf("quiet window %q: %v", spec, err)
+	}
+	w.loc = time.UTC
+	if len(fields) == 3 {
+		if w.loc, err = time.LoadLocation(fields[2]); err != nil {
+			return nil, fmt.Errorf("quiet window %q: %v", spec, err)
+		}
+	}
+	return w, nil
+}
+
+// parseWeekdays accepts "*", comma-separated names and ranges like "mon-fri".
+func parseWeekdays(s string, days *[7]bool) error {
+	if s == "*" {
+		for i := range days {
+			days[i] = true
+		}
+		return nil
+	}
+	for _, part := range strings.Split(strings.ToLower(s), ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		start, ok := weekdayNames[from]
+		if !ok {
+			return fmt.Errorf("unknown weekday %q", from)
+		}
+		end := start
+		if isRange {
+			if end, ok = weekdayNames[to]; !ok {
+				return fmt.Errorf("unknown weekday %q", to)
+			}
+		}
+		for d := start; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == end {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes since midnight; 24:00 is allowed as an end.
+func parseClock(s string) (int, error) {
+	hh, mm, ok := strings.Cut(s, ":")
+	h, errH := strconv.Atoi(hh)
+	m, errM := strconv.Atoi(mm)
+	if !ok || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+// quietKey identifies a summary: a window and the target it is posted to,
+// empty for every destination of the default route.
+type quietKey struct {
+	window *quietWindow
+	target string
+}
+
+// quietSummary is the summary of a window that has closed.
+type quietSummary struct {
+	key    quietKey
+	counts map[string]int
+	text   string
+}
+
+// quietSchedule tracks suppressed counts for a set of windows.
+type quietSchedule struct {
+	windows []*quietWindow
+	bypass  logging.Severity
+
+	mu         sync.Mutex
+	suppressed map[quietKey]map[string]int // severity -> count
+}
+
+func parseQuietSchedule(specs string, bypass logging.Severity) (*quietSchedule, error) {
+	qs := &quietSchedule{bypass: bypass, suppressed: map[quietKey]map[string]int{}}
+	for _, spec := range strings.Split(specs, ";") {
+		if strings.TrimSpace(spec) == "" {
+			continue
+		}
+		w, err := parseQuietWindow(spec)
+		if err != nil {
+			return nil, err
+		}
+		qs.windows = append(qs.windows, w)
+	}
+	return qs, nil
+}
+
+// suppress reports whether an entry of the given severity falls in an active
+// window; if so it is counted towards that window's summary for target,
+// empty for the default route.
+func (qs *quietSchedule) suppress(now time.Time, severity, target string) bool {
+	if qs == nil || logging.ParseSeverity(severity) >= qs.bypass {
+		return false
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	for _, w := range qs.windows {
+		if w.contains(now) {
+			qs.count(quietKey{window: w, target: target}, map[string]int{strings.ToUpper(severity): 1})
+			return true
+		}
+	}
+	return false
+}
+
+// count adds counts to key's summary. qs.mu must be held.
+func (qs *quietSchedule) count(key quietKey, counts map[string]int) {
+	if qs.suppressed[key] == nil {
+		qs.suppressed[key] = map[string]int{}
+	}
+	for sev, n := range counts {
+		qs.suppressed[key][sev] += n
+	}
+}
+
+// restore puts the counts of a summary that could not be posted to target
+// back, so they are part of the next attempt.
+func (qs *quietSchedule) restore(s quietSummary, target string) {
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	qs.count(quietKey{window: s.key.window, target: target}, s.counts)
+}
+
+// carryQuietCounts moves the pending counts of old, the schedule before a
+// config reload, to qs so a reload does not lose them. Counts of windows
+// that are still configured move to the new window; the others keep their
+// window and are summarised once it closes. When qs is nil, old's counts
+// are kept in a schedule without windows.
+func carryQuietCounts(old, qs *quietSchedule) *quietSchedule {
+	if old == nil {
+		return qs
+	}
+	old.mu.Lock()
+	defer old.mu.Unlock()
+	if len(old.suppressed) == 0 {
+		return qs
+	}
+	if qs == nil {
+		qs = &quietSchedule{bypass: old.bypass, suppressed: map[quietKey]map[string]int{}}
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	for key, counts := range old.suppressed {
+		for _, w := range qs.windows {
+			if w.spec == key.window.spec {
+				key.window = w
+				break
+			}
+		}
+		qs.count(key, counts)
+	}
+	old.suppressed = map[quietKey]map[string]int{}
+	return qs
+}
+
+// endedSummaries returns summaries for windows that have closed since they
+// last suppressed something, and resets their counters; summaries that fail
+// to post are put back with restore.
+func (qs *quietSchedule) endedSummaries(now time.Time) []quietSummary {
+	if qs == nil {
+		return nil
+	}
+	qs.mu.Lock()
+	defer qs.mu.Unlock()
+	var out []quietSummary
+	for key, counts := range qs.suppressed {
+		w := key.window
+		if len(counts) == 0 || w.contains(now) {
+			continue
+		}
+		delete(qs.suppressed, key)
+
+		total := 0
+		sevs := make([]string, 0, len(counts))
+		for sev, n := range counts {
+			total += n
+			sevs = append(sevs, sev)
+		}
+		sort.Slice(sevs, func(i, j int) bool {
+			return logging.ParseSeverity(sevs[i]) > logging.ParseSeverity(sevs[j])
+		})
+		parts := make([]string, 0, len(sevs))
+		for _, sev := range sevs {
+			parts = append(parts, fmt.Sprintf("%s: %d", sev, counts[sev]))
+		}
+		out = append(out, quietSummary{
+			key:    key,
+			counts: counts,
+			text:   fmt.Sprintf("Quiet window ended (%s): %d alert(s) suppressed (%s)", w.spec, total, strings.Join(parts, ", ")),
+		})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].text != out[j].text {
+			return out[i].text < out[j].text
+		}
+		return out[i].key.target < out[j].key.target
+	})
+	return out
+}
+
+var (
+	quietHours         *quietSchedule
+	quietHoursErr      error
+	quietHoursInitOnce configOnce
+)
+
+// getQuietHours returns the schedule configured via env, or nil when none is set.
+func getQuietHours() (*quietSchedule, error) {
+	quietHoursInitOnce.Do(func() {
+		old := quietHours
+		quietHours, quietHoursErr = nil, nil
+		specs := setting("SLACK_QUIET_WINDOWS")
+		if specs == "" {
+			quietHours = carryQuietCounts(old, nil)
+			return
+		}
+		bypass, bypassErr := quietBypass()
+		qs, err := parseQuietSchedule(specs, bypass)
+		quietHours, quietHoursErr = carryQuietCounts(old, qs), errors.Join(bypassErr, err)
+	})
+	return quietHours, quietHoursErr
+}
+
+// quietBypass returns the severity from which alerts ignore quiet windows.
+func quietBypass() (logging.Severity, error) {
+	v := setting("SLACK_QUIET_BYPASS_SEVERITY")
+	if v == "" {
+		return logging.Critical, nil
+	}
+	// an unknown severity parses as DEFAULT, which would let everything
+	// bypass the windows
+	if !validSeverity(v) {
+		return logging.Critical, fmt.Errorf("invalid SLACK_QUIET_BYPASS_SEVERITY %q, using CRITICAL", v)
+	}
+	return logging.ParseSeverity(v), nil
+}
+
+// namedQuiet is a destination schedule and the config generation it was
+// parsed from.
+type namedQuiet struct {
+	qs  *quietSchedule
+	gen uint64
+}
+
+var (
+	namedQuietMu    sync.Mutex
+	namedQuietHours = map[string]*namedQuiet{}
+)
+
+// getNamedQuietHours returns the schedule of a destination's "quiet=<name>"
+// option, parsing it on first use and again after the config changed.
+// Schedules are never dropped, so their pending counts survive a reload
+// that breaks or removes them.
+func getNamedQuietHours(name string) (*quietSchedule, error) {
+	namedQuietMu.Lock()
+	defer namedQuietMu.Unlock()
+	gen := configGeneration.Load()
+	nq, ok := namedQuietHours[name]
+	if ok && nq.gen == gen {
+		return nq.qs, nil
+	}
+	if !ok {
+		nq = &namedQuiet{}
+		namedQuietHours[name] = nq
+	}
+	key := "SLACK_QUIET_WINDOWS_" + envName(name)
+	specs := setting(key)
+	if specs == "" {
+		nq.qs = carryQuietCounts(nq.qs, nil)
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	bypass, err := quietBypass()
+	if err != nil {
+		nq.qs = carryQuietCounts(nq.qs, nil)
+		return nil, err
+	}
+	qs, err := parseQuietSchedule(specs, bypass)
+	if err != nil {
+		nq.qs = carryQuietCounts(nq.qs, nil)
+		return nil, fmt.Errorf("%s: %v", key, err)
+	}
+	nq.qs, nq.gen = carryQuietCounts(nq.qs, qs), gen
+	return nq.qs, nil
+}
+
+// namedQuietSchedules returns the destination schedules in use.
+func namedQuietSchedules() []*quietSchedule {
+	namedQuietMu.Lock()
+	defer namedQuietMu.Unlock()
+	out := make([]*quietSchedule, 0, len(namedQuietHours))
+	for _, nq := range namedQuietHours {
+		if nq.qs != nil {
+			out = append(out, nq.qs)
+		}
+	}
+	return out
+}
+
+// suppressForDestination reports whether d's own quiet windows hold the
+// alert back, counting it towards their summary for d. A broken schedule
+// fails open.
+func suppressForDestination(reqLog *logger.RequestLogger, d Destination, a *Alert, now time.Time) bool {
+	qs, err := getNamedQuietHours(d.QuietWindow)
+	if err != nil {
+		reqLog.Error("invalid quiet window config", err, map[string]any{"target": d.Target})
+		return false
+	}
+	if !qs.suppress(now, a.Severity, d.Target) {
+		return false
+	}
+	countMetric(reqLog, metricSuppressed, map[string]string{"reason": "quiet_window"})
+	reqLog.Info("alert suppressed by destination quiet window", map[string]any{"target": d.Target, "window": d.QuietWindow, "severity": a.Severity})
+	return true
+}
+
+// postQuietSummaries sends end-of-window summaries of qs to their target,
+// or to every destination of the default route, regardless of their
+// severity floors. Counts of summaries that failed to post with a transient
+// error are restored and posted again on the next invocation.
+func postQuietSummaries(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, qs *quietSchedule, summaries []quietSummary) {
+	for _, s := range summaries {
+		targets := []string{s.key.target}
+		if s.key.target == "" {
+			targets = targets[:0]
+			for _, d := range routeForSeverity("", "") {
+				targets = append(targets, d.Target)
+			}
+		}
+		for _, target := range targets {
+			err := deliver(ctx, reqLog, notifier, target, newAlert("INFO", s.text, nil))
+			if err == nil {
+				continue
+			}
+			reqLog.Error("failed to post quiet window summary", err, map[string]any{"target": target})
+			if !IsPermanent(err) {
+				qs.restore(s, target)
+			}
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// recentAlertsSize is how many alerts each instance remembers for
+// "/ieos-alerts recent".
+const recentAlertsSize = 50
+
+// recentAlert is a handled alert as listed by the slash command.
+type recentAlert struct {
+	At       time.Time
+	Severity string
+	Service  string
+	Title    string
+	Headline string
+	Muted    string // why it was not posted, if it was not
+}
+
+// recentBuffer is a fixed-size ring of the latest alerts.
+type recentBuffer struct {
+	mu    sync.Mutex
+	items []recentAlert
+	next  int
+}
+
+func newRecentBuffer(size int) *recentBuffer {
+	return &recentBuffer{items: make([]recentAlert, 0, size)}
+}
+
+func (b *recentBuffer) add(r recentAlert) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.items) < cap(b.items) {
+		b.items = append(b.items, r)
+		return
+	}
+	b.items[b.next] = r
+	b.next = (b.next + 1) % len(b.items)
+}
+
+// latest returns up to limit alerts, newest first, whose service or title
+// contains filter (case-insensitive); an empty filter matches everything.
+func (b *recentBuffer) latest(filter string, limit int) []recentAlert {
+	return b.matching(recentFilter(filter), limit)
+}
+
+// matching returns up to limit alerts for which match is true, newest first.
+func (b *recentBuffer) matching(match func(recentAlert) bool, limit int) []recentAlert {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var out []recentAlert
+	for i := 0; i < len(b.items) && len(out) < limit; i++ {
+		r := b.items[(b.next-1-i+2*len(b.items))%len(b.items)]
+		if match(r) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// recentFilter matches alerts whose service or title contains filter
+// (case-insensitive); an empty filter matches everything.
+func recentFilter(filter string) func(recentAlert) bool {
+	filter = strings.ToLower(filter)
+	return func(r recentAlert) bool {
+		return filter == "" || strings.Contains(strings.ToLower(r.Service), filter) || strings.Contains(strings.ToLower(r.Title), filter)
+	}
+}
+
+var recentAlerts = newRecentBuffer(recentAlertsSize)
+
+// entryService names the workload that produced the entry, from the
+// resource labels most monitored resource types carry.
+func entryService(e *LogEntry) string {
+	for _, key := range []string{"service_name", "function_name", "job_name", "container_name", "module_id"} {
+		if v := e.Resource.Labels[key]; v != "" {
+			return v
+		}
+	}
+	return e.Resource.Type
+}
+
+// recordRecent remembers a handled alert; muted says why it was held back.
+func recordRecent(a *Alert, now time.Time, muted string) {
+	r := recentAlert{At: now, Severity: a.Severity, Title: a.Title, Headline: digestSample(a.Text), Muted: muted}
+	if a.Entry != nil {
+		r.At = a.Timestamp()
+		r.Service = entryService(a.Entry)
+	}
+	recentAlerts.add(r)
+}
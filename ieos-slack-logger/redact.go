@@ -0,0 +1,97 @@
+package service
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// Formatted messages, template output and snippets are redacted before they
+// are posted, since log payloads occasionally carry customer data or
+// credentials. Built-in rules cover tokens and keys, email addresses and
+// card-like numbers (Luhn checked); SLACK_REDACT_PATTERNS adds regular
+// expressions, one per line, whose matches are replaced with "[redacted]".
+// SLACK_REDACT=off disables redaction.
+
+type redactRule struct {
+	re          *regexp.Regexp
+	replacement string
+	// keep, when set, reports whether a match is a false positive.
+	keep func(match string) bool
+}
+
+var builtinRedactRules = []redactRule{
+	{re: regexp.MustCompile(`-----BEGIN [A-Z ]*PRIVATE KEY-----[\s\S]*?-----END [A-Z ]*PRIVATE KEY-----`), replacement: "[redacted:private-key]"},
+	{re: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`), replacement: "[redacted:slack-token]"},
+	{re: regexp.MustCompile(`\bAKIA[0-9A-Z]{16}\b`), replacement: "[redacted:aws-key]"},
+	{re: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`), replacement: "[redacted:google-api-key]"},
+	{re: regexp.MustCompile(`\beyJ[0-9A-Za-z_-]+\.eyJ[0-9A-Za-z_-]+\.[0-9A-Za-z_-]+`), replacement: "[redacted:jwt]"},
+	{re: regexp.MustCompile(`(?i)\b(bearer|basic)\s+[0-9A-Za-z._~+/=-]{8,}`), replacement: "$1 [redacted]"},
+	{re: regexp.MustCompile(`(?i)((?:password|passwd|secret|token|api[_-]?key|client[_-]?secret)"?\s*[:=]\s*"?)[^\s",}&]+`), replacement: "${1}[redacted]"},
+	{re: regexp.MustCompile(`\b[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}\b`), replacement: "[redacted:email]"},
+	{re: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), replacement: "[redacted:card]", keep: func(m string) bool { return !luhnValid(m) }},
+}
+
+// luhnValid reports whether the digits in s pass the Luhn checksum.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+var (
+	redactRules    []redactRule
+	redactInitOnce configOnce
+)
+
+func getRedactRules() []redactRule {
+	redactInitOnce.Do(func() {
+		redactRules = nil
+		if setting("SLACK_REDACT") == "off" {
+			return
+		}
+		redactRules = append(redactRules, builtinRedactRules...)
+		for _, p := range strings.Split(setting("SLACK_REDACT_PATTERNS"), "\n") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			re, err := regexp.Compile(p)
+			if err != nil {
+				log.Printf("invalid SLACK_REDACT_PATTERNS entry %q, skipped: %v", p, err)
+				continue
+			}
+			redactRules = append(redactRules, redactRule{re: re, replacement: "[redacted]"})
+		}
+	})
+	return redactRules
+}
+
+// redact masks secrets and personal data in s.
+func redact(s string) string {
+	for _, r := range getRedactRules() {
+		if r.keep == nil {
+			s = r.re.ReplaceAllString(s, r.replacement)
+			continue
+		}
+		s = r.re.ReplaceAllStringFunc(s, func(m string) string {
+			if r.keep(m) {
+				return m
+			}
+			return r.replacement
+		})
+	}
+	return s
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// RetryPolicy retries transient Slack failures (network errors, 5xx, rate
+// limits and Slack's internal errors) with jittered exponential backoff.
+// Permanent failures are returned at once so they can be dead-lettered, and
+// retries never outlast the context deadline.
+type RetryPolicy struct {
+	// MaxAttempts counts the first try; 1 disables retries. Defaults to 3.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled on each
+	// further retry. Defaults to 500ms.
+	BaseDelay time.Duration
+	// MaxDelay caps a single delay, including a rate limit's Retry-After.
+	// Defaults to 10s.
+	MaxDelay time.Duration
+}
+
+const (
+	defaultRetryAttempts  = 3
+	defaultRetryBaseDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+)
+
+// transientSlackCodes are Slack API error codes worth another try.
+var transientSlackCodes = map[string]bool{
+	"ratelimited":         true,
+	"internal_error":      true,
+	"fatal_error":         true,
+	"service_unavailable": true,
+	"request_timeout":     true,
+}
+
+func (p RetryPolicy) withDefaults() RetryPolicy {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultRetryAttempts
+	}
+	if p.BaseDelay <= 0 {
+		p.BaseDelay = defaultRetryBaseDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = defaultRetryMaxDelay
+	}
+	return p
+}
+
+// retryDelay returns how long to wait before retrying err after the given
+// attempt (1-based), or false when err is not transient.
+func (p RetryPolicy) retryDelay(err error, attempt int) (time.Duration, bool) {
+	var rl *slack.RateLimitedError
+	if errors.As(err, &rl) {
+		return min(rl.RetryAfter, p.MaxDelay), true
+	}
+	if !isTransientSlackError(err) {
+		return 0, false
+	}
+	d := p.BaseDelay << (attempt - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	// full jitter between half and all of the delay spreads out instances
+	// retrying after the same outage
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1)), true
+}
+
+func isTransientSlackError(err error) bool {
+	var retryable interface{ Retryable() bool } // slack.StatusCodeError: 5xx and 429
+	if errors.As(err, &retryable) {
+		return retryable.Retryable()
+	}
+	var apiErr slack.SlackErrorResponse
+	if errors.As(err, &apiErr) {
+		return transientSlackCodes[apiErr.Err]
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// do calls fn until it succeeds, fails permanently, runs out of attempts or
+// ctx is done. The last error from fn is returned.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts {
+			return err
+		}
+		delay, ok := p.retryDelay(err, attempt)
+		if !ok {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Routes are read from SLACK_ERROR_CHANNEL_ID (ERROR and above),
+// SLACK_WARNING_CHANNEL_ID (WARNING, NOTICE) and SLACK_DEFAULT_CHANNEL_ID
+// (everything else, and the fallback for the other two). Each holds a
+// comma-separated list of destinations, optionally with a severity floor:
+//
+//	C0123456,webhook:pagerduty>=CRITICAL,sms:oncall>=ALERT
+//
+// A destination is a Slack channel ID, "workspace/channel", or a sink such
+// as "webhook:<name>", optionally followed by "|<template>" (see
+// SLACK_TEMPLATE_<NAME>) and by options separated with ";":
+//
+//	C0123456|payments;nounfurl;nomentions>=ERROR
+//
+// "nounfurl" posts without link and media previews, "nomentions" turns user,
+// group and channel mentions in the payload into plain text, "escape" shows
+// payload text verbatim, Slack markup included, and "dryrun" only logs what
+// would have been delivered (see SLACK_DRY_RUN). "quiet=<name>" holds back
+// the destination's non-critical alerts during the quiet windows in
+// SLACK_QUIET_WINDOWS_<NAME>, on top of the global ones. All destinations
+// are delivered concurrently and fail independently.
+//
+// A centralized deployment serving several projects can give a project its
+// own routes with the project ID as suffix, e.g. SLACK_ERROR_CHANNEL_ID_MY_PROD
+// for entries whose logName is "projects/my-prod/logs/...". A project with
+// any route of its own uses only its own routes.
+
+// Destination is one fan-out target of a route.
+type Destination struct {
+	Target      string
+	MinSeverity logging.Severity // zero (DEFAULT) accepts everything
+	Template    string           // optional message template name
+	NoUnfurl    bool             // post without link and media previews
+	NoMentions  bool             // neutralise mentions in payload text
+	Escape      bool             // escape Slack markup in payload text
+	DryRun      bool             // log the message instead of delivering it
+	QuietWindow string           // optional named quiet window set
+}
+
+// destinationOptions set the option flags of a destination by name.
+var destinationOptions = map[string]func(*Destination){
+	"nounfurl":   func(d *Destination) { d.NoUnfurl = true },
+	"nomentions": func(d *Destination) { d.NoMentions = true },
+	"escape":     func(d *Destination) { d.Escape = true },
+	"dryrun":     func(d *Destination) { d.DryRun = true },
+}
+
+// quietOption returns the window set name of a "quiet=<name>" option.
+func quietOption(opt string) (string, bool) {
+	key, name, ok := strings.Cut(opt, "=")
+	if !ok || !strings.EqualFold(strings.TrimSpace(key), "quiet") || strings.TrimSpace(name) == "" {
+		return "", false
+	}
+	return strings.TrimSpace(name), true
+}
+
+func (d Destination) accepts(sev logging.Severity) bool {
+	return sev >= d.MinSeverity
+}
+
+func parseDestinations(spec string) []Destination {
+	var out []Destination
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		d := Destination{Target: part}
+		if target, min, ok := strings.Cut(part, ">="); ok {
+			d.Target, d.MinSeverity = strings.TrimSpace(target), logging.ParseSeverity(strings.TrimSpace(min))
+		}
+		opts := strings.Split(d.Target, ";")
+		d.Target = strings.TrimSpace(opts[0])
+		for _, opt := range opts[1:] {
+			opt = strings.TrimSpace(opt)
+			if name, ok := quietOption(opt); ok {
+				d.QuietWindow = name
+			} else if set, ok := destinationOptions[strings.ToLower(opt)]; ok {
+				set(&d)
+			}
+		}
+		if target, tmpl, ok := strings.Cut(d.Target, "|"); ok {
+			d.Target, d.Template = strings.TrimSpace(target), strings.TrimSpace(tmpl)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+// projectRouteKeys are the route settings a project or environment can
+// override.
+var projectRouteKeys = []string{"SLACK_ERROR_CHANNEL_ID", "SLACK_WARNING_CHANNEL_ID", "SLACK_DEFAULT_CHANNEL_ID"}
+
+// routeSuffix returns the settings suffix of the first scope (a project or
+// environment) that has routes of its own, or "" when none has.
+func routeSuffix(scopes ...string) string {
+	for _, scope := range scopes {
+		if scope == "" {
+			continue
+		}
+		suffix := "_" + envName(scope)
+		for _, key := range projectRouteKeys {
+			if setting(key+suffix) != "" {
+				return suffix
+			}
+		}
+	}
+	return ""
+}
+
+// routeForSeverity returns the destinations for a severity in the first of
+// scopes (project, then environment; empty when unknown) with routes of its
+// own. When nothing is configured it returns a single empty target, which
+// surfaces as a "channel ID is required" delivery error.
+func routeForSeverity(sev string, scopes ...string) []Destination {
+	suffix := routeSuffix(scopes...)
+	spec := ""
+	switch level := logging.ParseSeverity(sev); {
+	case level >= logging.Error:
+		spec = setting("SLACK_ERROR_CHANNEL_ID" + suffix)
+	case level >= logging.Notice:
+		spec = setting("SLACK_WARNING_CHANNEL_ID" + suffix)
+	}
+	if spec == "" {
+		spec = setting("SLACK_DEFAULT_CHANNEL_ID" + suffix)
+	}
+	if dests := parseDestinations(spec); len(dests) > 0 {
+		return dests
+	}
+	return []Destination{{}}
+}
+
+// fanOut delivers the alert to every destination concurrently, rendered
+// with the destination's template if it has one. Targets already delivered
+// for this message ID (on an earlier, partially failed attempt) are skipped;
+// permanent failures are dead-lettered per target. The returned error is
+// non-nil only when some target should be retried by redelivery.
+func fanOut(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, m PubSubMessage, dests []Destination, a *Alert) error {
+	id := messageID(ctx, m)
+	store, _ := getDedupStore()
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []error
+	)
+	for _, d := range dests {
+		key := id + ":" + strings.ReplaceAll(d.Target, "/", "_")
+		if id != "" {
+			if seen, _ := store.Seen(ctx, key); seen {
+				continue
+			}
+		}
+		wg.Add(1)
+		go func(d Destination, key string) {
+			defer wg.Done()
+			da := a.forDestination(d)
+			if d.Template != "" {
+				if rendered, err := renderTemplate(d.Template, da); err != nil {
+					reqLog.Error("message template failed, using default format", err, map[string]any{"target": d.Target, "template": d.Template})
+				} else {
+					da = rendered
+				}
+			}
+			if dryRun(d) {
+				logDryRun(reqLog, d.Target, da)
+				return
+			}
+			err := deliver(ctx, reqLog, notifier, d.Target, da)
+			if err == nil {
+				countMetric(reqLog, metricPosted, map[string]string{"target": d.Target})
+				if id != "" {
+					_ = store.MarkProcessed(ctx, key)
+				}
+				return
+			}
+			reqLog.Error("alert delivery failed", err, map[string]any{"target": d.Target})
+			countMetric(reqLog, metricFailed, map[string]string{"target": d.Target, "reason": failureReason(err)})
+			if err := handleDeliveryFailure(ctx, reqLog, m, d.Target, err); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}(d, key)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
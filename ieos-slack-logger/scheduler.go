@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// A Cloud Scheduler job should call the scheduler endpoint every minute so
+// time-based work happens even when no log entries arrive: overdue
+// escalations, heartbeats, daily summaries and replays of alerts held back
+// during a Slack outage.
+
+// runScheduledTasks runs the time-based work. It is not piggybacked on
+// Pub/Sub invocations, which would repeat its Firestore queries and Slack
+// posts for every entry of an error burst.
+func runScheduledTasks(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, now time.Time) {
+	reloadConfig(ctx, reqLog, now)
+	runEscalations(ctx, reqLog, notifier, now)
+	runHeartbeat(ctx, reqLog, notifier, now)
+	runDailySummary(ctx, reqLog, notifier, now)
+	replayHeldAlerts(ctx, reqLog, notifier, now)
+}
+
+// NewSchedulerHandler returns an http.Handler for the Cloud Scheduler job.
+// The job's OIDC token is verified like a push delivery's.
+func NewSchedulerHandler(cfg PushConfig) (http.Handler, error) {
+	if cfg.Audience == "" && !cfg.SkipAuth {
+		return nil, fmt.Errorf("audience is required when auth is enabled")
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		reqLog := getLogger(ctx).ForRequest(ctx, r)
+		if !cfg.SkipAuth {
+			if err := verifyPushToken(r, cfg); err != nil {
+				reqLog.Warning("scheduler token rejected", err)
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+		}
+		runScheduledTasks(ctx, reqLog, getWorkspaces(ctx), time.Now().UTC())
+		w.WriteHeader(http.StatusNoContent)
+	}), nil
+}
+
+// HandleScheduledTasks is the HTTP Cloud Function equivalent of
+// NewSchedulerHandler. Deploy it without unauthenticated access; IAM takes
+// the place of token verification.
+func HandleScheduledTasks(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	runScheduledTasks(ctx, getLogger(ctx).ForRequest(ctx, r), getWorkspaces(ctx), time.Now().UTC())
+	w.WriteHeader(http.StatusNoContent)
+}
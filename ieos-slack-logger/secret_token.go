@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+)
+
+// secretTokenSource returns a NotifierConfig.TokenSource that reads the token
+// from a Secret Manager version, e.g. "projects/p/secrets/slack-bot-token/versions/latest".
+func secretTokenSource(name string) func(ctx context.Context) (string, error) {
+	var (
+		once    sync.Once
+		client  *secretmanager.Client
+		initErr error
+	)
+	return func(ctx context.Context) (string, error) {
+		once.Do(func() {
+			// The client is reused across requests, so it must not inherit ctx's deadline.
+			client, initErr = secretmanager.NewClient(context.Background())
+		})
+		if initErr != nil {
+			return "", initErr
+		}
+		resp, err := client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(resp.GetPayload().GetData())), nil
+	}
+}
@@ -0,0 +1,121 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"cloud.google.com/go/logging"
+)
+
+// SLACK_SEVERITY_RULES remaps the severity of entries before they are
+// routed and formatted, one rule per line:
+//
+//	<log ID> <FROM>=<TO> [~<regexp>]
+//
+// e.g. "payments-worker WARNING=ERROR" escalates a log whose warnings
+// matter, and "run.googleapis.com/stderr ERROR=NOTICE ~cache warm-up" tames
+// a known-noisy error. The log ID is unescaped ("run.googleapis.com/stderr",
+// not "%2F"); either it or FROM may be "*". The optional regexp must match
+// the textPayload or jsonPayload.message. The first matching rule wins.
+
+// severityRule is one line of SLACK_SEVERITY_RULES.
+type severityRule struct {
+	logID string // "*" matches every log
+	from  string // "*" matches every severity
+	to    string
+	match *regexp.Regexp // optional
+}
+
+// parseSeverityRule parses one rule line.
+func parseSeverityRule(spec string) (severityRule, error) {
+	var r severityRule
+	head, pattern, hasPattern := strings.Cut(spec, "~")
+	fields := strings.Fields(head)
+	if len(fields) != 2 {
+		return r, fmt.Errorf("invalid severity rule %q: expected <log ID> <FROM>=<TO> [~<regexp>]", spec)
+	}
+	from, to, ok := strings.Cut(fields[1], "=")
+	if !ok {
+		return r, fmt.Errorf("invalid severity rule %q: expected <FROM>=<TO>", spec)
+	}
+	r.logID, r.from, r.to = fields[0], strings.ToUpper(from), strings.ToUpper(to)
+	if r.from != "*" && !validSeverity(r.from) {
+		return r, fmt.Errorf("invalid severity rule %q: unknown severity %q", spec, from)
+	}
+	if !validSeverity(r.to) {
+		return r, fmt.Errorf("invalid severity rule %q: unknown severity %q", spec, to)
+	}
+	if hasPattern {
+		re, err := regexp.Compile(strings.TrimSpace(pattern))
+		if err != nil {
+			return r, fmt.Errorf("invalid severity rule %q: %v", spec, err)
+		}
+		r.match = re
+	}
+	return r, nil
+}
+
+// entryLogID returns the unescaped log ID of the entry's logName.
+func entryLogID(e *LogEntry) string {
+	_, id, _ := strings.Cut(e.LogName, "/logs/")
+	if unescaped, err := url.PathUnescape(id); err == nil {
+		return unescaped
+	}
+	return id
+}
+
+func (r severityRule) applies(e *LogEntry) bool {
+	if r.logID != "*" && r.logID != entryLogID(e) {
+		return false
+	}
+	if r.from != "*" && logging.ParseSeverity(r.from) != e.SeverityLevel() {
+		return false
+	}
+	if r.match == nil {
+		return true
+	}
+	message := e.TextPayload
+	if message == "" {
+		message, _ = e.JSONPayload["message"].(string)
+	}
+	return r.match.MatchString(message)
+}
+
+var (
+	severityRules         []severityRule
+	severityRulesInitOnce configOnce
+)
+
+func getSeverityRules() []severityRule {
+	severityRulesInitOnce.Do(func() {
+		severityRules = nil
+		for _, spec := range strings.Split(setting("SLACK_SEVERITY_RULES"), "\n") {
+			if spec = strings.TrimSpace(spec); spec == "" {
+				continue
+			}
+			r, err := parseSeverityRule(spec)
+			if err != nil {
+				log.Printf("%v, skipped", err)
+				continue
+			}
+			severityRules = append(severityRules, r)
+		}
+	})
+	return severityRules
+}
+
+// remapSeverity applies the first matching rule to the entry and returns
+// the severity it had before, or "" when no rule matched.
+func remapSeverity(e *LogEntry) string {
+	for _, r := range getSeverityRules() {
+		if r.applies(e) {
+			original := e.Severity
+			e.Severity = r.to
+			return original
+		}
+	}
+	return ""
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A long-running server (see cmd/server) calls Shutdown on SIGTERM. Push
+// deliveries that arrive afterwards are answered 503 so Pub/Sub redelivers
+// them to another instance, the ones in flight are waited for, and what this
+// instance still buffers (digests, batched emails) is sent before it exits.
+
+var (
+	shutdownMu sync.Mutex // orders inflight.Add against inflight.Wait
+	draining   bool
+	inflight   sync.WaitGroup
+)
+
+// beginDelivery registers an in-flight push delivery, or reports false once
+// Shutdown was called. Every true result must be paired with endDelivery.
+func beginDelivery() bool {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	if draining {
+		return false
+	}
+	inflight.Add(1)
+	return true
+}
+
+func endDelivery() { inflight.Done() }
+
+// flusher is implemented by sinks that batch alerts.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// Shutdown stops intake of push deliveries, waits for the ones in flight and
+// flushes buffered digests, held stale entries and sink batches. The flush
+// is best-effort: once ctx is done the remaining deliveries fail, and
+// whatever has not been posted by then is lost with the instance.
+func Shutdown(ctx context.Context) error {
+	shutdownMu.Lock()
+	draining = true
+	shutdownMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		inflight.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return fmt.Errorf("waiting for in-flight deliveries: %w", ctx.Err())
+	}
+
+	reqLog := getLogger(ctx).ForRequest(ctx, nil)
+	if d, _ := getDigest(); d != nil {
+		postDigests(ctx, reqLog, getWorkspaces(ctx), d, d.drain())
+	}
+	if late, _ := getStaleBatch(); late != nil {
+		postStaleSummaries(ctx, reqLog, getWorkspaces(ctx), late.drain(), time.Now())
+	}
+
+	sinksMu.Lock()
+	keys := make([]string, 0, len(sinks))
+	batched := map[string]flusher{}
+	for key, s := range sinks {
+		if f, ok := s.(flusher); ok {
+			keys = append(keys, key)
+			batched[key] = f
+		}
+	}
+	sinksMu.Unlock()
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if err := batched[key].Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,175 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/slack-go/slack"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Every inbound Slack endpoint (interactivity, slash commands, events) sits
+// behind VerifySlackRequests. Slack signs each request with the app's
+// signing secret over its timestamp and body; requests with a bad signature
+// or a timestamp more than five minutes off are rejected, and so is a second
+// request carrying a signature already seen, which stops a captured request
+// from being replayed within that window. Signatures are remembered per
+// instance; setting SLACK_REPLAY_FIRESTORE_COLLECTION shares them across
+// instances. Documents carry an expireAt field for a Firestore TTL policy.
+
+const (
+	// maxSlackRequestBody bounds request bodies; Slack's are a few KB.
+	maxSlackRequestBody = 1 << 20
+	// slackSignatureMaxAge is how far a request timestamp may be off, as
+	// enforced by slack.NewSecretsVerifier.
+	slackSignatureMaxAge = 5 * time.Minute
+	seenSignaturesSize   = 10000
+)
+
+// VerifySlackRequests returns a handler that only passes POST requests
+// signed with one of secrets, and not seen before, on to next. The body is
+// restored so next can read it as usual.
+func VerifySlackRequests(secrets []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		reqLog := getLogger(ctx).ForRequest(ctx, r)
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxSlackRequestBody))
+		if err != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if err := verifySlackSignature(r.Header, body, secrets); err != nil {
+			reqLog.Warning("slack signature rejected", err)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		replayed, err := seenSlackSignature(ctx, r.Header.Get("X-Slack-Signature"))
+		if err != nil {
+			// the signature and timestamp checked out; failing closed would
+			// only make Slack retry
+			reqLog.Error("slack replay check failed", err)
+		}
+		if replayed {
+			reqLog.Warning("slack request replayed", map[string]any{"timestamp": r.Header.Get("X-Slack-Request-Timestamp")})
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		next.ServeHTTP(w, r)
+	})
+}
+
+// verifySlackSignature checks X-Slack-Signature against each secret.
+// See: https://api.slack.com/authentication/verifying-requests-from-slack
+func verifySlackSignature(header http.Header, body []byte, secrets []string) error {
+	if len(secrets) == 0 {
+		return fmt.Errorf("no slack signing secret configured")
+	}
+	var err error
+	for _, secret := range secrets {
+		var sv slack.SecretsVerifier
+		if sv, err = slack.NewSecretsVerifier(header, secret); err != nil {
+			// missing headers or a stale timestamp fail for every secret
+			return err
+		}
+		if _, err = sv.Write(body); err != nil {
+			return err
+		}
+		if err = sv.Ensure(); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// signatureStore remembers the signatures of verified requests.
+type signatureStore struct {
+	local  *lruStore
+	shared *firestore.CollectionRef // optional
+}
+
+// seen records signature and reports whether it had been recorded before.
+func (s *signatureStore) seen(ctx context.Context, signature string) (bool, error) {
+	if seen, _ := s.local.Seen(ctx, signature); seen {
+		return true, nil
+	}
+	_ = s.local.MarkProcessed(ctx, signature)
+	if s.shared == nil {
+		return false, nil
+	}
+	now := time.Now().UTC()
+	// "v0=<hex>" is a valid document ID
+	_, err := s.shared.Doc(signature).Create(ctx, map[string]any{
+		"seenAt":   now,
+		"expireAt": now.Add(slackSignatureMaxAge),
+	})
+	if status.Code(err) == codes.AlreadyExists {
+		return true, nil
+	}
+	return false, err
+}
+
+var (
+	signatures         *signatureStore
+	signaturesErr      error
+	signaturesInitOnce sync.Once
+)
+
+func getSignatureStore() (*signatureStore, error) {
+	signaturesInitOnce.Do(func() {
+		signatures = &signatureStore{local: newLRUStore(seenSignaturesSize)}
+		collection := setting("SLACK_REPLAY_FIRESTORE_COLLECTION")
+		if collection == "" {
+			return
+		}
+		client, err := getFirestore()
+		if err != nil {
+			signaturesErr = err
+			return
+		}
+		signatures.shared = client.Collection(collection)
+	})
+	return signatures, signaturesErr
+}
+
+// seenSlackSignature reports whether a request with this signature was
+// already accepted.
+func seenSlackSignature(ctx context.Context, signature string) (bool, error) {
+	s, err := getSignatureStore()
+	seen, serr := s.seen(ctx, signature)
+	if err == nil {
+		err = serr
+	}
+	return seen, err
+}
+
+// signingSecretsFromEnv reads SLACK_SIGNING_SECRET and, for each workspace in
+// SLACK_WORKSPACES, SLACK_SIGNING_SECRET_<NAME>.
+func signingSecretsFromEnv() []string {
+	var secrets []string
+	if s := setting("SLACK_SIGNING_SECRET"); s != "" {
+		secrets = append(secrets, s)
+	}
+	for _, name := range strings.Split(setting("SLACK_WORKSPACES"), ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if s := setting("SLACK_SIGNING_SECRET_" + envName(name)); s != "" {
+			secrets = append(secrets, s)
+		}
+	}
+	return secrets
+}
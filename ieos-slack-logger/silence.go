@@ -0,0 +1,172 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+)
+
+// Silences mute every alert whose text contains a pattern (case-insensitive)
+// until they expire. They are managed with the /ieos-alerts slash command
+// (see NewCommandHandler) and kept per instance unless
+// SLACK_SILENCE_FIRESTORE_COLLECTION is set. With a shared collection each
+// instance re-reads the active silences at most every silenceSyncInterval.
+
+const (
+	maxSilenceDuration  = 7 * 24 * time.Hour
+	silenceSyncInterval = 30 * time.Second
+)
+
+// silenceRecord is one active silence.
+type silenceRecord struct {
+	Pattern   string    `firestore:"pattern"`
+	CreatedBy string    `firestore:"createdBy"` // Slack user ID
+	CreatedAt time.Time `firestore:"createdAt"`
+	Until     time.Time `firestore:"until"`
+	ExpireAt  time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+func (r silenceRecord) matches(text string) bool {
+	return strings.Contains(strings.ToLower(text), strings.ToLower(r.Pattern))
+}
+
+// silenceDocID keys silences by pattern; patterns may contain characters
+// Firestore does not allow in document IDs.
+func silenceDocID(pattern string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(pattern)))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// silenceStore holds the active silences.
+type silenceStore struct {
+	shared *firestore.CollectionRef // optional
+
+	mu     sync.Mutex
+	local  map[string]silenceRecord // by silenceDocID
+	synced time.Time
+}
+
+func (s *silenceStore) add(ctx context.Context, rec silenceRecord) error {
+	id := silenceDocID(rec.Pattern)
+	s.mu.Lock()
+	s.local[id] = rec
+	s.mu.Unlock()
+	if s.shared == nil {
+		return nil
+	}
+	_, err := s.shared.Doc(id).Set(ctx, rec)
+	return err
+}
+
+// remove deletes the silence for pattern and reports whether one was active.
+func (s *silenceStore) remove(ctx context.Context, pattern string, now time.Time) (bool, error) {
+	active, err := s.list(ctx, now)
+	if err != nil {
+		return false, err
+	}
+	id := silenceDocID(pattern)
+	found := false
+	for _, rec := range active {
+		found = found || silenceDocID(rec.Pattern) == id
+	}
+	s.mu.Lock()
+	delete(s.local, id)
+	s.mu.Unlock()
+	if s.shared == nil {
+		return found, nil
+	}
+	_, err = s.shared.Doc(id).Delete(ctx)
+	return found, err
+}
+
+// list returns the silences active at now, soonest to expire first. When the
+// shared backend fails the local view is returned along with the error.
+func (s *silenceStore) list(ctx context.Context, now time.Time) ([]silenceRecord, error) {
+	if s == nil {
+		return nil, nil
+	}
+	var err error
+	if s.shared != nil {
+		s.mu.Lock()
+		stale := now.Sub(s.synced) >= silenceSyncInterval
+		s.mu.Unlock()
+		if stale {
+			err = s.sync(ctx, now)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]silenceRecord, 0, len(s.local))
+	for id, rec := range s.local {
+		if !now.Before(rec.Until) {
+			delete(s.local, id)
+			continue
+		}
+		out = append(out, rec)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Until.Before(out[j].Until) })
+	return out, err
+}
+
+// sync replaces the local view with the active silences in Firestore.
+func (s *silenceStore) sync(ctx context.Context, now time.Time) error {
+	snaps, err := s.shared.Where("until", ">", now).Documents(ctx).GetAll()
+	if err != nil {
+		return err
+	}
+	local := make(map[string]silenceRecord, len(snaps))
+	for _, snap := range snaps {
+		var rec silenceRecord
+		if err := snap.DataTo(&rec); err != nil {
+			return err
+		}
+		local[snap.Ref.ID] = rec
+	}
+	s.mu.Lock()
+	s.local, s.synced = local, now
+	s.mu.Unlock()
+	return nil
+}
+
+// match returns the silence muting text at now, if any.
+func (s *silenceStore) match(ctx context.Context, text string, now time.Time) (*silenceRecord, error) {
+	active, err := s.list(ctx, now)
+	for _, rec := range active {
+		if rec.matches(text) {
+			return &rec, nil
+		}
+	}
+	return nil, err
+}
+
+var (
+	silences         *silenceStore
+	silencesErr      error
+	silencesInitOnce sync.Once
+)
+
+// getSilences returns the silence store configured via env. It is always
+// usable; an error means the shared backend is unavailable.
+func getSilences() (*silenceStore, error) {
+	silencesInitOnce.Do(func() {
+		silences = &silenceStore{local: map[string]silenceRecord{}}
+		collection := setting("SLACK_SILENCE_FIRESTORE_COLLECTION")
+		if collection == "" {
+			return
+		}
+		client, err := getFirestore()
+		if err != nil {
+			silencesErr = err
+			return
+		}
+		silences.shared = client.Collection(collection)
+	})
+	return silences, silencesErr
+}
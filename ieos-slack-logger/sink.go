@@ -0,0 +1,187 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// Alert is a formatted entry ready for delivery. Entry is nil for synthetic
+// alerts such as digests and quiet window summaries.
+type Alert struct {
+	Severity string
+	Title    string // the "[SEVERITY] logName" header line
+	Text     string // full Slack-formatted message, header included
+	Entry    *LogEntry
+	// Fingerprint groups repeats of the same alert; empty for synthetic alerts.
+	Fingerprint string
+	// Color, when set, shows the Slack message body in an attachment of that
+	// color, e.g. green for a passed build.
+	Color string
+	// NoUnfurl posts the Slack message without link and media previews.
+	NoUnfurl bool
+	// incident is the Cloud Monitoring incident the alert announces, if any.
+	incident string
+}
+
+func newAlert(severity, text string, entry *LogEntry) *Alert {
+	title, _, _ := strings.Cut(text, "\n")
+	a := &Alert{Severity: severity, Title: title, Text: text, Entry: entry}
+	if entry != nil {
+		a.Fingerprint = alertFingerprint(entry, text)
+	}
+	return a
+}
+
+// Body returns the message without its header line.
+func (a *Alert) Body() string {
+	_, body, _ := strings.Cut(a.Text, "\n")
+	return body
+}
+
+// Timestamp returns the entry time, or now for synthetic alerts.
+func (a *Alert) Timestamp() time.Time {
+	if a.Entry != nil && !a.Entry.Timestamp.IsZero() {
+		return a.Entry.Timestamp
+	}
+	return time.Now().UTC()
+}
+
+// Sink delivers alerts to a non-Slack destination.
+type Sink interface {
+	Send(ctx context.Context, a *Alert) error
+}
+
+// SinkError is a failed sink delivery. Permanent errors will not succeed on retry.
+type SinkError struct {
+	Sink      string
+	Status    int // HTTP status when the sink is HTTP based
+	Permanent bool
+	msg       string
+}
+
+func (e *SinkError) Error() string { return e.msg }
+
+// httpSinkError classifies an HTTP response: 4xx other than 408/429 will not
+// succeed on retry.
+func httpSinkError(sink string, status int, body string) *SinkError {
+	permanent := status >= 400 && status < 500 && status != 408 && status != 429
+	return &SinkError{Sink: sink, Status: status, Permanent: permanent, msg: fmt.Sprintf("%s returned HTTP %d: %s", sink, status, body)}
+}
+
+// sinkFactories build a named sink from env, keyed by target prefix.
+// Targets look like "<kind>:<name>", e.g. "webhook:ops" or "discord:night";
+// anything else is a Slack target.
+var sinkFactories = map[string]func(name string) (Sink, error){
+	"webhook":  newWebhookSinkFromEnv,
+	"teams":    newTeamsSinkFromEnv,
+	"discord":  newDiscordSinkFromEnv,
+	"email":    newEmailSinkFromEnv,
+	"sms":      newSMSSinkFromEnv,
+	"gchat":    newGChatSinkFromEnv,
+	"workflow": newWorkflowSinkFromEnv,
+}
+
+var (
+	sinksMu sync.Mutex
+	sinks   = map[string]Sink{}
+)
+
+// sinkTarget reports whether target names a non-Slack sink.
+func sinkTarget(target string) (kind, name string, ok bool) {
+	kind, name, ok = strings.Cut(target, ":")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	_, ok = sinkFactories[kind]
+	return kind, name, ok
+}
+
+// getSink returns the cached sink for kind:name, building it on first use.
+func getSink(kind, name string) (Sink, error) {
+	key := kind + ":" + name
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if s, ok := sinks[key]; ok {
+		return s, nil
+	}
+	s, err := sinkFactories[kind](name)
+	if err != nil {
+		// misconfiguration will not fix itself on redelivery
+		return nil, &SinkError{Sink: key, Permanent: true, msg: fmt.Sprintf("sink %s: %v", key, err)}
+	}
+	sinks[key] = s
+	return s, nil
+}
+
+// envName turns a sink name into an env var fragment ("on-call" -> "ON_CALL").
+func envName(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name))
+}
+
+// severityTier buckets Cloud Logging severities for sinks that only have a
+// handful of visual styles.
+type severityTier int
+
+const (
+	tierDebug severityTier = iota
+	tierInfo
+	tierWarning
+	tierError
+)
+
+func tierOf(severity string) severityTier {
+	switch sev := logging.ParseSeverity(severity); {
+	case sev >= logging.Error:
+		return tierError
+	case sev >= logging.Warning:
+		return tierWarning
+	case sev >= logging.Info:
+		return tierInfo
+	default:
+		return tierDebug
+	}
+}
+
+// severityRGB is the accent color used by sinks that take an RGB value.
+func severityRGB(severity string) int {
+	switch tierOf(severity) {
+	case tierError:
+		return 0xD32F2F
+	case tierWarning:
+		return 0xF57C00
+	case tierInfo:
+		return 0x1976D2
+	default:
+		return 0x9E9E9E
+	}
+}
+
+// textSegment is a run of alert text that is either prose or a fenced code block.
+type textSegment struct {
+	Code bool
+	Text string
+}
+
+// splitCodeBlocks splits Slack-style text on ``` fences so sinks without
+// Markdown code blocks can render them natively.
+func splitCodeBlocks(text string) []textSegment {
+	var out []textSegment
+	parts := strings.Split(text, "```")
+	for i, p := range parts {
+		code := i%2 == 1
+		if code {
+			p = strings.Trim(p, "\n")
+		} else {
+			p = strings.TrimSpace(p)
+		}
+		if p != "" {
+			out = append(out, textSegment{Code: code, Text: p})
+		}
+	}
+	return out
+}
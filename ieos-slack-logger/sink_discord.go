@@ -0,0 +1,70 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// discordSink posts embeds colored by severity to a Discord webhook,
+// configured as DISCORD_<NAME>_URL.
+type discordSink struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// Discord embed limits.
+const (
+	discordTitleLimit       = 256
+	discordDescriptionLimit = 4096
+)
+
+type discordEmbed struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Color       int    `json:"color"`
+	Timestamp   string `json:"timestamp"`
+}
+
+type discordMessage struct {
+	Username        string         `json:"username"`
+	Embeds          []discordEmbed `json:"embeds"`
+	AllowedMentions map[string]any `json:"allowed_mentions"`
+}
+
+func newDiscordSinkFromEnv(name string) (Sink, error) {
+	key := "DISCORD_" + envName(name) + "_URL"
+	url := setting(key)
+	if url == "" {
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	return &discordSink{name: name, url: url, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+func (s *discordSink) Send(ctx context.Context, a *Alert) error {
+	msg := discordMessage{
+		Username: "ieos-slack-logger",
+		Embeds: []discordEmbed{{
+			Title:       truncateMiddle(a.Title, discordTitleLimit),
+			Description: truncateMiddle(a.Body(), discordDescriptionLimit),
+			Color:       severityRGB(a.Severity),
+			Timestamp:   a.Timestamp().UTC().Format(time.RFC3339),
+		}},
+		// log payloads must never ping @everyone or roles
+		AllowedMentions: map[string]any{"parse": []string{}},
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doSinkRequest(s.client, "discord:"+s.name, req)
+}
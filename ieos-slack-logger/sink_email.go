@@ -0,0 +1,206 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// emailSink mails alerts through SMTP or SendGrid, either immediately or as
+// an HTML digest. Configured by name from env:
+//
+//	EMAIL_<NAME>_TO                comma-separated recipients (required)
+//	EMAIL_<NAME>_FROM              sender address (required)
+//	EMAIL_<NAME>_PROVIDER          "smtp" (default) or "sendgrid"
+//	EMAIL_<NAME>_SMTP_ADDR         host:port of the SMTP relay
+//	EMAIL_<NAME>_SMTP_USER / _SMTP_PASSWORD   optional PLAIN auth
+//	EMAIL_<NAME>_SENDGRID_API_KEY  API key for the sendgrid provider
+//	EMAIL_<NAME>_DIGEST_INTERVAL   optional; batch alerts and mail every interval
+//
+// Digests are buffered per instance and sent on the first alert after the
+// interval elapses, or on shutdown.
+type emailSink struct {
+	name     string
+	to       []string
+	from     string
+	provider string
+	smtpAddr string
+	smtpAuth smtp.Auth
+	apiKey   string
+	interval time.Duration
+	client   *http.Client
+
+	mu      sync.Mutex
+	pending []*Alert
+	started time.Time
+}
+
+const sendgridURL = "https://api.sendgrid.com/v3/mail/send"
+
+func newEmailSinkFromEnv(name string) (Sink, error) {
+	prefix := "EMAIL_" + envName(name) + "_"
+	s := &emailSink{
+		name:     name,
+		from:     setting(prefix + "FROM"),
+		provider: strings.ToLower(setting(prefix + "PROVIDER")),
+		smtpAddr: setting(prefix + "SMTP_ADDR"),
+		apiKey:   setting(prefix + "SENDGRID_API_KEY"),
+		client:   &http.Client{Timeout: 15 * time.Second},
+	}
+	for _, to := range strings.Split(setting(prefix+"TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			s.to = append(s.to, to)
+		}
+	}
+	if len(s.to) == 0 || s.from == "" {
+		return nil, fmt.Errorf("%sTO and %sFROM are required", prefix, prefix)
+	}
+	switch s.provider {
+	case "", "smtp":
+		s.provider = "smtp"
+		if s.smtpAddr == "" {
+			return nil, fmt.Errorf("%sSMTP_ADDR is required for smtp", prefix)
+		}
+		if user := setting(prefix + "SMTP_USER"); user != "" {
+			host, _, _ := strings.Cut(s.smtpAddr, ":")
+			s.smtpAuth = smtp.PlainAuth("", user, setting(prefix+"SMTP_PASSWORD"), host)
+		}
+	case "sendgrid":
+		if s.apiKey == "" {
+			return nil, fmt.Errorf("%sSENDGRID_API_KEY is required for sendgrid", prefix)
+		}
+	default:
+		return nil, fmt.Errorf("%sPROVIDER %q is not supported", prefix, s.provider)
+	}
+	if v := setting(prefix + "DIGEST_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("%sDIGEST_INTERVAL %q is invalid", prefix, v)
+		}
+		s.interval = d
+	}
+	return s, nil
+}
+
+func (s *emailSink) Send(ctx context.Context, a *Alert) error {
+	if s.interval == 0 {
+		html, err := renderEmail([]*Alert{a})
+		if err != nil {
+			return err
+		}
+		return s.mail(ctx, a.Title, html)
+	}
+
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.started = time.Now()
+	}
+	s.pending = append(s.pending, a)
+	if time.Since(s.started) < s.interval {
+		s.mu.Unlock()
+		return nil
+	}
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	html, err := renderEmail(batch)
+	if err == nil {
+		err = s.mail(ctx, fmt.Sprintf("ieos alert digest: %d alert(s)", len(batch)), html)
+	}
+	if err != nil {
+		// keep earlier alerts for the next attempt; the current one is
+		// redelivered by Pub/Sub when the error is returned
+		s.mu.Lock()
+		s.pending = append(batch[:len(batch)-1], s.pending...)
+		s.mu.Unlock()
+	}
+	return err
+}
+
+// Flush mails the alerts batched so far, if any.
+func (s *emailSink) Flush(ctx context.Context) error {
+	s.mu.Lock()
+	batch := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+	if len(batch) == 0 {
+		return nil
+	}
+	html, err := renderEmail(batch)
+	if err == nil {
+		err = s.mail(ctx, fmt.Sprintf("ieos alert digest: %d alert(s)", len(batch)), html)
+	}
+	return err
+}
+
+func (s *emailSink) mail(ctx context.Context, subject, html string) error {
+	if s.provider == "sendgrid" {
+		return s.sendgrid(ctx, subject, html)
+	}
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.from)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(s.to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/html; charset=utf-8\r\n\r\n")
+	msg.WriteString(html)
+	if err := smtp.SendMail(s.smtpAddr, s.smtpAuth, s.from, s.to, msg.Bytes()); err != nil {
+		return fmt.Errorf("email:%s: %w", s.name, err)
+	}
+	return nil
+}
+
+func (s *emailSink) sendgrid(ctx context.Context, subject, html string) error {
+	to := make([]map[string]string, 0, len(s.to))
+	for _, addr := range s.to {
+		to = append(to, map[string]string{"email": addr})
+	}
+	body, err := json.Marshal(map[string]any{
+		"personalizations": []map[string]any{{"to": to}},
+		"from":             map[string]string{"email": s.from},
+		"subject":          subject,
+		"content":          []map[string]string{{"type": "text/html", "value": html}},
+	})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sendgridURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+s.apiKey)
+	return doSinkRequest(s.client, "email:"+s.name, req)
+}
+
+var emailTemplate = template.Must(template.New("email").Funcs(template.FuncMap{
+	"color": func(sev string) string { return fmt.Sprintf("#%06X", severityRGB(sev)) },
+	"split": splitCodeBlocks,
+	"time":  formatTimestamp,
+}).Parse(`<!DOCTYPE html>
+<html><body style="font-family:sans-serif">
+{{range .}}
+<div style="border-left:4px solid {{color .Severity}};padding:4px 12px;margin-bottom:16px">
+<h3 style="margin:4px 0">{{.Title}}</h3>
+<p style="color:#666;font-size:12px;margin:0">{{time .Timestamp}}</p>
+{{range split .Body}}{{if .Code}}<pre style="background:#f4f4f4;padding:8px;overflow-x:auto">{{.Text}}</pre>{{else}}<p style="white-space:pre-wrap">{{.Text}}</p>{{end}}{{end}}
+</div>
+{{end}}
+</body></html>`))
+
+func renderEmail(alerts []*Alert) (string, error) {
+	var buf bytes.Buffer
+	if err := emailTemplate.Execute(&buf, alerts); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
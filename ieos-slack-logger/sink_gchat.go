@@ -0,0 +1,77 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// gchatSink posts Cards v2 messages to a Google Chat space webhook,
+// configured as GCHAT_<NAME>_URL.
+type gchatSink struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// Google Chat caps messages at 32 KB.
+const gchatBodyLimit = 20000
+
+func newGChatSinkFromEnv(name string) (Sink, error) {
+	key := "GCHAT_" + envName(name) + "_URL"
+	url := setting(key)
+	if url == "" {
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	return &gchatSink{name: name, url: url, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// gchatText converts plain text to the HTML subset card widgets accept.
+func gchatText(s string) string {
+	return strings.ReplaceAll(html.EscapeString(s), "\n", "<br>")
+}
+
+func gchatCard(a *Alert) map[string]any {
+	widgets := []map[string]any{{
+		"textParagraph": map[string]any{
+			"text": fmt.Sprintf(`<font color="#%06X"><b>%s</b></font>`, severityRGB(a.Severity), html.EscapeString(a.Severity)),
+		},
+	}}
+	for _, seg := range splitCodeBlocks(truncateMiddle(a.Body(), gchatBodyLimit)) {
+		text := gchatText(seg.Text)
+		if seg.Code {
+			text = `<font color="#555555">` + text + `</font>`
+		}
+		widgets = append(widgets, map[string]any{"textParagraph": map[string]any{"text": text}})
+	}
+	return map[string]any{
+		"cardsV2": []map[string]any{{
+			"cardId": "ieos-alert",
+			"card": map[string]any{
+				"header": map[string]any{
+					"title":    a.Title,
+					"subtitle": formatTimestamp(a.Timestamp()),
+				},
+				"sections": []map[string]any{{"widgets": widgets}},
+			},
+		}},
+	}
+}
+
+func (s *gchatSink) Send(ctx context.Context, a *Alert) error {
+	payload, err := json.Marshal(gchatCard(a))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	return doSinkRequest(s.client, "gchat:"+s.name, req)
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/logging"
+)
+
+// smsSink texts on-call phones through Twilio. It is meant for the EMERGENCY
+// and ALERT tiers and skips anything below SMS_<NAME>_MIN_SEVERITY (default
+// ALERT), so a broad routing rule cannot turn into a pager storm.
+//
+//	SMS_<NAME>_TO            comma-separated E.164 numbers (required)
+//	SMS_<NAME>_FROM          Twilio sender number or messaging service SID (required)
+//	SMS_<NAME>_ACCOUNT_SID   falls back to TWILIO_ACCOUNT_SID
+//	SMS_<NAME>_AUTH_TOKEN    falls back to TWILIO_AUTH_TOKEN
+//	SMS_<NAME>_MIN_SEVERITY  lowest severity that is texted
+type smsSink struct {
+	name       string
+	to         []string
+	from       string
+	accountSID string
+	authToken  string
+	min        logging.Severity
+	client     *http.Client
+}
+
+// Two concatenated SMS segments.
+const smsBodyLimit = 320
+
+var twilioBaseURL = "https://api.twilio.com/2010-04-01"
+
+func newSMSSinkFromEnv(name string) (Sink, error) {
+	prefix := "SMS_" + envName(name) + "_"
+	envOr := func(key, fallback string) string {
+		if v := setting(prefix + key); v != "" {
+			return v
+		}
+		return setting(fallback)
+	}
+	s := &smsSink{
+		name:       name,
+		from:       setting(prefix + "FROM"),
+		accountSID: envOr("ACCOUNT_SID", "TWILIO_ACCOUNT_SID"),
+		authToken:  envOr("AUTH_TOKEN", "TWILIO_AUTH_TOKEN"),
+		min:        logging.Alert,
+		client:     &http.Client{Timeout: 10 * time.Second},
+	}
+	for _, to := range strings.Split(setting(prefix+"TO"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			s.to = append(s.to, to)
+		}
+	}
+	if v := setting(prefix + "MIN_SEVERITY"); v != "" {
+		s.min = logging.ParseSeverity(v)
+	}
+	if len(s.to) == 0 || s.from == "" || s.accountSID == "" || s.authToken == "" {
+		return nil, fmt.Errorf("%sTO, %sFROM and Twilio credentials are required", prefix, prefix)
+	}
+	return s, nil
+}
+
+// smsText squeezes the alert into a couple of SMS segments.
+func smsText(a *Alert) string {
+	text := a.Title
+	for _, line := range strings.Split(a.Body(), "\n") {
+		if line = strings.TrimSpace(strings.Trim(line, "`*")); line != "" {
+			text += "\n" + line
+			break
+		}
+	}
+	if r := []rune(text); len(r) > smsBodyLimit {
+		text = string(r[:smsBodyLimit-1]) + "…"
+	}
+	return text
+}
+
+func (s *smsSink) Send(ctx context.Context, a *Alert) error {
+	if logging.ParseSeverity(a.Severity) < s.min {
+		return nil
+	}
+	body := smsText(a)
+	endpoint := fmt.Sprintf("%s/Accounts/%s/Messages.json", twilioBaseURL, url.PathEscape(s.accountSID))
+	var errs []error
+	for _, to := range s.to {
+		form := url.Values{"To": {to}, "Body": {body}}
+		if strings.HasPrefix(s.from, "MG") {
+			form.Set("MessagingServiceSid", s.from)
+		} else {
+			form.Set("From", s.from)
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.SetBasicAuth(s.accountSID, s.authToken)
+		if err := doSinkRequest(s.client, "sms:"+s.name, req); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
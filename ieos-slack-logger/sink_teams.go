@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// teamsSink posts Adaptive Cards to a Microsoft Teams Incoming Webhook or
+// Workflows webhook URL, configured as TEAMS_<NAME>_URL.
+type teamsSink struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// Teams rejects payloads over roughly 28 KB.
+const teamsBodyLimit = 20000
+
+func newTeamsSinkFromEnv(name string) (Sink, error) {
+	key := "TEAMS_" + envName(name) + "_URL"
+	url := setting(key)
+	if url == "" {
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	return &teamsSink{name: name, url: url, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// teamsColor maps severity to Adaptive Card TextBlock colors.
+func teamsColor(severity string) string {
+	switch tierOf(severity) {
+	case tierError:
+		return "Attention"
+	case tierWarning:
+		return "Warning"
+	case tierInfo:
+		return "Accent"
+	default:
+		return "Default"
+	}
+}
+
+func teamsCard(a *Alert) map[string]any {
+	body := []map[string]any{{
+		"type":   "TextBlock",
+		"text":   a.Title,
+		"weight": "Bolder",
+		"size":   "Medium",
+		"color":  teamsColor(a.Severity),
+		"wrap":   true,
+	}}
+	for _, seg := range splitCodeBlocks(truncateMiddle(a.Body(), teamsBodyLimit)) {
+		block := map[string]any{"type": "TextBlock", "text": seg.Text, "wrap": true}
+		if seg.Code {
+			block["fontType"] = "Monospace"
+			block["size"] = "Small"
+		}
+		body = append(body, block)
+	}
+	body = append(body, map[string]any{
+		"type":     "TextBlock",
+		"text":     formatTimestamp(a.Timestamp()),
+		"isSubtle": true,
+		"size":     "Small",
+	})
+	return map[string]any{
+		"type": "message",
+		"attachments": []map[string]any{{
+			"contentType": "application/vnd.microsoft.card.adaptive",
+			"content": map[string]any{
+				"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+				"type":    "AdaptiveCard",
+				"version": "1.4",
+				"msteams": map[string]any{"width": "Full"},
+				"body":    body,
+			},
+		}},
+	}
+}
+
+func (s *teamsSink) Send(ctx context.Context, a *Alert) error {
+	payload, err := json.Marshal(teamsCard(a))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doSinkRequest(s.client, "teams:"+s.name, req)
+}
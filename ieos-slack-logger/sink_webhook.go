@@ -0,0 +1,133 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"text/template"
+	"time"
+)
+
+// webhookSink posts alerts as JSON to an arbitrary URL. It is configured by
+// name from env:
+//
+//	WEBHOOK_<NAME>_URL               destination URL (required)
+//	WEBHOOK_<NAME>_TEMPLATE          optional text/template rendering the body
+//	WEBHOOK_<NAME>_SECRET            optional HMAC-SHA256 key for signing
+//	WEBHOOK_<NAME>_SIGNATURE_HEADER  signature header (default X-Ieos-Signature)
+//
+// The template receives the Alert and may use the "json" func to embed
+// escaped values, e.g. {"text": {{json .Text}}, "sev": {{json .Severity}}}.
+// Signed requests carry "sha256=<hex>" over "<timestamp>.<body>" and the
+// timestamp in X-Ieos-Timestamp so receivers can reject replays.
+type webhookSink struct {
+	name      string
+	url       string
+	tmpl      *template.Template
+	secret    []byte
+	sigHeader string
+	client    *http.Client
+}
+
+const defaultWebhookSignatureHeader = "X-Ieos-Signature"
+
+// webhookPayload is the default body when no template is configured.
+type webhookPayload struct {
+	Severity  string            `json:"severity"`
+	Title     string            `json:"title"`
+	Text      string            `json:"text"`
+	Timestamp time.Time         `json:"timestamp"`
+	LogName   string            `json:"logName,omitempty"`
+	InsertID  string            `json:"insertId,omitempty"`
+	Resource  MonitoredResource `json:"resource"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+var webhookFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func newWebhookSinkFromEnv(name string) (Sink, error) {
+	prefix := "WEBHOOK_" + envName(name) + "_"
+	s := &webhookSink{
+		name:      name,
+		url:       setting(prefix + "URL"),
+		secret:    []byte(setting(prefix + "SECRET")),
+		sigHeader: setting(prefix + "SIGNATURE_HEADER"),
+		client:    &http.Client{Timeout: 10 * time.Second},
+	}
+	if s.url == "" {
+		return nil, fmt.Errorf("%sURL is not set", prefix)
+	}
+	if s.sigHeader == "" {
+		s.sigHeader = defaultWebhookSignatureHeader
+	}
+	if t := setting(prefix + "TEMPLATE"); t != "" {
+		tmpl, err := template.New(name).Funcs(webhookFuncs).Parse(t)
+		if err != nil {
+			return nil, fmt.Errorf("%sTEMPLATE: %v", prefix, err)
+		}
+		s.tmpl = tmpl
+	}
+	return s, nil
+}
+
+func (s *webhookSink) render(a *Alert) ([]byte, error) {
+	if s.tmpl != nil {
+		var buf bytes.Buffer
+		if err := s.tmpl.Execute(&buf, a); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	p := webhookPayload{Severity: a.Severity, Title: a.Title, Text: a.Text, Timestamp: a.Timestamp()}
+	if a.Entry != nil {
+		p.LogName, p.InsertID, p.Resource, p.Labels = a.Entry.LogName, a.Entry.InsertID, a.Entry.Resource, a.Entry.Labels
+	}
+	return json.Marshal(p)
+}
+
+func (s *webhookSink) Send(ctx context.Context, a *Alert) error {
+	body, err := s.render(a)
+	if err != nil {
+		return &SinkError{Sink: "webhook:" + s.name, Permanent: true, msg: fmt.Sprintf("webhook %s: render: %v", s.name, err)}
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(s.secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		mac := hmac.New(sha256.New, s.secret)
+		mac.Write([]byte(ts + "."))
+		mac.Write(body)
+		req.Header.Set("X-Ieos-Timestamp", ts)
+		req.Header.Set(s.sigHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	return doSinkRequest(s.client, "webhook:"+s.name, req)
+}
+
+// doSinkRequest sends req and maps non-2xx responses to a SinkError.
+func doSinkRequest(client *http.Client, sink string, req *http.Request) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: %w", sink, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return httpSinkError(sink, resp.StatusCode, string(msg))
+	}
+	return nil
+}
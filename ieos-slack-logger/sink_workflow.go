@@ -0,0 +1,66 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// workflowSink triggers a Slack Workflow Builder webhook, configured as
+// WORKFLOW_<NAME>_URL, so follow-on steps (tickets, forms) can be built in
+// Slack without changes here. The workflow receives these text variables:
+// severity, service, message, title, log_name, timestamp, logs_url and
+// fingerprint.
+type workflowSink struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+// Workflow Builder truncates long variables; keep message readable.
+const workflowMessageLimit = 3000
+
+func newWorkflowSinkFromEnv(name string) (Sink, error) {
+	key := "WORKFLOW_" + envName(name) + "_URL"
+	url := setting(key)
+	if url == "" {
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	return &workflowSink{name: name, url: url, client: &http.Client{Timeout: 10 * time.Second}}, nil
+}
+
+// workflowVariables are the webhook body. Workflow Builder only accepts
+// flat string values.
+func workflowVariables(a *Alert) map[string]string {
+	d := newMessageData(a)
+	message := d.Message
+	if message == "" {
+		message = a.Body()
+	}
+	return map[string]string{
+		"severity":    a.Severity,
+		"service":     d.Service,
+		"message":     truncateMiddle(message, workflowMessageLimit),
+		"title":       a.Title,
+		"log_name":    d.LogName,
+		"timestamp":   d.Timestamp.UTC().Format(time.RFC3339),
+		"logs_url":    d.Links.Logs,
+		"fingerprint": a.Fingerprint,
+	}
+}
+
+func (s *workflowSink) Send(ctx context.Context, a *Alert) error {
+	payload, err := json.Marshal(workflowVariables(a))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doSinkRequest(s.client, "workflow:"+s.name, req)
+}
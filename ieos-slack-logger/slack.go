@@ -1,78 +1,358 @@
 package service
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"os"
 	"strings"
+	"sync"
+	"time"
 
-	"github.com/joho/godotenv"
 	"github.com/slack-go/slack"
 )
 
-var (
-	slackClient    *slack.Client
-	isSlackEnabled bool
-)
+// SlackAPI is the subset of *slack.Client the Notifier depends on. The
+// slacktest package provides a recording fake.
+type SlackAPI interface {
+	PostMessageContext(ctx context.Context, channelID string, options ...slack.MsgOption) (string, string, error)
+	UpdateMessageContext(ctx context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error)
+	UploadFileV2Context(ctx context.Context, params slack.UploadFileV2Parameters) (*slack.FileSummary, error)
+	GetConversationHistoryContext(ctx context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error)
+	AuthTestContext(ctx context.Context) (*slack.AuthTestResponse, error)
+	GetConversationsContext(ctx context.Context, params *slack.GetConversationsParameters) ([]slack.Channel, string, error)
+	JoinConversationContext(ctx context.Context, channelID string) (*slack.Channel, string, []string, error)
+}
 
-func init() {
-	// Load .env for local/dev usage; ignore error in serverless
-	_ = godotenv.Load()
+// NotifierConfig configures a Slack Notifier.
+type NotifierConfig struct {
+	// BotToken is the bot user OAuth token; it must start with "xoxb-".
+	// Ignored when API or TokenSource is set.
+	BotToken string
+	// TokenSource supplies the bot token instead of BotToken, e.g. from
+	// Secret Manager. It is re-read every RefreshInterval so rotated tokens
+	// are picked up without a redeploy.
+	TokenSource func(ctx context.Context) (string, error)
+	// RefreshInterval defaults to one hour when TokenSource is set.
+	RefreshInterval time.Duration
+	// API overrides the Slack client, e.g. with a slacktest.Fake.
+	API SlackAPI
+	// SkipAuthTest skips the auth.test call made to validate a token
+	// before it is used.
+	SkipAuthTest bool
+	// Retry governs retries of transient failures when posting messages.
+	Retry RetryPolicy
+}
 
-	botToken := os.Getenv("SLACK_BOT_TOKEN")
-	if botToken == "" {
-		log.Printf("SLACK_BOT_TOKEN environment variable is not set. Slack notifications will be disabled.")
-		isSlackEnabled = false
-		return
+const defaultTokenRefreshInterval = time.Hour
+
+// Notifier posts alerts to Slack. A nil *Notifier is valid and fails every
+// send with a permanent "not configured" error.
+type Notifier struct {
+	mu        sync.Mutex
+	client    SlackAPI
+	token     string
+	source    func(ctx context.Context) (string, error)
+	refresh   time.Duration
+	refreshed time.Time
+	skipAuth  bool
+	teamID    string // from auth.test; empty when it was skipped
+	retry     RetryPolicy
+	channels  channelDirectory
+}
+
+// NewNotifier validates the configuration and returns a ready Notifier.
+func NewNotifier(ctx context.Context, cfg NotifierConfig) (*Notifier, error) {
+	if cfg.API != nil {
+		n := &Notifier{client: cfg.API, retry: cfg.Retry.withDefaults()}
+		if !cfg.SkipAuthTest {
+			resp, err := n.client.AuthTestContext(ctx)
+			if err != nil {
+				return nil, fmt.Errorf("slack authentication failed: %w", err)
+			}
+			n.teamID = resp.TeamID
+		}
+		return n, nil
 	}
-	if !strings.HasPrefix(botToken, "xoxb-") {
-		log.Printf("SLACK_BOT_TOKEN appears to be invalid (should start with 'xoxb-'). Slack notifications will be disabled.")
-		isSlackEnabled = false
-		return
+
+	n := &Notifier{source: cfg.TokenSource, refresh: cfg.RefreshInterval, skipAuth: cfg.SkipAuthTest, retry: cfg.Retry.withDefaults()}
+	if n.refresh <= 0 {
+		n.refresh = defaultTokenRefreshInterval
+	}
+	token := cfg.BotToken
+	if n.source != nil {
+		var err error
+		if token, err = n.source(ctx); err != nil {
+			return nil, fmt.Errorf("failed to load slack bot token: %w", err)
+		}
+	}
+	client, teamID, err := newSlackClient(ctx, token, n.skipAuth)
+	if err != nil {
+		return nil, err
+	}
+	n.client, n.token, n.teamID, n.refreshed = client, token, teamID, time.Now()
+	return n, nil
+}
+
+func newSlackClient(ctx context.Context, token string, skipAuth bool) (SlackAPI, string, error) {
+	if token == "" {
+		return nil, "", fmt.Errorf("slack bot token is required")
+	}
+	if !strings.HasPrefix(token, "xoxb-") {
+		return nil, "", fmt.Errorf("slack bot token appears to be invalid (should start with 'xoxb-')")
+	}
+	client := slack.New(token)
+	if skipAuth {
+		return client, "", nil
 	}
+	resp, err := client.AuthTestContext(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("slack authentication failed: %w", err)
+	}
+	return client, resp.TeamID, nil
+}
+
+// api returns the current client, re-reading the token source when the
+// refresh interval has passed. A failed refresh keeps the previous client,
+// since the old token usually remains valid for a while after rotation.
+// The token fetch and auth.test run without holding n.mu, so deliveries
+// keep using the current client while a refresh is in flight.
+func (n *Notifier) api(ctx context.Context) SlackAPI {
+	n.mu.Lock()
+	client, current := n.client, n.token
+	if n.source == nil || time.Since(n.refreshed) < n.refresh {
+		n.mu.Unlock()
+		return client
+	}
+	// claim the refresh so concurrent callers keep the current client
+	n.refreshed = time.Now()
+	n.mu.Unlock()
+
+	token, err := n.source(ctx)
+	if err != nil {
+		log.Printf("slack token refresh failed, keeping current token: %v", err)
+		return client
+	}
+	if token == current {
+		return client
+	}
+	rotated, _, err := newSlackClient(ctx, token, n.skipAuth)
+	if err != nil {
+		log.Printf("rotated slack token rejected, keeping current token: %v", err)
+		return client
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.token == current {
+		n.client, n.token = rotated, token
+	}
+	return n.client
+}
+
+// SlackError is returned for failed Slack calls. Permanent errors (bad token,
+// unknown channel, oversized message, missing configuration) will not succeed
+// on retry.
+type SlackError struct {
+	Code      string // Slack API error code, e.g. "channel_not_found"
+	Permanent bool
+	msg       string
+}
+
+func (e *SlackError) Error() string { return e.msg }
+
+// permanentSlackCodes are Slack API error codes that no retry can fix.
+var permanentSlackCodes = map[string]bool{
+	"invalid_auth":      true,
+	"not_authed":        true,
+	"account_inactive":  true,
+	"token_revoked":     true,
+	"missing_scope":     true,
+	"channel_not_found": true,
+	"not_in_channel":    true,
+	"is_archived":       true,
+	"msg_too_long":      true,
+	"invalid_blocks":    true,
+	"not_configured":    true,
+}
+
+// IsPermanent reports whether err is a Slack or sink failure that will not
+// succeed on retry.
+func IsPermanent(err error) bool {
+	var se *SlackError
+	var ke *SinkError
+	return (errors.As(err, &se) && se.Permanent) || (errors.As(err, &ke) && ke.Permanent)
+}
+
+func isSlackErrorCode(err error, code string) bool {
+	var se *SlackError
+	return errors.As(err, &se) && se.Code == code
+}
 
-	slackClient = slack.New(botToken)
-	if err := testSlackAuth(); err != nil {
-		log.Printf("Slack authentication failed. Slack notifications will be disabled: %v", err)
-		isSlackEnabled = false
+// invalidateToken forces the next call to re-read the token source, so a
+// rotated-away token is replaced as soon as Slack starts rejecting it.
+func (n *Notifier) invalidateToken(err error) {
+	if n.source == nil || !(isSlackErrorCode(err, "invalid_auth") || isSlackErrorCode(err, "token_revoked")) {
 		return
 	}
-	isSlackEnabled = true
-	log.Printf("Slack integration initialized successfully")
+	n.mu.Lock()
+	n.refreshed = time.Time{}
+	n.mu.Unlock()
 }
 
-func testSlackAuth() error {
-	if slackClient == nil {
-		return fmt.Errorf("slack client not initialized")
+// checkReady returns the client and the channel's ID, resolving a
+// "#name" channel.
+func (n *Notifier) checkReady(ctx context.Context, channel string) (SlackAPI, string, error) {
+	if n == nil {
+		return nil, "", &SlackError{Code: "not_configured", Permanent: true, msg: "slack is not properly configured"}
+	}
+	if channel == "" {
+		return nil, "", &SlackError{Code: "not_configured", Permanent: true, msg: "channel ID is required"}
+	}
+	api := n.api(ctx)
+	channelID, err := n.resolveChannel(ctx, api, channel)
+	if err != nil {
+		n.invalidateToken(err)
+		return nil, "", err
 	}
-	_, err := slackClient.AuthTest()
-	return err
+	return api, channelID, nil
 }
 
-// SendMessage sends a message to a channel.
-func SendMessage(channelID, message string) (string, error) {
-	if !isSlackEnabled {
-		return "", fmt.Errorf("slack is not properly configured")
+// SendMessage sends a message to a channel. extra options, such as blocks,
+// are applied after the text. Transient failures are retried per the
+// notifier's RetryPolicy.
+func (n *Notifier) SendMessage(ctx context.Context, channelID, message string, extra ...slack.MsgOption) (string, error) {
+	api, channelID, err := n.checkReady(ctx, channelID)
+	if err != nil {
+		return "", err
 	}
-	if channelID == "" {
-		return "", fmt.Errorf("channel ID is required")
+
+	options := append([]slack.MsgOption{slack.MsgOptionText(truncateMiddle(message, slackMessageTextLimit), false)}, extra...)
+	var timestamp string
+	err = n.post(ctx, api, channelID, func() error {
+		var err error
+		_, timestamp, err = api.PostMessageContext(ctx, channelID, options...)
+		return err
+	})
+	if err != nil {
+		return "", err
 	}
+	return timestamp, nil
+}
 
-	_, timestamp, err := slackClient.PostMessage(
-		channelID,
-		slack.MsgOptionText(message, false),
+// post calls fn, a write to channelID, per the notifier's RetryPolicy. When
+// the bot is not in the channel it joins it and tries once more. Errors are
+// returned described.
+func (n *Notifier) post(ctx context.Context, api SlackAPI, channelID string, fn func() error) error {
+	err := n.retry.do(ctx, fn)
+	if err != nil && isSlackErrorCode(describeSlackError(err), "not_in_channel") && !n.channels.isJoined(channelID) {
+		if err = n.joinChannel(ctx, api, channelID); err == nil {
+			err = n.retry.do(ctx, fn)
+		}
+	}
+	if err != nil {
+		err = describeSlackError(err)
+		n.invalidateToken(err)
+		return err
+	}
+	return nil
+}
+
+// UpdateMessage replaces the text and blocks of the message at ts.
+func (n *Notifier) UpdateMessage(ctx context.Context, channelID, ts, message string, blocks ...slack.Block) error {
+	api, channelID, err := n.checkReady(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	_, _, _, err = api.UpdateMessageContext(ctx, channelID, ts,
+		slack.MsgOptionText(truncateMiddle(message, slackMessageTextLimit), false),
+		slack.MsgOptionBlocks(blocks...),
 	)
 	if err != nil {
-		if strings.Contains(err.Error(), "invalid_auth") {
-			return "", fmt.Errorf("slack authentication failed - please check your bot token and permissions")
-		}
-		if strings.Contains(err.Error(), "channel_not_found") {
-			return "", fmt.Errorf("slack channel not found - please check your channel ID")
-		}
-		if strings.Contains(err.Error(), "not_in_channel") {
-			return "", fmt.Errorf("slack bot is not in the specified channel - please invite the bot to the channel")
+		err = describeSlackError(err)
+		n.invalidateToken(err)
+		return err
+	}
+	return nil
+}
+
+// UploadSnippet attaches content as a file in channelID, threaded under
+// threadTS when set. It uses the external upload flow since Slack retired the
+// legacy files.upload method. Failures are retried like SendMessage's.
+func (n *Notifier) UploadSnippet(ctx context.Context, channelID, threadTS, filename, content string) error {
+	api, channelID, err := n.checkReady(ctx, channelID)
+	if err != nil {
+		return err
+	}
+	return n.post(ctx, api, channelID, func() error {
+		_, err := api.UploadFileV2Context(ctx, slack.UploadFileV2Parameters{
+			Channel:         channelID,
+			ThreadTimestamp: threadTS,
+			Filename:        filename,
+			Title:           filename,
+			Content:         content,
+			FileSize:        len(content),
+		})
+		return err
+	})
+}
+
+// alertMetadata returns the metadata payload of the alert message at ts, or
+// nil when the message is not one of ours.
+func (n *Notifier) alertMetadata(ctx context.Context, channelID, ts string) (map[string]any, error) {
+	api, channelID, err := n.checkReady(ctx, channelID)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := api.GetConversationHistoryContext(ctx, &slack.GetConversationHistoryParameters{
+		ChannelID:          channelID,
+		Latest:             ts,
+		Inclusive:          true,
+		Limit:              1,
+		IncludeAllMetadata: true,
+	})
+	if err != nil {
+		err = describeSlackError(err)
+		n.invalidateToken(err)
+		return nil, err
+	}
+	if len(resp.Messages) == 0 || resp.Messages[0].Timestamp != ts || resp.Messages[0].Metadata.EventType != alertMetadataType {
+		return nil, nil
+	}
+	return resp.Messages[0].Metadata.EventPayload, nil
+}
+
+func describeSlackError(err error) error {
+	if se := (*SlackError)(nil); errors.As(err, &se) {
+		return err // already described
+	}
+	code := ""
+	var apiErr slack.SlackErrorResponse
+	var rl *slack.RateLimitedError
+	if errors.As(err, &apiErr) {
+		code = apiErr.Err
+	} else if errors.As(err, &rl) {
+		code = "ratelimited"
+	} else {
+		// some client paths wrap the API error in a plain string
+		for c := range permanentSlackCodes {
+			if strings.Contains(err.Error(), c) {
+				code = c
+				break
+			}
 		}
-		return "", fmt.Errorf("failed to send slack message: %v", err)
 	}
-	return timestamp, nil
+	se := &SlackError{Code: code, Permanent: permanentSlackCodes[code]}
+	switch code {
+	case "invalid_auth":
+		se.msg = "slack authentication failed - please check your bot token and permissions"
+	case "channel_not_found":
+		se.msg = "slack channel not found - please check your channel ID"
+	case "not_in_channel":
+		se.msg = "slack bot is not in the specified channel - please invite the bot to the channel"
+	case "msg_too_long":
+		se.msg = fmt.Sprintf("slack rejected the message as too long: %v", err)
+	default:
+		se.msg = fmt.Sprintf("failed to send slack message: %v", err)
+	}
+	return se
 }
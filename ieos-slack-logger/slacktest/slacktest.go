@@ -0,0 +1,258 @@
+// Package slacktest provides a recording fake of the Slack API used by the
+// ieos-slack-logger Notifier, so handler tests can assert on what would have
+// been posted without network calls.
+//
+//	fake := slacktest.New()
+//	n, _ := service.NewNotifier(ctx, service.NotifierConfig{API: fake})
+//	// ... exercise the handler ...
+//	if got := fake.Messages(); len(got) != 1 { t.Fatalf("posted %d messages", len(got)) }
+package slacktest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	service "github.com/print-engine/ieos-golang-utils/ieos-slack-logger"
+	"github.com/slack-go/slack"
+)
+
+var _ service.SlackAPI = (*Fake)(nil)
+
+// Message is a recorded chat.postMessage or chat.update call.
+type Message struct {
+	Channel     string
+	Timestamp   string
+	ThreadTS    string
+	Text        string
+	Blocks      []json.RawMessage
+	Attachments []json.RawMessage
+	Metadata    slack.SlackMetadata
+	// Values holds every form value the options produced, for assertions
+	// on less common parameters such as unfurl_links.
+	Values url.Values
+}
+
+// Fake records calls and returns canned successes. Set Fail to inject errors.
+type Fake struct {
+	// Fail, when non-nil, is consulted before each call with the Slack
+	// method name (e.g. "chat.postMessage") and channel; a non-nil result
+	// is returned as the call's error.
+	Fail func(method, channel string) error
+
+	mu       sync.Mutex
+	seq      int
+	messages []Message
+	updates  []Message
+	uploads  []slack.UploadFileV2Parameters
+	channels []slack.Channel
+	joins    []string
+}
+
+// New returns an empty Fake.
+func New() *Fake { return &Fake{} }
+
+func (f *Fake) fail(method, channel string) error {
+	if f.Fail == nil {
+		return nil
+	}
+	return f.Fail(method, channel)
+}
+
+func (f *Fake) nextTS() string {
+	f.seq++
+	return fmt.Sprintf("1700000000.%06d", f.seq)
+}
+
+func decode(channel string, options []slack.MsgOption) (Message, error) {
+	_, values, err := slack.UnsafeApplyMsgOptions("", channel, "", options...)
+	if err != nil {
+		return Message{}, err
+	}
+	m := Message{Channel: channel, ThreadTS: values.Get("thread_ts"), Text: values.Get("text"), Values: values}
+	if b := values.Get("blocks"); b != "" {
+		if err := json.Unmarshal([]byte(b), &m.Blocks); err != nil {
+			return Message{}, err
+		}
+	}
+	if md := values.Get("metadata"); md != "" {
+		if err := json.Unmarshal([]byte(md), &m.Metadata); err != nil {
+			return Message{}, err
+		}
+	}
+	if a := values.Get("attachments"); a != "" {
+		if err := json.Unmarshal([]byte(a), &m.Attachments); err != nil {
+			return Message{}, err
+		}
+	}
+	return m, nil
+}
+
+// PostMessageContext records a posted message.
+func (f *Fake) PostMessageContext(_ context.Context, channelID string, options ...slack.MsgOption) (string, string, error) {
+	if err := f.fail("chat.postMessage", channelID); err != nil {
+		return "", "", err
+	}
+	m, err := decode(channelID, options)
+	if err != nil {
+		return "", "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	m.Timestamp = f.nextTS()
+	f.messages = append(f.messages, m)
+	return channelID, m.Timestamp, nil
+}
+
+// UpdateMessageContext records an edit of a previously posted message.
+func (f *Fake) UpdateMessageContext(_ context.Context, channelID, timestamp string, options ...slack.MsgOption) (string, string, string, error) {
+	if err := f.fail("chat.update", channelID); err != nil {
+		return "", "", "", err
+	}
+	m, err := decode(channelID, options)
+	if err != nil {
+		return "", "", "", err
+	}
+	m.Timestamp = timestamp
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.updates = append(f.updates, m)
+	return channelID, timestamp, m.Text, nil
+}
+
+// UploadFileV2Context records a file upload.
+func (f *Fake) UploadFileV2Context(_ context.Context, params slack.UploadFileV2Parameters) (*slack.FileSummary, error) {
+	if err := f.fail("files.upload", params.Channel); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.uploads = append(f.uploads, params)
+	return &slack.FileSummary{ID: fmt.Sprintf("F%06d", len(f.uploads)), Title: params.Title}, nil
+}
+
+// GetConversationHistoryContext returns the posted messages of a channel,
+// newest first, honouring Latest, Inclusive and Limit.
+func (f *Fake) GetConversationHistoryContext(_ context.Context, params *slack.GetConversationHistoryParameters) (*slack.GetConversationHistoryResponse, error) {
+	if err := f.fail("conversations.history", params.ChannelID); err != nil {
+		return nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	resp := &slack.GetConversationHistoryResponse{SlackResponse: slack.SlackResponse{Ok: true}}
+	for i := len(f.messages) - 1; i >= 0; i-- {
+		m := f.messages[i]
+		if m.Channel != params.ChannelID {
+			continue
+		}
+		if params.Latest != "" && (m.Timestamp > params.Latest || (m.Timestamp == params.Latest && !params.Inclusive)) {
+			continue
+		}
+		msg := slack.Message{}
+		msg.Channel, msg.Timestamp, msg.ThreadTimestamp, msg.Text = m.Channel, m.Timestamp, m.ThreadTS, m.Text
+		if params.IncludeAllMetadata {
+			msg.Metadata = m.Metadata
+		}
+		resp.Messages = append(resp.Messages, msg)
+		if params.Limit > 0 && len(resp.Messages) == params.Limit {
+			break
+		}
+	}
+	return resp, nil
+}
+
+// AuthTestContext always succeeds unless Fail says otherwise.
+func (f *Fake) AuthTestContext(_ context.Context) (*slack.AuthTestResponse, error) {
+	if err := f.fail("auth.test", ""); err != nil {
+		return nil, err
+	}
+	return &slack.AuthTestResponse{Team: "test", User: "ieos-slack-logger", UserID: "UFAKE", BotID: "BFAKE"}, nil
+}
+
+// AddChannel makes a channel visible to conversations.list. The bot is a
+// member of it when member is set; private channels the bot is not in are
+// not listed, as with Slack.
+func (f *Fake) AddChannel(id, name string, private, member bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	c := slack.Channel{IsMember: member}
+	c.ID, c.Name, c.IsPrivate = id, name, private
+	f.channels = append(f.channels, c)
+}
+
+// GetConversationsContext lists the channels added with AddChannel in one
+// page.
+func (f *Fake) GetConversationsContext(_ context.Context, params *slack.GetConversationsParameters) ([]slack.Channel, string, error) {
+	if err := f.fail("conversations.list", ""); err != nil {
+		return nil, "", err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var out []slack.Channel
+	for _, c := range f.channels {
+		if !c.IsPrivate || c.IsMember {
+			out = append(out, c)
+		}
+	}
+	return out, "", nil
+}
+
+// JoinConversationContext records the join and makes the bot a member of a
+// public channel; private channels fail like they do in Slack.
+func (f *Fake) JoinConversationContext(_ context.Context, channelID string) (*slack.Channel, string, []string, error) {
+	if err := f.fail("conversations.join", channelID); err != nil {
+		return nil, "", nil, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.channels {
+		c := &f.channels[i]
+		if c.ID != channelID {
+			continue
+		}
+		if c.IsPrivate {
+			return nil, "", nil, slack.SlackErrorResponse{Err: "method_not_supported_for_channel_type"}
+		}
+		c.IsMember = true
+		f.joins = append(f.joins, channelID)
+		return c, "", nil, nil
+	}
+	return nil, "", nil, slack.SlackErrorResponse{Err: "channel_not_found"}
+}
+
+// Joins returns the IDs of the channels joined, in order.
+func (f *Fake) Joins() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.joins...)
+}
+
+// Messages returns the posted messages in order.
+func (f *Fake) Messages() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.messages...)
+}
+
+// Updates returns the recorded message edits in order.
+func (f *Fake) Updates() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.updates...)
+}
+
+// Uploads returns the recorded file uploads in order.
+func (f *Fake) Uploads() []slack.UploadFileV2Parameters {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]slack.UploadFileV2Parameters(nil), f.uploads...)
+}
+
+// Reset clears everything recorded so far.
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.messages, f.updates, f.uploads, f.joins = nil, nil, nil, nil
+}
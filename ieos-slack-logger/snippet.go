@@ -0,0 +1,68 @@
+package service
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Messages longer than SLACK_SNIPPET_THRESHOLD characters (default 3000) are
+// posted as a short summary with the full payload attached as a file in the
+// summary's thread.
+
+const (
+	defaultSnippetThreshold = 3000
+	snippetSummaryTextLen   = 300
+)
+
+func snippetThreshold() int {
+	if v := setting("SLACK_SNIPPET_THRESHOLD"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			return n
+		}
+	}
+	return defaultSnippetThreshold
+}
+
+// snippetContent returns the full payload to attach, redacted, and a
+// filename whose extension lets Slack pick syntax highlighting.
+func snippetContent(message string, entry *LogEntry) (content, filename string) {
+	if entry == nil {
+		return message, "message.txt"
+	}
+	var parts []string
+	if entry.TextPayload != "" {
+		parts = append(parts, entry.TextPayload)
+	}
+	if len(entry.JSONPayload) > 0 {
+		if pretty, err := json.MarshalIndent(entry.JSONPayload, "", "  "); err == nil {
+			parts = append(parts, string(pretty))
+		}
+	}
+	if len(parts) == 0 {
+		parts = append(parts, message)
+	}
+	filename = "payload.txt"
+	switch {
+	case entry.TextPayload == "" && len(entry.JSONPayload) > 0:
+		filename = "payload.json"
+	case len(entry.JSONPayload) == 0 && payloadLanguage(entry.TextPayload) != "":
+		filename = "payload." + payloadLanguage(entry.TextPayload)
+	}
+	return redact(strings.Join(parts, "\n\n")), filename
+}
+
+// snippetSummary keeps the header line and the start of the first payload
+// line of a formatted message.
+func snippetSummary(message string) string {
+	header, rest, _ := strings.Cut(message, "\n")
+	first := firstTextLine(rest)
+	if r := []rune(first); len(r) > snippetSummaryTextLen {
+		first = string(r[:snippetSummaryTextLen]) + "…"
+	}
+	summary := header
+	if first != "" {
+		summary += "\n" + first
+	}
+	return summary + "\n_(full payload attached in thread)_"
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/logging"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Setting SLACK_STALE_AFTER (e.g. "30m") keeps entries older than that, such
+// as a subscription backlog delivered after a long outage, from paging people
+// one by one. With SLACK_STALE_ACTION=batch (the default) they are collected
+// per destination and posted as one "backlog replay" summary once
+// SLACK_STALE_BATCH_WINDOW (default 5m) has passed since the first one;
+// with SLACK_STALE_ACTION=drop they are only counted and logged. An entry's
+// age is measured from its timestamp, or its receive timestamp when it has
+// none. Batches are per instance and flushed like digests, on the
+// first invocation after the window elapses and on shutdown.
+
+const (
+	defaultStaleBatchWindow = 5 * time.Minute
+	staleReplayLimit        = 20 // alerts listed per summary
+)
+
+// staleAlert is a late alert waiting in a backlog replay summary.
+type staleAlert struct {
+	At       time.Time
+	Severity string
+	Title    string
+}
+
+type staleBatch struct {
+	after  time.Duration
+	drop   bool
+	window time.Duration
+
+	mu      sync.Mutex
+	started time.Time
+	byDest  map[string][]staleAlert
+}
+
+// entryAge returns how long ago the entry was written, or 0 when it carries
+// no timestamp.
+func entryAge(e *LogEntry, now time.Time) time.Duration {
+	at := e.Timestamp
+	if at.IsZero() {
+		at = e.ReceiveTimestamp
+	}
+	if at.IsZero() {
+		return 0
+	}
+	return now.Sub(at)
+}
+
+// stale reports whether the entry is too old to be posted on its own.
+func (b *staleBatch) stale(e *LogEntry, now time.Time) bool {
+	return b != nil && entryAge(e, now) > b.after
+}
+
+// add queues the alert for the backlog replay summary of target.
+func (b *staleBatch) add(now time.Time, target string, a *Alert) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.byDest) == 0 {
+		b.started = now
+	}
+	b.byDest[target] = append(b.byDest[target], staleAlert{At: a.Timestamp(), Severity: a.Severity, Title: a.Title})
+}
+
+// due returns the queued alerts keyed by target once the window has passed
+// since the first one and clears the batch.
+func (b *staleBatch) due(now time.Time) map[string][]staleAlert {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.byDest) == 0 || now.Sub(b.started) < b.window {
+		return nil
+	}
+	return b.take()
+}
+
+// drain returns the queued alerts regardless of the window, e.g. on
+// shutdown, and clears the batch.
+func (b *staleBatch) drain() map[string][]staleAlert {
+	if b == nil {
+		return nil
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.take()
+}
+
+// take returns the queued alerts and clears them. b.mu must be held.
+func (b *staleBatch) take() map[string][]staleAlert {
+	out := b.byDest
+	b.byDest = map[string][]staleAlert{}
+	return out
+}
+
+// staleSummary lists the late alerts for one target, oldest first, and
+// returns the highest severity among them.
+func staleSummary(late []staleAlert, now time.Time) (string, string) {
+	sort.SliceStable(late, func(i, j int) bool { return late[i].At.Before(late[j].At) })
+	top := late[0].Severity
+	var b strings.Builder
+	fmt.Fprintf(&b, ":rewind: Backlog replay: %d alert(s) from between %s and %s arrived late (up to %s old)",
+		len(late), formatTimestamp(late[0].At), formatTimestamp(late[len(late)-1].At), now.Sub(late[0].At).Round(time.Minute))
+	for i, a := range late {
+		if logging.ParseSeverity(a.Severity) > logging.ParseSeverity(top) {
+			top = a.Severity
+		}
+		if i < staleReplayLimit {
+			fmt.Fprintf(&b, "\n• %s %s", formatTimestamp(a.At), a.Title)
+		}
+	}
+	if n := len(late) - staleReplayLimit; n > 0 {
+		fmt.Fprintf(&b, "\n…and %d more", n)
+	}
+	return b.String(), top
+}
+
+var (
+	staleAlerts   *staleBatch
+	staleErr      error
+	staleInitOnce sync.Once
+)
+
+// getStaleBatch returns the stale entry handling configured via env, or nil
+// when it is disabled.
+func getStaleBatch() (*staleBatch, error) {
+	staleInitOnce.Do(func() {
+		v := setting("SLACK_STALE_AFTER")
+		if v == "" {
+			return
+		}
+		after, err := time.ParseDuration(v)
+		if err != nil || after <= 0 {
+			staleErr = fmt.Errorf("invalid SLACK_STALE_AFTER %q", v)
+			return
+		}
+		b := &staleBatch{after: after, window: defaultStaleBatchWindow, byDest: map[string][]staleAlert{}}
+		switch action := setting("SLACK_STALE_ACTION"); action {
+		case "", "batch":
+		case "drop":
+			b.drop = true
+		default:
+			staleErr = fmt.Errorf("invalid SLACK_STALE_ACTION %q", action)
+			return
+		}
+		if v := setting("SLACK_STALE_BATCH_WINDOW"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				staleErr = fmt.Errorf("invalid SLACK_STALE_BATCH_WINDOW %q", v)
+				return
+			}
+			b.window = d
+		}
+		staleAlerts = b
+	})
+	return staleAlerts, staleErr
+}
+
+// holdStale drops a stale alert or queues it for the backlog replay summary
+// of each destination that would have received it.
+func holdStale(reqLog *logger.RequestLogger, b *staleBatch, a *Alert, now time.Time) {
+	e := a.Entry
+	fields := map[string]any{"severity": e.Severity, "logName": e.LogName, "age": entryAge(e, now).Round(time.Second).String()}
+	if b.drop {
+		countMetric(reqLog, metricSuppressed, map[string]string{"reason": "stale"})
+		reqLog.Info("stale entry dropped", fields)
+		return
+	}
+	for _, d := range routeForSeverity(e.Severity, logProject(e.LogName), entryEnvironment(e)) {
+		if d.accepts(e.SeverityLevel()) {
+			b.add(now, d.Target, a)
+			countMetric(reqLog, metricSuppressed, map[string]string{"reason": "stale", "target": d.Target})
+		}
+	}
+	reqLog.Info("stale entry held for backlog replay", fields)
+}
+
+// postStaleSummaries sends a backlog replay summary to each target.
+func postStaleSummaries(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, late map[string][]staleAlert, now time.Time) {
+	targets := make([]string, 0, len(late))
+	for target := range late {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		text, severity := staleSummary(late[target], now)
+		if err := deliver(ctx, reqLog, notifier, target, newAlert(severity, text, nil)); err != nil {
+			reqLog.Error("failed to post backlog replay", err, map[string]any{"target": target, "count": len(late[target])})
+		}
+	}
+}
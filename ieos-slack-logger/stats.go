@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Setting SLACK_SUMMARY_CHANNEL_ID (destinations, like a route) posts a daily
+// health summary at SLACK_SUMMARY_TIME (HH:MM in SLACK_TIMEZONE, default
+// 09:00): alert counts for the past 24h by severity and by service, with an
+// arrow comparing each to the 24h before. Summaries are sent from the
+// scheduler endpoint. Counts are kept per instance
+// unless SLACK_SUMMARY_FIRESTORE_COLLECTION is set, which also makes sure
+// only one instance posts each day's summary.
+
+const (
+	defaultSummaryTime  = "09:00"
+	summaryHourLayout   = "2006010215"
+	summaryServiceLimit = 10
+	// statsRetention keeps the previous day for the comparison.
+	statsRetention = 49 * time.Hour
+)
+
+// statsKey separates severity and service in a counter name; it cannot occur
+// in either.
+const statsKey = "\x1f"
+
+// hourStats are the alert counts of one hour, keyed by severity and service.
+type hourStats struct {
+	Counts   map[string]int64 `firestore:"counts"`
+	ExpireAt time.Time        `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+type alertStats struct {
+	targets []Destination
+	at      time.Duration // time of day the summary is due
+	shared  *firestore.CollectionRef
+
+	mu       sync.Mutex
+	hours    map[string]map[string]int64 // hour -> counter -> count
+	lastSent string                      // day of the last summary
+}
+
+// add counts an alert in the hour it was handled.
+func (s *alertStats) add(ctx context.Context, now time.Time, severity, service string) error {
+	if s == nil {
+		return nil
+	}
+	hour := now.UTC().Format(summaryHourLayout)
+	counter := severity + statsKey + service
+	if s.shared != nil {
+		_, err := s.shared.Doc("hour-"+hour).Set(ctx, map[string]any{
+			"counts":   map[string]any{counter: firestore.Increment(1)},
+			"expireAt": now.Add(statsRetention),
+		}, firestore.MergeAll)
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.hours[hour] == nil {
+		s.hours[hour] = map[string]int64{}
+	}
+	s.hours[hour][counter]++
+	for h := range s.hours {
+		if t, _ := time.Parse(summaryHourLayout, h); now.Sub(t) > statsRetention {
+			delete(s.hours, h)
+		}
+	}
+	return nil
+}
+
+// window sums the counters of the 24 hourly buckets up to and including
+// the one holding end.
+func (s *alertStats) window(ctx context.Context, end time.Time) (map[string]int64, error) {
+	hours := make([]string, 0, 24)
+	last := end.UTC().Truncate(time.Hour)
+	for t := last.Add(-23 * time.Hour); !t.After(last); t = t.Add(time.Hour) {
+		hours = append(hours, t.Format(summaryHourLayout))
+	}
+	out := map[string]int64{}
+	if s.shared == nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		for _, h := range hours {
+			for k, n := range s.hours[h] {
+				out[k] += n
+			}
+		}
+		return out, nil
+	}
+	refs := make([]*firestore.DocumentRef, len(hours))
+	for i, h := range hours {
+		refs[i] = s.shared.Doc("hour-" + h)
+	}
+	client, err := getFirestore()
+	if err != nil {
+		return nil, err
+	}
+	snaps, err := client.GetAll(ctx, refs)
+	if err != nil {
+		return nil, err
+	}
+	for _, snap := range snaps {
+		if !snap.Exists() {
+			continue
+		}
+		var hs hourStats
+		if err := snap.DataTo(&hs); err != nil {
+			return nil, err
+		}
+		for k, n := range hs.Counts {
+			out[k] += n
+		}
+	}
+	return out, nil
+}
+
+// due reports whether today's summary should go out and claims it, so only
+// one instance posts it.
+func (s *alertStats) due(ctx context.Context, now time.Time) (bool, error) {
+	if s == nil {
+		return false, nil
+	}
+	local := now.In(timestampLoc)
+	day := local.Format(anchorDayLayout)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, local.Location())
+	s.mu.Lock()
+	if s.lastSent == day || local.Sub(midnight) < s.at {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.lastSent = day
+	s.mu.Unlock()
+	if s.shared == nil {
+		return true, nil
+	}
+	_, err := s.shared.Doc("summary-"+day).Create(ctx, map[string]any{"sentAt": now, "expireAt": now.Add(statsRetention)})
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// trendArrow compares a count with the previous day's.
+func trendArrow(cur, prev int64) string {
+	switch {
+	case cur > prev:
+		return fmt.Sprintf("↑ +%d", cur-prev)
+	case cur < prev:
+		return fmt.Sprintf("↓ -%d", prev-cur)
+	}
+	return "→"
+}
+
+// summaryRows splits the counters by one part (0 severity, 1 service) and
+// returns the rows ordered by count.
+func summaryRows(cur, prev map[string]int64, part int) (names []string, curBy, prevBy map[string]int64) {
+	curBy, prevBy = map[string]int64{}, map[string]int64{}
+	for k, n := range cur {
+		curBy[strings.Split(k, statsKey)[part]] += n
+	}
+	for k, n := range prev {
+		prevBy[strings.Split(k, statsKey)[part]] += n
+	}
+	for name := range curBy {
+		names = append(names, name)
+	}
+	for name := range prevBy {
+		if _, ok := curBy[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if curBy[names[i]] != curBy[names[j]] {
+			return curBy[names[i]] > curBy[names[j]]
+		}
+		return names[i] < names[j]
+	})
+	return names, curBy, prevBy
+}
+
+func formatSummary(cur, prev map[string]int64, now time.Time) string {
+	var total, prevTotal int64
+	for _, n := range cur {
+		total += n
+	}
+	for _, n := range prev {
+		prevTotal += n
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, ":bar_chart: *Alerts in the 24h to %s:* %d (%s vs the day before)", formatTimestamp(now), total, trendArrow(total, prevTotal))
+	if total == 0 && prevTotal == 0 {
+		return b.String()
+	}
+	b.WriteString("\n*By severity*")
+	names, curBy, prevBy := summaryRows(cur, prev, 0)
+	for _, name := range names {
+		fmt.Fprintf(&b, "\n• %s: %d %s", name, curBy[name], trendArrow(curBy[name], prevBy[name]))
+	}
+	b.WriteString("\n*By service*")
+	names, curBy, prevBy = summaryRows(cur, prev, 1)
+	for i, name := range names {
+		if i == summaryServiceLimit {
+			fmt.Fprintf(&b, "\n• and %d more", len(names)-i)
+			break
+		}
+		label := name
+		if label == "" {
+			label = "(none)"
+		}
+		fmt.Fprintf(&b, "\n• `%s`: %d %s", label, curBy[name], trendArrow(curBy[name], prevBy[name]))
+	}
+	return b.String()
+}
+
+var (
+	stats         *alertStats
+	statsErr      error
+	statsInitOnce sync.Once
+)
+
+// getAlertStats returns the summary config, or nil when summaries are off.
+func getAlertStats() (*alertStats, error) {
+	statsInitOnce.Do(func() {
+		targets := parseDestinations(setting("SLACK_SUMMARY_CHANNEL_ID"))
+		if len(targets) == 0 {
+			return
+		}
+		spec := setting("SLACK_SUMMARY_TIME")
+		if spec == "" {
+			spec = defaultSummaryTime
+		}
+		t, err := time.Parse("15:04", spec)
+		if err != nil {
+			statsErr = fmt.Errorf("invalid SLACK_SUMMARY_TIME %q: expected HH:MM", spec)
+			return
+		}
+		s := &alertStats{targets: targets, at: time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, hours: map[string]map[string]int64{}}
+		if collection := setting("SLACK_SUMMARY_FIRESTORE_COLLECTION"); collection != "" {
+			client, err := getFirestore()
+			if err != nil {
+				statsErr = err
+				return
+			}
+			s.shared = client.Collection(collection)
+		}
+		stats = s
+	})
+	return stats, statsErr
+}
+
+// countAlertStats counts a handled alert towards the daily summary.
+func countAlertStats(ctx context.Context, reqLog *logger.RequestLogger, a *Alert, now time.Time) {
+	s, _ := getAlertStats()
+	service := ""
+	if a.Entry != nil {
+		service = entryService(a.Entry)
+	}
+	if err := s.add(ctx, now, a.Severity, service); err != nil {
+		reqLog.Warning("failed to count alert for summary", err)
+	}
+}
+
+// runDailySummary posts the daily summary when it is due.
+func runDailySummary(ctx context.Context, reqLog *logger.RequestLogger, notifier *Workspaces, now time.Time) {
+	s, err := getAlertStats()
+	if err != nil {
+		reqLog.Error("invalid summary config", err)
+	}
+	loadTimestampConfig()
+	if ok, err := s.due(ctx, now); err != nil {
+		reqLog.Warning("summary claim failed", err)
+		return
+	} else if !ok {
+		return
+	}
+	cur, err := s.window(ctx, now)
+	if err != nil {
+		reqLog.Error("failed to read summary counts", err)
+		return
+	}
+	prev, err := s.window(ctx, now.Add(-24*time.Hour))
+	if err != nil {
+		reqLog.Error("failed to read summary counts", err)
+		return
+	}
+	text := formatSummary(cur, prev, now)
+	for _, d := range s.targets {
+		if err := deliver(ctx, reqLog, notifier, d.Target, newAlert("INFO", text, nil)); err != nil {
+			reqLog.Error("failed to post daily summary", err, map[string]any{"target": d.Target})
+		}
+	}
+}
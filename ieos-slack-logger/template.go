@@ -0,0 +1,150 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// A route destination can name a message template with "|<name>", e.g.
+// "C0123456|payments>=ERROR". The template is read from
+// SLACK_TEMPLATE_<NAME> and rendered with messageData; its first line becomes
+// the alert title. For example:
+//
+//	SLACK_TEMPLATE_PAYMENTS=[{{.Severity}}] {{.Service}} on {{.Resource.Labels.location}}
+//	{{.Message}}
+//	{{slackdate .Timestamp}} · <{{.Links.Logs}}|Open in Logs Explorer>
+//
+// A template that fails to parse or render falls back to the default format,
+// so a typo never swallows an alert.
+
+// messageData is what message templates see.
+type messageData struct {
+	Severity  string
+	LogName   string
+	Service   string
+	Message   string // textPayload, or jsonPayload.message
+	Text      string // the default formatted message
+	Timestamp time.Time
+	InsertID  string
+	Trace     string
+	Labels    map[string]string
+	Resource  MonitoredResource
+	JSON      map[string]any
+	Links     messageLinks
+}
+
+// messageLinks point into the Cloud console, empty when the project is
+// unknown, and to the print job dashboard.
+type messageLinks struct {
+	Logs  string
+	Trace string
+	Job   string
+}
+
+var templateFuncs = template.FuncMap{
+	"json":      webhookFuncs["json"],
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+	"truncate":  func(limit int, s string) string { return truncateMiddle(s, limit) },
+	"time":      formatTimestamp,
+	"slackdate": slackDate,
+	"default": func(fallback, v string) string {
+		if v == "" {
+			return fallback
+		}
+		return v
+	},
+}
+
+// logProject extracts the project ID from "projects/<p>/logs/<id>".
+func logProject(logName string) string {
+	parts := strings.SplitN(logName, "/", 4)
+	if len(parts) >= 3 && parts[0] == "projects" {
+		return parts[1]
+	}
+	return ""
+}
+
+func entryLinks(e *LogEntry) messageLinks {
+	var l messageLinks
+	if j, ok := entryPrintJob(e); ok {
+		l.Job = jobDashboardURL(j)
+	}
+	project := logProject(e.LogName)
+	if project == "" {
+		return l
+	}
+	if e.InsertID != "" {
+		query := url.PathEscape(fmt.Sprintf("insertId=%q", e.InsertID))
+		l.Logs = fmt.Sprintf("https://console.cloud.google.com/logs/query;query=%s?project=%s", query, url.QueryEscape(project))
+	}
+	if e.Trace != "" {
+		traceID := e.Trace[strings.LastIndex(e.Trace, "/")+1:]
+		l.Trace = fmt.Sprintf("https://console.cloud.google.com/traces/list?tid=%s&project=%s", url.QueryEscape(traceID), url.QueryEscape(project))
+	}
+	return l
+}
+
+func newMessageData(a *Alert) messageData {
+	d := messageData{Severity: a.Severity, Text: a.Text, Timestamp: a.Timestamp()}
+	if e := a.Entry; e != nil {
+		d.LogName, d.Service, d.InsertID, d.Trace = e.LogName, entryService(e), e.InsertID, e.Trace
+		d.Labels, d.Resource, d.JSON, d.Links = e.Labels, e.Resource, e.JSONPayload, entryLinks(e)
+		d.Message = e.TextPayload
+		if d.Message == "" {
+			d.Message, _ = e.JSONPayload["message"].(string)
+		}
+	}
+	return d
+}
+
+var (
+	templatesMu sync.Mutex
+	templates   = map[string]*template.Template{}
+)
+
+// getTemplate returns the cached template for name, parsing it on first use.
+func getTemplate(name string) (*template.Template, error) {
+	templatesMu.Lock()
+	defer templatesMu.Unlock()
+	if t, ok := templates[name]; ok {
+		return t, nil
+	}
+	key := "SLACK_TEMPLATE_" + envName(name)
+	src := setting(key)
+	if src == "" {
+		return nil, fmt.Errorf("%s is not set", key)
+	}
+	t, err := template.New(name).Funcs(templateFuncs).Option("missingkey=zero").Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", key, err)
+	}
+	templates[name] = t
+	return t, nil
+}
+
+// renderTemplate returns a copy of the alert with its text rendered by the
+// named template and redacted. The fingerprint is kept so acks still match.
+func renderTemplate(name string, a *Alert) (*Alert, error) {
+	t, err := getTemplate(name)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, newMessageData(a)); err != nil {
+		return nil, fmt.Errorf("template %s: %v", name, err)
+	}
+	text := strings.TrimSpace(redact(buf.String()))
+	if text == "" {
+		return nil, fmt.Errorf("template %s rendered an empty message", name)
+	}
+	out := *a
+	out.Text = text
+	out.Title, _, _ = strings.Cut(text, "\n")
+	return &out, nil
+}
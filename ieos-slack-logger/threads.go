@@ -0,0 +1,204 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Setting SLACK_THREAD_BY_TRACE=true threads alerts that share a trace: the
+// first one posted to a Slack target starts a thread and later ones with the
+// same trace within SLACK_THREAD_WINDOW (default 1h) are posted as replies,
+// so a failing request that logs five errors pings once. Threads are kept
+// per instance unless SLACK_THREAD_FIRESTORE_COLLECTION is set.
+
+const defaultThreadWindow = time.Hour
+
+// traceThread is the Slack thread started for a trace on a target.
+type traceThread struct {
+	Target    string    `firestore:"target"`
+	Trace     string    `firestore:"trace"`
+	TS        string    `firestore:"ts"`
+	StartedAt time.Time `firestore:"startedAt"`
+	ExpireAt  time.Time `firestore:"expireAt"` // for a Firestore TTL policy
+}
+
+// traceThreadKey keys threads by target and trace; traces contain slashes,
+// which Firestore does not allow in document IDs.
+func traceThreadKey(target, trace string) string {
+	sum := sha256.Sum256([]byte(target + "\x00" + trace))
+	return hex.EncodeToString(sum[:])[:24]
+}
+
+// traceThreads maps traces to the threads they started.
+type traceThreads struct {
+	window time.Duration
+	shared *firestore.CollectionRef // optional
+
+	mu    sync.Mutex
+	local map[string]traceThread
+}
+
+// lookup returns the ts of the thread for trace on target, or "" when there
+// is none within the window.
+func (t *traceThreads) lookup(ctx context.Context, target, trace string, now time.Time) (string, error) {
+	if t == nil || trace == "" {
+		return "", nil
+	}
+	key := traceThreadKey(target, trace)
+	t.mu.Lock()
+	th, ok := t.local[key]
+	if ok && !now.Before(th.ExpireAt) {
+		delete(t.local, key)
+		ok = false
+	}
+	t.mu.Unlock()
+	if ok || t.shared == nil {
+		return th.TS, nil
+	}
+
+	snap, err := t.shared.Doc(key).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if err := snap.DataTo(&th); err != nil {
+		return "", err
+	}
+	if !now.Before(th.ExpireAt) {
+		return "", nil
+	}
+	t.mu.Lock()
+	t.local[key] = th
+	t.mu.Unlock()
+	return th.TS, nil
+}
+
+// record remembers the thread started at ts for trace on target.
+func (t *traceThreads) record(ctx context.Context, target, trace, ts string, now time.Time) error {
+	if t == nil || trace == "" {
+		return nil
+	}
+	key := traceThreadKey(target, trace)
+	th := traceThread{Target: target, Trace: trace, TS: ts, StartedAt: now, ExpireAt: now.Add(t.window)}
+	t.mu.Lock()
+	t.local[key] = th
+	t.mu.Unlock()
+	if t.shared == nil {
+		return nil
+	}
+	_, err := t.shared.Doc(key).Set(ctx, th)
+	return err
+}
+
+// claim reserves the thread for trace on target before its first message is
+// posted, so concurrent deliveries do not both start one. It reports false
+// when the thread exists or another delivery is starting it.
+func (t *traceThreads) claim(ctx context.Context, target, trace string, now time.Time) (bool, error) {
+	key := traceThreadKey(target, trace)
+	th := traceThread{Target: target, Trace: trace, StartedAt: now, ExpireAt: now.Add(t.window)}
+	t.mu.Lock()
+	if cur, ok := t.local[key]; ok && now.Before(cur.ExpireAt) {
+		t.mu.Unlock()
+		return false, nil
+	}
+	t.local[key] = th
+	t.mu.Unlock()
+	if t.shared == nil {
+		return true, nil
+	}
+	_, err := t.shared.Doc(key).Create(ctx, th)
+	if status.Code(err) == codes.AlreadyExists {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// release drops a claim whose first message could not be posted.
+func (t *traceThreads) release(ctx context.Context, target, trace string) error {
+	key := traceThreadKey(target, trace)
+	t.mu.Lock()
+	delete(t.local, key)
+	t.mu.Unlock()
+	if t.shared == nil {
+		return nil
+	}
+	_, err := t.shared.Doc(key).Delete(ctx)
+	return err
+}
+
+var (
+	threads         *traceThreads
+	threadsErr      error
+	threadsInitOnce sync.Once
+)
+
+// getTraceThreads returns the thread map configured via env, or nil when
+// threading by trace is disabled.
+func getTraceThreads() (*traceThreads, error) {
+	threadsInitOnce.Do(func() {
+		if setting("SLACK_THREAD_BY_TRACE") != "true" {
+			return
+		}
+		t := &traceThreads{window: defaultThreadWindow, local: map[string]traceThread{}}
+		if v := setting("SLACK_THREAD_WINDOW"); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil || d <= 0 {
+				threadsErr = fmt.Errorf("invalid SLACK_THREAD_WINDOW %q", v)
+				return
+			}
+			t.window = d
+		}
+		if collection := setting("SLACK_THREAD_FIRESTORE_COLLECTION"); collection != "" {
+			client, err := getFirestore()
+			if err != nil {
+				threadsErr = err
+				return
+			}
+			t.shared = client.Collection(collection)
+		}
+		threads = t
+	})
+	return threads, threadsErr
+}
+
+// alertTrace returns the trace of the alert's entry, or "".
+func alertTrace(a *Alert) string {
+	if a.Entry == nil {
+		return ""
+	}
+	return a.Entry.Trace
+}
+
+// traceThreadFor returns the ts of the thread the alert should be posted in,
+// or "" when it should start one.
+func traceThreadFor(ctx context.Context, reqLog *logger.RequestLogger, target string, a *Alert) string {
+	t, err := getTraceThreads()
+	if err != nil {
+		reqLog.Error("invalid trace threading config", err)
+	}
+	ts, err := t.lookup(ctx, target, alertTrace(a), time.Now().UTC())
+	if err != nil {
+		reqLog.Warning("trace thread lookup failed", err, map[string]any{"target": target})
+	}
+	return ts
+}
+
+// recordTraceThread remembers a freshly posted top-level alert as the thread
+// for its trace.
+func recordTraceThread(ctx context.Context, reqLog *logger.RequestLogger, target, ts string, a *Alert) {
+	t, _ := getTraceThreads()
+	if err := t.record(ctx, target, alertTrace(a), ts, time.Now().UTC()); err != nil {
+		reqLog.Warning("failed to record trace thread", err, map[string]any{"target": target, "ts": ts})
+	}
+}
@@ -0,0 +1,49 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Event times are rendered in SLACK_TIMEZONE (an IANA zone, default UTC)
+// using SLACK_TIMESTAMP_FORMAT (a Go time layout, default
+// "2006-01-02 15:04:05 MST"). Slack messages additionally use a <!date> token
+// so every viewer sees the time in their own timezone; the configured
+// rendering is its fallback text.
+
+const defaultTimestampFormat = "2006-01-02 15:04:05 MST"
+
+var (
+	timestampLoc      = time.UTC
+	timestampLayout   = defaultTimestampFormat
+	timestampInitOnce sync.Once
+)
+
+func loadTimestampConfig() {
+	timestampInitOnce.Do(func() {
+		if v := setting("SLACK_TIMEZONE"); v != "" {
+			loc, err := time.LoadLocation(v)
+			if err != nil {
+				log.Printf("invalid SLACK_TIMEZONE %q, using UTC: %v", v, err)
+			} else {
+				timestampLoc = loc
+			}
+		}
+		if v := setting("SLACK_TIMESTAMP_FORMAT"); v != "" {
+			timestampLayout = v
+		}
+	})
+}
+
+// formatTimestamp renders t in the configured timezone and layout.
+func formatTimestamp(t time.Time) string {
+	loadTimestampConfig()
+	return t.In(timestampLoc).Format(timestampLayout)
+}
+
+// slackDate renders t as a date token Slack shows in the viewer's timezone.
+func slackDate(t time.Time) string {
+	return fmt.Sprintf("<!date^%d^{date_short_pretty} {time_secs}|%s>", t.Unix(), formatTimestamp(t))
+}
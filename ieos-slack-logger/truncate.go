@@ -0,0 +1,42 @@
+package service
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Slack rejects messages whose text exceeds these character counts
+// (msg_too_long / invalid_blocks).
+const (
+	slackBlockTextLimit   = 3000
+	slackMessageTextLimit = 40000
+)
+
+// truncateMiddle shortens s to at most limit characters, keeping the head and
+// the tail (where stack traces and error causes usually end up) and replacing
+// the middle with a marker that reports how much was dropped.
+func truncateMiddle(s string, limit int) string {
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	runes := []rune(s)
+
+	// The marker length depends on the omitted byte count, so size it for
+	// the worst case of dropping the whole string.
+	maxMarker := utf8.RuneCountInString(truncationMarker(len(s)))
+	keep := limit - maxMarker
+	if keep <= 0 {
+		return string(runes[:limit])
+	}
+	head := keep * 2 / 3
+	tail := keep - head
+
+	headStr := string(runes[:head])
+	tailStr := string(runes[len(runes)-tail:])
+	omitted := len(s) - len(headStr) - len(tailStr)
+	return headStr + truncationMarker(omitted) + tailStr
+}
+
+func truncationMarker(omitted int) string {
+	return fmt.Sprintf("\n…truncated (%d bytes omitted)…\n", omitted)
+}
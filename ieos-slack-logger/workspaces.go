@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/slack-go/slack"
+)
+
+// Workspaces routes "workspace/channel" targets to the Notifier of that
+// workspace; a bare channel ID uses the default workspace. Named workspaces
+// are listed in SLACK_WORKSPACES (e.g. "eng,shared") and each reads its token
+// from SLACK_BOT_TOKEN_<NAME> or SLACK_BOT_TOKEN_SECRET_<NAME>, mirroring the
+// default workspace's SLACK_BOT_TOKEN / SLACK_BOT_TOKEN_SECRET.
+type Workspaces struct {
+	byName map[string]*Notifier // "" is the default workspace
+}
+
+// NewWorkspaces builds a Workspaces from already constructed notifiers.
+// The default workspace is keyed by "".
+func NewWorkspaces(byName map[string]*Notifier) *Workspaces {
+	return &Workspaces{byName: byName}
+}
+
+// splitTarget splits "workspace/channel" into its parts.
+func splitTarget(target string) (workspace, channelID string) {
+	if ws, ch, ok := strings.Cut(target, "/"); ok {
+		return ws, ch
+	}
+	return "", target
+}
+
+func (w *Workspaces) resolve(target string) (*Notifier, string, error) {
+	ws, channelID := splitTarget(target)
+	if w == nil {
+		return nil, channelID, nil
+	}
+	n, ok := w.byName[ws]
+	if !ok && ws != "" {
+		return nil, channelID, &SlackError{Code: "unknown_workspace", Permanent: true, msg: fmt.Sprintf("unknown slack workspace %q", ws)}
+	}
+	return n, channelID, nil
+}
+
+// SendMessage posts message to target and returns the message timestamp.
+func (w *Workspaces) SendMessage(ctx context.Context, target, message string, extra ...slack.MsgOption) (string, error) {
+	n, channelID, err := w.resolve(target)
+	if err != nil {
+		return "", err
+	}
+	return n.SendMessage(ctx, channelID, message, extra...)
+}
+
+// UpdateMessage replaces the text and blocks of the message at ts in target.
+func (w *Workspaces) UpdateMessage(ctx context.Context, target, ts, message string, blocks ...slack.Block) error {
+	n, channelID, err := w.resolve(target)
+	if err != nil {
+		return err
+	}
+	return n.UpdateMessage(ctx, channelID, ts, message, blocks...)
+}
+
+// forTeam returns the notifier whose token belongs to the Slack team ID,
+// falling back to the default workspace.
+func (w *Workspaces) forTeam(teamID string) *Notifier {
+	if w == nil {
+		return nil
+	}
+	for _, n := range w.byName {
+		if n != nil && teamID != "" && n.teamID == teamID {
+			return n
+		}
+	}
+	return w.byName[""]
+}
+
+// UploadSnippet attaches content to target, threaded under threadTS when set.
+func (w *Workspaces) UploadSnippet(ctx context.Context, target, threadTS, filename, content string) error {
+	n, channelID, err := w.resolve(target)
+	if err != nil {
+		return err
+	}
+	return n.UploadSnippet(ctx, channelID, threadTS, filename, content)
+}
+
+var (
+	workspaces        *Workspaces
+	workspaceInitOnce sync.Once
+)
+
+// UseWorkspaces makes the handlers post through w instead of the notifiers
+// configured via env, e.g. a slacktest.Fake in tools and tests. It must be
+// called before the first message is handled.
+func UseWorkspaces(w *Workspaces) {
+	workspaceInitOnce.Do(func() { workspaces = w })
+}
+
+// getWorkspaces builds the notifiers configured via env. A workspace whose
+// token is missing or invalid is kept with a nil notifier, which fails every
+// send to it.
+func getWorkspaces(ctx context.Context) *Workspaces {
+	workspaceInitOnce.Do(func() {
+		reqLog := getLogger(ctx).ForRequest(ctx, nil)
+		byName := map[string]*Notifier{}
+		names := []string{""}
+		if v := setting("SLACK_WORKSPACES"); v != "" {
+			for _, name := range strings.Split(v, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					names = append(names, name)
+				}
+			}
+		}
+		for _, name := range names {
+			n, err := notifierFromEnv(ctx, name)
+			if err != nil {
+				reqLog.Error("slack notifications disabled for workspace", err, map[string]any{"workspace": name})
+			}
+			byName[name] = n
+		}
+		workspaces = NewWorkspaces(byName)
+	})
+	return workspaces
+}
+
+// notifierFromEnv builds the notifier for a workspace from SLACK_BOT_TOKEN[_<NAME>]
+// or, when set, the Secret Manager version in SLACK_BOT_TOKEN_SECRET[_<NAME>]
+// (refreshed every SLACK_TOKEN_REFRESH_INTERVAL, default 1h). Posts are tried
+// up to SLACK_RETRY_ATTEMPTS times (default 3).
+func notifierFromEnv(ctx context.Context, workspace string) (*Notifier, error) {
+	suffix := ""
+	if workspace != "" {
+		suffix = "_" + strings.ToUpper(strings.ReplaceAll(workspace, "-", "_"))
+	}
+	cfg := NotifierConfig{BotToken: setting("SLACK_BOT_TOKEN" + suffix)}
+	if v := setting("SLACK_RETRY_ATTEMPTS"); v != "" {
+		cfg.Retry.MaxAttempts, _ = strconv.Atoi(v)
+	}
+	if secret := setting("SLACK_BOT_TOKEN_SECRET" + suffix); secret != "" {
+		cfg.TokenSource = secretTokenSource(secret)
+		if v := setting("SLACK_TOKEN_REFRESH_INTERVAL"); v != "" {
+			cfg.RefreshInterval, _ = time.ParseDuration(v)
+		}
+	}
+	return NewNotifier(ctx, cfg)
+}
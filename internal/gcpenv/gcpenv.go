@@ -0,0 +1,88 @@
+// Package gcpenv detects the Google Cloud project and runtime a process
+// runs in, for packages that report to Cloud Logging and Monitoring.
+package gcpenv
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+
+	cloudmeta "cloud.google.com/go/compute/metadata"
+)
+
+// ProjectID returns GOOGLE_CLOUD_PROJECT, or the project from the metadata
+// server when on Google Cloud.
+func ProjectID(ctx context.Context) (string, error) {
+	if v := os.Getenv("GOOGLE_CLOUD_PROJECT"); v != "" {
+		return v, nil
+	}
+	if cloudmeta.OnGCE() {
+		return cloudmeta.ProjectID()
+	}
+	return "", errors.New("GOOGLE_CLOUD_PROJECT not set and not on GCE")
+}
+
+// Resource is a Cloud Monitoring monitored resource.
+type Resource struct {
+	Type   string
+	Labels map[string]string
+}
+
+// DetectResource returns the monitored resource custom metrics of this
+// process are written against:
+//
+//   - Cloud Run and Cloud Functions: generic_task, with the region as
+//     location, the service as namespace, the revision as job and the
+//     instance ID as task_id, so instances never write the same series
+//   - Compute Engine: gce_instance
+//   - elsewhere: generic_task in location "global", with the hostname as
+//     task_id
+func DetectResource(ctx context.Context, projectID string) Resource {
+	service := firstEnv("K_SERVICE", "FUNCTION_NAME")
+	onGCE := cloudmeta.OnGCE()
+	switch {
+	case service != "" && onGCE:
+		region, _ := cloudmeta.GetWithContext(ctx, "instance/region")
+		id, _ := cloudmeta.InstanceID()
+		return genericTask(projectID, orDefault(path.Base(region), "global"), service,
+			orDefault(firstEnv("K_REVISION", "X_GOOGLE_FUNCTION_VERSION"), service), id)
+	case onGCE:
+		id, _ := cloudmeta.InstanceID()
+		zone, _ := cloudmeta.Zone()
+		return Resource{Type: "gce_instance", Labels: map[string]string{
+			"project_id":  projectID,
+			"instance_id": id,
+			"zone":        zone,
+		}}
+	}
+	host, _ := os.Hostname()
+	service = orDefault(service, "local")
+	return genericTask(projectID, "global", service, service, orDefault(host, "local"))
+}
+
+func genericTask(projectID, location, namespace, job, taskID string) Resource {
+	return Resource{Type: "generic_task", Labels: map[string]string{
+		"project_id": projectID,
+		"location":   location,
+		"namespace":  namespace,
+		"job":        job,
+		"task_id":    taskID,
+	}}
+}
+
+func firstEnv(keys ...string) string {
+	for _, k := range keys {
+		if v := os.Getenv(k); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func orDefault(s, def string) string {
+	if s == "" || s == "." {
+		return def
+	}
+	return s
+}
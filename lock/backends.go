@@ -0,0 +1,236 @@
+package lock
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// state is a lock as stored by the backends.
+type state struct {
+	Owner   string    `firestore:"owner" json:"owner"`
+	Token   int64     `firestore:"token" json:"token"`
+	Expires time.Time `firestore:"expires" json:"expires"`
+}
+
+// acquire returns the state that gives name to owner, or ErrHeld.
+func acquire(cur state, owner string, ttl time.Duration, now time.Time) (state, error) {
+	if cur.Owner != "" && now.Before(cur.Expires) {
+		return state{}, ErrHeld
+	}
+	return state{Owner: owner, Token: cur.Token + 1, Expires: now.Add(ttl)}, nil
+}
+
+// current reports whether cur is still l's lease.
+func current(cur state, l Lease, now time.Time) bool {
+	return cur.Owner == l.Owner && cur.Token == l.Token && now.Before(cur.Expires)
+}
+
+func lease(name string, s state) Lease {
+	return Lease{Name: name, Owner: s.Owner, Token: s.Token, Expires: s.Expires}
+}
+
+// FirestoreBackend keeps locks as documents of collection, updated in
+// transactions. Released locks stay as documents to keep their fencing
+// tokens; do not put a TTL policy on the collection.
+func FirestoreBackend(client *firestore.Client, collection string) Backend {
+	return &firestoreBackend{client: client, coll: client.Collection(collection)}
+}
+
+type firestoreBackend struct {
+	client *firestore.Client
+	coll   *firestore.CollectionRef
+}
+
+func (b *firestoreBackend) doc(name string) *firestore.DocumentRef {
+	// document IDs cannot contain slashes
+	return b.coll.Doc(url.PathEscape(name))
+}
+
+func (b *firestoreBackend) get(tx *firestore.Transaction, ref *firestore.DocumentRef) (state, error) {
+	var s state
+	snap, err := tx.Get(ref)
+	if status.Code(err) == codes.NotFound {
+		return s, nil
+	}
+	if err != nil {
+		return s, err
+	}
+	err = snap.DataTo(&s)
+	return s, err
+}
+
+func (b *firestoreBackend) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (Lease, error) {
+	ref := b.doc(name)
+	var next state
+	err := b.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		cur, err := b.get(tx, ref)
+		if err != nil {
+			return err
+		}
+		if next, err = acquire(cur, owner, ttl, time.Now()); err != nil {
+			return err
+		}
+		return tx.Set(ref, next)
+	})
+	return lease(name, next), err
+}
+
+func (b *firestoreBackend) Renew(ctx context.Context, l Lease, ttl time.Duration) (Lease, error) {
+	return b.update(ctx, l, ttl)
+}
+
+func (b *firestoreBackend) Release(ctx context.Context, l Lease) error {
+	_, err := b.update(ctx, l, 0)
+	if errors.Is(err, ErrLost) {
+		return nil
+	}
+	return err
+}
+
+// update sets l's expiry to now+ttl if l is the current lease.
+func (b *firestoreBackend) update(ctx context.Context, l Lease, ttl time.Duration) (Lease, error) {
+	ref := b.doc(l.Name)
+	var next state
+	err := b.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		cur, err := b.get(tx, ref)
+		if err != nil {
+			return err
+		}
+		now := time.Now()
+		if !current(cur, l, now) {
+			return ErrLost
+		}
+		next = cur
+		next.Expires = now.Add(ttl)
+		return tx.Set(ref, next)
+	})
+	return lease(l.Name, next), err
+}
+
+// GCSBackend keeps locks as small JSON objects named prefix+name in bucket,
+// written with generation preconditions so only one writer wins a race.
+// Released locks stay as objects to keep their fencing tokens; do not put
+// a lifecycle rule deleting them on the prefix.
+func GCSBackend(client *gcs.Client, bucket, prefix string) Backend {
+	return &gcsBackend{bucket: client.Bucket(bucket), prefix: prefix}
+}
+
+type gcsBackend struct {
+	bucket *gcs.BucketHandle
+	prefix string
+}
+
+// read returns the lock's state and object generation, zero if it does
+// not exist.
+func (b *gcsBackend) read(ctx context.Context, name string) (state, int64, error) {
+	var s state
+	r, err := b.bucket.Object(b.prefix + name).NewReader(ctx)
+	if errors.Is(err, gcs.ErrObjectNotExist) {
+		return s, 0, nil
+	}
+	if err != nil {
+		return s, 0, err
+	}
+	defer r.Close()
+	if err := json.NewDecoder(r).Decode(&s); err != nil {
+		return s, 0, err
+	}
+	return s, r.Attrs.Generation, nil
+}
+
+// write stores s if the object is still at generation gen (zero: absent),
+// and returns errConflict if another writer got there first.
+func (b *gcsBackend) write(ctx context.Context, name string, s state, gen int64) error {
+	obj := b.bucket.Object(b.prefix + name)
+	if gen == 0 {
+		obj = obj.If(gcs.Conditions{DoesNotExist: true})
+	} else {
+		obj = obj.If(gcs.Conditions{GenerationMatch: gen})
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := obj.NewWriter(ctx)
+	w.ContentType = "application/json"
+	w.CacheControl = "no-store"
+	if err := json.NewEncoder(w).Encode(s); err != nil {
+		cancel()
+		_ = w.Close()
+		return err
+	}
+	err := w.Close()
+	if preconditionFailed(err) {
+		return errConflict
+	}
+	return err
+}
+
+var errConflict = errors.New("lock: concurrent update")
+
+func preconditionFailed(err error) bool {
+	var gerr *googleapi.Error
+	if errors.As(err, &gerr) {
+		return gerr.Code == http.StatusPreconditionFailed
+	}
+	return status.Code(err) == codes.FailedPrecondition
+}
+
+func (b *gcsBackend) Acquire(ctx context.Context, name, owner string, ttl time.Duration) (Lease, error) {
+	cur, gen, err := b.read(ctx, name)
+	if err != nil {
+		return Lease{}, err
+	}
+	next, err := acquire(cur, owner, ttl, time.Now())
+	if err != nil {
+		return Lease{}, err
+	}
+	if err := b.write(ctx, name, next, gen); err != nil {
+		if errors.Is(err, errConflict) {
+			// another owner acquired it between our read and write
+			return Lease{}, ErrHeld
+		}
+		return Lease{}, err
+	}
+	return lease(name, next), nil
+}
+
+func (b *gcsBackend) Renew(ctx context.Context, l Lease, ttl time.Duration) (Lease, error) {
+	return b.update(ctx, l, ttl)
+}
+
+func (b *gcsBackend) Release(ctx context.Context, l Lease) error {
+	_, err := b.update(ctx, l, 0)
+	if errors.Is(err, ErrLost) {
+		return nil
+	}
+	return err
+}
+
+func (b *gcsBackend) update(ctx context.Context, l Lease, ttl time.Duration) (Lease, error) {
+	cur, gen, err := b.read(ctx, l.Name)
+	if err != nil {
+		return Lease{}, err
+	}
+	now := time.Now()
+	if !current(cur, l, now) {
+		return Lease{}, ErrLost
+	}
+	next := cur
+	next.Expires = now.Add(ttl)
+	if err := b.write(ctx, l.Name, next, gen); err != nil {
+		if errors.Is(err, errConflict) {
+			return Lease{}, ErrLost
+		}
+		return Lease{}, err
+	}
+	return lease(l.Name, next), nil
+}
@@ -0,0 +1,267 @@
+// Package lock provides lease-based distributed locks, kept in Firestore
+// or in GCS objects guarded by generation preconditions, so that singleton
+// jobs such as the daily alert summary run on one instance at a time.
+// Leases are renewed in the background while held, and every acquisition
+// gets a fencing token larger than the previous holder's.
+//
+// Quick start:
+//
+//	lk := lock.New(lock.FirestoreBackend(fs, "locks"), lock.WithLogger(lg))
+//
+//	err := lk.Run(ctx, "daily-summary", func(ctx context.Context, l *lock.Lock) error {
+//	    // ctx is cancelled if the lease is lost
+//	    return sendSummary(ctx, l.Token()) // pass the token on to reject stale writers
+//	})
+//	if errors.Is(err, lock.ErrHeld) {
+//	    return nil // another instance is on it
+//	}
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+var (
+	// ErrHeld is returned when another owner holds an unexpired lease.
+	ErrHeld = errors.New("lock: held by another owner")
+	// ErrLost is returned when a lease expired and was taken over, or
+	// released, before it could be renewed.
+	ErrLost = errors.New("lock: lease lost")
+)
+
+// Lease is one owner's hold on a lock.
+type Lease struct {
+	Name  string
+	Owner string
+	// Token increases with every acquisition of the lock.
+	Token   int64
+	Expires time.Time
+}
+
+// Backend stores leases. Expiry is judged by the local clock, so lease
+// TTLs must be well above the clock skew between instances.
+type Backend interface {
+	// Acquire takes name for owner until ttl elapses if it is free or its
+	// lease expired, and returns ErrHeld otherwise.
+	Acquire(ctx context.Context, name, owner string, ttl time.Duration) (Lease, error)
+	// Renew extends l by ttl from now, or returns ErrLost if l is no longer
+	// the current lease.
+	Renew(ctx context.Context, l Lease, ttl time.Duration) (Lease, error)
+	// Release ends l if it is the current lease, keeping its token so the
+	// next one is larger.
+	Release(ctx context.Context, l Lease) error
+}
+
+type Options struct {
+	TTL           time.Duration
+	RenewInterval time.Duration
+	RetryInterval time.Duration
+	Owner         string
+	Logger        *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithTTL sets how long a lease lasts without renewal, which is how long a
+// crashed holder blocks the lock; defaults to 30s.
+func WithTTL(d time.Duration) Option { return func(o *Options) { o.TTL = d } }
+
+// WithRenewInterval sets how often held leases are renewed; defaults to a
+// third of the TTL.
+func WithRenewInterval(d time.Duration) Option { return func(o *Options) { o.RenewInterval = d } }
+
+// WithRetryInterval sets how often Lock retries a held lock; defaults to 1s.
+func WithRetryInterval(d time.Duration) Option { return func(o *Options) { o.RetryInterval = d } }
+
+// WithOwner names this instance in leases; defaults to the hostname and a
+// random suffix.
+func WithOwner(owner string) Option { return func(o *Options) { o.Owner = owner } }
+
+// WithLogger logs acquisitions, failed renewals and lost leases.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// Locker acquires locks from a Backend. It is safe for concurrent use.
+type Locker struct {
+	backend Backend
+	opts    Options
+}
+
+// New returns a Locker over backend.
+func New(backend Backend, opts ...Option) *Locker {
+	options := Options{
+		TTL:           30 * time.Second,
+		RetryInterval: time.Second,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.RenewInterval <= 0 {
+		options.RenewInterval = options.TTL / 3
+	}
+	if options.Owner == "" {
+		host, _ := os.Hostname()
+		b := make([]byte, 4)
+		_, _ = rand.Read(b)
+		options.Owner = host + "-" + hex.EncodeToString(b)
+	}
+	return &Locker{backend: backend, opts: options}
+}
+
+// TryLock acquires name, or returns ErrHeld at once if another owner holds
+// it. The lease is renewed until Unlock.
+func (lk *Locker) TryLock(ctx context.Context, name string) (*Lock, error) {
+	lease, err := lk.backend.Acquire(ctx, name, lk.opts.Owner, lk.opts.TTL)
+	if err != nil {
+		if errors.Is(err, ErrHeld) {
+			return nil, fmt.Errorf("%w: %s", ErrHeld, name)
+		}
+		return nil, fmt.Errorf("lock: acquire %s: %w", name, err)
+	}
+	if lg := lk.opts.Logger; lg != nil {
+		lg.Info(ctx, nil, "lock acquired", map[string]any{"lock": name, "owner": lease.Owner, "token": lease.Token})
+	}
+	l := &Lock{lk: lk, lease: lease, lost: make(chan struct{}), stop: make(chan struct{}), done: make(chan struct{})}
+	go l.renew()
+	return l, nil
+}
+
+// Lock acquires name, waiting while another owner holds it until ctx is
+// done.
+func (lk *Locker) Lock(ctx context.Context, name string) (*Lock, error) {
+	for {
+		l, err := lk.TryLock(ctx, name)
+		if !errors.Is(err, ErrHeld) {
+			return l, err
+		}
+		t := time.NewTimer(lk.opts.RetryInterval)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("lock: %s: %w", name, ctx.Err())
+		case <-t.C:
+		}
+	}
+}
+
+// Run runs fn holding name, or returns ErrHeld without running it if
+// another owner holds the lock. fn's context is cancelled if the lease is
+// lost; Run then returns ErrLost joined with fn's error.
+func (lk *Locker) Run(ctx context.Context, name string, fn func(ctx context.Context, l *Lock) error) error {
+	l, err := lk.TryLock(ctx, name)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-l.Lost():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	err = fn(ctx, l)
+	uerr := l.Unlock(context.WithoutCancel(ctx))
+	return errors.Join(err, uerr)
+}
+
+// Lock is a held lease.
+type Lock struct {
+	lk *Locker
+
+	mu    sync.Mutex
+	lease Lease
+
+	lost     chan struct{}
+	stop     chan struct{}
+	stopOnce sync.Once
+	done     chan struct{}
+}
+
+// Token returns the fencing token of the lease. Pass it along with writes
+// the lock guards, and have the receiver reject tokens lower than the
+// largest it has seen, so a holder that stalled past its lease cannot
+// overwrite its successor.
+func (l *Lock) Token() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lease.Token
+}
+
+// Lease returns the current lease.
+func (l *Lock) Lease() Lease {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lease
+}
+
+// Lost is closed when the lease is lost: taken over after it expired, or
+// not renewable before its expiry.
+func (l *Lock) Lost() <-chan struct{} { return l.lost }
+
+// Unlock stops renewal and releases the lease. It returns ErrLost if the
+// lease was lost while held.
+func (l *Lock) Unlock(ctx context.Context) error {
+	l.stopOnce.Do(func() { close(l.stop) })
+	<-l.done
+	select {
+	case <-l.lost:
+		return fmt.Errorf("%w: %s", ErrLost, l.lease.Name)
+	default:
+	}
+	if err := l.lk.backend.Release(ctx, l.Lease()); err != nil {
+		return fmt.Errorf("lock: release %s: %w", l.lease.Name, err)
+	}
+	return nil
+}
+
+func (l *Lock) renew() {
+	defer close(l.done)
+	t := time.NewTicker(l.lk.opts.RenewInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-t.C:
+		}
+		cur := l.Lease()
+		ctx, cancel := context.WithDeadline(context.Background(), cur.Expires)
+		next, err := l.lk.backend.Renew(ctx, cur, l.lk.opts.TTL)
+		cancel()
+		if err == nil {
+			l.mu.Lock()
+			l.lease = next
+			l.mu.Unlock()
+			continue
+		}
+		lost := errors.Is(err, ErrLost) || !time.Now().Before(cur.Expires)
+		l.log(cur, err, lost)
+		if lost {
+			close(l.lost)
+			return
+		}
+	}
+}
+
+func (l *Lock) log(lease Lease, err error, lost bool) {
+	lg := l.lk.opts.Logger
+	if lg == nil {
+		return
+	}
+	data := map[string]any{"lock": lease.Name, "owner": lease.Owner, "token": lease.Token, "error": err.Error()}
+	if lost {
+		lg.Error(context.Background(), nil, "lock lease lost", data)
+		return
+	}
+	lg.Warning(context.Background(), nil, "lock renewal failed", data)
+}
@@ -0,0 +1,286 @@
+package lock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+func TestAcquire(t *testing.T) {
+	tests := []struct {
+		name      string
+		cur       state
+		now       time.Time
+		wantErr   error
+		wantToken int64
+	}{
+		{"never taken", state{}, t0, nil, 1},
+		{"released", state{Token: 4, Expires: t0.Add(time.Minute)}, t0, nil, 5},
+		{"held", state{Owner: "a", Token: 4, Expires: t0.Add(time.Second)}, t0, ErrHeld, 0},
+		{"expired", state{Owner: "a", Token: 4, Expires: t0}, t0, nil, 5},
+		{"expired long ago", state{Owner: "a", Token: 9, Expires: t0.Add(-time.Hour)}, t0, nil, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := acquire(tt.cur, "b", 30*time.Second, tt.now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			want := state{Owner: "b", Token: tt.wantToken, Expires: tt.now.Add(30 * time.Second)}
+			if got != want {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCurrent(t *testing.T) {
+	l := Lease{Name: "job", Owner: "a", Token: 3, Expires: t0.Add(time.Minute)}
+	tests := []struct {
+		name string
+		cur  state
+		now  time.Time
+		want bool
+	}{
+		{"held", state{Owner: "a", Token: 3, Expires: t0.Add(time.Minute)}, t0, true},
+		{"renewed elsewhere", state{Owner: "a", Token: 3, Expires: t0.Add(time.Hour)}, t0, true},
+		{"expired", state{Owner: "a", Token: 3, Expires: t0}, t0, false},
+		{"released", state{Token: 3, Expires: t0.Add(time.Minute)}, t0, false},
+		{"taken over", state{Owner: "b", Token: 4, Expires: t0.Add(time.Minute)}, t0, false},
+		// the same owner reacquiring after an expiry gets a new token
+		{"reacquired by the same owner", state{Owner: "a", Token: 4, Expires: t0.Add(time.Minute)}, t0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := current(tt.cur, l, tt.now); got != tt.want {
+				t.Errorf("current = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// memBackend keeps leases in memory with the rules of the real backends.
+type memBackend struct {
+	mu       sync.Mutex
+	locks    map[string]state
+	renewErr error
+	renewals atomic.Int32
+}
+
+func newMemBackend() *memBackend { return &memBackend{locks: map[string]state{}} }
+
+func (b *memBackend) Acquire(_ context.Context, name, owner string, ttl time.Duration) (Lease, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	next, err := acquire(b.locks[name], owner, ttl, time.Now())
+	if err != nil {
+		return Lease{}, err
+	}
+	b.locks[name] = next
+	return lease(name, next), nil
+}
+
+func (b *memBackend) Renew(_ context.Context, l Lease, ttl time.Duration) (Lease, error) {
+	b.renewals.Add(1)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.renewErr != nil {
+		return Lease{}, b.renewErr
+	}
+	cur := b.locks[l.Name]
+	if !current(cur, l, time.Now()) {
+		return Lease{}, ErrLost
+	}
+	cur.Expires = time.Now().Add(ttl)
+	b.locks[l.Name] = cur
+	return lease(l.Name, cur), nil
+}
+
+func (b *memBackend) Release(_ context.Context, l Lease) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.locks[l.Name]
+	if !current(cur, l, time.Now()) {
+		return nil
+	}
+	b.locks[l.Name] = state{Token: cur.Token}
+	return nil
+}
+
+// steal hands name to another owner, as if the lease had expired.
+func (b *memBackend) steal(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	cur := b.locks[name]
+	b.locks[name] = state{Owner: "thief", Token: cur.Token + 1, Expires: time.Now().Add(time.Hour)}
+}
+
+func TestTryLock(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBackend()
+	a := New(b, WithOwner("a"), WithTTL(time.Minute))
+	other := New(b, WithOwner("b"), WithTTL(time.Minute))
+
+	l, err := a.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryLock: %v", err)
+	}
+	if l.Token() != 1 || l.Lease().Owner != "a" {
+		t.Errorf("lease = %+v, want token 1 for a", l.Lease())
+	}
+	if _, err := other.TryLock(ctx, "job"); !errors.Is(err, ErrHeld) {
+		t.Fatalf("second TryLock err = %v, want ErrHeld", err)
+	}
+	if _, err := other.TryLock(ctx, "other-job"); err != nil {
+		t.Errorf("TryLock of another name: %v", err)
+	}
+	if err := l.Unlock(ctx); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	l2, err := other.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatalf("TryLock after Unlock: %v", err)
+	}
+	defer l2.Unlock(ctx)
+	if l2.Token() <= l.Token() {
+		t.Errorf("token after release = %d, want above %d", l2.Token(), l.Token())
+	}
+}
+
+func TestLockWaits(t *testing.T) {
+	ctx := context.Background()
+	b := newMemBackend()
+	a := New(b, WithOwner("a"), WithTTL(time.Minute), WithRetryInterval(5*time.Millisecond))
+	held, err := a.TryLock(ctx, "job")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("until ctx is done", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := a.Lock(ctx, "job"); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("err = %v, want DeadlineExceeded", err)
+		}
+	})
+	t.Run("until released", func(t *testing.T) {
+		time.AfterFunc(20*time.Millisecond, func() { _ = held.Unlock(ctx) })
+		l, err := a.Lock(ctx, "job")
+		if err != nil {
+			t.Fatalf("Lock: %v", err)
+		}
+		defer l.Unlock(ctx)
+		if l.Token() != 2 {
+			t.Errorf("token = %d, want 2", l.Token())
+		}
+	})
+}
+
+func TestRenewal(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name     string
+		ttl      time.Duration
+		renewErr error
+		steal    bool
+		wantLost bool
+	}{
+		{"renewed", 300 * time.Millisecond, nil, false, false},
+		{"taken over", 300 * time.Millisecond, nil, true, true},
+		{"released by the backend", 300 * time.Millisecond, ErrLost, false, true},
+		// transient failures are retried until the lease expires
+		{"failing past expiry", 60 * time.Millisecond, errors.New("unavailable"), false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newMemBackend()
+			lk := New(b, WithOwner("a"), WithTTL(tt.ttl), WithRenewInterval(10*time.Millisecond))
+			l, err := lk.TryLock(ctx, "job")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b.mu.Lock()
+			b.renewErr = tt.renewErr
+			b.mu.Unlock()
+			if tt.steal {
+				b.steal("job")
+			}
+
+			select {
+			case <-l.Lost():
+				if !tt.wantLost {
+					t.Fatal("lease lost")
+				}
+			case <-time.After(2 * tt.ttl):
+				if tt.wantLost {
+					t.Fatal("lease not reported lost")
+				}
+			}
+			if n := b.renewals.Load(); n == 0 {
+				t.Error("lease never renewed")
+			}
+			err = l.Unlock(ctx)
+			if tt.wantLost != errors.Is(err, ErrLost) {
+				t.Errorf("Unlock err = %v, want lost %v", err, tt.wantLost)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	ctx := context.Background()
+	boom := errors.New("boom")
+
+	t.Run("releases after fn", func(t *testing.T) {
+		b := newMemBackend()
+		lk := New(b, WithOwner("a"))
+		var token int64
+		err := lk.Run(ctx, "job", func(ctx context.Context, l *Lock) error {
+			token = l.Token()
+			return boom
+		})
+		if !errors.Is(err, boom) {
+			t.Errorf("err = %v, want fn's error", err)
+		}
+		if token != 1 {
+			t.Errorf("token = %d, want 1", token)
+		}
+		if s := b.locks["job"]; s.Owner != "" || s.Token != 1 {
+			t.Errorf("state after Run = %+v, want released with token 1", s)
+		}
+	})
+	t.Run("held elsewhere", func(t *testing.T) {
+		b := newMemBackend()
+		if _, err := New(b, WithOwner("b"), WithTTL(time.Minute)).TryLock(ctx, "job"); err != nil {
+			t.Fatal(err)
+		}
+		ran := false
+		err := New(b, WithOwner("a")).Run(ctx, "job", func(context.Context, *Lock) error {
+			ran = true
+			return nil
+		})
+		if !errors.Is(err, ErrHeld) || ran {
+			t.Errorf("err = %v, ran = %v; want ErrHeld without running", err, ran)
+		}
+	})
+	t.Run("cancels fn when the lease is lost", func(t *testing.T) {
+		b := newMemBackend()
+		lk := New(b, WithOwner("a"), WithTTL(time.Minute), WithRenewInterval(5*time.Millisecond))
+		err := lk.Run(ctx, "job", func(ctx context.Context, l *Lock) error {
+			b.steal("job")
+			<-ctx.Done()
+			return ctx.Err()
+		})
+		if !errors.Is(err, ErrLost) || !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want ErrLost joined with context.Canceled", err)
+		}
+	})
+}
@@ -47,7 +47,6 @@
 package logger
 
 import (
-	cloudmeta "cloud.google.com/go/compute/metadata"
 	"cloud.google.com/go/logging"
 	"context"
 	"encoding/json"
@@ -55,10 +54,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"reflect"
 	"strings"
 	"sync"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/print-engine/ieos-golang-utils/internal/gcpenv"
 )
 
 type Notifier interface {
@@ -110,7 +112,7 @@ func New(ctx context.Context, opts ...Option) (*CloudLogger, error) {
 		f(&options)
 	}
 	if options.ProjectID == "" && !options.ForceStdout {
-		id, err := detectProjectID(ctx)
+		id, err := gcpenv.ProjectID(ctx)
 		if err != nil {
 			// fallback to stdout when no project ID
 			options.ForceStdout = true
@@ -189,29 +191,87 @@ func (c *CloudLogger) Emergency(ctx context.Context, r *http.Request, message st
 	c.log(ctx, logging.Emergency, r, message, data...)
 }
 
+// codedError is implemented by errors carrying a code and a severity, such
+// as errs.Error.
+type codedError interface {
+	error
+	ErrorCode() string
+	LogSeverity() logging.Severity
+}
+
+// Err logs err with message at the severity its code maps to, or Error for
+// errors without a code.
+func (c *CloudLogger) Err(ctx context.Context, r *http.Request, message string, err error, data ...interface{}) {
+	c.logLabels(ctx, errSeverity(err), r, nil, message, append([]interface{}{err}, data...)...)
+}
+
+func errSeverity(err error) logging.Severity {
+	var ce codedError
+	if errors.As(err, &ce) {
+		return ce.LogSeverity()
+	}
+	return logging.Error
+}
+
+// errorLabels returns an error_code label for the first coded error in
+// data, so entries can be filtered by code.
+func errorLabels(data []interface{}) map[string]string {
+	for _, it := range data {
+		err, ok := it.(error)
+		if !ok {
+			continue
+		}
+		var ce codedError
+		if errors.As(err, &ce) {
+			return map[string]string{"error_code": ce.ErrorCode()}
+		}
+	}
+	return nil
+}
+
 // Request-scoped sugar to avoid passing ctx & req on each call
 
 type RequestLogger struct {
-	base *CloudLogger
-	ctx  context.Context
-	req  *http.Request
+	base   *CloudLogger
+	ctx    context.Context
+	req    *http.Request
+	labels map[string]string
 }
 
 func (c *CloudLogger) ForRequest(ctx context.Context, r *http.Request) *RequestLogger {
 	return &RequestLogger{base: c, ctx: ctx, req: r}
 }
 
-func (rl *RequestLogger) Debug(msg string, data ...any)     { rl.base.log(rl.ctx, logging.Debug, rl.req, msg, data...) }
-func (rl *RequestLogger) Info(msg string, data ...any)      { rl.base.log(rl.ctx, logging.Info, rl.req, msg, data...) }
-func (rl *RequestLogger) Notice(msg string, data ...any)    { rl.base.log(rl.ctx, logging.Notice, rl.req, msg, data...) }
-func (rl *RequestLogger) Warning(msg string, data ...any)   { rl.base.log(rl.ctx, logging.Warning, rl.req, msg, data...) }
-func (rl *RequestLogger) Error(msg string, data ...any)     { rl.base.log(rl.ctx, logging.Error, rl.req, msg, data...) }
-func (rl *RequestLogger) Critical(msg string, data ...any)  { rl.base.log(rl.ctx, logging.Critical, rl.req, msg, data...) }
-func (rl *RequestLogger) Emergency(msg string, data ...any) { rl.base.log(rl.ctx, logging.Emergency, rl.req, msg, data...) }
+// WithLabels returns a copy of rl that adds labels to every entry, e.g. the
+// authenticated user's ID.
+func (rl *RequestLogger) WithLabels(labels map[string]string) *RequestLogger {
+	cp := *rl
+	cp.labels = mergeLabels(rl.labels, labels)
+	return &cp
+}
+
+func (rl *RequestLogger) Debug(msg string, data ...any)     { rl.base.logLabels(rl.ctx, logging.Debug, rl.req, rl.labels, msg, data...) }
+func (rl *RequestLogger) Info(msg string, data ...any)      { rl.base.logLabels(rl.ctx, logging.Info, rl.req, rl.labels, msg, data...) }
+func (rl *RequestLogger) Notice(msg string, data ...any)    { rl.base.logLabels(rl.ctx, logging.Notice, rl.req, rl.labels, msg, data...) }
+func (rl *RequestLogger) Warning(msg string, data ...any)   { rl.base.logLabels(rl.ctx, logging.Warning, rl.req, rl.labels, msg, data...) }
+func (rl *RequestLogger) Error(msg string, data ...any)     { rl.base.logLabels(rl.ctx, logging.Error, rl.req, rl.labels, msg, data...) }
+func (rl *RequestLogger) Critical(msg string, data ...any)  { rl.base.logLabels(rl.ctx, logging.Critical, rl.req, rl.labels, msg, data...) }
+func (rl *RequestLogger) Emergency(msg string, data ...any) { rl.base.logLabels(rl.ctx, logging.Emergency, rl.req, rl.labels, msg, data...) }
+
+// Err logs err with msg at the severity its code maps to, like
+// CloudLogger.Err.
+func (rl *RequestLogger) Err(msg string, err error, data ...any) {
+	rl.base.logLabels(rl.ctx, errSeverity(err), rl.req, rl.labels, msg, append([]any{err}, data...)...)
+}
 
 func (c *CloudLogger) log(ctx context.Context, sev logging.Severity, r *http.Request, message string, data ...interface{}) {
+	c.logLabels(ctx, sev, r, nil, message, data...)
+}
+
+func (c *CloudLogger) logLabels(ctx context.Context, sev logging.Severity, r *http.Request, labels map[string]string, message string, data ...interface{}) {
 	execID := extractExecutionID(r, c.opts.ExecutionIDHeaderKeys)
-	trace := extractTrace(c.opts.ProjectID, r)
+	trace, spanID, sampled := traceContext(ctx, c.opts.ProjectID, r)
+	labels = mergeLabels(labels, errorLabels(data))
 
     normalized := normalizeData(data)
 
@@ -223,13 +283,15 @@ func (c *CloudLogger) log(ctx context.Context, sev logging.Severity, r *http.Req
 	}
 
 	if c.client == nil || c.logger == nil || c.opts.ForceStdout {
-		writeStdout(sev, payload, c.opts.CommonLabels, trace)
+		writeStdout(sev, payload, mergeLabels(c.opts.CommonLabels, labels), trace, spanID, sampled)
 	} else {
 		c.logger.Log(logging.Entry{
-			Severity: sev,
-			Labels:   mergeLabels(c.opts.CommonLabels, map[string]string{"execution_id": execID}),
-			Payload:  payload,
-			Trace:    trace,
+			Severity:     sev,
+			Labels:       mergeLabels(mergeLabels(c.opts.CommonLabels, labels), map[string]string{"execution_id": execID}),
+			Payload:      payload,
+			Trace:        trace,
+			SpanID:       spanID,
+			TraceSampled: sampled,
 		})
 	}
 
@@ -291,6 +353,16 @@ func extractExecutionID(r *http.Request, keys []string) string {
 	return ""
 }
 
+// traceContext prefers the OpenTelemetry span in ctx, as set up by the
+// tracing package, over the request's X-Cloud-Trace-Context header.
+func traceContext(ctx context.Context, projectID string, r *http.Request) (trace, spanID string, sampled bool) {
+	sc := oteltrace.SpanContextFromContext(ctx)
+	if !sc.IsValid() || projectID == "" {
+		return extractTrace(projectID, r), "", false
+	}
+	return fmt.Sprintf("projects/%s/traces/%s", projectID, sc.TraceID()), sc.SpanID().String(), sc.IsSampled()
+}
+
 func extractTrace(projectID string, r *http.Request) string {
 	if r == nil || projectID == "" {
 		return ""
@@ -307,28 +379,21 @@ func extractTrace(projectID string, r *http.Request) string {
 	return fmt.Sprintf("projects/%s/traces/%s", projectID, parts[0])
 }
 
-func detectProjectID(ctx context.Context) (string, error) {
-	if v := os.Getenv("GOOGLE_CLOUD_PROJECT"); v != "" {
-		return v, nil
-	}
-    if cloudmeta.OnGCE() {
-        // Older versions of metadata use ProjectID() without context
-        return cloudmeta.ProjectID()
-    }
-	return "", errors.New("GOOGLE_CLOUD_PROJECT not set and not on GCE")
-}
-
-func writeStdout(sev logging.Severity, payload LogEntryPayload, labels map[string]string, trace string) {
+func writeStdout(sev logging.Severity, payload LogEntryPayload, labels map[string]string, trace, spanID string, sampled bool) {
 	entry := struct {
-		Severity string            `json:"severity"`
-		Labels   map[string]string `json:"labels,omitempty"`
-		Trace    string            `json:"trace,omitempty"`
-		Payload  LogEntryPayload   `json:"payload"`
+		Severity     string            `json:"severity"`
+		Labels       map[string]string `json:"labels,omitempty"`
+		Trace        string            `json:"trace,omitempty"`
+		SpanID       string            `json:"spanId,omitempty"`
+		TraceSampled bool              `json:"traceSampled,omitempty"`
+		Payload      LogEntryPayload   `json:"payload"`
 	}{
-		Severity: sev.String(),
-		Labels:   mergeLabels(labels, map[string]string{"execution_id": payload.ExecutionID}),
-		Trace:    trace,
-		Payload:  payload,
+		Severity:     sev.String(),
+		Labels:       mergeLabels(labels, map[string]string{"execution_id": payload.ExecutionID}),
+		Trace:        trace,
+		SpanID:       spanID,
+		TraceSampled: sampled,
+		Payload:      payload,
 	}
 	b, _ := json.Marshal(entry)
 	log.Println(string(b))
@@ -0,0 +1,223 @@
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/genproto/googleapis/api/distribution"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+)
+
+// DefaultBuckets suits latencies in milliseconds, from 5ms to 60s.
+var DefaultBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000}
+
+// ExponentialBuckets returns n bounds starting at start, each factor times
+// the previous.
+func ExponentialBuckets(start, factor float64, n int) []float64 {
+	b := make([]float64, n)
+	for i := range b {
+		b[i] = start * math.Pow(factor, float64(i))
+	}
+	return b
+}
+
+type metric interface {
+	// collect returns the current value of every series.
+	collect() []point
+	kind() metricpb.MetricDescriptor_MetricKind
+}
+
+// point is one series' value at a flush.
+type point struct {
+	labels Labels
+	start  time.Time
+	value  *monitoringpb.TypedValue
+}
+
+// entry is one series of a metric: a combination of label values.
+type entry[V any] struct {
+	labels Labels
+	start  time.Time
+	v      V
+}
+
+type series[V any] struct {
+	mu sync.Mutex
+	m  map[string]*entry[V]
+}
+
+func newSeries[V any]() series[V] { return series[V]{m: map[string]*entry[V]{}} }
+
+func (s *series[V]) update(l Labels, f func(v *V)) {
+	k := key(l)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.m[k]
+	if !ok {
+		e = &entry[V]{labels: clone(l), start: time.Now()}
+		s.m[k] = e
+	}
+	f(&e.v)
+}
+
+func (s *series[V]) collect(value func(v V) *monitoringpb.TypedValue) []point {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]point, 0, len(s.m))
+	for _, e := range s.m {
+		out = append(out, point{labels: e.labels, start: e.start, value: value(e.v)})
+	}
+	return out
+}
+
+// Counter is a cumulative count, such as jobs printed. It is written as
+// an INT64 CUMULATIVE metric, so charts can show rates and totals.
+type Counter struct {
+	series series[int64]
+}
+
+// Add adds n, which must not be negative, to the series for l.
+func (c *Counter) Add(n int64, l Labels) {
+	if n < 0 {
+		panic("metrics: negative counter increment")
+	}
+	c.series.update(l, func(v *int64) { *v += n })
+}
+
+// Inc adds one to the series for l.
+func (c *Counter) Inc(l Labels) { c.Add(1, l) }
+
+func (c *Counter) collect() []point {
+	return c.series.collect(func(v int64) *monitoringpb.TypedValue {
+		return &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_Int64Value{Int64Value: v}}
+	})
+}
+
+func (c *Counter) kind() metricpb.MetricDescriptor_MetricKind {
+	return metricpb.MetricDescriptor_CUMULATIVE
+}
+
+// Gauge is a value at a point in time, such as queue depth. It is written
+// as a DOUBLE GAUGE metric; each flush writes the last value set.
+type Gauge struct {
+	series series[float64]
+}
+
+// Set sets the series for l to v.
+func (g *Gauge) Set(v float64, l Labels) {
+	g.series.update(l, func(cur *float64) { *cur = v })
+}
+
+// Add adds delta to the series for l.
+func (g *Gauge) Add(delta float64, l Labels) {
+	g.series.update(l, func(cur *float64) { *cur += delta })
+}
+
+func (g *Gauge) collect() []point {
+	return g.series.collect(func(v float64) *monitoringpb.TypedValue {
+		return &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_DoubleValue{DoubleValue: v}}
+	})
+}
+
+func (g *Gauge) kind() metricpb.MetricDescriptor_MetricKind {
+	return metricpb.MetricDescriptor_GAUGE
+}
+
+// Distribution records values, such as render latencies, into buckets. It
+// is written as a CUMULATIVE DISTRIBUTION metric, so charts can show
+// percentiles and heatmaps.
+type Distribution struct {
+	bounds []float64
+	series series[dist]
+}
+
+type dist struct {
+	count      int64
+	sum, sumSq float64
+	buckets    []int64
+}
+
+func newDistribution(bounds []float64) *Distribution {
+	if len(bounds) == 0 {
+		panic("metrics: no bucket bounds")
+	}
+	for i := 1; i < len(bounds); i++ {
+		if bounds[i] <= bounds[i-1] {
+			panic(fmt.Sprintf("metrics: bucket bounds %v are not increasing", bounds))
+		}
+	}
+	return &Distribution{bounds: append([]float64(nil), bounds...), series: newSeries[dist]()}
+}
+
+// Record adds v to the series for l.
+func (d *Distribution) Record(v float64, l Labels) {
+	// bucket 0 is below bounds[0]; bucket i holds bounds[i-1] <= v < bounds[i]
+	b := sort.Search(len(d.bounds), func(i int) bool { return d.bounds[i] > v })
+	d.series.update(l, func(cur *dist) {
+		if cur.buckets == nil {
+			cur.buckets = make([]int64, len(d.bounds)+1)
+		}
+		cur.count++
+		cur.sum += v
+		cur.sumSq += v * v
+		cur.buckets[b]++
+	})
+}
+
+// Since records the milliseconds elapsed since start for l.
+func (d *Distribution) Since(start time.Time, l Labels) {
+	d.Record(float64(time.Since(start))/float64(time.Millisecond), l)
+}
+
+func (d *Distribution) collect() []point {
+	return d.series.collect(func(v dist) *monitoringpb.TypedValue {
+		mean := v.sum / float64(v.count)
+		return &monitoringpb.TypedValue{Value: &monitoringpb.TypedValue_DistributionValue{
+			DistributionValue: &distribution.Distribution{
+				Count:                 v.count,
+				Mean:                  mean,
+				SumOfSquaredDeviation: max(v.sumSq-v.sum*mean, 0),
+				BucketOptions: &distribution.Distribution_BucketOptions{
+					Options: &distribution.Distribution_BucketOptions_ExplicitBuckets{
+						ExplicitBuckets: &distribution.Distribution_BucketOptions_Explicit{Bounds: d.bounds},
+					},
+				},
+				BucketCounts: append([]int64(nil), v.buckets...),
+			},
+		}}
+	})
+}
+
+func (d *Distribution) kind() metricpb.MetricDescriptor_MetricKind {
+	return metricpb.MetricDescriptor_CUMULATIVE
+}
+
+// key identifies a series by its labels, whatever their order.
+func key(l Labels) string {
+	keys := make([]string, 0, len(l))
+	for k := range l {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte(0)
+		b.WriteString(l[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
+
+func clone(l Labels) Labels {
+	out := make(Labels, len(l))
+	for k, v := range l {
+		out[k] = v
+	}
+	return out
+}
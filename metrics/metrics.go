@@ -0,0 +1,227 @@
+// Package metrics writes custom Cloud Monitoring metrics. Counters, gauges
+// and distributions aggregate in memory and are flushed periodically, so
+// recording a value is a map update, not an API call.
+//
+// Quick start:
+//
+//	m, err := metrics.New(ctx, metrics.WithLogger(lg))
+//	if err != nil { return err }
+//	defer m.Close(context.Background())
+//
+//	printed := m.Counter("print/jobs_printed")
+//	renderMs := m.Distribution("render/latency_ms", metrics.DefaultBuckets)
+//
+//	printed.Inc(metrics.Labels{"printer": printerID})
+//	renderMs.Record(float64(time.Since(start).Milliseconds()), metrics.Labels{"format": "pdf"})
+//
+// Metrics are written against a monitored resource detected from the
+// runtime (Cloud Run, Cloud Functions, Compute Engine); see WithResource.
+// On Cloud Run with CPU allocated only during requests the background
+// flush may be starved; call Flush at the end of a request or enable
+// always-on CPU.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	monitoring "cloud.google.com/go/monitoring/apiv3/v2"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/internal/gcpenv"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// minFlushInterval keeps well clear of Cloud Monitoring's limit of one
+// point per series every 5 seconds.
+const minFlushInterval = 10 * time.Second
+
+// Labels are metric labels; the same metric must always be recorded with
+// the same label keys.
+type Labels map[string]string
+
+type Options struct {
+	ProjectID      string
+	Prefix         string
+	FlushInterval  time.Duration
+	CommonLabels   Labels
+	ResourceType   string
+	ResourceLabels map[string]string
+	Logger         *logger.CloudLogger
+	ClientOptions  []option.ClientOption
+	ForceStdout    bool
+}
+
+type Option func(*Options)
+
+// WithProjectID sets the project metrics are written to; by default it is
+// detected like the logger's.
+func WithProjectID(id string) Option { return func(o *Options) { o.ProjectID = id } }
+
+// WithPrefix sets the prefix of metric types, "custom.googleapis.com/" by
+// default.
+func WithPrefix(p string) Option { return func(o *Options) { o.Prefix = p } }
+
+// WithFlushInterval sets how often aggregated values are written, 60s by
+// default and at least 10s.
+func WithFlushInterval(d time.Duration) Option {
+	return func(o *Options) { o.FlushInterval = max(d, minFlushInterval) }
+}
+
+// WithCommonLabels adds labels to every metric, such as env.
+func WithCommonLabels(l Labels) Option { return func(o *Options) { o.CommonLabels = l } }
+
+// WithResource overrides the detected monitored resource.
+func WithResource(typ string, labels map[string]string) Option {
+	return func(o *Options) { o.ResourceType, o.ResourceLabels = typ, labels }
+}
+
+// WithLogger logs failed flushes; without it they go to the standard
+// logger.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithClientOptions passes options to the Monitoring client.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *Options) { o.ClientOptions = append(o.ClientOptions, opts...) }
+}
+
+// WithStdoutOnly prints flushed values as JSON lines instead of writing
+// them to Cloud Monitoring, for local runs. It is implied when no project
+// can be detected.
+func WithStdoutOnly() Option { return func(o *Options) { o.ForceStdout = true } }
+
+// Client owns a process's metrics and flushes them. It is safe for
+// concurrent use.
+type Client struct {
+	opts     Options
+	client   *monitoring.MetricClient
+	resource gcpenv.Resource
+
+	mu      sync.Mutex
+	metrics map[string]metric
+	flushMu sync.Mutex
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// New returns a Client and starts its periodic flush; Close stops it.
+func New(ctx context.Context, opts ...Option) (*Client, error) {
+	options := Options{
+		Prefix:        "custom.googleapis.com/",
+		FlushInterval: time.Minute,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.ProjectID == "" && !options.ForceStdout {
+		id, err := gcpenv.ProjectID(ctx)
+		if err != nil {
+			options.ForceStdout = true
+		} else {
+			options.ProjectID = id
+		}
+	}
+	c := &Client{
+		opts:    options,
+		metrics: map[string]metric{},
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if options.ResourceType != "" {
+		c.resource = gcpenv.Resource{Type: options.ResourceType, Labels: options.ResourceLabels}
+	} else {
+		c.resource = gcpenv.DetectResource(ctx, options.ProjectID)
+	}
+	if !options.ForceStdout {
+		client, err := monitoring.NewMetricClient(ctx, options.ClientOptions...)
+		if err != nil {
+			return nil, fmt.Errorf("metrics: new client: %w", err)
+		}
+		c.client = client
+	}
+	go c.loop()
+	return c, nil
+}
+
+func (c *Client) loop() {
+	defer close(c.done)
+	t := time.NewTicker(c.opts.FlushInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-t.C:
+			ctx, cancel := context.WithTimeout(context.Background(), c.opts.FlushInterval)
+			if err := c.Flush(ctx); err != nil {
+				c.logError(err)
+			}
+			cancel()
+		}
+	}
+}
+
+// Close stops the periodic flush, flushes once more and closes the
+// Monitoring client.
+func (c *Client) Close(ctx context.Context) error {
+	var err error
+	c.once.Do(func() {
+		close(c.stop)
+		<-c.done
+		err = c.Flush(ctx)
+		if c.client != nil {
+			err = errors.Join(err, c.client.Close())
+		}
+	})
+	return err
+}
+
+// Counter returns the counter named name, creating it on first use. Its
+// metric type is the prefix plus name, e.g. custom.googleapis.com/print/jobs_printed.
+// It panics if name is already used by a metric of another kind.
+func (c *Client) Counter(name string) *Counter {
+	return register(c, name, func() *Counter { return &Counter{series: newSeries[int64]()} })
+}
+
+// Gauge returns the gauge named name, creating it on first use. It panics
+// if name is already used by a metric of another kind.
+func (c *Client) Gauge(name string) *Gauge {
+	return register(c, name, func() *Gauge { return &Gauge{series: newSeries[float64]()} })
+}
+
+// Distribution returns the distribution named name with the given bucket
+// bounds, creating it on first use; later calls ignore bounds. It panics
+// if name is already used by a metric of another kind or bounds are not
+// increasing.
+func (c *Client) Distribution(name string, bounds []float64) *Distribution {
+	return register(c, name, func() *Distribution { return newDistribution(bounds) })
+}
+
+func register[M metric](c *Client, name string, create func() M) M {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if m, ok := c.metrics[name]; ok {
+		typed, ok := m.(M)
+		if !ok {
+			panic(fmt.Sprintf("metrics: %s already registered as %T", name, m))
+		}
+		return typed
+	}
+	m := create()
+	c.metrics[name] = m
+	return m
+}
+
+func (c *Client) logError(err error) {
+	if lg := c.opts.Logger; lg != nil {
+		lg.Warning(context.Background(), nil, "metrics flush failed", map[string]any{"error": err.Error()})
+		return
+	}
+	log.Printf("metrics: flush: %v", err)
+}
@@ -0,0 +1,315 @@
+package metrics_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/monitoring/apiv3/v2/monitoringpb"
+	"google.golang.org/api/option"
+	metricpb "google.golang.org/genproto/googleapis/api/metric"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+
+	"github.com/print-engine/ieos-golang-utils/metrics"
+)
+
+// fakeMonitoring records written time series.
+type fakeMonitoring struct {
+	monitoringpb.UnimplementedMetricServiceServer
+
+	mu       sync.Mutex
+	requests []*monitoringpb.CreateTimeSeriesRequest
+	fail     bool
+}
+
+func (f *fakeMonitoring) CreateTimeSeries(_ context.Context, req *monitoringpb.CreateTimeSeriesRequest) (*emptypb.Empty, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.fail {
+		return nil, status.Error(codes.InvalidArgument, "points written too frequently")
+	}
+	f.requests = append(f.requests, req)
+	return &emptypb.Empty{}, nil
+}
+
+func (f *fakeMonitoring) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.requests)
+}
+
+// series returns the written series by metric type and label value.
+func (f *fakeMonitoring) series() map[string]*monitoringpb.TimeSeries {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	out := map[string]*monitoringpb.TimeSeries{}
+	for _, req := range f.requests {
+		for _, ts := range req.GetTimeSeries() {
+			out[ts.GetMetric().GetType()+" "+ts.GetMetric().GetLabels()["printer"]] = ts
+		}
+	}
+	return out
+}
+
+// client returns a Client writing to an in-process fakeMonitoring.
+func client(t *testing.T, opts ...metrics.Option) (*metrics.Client, *fakeMonitoring) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeMonitoring{}
+	srv := grpc.NewServer()
+	monitoringpb.RegisterMetricServiceServer(srv, fake)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	c, err := metrics.New(context.Background(), append([]metrics.Option{
+		metrics.WithProjectID("my-proj"),
+		metrics.WithResource("generic_task", map[string]string{"job": "print-engine"}),
+		metrics.WithClientOptions(
+			option.WithEndpoint(lis.Addr().String()),
+			option.WithoutAuthentication(),
+			option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+		),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close(context.Background()) })
+	return c, fake
+}
+
+func TestExponentialBuckets(t *testing.T) {
+	got := metrics.ExponentialBuckets(5, 2, 4)
+	want := []float64{5, 10, 20, 40}
+	if len(got) != len(want) {
+		t.Fatalf("ExponentialBuckets = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ExponentialBuckets = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestFlush(t *testing.T) {
+	tests := []struct {
+		name   string
+		record func(c *metrics.Client)
+		key    string
+		check  func(t *testing.T, ts *monitoringpb.TimeSeries)
+	}{
+		{
+			name: "counter",
+			record: func(c *metrics.Client) {
+				jobs := c.Counter("print/jobs_printed")
+				jobs.Inc(metrics.Labels{"printer": "p1"})
+				jobs.Add(2, metrics.Labels{"printer": "p1"})
+				jobs.Inc(metrics.Labels{"printer": "p2"})
+			},
+			key: "custom.googleapis.com/print/jobs_printed p1",
+			check: func(t *testing.T, ts *monitoringpb.TimeSeries) {
+				p := ts.GetPoints()[0]
+				if ts.GetMetricKind() != metricpb.MetricDescriptor_CUMULATIVE || p.GetValue().GetInt64Value() != 3 {
+					t.Errorf("series = %s %v", ts.GetMetricKind(), p.GetValue())
+				}
+				if !p.GetInterval().GetStartTime().AsTime().Before(p.GetInterval().GetEndTime().AsTime()) {
+					t.Errorf("interval = %v", p.GetInterval())
+				}
+			},
+		},
+		{
+			name: "labels in any order are one series",
+			record: func(c *metrics.Client) {
+				jobs := c.Counter("print/jobs_printed")
+				jobs.Inc(metrics.Labels{"printer": "p1", "format": "pdf"})
+				jobs.Inc(metrics.Labels{"format": "pdf", "printer": "p1"})
+			},
+			key: "custom.googleapis.com/print/jobs_printed p1",
+			check: func(t *testing.T, ts *monitoringpb.TimeSeries) {
+				if v := ts.GetPoints()[0].GetValue().GetInt64Value(); v != 2 {
+					t.Errorf("count = %d, want 2", v)
+				}
+			},
+		},
+		{
+			name: "gauge",
+			record: func(c *metrics.Client) {
+				depth := c.Gauge("print/queue_depth")
+				depth.Set(4, metrics.Labels{"printer": "p1"})
+				depth.Add(-1.5, metrics.Labels{"printer": "p1"})
+			},
+			key: "custom.googleapis.com/print/queue_depth p1",
+			check: func(t *testing.T, ts *monitoringpb.TimeSeries) {
+				p := ts.GetPoints()[0]
+				if ts.GetMetricKind() != metricpb.MetricDescriptor_GAUGE || p.GetValue().GetDoubleValue() != 2.5 || p.GetInterval().GetStartTime() != nil {
+					t.Errorf("series = %s %v %v", ts.GetMetricKind(), p.GetValue(), p.GetInterval())
+				}
+			},
+		},
+		{
+			name: "distribution",
+			record: func(c *metrics.Client) {
+				latency := c.Distribution("render/latency_ms", []float64{10, 100})
+				for _, v := range []float64{5, 10, 50, 500} {
+					latency.Record(v, metrics.Labels{"printer": "p1"})
+				}
+			},
+			key: "custom.googleapis.com/render/latency_ms p1",
+			check: func(t *testing.T, ts *monitoringpb.TimeSeries) {
+				d := ts.GetPoints()[0].GetValue().GetDistributionValue()
+				var ssd float64
+				for _, v := range []float64{5, 10, 50, 500} {
+					ssd += (v - 141.25) * (v - 141.25)
+				}
+				if d.GetCount() != 4 || d.GetMean() != 141.25 || math.Abs(d.GetSumOfSquaredDeviation()-ssd) > 1e-6 {
+					t.Errorf("distribution = %v", d)
+				}
+				if got := d.GetBucketCounts(); len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 1 {
+					t.Errorf("buckets = %v, want [1 2 1]", got)
+				}
+			},
+		},
+		{
+			name: "common labels",
+			record: func(c *metrics.Client) {
+				c.Counter("print/jobs_printed").Inc(metrics.Labels{"printer": "p1", "region": "eu"})
+			},
+			key: "custom.googleapis.com/print/jobs_printed p1",
+			check: func(t *testing.T, ts *monitoringpb.TimeSeries) {
+				l := ts.GetMetric().GetLabels()
+				if l["service"] != "print-engine" || l["region"] != "eu" {
+					t.Errorf("labels = %v", l)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, fake := client(t, metrics.WithCommonLabels(metrics.Labels{"service": "print-engine", "region": "us"}))
+			tt.record(c)
+			if err := c.Flush(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			if n := fake.count(); n != 1 {
+				t.Fatalf("%d requests, want 1", n)
+			}
+			ts, ok := fake.series()[tt.key]
+			if !ok {
+				t.Fatalf("no series %s in %v", tt.key, fake.series())
+			}
+			if ts.GetResource().GetType() != "generic_task" || ts.GetResource().GetLabels()["job"] != "print-engine" {
+				t.Errorf("resource = %v", ts.GetResource())
+			}
+			tt.check(t, ts)
+		})
+	}
+}
+
+func TestFlushBatches(t *testing.T) {
+	c, fake := client(t, metrics.WithPrefix("custom.googleapis.com/ieos/"))
+	jobs := c.Counter("print/jobs_printed")
+	for i := 0; i < 450; i++ {
+		jobs.Inc(metrics.Labels{"printer": "p" + strconv.Itoa(i)})
+	}
+	if err := c.Flush(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count(); n != 3 {
+		t.Errorf("%d requests, want 3", n)
+	}
+	if _, ok := fake.series()["custom.googleapis.com/ieos/print/jobs_printed p0"]; !ok {
+		t.Error("prefix not applied")
+	}
+}
+
+func TestFlushError(t *testing.T) {
+	c, fake := client(t)
+	fake.mu.Lock()
+	fake.fail = true
+	fake.mu.Unlock()
+	c.Counter("print/jobs_printed").Inc(nil)
+	if err := c.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "points written too frequently") {
+		t.Errorf("Flush = %v", err)
+	}
+}
+
+func TestCloseFlushes(t *testing.T) {
+	c, fake := client(t)
+	c.Gauge("print/queue_depth").Set(1, nil)
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n := fake.count(); n != 1 {
+		t.Errorf("%d requests on Close, want 1", n)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Errorf("second Close = %v", err)
+	}
+}
+
+func TestStdoutOnly(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	c, err := metrics.New(context.Background(), metrics.WithStdoutOnly(), metrics.WithResource("global", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Counter("print/jobs_printed").Inc(metrics.Labels{"printer": "p1"})
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if out := buf.String(); !strings.Contains(out, "custom.googleapis.com/print/jobs_printed") || !strings.Contains(out, `"printer":"p1"`) {
+		t.Errorf("stdout = %s", out)
+	}
+}
+
+func TestRegisterPanics(t *testing.T) {
+	tests := []struct {
+		name     string
+		register func(c *metrics.Client)
+	}{
+		{"another kind", func(c *metrics.Client) {
+			c.Counter("print/jobs_printed")
+			c.Gauge("print/jobs_printed")
+		}},
+		{"no bounds", func(c *metrics.Client) { c.Distribution("render/latency_ms", nil) }},
+		{"bounds not increasing", func(c *metrics.Client) { c.Distribution("render/latency_ms", []float64{10, 10}) }},
+		{"negative increment", func(c *metrics.Client) { c.Counter("print/jobs_printed").Add(-1, nil) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := client(t)
+			defer func() {
+				if recover() == nil {
+					t.Error("did not panic")
+				}
+			}()
+			tt.register(c)
+		})
+	}
+}
+
+func TestSameMetric(t *testing.T) {
+	c, _ := client(t)
+	if c.Counter("print/jobs_printed") != c.Counter("print/jobs_printed") {
+		t.Error("Counter returned a new metric for the same name")
+	}
+	d := c.Distribution("render/latency_ms", []float64{10})
+	if c.Distribution("render/latency_ms", []float64{1, 2, 3}) != d {
+		t.Error("Distribution returned a new metric for the same name")
+	}
+}
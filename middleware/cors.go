@@ -0,0 +1,101 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSOptions configures CORS.
+type CORSOptions struct {
+	// AllowedOrigins lists exact origins ("https://app.example.com"),
+	// "*.example.com" subdomain wildcards or "*" for any origin.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, HEAD, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders defaults to the headers the preflight asks for.
+	AllowedHeaders []string
+	// ExposedHeaders are readable by the browser; X-Request-Id always is.
+	ExposedHeaders []string
+	// AllowCredentials allows cookies and auth headers; the matching origin
+	// is then echoed, never "*".
+	AllowCredentials bool
+	// MaxAge is how long browsers cache a preflight; defaults to 10m.
+	MaxAge time.Duration
+}
+
+// CORS sets CORS headers for allowed origins and answers preflight
+// requests itself.
+func CORS(c CORSOptions) Middleware {
+	if len(c.AllowedMethods) == 0 {
+		c.AllowedMethods = []string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	}
+	if c.MaxAge == 0 {
+		c.MaxAge = 10 * time.Minute
+	}
+	methods := strings.Join(c.AllowedMethods, ", ")
+	headers := strings.Join(c.AllowedHeaders, ", ")
+	exposed := strings.Join(append([]string{RequestIDHeader}, c.ExposedHeaders...), ", ")
+	maxAge := strconv.Itoa(int(c.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if origin == "" || !c.allowed(origin) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if c.AllowCredentials || !c.any() {
+				h.Set("Access-Control-Allow-Origin", origin)
+			} else {
+				h.Set("Access-Control-Allow-Origin", "*")
+			}
+			if c.AllowCredentials {
+				h.Set("Access-Control-Allow-Credentials", "true")
+			}
+			if r.Method != http.MethodOptions || r.Header.Get("Access-Control-Request-Method") == "" {
+				h.Set("Access-Control-Expose-Headers", exposed)
+				next.ServeHTTP(w, r)
+				return
+			}
+			// preflight
+			h.Add("Vary", "Access-Control-Request-Method")
+			h.Add("Vary", "Access-Control-Request-Headers")
+			h.Set("Access-Control-Allow-Methods", methods)
+			if headers != "" {
+				h.Set("Access-Control-Allow-Headers", headers)
+			} else if req := r.Header.Get("Access-Control-Request-Headers"); req != "" {
+				h.Set("Access-Control-Allow-Headers", req)
+			}
+			h.Set("Access-Control-Max-Age", maxAge)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+func (c CORSOptions) any() bool {
+	for _, o := range c.AllowedOrigins {
+		if o == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+func (c CORSOptions) allowed(origin string) bool {
+	for _, o := range c.AllowedOrigins {
+		switch {
+		case o == "*", strings.EqualFold(o, origin):
+			return true
+		case strings.HasPrefix(o, "*."):
+			// "*.example.com" matches "https://app.example.com"
+			if _, host, ok := strings.Cut(origin, "://"); ok && strings.HasSuffix(strings.ToLower(host), strings.ToLower(o[1:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
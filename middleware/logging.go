@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"regexp"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// RequestIDHeader carries the request ID, accepted from the caller and
+// echoed in the response.
+const RequestIDHeader = "X-Request-Id"
+
+type requestIDKey struct{}
+type loggerKey struct{}
+
+// validRequestID keeps caller-supplied IDs from injecting into logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// RequestID gives every request an ID: the caller's X-Request-Id when
+// valid, else the trace ID of X-Cloud-Trace-Context, else a random one. It
+// is set on the response and available through RequestIDFrom.
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !validRequestID.MatchString(id) {
+				id, _, _ = strings.Cut(r.Header.Get("X-Cloud-Trace-Context"), "/")
+			}
+			if !validRequestID.MatchString(id) {
+				b := make([]byte, 8)
+				_, _ = rand.Read(b)
+				id = hex.EncodeToString(b)
+			}
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+		})
+	}
+}
+
+// RequestIDFrom returns the ID set by RequestID, or "".
+func RequestIDFrom(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// RequestLogger binds a request logger, carrying the trace and execution
+// ID, to each request for LoggerFrom, and logs every request except those
+// to skip with its status, size and latency: 5xx at error, 4xx at warning,
+// the rest at info.
+func RequestLogger(lg *logger.CloudLogger, skip ...string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), loggerKey{}, lg.ForRequest(r.Context(), r))
+			r = r.WithContext(ctx)
+			for _, p := range skip {
+				if r.URL.Path == p {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			rec := &recorder{ResponseWriter: w}
+			start := time.Now()
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+			data := map[string]any{
+				"method":    r.Method,
+				"path":      r.URL.Path,
+				"status":    rec.status,
+				"bytes":     rec.bytes,
+				"latencyMs": time.Since(start).Milliseconds(),
+				"userAgent": r.UserAgent(),
+			}
+			if id := RequestIDFrom(ctx); id != "" {
+				data["requestId"] = id
+			}
+			msg := fmt.Sprintf("%s %s %d", r.Method, r.URL.Path, rec.status)
+			switch {
+			case rec.status >= 500:
+				lg.Error(ctx, r, msg, data)
+			case rec.status >= 400:
+				lg.Warning(ctx, r, msg, data)
+			default:
+				lg.Info(ctx, r, msg, data)
+			}
+		})
+	}
+}
+
+// LoggerFrom returns the request logger bound by RequestLogger, or nil.
+func LoggerFrom(ctx context.Context) *logger.RequestLogger {
+	rl, _ := ctx.Value(loggerKey{}).(*logger.RequestLogger)
+	return rl
+}
+
+// ContextWithLogger returns ctx carrying rl for LoggerFrom, e.g. to replace
+// the request logger with one carrying more labels.
+func ContextWithLogger(ctx context.Context, rl *logger.RequestLogger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, rl)
+}
+
+// Recover answers 500 instead of dropping the connection when a handler
+// panics, and logs the panic with its stack at critical level.
+// http.ErrAbortHandler is re-raised, as net/http expects.
+func Recover(lg *logger.CloudLogger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				p := recover()
+				if p == nil {
+					return
+				}
+				if p == http.ErrAbortHandler {
+					panic(p)
+				}
+				lg.Critical(r.Context(), r, "handler panic", map[string]any{
+					"panic":     fmt.Sprint(p),
+					"stack":     string(debug.Stack()),
+					"path":      r.URL.Path,
+					"requestId": RequestIDFrom(r.Context()),
+				})
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// recorder captures the status and size of a response.
+type recorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *recorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *recorder) Unwrap() http.ResponseWriter { return r.ResponseWriter }
+
+func (r *recorder) Flush() {
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
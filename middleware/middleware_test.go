@@ -0,0 +1,314 @@
+package middleware_test
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/logging"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/middleware"
+)
+
+// notes records the messages the logger notifies about.
+type notes struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (n *notes) Notify(_ context.Context, sev logging.Severity, _, msg string, _ any) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.msgs = append(n.msgs, sev.String()+" "+msg)
+}
+
+func (n *notes) all() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]string(nil), n.msgs...)
+}
+
+func newLogger(t *testing.T, min logging.Severity) (*logger.CloudLogger, *notes) {
+	t.Helper()
+	n := &notes{}
+	lg, err := logger.New(context.Background(), logger.WithStdoutOnly(), logger.WithNotifier(n, min))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lg, n
+}
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	mw := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := middleware.Chain(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { order = append(order, "handler") }), mw("a"), mw("b"))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if got := strings.Join(order, ","); got != "a,b,handler" {
+		t.Errorf("order = %s, want a,b,handler", got)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   string // "" for a random ID
+	}{
+		{"caller's ID", map[string]string{middleware.RequestIDHeader: "req-42"}, "req-42"},
+		{"trace ID", map[string]string{"X-Cloud-Trace-Context": "105445aa7843bc8bf206b12000100000/1;o=1"}, "105445aa7843bc8bf206b12000100000"},
+		{"invalid caller's ID", map[string]string{middleware.RequestIDHeader: "bad\nid"}, ""},
+		{"none", nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			h := middleware.RequestID()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				seen = middleware.RequestIDFrom(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if got := w.Header().Get(middleware.RequestIDHeader); got != seen {
+				t.Errorf("response ID %q, context ID %q", got, seen)
+			}
+			if tt.want != "" && seen != tt.want {
+				t.Errorf("ID = %q, want %q", seen, tt.want)
+			}
+			if tt.want == "" && len(seen) != 16 {
+				t.Errorf("ID = %q, want 16 random hex digits", seen)
+			}
+		})
+	}
+}
+
+func TestRequestLogger(t *testing.T) {
+	tests := []struct {
+		path   string
+		status int
+		want   []string
+	}{
+		{"/jobs", 200, []string{"Info GET /jobs 200"}},
+		{"/jobs", 404, []string{"Warning GET /jobs 404"}},
+		{"/jobs", 502, []string{"Error GET /jobs 502"}},
+		{"/healthz", 500, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			lg, n := newLogger(t, logging.Info)
+			h := middleware.RequestLogger(lg, "/healthz")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if middleware.LoggerFrom(r.Context()) == nil {
+					t.Error("no request logger bound")
+				}
+				w.WriteHeader(tt.status)
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if got := n.all(); strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("logged %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecover(t *testing.T) {
+	lg, n := newLogger(t, logging.Critical)
+	h := middleware.Recover(lg)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic("nil map") }))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status = %d, want 500", w.Code)
+	}
+	if got := n.all(); len(got) != 1 || got[0] != "Critical handler panic" {
+		t.Errorf("logged %q, want the panic at critical", got)
+	}
+
+	defer func() {
+		if recover() != http.ErrAbortHandler {
+			t.Error("ErrAbortHandler was not re-raised")
+		}
+	}()
+	middleware.Recover(lg)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) { panic(http.ErrAbortHandler) })).
+		ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
+
+func TestCORS(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) { w.WriteHeader(http.StatusOK) })
+	tests := []struct {
+		name        string
+		opts        middleware.CORSOptions
+		method      string
+		origin      string
+		preflight   bool
+		wantStatus  int
+		wantOrigin  string
+		wantCreds   string
+		wantMethods string
+	}{
+		{"exact origin", middleware.CORSOptions{AllowedOrigins: []string{"https://app.example.com"}}, "GET", "https://app.example.com", false, 200, "https://app.example.com", "", ""},
+		{"origin not allowed", middleware.CORSOptions{AllowedOrigins: []string{"https://app.example.com"}}, "GET", "https://evil.example", false, 200, "", "", ""},
+		{"subdomain wildcard", middleware.CORSOptions{AllowedOrigins: []string{"*.example.com"}}, "GET", "https://App.Example.com", false, 200, "https://App.Example.com", "", ""},
+		{"wildcard not a suffix trick", middleware.CORSOptions{AllowedOrigins: []string{"*.example.com"}}, "GET", "https://example.com.evil", false, 200, "", "", ""},
+		{"any origin", middleware.CORSOptions{AllowedOrigins: []string{"*"}}, "GET", "https://x.test", false, 200, "*", "", ""},
+		{"any origin with credentials echoes", middleware.CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true}, "GET", "https://x.test", false, 200, "https://x.test", "true", ""},
+		{"preflight", middleware.CORSOptions{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET", "POST"}}, "OPTIONS", "https://x.test", true, 204, "*", "", "GET, POST"},
+		{"options without preflight", middleware.CORSOptions{AllowedOrigins: []string{"*"}}, "OPTIONS", "https://x.test", false, 200, "*", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, "/jobs", nil)
+			r.Header.Set("Origin", tt.origin)
+			if tt.preflight {
+				r.Header.Set("Access-Control-Request-Method", "POST")
+				r.Header.Set("Access-Control-Request-Headers", "Authorization")
+			}
+			w := httptest.NewRecorder()
+			middleware.CORS(tt.opts)(ok).ServeHTTP(w, r)
+			h := w.Header()
+			if w.Code != tt.wantStatus || h.Get("Access-Control-Allow-Origin") != tt.wantOrigin ||
+				h.Get("Access-Control-Allow-Credentials") != tt.wantCreds || h.Get("Access-Control-Allow-Methods") != tt.wantMethods {
+				t.Errorf("status %d, headers %v", w.Code, h)
+			}
+			if tt.preflight && (h.Get("Access-Control-Allow-Headers") != "Authorization" || h.Get("Access-Control-Max-Age") != "600") {
+				t.Errorf("preflight headers %v", h)
+			}
+		})
+	}
+}
+
+func TestGzip(t *testing.T) {
+	body := strings.Repeat("print job 42 queued\n", 50)
+	tests := []struct {
+		name     string
+		accept   string
+		method   string
+		encoding string // set by the handler
+		status   int
+		wantGzip bool
+	}{
+		{"accepted", "gzip, deflate", "GET", "", 200, true},
+		{"not accepted", "br", "GET", "", 200, false},
+		{"q=0", "gzip;q=0", "GET", "", 200, false},
+		{"head", "gzip", "HEAD", "", 200, false},
+		{"handler's own encoding", "gzip", "GET", "br", 200, false},
+		{"no content", "gzip", "GET", "", 204, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := middleware.Gzip()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				if tt.encoding != "" {
+					w.Header().Set("Content-Encoding", tt.encoding)
+				}
+				w.WriteHeader(tt.status)
+				if tt.status != 204 {
+					_, _ = io.WriteString(w, body)
+				}
+			}))
+			r := httptest.NewRequest(tt.method, "/", nil)
+			r.Header.Set("Accept-Encoding", tt.accept)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			gotGzip := w.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("gzip = %v, want %v", gotGzip, tt.wantGzip)
+			}
+			if !gotGzip {
+				return
+			}
+			zr, err := gzip.NewReader(w.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := io.ReadAll(zr); string(b) != body {
+				t.Error("body did not round-trip")
+			}
+		})
+	}
+}
+
+func TestGzipSniffsPlainBytes(t *testing.T) {
+	h := middleware.Gzip()(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = io.WriteString(w, "<html><body>jobs</body></html>")
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Errorf("Content-Type = %q, want text/html", ct)
+	}
+}
+
+func TestMaxBodySize(t *testing.T) {
+	h := middleware.MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, err := io.ReadAll(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}))
+	tests := []struct {
+		name       string
+		body       string
+		chunked    bool
+		wantStatus int
+	}{
+		{"within", "12345678", false, 200},
+		{"declared over", "123456789", false, 413},
+		{"undeclared over", "123456789", true, 400},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			if tt.chunked {
+				r.ContentLength = -1
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	h := middleware.Timeout(10 * time.Millisecond)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("status = %d, want 503", w.Code)
+	}
+}
+
+func TestStandard(t *testing.T) {
+	lg, _ := newLogger(t, logging.Critical)
+	h := middleware.Standard(lg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if middleware.RequestIDFrom(r.Context()) == "" || middleware.LoggerFrom(r.Context()) == nil {
+			t.Error("request ID or logger missing")
+		}
+		_, _ = io.WriteString(w, strings.Repeat("x", 1024))
+	}))
+	r := httptest.NewRequest(http.MethodGet, "/jobs", nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Header().Get(middleware.RequestIDHeader) == "" || w.Header().Get("Content-Encoding") != "gzip" {
+		t.Errorf("headers = %v, want a request ID and gzip", w.Header())
+	}
+}
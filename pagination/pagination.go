@@ -0,0 +1,156 @@
+// Package pagination gives list endpoints one way to paginate: opaque page
+// tokens signed with HMAC so callers cannot forge or edit them, page-size
+// clamping, and helpers paging Firestore and BigQuery queries.
+//
+// Quick start:
+//
+//	codec := pagination.NewCodec(cursorSecret, pagination.WithTTL(time.Hour))
+//
+//	func listJobs(w http.ResponseWriter, r *http.Request) {
+//	    size, token := pagination.FromRequest(r, 50, 200)
+//	    page, err := pagination.Firestore(r.Context(), jobs, jobs.Ref().OrderBy("createdAt", firestore.Desc), codec, token, size)
+//	    if err != nil {
+//	        errs.WriteHTTP(w, err) // 400 for bad tokens
+//	        return
+//	    }
+//	    json.NewEncoder(w).Encode(page) // {"items":[...],"nextPageToken":"..."}
+//	}
+package pagination
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+)
+
+var (
+	// ErrInvalidToken is returned, wrapped, for page tokens that were not
+	// issued by the codec or were altered.
+	ErrInvalidToken = errs.New(errs.InvalidArgument, "invalid page token")
+	// ErrExpiredToken is returned, wrapped, for page tokens older than the
+	// codec's TTL.
+	ErrExpiredToken = errs.New(errs.InvalidArgument, "page token expired")
+)
+
+// Page is one page of a list response. NextPageToken is empty on the last
+// page.
+type Page[T any] struct {
+	Items         []T    `json:"items"`
+	NextPageToken string `json:"nextPageToken,omitempty"`
+}
+
+type Options struct {
+	TTL time.Duration
+}
+
+type Option func(*Options)
+
+// WithTTL rejects tokens older than d with ErrExpiredToken; by default
+// tokens do not expire.
+func WithTTL(d time.Duration) Option { return func(o *Options) { o.TTL = d } }
+
+// Codec turns cursors into signed page tokens and back. It is safe for
+// concurrent use.
+type Codec struct {
+	secret []byte
+	opts   Options
+}
+
+// NewCodec returns a Codec signing with secret, which should be at least
+// 32 random bytes kept in Secret Manager. Tokens from one codec are only
+// accepted by codecs with the same secret.
+func NewCodec(secret []byte, opts ...Option) *Codec {
+	if len(secret) == 0 {
+		panic("pagination: empty secret")
+	}
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Codec{secret: secret, opts: options}
+}
+
+// token is what a page token carries.
+type token struct {
+	V json.RawMessage `json:"v"`
+	T int64           `json:"t"`
+}
+
+// Encode returns a page token carrying v, any JSON-encodable cursor.
+func (c *Codec) Encode(v any) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("pagination: encode cursor: %w", err)
+	}
+	payload, err := json.Marshal(token{V: raw, T: time.Now().Unix()})
+	if err != nil {
+		return "", fmt.Errorf("pagination: encode cursor: %w", err)
+	}
+	enc := base64.RawURLEncoding.EncodeToString(payload)
+	return enc + "." + base64.RawURLEncoding.EncodeToString(c.sign(enc)), nil
+}
+
+// Decode verifies tok and decodes its cursor into v. An empty tok, the
+// first page, leaves v untouched and returns nil.
+func (c *Codec) Decode(tok string, v any) error {
+	if tok == "" {
+		return nil
+	}
+	enc, sig, ok := strings.Cut(tok, ".")
+	if !ok {
+		return fmt.Errorf("%w: malformed", ErrInvalidToken)
+	}
+	got, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, c.sign(enc)) {
+		return fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(enc)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	var t token
+	if err := json.Unmarshal(payload, &t); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if c.opts.TTL > 0 && time.Since(time.Unix(t.T, 0)) > c.opts.TTL {
+		return ErrExpiredToken
+	}
+	if err := json.Unmarshal(t.V, v); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	return nil
+}
+
+func (c *Codec) sign(s string) []byte {
+	m := hmac.New(sha256.New, c.secret)
+	m.Write([]byte(s))
+	return m.Sum(nil)
+}
+
+// PageSize clamps a requested page size: zero or less gives def, more
+// than max gives max.
+func PageSize(requested, def, max int) int {
+	switch {
+	case requested <= 0:
+		return def
+	case requested > max:
+		return max
+	}
+	return requested
+}
+
+// FromRequest reads the page_size and page_token query parameters, with
+// the size clamped by PageSize. An unparsable size counts as none.
+func FromRequest(r *http.Request, def, max int) (size int, token string) {
+	q := r.URL.Query()
+	n, _ := strconv.Atoi(q.Get("page_size"))
+	return PageSize(n, def, max), q.Get("page_token")
+}
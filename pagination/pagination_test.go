@@ -0,0 +1,133 @@
+package pagination_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+	"github.com/print-engine/ieos-golang-utils/pagination"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+type cursor struct {
+	After string `json:"after"`
+	Seq   int    `json:"seq"`
+}
+
+// forge signs payload with secret the way the codec does.
+func forge(payload string) string {
+	enc := base64.RawURLEncoding.EncodeToString([]byte(payload))
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(enc))
+	return enc + "." + base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+func TestRoundTrip(t *testing.T) {
+	c := pagination.NewCodec(secret)
+	want := cursor{After: "jobs/01J9ZK", Seq: 42}
+	tok, err := c.Encode(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.ContainsAny(tok, "+/=") {
+		t.Errorf("token %q is not URL-safe", tok)
+	}
+	var got cursor
+	if err := c.Decode(tok, &got); err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if got != want {
+		t.Errorf("cursor = %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeFirstPage(t *testing.T) {
+	got := cursor{After: "untouched"}
+	if err := pagination.NewCodec(secret).Decode("", &got); err != nil || got.After != "untouched" {
+		t.Errorf("Decode(\"\") = %v, cursor %+v; want nil and cursor untouched", err, got)
+	}
+}
+
+func TestDecodeRejects(t *testing.T) {
+	c := pagination.NewCodec(secret, pagination.WithTTL(time.Hour))
+	valid, err := c.Encode(cursor{After: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc, sig, _ := strings.Cut(valid, ".")
+	other, _ := pagination.NewCodec([]byte("another secret")).Encode(cursor{After: "a"})
+	old := time.Now().Add(-2 * time.Hour).Unix()
+
+	tests := []struct {
+		name string
+		tok  string
+		want error
+	}{
+		{"no signature", enc, pagination.ErrInvalidToken},
+		{"signature of another secret", other, pagination.ErrInvalidToken},
+		{"edited payload", base64.RawURLEncoding.EncodeToString([]byte(`{"v":{"after":"b"},"t":1}`)) + "." + sig, pagination.ErrInvalidToken},
+		{"garbled signature", enc + ".%%%", pagination.ErrInvalidToken},
+		{"signed garbage", forge("not json"), pagination.ErrInvalidToken},
+		{"wrong cursor type", forge(`{"v":"a string","t":` + strconv.FormatInt(time.Now().Unix(), 10) + `}`), pagination.ErrInvalidToken},
+		{"expired", forge(`{"v":{"after":"a"},"t":` + strconv.FormatInt(old, 10) + `}`), pagination.ErrExpiredToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got cursor
+			err := c.Decode(tt.tok, &got)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("err = %v, want %v", err, tt.want)
+			}
+			if errs.HTTPStatus(err) != http.StatusBadRequest {
+				t.Errorf("HTTP status = %d, want 400", errs.HTTPStatus(err))
+			}
+		})
+	}
+}
+
+func TestPageSize(t *testing.T) {
+	tests := []struct {
+		requested, want int
+	}{
+		{-1, 50},
+		{0, 50},
+		{1, 1},
+		{120, 120},
+		{200, 200},
+		{201, 200},
+	}
+	for _, tt := range tests {
+		if got := pagination.PageSize(tt.requested, 50, 200); got != tt.want {
+			t.Errorf("PageSize(%d) = %d, want %d", tt.requested, got, tt.want)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		query     string
+		wantSize  int
+		wantToken string
+	}{
+		{"", 50, ""},
+		{"page_size=10&page_token=abc.def", 10, "abc.def"},
+		{"page_size=ten", 50, ""},
+		{"page_size=1000", 200, ""},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/jobs?"+tt.query, nil)
+		size, tok := pagination.FromRequest(r, 50, 200)
+		if size != tt.wantSize || tok != tt.wantToken {
+			t.Errorf("FromRequest(%q) = %d, %q; want %d, %q", tt.query, size, tok, tt.wantSize, tt.wantToken)
+		}
+	}
+}
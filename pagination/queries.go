@@ -0,0 +1,90 @@
+package pagination
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/firestore"
+	"google.golang.org/api/iterator"
+
+	"github.com/print-engine/ieos-golang-utils/firestorex"
+)
+
+// Firestore returns one page of q, which must be ordered, over coll. The
+// token wraps firestorex's cursor, so it stays valid while the last
+// document of the previous page exists.
+func Firestore[T any](ctx context.Context, coll *firestorex.Collection[T], q firestore.Query, c *Codec, tok string, size int) (Page[firestorex.Doc[T]], error) {
+	var cursor string
+	if err := c.Decode(tok, &cursor); err != nil {
+		return Page[firestorex.Doc[T]]{}, err
+	}
+	docs, next, err := coll.Page(ctx, q, size, cursor)
+	if err != nil {
+		if errors.Is(err, firestorex.ErrNotFound) || errors.Is(err, firestorex.ErrInvalidCursor) {
+			// the previous page's last document is gone
+			return Page[firestorex.Doc[T]]{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+		}
+		return Page[firestorex.Doc[T]]{}, err
+	}
+	page := Page[firestorex.Doc[T]]{Items: docs}
+	if next != "" {
+		if page.NextPageToken, err = c.Encode(next); err != nil {
+			return Page[firestorex.Doc[T]]{}, err
+		}
+	}
+	return page, nil
+}
+
+// bqCursor points into the results of a finished BigQuery job.
+type bqCursor struct {
+	Project  string `json:"p"`
+	JobID    string `json:"j"`
+	Location string `json:"l"`
+	Token    string `json:"t"`
+}
+
+// BigQuery returns one page of q's results as T, using bigquery's row
+// decoding. The first page runs q; later pages read on from the same job,
+// so paging sees one consistent result set. BigQuery keeps job results for
+// about a day; give the codec a shorter TTL.
+func BigQuery[T any](ctx context.Context, client *bigquery.Client, q *bigquery.Query, c *Codec, tok string, size int) (Page[T], error) {
+	var (
+		cur bqCursor
+		job *bigquery.Job
+		err error
+	)
+	if err := c.Decode(tok, &cur); err != nil {
+		return Page[T]{}, err
+	}
+	if cur.JobID == "" {
+		if job, err = q.Run(ctx); err != nil {
+			return Page[T]{}, fmt.Errorf("pagination: run query: %w", err)
+		}
+	} else {
+		if cur.Project != client.Project() {
+			return Page[T]{}, fmt.Errorf("%w: other project", ErrInvalidToken)
+		}
+		if job, err = client.JobFromIDLocation(ctx, cur.JobID, cur.Location); err != nil {
+			return Page[T]{}, fmt.Errorf("pagination: job %s: %w", cur.JobID, err)
+		}
+	}
+	it, err := job.Read(ctx)
+	if err != nil {
+		return Page[T]{}, fmt.Errorf("pagination: read job %s: %w", job.ID(), err)
+	}
+	var rows []T
+	next, err := iterator.NewPager(it, size, cur.Token).NextPage(&rows)
+	if err != nil {
+		return Page[T]{}, fmt.Errorf("pagination: read job %s: %w", job.ID(), err)
+	}
+	page := Page[T]{Items: rows}
+	if next != "" {
+		cur = bqCursor{Project: client.Project(), JobID: job.ID(), Location: job.Location(), Token: next}
+		if page.NextPageToken, err = c.Encode(cur); err != nil {
+			return Page[T]{}, err
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,114 @@
+// Package profiling starts Cloud Profiler with the fleet's defaults and
+// routes the agent's logs through CloudLogger.
+//
+// Quick start:
+//
+//	func main() {
+//	    if err := profiling.Start("render-api", os.Getenv("K_REVISION"), profiling.WithLogger(lg)); err != nil {
+//	        lg.Warning(ctx, nil, "profiler not started", err) // profiling is best effort
+//	    }
+//	    ...
+//	}
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"cloud.google.com/go/profiler"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/internal/gcpenv"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+const agentTimeLayout = "2006/01/02 15:04:05"
+
+type Options struct {
+	ProjectID      string
+	MutexProfiling bool
+	Logger         *logger.CloudLogger
+	ClientOptions  []option.ClientOption
+}
+
+type Option func(*Options)
+
+// WithProjectID sets the project profiles go to; by default it is
+// detected like the logger's.
+func WithProjectID(id string) Option { return func(o *Options) { o.ProjectID = id } }
+
+// WithMutexProfiling also collects contention profiles, which cost more
+// than the default CPU, heap, allocation and goroutine profiles.
+func WithMutexProfiling() Option { return func(o *Options) { o.MutexProfiling = true } }
+
+// WithLogger sends the agent's logs to lg: failures at warning, the rest
+// at debug. Without it the agent only logs failures to start.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithClientOptions passes options to the Profiler client.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *Options) { o.ClientOptions = append(o.ClientOptions, opts...) }
+}
+
+// Start starts the profiling agent for service at version, which default
+// to K_SERVICE and K_REVISION when empty. Without a detectable project,
+// as when running locally, it does nothing and returns nil. Only the
+// first call in a process has an effect. The agent needs
+// roles/cloudprofiler.agent.
+func Start(service, version string, opts ...Option) error {
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	if service == "" {
+		service = os.Getenv("K_SERVICE")
+	}
+	if version == "" {
+		version = os.Getenv("K_REVISION")
+	}
+	if service == "" {
+		return fmt.Errorf("profiling: no service name")
+	}
+	if options.ProjectID == "" {
+		id, err := gcpenv.ProjectID(context.Background())
+		if err != nil {
+			return nil
+		}
+		options.ProjectID = id
+	}
+	cfg := profiler.Config{
+		Service:        service,
+		ServiceVersion: version,
+		ProjectID:      options.ProjectID,
+		MutexProfiling: options.MutexProfiling,
+	}
+	if options.Logger != nil {
+		cfg.DebugLogging = true
+		cfg.DebugLoggingOutput = agentLog{options.Logger}
+	}
+	if err := profiler.Start(cfg, options.ClientOptions...); err != nil {
+		return fmt.Errorf("profiling: start: %w", err)
+	}
+	return nil
+}
+
+// agentLog receives the agent's log lines, one per Write, formatted as
+// "Cloud Profiler: 2006/01/02 15:04:05 message".
+type agentLog struct{ lg *logger.CloudLogger }
+
+func (a agentLog) Write(p []byte) (int, error) {
+	msg := strings.TrimPrefix(string(bytes.TrimSpace(p)), "Cloud Profiler: ")
+	if len(msg) > len(agentTimeLayout) && msg[4] == '/' {
+		msg = msg[len(agentTimeLayout)+1:]
+	}
+	data := map[string]any{"component": "cloud-profiler"}
+	if strings.Contains(msg, "failed") || strings.Contains(msg, "error") {
+		a.lg.Warning(context.Background(), nil, msg, data)
+	} else {
+		a.lg.Debug(context.Background(), nil, msg, data)
+	}
+	return len(p), nil
+}
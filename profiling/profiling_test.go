@@ -0,0 +1,56 @@
+package profiling
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"cloud.google.com/go/logging"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+type notes struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (n *notes) Notify(_ context.Context, sev logging.Severity, _, msg string, _ any) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.msgs = append(n.msgs, sev.String()+" "+msg)
+}
+
+func TestAgentLog(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{"Cloud Profiler: 2026/10/15 09:00:00 start uploading profile\n", "Debug start uploading profile"},
+		{"Cloud Profiler: 2026/10/15 09:00:00 failed to create profile, will retry: rpc error\n", "Warning failed to create profile, will retry: rpc error"},
+		{"Cloud Profiler: creating a new profile via profiler service", "Debug creating a new profile via profiler service"},
+		{"upload error: deadline exceeded", "Warning upload error: deadline exceeded"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			n := &notes{}
+			lg, err := logger.New(context.Background(), logger.WithStdoutOnly(), logger.WithNotifier(n, logging.Debug))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if written, err := (agentLog{lg}).Write([]byte(tt.line)); err != nil || written != len(tt.line) {
+				t.Fatalf("Write = %d, %v", written, err)
+			}
+			if len(n.msgs) != 1 || n.msgs[0] != tt.want {
+				t.Errorf("logged %q, want %q", n.msgs, tt.want)
+			}
+		})
+	}
+}
+
+func TestStartNeedsService(t *testing.T) {
+	t.Setenv("K_SERVICE", "")
+	if err := Start("", "", WithProjectID("my-proj")); err == nil {
+		t.Error("Start accepted no service name")
+	}
+}
@@ -0,0 +1,122 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+type requestLoggerKey struct{}
+
+// WithRequestLogger injects a request logger for each message, bound to the
+// handler's context, which handlers retrieve with RequestLoggerFrom.
+func WithRequestLogger(lg *logger.CloudLogger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) error {
+			return next(context.WithValue(ctx, requestLoggerKey{}, lg.ForRequest(ctx, nil)), m)
+		}
+	}
+}
+
+// RequestLoggerFrom returns the request logger injected by
+// WithRequestLogger, or nil.
+func RequestLoggerFrom(ctx context.Context) *logger.RequestLogger {
+	rl, _ := ctx.Value(requestLoggerKey{}).(*logger.RequestLogger)
+	return rl
+}
+
+// Recover turns a handler panic into an error, so the message is nacked
+// instead of the process crashing, and logs it with the stack when lg is
+// set.
+func Recover(lg *logger.CloudLogger) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					err = fmt.Errorf("pubsub: handler panic: %v", r)
+					if lg != nil {
+						lg.Critical(ctx, nil, "pubsub handler panic", map[string]any{"messageId": m.ID, "panic": fmt.Sprint(r), "stack": string(debug.Stack())})
+					}
+				}
+			}()
+			return next(ctx, m)
+		}
+	}
+}
+
+// Outcome is how a handled message was settled, as reported to Metrics.
+type Outcome string
+
+const (
+	OutcomeAck  Outcome = "ack"
+	OutcomeNack Outcome = "nack"
+)
+
+// Metrics reports the outcome and handling latency of every message to
+// record, e.g. a counter and histogram of the service's metrics library.
+// Place it inside DeadLetter to see dead-lettered messages as nacks.
+func Metrics(record func(ctx context.Context, m *Message, outcome Outcome, latency time.Duration)) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) error {
+			start := time.Now()
+			err := next(ctx, m)
+			outcome := OutcomeAck
+			if err != nil {
+				outcome = OutcomeNack
+			}
+			record(ctx, m, outcome, time.Since(start))
+			return err
+		}
+	}
+}
+
+// ConcurrencyLimit runs at most n handlers at once. Messages beyond the
+// limit wait in the handler until a slot frees up or ctx is done; prefer
+// ReceiveSettings.MaxOutstandingMessages for the subscription as a whole
+// and use this for a section of the chain or shared limits.
+func ConcurrencyLimit(n int) Middleware {
+	slots := make(chan struct{}, n)
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) error {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			defer func() { <-slots }()
+			return next(ctx, m)
+		}
+	}
+}
+
+// DeadLetterReasonAttribute carries the error of a dead-lettered message.
+const DeadLetterReasonAttribute = "dead-letter-reason"
+
+// DeadLetter republishes messages that fail permanently, or whose delivery
+// attempt (set when the subscription has a dead-letter policy) reached
+// maxAttempts, to pub with their original attributes and the error in
+// DeadLetterReasonAttribute, and acks them. A maxAttempts of 0 only
+// dead-letters permanent failures. If the republish fails the message is
+// nacked as usual.
+func DeadLetter(pub *Publisher, maxAttempts int) Middleware {
+	return func(next HandlerFunc) HandlerFunc {
+		return func(ctx context.Context, m *Message) error {
+			err := next(ctx, m)
+			if err == nil {
+				return nil
+			}
+			exhausted := maxAttempts > 0 && m.DeliveryAttempt != nil && *m.DeliveryAttempt >= maxAttempts
+			if !IsPermanent(err) && !exhausted {
+				return err
+			}
+			attrs := map[string]string{DeadLetterReasonAttribute: err.Error()}
+			if _, perr := pub.Publish(ctx, m.Data, WithAttributes(mergeAttributes(m.Attributes, attrs))); perr != nil {
+				return fmt.Errorf("%w (dead-letter publish failed: %v)", err, perr)
+			}
+			return nil
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// Package pubsub publishes messages to Google Cloud Pub/Sub with the
+// boilerplate every service otherwise repeats: JSON or protobuf encoding,
+// common and per-message attributes, ordering keys, retries of transient
+// failures and logging of publishes that fail for good.
+//
+// Quick start:
+//
+//	pub, err := pubsub.NewPublisher(ctx, "", "print-jobs",
+//	    pubsub.WithLogger(lg), // a *logger.CloudLogger
+//	    pubsub.WithCommonAttributes(map[string]string{"source": "render-api"}),
+//	)
+//	if err != nil { return err }
+//	defer pub.Close()
+//
+//	id, err := pub.Publish(ctx, job,
+//	    pubsub.WithOrderingKey(job.ID),
+//	    pubsub.WithAttributes(map[string]string{"facility": job.Facility}),
+//	)
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	gpubsub "cloud.google.com/go/pubsub"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+	"google.golang.org/protobuf/proto"
+)
+
+// Encoding selects how Publish encodes values.
+type Encoding int
+
+const (
+	// EncodingJSON encodes values with encoding/json.
+	EncodingJSON Encoding = iota
+	// EncodingProto encodes values, which must be proto.Message, in the
+	// protobuf wire format.
+	EncodingProto
+)
+
+// ContentTypeAttribute is set on every message to the encoding's media type,
+// unless the attributes set it, so subscribers can decode it.
+const ContentTypeAttribute = "content-type"
+
+func (e Encoding) contentType() string {
+	if e == EncodingProto {
+		return "application/x-protobuf"
+	}
+	return "application/json"
+}
+
+type Options struct {
+	Encoding         Encoding
+	CommonAttributes map[string]string
+	MessageOrdering  bool
+	MaxAttempts      int
+	InitialBackoff   time.Duration
+	MaxBackoff       time.Duration
+	Logger           *logger.CloudLogger
+	PublishSettings  *gpubsub.PublishSettings
+	Client           *gpubsub.Client
+}
+
+type Option func(*Options)
+
+func WithEncoding(e Encoding) Option { return func(o *Options) { o.Encoding = e } }
+func WithCommonAttributes(attrs map[string]string) Option {
+	return func(o *Options) { o.CommonAttributes = attrs }
+}
+
+// WithMessageOrdering enables ordering keys on the topic. Messages with the
+// same key are delivered in publish order to subscriptions with ordering
+// enabled. It is required to publish with WithOrderingKey.
+func WithMessageOrdering() Option { return func(o *Options) { o.MessageOrdering = true } }
+
+// WithRetry sets how often a publish is attempted in total (1 disables
+// retries) and the backoff between attempts, which doubles from initial up
+// to max with jitter.
+func WithRetry(maxAttempts int, initial, max time.Duration) Option {
+	return func(o *Options) { o.MaxAttempts, o.InitialBackoff, o.MaxBackoff = maxAttempts, initial, max }
+}
+
+// WithLogger logs publishes that fail for good, and retried attempts at
+// debug level, through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithPublishSettings overrides the topic's batching and flow control.
+func WithPublishSettings(s gpubsub.PublishSettings) Option {
+	return func(o *Options) { o.PublishSettings = &s }
+}
+
+// WithClient publishes through an existing client instead of creating one;
+// Close then leaves the client open.
+func WithClient(c *gpubsub.Client) Option { return func(o *Options) { o.Client = c } }
+
+// Publisher publishes to one topic.
+type Publisher struct {
+	opts       Options
+	client     *gpubsub.Client
+	topic      *gpubsub.Topic
+	ownsClient bool
+}
+
+// NewPublisher returns a Publisher for topicID in projectID; an empty
+// projectID is detected from the environment.
+func NewPublisher(ctx context.Context, projectID, topicID string, opts ...Option) (*Publisher, error) {
+	options := Options{
+		Encoding:       EncodingJSON,
+		MaxAttempts:    5,
+		InitialBackoff: 100 * time.Millisecond,
+		MaxBackoff:     5 * time.Second,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	if topicID == "" {
+		return nil, errors.New("pubsub: topic ID is required")
+	}
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+
+	p := &Publisher{opts: options, client: options.Client}
+	if p.client == nil {
+		if projectID == "" {
+			projectID = gpubsub.DetectProjectID
+		}
+		client, err := gpubsub.NewClient(ctx, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub: new client: %w", err)
+		}
+		p.client, p.ownsClient = client, true
+	}
+	p.topic = p.client.Topic(topicID)
+	if options.PublishSettings != nil {
+		p.topic.PublishSettings = *options.PublishSettings
+	}
+	p.topic.EnableMessageOrdering = options.MessageOrdering
+	return p, nil
+}
+
+// Close flushes pending messages and releases the topic, and the client
+// unless it was passed with WithClient.
+func (p *Publisher) Close() error {
+	p.topic.Stop()
+	if p.ownsClient {
+		return p.client.Close()
+	}
+	return nil
+}
+
+// publishOptions are the per-message settings of Publish.
+type publishOptions struct {
+	orderingKey string
+	attributes  map[string]string
+}
+
+type PublishOption func(*publishOptions)
+
+// WithOrderingKey publishes the message with an ordering key; the publisher
+// needs WithMessageOrdering.
+func WithOrderingKey(key string) PublishOption {
+	return func(o *publishOptions) { o.orderingKey = key }
+}
+
+// WithAttributes adds attributes to the message, overriding common ones.
+func WithAttributes(attrs map[string]string) PublishOption {
+	return func(o *publishOptions) { o.attributes = attrs }
+}
+
+// Encode encodes v per the publisher's encoding. []byte is passed through.
+func (p *Publisher) Encode(v any) ([]byte, error) {
+	if b, ok := v.([]byte); ok {
+		return b, nil
+	}
+	if p.opts.Encoding == EncodingProto {
+		m, ok := v.(proto.Message)
+		if !ok {
+			return nil, fmt.Errorf("pubsub: %T is not a proto.Message", v)
+		}
+		return proto.Marshal(m)
+	}
+	return json.Marshal(v)
+}
+
+// Publish encodes v and publishes it, retrying transient failures, and
+// returns the server-assigned message ID. It blocks until the message is
+// published or ctx is done.
+func (p *Publisher) Publish(ctx context.Context, v any, opts ...PublishOption) (string, error) {
+	var po publishOptions
+	for _, f := range opts {
+		f(&po)
+	}
+	data, err := p.Encode(v)
+	if err != nil {
+		return "", fmt.Errorf("pubsub: encode: %w", err)
+	}
+	attrs := mergeAttributes(map[string]string{ContentTypeAttribute: p.opts.Encoding.contentType()}, p.opts.CommonAttributes, po.attributes)
+
+	attempts := 0
+	policy := retryx.Policy{
+		MaxAttempts:  p.opts.MaxAttempts,
+		InitialDelay: p.opts.InitialBackoff,
+		MaxDelay:     p.opts.MaxBackoff,
+		Retryable:    Retryable,
+		OnRetry: func(attempt int, err error, delay time.Duration) {
+			if p.opts.Logger != nil {
+				p.opts.Logger.Debug(ctx, nil, "pubsub publish retrying", map[string]any{"topic": p.topic.ID(), "attempt": attempt, "delay": delay.String(), "error": err.Error()})
+			}
+		},
+	}
+	id, err := retryx.DoValue(ctx, policy, func(ctx context.Context) (string, error) {
+		attempts++
+		// messages are not reusable once handed to the topic
+		msg := &gpubsub.Message{Data: data, OrderingKey: po.orderingKey, Attributes: attrs}
+		id, err := p.topic.Publish(ctx, msg).Get(ctx)
+		if err != nil && po.orderingKey != "" {
+			// a failed publish pauses its ordering key until resumed
+			p.topic.ResumePublish(po.orderingKey)
+		}
+		return id, err
+	})
+	if err != nil {
+		p.logFailure(ctx, po.orderingKey, attrs, len(data), attempts, err)
+		return "", fmt.Errorf("pubsub: publish to %s: %w", p.topic.ID(), err)
+	}
+	return id, nil
+}
+
+func (p *Publisher) logFailure(ctx context.Context, orderingKey string, attrs map[string]string, size, attempts int, err error) {
+	if p.opts.Logger == nil {
+		return
+	}
+	p.opts.Logger.Error(ctx, nil, "pubsub publish failed", map[string]any{
+		"topic":       p.topic.ID(),
+		"orderingKey": orderingKey,
+		"attributes":  attrs,
+		"bytes":       size,
+		"attempts":    attempts,
+		"error":       err.Error(),
+	})
+}
+
+// Retryable reports whether a publish error is transient.
+func Retryable(err error) bool {
+	return retryx.TransientGRPC(err)
+}
+
+func mergeAttributes(layers ...map[string]string) map[string]string {
+	out := map[string]string{}
+	for _, l := range layers {
+		for k, v := range l {
+			out[k] = v
+		}
+	}
+	return out
+}
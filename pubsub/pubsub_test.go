@@ -0,0 +1,287 @@
+package pubsub_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	gpubsub "cloud.google.com/go/pubsub"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/print-engine/ieos-golang-utils/pubsub"
+)
+
+var errHandler = errors.New("printer offline")
+
+// unreachable returns a Publisher whose client connects nowhere, so
+// encoding works and publishing fails.
+func unreachable(t *testing.T, opts ...pubsub.Option) *pubsub.Publisher {
+	t.Helper()
+	ctx := context.Background()
+	client, err := gpubsub.NewClient(ctx, "test-project",
+		option.WithEndpoint("127.0.0.1:1"),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	p, err := pubsub.NewPublisher(ctx, "test-project", "print-jobs", append(opts, pubsub.WithClient(client))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []pubsub.Option
+		v       any
+		want    []byte
+		wantErr bool
+	}{
+		{"json", nil, map[string]int{"copies": 2}, []byte(`{"copies":2}`), false},
+		{"bytes passed through", []pubsub.Option{pubsub.WithEncoding(pubsub.EncodingProto)}, []byte("raw"), []byte("raw"), false},
+		{"proto", []pubsub.Option{pubsub.WithEncoding(pubsub.EncodingProto)}, wrapperspb.String("job-42"), mustProto(wrapperspb.String("job-42")), false},
+		{"proto of a non-message", []pubsub.Option{pubsub.WithEncoding(pubsub.EncodingProto)}, struct{}{}, nil, true},
+		{"json of a channel", nil, make(chan int), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unreachable(t, tt.opts...).Encode(tt.v)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Encode error = %v, want error %v", err, tt.wantErr)
+			}
+			if string(got) != string(tt.want) {
+				t.Errorf("Encode = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func mustProto(m proto.Message) []byte {
+	b, err := proto.Marshal(m)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func TestNewRequiresIDs(t *testing.T) {
+	ctx := context.Background()
+	if _, err := pubsub.NewPublisher(ctx, "p", ""); err == nil {
+		t.Error("NewPublisher accepted an empty topic")
+	}
+	if _, err := pubsub.NewSubscriber(ctx, "p", "", func(context.Context, *pubsub.Message) error { return nil }); err == nil {
+		t.Error("NewSubscriber accepted an empty subscription")
+	}
+	if _, err := pubsub.NewSubscriber(ctx, "p", "jobs", nil); err == nil {
+		t.Error("NewSubscriber accepted a nil handler")
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	if pubsub.Permanent(nil) != nil {
+		t.Error("Permanent(nil) is not nil")
+	}
+	err := pubsub.Permanent(errHandler)
+	if !pubsub.IsPermanent(err) || !errors.Is(err, errHandler) || err.Error() != errHandler.Error() {
+		t.Errorf("Permanent = %v", err)
+	}
+	if pubsub.IsPermanent(errHandler) {
+		t.Error("plain error reported permanent")
+	}
+}
+
+type job struct {
+	ID     string `json:"id"`
+	Copies int    `json:"copies"`
+}
+
+func TestDecoders(t *testing.T) {
+	var gotJob job
+	jsonHandler := pubsub.JSON(func(_ context.Context, v job, _ *pubsub.Message) error {
+		gotJob = v
+		return nil
+	})
+	var gotID string
+	protoHandler := pubsub.Proto(func(_ context.Context, v *wrapperspb.StringValue, _ *pubsub.Message) error {
+		gotID = v.GetValue()
+		return nil
+	})
+	tests := []struct {
+		name          string
+		h             pubsub.HandlerFunc
+		data          []byte
+		wantPermanent bool
+	}{
+		{"json", jsonHandler, []byte(`{"id":"job-42","copies":2}`), false},
+		{"bad json", jsonHandler, []byte(`{"id":`), true},
+		{"json of the wrong type", jsonHandler, []byte(`["job-42"]`), true},
+		{"proto", protoHandler, mustProto(wrapperspb.String("job-42")), false},
+		{"bad proto", protoHandler, []byte{0xff, 0xff}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotJob, gotID = job{}, ""
+			err := tt.h(context.Background(), &pubsub.Message{Data: tt.data})
+			if pubsub.IsPermanent(err) != tt.wantPermanent || (!tt.wantPermanent && err != nil) {
+				t.Fatalf("err = %v, want permanent %v", err, tt.wantPermanent)
+			}
+			if !tt.wantPermanent && gotJob.ID != "job-42" && gotID != "job-42" {
+				t.Errorf("handler got %+v / %q", gotJob, gotID)
+			}
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	mw := func(name string) pubsub.Middleware {
+		return func(next pubsub.HandlerFunc) pubsub.HandlerFunc {
+			return func(ctx context.Context, m *pubsub.Message) error {
+				order = append(order, name)
+				return next(ctx, m)
+			}
+		}
+	}
+	h := pubsub.Chain(func(context.Context, *pubsub.Message) error {
+		order = append(order, "handler")
+		return nil
+	}, mw("a"), mw("b"))
+	_ = h(context.Background(), &pubsub.Message{})
+	if got := strings.Join(order, ","); got != "a,b,handler" {
+		t.Errorf("order = %s, want a,b,handler", got)
+	}
+}
+
+func TestRecoverAndMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		h           pubsub.HandlerFunc
+		wantOutcome pubsub.Outcome
+		wantErr     string
+	}{
+		{"ack", func(context.Context, *pubsub.Message) error { return nil }, pubsub.OutcomeAck, ""},
+		{"nack", func(context.Context, *pubsub.Message) error { return errHandler }, pubsub.OutcomeNack, "printer offline"},
+		{"panic", func(context.Context, *pubsub.Message) error { panic("nil map") }, pubsub.OutcomeNack, "pubsub: handler panic: nil map"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var outcome pubsub.Outcome
+			record := func(_ context.Context, _ *pubsub.Message, o pubsub.Outcome, _ time.Duration) { outcome = o }
+			err := pubsub.Chain(tt.h, pubsub.Metrics(record), pubsub.Recover(nil))(context.Background(), &pubsub.Message{ID: "m1"})
+			if (err == nil && tt.wantErr != "") || (err != nil && err.Error() != tt.wantErr) {
+				t.Errorf("err = %v, want %q", err, tt.wantErr)
+			}
+			if outcome != tt.wantOutcome {
+				t.Errorf("outcome = %s, want %s", outcome, tt.wantOutcome)
+			}
+		})
+	}
+}
+
+func TestConcurrencyLimit(t *testing.T) {
+	var running, peak atomic.Int32
+	h := pubsub.ConcurrencyLimit(2)(func(context.Context, *pubsub.Message) error {
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = h(context.Background(), &pubsub.Message{})
+		}()
+	}
+	wg.Wait()
+	if p := peak.Load(); p != 2 {
+		t.Errorf("peak concurrency = %d, want 2", p)
+	}
+
+	blocked := pubsub.ConcurrencyLimit(1)(func(ctx context.Context, _ *pubsub.Message) error {
+		<-ctx.Done()
+		return nil
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() { _ = blocked(ctx, &pubsub.Message{}) }()
+	time.Sleep(5 * time.Millisecond)
+	wctx, wcancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer wcancel()
+	if err := blocked(wctx, &pubsub.Message{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("waiting handler = %v, want DeadlineExceeded", err)
+	}
+	cancel()
+}
+
+func TestDeadLetter(t *testing.T) {
+	attempt := func(n int) *int { return &n }
+	tests := []struct {
+		name        string
+		err         error
+		attempt     *int
+		wantErr     bool
+		wantPublish bool
+	}{
+		{"success", nil, nil, false, false},
+		{"transient failure nacked", errHandler, attempt(2), true, false},
+		{"no delivery attempt", errHandler, nil, true, false},
+		{"permanent failure dead-lettered", pubsub.Permanent(errHandler), nil, true, true},
+		{"attempts exhausted", errHandler, attempt(5), true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// the publisher connects nowhere, so a dead-letter attempt fails
+			// and shows in the error
+			settings := gpubsub.DefaultPublishSettings
+			settings.Timeout = 50 * time.Millisecond
+			pub := unreachable(t, pubsub.WithRetry(1, time.Millisecond, time.Millisecond), pubsub.WithPublishSettings(settings))
+			h := pubsub.DeadLetter(pub, 5)(func(context.Context, *pubsub.Message) error { return tt.err })
+			ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+			defer cancel()
+			err := h(ctx, &pubsub.Message{Data: []byte("{}"), DeliveryAttempt: tt.attempt})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			published := err != nil && strings.Contains(err.Error(), "dead-letter publish failed")
+			if published != tt.wantPublish {
+				t.Errorf("err = %v, want dead-letter attempt %v", err, tt.wantPublish)
+			}
+			if err != nil && !errors.Is(err, errHandler) {
+				t.Errorf("err = %v, want the handler's error kept", err)
+			}
+		})
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	b, err := unreachable(t).Encode(job{ID: "job-42", Copies: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got job
+	if err := json.Unmarshal(b, &got); err != nil || got != (job{ID: "job-42", Copies: 2}) {
+		t.Errorf("round trip = %+v, %v", got, err)
+	}
+}
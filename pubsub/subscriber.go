@@ -0,0 +1,162 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	gpubsub "cloud.google.com/go/pubsub"
+	"google.golang.org/protobuf/proto"
+)
+
+// Message is a received Pub/Sub message.
+type Message = gpubsub.Message
+
+// HandlerFunc handles one message. Returning nil acks it; an error nacks it
+// for redelivery, unless a middleware such as DeadLetter settles it.
+type HandlerFunc func(ctx context.Context, m *Message) error
+
+// Middleware wraps a handler, like HTTP middleware wraps an http.Handler.
+type Middleware func(HandlerFunc) HandlerFunc
+
+// Chain wraps h in mws; the first middleware is the outermost.
+func Chain(h HandlerFunc, mws ...Middleware) HandlerFunc {
+	for i := len(mws) - 1; i >= 0; i-- {
+		h = mws[i](h)
+	}
+	return h
+}
+
+type SubscriberOptions struct {
+	Middleware      []Middleware
+	ReceiveSettings *gpubsub.ReceiveSettings
+	Client          *gpubsub.Client
+}
+
+type SubscriberOption func(*SubscriberOptions)
+
+// WithMiddleware appends middleware to the subscriber's chain.
+func WithMiddleware(mws ...Middleware) SubscriberOption {
+	return func(o *SubscriberOptions) { o.Middleware = append(o.Middleware, mws...) }
+}
+
+// WithReceiveSettings overrides the subscription's flow control, e.g.
+// MaxOutstandingMessages.
+func WithReceiveSettings(s gpubsub.ReceiveSettings) SubscriberOption {
+	return func(o *SubscriberOptions) { o.ReceiveSettings = &s }
+}
+
+// WithSubscriberClient receives through an existing client instead of
+// creating one; Close then leaves the client open.
+func WithSubscriberClient(c *gpubsub.Client) SubscriberOption {
+	return func(o *SubscriberOptions) { o.Client = c }
+}
+
+// Subscriber runs a handler, wrapped in its middleware chain, for every
+// message of a subscription.
+type Subscriber struct {
+	sub        *gpubsub.Subscription
+	client     *gpubsub.Client
+	ownsClient bool
+	handler    HandlerFunc
+}
+
+// NewSubscriber returns a Subscriber for subscriptionID in projectID; an
+// empty projectID is detected from the environment.
+func NewSubscriber(ctx context.Context, projectID, subscriptionID string, h HandlerFunc, opts ...SubscriberOption) (*Subscriber, error) {
+	var options SubscriberOptions
+	for _, f := range opts {
+		f(&options)
+	}
+	if subscriptionID == "" {
+		return nil, errors.New("pubsub: subscription ID is required")
+	}
+	if h == nil {
+		return nil, errors.New("pubsub: handler is required")
+	}
+
+	s := &Subscriber{client: options.Client, handler: Chain(h, options.Middleware...)}
+	if s.client == nil {
+		if projectID == "" {
+			projectID = gpubsub.DetectProjectID
+		}
+		client, err := gpubsub.NewClient(ctx, projectID)
+		if err != nil {
+			return nil, fmt.Errorf("pubsub: new client: %w", err)
+		}
+		s.client, s.ownsClient = client, true
+	}
+	s.sub = s.client.Subscription(subscriptionID)
+	if options.ReceiveSettings != nil {
+		s.sub.ReceiveSettings = *options.ReceiveSettings
+	}
+	return s, nil
+}
+
+// Receive handles messages until ctx is done or receiving fails for good.
+// Handlers still running when ctx is done finish first.
+func (s *Subscriber) Receive(ctx context.Context) error {
+	return s.sub.Receive(ctx, func(ctx context.Context, m *Message) {
+		if err := s.handler(ctx, m); err != nil {
+			m.Nack()
+			return
+		}
+		m.Ack()
+	})
+}
+
+// Close releases the client unless it was passed with WithSubscriberClient.
+func (s *Subscriber) Close() error {
+	if s.ownsClient {
+		return s.client.Close()
+	}
+	return nil
+}
+
+// permanentError marks a failure that redelivery cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that redelivery cannot fix, such as a
+// malformed message; DeadLetter settles such messages at once.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+// JSON adapts a typed handler to a HandlerFunc by decoding the message data
+// as JSON into a T. Messages that do not decode fail permanently.
+func JSON[T any](h func(ctx context.Context, v T, m *Message) error) HandlerFunc {
+	return func(ctx context.Context, m *Message) error {
+		var v T
+		if err := json.Unmarshal(m.Data, &v); err != nil {
+			return Permanent(fmt.Errorf("pubsub: decode %T: %w", v, err))
+		}
+		return h(ctx, v, m)
+	}
+}
+
+// Proto adapts a typed handler to a HandlerFunc by decoding the message
+// data as the protobuf message T (a generated message pointer type).
+// Messages that do not decode fail permanently.
+func Proto[T proto.Message](h func(ctx context.Context, v T, m *Message) error) HandlerFunc {
+	return func(ctx context.Context, m *Message) error {
+		var zero T
+		v := zero.ProtoReflect().New().Interface().(T)
+		if err := proto.Unmarshal(m.Data, v); err != nil {
+			return Permanent(fmt.Errorf("pubsub: decode %T: %w", v, err))
+		}
+		return h(ctx, v, m)
+	}
+}
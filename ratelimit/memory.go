@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// bucket is the state of one key's token bucket.
+type bucket struct {
+	Tokens  float64   `firestore:"tokens"`
+	Updated time.Time `firestore:"updated"`
+}
+
+// take refills b up to now and takes n tokens if it holds them, returning
+// zero; otherwise it returns how long until it will, taking nothing.
+func (b *bucket) take(now time.Time, l Limit, n int) time.Duration {
+	if b.Updated.IsZero() {
+		b.Tokens = float64(l.Burst)
+	} else if elapsed := now.Sub(b.Updated).Seconds(); elapsed > 0 {
+		b.Tokens = math.Min(float64(l.Burst), b.Tokens+elapsed*l.Rate)
+	}
+	b.Updated = now
+	if b.Tokens >= float64(n) {
+		b.Tokens -= float64(n)
+		return 0
+	}
+	return time.Duration((float64(n) - b.Tokens) / l.Rate * float64(time.Second))
+}
+
+// full reports whether b has refilled completely by now, so it can be
+// forgotten.
+func (b *bucket) full(now time.Time, l Limit) bool {
+	return b.Tokens+now.Sub(b.Updated).Seconds()*l.Rate >= float64(l.Burst)
+}
+
+// MemoryStore keeps buckets in process; each instance limits on its own.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*memBucket
+	takes   int
+}
+
+type memBucket struct {
+	bucket
+	limit Limit
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: map[string]*memBucket{}}
+}
+
+func (s *MemoryStore) Take(_ context.Context, key string, l Limit, n int) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memBucket{}
+		s.buckets[key] = b
+	}
+	b.limit = l
+	wait := b.take(now, l, n)
+	if s.takes++; s.takes%1024 == 0 {
+		// full buckets are the same as missing ones; drop them so per-user
+		// or per-channel keys do not grow the map forever
+		for k, b := range s.buckets {
+			if b.full(now, b.limit) {
+				delete(s.buckets, k)
+			}
+		}
+	}
+	return wait, nil
+}
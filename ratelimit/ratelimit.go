@@ -0,0 +1,166 @@
+// Package ratelimit limits how often something may happen per key, such as
+// Slack messages per channel or calls to a vendor API, with token buckets
+// kept in process or, shared by every instance, in Redis or Firestore.
+//
+// Quick start:
+//
+//	// one message per second per Slack channel, bursts of 3
+//	lim := ratelimit.New(ratelimit.Limit{Rate: 1, Burst: 3})
+//	if err := lim.Wait(ctx, channelID); err != nil { ... }
+//
+//	// a vendor quota shared by all instances
+//	vendor := ratelimit.New(ratelimit.PerMinute(600),
+//	    ratelimit.WithStore(ratelimit.RedisStore(rdb, "ratelimit:")),
+//	    ratelimit.WithQuota("geo-api", ratelimit.PerSecond(5)),
+//	)
+//	ok, err := vendor.Allow(ctx, "geo-api")
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Limit is a token bucket: it refills at Rate tokens per second up to
+// Burst tokens, and every event takes one.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerSecond allows n events a second, all of them at once.
+func PerSecond(n int) Limit { return Limit{Rate: float64(n), Burst: n} }
+
+// PerMinute allows n events a minute, all of them at once.
+func PerMinute(n int) Limit { return Limit{Rate: float64(n) / 60, Burst: n} }
+
+// ErrExceedsBurst is returned when more tokens are asked for at once than
+// the key's bucket holds, which could never succeed.
+var ErrExceedsBurst = errors.New("ratelimit: n exceeds burst")
+
+// Store keeps the buckets.
+type Store interface {
+	// Take takes n tokens from key's bucket and returns zero if it holds
+	// them; otherwise it takes nothing and returns how long until it will.
+	Take(ctx context.Context, key string, l Limit, n int) (time.Duration, error)
+}
+
+type Options struct {
+	Quotas   map[string]Limit
+	Store    Store
+	FailOpen bool
+	Logger   *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithQuota gives key its own limit instead of the default.
+func WithQuota(key string, l Limit) Option {
+	return func(o *Options) {
+		if o.Quotas == nil {
+			o.Quotas = map[string]Limit{}
+		}
+		o.Quotas[key] = l
+	}
+}
+
+// WithStore keeps the buckets in s, e.g. RedisStore or FirestoreStore to
+// share them across instances; defaults to an in-process store.
+func WithStore(s Store) Option { return func(o *Options) { o.Store = s } }
+
+// WithFailOpen lets events through when the store fails, instead of
+// returning its error; failures are logged at warning level.
+func WithFailOpen() Option { return func(o *Options) { o.FailOpen = true } }
+
+// WithLogger logs store failures through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// Limiter limits events per key. It is safe for concurrent use.
+type Limiter struct {
+	limit Limit
+	opts  Options
+}
+
+// New returns a Limiter applying l to every key without a quota of its
+// own. Rates must be positive.
+func New(l Limit, opts ...Option) *Limiter {
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.Store == nil {
+		options.Store = NewMemoryStore()
+	}
+	return &Limiter{limit: l, opts: options}
+}
+
+// Limit returns the limit applied to key.
+func (l *Limiter) Limit(key string) Limit {
+	if q, ok := l.opts.Quotas[key]; ok {
+		return q
+	}
+	return l.limit
+}
+
+// Allow reports whether an event for key may happen now, and if so counts
+// it.
+func (l *Limiter) Allow(ctx context.Context, key string) (bool, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+// AllowN is Allow for n events at once.
+func (l *Limiter) AllowN(ctx context.Context, key string, n int) (bool, error) {
+	wait, err := l.take(ctx, key, n)
+	return err == nil && wait == 0, err
+}
+
+// Wait blocks until an event for key may happen and counts it. It returns
+// early with an error when ctx is done or its deadline is too close for
+// the wait.
+func (l *Limiter) Wait(ctx context.Context, key string) error {
+	return l.WaitN(ctx, key, 1)
+}
+
+// WaitN is Wait for n events at once.
+func (l *Limiter) WaitN(ctx context.Context, key string, n int) error {
+	for {
+		wait, err := l.take(ctx, key, n)
+		if err != nil || wait == 0 {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return fmt.Errorf("ratelimit: %s: wait of %s exceeds context deadline", key, wait)
+		}
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+			// another instance may have taken the tokens meanwhile; try again
+		}
+	}
+}
+
+func (l *Limiter) take(ctx context.Context, key string, n int) (time.Duration, error) {
+	lim := l.Limit(key)
+	if n > lim.Burst {
+		return 0, fmt.Errorf("%w: %s: %d > %d", ErrExceedsBurst, key, n, lim.Burst)
+	}
+	wait, err := l.opts.Store.Take(ctx, key, lim, n)
+	if err == nil {
+		return wait, nil
+	}
+	err = fmt.Errorf("ratelimit: %s: %w", key, err)
+	if lg := l.opts.Logger; lg != nil {
+		lg.Warning(ctx, nil, "rate limit store failed", map[string]any{"key": key, "failOpen": l.opts.FailOpen, "error": err.Error()})
+	}
+	if l.opts.FailOpen {
+		return 0, nil
+	}
+	return 0, err
+}
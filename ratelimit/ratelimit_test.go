@@ -0,0 +1,189 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+var t0 = time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+
+func TestBucketTake(t *testing.T) {
+	l := Limit{Rate: 2, Burst: 4} // a token every 500ms
+	tests := []struct {
+		name       string
+		b          bucket
+		now        time.Time
+		n          int
+		wantWait   time.Duration
+		wantTokens float64
+	}{
+		{"new bucket starts full", bucket{}, t0, 1, 0, 3},
+		{"new bucket, whole burst", bucket{}, t0, 4, 0, 0},
+		{"enough tokens", bucket{Tokens: 2, Updated: t0}, t0, 2, 0, 0},
+		{"empty", bucket{Tokens: 0, Updated: t0}, t0, 1, 500 * time.Millisecond, 0},
+		{"short by one and a half", bucket{Tokens: 0.5, Updated: t0}, t0, 2, 750 * time.Millisecond, 0.5},
+		{"refilled", bucket{Tokens: 0, Updated: t0}, t0.Add(time.Second), 1, 0, 1},
+		{"refill capped at burst", bucket{Tokens: 1, Updated: t0}, t0.Add(time.Hour), 1, 0, 3},
+		// a clock going backwards neither refills nor drains
+		{"clock going backwards", bucket{Tokens: 1, Updated: t0}, t0.Add(-time.Second), 1, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := tt.b
+			if got := b.take(tt.now, l, tt.n); got != tt.wantWait {
+				t.Errorf("wait = %s, want %s", got, tt.wantWait)
+			}
+			if b.Tokens != tt.wantTokens {
+				t.Errorf("tokens = %v, want %v", b.Tokens, tt.wantTokens)
+			}
+			if !b.Updated.Equal(tt.now) {
+				t.Errorf("updated = %s, want %s", b.Updated, tt.now)
+			}
+		})
+	}
+}
+
+func TestBucketFull(t *testing.T) {
+	l := Limit{Rate: 2, Burst: 4}
+	tests := []struct {
+		name string
+		b    bucket
+		now  time.Time
+		want bool
+	}{
+		{"full", bucket{Tokens: 4, Updated: t0}, t0, true},
+		{"partly used", bucket{Tokens: 3, Updated: t0}, t0, false},
+		{"refilled since", bucket{Tokens: 3, Updated: t0}, t0.Add(500 * time.Millisecond), true},
+		{"not refilled yet", bucket{Tokens: 0, Updated: t0}, t0.Add(time.Second), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.b.full(tt.now, l); got != tt.want {
+				t.Errorf("full = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllow(t *testing.T) {
+	ctx := context.Background()
+	lim := New(Limit{Rate: 0.001, Burst: 3}, WithQuota("vip", Limit{Rate: 0.001, Burst: 5}))
+	tests := []struct {
+		key  string
+		want int
+	}{
+		{"C0123", 3},
+		{"C0456", 3}, // keys have buckets of their own
+		{"vip", 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			allowed := 0
+			for i := 0; i < 10; i++ {
+				ok, err := lim.Allow(ctx, tt.key)
+				if err != nil {
+					t.Fatalf("Allow: %v", err)
+				}
+				if ok {
+					allowed++
+				}
+			}
+			if allowed != tt.want {
+				t.Errorf("allowed %d of 10, want %d", allowed, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowNExceedsBurst(t *testing.T) {
+	lim := New(PerSecond(2))
+	if _, err := lim.AllowN(context.Background(), "k", 3); !errors.Is(err, ErrExceedsBurst) {
+		t.Errorf("err = %v, want ErrExceedsBurst", err)
+	}
+}
+
+// failingStore fails every Take.
+type failingStore struct{}
+
+var errStore = errors.New("store down")
+
+func (failingStore) Take(context.Context, string, Limit, int) (time.Duration, error) {
+	return 0, errStore
+}
+
+func TestStoreFailure(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []Option
+		wantOK  bool
+		wantErr error
+	}{
+		{"fail closed", []Option{WithStore(failingStore{})}, false, errStore},
+		{"fail open", []Option{WithStore(failingStore{}), WithFailOpen()}, true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, err := New(PerSecond(1), tt.opts...).Allow(context.Background(), "k")
+			if ok != tt.wantOK || !errors.Is(err, tt.wantErr) {
+				t.Errorf("Allow = %v, %v; want %v, %v", ok, err, tt.wantOK, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	ctx := context.Background()
+	lim := New(Limit{Rate: 50, Burst: 1}) // a token every 20ms
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		if err := lim.Wait(ctx, "k"); err != nil {
+			t.Fatalf("Wait: %v", err)
+		}
+	}
+	if took := time.Since(start); took < 55*time.Millisecond {
+		t.Errorf("4 events took %s, want at least 3 refills of 20ms", took)
+	}
+
+	t.Run("deadline too close", func(t *testing.T) {
+		lim := New(Limit{Rate: 0.1, Burst: 1})
+		if err := lim.Wait(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		start := time.Now()
+		if err := lim.Wait(ctx, "k"); err == nil {
+			t.Fatal("Wait succeeded, want an error for a 10s wait")
+		}
+		if time.Since(start) > 100*time.Millisecond {
+			t.Error("Wait blocked instead of failing at once")
+		}
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		lim := New(Limit{Rate: 0.1, Burst: 1})
+		if err := lim.Wait(ctx, "k"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(ctx)
+		time.AfterFunc(10*time.Millisecond, cancel)
+		if err := lim.Wait(ctx, "k"); !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	})
+}
+
+func TestMemoryStoreForgetsFullBuckets(t *testing.T) {
+	s := NewMemoryStore()
+	l := Limit{Rate: 1e6, Burst: 1}
+	for i := 0; i < 2048; i++ {
+		if _, err := s.Take(context.Background(), fmt.Sprintf("user-%d", i), l, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(s.buckets); n >= 1024 {
+		t.Errorf("%d buckets kept, want full ones dropped", n)
+	}
+}
@@ -0,0 +1,108 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/redis/go-redis/v9"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RedisStore keeps buckets in Redis hashes under prefix+key, updated
+// atomically by a script that uses the Redis server's clock. Idle buckets
+// expire once full.
+func RedisStore(client redis.Scripter, prefix string) Store {
+	return &redisStore{client: client, prefix: prefix}
+}
+
+type redisStore struct {
+	client redis.Scripter
+	prefix string
+}
+
+// takeScript is bucket.take in Lua; it returns the wait in seconds as a
+// string, since Redis truncates Lua numbers to integers.
+var takeScript = redis.NewScript(`
+local rate, burst, n = tonumber(ARGV[1]), tonumber(ARGV[2]), tonumber(ARGV[3])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+local b = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens, updated = tonumber(b[1]), tonumber(b[2])
+if tokens == nil then
+  tokens = burst
+elseif now > updated then
+  tokens = math.min(burst, tokens + (now - updated) * rate)
+end
+local wait = 0
+if tokens >= n then
+  tokens = tokens - n
+else
+  wait = (n - tokens) / rate
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((burst - tokens) / rate * 1000) + 1000)
+return tostring(wait)
+`)
+
+func (s *redisStore) Take(ctx context.Context, key string, l Limit, n int) (time.Duration, error) {
+	res, err := takeScript.Run(ctx, s.client, []string{s.prefix + key}, l.Rate, l.Burst, n).Text()
+	if err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(res, 64)
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(secs * float64(time.Second)), nil
+}
+
+// FirestoreStore keeps buckets as documents of collection, updated in
+// transactions. Each document also gets an expireAt field for when it is
+// full again; a TTL policy on it removes idle buckets. Firestore sustains
+// about one write a second per document, so it suits low rates over many
+// keys; use RedisStore for hot keys.
+func FirestoreStore(client *firestore.Client, collection string) Store {
+	return &firestoreStore{client: client, coll: client.Collection(collection)}
+}
+
+type firestoreStore struct {
+	client *firestore.Client
+	coll   *firestore.CollectionRef
+}
+
+type firestoreBucket struct {
+	bucket
+	ExpireAt time.Time `firestore:"expireAt"`
+}
+
+func (s *firestoreStore) Take(ctx context.Context, key string, l Limit, n int) (time.Duration, error) {
+	// document IDs cannot contain slashes
+	ref := s.coll.Doc(url.PathEscape(key))
+	var wait time.Duration
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		var b firestoreBucket
+		snap, err := tx.Get(ref)
+		switch {
+		case status.Code(err) == codes.NotFound:
+		case err != nil:
+			return err
+		default:
+			if err := snap.DataTo(&b); err != nil {
+				return err
+			}
+		}
+		now := time.Now()
+		if wait = b.take(now, l, n); wait > 0 {
+			return nil
+		}
+		refill := (float64(l.Burst) - b.Tokens) / l.Rate
+		b.ExpireAt = now.Add(time.Duration(math.Ceil(refill)) * time.Second)
+		return tx.Set(ref, b)
+	})
+	return wait, err
+}
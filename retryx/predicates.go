@@ -0,0 +1,84 @@
+package retryx
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Predicate reports whether an error is transient and worth another try.
+type Predicate func(error) bool
+
+// AnyOf retries errors any of preds retries.
+func AnyOf(preds ...Predicate) Predicate {
+	return func(err error) bool {
+		for _, p := range preds {
+			if p(err) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// NetworkErrors retries network failures: timeouts, refused and reset
+// connections and DNS lookups.
+func NetworkErrors(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// GRPCCodes retries gRPC status errors with one of codes, as returned by
+// the Google Cloud client libraries.
+func GRPCCodes(codes ...codes.Code) Predicate {
+	return func(err error) bool {
+		s, ok := status.FromError(err)
+		if !ok {
+			return false
+		}
+		for _, c := range codes {
+			if s.Code() == c {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TransientGRPC retries the gRPC codes that signal a transient condition.
+var TransientGRPC = GRPCCodes(codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal)
+
+// StatusError is an HTTP response status as an error, for HTTPStatus.
+type StatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string { return "unexpected HTTP status " + e.Status }
+
+// HTTPStatus retries *StatusError errors with one of statuses.
+func HTTPStatus(statuses ...int) Predicate {
+	return func(err error) bool {
+		var se *StatusError
+		if !errors.As(err, &se) {
+			return false
+		}
+		for _, s := range statuses {
+			if se.StatusCode == s {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// TransientHTTP retries rate limiting and server errors that are usually
+// temporary.
+var TransientHTTP = HTTPStatus(http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout)
+
+// DefaultRetryable retries network failures, transient gRPC codes and
+// transient HTTP statuses.
+var DefaultRetryable = AnyOf(NetworkErrors, TransientGRPC, TransientHTTP)
@@ -0,0 +1,216 @@
+// Package retryx retries operations with exponential backoff and jitter,
+// bounded by attempts, elapsed time and the context, retrying only errors a
+// predicate classifies as transient.
+//
+// Quick start:
+//
+//	policy := retryx.Policy{
+//	    MaxAttempts: 5,
+//	    MaxElapsed:  30 * time.Second,
+//	    Retryable:   retryx.AnyOf(retryx.NetworkErrors, retryx.GRPCCodes(codes.Unavailable)),
+//	}
+//	err := policy.Do(ctx, func(ctx context.Context) error {
+//	    return client.Send(ctx, req)
+//	})
+//
+//	// or, for operations with a result
+//	resp, err := retryx.DoValue(ctx, policy, func(ctx context.Context) (*Response, error) {
+//	    return client.Get(ctx, id)
+//	})
+package retryx
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+const (
+	DefaultMaxAttempts  = 3
+	DefaultInitialDelay = 100 * time.Millisecond
+	DefaultMaxDelay     = 10 * time.Second
+	DefaultMultiplier   = 2.0
+	DefaultJitter       = 0.5
+)
+
+// Policy describes how an operation is retried. The zero value retries
+// DefaultRetryable errors up to DefaultMaxAttempts times in total.
+type Policy struct {
+	// MaxAttempts counts the first try; 1 disables retries. Zero means
+	// DefaultMaxAttempts, a negative value no limit (bound the retries
+	// with MaxElapsed or the context instead).
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry. Defaults to 100ms.
+	InitialDelay time.Duration
+	// MaxDelay caps a single delay, including one requested with After.
+	// Defaults to 10s.
+	MaxDelay time.Duration
+	// Multiplier grows the delay after each retry. Defaults to 2.
+	Multiplier float64
+	// Jitter randomizes each delay down by up to this fraction, so
+	// instances retrying after the same outage spread out: 0.5 waits
+	// between half and all of the delay. Defaults to 0.5; set a negative
+	// value for none.
+	Jitter float64
+	// MaxElapsed stops retrying once another delay would end past this
+	// long after the first try. Zero means no limit.
+	MaxElapsed time.Duration
+	// Retryable classifies errors; nil means DefaultRetryable. Permanent
+	// and context errors are never retried.
+	Retryable Predicate
+	// OnRetry, when set, is called before each delay, e.g. to log the
+	// failed attempt (1-based).
+	OnRetry func(attempt int, err error, delay time.Duration)
+}
+
+func (p Policy) withDefaults() Policy {
+	if p.MaxAttempts == 0 {
+		p.MaxAttempts = DefaultMaxAttempts
+	}
+	if p.InitialDelay <= 0 {
+		p.InitialDelay = DefaultInitialDelay
+	}
+	if p.MaxDelay <= 0 {
+		p.MaxDelay = DefaultMaxDelay
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = DefaultMultiplier
+	}
+	if p.Jitter == 0 {
+		p.Jitter = DefaultJitter
+	}
+	if p.Jitter < 0 {
+		p.Jitter = 0
+	}
+	if p.Jitter > 1 {
+		p.Jitter = 1
+	}
+	if p.Retryable == nil {
+		p.Retryable = DefaultRetryable
+	}
+	return p
+}
+
+// Delay returns the jittered delay before retry number attempt (1-based).
+func (p Policy) Delay(attempt int) time.Duration {
+	p = p.withDefaults()
+	d := float64(p.InitialDelay)
+	for i := 1; i < attempt && d < float64(p.MaxDelay); i++ {
+		d *= p.Multiplier
+	}
+	if d > float64(p.MaxDelay) {
+		d = float64(p.MaxDelay)
+	}
+	return time.Duration(d - d*p.Jitter*rand.Float64())
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, runs out of attempts or elapsed time, or ctx is done, and
+// returns the last error from fn. Retries never outlast ctx's deadline.
+func (p Policy) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	_, err := DoValue(ctx, p, func(ctx context.Context) (struct{}, error) {
+		return struct{}{}, fn(ctx)
+	})
+	return err
+}
+
+// DoValue is Do for operations that return a value.
+func DoValue[T any](ctx context.Context, p Policy, fn func(ctx context.Context) (T, error)) (T, error) {
+	p = p.withDefaults()
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		v, err := fn(ctx)
+		if err == nil {
+			return v, nil
+		}
+		if (p.MaxAttempts > 0 && attempt >= p.MaxAttempts) || !retryable(p.Retryable, err) {
+			return v, unwrapPermanent(err)
+		}
+		delay := p.Delay(attempt)
+		if d, ok := requestedDelay(err); ok {
+			delay = min(d, p.MaxDelay)
+		}
+		if p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed {
+			return v, err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return v, err
+		}
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, delay)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return v, err
+		case <-timer.C:
+		}
+	}
+}
+
+func retryable(pred Predicate, err error) bool {
+	if IsPermanent(err) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var after *afterError
+	if errors.As(err, &after) {
+		return true
+	}
+	return pred(err)
+}
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err so it is returned at once whatever the predicate
+// says. Do returns the unwrapped error.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p *permanentError
+	return errors.As(err, &p)
+}
+
+func unwrapPermanent(err error) error {
+	if p, ok := err.(*permanentError); ok {
+		return p.err
+	}
+	return err
+}
+
+// afterError asks for a retry after a server-specified delay.
+type afterError struct {
+	err   error
+	delay time.Duration
+}
+
+func (e *afterError) Error() string { return e.err.Error() }
+func (e *afterError) Unwrap() error { return e.err }
+
+// After marks err as retryable after delay, e.g. a rate limit's
+// Retry-After, overriding the backoff (up to MaxDelay) and the predicate.
+func After(err error, delay time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &afterError{err: err, delay: delay}
+}
+
+func requestedDelay(err error) (time.Duration, bool) {
+	var after *afterError
+	if errors.As(err, &after) {
+		return after.delay, true
+	}
+	return 0, false
+}
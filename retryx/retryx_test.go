@@ -0,0 +1,189 @@
+package retryx_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+var (
+	errTransient = &retryx.StatusError{StatusCode: http.StatusServiceUnavailable, Status: "503 Service Unavailable"}
+	errInvalid   = errors.New("invalid request")
+)
+
+func TestDelay(t *testing.T) {
+	p := retryx.Policy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Jitter: -1}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	}
+	for _, tt := range tests {
+		if got := p.Delay(tt.attempt); got != tt.want {
+			t.Errorf("Delay(%d) = %s, want %s", tt.attempt, got, tt.want)
+		}
+	}
+
+	jittered := retryx.Policy{InitialDelay: 100 * time.Millisecond, Jitter: 0.5}
+	for i := 0; i < 100; i++ {
+		if d := jittered.Delay(1); d < 50*time.Millisecond || d > 100*time.Millisecond {
+			t.Fatalf("jittered Delay(1) = %s, want within [50ms, 100ms]", d)
+		}
+	}
+}
+
+func TestPredicates(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"network error", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, true},
+		{"wrapped network error", fmt.Errorf("send: %w", &net.DNSError{Err: "no such host", IsTimeout: true}), true},
+		{"grpc unavailable", status.Error(codes.Unavailable, "backend down"), true},
+		{"grpc resource exhausted", status.Error(codes.ResourceExhausted, "quota"), true},
+		{"grpc invalid argument", status.Error(codes.InvalidArgument, "bad"), false},
+		{"http 429", &retryx.StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"http 503", errTransient, true},
+		{"http 404", &retryx.StatusError{StatusCode: http.StatusNotFound}, false},
+		{"plain error", errInvalid, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := retryx.DefaultRetryable(tt.err); got != tt.want {
+				t.Errorf("DefaultRetryable = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDo(t *testing.T) {
+	fast := retryx.Policy{MaxAttempts: 4, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+	tests := []struct {
+		name         string
+		policy       retryx.Policy
+		errs         []error // returned by successive attempts, then nil
+		wantAttempts int
+		wantErr      error
+	}{
+		{"first try", fast, nil, 1, nil},
+		{"transient then success", fast, []error{errTransient, errTransient}, 3, nil},
+		{"out of attempts", fast, []error{errTransient, errTransient, errTransient, errTransient, errTransient}, 4, errTransient},
+		{"not retryable", fast, []error{errInvalid}, 1, errInvalid},
+		{"permanent", fast, []error{retryx.Permanent(errTransient)}, 1, errTransient},
+		{"after overrides the predicate", fast, []error{retryx.After(errInvalid, time.Millisecond)}, 2, nil},
+		{"context error", fast, []error{context.DeadlineExceeded}, 1, context.DeadlineExceeded},
+		{"custom predicate", retryx.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, Retryable: func(err error) bool { return errors.Is(err, errInvalid) }},
+			[]error{errInvalid, errTransient}, 2, errTransient},
+		{"no retries", retryx.Policy{MaxAttempts: 1}, []error{errTransient}, 1, errTransient},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			var retries []int
+			tt.policy.OnRetry = func(attempt int, _ error, _ time.Duration) { retries = append(retries, attempt) }
+			err := tt.policy.Do(context.Background(), func(context.Context) error {
+				attempts++
+				if attempts <= len(tt.errs) {
+					return tt.errs[attempts-1]
+				}
+				return nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if retryx.IsPermanent(err) {
+				t.Error("Do returned a Permanent wrapper")
+			}
+			if attempts != tt.wantAttempts || len(retries) != attempts-1 {
+				t.Errorf("attempts = %d with OnRetry %v, want %d", attempts, retries, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDoLimits(t *testing.T) {
+	always := func(context.Context) error { return errTransient }
+	tests := []struct {
+		name    string
+		policy  retryx.Policy
+		ctx     func() (context.Context, context.CancelFunc)
+		maxTook time.Duration
+	}{
+		{
+			name:    "max elapsed",
+			policy:  retryx.Policy{MaxAttempts: -1, InitialDelay: 10 * time.Millisecond, Jitter: -1, MaxElapsed: 50 * time.Millisecond},
+			ctx:     func() (context.Context, context.CancelFunc) { return context.WithCancel(context.Background()) },
+			maxTook: 100 * time.Millisecond,
+		},
+		{
+			name:   "deadline too close for the delay",
+			policy: retryx.Policy{MaxAttempts: -1, InitialDelay: time.Second},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 100*time.Millisecond)
+			},
+			maxTook: 50 * time.Millisecond,
+		},
+		{
+			name:   "cancelled while waiting",
+			policy: retryx.Policy{MaxAttempts: -1, InitialDelay: time.Second},
+			ctx: func() (context.Context, context.CancelFunc) {
+				ctx, cancel := context.WithCancel(context.Background())
+				time.AfterFunc(20*time.Millisecond, cancel)
+				return ctx, cancel
+			},
+			maxTook: 200 * time.Millisecond,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			start := time.Now()
+			if err := tt.policy.Do(ctx, always); !errors.Is(err, errTransient) {
+				t.Errorf("err = %v, want the last attempt's error", err)
+			}
+			if took := time.Since(start); took > tt.maxTook {
+				t.Errorf("took %s, want at most %s", took, tt.maxTook)
+			}
+		})
+	}
+}
+
+func TestAfterCappedByMaxDelay(t *testing.T) {
+	p := retryx.Policy{MaxAttempts: 2, MaxDelay: 10 * time.Millisecond}
+	var delay time.Duration
+	p.OnRetry = func(_ int, _ error, d time.Duration) { delay = d }
+	_ = p.Do(context.Background(), func(context.Context) error { return retryx.After(errTransient, time.Hour) })
+	if delay != 10*time.Millisecond {
+		t.Errorf("delay = %s, want MaxDelay", delay)
+	}
+}
+
+func TestDoValue(t *testing.T) {
+	p := retryx.Policy{InitialDelay: time.Millisecond}
+	attempts := 0
+	got, err := retryx.DoValue(context.Background(), p, func(context.Context) (string, error) {
+		if attempts++; attempts < 2 {
+			return "", errTransient
+		}
+		return "ok", nil
+	})
+	if err != nil || got != "ok" {
+		t.Errorf("DoValue = %q, %v; want ok", got, err)
+	}
+}
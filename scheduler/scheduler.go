@@ -0,0 +1,194 @@
+// Package scheduler guards HTTP endpoints invoked by Cloud Scheduler, such
+// as daily summaries and cleanup jobs, so that only the scheduler's
+// service account can trigger them, and reads the job metadata Scheduler
+// sends with each run.
+//
+// Quick start:
+//
+//	guard, err := scheduler.New(ctx,
+//	    scheduler.WithAudience("https://jobs-abc123-uc.a.run.app/cron/daily-summary"),
+//	    scheduler.WithServiceAccount("scheduler@my-project.iam.gserviceaccount.com"),
+//	    scheduler.WithLogger(lg),
+//	)
+//	if err != nil { return err }
+//	mux.Handle("/cron/daily-summary", guard.Middleware()(http.HandlerFunc(dailySummary)))
+//
+//	func dailySummary(w http.ResponseWriter, r *http.Request) {
+//	    inv, _ := scheduler.From(r.Context())
+//	    day := inv.ScheduleTime.Truncate(24 * time.Hour) // stable across retries
+//	    ...
+//	}
+package scheduler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"google.golang.org/api/idtoken"
+
+	"github.com/print-engine/ieos-golang-utils/auth"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/middleware"
+)
+
+// Headers Cloud Scheduler sets on HTTP target requests.
+const (
+	Header             = "X-CloudScheduler"
+	JobNameHeader      = "X-CloudScheduler-JobName"
+	ScheduleTimeHeader = "X-CloudScheduler-ScheduleTime"
+)
+
+// ErrSharedHeader is returned when the header set by WithSharedHeader is
+// missing or wrong.
+var ErrSharedHeader = errors.New("scheduler: shared header mismatch")
+
+// Invocation is the metadata of a scheduled run.
+type Invocation struct {
+	// JobName is the Scheduler job's ID.
+	JobName string
+	// ScheduleTime is when the run was scheduled; it stays the same when
+	// Scheduler retries the run, so it makes a good idempotency key.
+	ScheduleTime time.Time
+}
+
+// Parse reads the Scheduler headers of r. It returns false for requests
+// without them, which Scheduler did not send; the headers are not
+// authenticated, so use a Verifier before trusting them.
+func Parse(r *http.Request) (Invocation, bool) {
+	if r.Header.Get(Header) != "true" {
+		return Invocation{}, false
+	}
+	inv := Invocation{JobName: r.Header.Get(JobNameHeader)}
+	if t, err := time.Parse(time.RFC3339Nano, r.Header.Get(ScheduleTimeHeader)); err == nil {
+		inv.ScheduleTime = t
+	}
+	return inv, true
+}
+
+type Options struct {
+	Audiences       []string
+	ServiceAccounts []string
+	HeaderName      string
+	HeaderValue     string
+	Logger          *logger.CloudLogger
+	Validator       *idtoken.Validator
+}
+
+type Option func(*Options)
+
+// WithAudience sets the accepted OIDC audiences; at least one is
+// required. It is the audience set on the job's OIDC token, by default
+// the target URL.
+func WithAudience(aud ...string) Option {
+	return func(o *Options) { o.Audiences = append(o.Audiences, aud...) }
+}
+
+// WithServiceAccount accepts only tokens of the listed service accounts,
+// those the jobs run as. Without it any Google-signed token for the
+// audience passes.
+func WithServiceAccount(emails ...string) Option {
+	return func(o *Options) { o.ServiceAccounts = append(o.ServiceAccounts, emails...) }
+}
+
+// WithSharedHeader also requires header name to equal value, a secret
+// set in the job's headers, as a second factor next to the token.
+func WithSharedHeader(name, value string) Option {
+	return func(o *Options) { o.HeaderName, o.HeaderValue = name, value }
+}
+
+// WithLogger logs rejected requests at warning level.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithValidator replaces the idtoken.Validator used to check signatures.
+func WithValidator(v *idtoken.Validator) Option { return func(o *Options) { o.Validator = v } }
+
+// Verifier checks that requests come from Cloud Scheduler. It is safe for
+// concurrent use.
+type Verifier struct {
+	opts Options
+	auth *auth.Verifier
+}
+
+// New returns a Verifier for the OIDC tokens Scheduler jobs send.
+func New(ctx context.Context, opts ...Option) (*Verifier, error) {
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.HeaderName != "" && options.HeaderValue == "" {
+		return nil, errors.New("scheduler: empty shared header value")
+	}
+	aopts := []auth.Option{auth.WithAudience(options.Audiences...), auth.WithEmails(options.ServiceAccounts...)}
+	if options.Validator != nil {
+		aopts = append(aopts, auth.WithValidator(options.Validator))
+	}
+	av, err := auth.NewVerifier(ctx, aopts...)
+	if err != nil {
+		return nil, fmt.Errorf("scheduler: %w", err)
+	}
+	return &Verifier{opts: options, auth: av}, nil
+}
+
+// Verify checks r's shared header, if configured, and OIDC token, and
+// returns its Invocation. Errors wrap ErrSharedHeader or auth's
+// ErrMissingToken, ErrInvalidToken or ErrForbidden.
+func (v *Verifier) Verify(r *http.Request) (Invocation, error) {
+	if v.opts.HeaderName != "" {
+		got := r.Header.Get(v.opts.HeaderName)
+		if subtle.ConstantTimeCompare([]byte(got), []byte(v.opts.HeaderValue)) != 1 {
+			return Invocation{}, ErrSharedHeader
+		}
+	}
+	if _, err := v.auth.Verify(r.Context(), auth.BearerToken(r)); err != nil {
+		return Invocation{}, err
+	}
+	inv, _ := Parse(r)
+	return inv, nil
+}
+
+type invocationKey struct{}
+
+// Middleware verifies each request before calling the next handler,
+// answering 403 for callers not allowed by WithServiceAccount and 401
+// otherwise. Scheduler counts both as failed runs. The Invocation is
+// available through From, and the request logger bound by
+// middleware.RequestLogger gains a scheduler_job label.
+func (v *Verifier) Middleware() middleware.Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inv, err := v.Verify(r)
+			if err != nil {
+				v.reject(w, r, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), invocationKey{}, inv)
+			if rl := middleware.LoggerFrom(ctx); rl != nil && inv.JobName != "" {
+				ctx = middleware.ContextWithLogger(ctx, rl.WithLabels(map[string]string{"scheduler_job": inv.JobName}))
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// From returns the Invocation verified by Middleware.
+func From(ctx context.Context) (Invocation, bool) {
+	inv, ok := ctx.Value(invocationKey{}).(Invocation)
+	return inv, ok
+}
+
+func (v *Verifier) reject(w http.ResponseWriter, r *http.Request, err error) {
+	status := http.StatusUnauthorized
+	if errors.Is(err, auth.ErrForbidden) {
+		status = http.StatusForbidden
+	}
+	if lg := v.opts.Logger; lg != nil {
+		lg.Warning(r.Context(), r, "scheduler request rejected", map[string]any{
+			"path": r.URL.Path, "status": status, "job": r.Header.Get(JobNameHeader), "error": err.Error(),
+		})
+	}
+	http.Error(w, http.StatusText(status), status)
+}
@@ -0,0 +1,180 @@
+package scheduler_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/api/idtoken"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/scheduler"
+)
+
+const (
+	testKid      = "key-1"
+	testAudience = "https://jobs.example.com/cron/daily-summary"
+	testAccount  = "scheduler@my-project.iam.gserviceaccount.com"
+)
+
+var signingKey = func() *rsa.PrivateKey {
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return k
+}()
+
+// redirect sends every request to srv, standing in for Google's cert
+// endpoints.
+type redirect struct{ srv *url.URL }
+
+func (rt redirect) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.URL.Scheme, r.URL.Host = rt.srv.Scheme, rt.srv.Host
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+// validator checks tokens against signingKey's public half.
+func validator(t *testing.T) *idtoken.Validator {
+	t.Helper()
+	pub := signingKey.PublicKey
+	body, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA", "kid": testKid, "use": "sig", "alg": "RS256",
+		"n": base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	u, _ := url.Parse(srv.URL)
+	v, err := idtoken.NewValidator(context.Background(), option.WithHTTPClient(&http.Client{Transport: redirect{u}}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func token(t *testing.T, email string) string {
+	t.Helper()
+	now := time.Now()
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            "https://accounts.google.com",
+		"aud":            testAudience,
+		"sub":            "1234",
+		"email":          email,
+		"email_verified": true,
+		"iat":            now.Unix(),
+		"exp":            now.Add(time.Hour).Unix(),
+	})
+	tok.Header["kid"] = testKid
+	s, err := tok.SignedString(signingKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name   string
+		header map[string]string
+		want   scheduler.Invocation
+		wantOK bool
+	}{
+		{"not from scheduler", nil, scheduler.Invocation{}, false},
+		{"full", map[string]string{
+			scheduler.Header: "true", scheduler.JobNameHeader: "daily-summary", scheduler.ScheduleTimeHeader: "2026-10-15T09:00:00Z",
+		}, scheduler.Invocation{JobName: "daily-summary", ScheduleTime: time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)}, true},
+		{"bad schedule time", map[string]string{
+			scheduler.Header: "true", scheduler.JobNameHeader: "daily-summary", scheduler.ScheduleTimeHeader: "yesterday",
+		}, scheduler.Invocation{JobName: "daily-summary"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/cron/daily-summary", nil)
+			for k, v := range tt.header {
+				r.Header.Set(k, v)
+			}
+			got, ok := scheduler.Parse(r)
+			if ok != tt.wantOK || got.JobName != tt.want.JobName || !got.ScheduleTime.Equal(tt.want.ScheduleTime) {
+				t.Errorf("Parse = %+v, %v; want %+v, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestNewRejectsEmptySharedHeader(t *testing.T) {
+	_, err := scheduler.New(context.Background(), scheduler.WithAudience(testAudience),
+		scheduler.WithSharedHeader("X-Cron-Secret", ""), scheduler.WithValidator(validator(t)))
+	if err == nil {
+		t.Error("New accepted an empty shared header value")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	v, err := scheduler.New(context.Background(),
+		scheduler.WithAudience(testAudience),
+		scheduler.WithServiceAccount(testAccount),
+		scheduler.WithSharedHeader("X-Cron-Secret", "s3cret"),
+		scheduler.WithValidator(validator(t)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got scheduler.Invocation
+	h := v.Middleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = scheduler.From(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name   string
+		token  string
+		secret string
+		want   int
+	}{
+		{"valid", token(t, testAccount), "s3cret", http.StatusNoContent},
+		{"wrong shared header", token(t, testAccount), "guess", http.StatusUnauthorized},
+		{"missing shared header", token(t, testAccount), "", http.StatusUnauthorized},
+		{"missing token", "", "s3cret", http.StatusUnauthorized},
+		{"garbled token", "not-a-jwt", "s3cret", http.StatusUnauthorized},
+		{"other service account", token(t, "intruder@other.iam.gserviceaccount.com"), "s3cret", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = scheduler.Invocation{}
+			r := httptest.NewRequest(http.MethodPost, "/cron/daily-summary", nil)
+			r.Header.Set(scheduler.Header, "true")
+			r.Header.Set(scheduler.JobNameHeader, "daily-summary")
+			if tt.token != "" {
+				r.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			if tt.secret != "" {
+				r.Header.Set("X-Cron-Secret", tt.secret)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Fatalf("status = %d, want %d", w.Code, tt.want)
+			}
+			if ok := got.JobName == "daily-summary"; ok != (tt.want == http.StatusNoContent) {
+				t.Errorf("invocation = %+v", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+// Package secrets reads Google Cloud Secret Manager versions with an
+// in-memory cache, so hot paths such as token loaders can call Get on every
+// request, and notifies callers when a secret is rotated.
+//
+// Quick start:
+//
+//	token, err := secrets.Get(ctx, "projects/my-proj/secrets/slack-bot-token/versions/latest")
+//
+//	// or with a client of your own
+//	sc, err := secrets.NewClient(ctx, secrets.WithTTL(time.Minute), secrets.WithLogger(lg))
+//	if err != nil { return err }
+//	defer sc.Close()
+//	sc.OnRotate("projects/my-proj/secrets/db-password", func(ctx context.Context, name, value string) {
+//	    pool.Reconnect(value)
+//	})
+//	go sc.Watch(ctx) // re-reads cached secrets every TTL to fire OnRotate
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	secretmanager "cloud.google.com/go/secretmanager/apiv1"
+	"cloud.google.com/go/secretmanager/apiv1/secretmanagerpb"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// Accessor reads a secret version and returns its full resource name, with
+// the version number an alias such as "latest" resolved to, and its payload.
+type Accessor func(ctx context.Context, name string) (version string, payload []byte, err error)
+
+// RotateFunc is called with a rotated secret's version name, normalized as
+// by Name, and its new value.
+type RotateFunc func(ctx context.Context, name, value string)
+
+type Options struct {
+	TTL      time.Duration
+	Logger   *logger.CloudLogger
+	Accessor Accessor
+}
+
+type Option func(*Options)
+
+// WithTTL sets how long values of unpinned versions ("latest" or another
+// alias) are served from the cache; defaults to 5m. Pinned versions, by
+// number, never change and are cached for the life of the client.
+func WithTTL(d time.Duration) Option { return func(o *Options) { o.TTL = d } }
+
+// WithLogger logs failed refreshes, when the cached value is served instead,
+// and rotations through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithAccessor reads secrets through f instead of a Secret Manager client,
+// e.g. in tests.
+func WithAccessor(f Accessor) Option { return func(o *Options) { o.Accessor = f } }
+
+// Client caches secret versions. It is safe for concurrent use.
+type Client struct {
+	opts   Options
+	client *secretmanager.Client
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	rotate  map[string][]RotateFunc
+}
+
+type entry struct {
+	mu      sync.Mutex // held while fetching, so concurrent misses fetch once
+	version string
+	value   string
+	fetched time.Time
+}
+
+// NewClient returns a Client; it creates a Secret Manager client unless
+// WithAccessor is given.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	options := Options{TTL: 5 * time.Minute}
+	for _, f := range opts {
+		f(&options)
+	}
+	c := &Client{opts: options, entries: map[string]*entry{}, rotate: map[string][]RotateFunc{}}
+	if c.opts.Accessor == nil {
+		client, err := secretmanager.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("secrets: new client: %w", err)
+		}
+		c.client = client
+		c.opts.Accessor = c.access
+	}
+	return c, nil
+}
+
+func (c *Client) access(ctx context.Context, name string) (string, []byte, error) {
+	resp, err := c.client.AccessSecretVersion(ctx, &secretmanagerpb.AccessSecretVersionRequest{Name: name})
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.GetName(), resp.GetPayload().GetData(), nil
+}
+
+// Close releases the Secret Manager client.
+func (c *Client) Close() error {
+	if c.client != nil {
+		return c.client.Close()
+	}
+	return nil
+}
+
+// Name normalizes a secret reference to a version resource name:
+// "projects/p/secrets/s" means the latest version. It reports false for
+// anything else.
+func Name(ref string) (string, bool) {
+	parts := strings.Split(ref, "/")
+	switch {
+	case len(parts) == 4 && parts[0] == "projects" && parts[2] == "secrets" && parts[1] != "" && parts[3] != "":
+		return ref + "/versions/latest", true
+	case len(parts) == 6 && parts[0] == "projects" && parts[2] == "secrets" && parts[4] == "versions" && parts[1] != "" && parts[3] != "" && parts[5] != "":
+		return ref, true
+	}
+	return "", false
+}
+
+// Version returns the resource name of version v of secret, e.g. to pin a
+// deployment to a known-good credential: Version("projects/p/secrets/s", "7").
+func Version(secret, v string) string {
+	return strings.TrimSuffix(secret, "/") + "/versions/" + v
+}
+
+// pinned reports whether name is a numbered version, whose value never
+// changes.
+func pinned(name string) bool {
+	v := name[strings.LastIndex(name, "/")+1:]
+	return strings.Trim(v, "0123456789") == ""
+}
+
+// Get returns the value of a secret version, with surrounding whitespace
+// trimmed, from the cache when fresh. If a refresh fails the cached value is
+// served and the failure logged, so a Secret Manager outage does not take
+// down callers that already had the secret.
+func (c *Client) Get(ctx context.Context, ref string) (string, error) {
+	name, ok := Name(ref)
+	if !ok {
+		return "", fmt.Errorf("secrets: %q is not a secret reference (projects/p/secrets/s[/versions/v])", ref)
+	}
+	c.mu.Lock()
+	e, ok := c.entries[name]
+	if !ok {
+		e = &entry{}
+		c.entries[name] = e
+	}
+	c.mu.Unlock()
+
+	e.mu.Lock()
+	if !e.fetched.IsZero() && (pinned(name) || time.Since(e.fetched) < c.opts.TTL) {
+		value := e.value
+		e.mu.Unlock()
+		return value, nil
+	}
+	value, rotated, err := c.fetch(ctx, name, e)
+	version := e.version
+	e.mu.Unlock()
+	if rotated {
+		// outside the lock, so callbacks may Get the secret
+		c.notify(ctx, name, version, value)
+	}
+	return value, err
+}
+
+// fetch must be called with e.mu held.
+func (c *Client) fetch(ctx context.Context, name string, e *entry) (value string, rotated bool, err error) {
+	version, payload, err := c.opts.Accessor(ctx, name)
+	if err != nil {
+		if e.fetched.IsZero() {
+			return "", false, fmt.Errorf("secrets: access %s: %w", name, err)
+		}
+		if lg := c.opts.Logger; lg != nil {
+			lg.Warning(ctx, nil, "secret refresh failed, serving cached value", map[string]any{"secret": name, "version": e.version, "error": err.Error()})
+		}
+		// retry at the next TTL rather than on every call
+		e.fetched = time.Now()
+		return e.value, false, nil
+	}
+	value = strings.TrimSpace(string(payload))
+	rotated = !e.fetched.IsZero() && version != e.version
+	e.version, e.value, e.fetched = version, value, time.Now()
+	return value, rotated, nil
+}
+
+// OnRotate calls f whenever a refresh of ref (a secret or version name, as
+// given to Get) finds a new version. Refreshes happen on Get after the TTL
+// and, in the background, in Watch.
+func (c *Client) OnRotate(ref string, f RotateFunc) {
+	name, ok := Name(ref)
+	if !ok {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.rotate[name] = append(c.rotate[name], f)
+}
+
+func (c *Client) notify(ctx context.Context, name, version, value string) {
+	if lg := c.opts.Logger; lg != nil {
+		lg.Info(ctx, nil, "secret rotated", map[string]any{"secret": name, "version": version})
+	}
+	c.mu.Lock()
+	fns := append([]RotateFunc(nil), c.rotate[name]...)
+	c.mu.Unlock()
+	for _, f := range fns {
+		f(ctx, name, value)
+	}
+}
+
+// Watch refreshes every cached unpinned secret, and those registered with
+// OnRotate, every TTL until ctx is done, so rotations are noticed without
+// waiting for a Get.
+func (c *Client) Watch(ctx context.Context) error {
+	t := time.NewTicker(c.opts.TTL)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+		c.mu.Lock()
+		var names []string
+		for name := range c.entries {
+			names = append(names, name)
+		}
+		for name := range c.rotate {
+			if _, ok := c.entries[name]; !ok {
+				names = append(names, name)
+			}
+		}
+		c.mu.Unlock()
+		for _, name := range names {
+			if pinned(name) {
+				continue
+			}
+			// Get refreshes values older than the TTL; the rest wait a tick
+			if _, err := c.Get(ctx, name); err != nil && !errors.Is(err, context.Canceled) && c.opts.Logger != nil {
+				c.opts.Logger.Warning(ctx, nil, "secret refresh failed", map[string]any{"secret": name, "error": err.Error()})
+			}
+		}
+	}
+}
+
+var (
+	defaultOnce   sync.Once
+	defaultClient *Client
+	defaultErr    error
+)
+
+// Get returns a secret's value through a process-wide Client with the
+// default TTL, created on first use.
+func Get(ctx context.Context, ref string) (string, error) {
+	defaultOnce.Do(func() {
+		// The client is reused across requests, so it must not inherit ctx's deadline.
+		defaultClient, defaultErr = NewClient(context.Background())
+	})
+	if defaultErr != nil {
+		return "", defaultErr
+	}
+	return defaultClient.Get(ctx, ref)
+}
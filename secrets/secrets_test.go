@@ -0,0 +1,188 @@
+package secrets_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/secrets"
+)
+
+const secret = "projects/my-proj/secrets/slack-bot-token"
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		ref    string
+		want   string
+		wantOK bool
+	}{
+		{secret, secret + "/versions/latest", true},
+		{secret + "/versions/7", secret + "/versions/7", true},
+		{secret + "/versions/latest", secret + "/versions/latest", true},
+		{"slack-bot-token", "", false},
+		{"projects//secrets/slack-bot-token", "", false},
+		{"projects/my-proj/topics/print-jobs", "", false},
+		{secret + "/versions/", "", false},
+		{secret + "/aliases/7", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, ok := secrets.Name(tt.ref)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("Name = %q, %v; want %q, %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestVersion(t *testing.T) {
+	for _, s := range []string{secret, secret + "/"} {
+		if got := secrets.Version(s, "7"); got != secret+"/versions/7" {
+			t.Errorf("Version(%q) = %q", s, got)
+		}
+	}
+}
+
+// fakeManager serves versions of secrets from memory and counts reads.
+type fakeManager struct {
+	mu      sync.Mutex
+	version int
+	err     error
+	reads   atomic.Int32
+}
+
+func (f *fakeManager) access(_ context.Context, name string) (string, []byte, error) {
+	f.reads.Add(1)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", nil, f.err
+	}
+	return fmt.Sprintf("%s#%d", name, f.version), []byte(fmt.Sprintf("  xoxb-%d\n", f.version)), nil
+}
+
+func (f *fakeManager) set(version int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.version, f.err = version, err
+}
+
+func TestGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		ref       string
+		ttl       time.Duration
+		rotate    int   // version after the first Get
+		err       error // on refresh
+		want      string
+		wantReads int32
+	}{
+		{"cached within the TTL", secret, time.Hour, 2, nil, "xoxb-1", 1},
+		{"refreshed after the TTL", secret, time.Nanosecond, 2, nil, "xoxb-2", 2},
+		{"pinned versions never refresh", secret + "/versions/1", time.Nanosecond, 2, nil, "xoxb-1", 1},
+		{"cached value served when refresh fails", secret, time.Nanosecond, 2, errors.New("unavailable"), "xoxb-1", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeManager{version: 1}
+			c, err := secrets.NewClient(context.Background(), secrets.WithTTL(tt.ttl), secrets.WithAccessor(f.access))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+			ctx := context.Background()
+			if got, err := c.Get(ctx, tt.ref); err != nil || got != "xoxb-1" {
+				t.Fatalf("first Get = %q, %v", got, err)
+			}
+			f.set(tt.rotate, tt.err)
+			time.Sleep(time.Millisecond)
+			got, err := c.Get(ctx, tt.ref)
+			if err != nil || got != tt.want {
+				t.Errorf("Get = %q, %v; want %q", got, err, tt.want)
+			}
+			if n := f.reads.Load(); n != tt.wantReads {
+				t.Errorf("read %d times, want %d", n, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestGetErrors(t *testing.T) {
+	f := &fakeManager{err: errors.New("permission denied")}
+	c, err := secrets.NewClient(context.Background(), secrets.WithAccessor(f.access))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(context.Background(), "slack-bot-token"); err == nil {
+		t.Error("Get accepted a bare secret id")
+	}
+	if _, err := c.Get(context.Background(), secret); err == nil || !errors.Is(err, f.err) {
+		t.Errorf("Get = %v, want the access error", err)
+	}
+}
+
+func TestConcurrentMissesFetchOnce(t *testing.T) {
+	f := &fakeManager{version: 1}
+	c, err := secrets.NewClient(context.Background(), secrets.WithAccessor(f.access))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _ = c.Get(context.Background(), secret)
+		}()
+	}
+	wg.Wait()
+	if n := f.reads.Load(); n != 1 {
+		t.Errorf("read %d times, want 1", n)
+	}
+}
+
+func TestOnRotate(t *testing.T) {
+	f := &fakeManager{version: 1}
+	c, err := secrets.NewClient(context.Background(), secrets.WithTTL(10*time.Millisecond), secrets.WithAccessor(f.access))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated := make(chan string, 1)
+	// registered by secret, fired for its latest version
+	c.OnRotate(secret, func(ctx context.Context, name, value string) {
+		if name != secret+"/versions/latest" {
+			t.Errorf("rotated %s", name)
+		}
+		// callbacks run outside the lock, so may read the secret
+		if got, _ := c.Get(ctx, name); got != value {
+			t.Errorf("Get in callback = %q, want %q", got, value)
+		}
+		rotated <- value
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if _, err := c.Get(ctx, secret); err != nil {
+		t.Fatal(err)
+	}
+	go c.Watch(ctx)
+
+	f.set(1, nil)
+	select {
+	case v := <-rotated:
+		t.Fatalf("rotated to %q without a new version", v)
+	case <-time.After(30 * time.Millisecond):
+	}
+	f.set(2, nil)
+	select {
+	case v := <-rotated:
+		if v != "xoxb-2" {
+			t.Errorf("rotated to %q, want xoxb-2", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Watch did not notice the rotation")
+	}
+}
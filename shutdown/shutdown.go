@@ -0,0 +1,192 @@
+// Package shutdown runs a service's cleanup hooks, in order and within one
+// deadline, when the platform stops it with SIGTERM (or on Ctrl-C locally),
+// and logs how each hook went.
+//
+// Quick start:
+//
+//	sm := shutdown.New(shutdown.WithLogger(lg), shutdown.WithTimeout(9*time.Second))
+//	sm.Register("http", shutdown.HTTPServer(srv))
+//	sm.Register("pubsub", func(ctx context.Context) error { return pub.Close() })
+//	sm.Register("logger", func(ctx context.Context) error { return lg.Close() })
+//
+//	go func() {
+//	    if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+//	        log.Fatal(err)
+//	    }
+//	}()
+//	if err := sm.Wait(context.Background()); err != nil {
+//	    log.Printf("shutdown: %v", err)
+//	}
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+type Options struct {
+	Timeout time.Duration
+	Signals []os.Signal
+	Logger  *logger.CloudLogger
+}
+
+type Option func(*Options)
+
+// WithTimeout bounds all hooks together; defaults to 10s, Cloud Run's grace
+// period between SIGTERM and SIGKILL. Leave headroom for the hooks' logs.
+func WithTimeout(d time.Duration) Option { return func(o *Options) { o.Timeout = d } }
+
+// WithSignals replaces the signals Wait listens for; defaults to SIGTERM
+// and SIGINT.
+func WithSignals(sigs ...os.Signal) Option { return func(o *Options) { o.Signals = sigs } }
+
+// WithLogger logs the signal and each hook's outcome and duration through
+// lg. A hook that closes lg should be registered last.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// Hook releases one resource; it should return once ctx is done.
+type Hook func(ctx context.Context) error
+
+// Manager holds the shutdown hooks. It is safe for concurrent use.
+type Manager struct {
+	opts Options
+
+	mu    sync.Mutex
+	hooks []namedHook
+	once  sync.Once
+	err   error
+}
+
+type namedHook struct {
+	name string
+	fn   Hook
+}
+
+// New returns a Manager without hooks.
+func New(opts ...Option) *Manager {
+	options := Options{
+		Timeout: 10 * time.Second,
+		Signals: []os.Signal{syscall.SIGTERM, os.Interrupt},
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Manager{opts: options}
+}
+
+// Register appends a hook; hooks run in registration order, so register
+// intake (HTTP servers, subscribers) before what it feeds (publishers,
+// buffers) and the logger last.
+func (m *Manager) Register(name string, fn Hook) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, namedHook{name: name, fn: fn})
+}
+
+// Wait blocks until one of the signals arrives or ctx is done, then runs
+// Shutdown and returns its error.
+func (m *Manager) Wait(ctx context.Context) error {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, m.opts.Signals...)
+	defer signal.Stop(sig)
+	reason := "context done"
+	select {
+	case s := <-sig:
+		reason = s.String()
+	case <-ctx.Done():
+	}
+	if lg := m.opts.Logger; lg != nil {
+		m.mu.Lock()
+		n := len(m.hooks)
+		m.mu.Unlock()
+		lg.Info(context.Background(), nil, "shutting down", map[string]any{"reason": reason, "hooks": n, "timeout": m.opts.Timeout.String()})
+	}
+	return m.Shutdown(context.Background())
+}
+
+// Shutdown runs the hooks in order, once, sharing the timeout and ctx's
+// deadline. A failing hook does not stop the ones after it; hooks not
+// reached before the deadline are skipped. It returns the hooks' errors
+// joined; later calls return the same result.
+func (m *Manager) Shutdown(ctx context.Context) error {
+	m.once.Do(func() {
+		m.mu.Lock()
+		hooks := append([]namedHook(nil), m.hooks...)
+		m.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+		defer cancel()
+		var errs []error
+		for i, h := range hooks {
+			if ctx.Err() != nil {
+				for _, skipped := range hooks[i:] {
+					errs = append(errs, fmt.Errorf("%s: skipped: %w", skipped.name, ctx.Err()))
+					m.log(ctx, skipped.name, 0, ctx.Err(), true)
+				}
+				break
+			}
+			start := time.Now()
+			err := runHook(ctx, h.fn)
+			m.log(ctx, h.name, time.Since(start), err, false)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", h.name, err))
+			}
+		}
+		m.err = errors.Join(errs...)
+	})
+	return m.err
+}
+
+// runHook turns a hook's panic into an error so the later hooks still run.
+func runHook(ctx context.Context, fn Hook) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn(ctx)
+}
+
+func (m *Manager) log(ctx context.Context, name string, took time.Duration, err error, skipped bool) {
+	lg := m.opts.Logger
+	if lg == nil {
+		return
+	}
+	// the shutdown deadline must not stop the log entry itself
+	ctx = context.WithoutCancel(ctx)
+	data := map[string]any{"hook": name, "durationMs": took.Milliseconds()}
+	switch {
+	case skipped:
+		data["error"] = err.Error()
+		lg.Error(ctx, nil, "shutdown hook skipped", data)
+	case err != nil:
+		data["error"] = err.Error()
+		lg.Error(ctx, nil, "shutdown hook failed", data)
+	default:
+		lg.Info(ctx, nil, "shutdown hook done", data)
+	}
+}
+
+// HTTPServer returns a hook that stops srv accepting connections and waits
+// for requests in flight.
+func HTTPServer(srv *http.Server) Hook {
+	return func(ctx context.Context) error { return srv.Shutdown(ctx) }
+}
+
+// Cancel returns a hook that cancels a context, e.g. the one a Pub/Sub
+// subscriber receives with, stopping intake.
+func Cancel(cancel context.CancelFunc) Hook {
+	return func(context.Context) error {
+		cancel()
+		return nil
+	}
+}
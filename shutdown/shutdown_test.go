@@ -0,0 +1,125 @@
+package shutdown_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/shutdown"
+)
+
+var errClose = errors.New("close failed")
+
+func TestShutdown(t *testing.T) {
+	type hook struct {
+		name  string
+		err   error
+		panic bool
+		block bool // until ctx is done
+	}
+	tests := []struct {
+		name     string
+		hooks    []hook
+		wantRan  string
+		wantErrs []string
+	}{
+		{"in order", []hook{{name: "http"}, {name: "pubsub"}, {name: "logger"}}, "http,pubsub,logger", nil},
+		{"failure does not stop the rest", []hook{{name: "http", err: errClose}, {name: "logger"}}, "http,logger", []string{"http: close failed"}},
+		{"panic does not stop the rest", []hook{{name: "http", panic: true}, {name: "logger"}}, "http,logger", []string{"http: panic: boom"}},
+		{"hooks after the deadline skipped", []hook{{name: "http", block: true}, {name: "pubsub"}, {name: "logger"}}, "http",
+			[]string{"http: context deadline exceeded", "pubsub: skipped: context deadline exceeded", "logger: skipped"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := shutdown.New(shutdown.WithTimeout(20 * time.Millisecond))
+			var ran []string
+			for _, h := range tt.hooks {
+				h := h
+				m.Register(h.name, func(ctx context.Context) error {
+					ran = append(ran, h.name)
+					if h.panic {
+						panic("boom")
+					}
+					if h.block {
+						<-ctx.Done()
+						return ctx.Err()
+					}
+					return h.err
+				})
+			}
+			err := m.Shutdown(context.Background())
+			if got := strings.Join(ran, ","); got != tt.wantRan {
+				t.Errorf("ran %s, want %s", got, tt.wantRan)
+			}
+			if tt.wantErrs == nil && err != nil {
+				t.Fatalf("Shutdown = %v, want nil", err)
+			}
+			for _, want := range tt.wantErrs {
+				if err == nil || !strings.Contains(err.Error(), want) {
+					t.Errorf("Shutdown = %v, want it to contain %q", err, want)
+				}
+			}
+			if again := m.Shutdown(context.Background()); again != err || strings.Join(ran, ",") != tt.wantRan {
+				t.Error("a second Shutdown ran the hooks again")
+			}
+		})
+	}
+}
+
+func TestWait(t *testing.T) {
+	t.Run("context done", func(t *testing.T) {
+		m := shutdown.New()
+		ran := false
+		m.Register("flush", func(context.Context) error { ran = true; return nil })
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if err := m.Wait(ctx); err != nil || !ran {
+			t.Errorf("Wait = %v, ran %v", err, ran)
+		}
+	})
+	t.Run("signal", func(t *testing.T) {
+		m := shutdown.New(shutdown.WithSignals(syscall.SIGUSR1))
+		done := make(chan error)
+		go func() { done <- m.Wait(context.Background()) }()
+		time.Sleep(20 * time.Millisecond) // let Wait subscribe
+		if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Errorf("Wait = %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("Wait did not return on the signal")
+		}
+	})
+}
+
+func TestHTTPServerHook(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	defer srv.Close()
+	m := shutdown.New()
+	m.Register("http", shutdown.HTTPServer(srv.Config))
+	if err := m.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(srv.URL); err == nil {
+		t.Error("server still accepting requests")
+	}
+}
+
+func TestCancelHook(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	m := shutdown.New()
+	m.Register("subscriber", shutdown.Cancel(cancel))
+	_ = m.Shutdown(context.Background())
+	if ctx.Err() == nil {
+		t.Error("context not cancelled")
+	}
+}
@@ -0,0 +1,249 @@
+// Package storage wraps Google Cloud Storage for the artwork and PDF
+// artifacts print services move around: streaming uploads and downloads,
+// resumable uploads with progress callbacks, V4 signed URLs and configurable
+// retries.
+//
+// Quick start:
+//
+//	st, err := storage.NewClient(ctx, storage.WithLogger(lg)) // lg is a *logger.CloudLogger
+//	if err != nil { return err }
+//	defer st.Close()
+//
+//	attrs, err := st.Upload(ctx, "artwork", "orders/42/front.pdf", file,
+//	    storage.WithContentType("application/pdf"),
+//	    storage.WithProgress(func(n int64) { log.Printf("%d bytes sent", n) }),
+//	)
+//
+//	url, err := st.SignedURL("artwork", "orders/42/front.pdf", http.MethodGet, 15*time.Minute)
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"github.com/googleapis/gax-go/v2"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+// ErrNotExist is returned, wrapped, for objects that do not exist.
+var ErrNotExist = gcs.ErrObjectNotExist
+
+type Options struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	RetryPolicy    gcs.RetryPolicy
+	ChunkSize      int
+	Logger         *logger.CloudLogger
+	Client         *gcs.Client
+}
+
+type Option func(*Options)
+
+// WithRetry sets how often an operation is attempted in total and the
+// backoff between attempts, which doubles from initial up to max with
+// jitter. Defaults to 5 attempts, 1s to 30s.
+func WithRetry(maxAttempts int, initial, max time.Duration) Option {
+	return func(o *Options) { o.MaxAttempts, o.InitialBackoff, o.MaxBackoff = maxAttempts, initial, max }
+}
+
+// WithRetryPolicy sets which operations are retried. The default,
+// gcs.RetryIdempotent, retries reads and uploads with a precondition such
+// as IfNotExists; gcs.RetryAlways also retries unconditional overwrites,
+// which is safe when every writer of an object writes the same content.
+func WithRetryPolicy(p gcs.RetryPolicy) Option { return func(o *Options) { o.RetryPolicy = p } }
+
+// WithChunkSize sets the default chunk size of resumable uploads; each
+// chunk is buffered in memory and retried on its own. Defaults to 16 MiB;
+// 0 uploads in a single request, without resumption or progress.
+func WithChunkSize(n int) Option { return func(o *Options) { o.ChunkSize = n } }
+
+// WithLogger logs failed uploads and downloads through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithClient uses an existing client instead of creating one; Close then
+// leaves the client open.
+func WithClient(c *gcs.Client) Option { return func(o *Options) { o.Client = c } }
+
+// Client reads and writes objects.
+type Client struct {
+	opts       Options
+	client     *gcs.Client
+	ownsClient bool
+}
+
+// NewClient returns a Client using Application Default Credentials.
+func NewClient(ctx context.Context, opts ...Option) (*Client, error) {
+	options := Options{
+		MaxAttempts:    5,
+		InitialBackoff: time.Second,
+		MaxBackoff:     30 * time.Second,
+		RetryPolicy:    gcs.RetryIdempotent,
+		ChunkSize:      16 << 20,
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	if options.MaxAttempts < 1 {
+		options.MaxAttempts = 1
+	}
+
+	c := &Client{opts: options, client: options.Client}
+	if c.client == nil {
+		client, err := gcs.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("storage: new client: %w", err)
+		}
+		c.client, c.ownsClient = client, true
+	}
+	return c, nil
+}
+
+// Close releases the client unless it was passed with WithClient.
+func (c *Client) Close() error {
+	if c.ownsClient {
+		return c.client.Close()
+	}
+	return nil
+}
+
+// GCS returns the underlying client, for operations this package does not
+// cover.
+func (c *Client) GCS() *gcs.Client { return c.client }
+
+// object returns the handle of bucket/name with the client's retry policy.
+func (c *Client) object(bucket, name string) *gcs.ObjectHandle {
+	return c.client.Bucket(bucket).Object(name).Retryer(
+		gcs.WithBackoff(gax.Backoff{Initial: c.opts.InitialBackoff, Max: c.opts.MaxBackoff, Multiplier: 2}),
+		gcs.WithMaxAttempts(c.opts.MaxAttempts),
+		gcs.WithPolicy(c.opts.RetryPolicy),
+	)
+}
+
+// uploadOptions are the per-object settings of Upload.
+type uploadOptions struct {
+	contentType  string
+	cacheControl string
+	metadata     map[string]string
+	progress     func(int64)
+	chunkSize    *int
+	ifNotExists  bool
+}
+
+type UploadOption func(*uploadOptions)
+
+// WithContentType sets the object's content type; by default it is sniffed
+// from the first 512 bytes.
+func WithContentType(ct string) UploadOption {
+	return func(o *uploadOptions) { o.contentType = ct }
+}
+
+// WithCacheControl sets the object's Cache-Control, e.g. "no-store" for
+// proofs that are regenerated in place.
+func WithCacheControl(cc string) UploadOption {
+	return func(o *uploadOptions) { o.cacheControl = cc }
+}
+
+// WithMetadata sets custom metadata on the object.
+func WithMetadata(md map[string]string) UploadOption {
+	return func(o *uploadOptions) { o.metadata = md }
+}
+
+// WithProgress calls f with the total bytes uploaded after each chunk of a
+// resumable upload. f must return quickly.
+func WithProgress(f func(uploaded int64)) UploadOption {
+	return func(o *uploadOptions) { o.progress = f }
+}
+
+// WithUploadChunkSize overrides the client's chunk size for one upload.
+func WithUploadChunkSize(n int) UploadOption {
+	return func(o *uploadOptions) { o.chunkSize = &n }
+}
+
+// IfNotExists fails the upload if the object exists, which also makes it
+// idempotent and so retried under the default policy.
+func IfNotExists() UploadOption {
+	return func(o *uploadOptions) { o.ifNotExists = true }
+}
+
+// Upload streams r to bucket/object and returns the object's attributes.
+// Uploads are resumable in chunks unless the chunk size is 0.
+func (c *Client) Upload(ctx context.Context, bucket, object string, r io.Reader, opts ...UploadOption) (*gcs.ObjectAttrs, error) {
+	uo := uploadOptions{}
+	for _, f := range opts {
+		f(&uo)
+	}
+	o := c.object(bucket, object)
+	if uo.ifNotExists {
+		o = o.If(gcs.Conditions{DoesNotExist: true})
+	}
+	wctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	w := o.NewWriter(wctx)
+	w.ContentType = uo.contentType
+	w.CacheControl = uo.cacheControl
+	w.Metadata = uo.metadata
+	w.ProgressFunc = uo.progress
+	w.ChunkSize = c.opts.ChunkSize
+	if uo.chunkSize != nil {
+		w.ChunkSize = *uo.chunkSize
+	}
+
+	n, err := io.Copy(w, r)
+	if err != nil {
+		// cancel before closing, which would otherwise commit what was written so far
+		cancel()
+		w.Close()
+		c.logFailure(ctx, "upload", bucket, object, n, err)
+		return nil, fmt.Errorf("storage: upload gs://%s/%s: %w", bucket, object, err)
+	}
+	if err := w.Close(); err != nil {
+		c.logFailure(ctx, "upload", bucket, object, n, err)
+		return nil, fmt.Errorf("storage: upload gs://%s/%s: %w", bucket, object, err)
+	}
+	return w.Attrs(), nil
+}
+
+// Open returns a reader streaming bucket/object; the caller must close it.
+// Reads resume where they left off after transient failures.
+func (c *Client) Open(ctx context.Context, bucket, object string) (*gcs.Reader, error) {
+	r, err := c.object(bucket, object).NewReader(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("storage: open gs://%s/%s: %w", bucket, object, err)
+	}
+	return r, nil
+}
+
+// Download streams bucket/object into w and returns the bytes written.
+func (c *Client) Download(ctx context.Context, bucket, object string, w io.Writer) (int64, error) {
+	r, err := c.Open(ctx, bucket, object)
+	if err != nil {
+		if !errors.Is(err, ErrNotExist) {
+			c.logFailure(ctx, "download", bucket, object, 0, err)
+		}
+		return 0, err
+	}
+	defer r.Close()
+	n, err := io.Copy(w, r)
+	if err != nil {
+		c.logFailure(ctx, "download", bucket, object, n, err)
+		return n, fmt.Errorf("storage: download gs://%s/%s: %w", bucket, object, err)
+	}
+	return n, nil
+}
+
+func (c *Client) logFailure(ctx context.Context, op, bucket, object string, bytes int64, err error) {
+	if c.opts.Logger == nil {
+		return
+	}
+	c.opts.Logger.Error(ctx, nil, "storage "+op+" failed", map[string]any{
+		"bucket": bucket,
+		"object": object,
+		"bytes":  bytes,
+		"error":  err.Error(),
+	})
+}
@@ -0,0 +1,327 @@
+package storage_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	gcs "cloud.google.com/go/storage"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/storage"
+)
+
+// fakeGCS stores objects in memory and serves the JSON upload and XML
+// download APIs the client uses.
+type fakeGCS struct {
+	mu       sync.Mutex
+	objects  map[string][]byte // by "bucket/object"
+	meta     map[string]map[string]any
+	sessions map[string]*bytes.Buffer // resumable uploads by id
+	failures int                      // downloads to fail with 503 first
+}
+
+func newFakeGCS() *fakeGCS {
+	return &fakeGCS{objects: map[string][]byte{}, meta: map[string]map[string]any{}, sessions: map[string]*bytes.Buffer{}}
+}
+
+func (f *fakeGCS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	bucket, _, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/upload/storage/v1/b/"), "/")
+	switch {
+	case r.URL.Query().Get("upload_id") != "":
+		id := r.URL.Query().Get("upload_id")
+		buf := f.sessions[id]
+		_, _ = io.Copy(buf, r.Body)
+		// "bytes 0-262143/*" until the last chunk gives the total; the
+		// client asks for "incomplete" as a header rather than a 308
+		if strings.HasSuffix(r.Header.Get("Content-Range"), "/*") {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", buf.Len()-1))
+			w.Header().Set("X-Http-Status-Code-Override", "308")
+			return
+		}
+		f.create(w, r, bucket, f.meta["session "+id], buf.Bytes())
+	case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "multipart":
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		mr := multipart.NewReader(r.Body, params["boundary"])
+		var meta map[string]any
+		part, _ := mr.NextPart()
+		_ = json.NewDecoder(part).Decode(&meta)
+		part, _ = mr.NextPart()
+		data, _ := io.ReadAll(part)
+		if _, ok := meta["contentType"]; !ok {
+			meta["contentType"] = part.Header.Get("Content-Type")
+		}
+		f.create(w, r, bucket, meta, data)
+	case r.Method == http.MethodPost && r.URL.Query().Get("uploadType") == "resumable":
+		var meta map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&meta)
+		if _, ok := meta["contentType"]; !ok {
+			meta["contentType"] = r.Header.Get("X-Upload-Content-Type")
+		}
+		id := strconv.Itoa(len(f.sessions))
+		f.sessions[id] = &bytes.Buffer{}
+		f.meta["session "+id] = meta
+		q := r.URL.Query()
+		q.Set("upload_id", id)
+		w.Header().Set("Location", "http://"+r.Host+r.URL.Path+"?"+q.Encode())
+		w.WriteHeader(http.StatusOK)
+	case r.Method == http.MethodGet:
+		if f.failures > 0 {
+			f.failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		data, ok := f.objects[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.Header().Set("X-Goog-Generation", "1")
+		_, _ = w.Write(data)
+	default:
+		w.WriteHeader(http.StatusNotImplemented)
+	}
+}
+
+// create stores an object, honouring ifGenerationMatch=0, and answers with
+// its attributes.
+func (f *fakeGCS) create(w http.ResponseWriter, r *http.Request, bucket string, meta map[string]any, data []byte) {
+	name, _ := meta["name"].(string)
+	key := bucket + "/" + name
+	if _, exists := f.objects[key]; exists && r.URL.Query().Get("ifGenerationMatch") == "0" {
+		w.WriteHeader(http.StatusPreconditionFailed)
+		_, _ = w.Write([]byte(`{"error":{"code":412,"message":"conditionNotMet"}}`))
+		return
+	}
+	f.objects[key] = data
+	meta["bucket"], meta["size"], meta["generation"] = bucket, strconv.Itoa(len(data)), "1"
+	f.meta[key] = meta
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(meta)
+}
+
+func (f *fakeGCS) object(key string) ([]byte, map[string]any) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.objects[key], f.meta[key]
+}
+
+// client returns a Client backed by an in-process fakeGCS.
+func client(t *testing.T, f *fakeGCS, opts ...storage.Option) *storage.Client {
+	t.Helper()
+	srv := httptest.NewServer(f)
+	t.Cleanup(srv.Close)
+	gc, err := gcs.NewClient(context.Background(), option.WithEndpoint(srv.URL+"/storage/v1/"), option.WithoutAuthentication())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { gc.Close() })
+	c, err := storage.NewClient(context.Background(), append([]storage.Option{
+		storage.WithClient(gc),
+		storage.WithRetry(3, time.Millisecond, time.Millisecond),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestUpload(t *testing.T) {
+	pdf := append([]byte("%PDF-1.7\n"), bytes.Repeat([]byte("x"), 600<<10)...)
+	tests := []struct {
+		name            string
+		data            []byte
+		opts            []storage.UploadOption
+		wantContentType string
+		wantCache       string
+		wantProgress    bool
+	}{
+		{"single request", []byte("hello"), []storage.UploadOption{storage.WithUploadChunkSize(0)}, "text/plain; charset=utf-8", "", false},
+		{"content type and metadata", []byte("hello"), []storage.UploadOption{
+			storage.WithUploadChunkSize(0), storage.WithContentType("application/pdf"),
+			storage.WithCacheControl("no-store"), storage.WithMetadata(map[string]string{"order": "42"}),
+		}, "application/pdf", "no-store", false},
+		{"resumable in chunks", pdf, []storage.UploadOption{storage.WithUploadChunkSize(256 << 10)}, "application/pdf", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGCS()
+			c := client(t, f)
+			var progress []int64
+			opts := append(tt.opts, storage.WithProgress(func(n int64) { progress = append(progress, n) }))
+			attrs, err := c.Upload(context.Background(), "artwork", "orders/42/front.pdf", bytes.NewReader(tt.data), opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if attrs.Bucket != "artwork" || attrs.Name != "orders/42/front.pdf" || attrs.Size != int64(len(tt.data)) {
+				t.Errorf("attrs = %+v", attrs)
+			}
+			data, meta := f.object("artwork/orders/42/front.pdf")
+			if !bytes.Equal(data, tt.data) {
+				t.Errorf("stored %d bytes, want %d", len(data), len(tt.data))
+			}
+			if meta["contentType"] != tt.wantContentType {
+				t.Errorf("content type = %v, want %s", meta["contentType"], tt.wantContentType)
+			}
+			if cc, _ := meta["cacheControl"].(string); cc != tt.wantCache {
+				t.Errorf("cache control = %q, want %q", cc, tt.wantCache)
+			}
+			if (len(progress) > 1) != tt.wantProgress {
+				t.Errorf("progress = %v", progress)
+			}
+		})
+	}
+}
+
+func TestUploadIfNotExists(t *testing.T) {
+	c := client(t, newFakeGCS())
+	ctx := context.Background()
+	for i, want := range []bool{false, true} {
+		_, err := c.Upload(ctx, "artwork", "orders/42/front.pdf", strings.NewReader("proof"), storage.IfNotExists(), storage.WithUploadChunkSize(0))
+		if (err != nil) != want {
+			t.Errorf("upload %d = %v, want error %v", i+1, err, want)
+		}
+	}
+}
+
+func TestUploadReadError(t *testing.T) {
+	f := newFakeGCS()
+	c := client(t, f)
+	r := io.MultiReader(strings.NewReader("partial"), failingReader{})
+	if _, err := c.Upload(context.Background(), "artwork", "orders/42/front.pdf", r, storage.WithUploadChunkSize(0)); err == nil {
+		t.Fatal("Upload succeeded with a failing reader")
+	}
+	if data, _ := f.object("artwork/orders/42/front.pdf"); data != nil {
+		t.Errorf("partial object %q committed", data)
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) { return 0, errors.New("disk read failed") }
+
+func TestDownload(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		object    string
+		want      string
+		wantNotEx bool
+	}{
+		{"ok", 0, "orders/42/front.pdf", "%PDF-1.7", false},
+		{"retried after 503", 2, "orders/42/front.pdf", "%PDF-1.7", false},
+		{"missing", 0, "orders/43/front.pdf", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFakeGCS()
+			f.objects["artwork/orders/42/front.pdf"] = []byte("%PDF-1.7")
+			f.failures = tt.failures
+			c := client(t, f)
+			var buf bytes.Buffer
+			n, err := c.Download(context.Background(), "artwork", tt.object, &buf)
+			if errors.Is(err, storage.ErrNotExist) != tt.wantNotEx || (!tt.wantNotEx && err != nil) {
+				t.Fatalf("Download = %v, want not exist %v", err, tt.wantNotEx)
+			}
+			if buf.String() != tt.want || n != int64(len(tt.want)) {
+				t.Errorf("downloaded %d bytes %q, want %q", n, buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+// serviceAccountJSON returns a service account key that signs offline.
+func serviceAccountJSON(t *testing.T) []byte {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(map[string]string{
+		"type":         "service_account",
+		"project_id":   "my-proj",
+		"client_email": "artwork@my-proj.iam.gserviceaccount.com",
+		"private_key":  string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		"token_uri":    "https://oauth2.googleapis.com/token",
+	})
+	return b
+}
+
+func TestSignedURL(t *testing.T) {
+	gc, err := gcs.NewClient(context.Background(), option.WithCredentialsJSON(serviceAccountJSON(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer gc.Close()
+	c, err := storage.NewClient(context.Background(), storage.WithClient(gc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name        string
+		method      string
+		opts        []storage.SignOption
+		wantHeaders string
+		wantQuery   map[string]string
+	}{
+		{"get", http.MethodGet, nil, "host", nil},
+		{"put with content type", http.MethodPut, []storage.SignOption{storage.WithSignedContentType("application/pdf")}, "content-type;host", nil},
+		{"signed headers", http.MethodPut, []storage.SignOption{storage.WithSignedHeaders("x-goog-if-generation-match:0")}, "host;x-goog-if-generation-match", nil},
+		{"signed query", http.MethodGet, []storage.SignOption{storage.WithSignedQuery(url.Values{"response-content-disposition": {"attachment"}})}, "host",
+			map[string]string{"response-content-disposition": "attachment"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			raw, err := c.SignedURL("artwork", "orders/42/front.pdf", tt.method, 15*time.Minute, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, err := url.Parse(raw)
+			if err != nil {
+				t.Fatal(err)
+			}
+			q := u.Query()
+			if !strings.HasSuffix(u.Path, "/artwork/orders/42/front.pdf") || q.Get("X-Goog-Algorithm") != "GOOG4-RSA-SHA256" || (q.Get("X-Goog-Expires") != "900" && q.Get("X-Goog-Expires") != "899") {
+				t.Errorf("url = %s", raw)
+			}
+			if !strings.HasPrefix(q.Get("X-Goog-Credential"), "artwork@my-proj.iam.gserviceaccount.com/") {
+				t.Errorf("credential = %s", q.Get("X-Goog-Credential"))
+			}
+			if got := q.Get("X-Goog-SignedHeaders"); got != tt.wantHeaders {
+				t.Errorf("signed headers = %s, want %s", got, tt.wantHeaders)
+			}
+			for k, v := range tt.wantQuery {
+				if q.Get(k) != v {
+					t.Errorf("query %s = %q, want %q", k, q.Get(k), v)
+				}
+			}
+		})
+	}
+	if _, err := c.SignedURL("artwork", "orders/42/front.pdf", http.MethodGet, 8*24*time.Hour); err == nil {
+		t.Error("SignedURL accepted an expiry over 7 days")
+	}
+}
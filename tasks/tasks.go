@@ -0,0 +1,273 @@
+// Package tasks enqueues Cloud Tasks HTTP tasks the same way everywhere:
+// JSON payloads, OIDC-authenticated calls to Cloud Run or Cloud Functions,
+// deduplicated task names and schedule times for delayed work such as
+// escalations, retries and job polling.
+//
+// Quick start:
+//
+//	q, err := tasks.NewQueue(ctx, "", "us-central1", "print-jobs",
+//	    tasks.WithServiceAccount("tasks-invoker@my-proj.iam.gserviceaccount.com"),
+//	    tasks.WithBaseURL("https://poller-abc123-uc.a.run.app"),
+//	)
+//	if err != nil { return err }
+//	defer q.Close()
+//
+//	_, err = q.Enqueue(ctx, "/poll", PollJob{ID: job.ID},
+//	    tasks.After(30*time.Second),
+//	    tasks.Dedupe("poll-"+job.ID+"-"+strconv.Itoa(attempt)),
+//	)
+//	if errors.Is(err, tasks.ErrDuplicate) { err = nil } // already enqueued
+package tasks
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
+	"cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// ErrDuplicate is returned, wrapped, when a task with the same name exists
+// or existed recently; with Dedupe this means the work is already queued.
+var ErrDuplicate = errors.New("tasks: duplicate task")
+
+type Options struct {
+	ServiceAccount string
+	Audience       string
+	BaseURL        string
+	Headers        map[string]string
+	Logger         *logger.CloudLogger
+	Client         *cloudtasks.Client
+}
+
+type Option func(*Options)
+
+// WithServiceAccount attaches an OIDC token for the service account email
+// to every task, as Cloud Run and authenticated functions require. The
+// caller needs iam.serviceAccounts.actAs on it.
+func WithServiceAccount(email string) Option { return func(o *Options) { o.ServiceAccount = email } }
+
+// WithAudience sets the OIDC token audience; it defaults to the task URL
+// without its query, as Cloud Run expects.
+func WithAudience(aud string) Option { return func(o *Options) { o.Audience = aud } }
+
+// WithBaseURL resolves relative task URLs, such as "/poll", against base.
+func WithBaseURL(base string) Option { return func(o *Options) { o.BaseURL = base } }
+
+// WithHeaders sets headers on every task.
+func WithHeaders(h map[string]string) Option { return func(o *Options) { o.Headers = h } }
+
+// WithLogger logs failed enqueues through lg.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithClient uses an existing client instead of creating one; Close then
+// leaves the client open.
+func WithClient(c *cloudtasks.Client) Option { return func(o *Options) { o.Client = c } }
+
+// Queue enqueues tasks on one queue.
+type Queue struct {
+	opts       Options
+	name       string
+	client     *cloudtasks.Client
+	ownsClient bool
+}
+
+// NewQueue returns the queue queueID in projectID and location; an empty
+// projectID is read from GOOGLE_CLOUD_PROJECT.
+func NewQueue(ctx context.Context, projectID, location, queueID string, opts ...Option) (*Queue, error) {
+	var options Options
+	for _, f := range opts {
+		f(&options)
+	}
+	if projectID == "" {
+		projectID = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if projectID == "" || location == "" || queueID == "" {
+		return nil, errors.New("tasks: project, location and queue are required")
+	}
+
+	q := &Queue{
+		opts:   options,
+		name:   fmt.Sprintf("projects/%s/locations/%s/queues/%s", projectID, location, queueID),
+		client: options.Client,
+	}
+	if q.client == nil {
+		client, err := cloudtasks.NewClient(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("tasks: new client: %w", err)
+		}
+		q.client, q.ownsClient = client, true
+	}
+	return q, nil
+}
+
+// Close releases the client unless it was passed with WithClient.
+func (q *Queue) Close() error {
+	if q.ownsClient {
+		return q.client.Close()
+	}
+	return nil
+}
+
+// Name returns the queue's resource name.
+func (q *Queue) Name() string { return q.name }
+
+// taskOptions are the per-task settings of Enqueue.
+type taskOptions struct {
+	id               string
+	scheduleTime     time.Time
+	method           cloudtaskspb.HttpMethod
+	headers          map[string]string
+	dispatchDeadline time.Duration
+}
+
+type TaskOption func(*taskOptions)
+
+// WithTaskID names the task id, which must be at most 500 letters, digits,
+// hyphens and underscores. Cloud Tasks rejects a name used by a task in the
+// queue or completed in the last hour (up to 9 days after it was deleted).
+// Prefer Dedupe for names derived from arbitrary keys.
+func WithTaskID(id string) TaskOption { return func(o *taskOptions) { o.id = id } }
+
+// Dedupe names the task after a hash of key, so enqueueing the same key
+// twice, e.g. from a redelivered message, creates one task and returns
+// ErrDuplicate for the other.
+func Dedupe(key string) TaskOption {
+	sum := sha256.Sum256([]byte(key))
+	return WithTaskID(hex.EncodeToString(sum[:]))
+}
+
+// At schedules the task for t.
+func At(t time.Time) TaskOption { return func(o *taskOptions) { o.scheduleTime = t } }
+
+// After schedules the task d from now.
+func After(d time.Duration) TaskOption {
+	return func(o *taskOptions) { o.scheduleTime = time.Now().Add(d) }
+}
+
+// Backoff schedules the retry number attempt (1-based) of some work after
+// base doubled per earlier attempt, capped at max, e.g. to poll a print job
+// less often the longer it runs.
+func Backoff(attempt int, base, max time.Duration) TaskOption {
+	d := base
+	for i := 1; i < attempt && d < max; i++ {
+		d *= 2
+	}
+	return After(min(d, max))
+}
+
+// WithMethod sets the HTTP method; defaults to POST.
+func WithMethod(method string) TaskOption {
+	return func(o *taskOptions) {
+		if m, ok := cloudtaskspb.HttpMethod_value[strings.ToUpper(method)]; ok {
+			o.method = cloudtaskspb.HttpMethod(m)
+		}
+	}
+}
+
+// WithTaskHeaders sets headers on this task, over the queue's.
+func WithTaskHeaders(h map[string]string) TaskOption { return func(o *taskOptions) { o.headers = h } }
+
+// WithDispatchDeadline sets how long Cloud Tasks waits for the handler
+// before retrying the task (15s to 30m; default 10m).
+func WithDispatchDeadline(d time.Duration) TaskOption {
+	return func(o *taskOptions) { o.dispatchDeadline = d }
+}
+
+// Enqueue creates an HTTP task calling target, absolute or relative to the
+// base URL, with payload as the body: []byte as is, anything else encoded
+// as JSON, and nil for no body.
+func (q *Queue) Enqueue(ctx context.Context, target string, payload any, opts ...TaskOption) (*cloudtaskspb.Task, error) {
+	to := taskOptions{method: cloudtaskspb.HttpMethod_POST}
+	for _, f := range opts {
+		f(&to)
+	}
+	u, err := q.resolve(target)
+	if err != nil {
+		return nil, err
+	}
+	headers := map[string]string{}
+	for k, v := range q.opts.Headers {
+		headers[k] = v
+	}
+	for k, v := range to.headers {
+		headers[k] = v
+	}
+	var body []byte
+	switch p := payload.(type) {
+	case nil:
+	case []byte:
+		body = p
+	default:
+		if body, err = json.Marshal(p); err != nil {
+			return nil, fmt.Errorf("tasks: encode payload: %w", err)
+		}
+		if _, ok := headers["Content-Type"]; !ok {
+			headers["Content-Type"] = "application/json"
+		}
+	}
+
+	req := &cloudtaskspb.HttpRequest{Url: u, HttpMethod: to.method, Headers: headers, Body: body}
+	if q.opts.ServiceAccount != "" {
+		aud := q.opts.Audience
+		if aud == "" {
+			aud = strings.SplitN(u, "?", 2)[0]
+		}
+		req.AuthorizationHeader = &cloudtaskspb.HttpRequest_OidcToken{
+			OidcToken: &cloudtaskspb.OidcToken{ServiceAccountEmail: q.opts.ServiceAccount, Audience: aud},
+		}
+	}
+	task := &cloudtaskspb.Task{MessageType: &cloudtaskspb.Task_HttpRequest{HttpRequest: req}}
+	if to.id != "" {
+		task.Name = q.name + "/tasks/" + to.id
+	}
+	if !to.scheduleTime.IsZero() {
+		task.ScheduleTime = timestamppb.New(to.scheduleTime)
+	}
+	if to.dispatchDeadline > 0 {
+		task.DispatchDeadline = durationpb.New(to.dispatchDeadline)
+	}
+
+	created, err := q.client.CreateTask(ctx, &cloudtaskspb.CreateTaskRequest{Parent: q.name, Task: task})
+	if status.Code(err) == codes.AlreadyExists {
+		return nil, fmt.Errorf("%w: %s: %w", ErrDuplicate, task.Name, err)
+	}
+	if err != nil {
+		if q.opts.Logger != nil {
+			q.opts.Logger.Error(ctx, nil, "cloud tasks enqueue failed", map[string]any{"queue": q.name, "url": u, "task": task.Name, "error": err.Error()})
+		}
+		return nil, fmt.Errorf("tasks: enqueue to %s: %w", q.name, err)
+	}
+	return created, nil
+}
+
+func (q *Queue) resolve(target string) (string, error) {
+	t, err := url.Parse(target)
+	if err != nil {
+		return "", fmt.Errorf("tasks: target %q: %w", target, err)
+	}
+	if t.IsAbs() {
+		return target, nil
+	}
+	if q.opts.BaseURL == "" {
+		return "", fmt.Errorf("tasks: relative target %q needs WithBaseURL", target)
+	}
+	base, err := url.Parse(q.opts.BaseURL)
+	if err != nil {
+		return "", fmt.Errorf("tasks: base URL %q: %w", q.opts.BaseURL, err)
+	}
+	return base.ResolveReference(t).String(), nil
+}
@@ -0,0 +1,234 @@
+package tasks_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	cloudtasks "cloud.google.com/go/cloudtasks/apiv2"
+	"cloud.google.com/go/cloudtasks/apiv2/cloudtaskspb"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+
+	"github.com/print-engine/ieos-golang-utils/tasks"
+)
+
+const queueName = "projects/my-proj/locations/us-central1/queues/print-jobs"
+
+// fakeTasks records created tasks and rejects names it has seen.
+type fakeTasks struct {
+	cloudtaskspb.UnimplementedCloudTasksServer
+
+	mu    sync.Mutex
+	names map[string]bool
+	last  *cloudtaskspb.CreateTaskRequest
+}
+
+func (f *fakeTasks) CreateTask(_ context.Context, req *cloudtaskspb.CreateTaskRequest) (*cloudtaskspb.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.last = req
+	if name := req.GetTask().GetName(); name != "" {
+		if f.names[name] {
+			return nil, status.Error(codes.AlreadyExists, "task exists")
+		}
+		f.names[name] = true
+	}
+	return req.GetTask(), nil
+}
+
+// queue returns a Queue backed by an in-process fakeTasks.
+func queue(t *testing.T, opts ...tasks.Option) (*tasks.Queue, *fakeTasks) {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeTasks{names: map[string]bool{}}
+	srv := grpc.NewServer()
+	cloudtaskspb.RegisterCloudTasksServer(srv, fake)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	ctx := context.Background()
+	client, err := cloudtasks.NewClient(ctx,
+		option.WithEndpoint(lis.Addr().String()),
+		option.WithoutAuthentication(),
+		option.WithGRPCDialOption(grpc.WithTransportCredentials(insecure.NewCredentials())),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	q, err := tasks.NewQueue(ctx, "my-proj", "us-central1", "print-jobs", append(opts, tasks.WithClient(client))...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return q, fake
+}
+
+func TestNewQueue(t *testing.T) {
+	t.Setenv("GOOGLE_CLOUD_PROJECT", "")
+	if _, err := tasks.NewQueue(context.Background(), "", "us-central1", "print-jobs"); err == nil {
+		t.Error("NewQueue accepted an empty project")
+	}
+	q, _ := queue(t)
+	if q.Name() != queueName {
+		t.Errorf("Name = %s", q.Name())
+	}
+}
+
+type pollJob struct {
+	ID string `json:"id"`
+}
+
+func TestEnqueue(t *testing.T) {
+	tests := []struct {
+		name        string
+		queueOpts   []tasks.Option
+		target      string
+		payload     any
+		opts        []tasks.TaskOption
+		wantURL     string
+		wantMethod  cloudtaskspb.HttpMethod
+		wantBody    string
+		wantHeaders map[string]string
+		wantAud     string
+		wantErr     bool
+	}{
+		{
+			name: "json payload", target: "https://poller.example.com/poll", payload: pollJob{ID: "job-42"},
+			wantURL: "https://poller.example.com/poll", wantMethod: cloudtaskspb.HttpMethod_POST, wantBody: `{"id":"job-42"}`,
+			wantHeaders: map[string]string{"Content-Type": "application/json"},
+		},
+		{
+			name: "bytes passed through", target: "https://poller.example.com/poll", payload: []byte("raw"),
+			wantURL: "https://poller.example.com/poll", wantMethod: cloudtaskspb.HttpMethod_POST, wantBody: "raw",
+			wantHeaders: map[string]string{},
+		},
+		{
+			name: "relative target and method", queueOpts: []tasks.Option{tasks.WithBaseURL("https://poller.example.com/v1/")},
+			target: "poll?job=42", opts: []tasks.TaskOption{tasks.WithMethod("get")},
+			wantURL: "https://poller.example.com/v1/poll?job=42", wantMethod: cloudtaskspb.HttpMethod_GET,
+			wantHeaders: map[string]string{},
+		},
+		{
+			name: "relative target without a base URL", target: "/poll", wantErr: true,
+		},
+		{
+			name:      "task headers over queue headers",
+			queueOpts: []tasks.Option{tasks.WithHeaders(map[string]string{"X-Source": "queue", "X-Tenant": "acme"})},
+			target:    "https://poller.example.com/poll", payload: pollJob{ID: "job-42"},
+			opts:    []tasks.TaskOption{tasks.WithTaskHeaders(map[string]string{"X-Source": "task", "Content-Type": "text/plain"})},
+			wantURL: "https://poller.example.com/poll", wantMethod: cloudtaskspb.HttpMethod_POST, wantBody: `{"id":"job-42"}`,
+			wantHeaders: map[string]string{"X-Source": "task", "X-Tenant": "acme", "Content-Type": "text/plain"},
+		},
+		{
+			name: "oidc audience from the url", queueOpts: []tasks.Option{tasks.WithServiceAccount("tasks@my-proj.iam.gserviceaccount.com")},
+			target: "https://poller.example.com/poll?job=42", wantURL: "https://poller.example.com/poll?job=42",
+			wantMethod: cloudtaskspb.HttpMethod_POST, wantHeaders: map[string]string{}, wantAud: "https://poller.example.com/poll",
+		},
+		{
+			name: "oidc audience set", queueOpts: []tasks.Option{
+				tasks.WithServiceAccount("tasks@my-proj.iam.gserviceaccount.com"), tasks.WithAudience("https://poller.example.com"),
+			},
+			target: "https://poller.example.com/poll", wantURL: "https://poller.example.com/poll",
+			wantMethod: cloudtaskspb.HttpMethod_POST, wantHeaders: map[string]string{}, wantAud: "https://poller.example.com",
+		},
+		{
+			name: "unencodable payload", target: "https://poller.example.com/poll", payload: make(chan int), wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, fake := queue(t, tt.queueOpts...)
+			_, err := q.Enqueue(context.Background(), tt.target, tt.payload, tt.opts...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Enqueue = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if fake.last != nil {
+					t.Error("task created despite the error")
+				}
+				return
+			}
+			if fake.last.GetParent() != queueName {
+				t.Errorf("parent = %s", fake.last.GetParent())
+			}
+			req := fake.last.GetTask().GetHttpRequest()
+			if req.GetUrl() != tt.wantURL || req.GetHttpMethod() != tt.wantMethod || string(req.GetBody()) != tt.wantBody {
+				t.Errorf("request = %s %s %q", req.GetHttpMethod(), req.GetUrl(), req.GetBody())
+			}
+			if len(req.GetHeaders()) != len(tt.wantHeaders) {
+				t.Errorf("headers = %v, want %v", req.GetHeaders(), tt.wantHeaders)
+			}
+			for k, v := range tt.wantHeaders {
+				if req.GetHeaders()[k] != v {
+					t.Errorf("header %s = %q, want %q", k, req.GetHeaders()[k], v)
+				}
+			}
+			if got := req.GetOidcToken().GetAudience(); got != tt.wantAud {
+				t.Errorf("audience = %q, want %q", got, tt.wantAud)
+			}
+		})
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	t0 := time.Date(2026, 10, 15, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		opt  tasks.TaskOption
+		want time.Duration // from now, or from t0 for At
+		at   bool
+	}{
+		{"at", tasks.At(t0), 0, true},
+		{"after", tasks.After(30 * time.Second), 30 * time.Second, false},
+		{"first backoff", tasks.Backoff(1, 30*time.Second, 10*time.Minute), 30 * time.Second, false},
+		{"third backoff", tasks.Backoff(3, 30*time.Second, 10*time.Minute), 2 * time.Minute, false},
+		{"backoff capped", tasks.Backoff(20, 30*time.Second, 10*time.Minute), 10 * time.Minute, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, fake := queue(t)
+			now := time.Now()
+			if _, err := q.Enqueue(context.Background(), "https://poller.example.com/poll", nil, tt.opt); err != nil {
+				t.Fatal(err)
+			}
+			got := fake.last.GetTask().GetScheduleTime().AsTime()
+			want := now.Add(tt.want)
+			if tt.at {
+				want = t0
+			}
+			if d := got.Sub(want); d < 0 || d > time.Second {
+				t.Errorf("schedule time = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestDedupe(t *testing.T) {
+	q, fake := queue(t)
+	ctx := context.Background()
+	opts := []tasks.TaskOption{tasks.Dedupe("poll-job-42-1"), tasks.WithDispatchDeadline(time.Minute)}
+	if _, err := q.Enqueue(ctx, "https://poller.example.com/poll", nil, opts...); err != nil {
+		t.Fatal(err)
+	}
+	task := fake.last.GetTask()
+	if len(task.GetName()) != len(queueName+"/tasks/")+64 || task.GetDispatchDeadline().AsDuration() != time.Minute {
+		t.Errorf("task = %s, deadline %s", task.GetName(), task.GetDispatchDeadline().AsDuration())
+	}
+	_, err := q.Enqueue(ctx, "https://poller.example.com/poll", nil, opts...)
+	if !errors.Is(err, tasks.ErrDuplicate) {
+		t.Errorf("second Enqueue = %v, want ErrDuplicate", err)
+	}
+	if _, err := q.Enqueue(ctx, "https://poller.example.com/poll", nil, tasks.Dedupe("poll-job-42-2")); err != nil {
+		t.Errorf("another key = %v", err)
+	}
+}
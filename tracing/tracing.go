@@ -0,0 +1,140 @@
+// Package tracing sets up OpenTelemetry tracing exported to Cloud Trace,
+// with the service's Google Cloud resource detected and W3C trace context
+// propagated. Loggers from the logger package tag entries with the span
+// in their context, so logs and traces link up in the console.
+//
+// Quick start:
+//
+//	shutdown, err := tracing.Setup(ctx, "render-api", 0.1) // sample 10% of new traces
+//	if err != nil { return err }
+//	defer shutdown(context.Background())
+//
+//	ctx, span := tracing.Start(ctx, "render")
+//	defer span.End()
+//	lg.Info(ctx, r, "rendering") // carries the span's trace and span IDs
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
+	"go.opentelemetry.io/contrib/detectors/gcp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/api/option"
+
+	"github.com/print-engine/ieos-golang-utils/internal/gcpenv"
+	"github.com/print-engine/ieos-golang-utils/logger"
+)
+
+type Options struct {
+	ProjectID     string
+	Version       string
+	Logger        *logger.CloudLogger
+	ClientOptions []option.ClientOption
+	ForceNoExport bool
+}
+
+type Option func(*Options)
+
+// WithProjectID sets the project traces are exported to; by default it is
+// detected like the logger's.
+func WithProjectID(id string) Option { return func(o *Options) { o.ProjectID = id } }
+
+// WithVersion sets service.version, K_REVISION by default.
+func WithVersion(v string) Option { return func(o *Options) { o.Version = v } }
+
+// WithLogger logs export errors; without it they go to the standard
+// logger.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithClientOptions passes options to the Cloud Trace client.
+func WithClientOptions(opts ...option.ClientOption) Option {
+	return func(o *Options) { o.ClientOptions = append(o.ClientOptions, opts...) }
+}
+
+// WithoutExport creates and propagates spans without exporting them, for
+// local runs and tests. It is implied when no project can be detected.
+func WithoutExport() Option { return func(o *Options) { o.ForceNoExport = true } }
+
+// Setup installs the global tracer provider and propagator. New traces are
+// sampled at sampleRate, between 0 and 1; requests arriving with a trace
+// context follow their caller's decision, so a trace is never half
+// recorded. The returned shutdown flushes buffered spans and must be
+// called before the process exits.
+func Setup(ctx context.Context, service string, sampleRate float64, opts ...Option) (shutdown func(context.Context) error, err error) {
+	options := Options{Version: os.Getenv("K_REVISION")}
+	for _, f := range opts {
+		f(&options)
+	}
+	if sampleRate < 0 || sampleRate > 1 {
+		return nil, fmt.Errorf("tracing: sample rate %v not in [0, 1]", sampleRate)
+	}
+	if options.ProjectID == "" && !options.ForceNoExport {
+		id, err := gcpenv.ProjectID(ctx)
+		if err != nil {
+			options.ForceNoExport = true
+		} else {
+			options.ProjectID = id
+		}
+	}
+
+	attrs := []resource.Option{
+		resource.WithDetectors(gcp.NewDetector()),
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(semconv.ServiceName(service)),
+	}
+	if options.Version != "" {
+		attrs = append(attrs, resource.WithAttributes(semconv.ServiceVersion(options.Version)))
+	}
+	res, err := resource.New(ctx, attrs...)
+	if err != nil && !errors.Is(err, resource.ErrPartialResource) {
+		return nil, fmt.Errorf("tracing: detect resource: %w", err)
+	}
+
+	tpOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(sampleRate))),
+	}
+	if !options.ForceNoExport {
+		exp, err := texporter.New(
+			texporter.WithProjectID(options.ProjectID),
+			texporter.WithTraceClientOptions(options.ClientOptions),
+			texporter.WithErrorHandler(errorHandler{options.Logger}),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("tracing: new exporter: %w", err)
+		}
+		tpOpts = append(tpOpts, sdktrace.WithBatcher(exp))
+	}
+	tp := sdktrace.NewTracerProvider(tpOpts...)
+
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	otel.SetErrorHandler(errorHandler{options.Logger})
+	return tp.Shutdown, nil
+}
+
+// Start starts a span from the global tracer provider; end it with
+// span.End().
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer("github.com/print-engine/ieos-golang-utils/tracing").Start(ctx, name, opts...)
+}
+
+type errorHandler struct{ lg *logger.CloudLogger }
+
+func (h errorHandler) Handle(err error) {
+	if h.lg == nil {
+		log.Printf("tracing: %v", err)
+		return
+	}
+	h.lg.Warning(context.Background(), nil, "tracing error", map[string]any{"error": err.Error()})
+}
@@ -0,0 +1,84 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/print-engine/ieos-golang-utils/tracing"
+)
+
+func TestSetupRejectsSampleRate(t *testing.T) {
+	for _, rate := range []float64{-0.1, 1.5} {
+		if _, err := tracing.Setup(context.Background(), "render-api", rate, tracing.WithoutExport()); err == nil {
+			t.Errorf("Setup accepted sample rate %v", rate)
+		}
+	}
+}
+
+func TestSampling(t *testing.T) {
+	// a caller's traceparent, sampled or not
+	const (
+		sampledParent   = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		unsampledParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00"
+	)
+	tests := []struct {
+		name        string
+		rate        float64
+		traceparent string
+		wantSampled bool
+	}{
+		{"new trace, rate 1", 1, "", true},
+		{"new trace, rate 0", 0, "", false},
+		{"sampled caller, rate 0", 0, sampledParent, true},
+		{"unsampled caller, rate 1", 1, unsampledParent, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := tracing.Setup(context.Background(), "render-api", tt.rate, tracing.WithoutExport(), tracing.WithVersion("render-api-00042"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer shutdown(context.Background())
+
+			ctx := context.Background()
+			if tt.traceparent != "" {
+				ctx = otel.GetTextMapPropagator().Extract(ctx, propagation.HeaderCarrier{"Traceparent": {tt.traceparent}})
+			}
+			ctx, span := tracing.Start(ctx, "render")
+			defer span.End()
+			sc := span.SpanContext()
+			if sc.IsSampled() != tt.wantSampled || !sc.IsValid() {
+				t.Errorf("span context = %+v, want sampled %v", sc, tt.wantSampled)
+			}
+			if tt.traceparent != "" && sc.TraceID().String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+				t.Errorf("trace ID = %s, want the caller's", sc.TraceID())
+			}
+
+			// the span's context is propagated to outgoing requests
+			h := http.Header{}
+			otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(h))
+			if got := h.Get("Traceparent"); !strings.Contains(got, sc.TraceID().String()+"-"+sc.SpanID().String()) {
+				t.Errorf("traceparent = %q", got)
+			}
+		})
+	}
+}
+
+func TestShutdownStopsRecording(t *testing.T) {
+	shutdown, err := tracing.Setup(context.Background(), "render-api", 1, tracing.WithoutExport())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	_, span := tracing.Start(context.Background(), "render")
+	if span.IsRecording() {
+		t.Error("span recorded after shutdown")
+	}
+}
@@ -0,0 +1,206 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+var builtin = map[string]Rule{
+	"min":     bound("min"),
+	"max":     bound("max"),
+	"len":     bound("len"),
+	"oneof":   oneOf,
+	"email":   String(isEmail, "must be a valid email address"),
+	"url":     String(isURL, "must be a valid http or https URL"),
+	"uuid":    String(uuidRE.MatchString, "must be a valid UUID"),
+	"isbn":    String(isISBN, "must be a valid ISBN-10 or ISBN-13"),
+	"country": String(isCountry, "must be an ISO 3166-1 alpha-2 country code"),
+}
+
+// String returns a Rule for string fields that fails with msg when check
+// returns false.
+func String(check func(s string) bool, msg string) Rule {
+	return func(v reflect.Value, _ string) error {
+		if v.Kind() != reflect.String {
+			return fmt.Errorf("must be a string")
+		}
+		if !check(v.String()) {
+			return errors.New(msg)
+		}
+		return nil
+	}
+}
+
+// All returns a Rule that passes when every rule passes, failing with the
+// first failure.
+func All(rules ...Rule) Rule {
+	return func(v reflect.Value, param string) error {
+		for _, r := range rules {
+			if err := r(v, param); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Any returns a Rule that passes when one of rules passes; otherwise it
+// fails with msg.
+func Any(msg string, rules ...Rule) Rule {
+	return func(v reflect.Value, param string) error {
+		for _, r := range rules {
+			if r(v, param) == nil {
+				return nil
+			}
+		}
+		return errors.New(msg)
+	}
+}
+
+// bound checks numbers by value and strings, slices and maps by length.
+func bound(kind string) Rule {
+	return func(v reflect.Value, param string) error {
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("validate: %s=%q is not a number", kind, param))
+		}
+		var (
+			n    float64
+			unit string
+		)
+		switch v.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			n = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			n = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			n = v.Float()
+		case reflect.String:
+			n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+		case reflect.Slice, reflect.Array, reflect.Map:
+			n, unit = float64(v.Len()), " items"
+		default:
+			return fmt.Errorf("cannot be checked with %s", kind)
+		}
+		switch {
+		case kind == "min" && n < limit:
+			if unit == "" {
+				return fmt.Errorf("must be at least %s", param)
+			}
+			return fmt.Errorf("must have at least %s%s", param, unit)
+		case kind == "max" && n > limit:
+			if unit == "" {
+				return fmt.Errorf("must be at most %s", param)
+			}
+			return fmt.Errorf("must have at most %s%s", param, unit)
+		case kind == "len" && n != limit:
+			if unit == "" {
+				return fmt.Errorf("must be %s", param)
+			}
+			return fmt.Errorf("must have exactly %s%s", param, unit)
+		}
+		return nil
+	}
+}
+
+// oneOf takes space-separated choices: `validate:"oneof=a4 letter"`.
+func oneOf(v reflect.Value, param string) error {
+	s := fmt.Sprint(v.Interface())
+	choices := strings.Fields(param)
+	for _, c := range choices {
+		if s == c {
+			return nil
+		}
+	}
+	return fmt.Errorf("must be one of: %s", strings.Join(choices, ", "))
+}
+
+var uuidRE = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func isEmail(s string) bool {
+	a, err := mail.ParseAddress(s)
+	return err == nil && a.Address == s && a.Name == ""
+}
+
+func isURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// isISBN checks the length and check digit of an ISBN-10 or ISBN-13,
+// ignoring hyphens and spaces.
+func isISBN(s string) bool {
+	s = strings.NewReplacer("-", "", " ", "").Replace(s)
+	switch len(s) {
+	case 10:
+		sum := 0
+		for i := 0; i < 10; i++ {
+			c := s[i]
+			var d int
+			switch {
+			case c >= '0' && c <= '9':
+				d = int(c - '0')
+			case i == 9 && (c == 'X' || c == 'x'):
+				d = 10
+			default:
+				return false
+			}
+			sum += d * (10 - i)
+		}
+		return sum%11 == 0
+	case 13:
+		sum := 0
+		for i := 0; i < 13; i++ {
+			c := s[i]
+			if c < '0' || c > '9' {
+				return false
+			}
+			d := int(c - '0')
+			if i%2 == 1 {
+				d *= 3
+			}
+			sum += d
+		}
+		return sum%10 == 0
+	}
+	return false
+}
+
+func isCountry(s string) bool {
+	return len(s) == 2 && strings.Contains(countries, " "+s+" ")
+}
+
+// countries lists the ISO 3166-1 alpha-2 codes, space-separated.
+const countries = " " +
+	"AD AE AF AG AI AL AM AO AQ AR AS AT AU AW AX AZ " +
+	"BA BB BD BE BF BG BH BI BJ BL BM BN BO BQ BR BS BT BV BW BY BZ " +
+	"CA CC CD CF CG CH CI CK CL CM CN CO CR CU CV CW CX CY CZ " +
+	"DE DJ DK DM DO DZ " +
+	"EC EE EG EH ER ES ET " +
+	"FI FJ FK FM FO FR " +
+	"GA GB GD GE GF GG GH GI GL GM GN GP GQ GR GS GT GU GW GY " +
+	"HK HM HN HR HT HU " +
+	"ID IE IL IM IN IO IQ IR IS IT " +
+	"JE JM JO JP " +
+	"KE KG KH KI KM KN KP KR KW KY KZ " +
+	"LA LB LC LI LK LR LS LT LU LV LY " +
+	"MA MC MD ME MF MG MH MK ML MM MN MO MP MQ MR MS MT MU MV MW MX MY MZ " +
+	"NA NC NE NF NG NI NL NO NP NR NU NZ " +
+	"OM " +
+	"PA PE PF PG PH PK PL PM PN PR PS PT PW PY " +
+	"QA " +
+	"RE RO RS RU RW " +
+	"SA SB SC SD SE SG SH SI SJ SK SL SM SN SO SR SS ST SV SX SY SZ " +
+	"TC TD TF TG TH TJ TK TL TM TN TO TR TT TV TW TZ " +
+	"UA UG UM US UY UZ " +
+	"VA VC VE VG VI VN VU " +
+	"WF WS " +
+	"YE YT " +
+	"ZA ZM ZW "
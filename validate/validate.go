@@ -0,0 +1,308 @@
+// Package validate checks structs against their `validate` tags, runs
+// their own Validate methods, and collects every failure into Errors, a
+// list of field errors that serializes cleanly into API responses.
+//
+// Quick start:
+//
+//	type Order struct {
+//	    Email   string `json:"email" validate:"required,email"`
+//	    Country string `json:"country" validate:"required,country"`
+//	    ISBN    string `json:"isbn,omitempty" validate:"omitempty,isbn"`
+//	    Copies  int    `json:"copies" validate:"min=1,max=500"`
+//	    Items   []Item `json:"items" validate:"required,max=50"` // Items are checked too
+//	}
+//
+//	if err := validate.Struct(order); err != nil {
+//	    validate.WriteHTTP(w, err) // 400 {"error":{"code":"invalid_argument",...,"fields":[...]}}
+//	    return
+//	}
+package validate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+)
+
+// ErrInvalid is in the chain of every Errors, so errs.CodeOf classifies
+// them as InvalidArgument.
+var ErrInvalid = errs.New(errs.InvalidArgument, "validation failed")
+
+// FieldError is one failed check. Field is the path to the field, using
+// JSON names: "items[2].sku".
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// Errors lists every failed check of a value.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	parts := make([]string, len(e))
+	for i, fe := range e {
+		if fe.Field == "" {
+			parts[i] = fe.Message
+			continue
+		}
+		parts[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func (e Errors) Unwrap() error { return ErrInvalid }
+
+// StructValidator is implemented by structs with checks beyond their tags,
+// such as rules spanning fields. Validate runs after the tags are checked;
+// Errors it returns are merged with their paths under the struct's.
+type StructValidator interface {
+	Validate() error
+}
+
+// Rule checks one field value; param is the text after "=" in the tag. It
+// returns an error whose text is the message for callers, such as "must
+// be a valid SKU". Pointers are dereferenced before rules run, and nil
+// pointers skip all rules but required.
+type Rule func(v reflect.Value, param string) error
+
+type Options struct {
+	Rules map[string]Rule
+}
+
+type Option func(*Options)
+
+// WithRule adds or replaces the rule used for name in tags.
+func WithRule(name string, r Rule) Option {
+	return func(o *Options) { o.Rules[name] = r }
+}
+
+// Validator checks values against their tags. It is safe for concurrent
+// use.
+type Validator struct {
+	rules map[string]Rule
+}
+
+// New returns a Validator with the built-in rules plus those added by
+// options.
+func New(opts ...Option) *Validator {
+	options := Options{Rules: map[string]Rule{}}
+	for name, r := range builtin {
+		options.Rules[name] = r
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	return &Validator{rules: options.Rules}
+}
+
+var std = New()
+
+// Struct checks s with the built-in rules; see Validator.Struct.
+func Struct(s any) error { return std.Struct(s) }
+
+// Var checks a single value against tag with the built-in rules; see
+// Validator.Var.
+func Var(v any, tag string) error { return std.Var(v, tag) }
+
+// Struct checks s, a struct or pointer to one, and the structs it contains
+// through fields, pointers and slices. It returns Errors, or nil if s is
+// valid. A tag naming an unknown rule panics, so typos fail in tests
+// rather than pass silently.
+func (v *Validator) Struct(s any) error {
+	rv := reflect.ValueOf(s)
+	for rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("validate: Struct of %T", s))
+	}
+	var out Errors
+	v.walk(rv, "", &out)
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+// Var checks a single value against tag, such as "required,email",
+// returning Errors with an empty Field, or nil.
+func (v *Validator) Var(val any, tag string) error {
+	var out Errors
+	v.check(reflect.ValueOf(val), "", tag, &out)
+	if len(out) == 0 {
+		return nil
+	}
+	return out
+}
+
+func (v *Validator) walk(rv reflect.Value, path string, out *Errors) {
+	t := rv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("validate")
+		if tag == "-" {
+			continue
+		}
+		fv := rv.Field(i)
+		p := path
+		if !f.Anonymous || tag != "" {
+			p = join(path, fieldName(f))
+		}
+		if tag != "" {
+			v.check(fv, p, tag, out)
+		}
+		v.descend(fv, p, out)
+	}
+	v.structValidate(rv, path, out)
+}
+
+// descend walks the structs inside fv.
+func (v *Validator) descend(fv reflect.Value, path string, out *Errors) {
+	for fv.Kind() == reflect.Pointer || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return
+		}
+		fv = fv.Elem()
+	}
+	switch fv.Kind() {
+	case reflect.Struct:
+		v.walk(fv, path, out)
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < fv.Len(); i++ {
+			v.descend(fv.Index(i), fmt.Sprintf("%s[%d]", path, i), out)
+		}
+	}
+}
+
+func (v *Validator) structValidate(rv reflect.Value, path string, out *Errors) {
+	var sv StructValidator
+	switch {
+	case rv.CanAddr() && rv.Addr().Type().Implements(reflect.TypeOf((*StructValidator)(nil)).Elem()):
+		sv = rv.Addr().Interface().(StructValidator)
+	case rv.CanInterface():
+		sv, _ = rv.Interface().(StructValidator)
+	}
+	if sv == nil {
+		return
+	}
+	err := sv.Validate()
+	if err == nil {
+		return
+	}
+	var fe Errors
+	if errors.As(err, &fe) {
+		for _, e := range fe {
+			e.Field = join(path, e.Field)
+			*out = append(*out, e)
+		}
+		return
+	}
+	*out = append(*out, FieldError{Field: path, Rule: "validate", Message: err.Error()})
+}
+
+func (v *Validator) check(fv reflect.Value, path, tag string, out *Errors) {
+	for _, part := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if isZero(fv) {
+				return
+			}
+			continue
+		case "required":
+			if isZero(fv) {
+				*out = append(*out, FieldError{Field: path, Rule: name, Message: "is required"})
+				return
+			}
+			continue
+		}
+		r, ok := v.rules[name]
+		if !ok {
+			panic(fmt.Sprintf("validate: unknown rule %q on %s", name, path))
+		}
+		val := fv
+		for val.Kind() == reflect.Pointer || val.Kind() == reflect.Interface {
+			if val.IsNil() {
+				return
+			}
+			val = val.Elem()
+		}
+		if err := r(val, param); err != nil {
+			*out = append(*out, FieldError{Field: path, Rule: name, Param: param, Message: err.Error()})
+		}
+	}
+}
+
+func isZero(v reflect.Value) bool {
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	}
+	return v.IsZero()
+}
+
+func fieldName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return f.Name
+	}
+	return name
+}
+
+func join(path, name string) string {
+	switch {
+	case path == "":
+		return name
+	case name == "":
+		return path
+	case strings.HasPrefix(name, "["):
+		return path + name
+	}
+	return path + "." + name
+}
+
+// WriteHTTP answers 400 for Errors, with the same body as errs.WriteHTTP
+// plus the field errors:
+//
+//	{"error": {"code": "invalid_argument", "message": "validation failed",
+//	           "fields": [{"field": "email", "rule": "email", "message": "must be a valid email address"}]}}
+//
+// Other errors are passed to errs.WriteHTTP.
+func WriteHTTP(w http.ResponseWriter, err error) {
+	var fe Errors
+	if !errors.As(err, &fe) {
+		errs.WriteHTTP(w, err)
+		return
+	}
+	var body struct {
+		Error struct {
+			Code    errs.Code `json:"code"`
+			Message string    `json:"message"`
+			Fields  Errors    `json:"fields"`
+		} `json:"error"`
+	}
+	body.Error.Code = errs.InvalidArgument
+	body.Error.Message = errs.Message(ErrInvalid)
+	body.Error.Fields = fe
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,216 @@
+package validate_test
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+	"github.com/print-engine/ieos-golang-utils/validate"
+)
+
+func TestVar(t *testing.T) {
+	two := 2
+	tests := []struct {
+		name     string
+		val      any
+		tag      string
+		wantRule string // "" for valid
+	}{
+		{"required empty", "", "required", "required"},
+		{"required blank", "  ", "required", "required"},
+		{"required nil slice", []int(nil), "required", "required"},
+		{"required zero int", 0, "required", "required"},
+		{"omitempty skips", "", "omitempty,email", ""},
+		{"email", "ops@example.com", "email", ""},
+		{"email with name", "Ops <ops@example.com>", "email", "email"},
+		{"url", "https://example.com/x", "url", ""},
+		{"url without scheme", "example.com", "url", "url"},
+		{"uuid", "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "uuid", ""},
+		{"isbn-10", "0-306-40615-2", "isbn", ""},
+		{"isbn-10 with X", "0-8044-2957-X", "isbn", ""},
+		{"isbn-13", "978-0-306-40615-7", "isbn", ""},
+		{"isbn bad check digit", "978-0-306-40615-8", "isbn", "isbn"},
+		{"country", "DE", "country", ""},
+		{"country lower case", "de", "country", "country"},
+		{"min int", 0, "min=1", "min"},
+		{"max int", 501, "max=500", "max"},
+		{"min string runes", "ää", "min=3", "min"},
+		{"len string runes", "äöü", "len=3", ""},
+		{"max slice", []int{1, 2, 3}, "max=2", "max"},
+		{"max float", 2.5, "max=2", "max"},
+		{"pointer dereferenced", &two, "min=3", "min"},
+		{"nil pointer skips rules", (*int)(nil), "min=3", ""},
+		{"oneof", "letter", "oneof=a4 letter", ""},
+		{"oneof miss", "a3", "oneof=a4 letter", "oneof"},
+		{"stops after required", "", "required,email", "required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Var(tt.val, tt.tag)
+			if tt.wantRule == "" {
+				if err != nil {
+					t.Fatalf("Var = %v, want nil", err)
+				}
+				return
+			}
+			var fe validate.Errors
+			if !errors.As(err, &fe) || len(fe) != 1 || fe[0].Rule != tt.wantRule {
+				t.Fatalf("Var = %#v, want one %q failure", err, tt.wantRule)
+			}
+		})
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for an unknown rule")
+		}
+	}()
+	_ = validate.Var("x", "emial")
+}
+
+type item struct {
+	SKU    string `json:"sku" validate:"required"`
+	Copies int    `json:"copies" validate:"min=1"`
+}
+
+type Address struct {
+	Country string `json:"country" validate:"required,country"`
+}
+
+type order struct {
+	Email    string   `json:"email" validate:"required,email"`
+	Items    []item   `json:"items" validate:"required,max=2"`
+	Ship     *Address `json:"ship"`
+	Internal string   `validate:"-"`
+	Address
+	Start, End int `json:"-"`
+}
+
+func (o order) Validate() error {
+	if o.End < o.Start {
+		return validate.Errors{{Field: "end", Rule: "after", Message: "must not be before start"}}
+	}
+	return nil
+}
+
+type batch struct {
+	Orders []order `json:"orders"`
+	Note   string  `json:"note"`
+}
+
+func (b *batch) Validate() error {
+	if b.Note == "forbidden" {
+		return errors.New("note is not allowed")
+	}
+	return nil
+}
+
+func TestStruct(t *testing.T) {
+	valid := order{Email: "ops@example.com", Items: []item{{SKU: "A", Copies: 1}}, Address: Address{Country: "DE"}}
+	tests := []struct {
+		name string
+		val  any
+		want []string // field:rule
+	}{
+		{"valid", valid, nil},
+		{"valid pointer", &valid, nil},
+		{"top-level fields", order{Email: "x", Address: Address{Country: "DE"}}, []string{"email:email", "items:required"}},
+		{"slice elements", order{Email: "ops@example.com", Items: []item{{SKU: "A", Copies: 1}, {Copies: 0}}, Address: Address{Country: "DE"}},
+			[]string{"items[1].sku:required", "items[1].copies:min"}},
+		{"pointer field", order{Email: "ops@example.com", Items: []item{{SKU: "A", Copies: 1}}, Ship: &Address{Country: "XX"}, Address: Address{Country: "DE"}},
+			[]string{"ship.country:country"}},
+		{"embedded struct flattened", order{Email: "ops@example.com", Items: []item{{SKU: "A", Copies: 1}}},
+			[]string{"country:required"}},
+		{"struct validator", order{Email: "ops@example.com", Items: []item{{SKU: "A", Copies: 1}}, Address: Address{Country: "DE"}, Start: 2, End: 1},
+			[]string{"end:after"}},
+		{"nested struct validator", &batch{Orders: []order{{Email: "ops@example.com", Items: []item{{SKU: "A", Copies: 1}}, Address: Address{Country: "DE"}, Start: 2}}},
+			[]string{"orders[0].end:after"}},
+		{"pointer receiver validator", &batch{Note: "forbidden"}, []string{":validate"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validate.Struct(tt.val)
+			var got []string
+			var fe validate.Errors
+			if errors.As(err, &fe) {
+				for _, e := range fe {
+					got = append(got, e.Field+":"+e.Rule)
+				}
+			} else if err != nil {
+				t.Fatalf("Struct = %v, want Errors", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("failures = %v, want %v", got, tt.want)
+			}
+			if err != nil && !errs.Is(err, errs.InvalidArgument) {
+				t.Errorf("code = %q, want invalid_argument", errs.CodeOf(err))
+			}
+		})
+	}
+}
+
+func TestCustomRules(t *testing.T) {
+	sku := validate.String(func(s string) bool { return strings.HasPrefix(s, "SKU-") }, "must be a valid SKU")
+	nonEmpty := validate.String(func(s string) bool { return s != "" }, "must not be empty")
+	v := validate.New(
+		validate.WithRule("sku", sku),
+		validate.WithRule("skuoremail", validate.Any("must be a SKU or email", sku, validate.String(func(s string) bool {
+			return validate.Var(s, "email") == nil
+		}, ""))),
+		validate.WithRule("strictsku", validate.All(nonEmpty, sku)),
+	)
+	tests := []struct {
+		val, tag, wantMsg string
+	}{
+		{"SKU-1", "sku", ""},
+		{"1", "sku", "must be a valid SKU"},
+		{"ops@example.com", "skuoremail", ""},
+		{"x", "skuoremail", "must be a SKU or email"},
+		{"", "strictsku", "must not be empty"},
+	}
+	for _, tt := range tests {
+		err := v.Var(tt.val, tt.tag)
+		var msg string
+		if err != nil {
+			msg = err.(validate.Errors)[0].Message
+		}
+		if msg != tt.wantMsg {
+			t.Errorf("Var(%q, %q) message = %q, want %q", tt.val, tt.tag, msg, tt.wantMsg)
+		}
+	}
+}
+
+func TestWriteHTTP(t *testing.T) {
+	w := httptest.NewRecorder()
+	validate.WriteHTTP(w, validate.Struct(order{Email: "x", Items: []item{{SKU: "A", Copies: 1}}, Address: Address{Country: "DE"}}))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want 400", w.Code)
+	}
+	var body struct {
+		Error struct {
+			Code    string                `json:"code"`
+			Message string                `json:"message"`
+			Fields  []validate.FieldError `json:"fields"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Error.Code != "invalid_argument" || body.Error.Message != "validation failed" ||
+		len(body.Error.Fields) != 1 || body.Error.Fields[0].Field != "email" {
+		t.Errorf("body = %+v", body.Error)
+	}
+
+	w = httptest.NewRecorder()
+	validate.WriteHTTP(w, errs.New(errs.NotFound, "print job 42 not found"))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status for other errors = %d, want errs.WriteHTTP's 404", w.Code)
+	}
+}
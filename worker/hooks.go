@@ -0,0 +1,28 @@
+package worker
+
+import (
+	"context"
+	"errors"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+	"github.com/print-engine/ieos-golang-utils/metrics"
+)
+
+// Metrics returns a Hook recording every job in m: the counter
+// worker/jobs, labeled by job and status ("ok", "panic" or the error's
+// errs code), and the distribution worker/job_latency_ms.
+func Metrics(m *metrics.Client) Hook {
+	jobs := m.Counter("worker/jobs")
+	latency := m.Distribution("worker/job_latency_ms", metrics.DefaultBuckets)
+	return func(_ context.Context, r Result) {
+		status := "ok"
+		switch {
+		case errors.Is(r.Err, ErrPanic):
+			status = "panic"
+		case r.Err != nil:
+			status = string(errs.CodeOf(r.Err))
+		}
+		jobs.Inc(metrics.Labels{"job": r.Name, "status": status})
+		latency.Record(float64(r.Duration.Milliseconds()), metrics.Labels{"job": r.Name})
+	}
+}
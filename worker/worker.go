@@ -0,0 +1,298 @@
+// Package worker runs background jobs on a bounded pool: each job gets a
+// timeout, retries per a retryx.Policy, and panic recovery, and Shutdown
+// drains queued and running jobs before the process exits.
+//
+// Quick start:
+//
+//	pool := worker.New(
+//	    worker.WithWorkers(8),
+//	    worker.WithTimeout(2*time.Minute),
+//	    worker.WithRetry(retryx.Policy{MaxAttempts: 3}),
+//	    worker.WithLogger(lg),
+//	    worker.WithHook(worker.Metrics(m)),
+//	)
+//	sm.Register("worker", pool.Shutdown) // drains on SIGTERM
+//
+//	err := pool.Submit(r.Context(), worker.Job{
+//	    Name: "post-process",
+//	    Run:  func(ctx context.Context) error { return postProcess(ctx, jobID) },
+//	})
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/errs"
+	"github.com/print-engine/ieos-golang-utils/logger"
+	"github.com/print-engine/ieos-golang-utils/retryx"
+)
+
+var (
+	// ErrClosed is returned by Submit after Shutdown has begun.
+	ErrClosed = errors.New("worker: pool closed")
+	// ErrQueueFull is returned by TrySubmit when the queue has no room.
+	ErrQueueFull = errors.New("worker: queue full")
+	// ErrPanic is in the chain of errors from jobs that panicked. Panics
+	// are not retried.
+	ErrPanic = errors.New("worker: job panicked")
+	// ErrTimeout is in the chain of errors from attempts that ran out of
+	// their timeout. Unlike other context errors, it is retried.
+	ErrTimeout = errs.New(errs.DeadlineExceeded, "job timed out")
+)
+
+// Job is a unit of background work.
+type Job struct {
+	// Name identifies the kind of job in logs and metrics, such as
+	// "slack-digest"; keep it low-cardinality.
+	Name string
+	Run  func(ctx context.Context) error
+	// Timeout bounds each attempt, overriding the pool's. Attempts that
+	// time out fail with ErrTimeout.
+	Timeout time.Duration
+	// Retry overrides the pool's retry policy.
+	Retry *retryx.Policy
+}
+
+// Result describes a finished job.
+type Result struct {
+	Name     string
+	Attempts int
+	Duration time.Duration
+	Err      error
+}
+
+// Hook is called after every job, from the worker that ran it.
+type Hook func(ctx context.Context, r Result)
+
+type Options struct {
+	Workers   int
+	QueueSize int
+	Timeout   time.Duration
+	Retry     retryx.Policy
+	Logger    *logger.CloudLogger
+	Hooks     []Hook
+}
+
+type Option func(*Options)
+
+// WithWorkers sets how many jobs run at once, 4 by default.
+func WithWorkers(n int) Option { return func(o *Options) { o.Workers = max(n, 1) } }
+
+// WithQueueSize sets how many jobs wait for a worker before Submit
+// blocks, 100 by default.
+func WithQueueSize(n int) Option { return func(o *Options) { o.QueueSize = max(n, 0) } }
+
+// WithTimeout bounds each attempt of a job, 5m by default; zero means no
+// limit.
+func WithTimeout(d time.Duration) Option { return func(o *Options) { o.Timeout = d } }
+
+// WithRetry sets the retry policy of jobs; by default they are not
+// retried.
+func WithRetry(p retryx.Policy) Option { return func(o *Options) { o.Retry = p } }
+
+// WithLogger logs failed jobs at error and retries at warning.
+func WithLogger(lg *logger.CloudLogger) Option { return func(o *Options) { o.Logger = lg } }
+
+// WithHook adds a hook called after every job, e.g. Metrics.
+func WithHook(h Hook) Option { return func(o *Options) { o.Hooks = append(o.Hooks, h) } }
+
+// Pool runs jobs on a fixed number of workers. It is safe for concurrent
+// use.
+type Pool struct {
+	opts  Options
+	queue chan queued
+
+	// ctx is canceled when Shutdown gives up waiting, to stop running
+	// jobs.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu      sync.RWMutex
+	closed  bool
+	workers sync.WaitGroup
+}
+
+type queued struct {
+	ctx context.Context
+	job Job
+}
+
+// New returns a Pool and starts its workers.
+func New(opts ...Option) *Pool {
+	options := Options{
+		Workers:   4,
+		QueueSize: 100,
+		Timeout:   5 * time.Minute,
+		Retry:     retryx.Policy{MaxAttempts: 1},
+	}
+	for _, f := range opts {
+		f(&options)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		opts:   options,
+		queue:  make(chan queued, options.QueueSize),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+	p.workers.Add(options.Workers)
+	for i := 0; i < options.Workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues job, blocking while the queue is full until ctx is done.
+// The job runs with ctx's values, such as its logger and trace, but not
+// its cancellation, so jobs submitted from a request outlive it.
+func (p *Pool) Submit(ctx context.Context, job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	select {
+	case p.queue <- queued{ctx: context.WithoutCancel(ctx), job: job}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySubmit queues job if there is room and returns ErrQueueFull
+// otherwise; see Submit.
+func (p *Pool) TrySubmit(ctx context.Context, job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return ErrClosed
+	}
+	select {
+	case p.queue <- queued{ctx: context.WithoutCancel(ctx), job: job}:
+		return nil
+	default:
+		return ErrQueueFull
+	}
+}
+
+// Shutdown stops accepting jobs and waits for queued and running ones to
+// finish. If ctx is done first, running jobs' contexts are canceled,
+// queued jobs are dropped, and Shutdown returns ctx's error once the
+// workers have returned. It has the signature of a shutdown.Hook.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		p.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		p.cancel()
+		return nil
+	case <-ctx.Done():
+		p.cancel()
+		<-done
+		return fmt.Errorf("worker: drain: %w", ctx.Err())
+	}
+}
+
+func (p *Pool) work() {
+	defer p.workers.Done()
+	for q := range p.queue {
+		if p.ctx.Err() != nil {
+			continue // draining gave up; drop the rest
+		}
+		p.run(q.ctx, q.job)
+	}
+}
+
+func (p *Pool) run(parent context.Context, job Job) {
+	ctx, cancel := context.WithCancel(parent)
+	defer cancel()
+	defer context.AfterFunc(p.ctx, cancel)()
+
+	policy := p.opts.Retry
+	if job.Retry != nil {
+		policy = *job.Retry
+	}
+	timeout := p.opts.Timeout
+	if job.Timeout > 0 {
+		timeout = job.Timeout
+	}
+	retryable := policy.Retryable
+	if retryable == nil {
+		retryable = retryx.DefaultRetryable
+	}
+	policy.Retryable = retryx.AnyOf(func(err error) bool { return errors.Is(err, ErrTimeout) }, retryable)
+	onRetry := policy.OnRetry
+	policy.OnRetry = func(attempt int, err error, delay time.Duration) {
+		p.logRetry(ctx, job, attempt, err, delay)
+		if onRetry != nil {
+			onRetry(attempt, err, delay)
+		}
+	}
+
+	start := time.Now()
+	attempts := 0
+	err := policy.Do(ctx, func(ctx context.Context) error {
+		attempts++
+		if timeout <= 0 {
+			return safeRun(ctx, job.Run)
+		}
+		actx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		err := safeRun(actx, job.Run)
+		if err != nil && ctx.Err() == nil && errors.Is(actx.Err(), context.DeadlineExceeded) {
+			// report the attempt's timeout as such, not as a context
+			// error retryx would give up on
+			return fmt.Errorf("%w after %s: %s", ErrTimeout, timeout, err)
+		}
+		return err
+	})
+	res := Result{Name: job.Name, Attempts: attempts, Duration: time.Since(start), Err: err}
+	if err != nil {
+		p.logFailure(ctx, res)
+	}
+	for _, h := range p.opts.Hooks {
+		h(ctx, res)
+	}
+}
+
+func safeRun(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = retryx.Permanent(fmt.Errorf("%w: %v\n%s", ErrPanic, v, debug.Stack()))
+		}
+	}()
+	return fn(ctx)
+}
+
+func (p *Pool) logRetry(ctx context.Context, job Job, attempt int, err error, delay time.Duration) {
+	if p.opts.Logger == nil {
+		return
+	}
+	p.opts.Logger.Warning(ctx, nil, "worker job failed, retrying", map[string]any{
+		"job": job.Name, "attempt": attempt, "delay": delay.String(), "error": err.Error(),
+	})
+}
+
+func (p *Pool) logFailure(ctx context.Context, res Result) {
+	if p.opts.Logger == nil {
+		return
+	}
+	p.opts.Logger.Err(ctx, nil, "worker job failed", res.Err, map[string]any{
+		"job": res.Name, "attempts": res.Attempts, "duration": res.Duration.String(),
+	})
+}
@@ -0,0 +1,232 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/print-engine/ieos-golang-utils/retryx"
+	"github.com/print-engine/ieos-golang-utils/worker"
+)
+
+// results collects the results of a pool's jobs.
+type results struct {
+	mu   sync.Mutex
+	list []worker.Result
+}
+
+func (r *results) hook(_ context.Context, res worker.Result) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.list = append(r.list, res)
+}
+
+func (r *results) all() []worker.Result {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]worker.Result(nil), r.list...)
+}
+
+var fast = retryx.Policy{MaxAttempts: 3, InitialDelay: time.Millisecond, MaxDelay: time.Millisecond}
+
+func TestJobs(t *testing.T) {
+	unavailable := &retryx.StatusError{StatusCode: 503, Status: "503 Service Unavailable"}
+	invalid := errors.New("invalid job")
+	tests := []struct {
+		name         string
+		run          func(attempt int) func(ctx context.Context) error
+		timeout      time.Duration
+		wantAttempts int
+		wantErr      error
+	}{
+		{
+			name:         "succeeds",
+			run:          func(int) func(context.Context) error { return func(context.Context) error { return nil } },
+			wantAttempts: 1,
+		},
+		{
+			name: "transient failure retried",
+			run: func(attempt int) func(context.Context) error {
+				return func(context.Context) error {
+					if attempt < 3 {
+						return unavailable
+					}
+					return nil
+				}
+			},
+			wantAttempts: 3,
+		},
+		{
+			name:         "transient failure out of attempts",
+			run:          func(int) func(context.Context) error { return func(context.Context) error { return unavailable } },
+			wantAttempts: 3,
+			wantErr:      unavailable,
+		},
+		{
+			name:         "permanent failure",
+			run:          func(int) func(context.Context) error { return func(context.Context) error { return invalid } },
+			wantAttempts: 1,
+			wantErr:      invalid,
+		},
+		{
+			name:         "panic is not retried",
+			run:          func(int) func(context.Context) error { return func(context.Context) error { panic("nil map") } },
+			wantAttempts: 1,
+			wantErr:      worker.ErrPanic,
+		},
+		{
+			name: "timeout retried",
+			run: func(attempt int) func(context.Context) error {
+				return func(ctx context.Context) error {
+					if attempt == 1 {
+						<-ctx.Done()
+						return ctx.Err()
+					}
+					return nil
+				}
+			},
+			timeout:      10 * time.Millisecond,
+			wantAttempts: 2,
+		},
+		{
+			name: "timeout out of attempts",
+			run: func(int) func(context.Context) error {
+				return func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				}
+			},
+			timeout:      5 * time.Millisecond,
+			wantAttempts: 3,
+			wantErr:      worker.ErrTimeout,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got results
+			p := worker.New(worker.WithRetry(fast), worker.WithHook(got.hook))
+			var attempts atomic.Int32
+			err := p.Submit(context.Background(), worker.Job{
+				Name:    "test",
+				Timeout: tt.timeout,
+				Run: func(ctx context.Context) error {
+					return tt.run(int(attempts.Add(1)))(ctx)
+				},
+			})
+			if err != nil {
+				t.Fatalf("Submit: %v", err)
+			}
+			if err := p.Shutdown(context.Background()); err != nil {
+				t.Fatalf("Shutdown: %v", err)
+			}
+			res := got.all()
+			if len(res) != 1 {
+				t.Fatalf("got %d results, want 1", len(res))
+			}
+			if res[0].Name != "test" || res[0].Attempts != tt.wantAttempts {
+				t.Errorf("result = %+v, want %d attempts", res[0], tt.wantAttempts)
+			}
+			if !errors.Is(res[0].Err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", res[0].Err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJobRetryOverride(t *testing.T) {
+	var got results
+	p := worker.New(worker.WithRetry(fast), worker.WithHook(got.hook))
+	once := retryx.Policy{MaxAttempts: 1}
+	_ = p.Submit(context.Background(), worker.Job{
+		Retry: &once,
+		Run:   func(context.Context) error { return &retryx.StatusError{StatusCode: 503} },
+	})
+	_ = p.Shutdown(context.Background())
+	if res := got.all(); len(res) != 1 || res[0].Attempts != 1 {
+		t.Errorf("results = %+v, want one attempt", res)
+	}
+}
+
+func TestSubmitOutlivesRequest(t *testing.T) {
+	var got results
+	p := worker.New(worker.WithHook(got.hook))
+	ctx, cancel := context.WithCancel(context.Background())
+	type key struct{}
+	ctx = context.WithValue(ctx, key{}, "trace-1")
+	var value any
+	_ = p.Submit(ctx, worker.Job{Run: func(ctx context.Context) error {
+		value = ctx.Value(key{})
+		return ctx.Err()
+	}})
+	cancel()
+	_ = p.Shutdown(context.Background())
+	if res := got.all(); len(res) != 1 || res[0].Err != nil {
+		t.Errorf("results = %+v, want the job to run despite the cancelled request", res)
+	}
+	if value != "trace-1" {
+		t.Errorf("job saw value %v, want the request's", value)
+	}
+}
+
+func TestTrySubmit(t *testing.T) {
+	block, started := make(chan struct{}), make(chan struct{}, 2)
+	p := worker.New(worker.WithWorkers(1), worker.WithQueueSize(1))
+	ctx := context.Background()
+	job := worker.Job{Run: func(context.Context) error {
+		started <- struct{}{}
+		<-block
+		return nil
+	}}
+
+	if err := p.TrySubmit(ctx, job); err != nil {
+		t.Fatalf("first TrySubmit: %v", err)
+	}
+	<-started // the worker is busy, the queue empty
+	if err := p.TrySubmit(ctx, job); err != nil {
+		t.Fatalf("second TrySubmit: %v", err)
+	}
+	if err := p.TrySubmit(ctx, job); !errors.Is(err, worker.ErrQueueFull) {
+		t.Errorf("third TrySubmit = %v, want ErrQueueFull", err)
+	}
+
+	sctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := p.Submit(sctx, job); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit to a full queue = %v, want DeadlineExceeded", err)
+	}
+	close(block)
+	if err := p.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	for _, submit := range []func(context.Context, worker.Job) error{p.Submit, p.TrySubmit} {
+		if err := submit(ctx, job); !errors.Is(err, worker.ErrClosed) {
+			t.Errorf("submit after Shutdown = %v, want ErrClosed", err)
+		}
+	}
+}
+
+func TestShutdownGivesUp(t *testing.T) {
+	var got results
+	p := worker.New(worker.WithWorkers(1), worker.WithHook(got.hook))
+	started := make(chan struct{})
+	_ = p.Submit(context.Background(), worker.Job{Name: "slow", Run: func(ctx context.Context) error {
+		close(started)
+		<-ctx.Done()
+		return ctx.Err()
+	}})
+	_ = p.Submit(context.Background(), worker.Job{Name: "queued", Run: func(context.Context) error { return nil }})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := p.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+	res := got.all()
+	if len(res) != 1 || res[0].Name != "slow" || !errors.Is(res[0].Err, context.Canceled) {
+		t.Errorf("results = %+v, want the running job cancelled and the queued one dropped", res)
+	}
+}